@@ -0,0 +1,106 @@
+// apierrors/apierrors.go
+package apierrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Machine-readable error codes returned to clients.
+const (
+	CodeInvalidRequest  = "INVALID_REQUEST"
+	CodeValidation      = "VALIDATION_FAILED"
+	CodeNotFound        = "DYNCRED_NOT_FOUND"
+	CodeInvalidTags     = "INVALID_TAGS"
+	CodeInvalidSelector = "INVALID_SELECTOR"
+	CodePropagation     = "PROPAGATION_FAILED"
+	CodeJobNotFound     = "JOB_NOT_FOUND"
+	CodeNoConflict      = "CONFLICT_NOT_FOUND"
+	CodeInvalidBundle   = "INVALID_BUNDLE"
+	CodeImportConflict  = "IMPORT_CONFLICT"
+	CodeLeaseNotFound   = "LEASE_NOT_FOUND"
+	CodeLeaseInactive   = "LEASE_INACTIVE"
+	CodeMappingNotFound = "MAPPING_NOT_FOUND"
+	CodeMappingExists   = "MAPPING_EXISTS"
+	CodeInvalidMapping  = "INVALID_MAPPING"
+	CodeInvalidProvider = "INVALID_PROVIDER"
+	CodeProvider        = "PROVIDER_FAILED"
+	CodeVersionConflict = "VERSION_CONFLICT"
+	CodeVersionRequired = "VERSION_REQUIRED"
+	CodePolicyViolation = "POLICY_VIOLATION"
+	CodeInvalidPolicy   = "INVALID_POLICY"
+	CodeTeamNotFound    = "TEAM_NOT_FOUND"
+	CodeTeamExists      = "TEAM_EXISTS"
+	CodeInvalidTeam     = "INVALID_TEAM"
+	CodeTeamNotEmpty    = "TEAM_NOT_EMPTY"
+	CodeMemberNotFound  = "MEMBER_NOT_FOUND"
+	CodeLastTeamAdmin   = "LAST_TEAM_ADMIN"
+	CodeTeamForbidden   = "TEAM_ACCESS_DENIED"
+	CodeAdminForbidden  = "ADMIN_ACCESS_DENIED"
+	CodeUnauthenticated = "UNAUTHENTICATED"
+	CodeMaintenance     = "MAINTENANCE"
+	CodeApprovalMissing = "APPROVAL_NOT_FOUND"
+	CodeApprovalDecided = "APPROVAL_DECIDED"
+	CodeSelfApproval    = "SELF_APPROVAL"
+	CodeInternal        = "INTERNAL_ERROR"
+)
+
+// Error is an error carrying the HTTP status and code to report to clients.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details any
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New creates an Error with the given status, code and message.
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Wrap creates an Error that keeps err as its cause.
+func Wrap(err error, status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message, Err: err}
+}
+
+// WithDetails attaches structured details to the error.
+func (e *Error) WithDetails(details any) *Error {
+	e.Details = details
+	return e
+}
+
+// FieldError describes a single failed field validation.
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+// InvalidRequest converts a request binding error into an Error, listing
+// per-field validation failures as details when available.
+func InvalidRequest(err error) *Error {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		fields := make([]FieldError, 0, len(verrs))
+		for _, fe := range verrs {
+			fields = append(fields, FieldError{Field: fe.Field(), Rule: fe.Tag(), Param: fe.Param()})
+		}
+		return Wrap(err, http.StatusBadRequest, CodeValidation, "Request validation failed").WithDetails(fields)
+	}
+	return Wrap(err, http.StatusBadRequest, CodeInvalidRequest, "Malformed request body")
+}
@@ -0,0 +1,115 @@
+// archive/archive.go
+
+// Package archive keeps a copy of dynamic credentials before they are
+// purged, as gzip-compressed JSON written to a local directory or a Google
+// Cloud Storage bucket. Archives never contain secrets, which dcreds does
+// not store.
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"test-go/models"
+	"time"
+)
+
+// Record is a purged credential as archived, with its rotation history.
+type Record struct {
+	Credential models.DynamicCredential `json:"dyncred"`
+	History    []models.RotationEvent   `json:"history,omitempty"`
+}
+
+// Archive is the document written for one purge run.
+type Archive struct {
+	PurgedAt time.Time `json:"purged_at"`
+	Records  []Record  `json:"dyncreds"`
+}
+
+// Archiver stores archives durably enough that the credentials in them
+// can be deleted once Store returns.
+type Archiver interface {
+	Store(ctx context.Context, a Archive) error
+}
+
+// Name returns the object name of an archive, sorting by purge time.
+func Name(a Archive) string {
+	return "dcreds-purge-" + a.PurgedAt.UTC().Format("20060102T150405.000000000Z") + ".json.gz"
+}
+
+// Encode writes a as gzip-compressed JSON.
+func Encode(w io.Writer, a Archive) error {
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(a); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Decode reads an archive written by Encode.
+func Decode(r io.Reader) (*Archive, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var a Archive
+	if err := json.NewDecoder(zr).Decode(&a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Dir writes archives as files in a local directory.
+type Dir struct {
+	Path string
+}
+
+// Store writes the archive to a temporary file and renames it into place,
+// so readers never see a partial archive.
+func (d Dir) Store(ctx context.Context, a Archive) error {
+	if err := os.MkdirAll(d.Path, 0o700); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	f, err := os.CreateTemp(d.Path, ".dcreds-purge-*")
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if err := Encode(f, a); err != nil {
+		f.Close()
+		return fmt.Errorf("archive: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	if err := os.Rename(f.Name(), filepath.Join(d.Path, Name(a))); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	return nil
+}
+
+// Parse returns the archiver for target, either a gs://bucket/prefix URL
+// or a local directory.
+func Parse(ctx context.Context, target string) (Archiver, error) {
+	if target == "" {
+		return nil, fmt.Errorf("archive: no target")
+	}
+	if rest, ok := strings.CutPrefix(target, "gs://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("archive: %q names no bucket", target)
+		}
+		return NewGCS(ctx, bucket, prefix)
+	}
+	return Dir{Path: target}, nil
+}
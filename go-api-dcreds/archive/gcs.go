@@ -0,0 +1,72 @@
+// archive/gcs.go
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// GCS uploads archives to a Google Cloud Storage bucket, under Prefix.
+type GCS struct {
+	Bucket string
+	Prefix string
+	// Endpoint is the Cloud Storage upload API base URL.
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// NewGCS creates the archiver with Application Default Credentials.
+func NewGCS(ctx context.Context, bucket, prefix string) (*GCS, error) {
+	ts, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/devstorage.read_write")
+	if err != nil {
+		return nil, err
+	}
+	client := oauth2.NewClient(ctx, ts)
+	client.Timeout = 5 * time.Minute
+	return &GCS{
+		Bucket:     bucket,
+		Prefix:     prefix,
+		Endpoint:   "https://storage.googleapis.com/upload/storage/v1",
+		HTTPClient: client,
+	}, nil
+}
+
+// Store uploads the archive as a single object. Existing objects are never
+// overwritten.
+func (g *GCS) Store(ctx context.Context, a Archive) error {
+	var body bytes.Buffer
+	if err := Encode(&body, a); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	query := url.Values{
+		"uploadType":        {"media"},
+		"name":              {path.Join(g.Prefix, Name(a))},
+		"ifGenerationMatch": {"0"},
+	}
+	endpoint := g.Endpoint + "/b/" + url.PathEscape(g.Bucket) + "/o?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("archive: upload to gs://%s: %d %s", g.Bucket, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
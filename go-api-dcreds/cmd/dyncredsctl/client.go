@@ -0,0 +1,179 @@
+// cmd/dyncredsctl/client.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"test-go/models"
+	"time"
+)
+
+// client calls the /dyncreds REST API.
+type client struct {
+	baseURL    string
+	user       string
+	httpClient *http.Client
+}
+
+// newClient returns a client for server. user, if set, is sent as the
+// X-User header naming the caller.
+func newClient(server, user string, timeout time.Duration) *client {
+	return &client{
+		baseURL:    strings.TrimRight(server, "/"),
+		user:       user,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// apiError is a failed API response.
+type apiError struct {
+	Status int
+	models.ErrorResponse
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%s (%d %s)", e.Message, e.Status, e.Code)
+	if e.Details != nil {
+		msg += fmt.Sprintf(": %v", e.Details)
+	}
+	return msg
+}
+
+// transportError is a request that never got an API response.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string { return e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+// do sends a JSON request and decodes the JSON response into out. Extra
+// headers are set on the request; the response headers are returned.
+func (c *client) do(ctx context.Context, method, path string, headers map[string]string, body, out any) (http.Header, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.user != "" {
+		req.Header.Set("X-User", c.user)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &transportError{err}
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &transportError{err}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &apiError{Status: resp.StatusCode}
+		if json.Unmarshal(data, &apiErr.ErrorResponse) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+			if apiErr.Message == "" {
+				apiErr.Message = http.StatusText(resp.StatusCode)
+			}
+		}
+		return nil, apiErr
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("decode %s %s response: %w", method, path, err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// credentialResponse is the body of single-credential responses.
+type credentialResponse struct {
+	Message  string                    `json:"message,omitempty"`
+	Dyncred  *models.DynamicCredential `json:"dyncred"`
+	Rotation *models.RotationEvent     `json:"rotation,omitempty"`
+}
+
+func credentialPath(id string) string {
+	return "/dyncreds/" + url.PathEscape(id)
+}
+
+func (c *client) create(ctx context.Context, req models.CreateDynamicCredentialRequest) (*models.DynamicCredential, error) {
+	var resp credentialResponse
+	if _, err := c.do(ctx, http.MethodPost, "/dyncreds", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Dyncred, nil
+}
+
+func (c *client) get(ctx context.Context, id string) (*models.DynamicCredential, error) {
+	var resp credentialResponse
+	if _, err := c.do(ctx, http.MethodGet, credentialPath(id), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Dyncred, nil
+}
+
+func (c *client) list(ctx context.Context, selector string) ([]*models.DynamicCredential, error) {
+	path := "/dyncreds"
+	if selector != "" {
+		path += "?selector=" + url.QueryEscape(selector)
+	}
+	var resp struct {
+		Dyncreds []*models.DynamicCredential `json:"dyncreds"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, path, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Dyncreds, nil
+}
+
+// update replaces the credential's fields if it is still at version.
+func (c *client) update(ctx context.Context, id string, version int, req models.UpdateDynamicCredentialRequest) (*models.DynamicCredential, error) {
+	headers := map[string]string{"If-Match": strconv.Quote(strconv.Itoa(version))}
+	var resp credentialResponse
+	if _, err := c.do(ctx, http.MethodPut, credentialPath(id), headers, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Dyncred, nil
+}
+
+// delete deletes credential id. When the server requires two-person
+// approval, nothing is deleted yet and the pending approval is returned.
+func (c *client) delete(ctx context.Context, id string) (*models.Approval, error) {
+	var resp struct {
+		Approval *models.Approval `json:"approval"`
+	}
+	if _, err := c.do(ctx, http.MethodDelete, credentialPath(id), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Approval, nil
+}
+
+func (c *client) rotate(ctx context.Context, id string) (*credentialResponse, error) {
+	var resp credentialResponse
+	if _, err := c.do(ctx, http.MethodPost, credentialPath(id)+"/rotate", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,234 @@
+// cmd/dyncredsctl/commands.go
+package main
+
+import (
+	"fmt"
+	"strings"
+	"test-go/models"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// exactArgs requires the named positional arguments, reporting a usage
+// error otherwise.
+func exactArgs(names ...string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) != len(names) {
+			return usageErrorf("%s requires %s", cmd.CommandPath(), strings.Join(names, " "))
+		}
+		return nil
+	}
+}
+
+// parseKeyValues parses repeated key=value flags.
+func parseKeyValues(flag string, pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, usageErrorf("invalid --%s %q: want key=value", flag, pair)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+func newCreateCmd(opts *options) *cobra.Command {
+	var (
+		req            models.CreateDynamicCredentialRequest
+		tags, settings []string
+	)
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a dynamic credential",
+		Long: `Create a dynamic credential. Its first secret is printed once and
+cannot be retrieved again.`,
+		Example: `  dyncredsctl create --name ci-deploy --ttl 3600 --tag team=infra
+  dyncredsctl create --name app --ttl 900 --provider aws --provider-config role_arn=arn:aws:iam::123456789012:role/app`,
+		Args: exactArgs(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if req.Name == "" {
+				return usageErrorf("--name is required")
+			}
+			if req.TTL <= 0 {
+				return usageErrorf("--ttl must be greater than 0")
+			}
+			var err error
+			if req.Tags, err = parseKeyValues("tag", tags); err != nil {
+				return err
+			}
+			if req.ProviderConfig, err = parseKeyValues("provider-config", settings); err != nil {
+				return err
+			}
+			cred, err := opts.client.create(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+			return opts.printCredential(cmd.OutOrStdout(), cred)
+		},
+	}
+	cmd.Flags().StringVar(&req.Name, "name", "", "credential name (required)")
+	cmd.Flags().IntVar(&req.TTL, "ttl", 0, "TTL in seconds (required)")
+	cmd.Flags().StringVar(&req.Owner, "owner", "", "owner notified before forced rotations")
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "tag as key=value (repeatable)")
+	cmd.Flags().StringVar(&req.Provider, "provider", "", `credential provider (default "token")`)
+	cmd.Flags().StringArrayVar(&settings, "provider-config", nil, "provider setting as key=value (repeatable)")
+	return cmd
+}
+
+func newGetCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get ID",
+		Short: "Show a dynamic credential",
+		Args:  exactArgs("ID"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cred, err := opts.client.get(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return opts.printCredential(cmd.OutOrStdout(), cred)
+		},
+	}
+}
+
+func newListCmd(opts *options) *cobra.Command {
+	var selector string
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List dynamic credentials",
+		Example: `  dyncredsctl list --selector 'team=infra,env!=prod'
+  dyncredsctl list -o json | jq -r '.[].id'`,
+		Args: exactArgs(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			creds, err := opts.client.list(cmd.Context(), selector)
+			if err != nil {
+				return err
+			}
+			return opts.printCredentials(cmd.OutOrStdout(), creds)
+		},
+	}
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "tag selector, e.g. team=infra,env!=prod")
+	return cmd
+}
+
+func newUpdateCmd(opts *options) *cobra.Command {
+	var (
+		name     string
+		ttl      int
+		tags     []string
+		clearTag bool
+		version  int
+	)
+	cmd := &cobra.Command{
+		Use:   "update ID",
+		Short: "Update a dynamic credential's name, TTL or tags",
+		Long: `Update a dynamic credential's name, TTL or tags. Fields that are not
+given keep their current values.
+
+The update only applies if the credential has not changed since it was
+read; pass --version to require a specific version instead, e.g. one
+seen earlier in a pipeline. A conflicting change exits with code 4.`,
+		Example: `  dyncredsctl update 6f1c... --ttl 7200
+  dyncredsctl update 6f1c... --tag env=prod --version 3`,
+		Args: exactArgs("ID"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			if !flags.Changed("name") && !flags.Changed("ttl") && !flags.Changed("tag") && !clearTag {
+				return usageErrorf("nothing to update: set --name, --ttl, --tag or --clear-tags")
+			}
+			newTags, err := parseKeyValues("tag", tags)
+			if err != nil {
+				return err
+			}
+
+			cred, err := opts.client.get(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			req := models.UpdateDynamicCredentialRequest{Name: cred.Name, TTL: cred.TTL, Tags: cred.Tags}
+			if flags.Changed("name") {
+				req.Name = name
+			}
+			if flags.Changed("ttl") {
+				req.TTL = ttl
+			}
+			if clearTag {
+				req.Tags = nil
+			}
+			if len(newTags) > 0 && req.Tags == nil {
+				req.Tags = make(map[string]string, len(newTags))
+			}
+			for k, v := range newTags {
+				req.Tags[k] = v
+			}
+			if !flags.Changed("version") {
+				version = cred.Version
+			}
+
+			updated, err := opts.client.update(cmd.Context(), args[0], version, req)
+			if err != nil {
+				return err
+			}
+			return opts.printCredential(cmd.OutOrStdout(), updated)
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", "", "new name")
+	cmd.Flags().IntVar(&ttl, "ttl", 0, "new TTL in seconds")
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "set a tag as key=value (repeatable)")
+	cmd.Flags().BoolVar(&clearTag, "clear-tags", false, "remove all existing tags before applying --tag")
+	cmd.Flags().IntVar(&version, "version", 0, "expected credential version (default: the version just read)")
+	return cmd
+}
+
+func newDeleteCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:     "delete ID",
+		Aliases: []string{"rm"},
+		Short:   "Delete a dynamic credential and revoke its secrets",
+		Args:    exactArgs("ID"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			approval, err := opts.client.delete(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			if approval != nil {
+				if opts.output == outputJSON {
+					return printJSON(cmd.OutOrStdout(), approval)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Deletion of dynamic credential %s awaits approval %s by a second admin, until %s\n",
+					args[0], approval.ID, approval.ExpiresAt.Format(time.RFC3339))
+				return nil
+			}
+			if opts.output == outputJSON {
+				return printJSON(cmd.OutOrStdout(), map[string]string{"id": args[0]})
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Deleted dynamic credential %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newRotateCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rotate ID",
+		Short: "Rotate a dynamic credential to a new generation",
+		Long: `Rotate a dynamic credential to a new generation with a fresh secret,
+revoking the previous one. The new secret is printed once.`,
+		Args: exactArgs("ID"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := opts.client.rotate(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			if opts.output == outputJSON {
+				return printJSON(cmd.OutOrStdout(), resp)
+			}
+			return opts.printCredential(cmd.OutOrStdout(), resp.Dyncred)
+		},
+	}
+}
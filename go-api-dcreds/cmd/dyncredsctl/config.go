@@ -0,0 +1,103 @@
+// cmd/dyncredsctl/config.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultServer  = "http://localhost:8080"
+	defaultProfile = "default"
+)
+
+// Profile is a named dyncreds server.
+type Profile struct {
+	Server string `yaml:"server"`
+	// Output is the default output format for this profile.
+	Output string `yaml:"output,omitempty"`
+}
+
+// Config is the dyncredsctl config file.
+type Config struct {
+	CurrentProfile string             `yaml:"current_profile,omitempty"`
+	Profiles       map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+// configPath returns $DYNCREDSCTL_CONFIG, or config.yaml in the user's
+// config directory.
+func configPath() (string, error) {
+	if path := os.Getenv("DYNCREDSCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dyncredsctl", "config.yaml"), nil
+}
+
+// loadConfig reads the config file; a missing file is an empty config.
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{Profiles: map[string]Profile{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]Profile{}
+	}
+	return cfg, nil
+}
+
+// save writes the config file, readable only by the user.
+func (cfg *Config) save(path string) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// profile returns the named profile, or the current one when name is
+// empty. Without a config file the default profile points at a local server.
+func (cfg *Config) profile(name string) (string, Profile, error) {
+	if name == "" {
+		name = cfg.CurrentProfile
+	}
+	if name == "" {
+		name = defaultProfile
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		if name == defaultProfile {
+			return name, Profile{Server: defaultServer}, nil
+		}
+		return "", Profile{}, usageErrorf("profile %q is not configured", name)
+	}
+	return name, p, nil
+}
+
+// profileNames returns the configured profile names, sorted.
+func (cfg *Config) profileNames() []string {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
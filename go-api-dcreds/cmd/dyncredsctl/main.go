@@ -0,0 +1,171 @@
+// cmd/dyncredsctl/main.go
+
+// Command dyncredsctl manages dynamic credentials through the dyncreds REST
+// API.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes, stable for scripts.
+const (
+	exitOK          = 0
+	exitError       = 1 // unexpected or internal server error
+	exitUsage       = 2 // invalid flags, arguments or request
+	exitNotFound    = 3 // the credential does not exist
+	exitConflict    = 4 // a concurrent change or version mismatch
+	exitUnavailable = 5 // the server or an upstream provider is unreachable
+)
+
+// usageError is an error in how dyncredsctl was invoked.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+func (e *usageError) Unwrap() error { return e.err }
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{fmt.Errorf(format, args...)}
+}
+
+// exitCode returns the exit code reporting err.
+func exitCode(err error) int {
+	var usageErr *usageError
+	var apiErr *apiError
+	var transportErr *transportError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.As(err, &transportErr):
+		return exitUnavailable
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.Status == http.StatusNotFound:
+			return exitNotFound
+		case apiErr.Status == http.StatusConflict, apiErr.Status == http.StatusPreconditionRequired:
+			return exitConflict
+		case apiErr.Status == http.StatusBadGateway, apiErr.Status == http.StatusServiceUnavailable,
+			apiErr.Status == http.StatusGatewayTimeout:
+			return exitUnavailable
+		case apiErr.Status >= 400 && apiErr.Status < 500:
+			return exitUsage
+		}
+	}
+	return exitError
+}
+
+// options are the global flags, resolved against the config file before
+// each command runs.
+type options struct {
+	profile string
+	server  string
+	user    string
+	output  string
+	timeout time.Duration
+
+	configPath string
+	config     *Config
+	client     *client
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:   "dyncredsctl",
+		Short: "Manage dynamic credentials",
+		Long: `dyncredsctl manages dynamic credentials through the dyncreds REST API.
+
+Servers are configured as named profiles (see "dyncredsctl profile"); --server
+and DYNCREDSCTL_SERVER override the profile's server for one invocation.
+
+Exit codes:
+  0  success
+  1  unexpected or internal server error
+  2  invalid flags, arguments or request
+  3  dynamic credential not found
+  4  conflict, e.g. the credential changed since it was read
+  5  server or credential provider unavailable`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return opts.resolve(cmd)
+		},
+	}
+	root.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &usageError{err}
+	})
+
+	flags := root.PersistentFlags()
+	flags.StringVarP(&opts.profile, "profile", "p", os.Getenv("DYNCREDSCTL_PROFILE"), "config profile to use (env DYNCREDSCTL_PROFILE)")
+	flags.StringVar(&opts.server, "server", os.Getenv("DYNCREDSCTL_SERVER"), "dyncreds server URL, overriding the profile (env DYNCREDSCTL_SERVER)")
+	flags.StringVar(&opts.user, "user", os.Getenv("DYNCREDSCTL_USER"), "user to act as, sent in the X-User header (env DYNCREDSCTL_USER)")
+	flags.StringVarP(&opts.output, "output", "o", "", "output format: table or json (default from the profile, else table)")
+	flags.DurationVar(&opts.timeout, "timeout", 30*time.Second, "timeout for each API request")
+
+	root.AddCommand(
+		newCreateCmd(opts),
+		newGetCmd(opts),
+		newListCmd(opts),
+		newUpdateCmd(opts),
+		newDeleteCmd(opts),
+		newRotateCmd(opts),
+		newProfileCmd(opts),
+	)
+	return root
+}
+
+// resolve loads the config file and applies the selected profile to the
+// flags that were not set.
+func (o *options) resolve(cmd *cobra.Command) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	o.configPath, o.config = path, cfg
+
+	// Profile management commands work on the file, not a server.
+	if cmd.Parent() != nil && cmd.Parent().Name() == "profile" {
+		return nil
+	}
+	_, profile, err := cfg.profile(o.profile)
+	if err != nil {
+		return err
+	}
+	if o.server == "" {
+		o.server = profile.Server
+	}
+	if o.output == "" {
+		o.output = profile.Output
+	}
+	if o.output == "" {
+		o.output = outputTable
+	}
+	if o.output != outputTable && o.output != outputJSON {
+		return usageErrorf("invalid --output %q: must be %s or %s", o.output, outputTable, outputJSON)
+	}
+	o.client = newClient(o.server, o.user, o.timeout)
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+	if err := newRootCmd().ExecuteContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+}
@@ -0,0 +1,106 @@
+// cmd/dyncredsctl/output.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"test-go/models"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printCredential prints one credential as JSON or as a field list,
+// followed by its secret when the API returned one.
+func (o *options) printCredential(w io.Writer, cred *models.DynamicCredential) error {
+	if o.output == outputJSON {
+		return printJSON(w, cred)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	row := func(field, value string) {
+		if value != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", field, value)
+		}
+	}
+	row("ID", cred.ID)
+	row("Name", cred.Name)
+	row("TTL", strconv.Itoa(cred.TTL)+"s")
+	row("Owner", cred.Owner)
+	row("Tags", formatMap(cred.Tags))
+	row("Provider", cred.Provider)
+	row("Provider config", formatMap(cred.ProviderConfig))
+	row("Provider key", cred.ProviderKeyID)
+	row("Generation", strconv.Itoa(cred.Generation))
+	row("Version", strconv.Itoa(cred.Version))
+	row("Created", formatTime(cred.CreatedAt))
+	row("Issued", formatTime(cred.IssuedAt))
+	row("Expires", formatTime(cred.ExpiresAt))
+	if cred.RotationDueAt != nil {
+		row("Rotation due", formatTime(*cred.RotationDueAt))
+	}
+	if len(cred.Secret) > 0 {
+		fmt.Fprintln(tw, "Secret (shown once):")
+		for _, k := range sortedKeys(cred.Secret) {
+			fmt.Fprintf(tw, "  %s:\t%s\n", k, cred.Secret[k])
+		}
+	}
+	return tw.Flush()
+}
+
+// printCredentials prints credentials as a JSON array or a table.
+func (o *options) printCredentials(w io.Writer, creds []*models.DynamicCredential) error {
+	if o.output == outputJSON {
+		if creds == nil {
+			creds = []*models.DynamicCredential{}
+		}
+		return printJSON(w, creds)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tTTL\tPROVIDER\tGEN\tVERSION\tEXPIRES\tTAGS")
+	for _, cred := range creds {
+		fmt.Fprintf(tw, "%s\t%s\t%ds\t%s\t%d\t%d\t%s\t%s\n",
+			cred.ID, cred.Name, cred.TTL, cred.Provider, cred.Generation, cred.Version,
+			formatTime(cred.ExpiresAt), formatMap(cred.Tags))
+	}
+	return tw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatMap renders m as sorted key=value pairs.
+func formatMap(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		pairs = append(pairs, k+"="+m[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
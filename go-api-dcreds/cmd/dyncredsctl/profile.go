@@ -0,0 +1,100 @@
+// cmd/dyncredsctl/profile.go
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func newProfileCmd(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage server profiles in the config file",
+		Long: `Manage server profiles in the config file, $DYNCREDSCTL_CONFIG or
+dyncredsctl/config.yaml in the user's config directory.`,
+	}
+	cmd.AddCommand(newProfileSetCmd(opts), newProfileUseCmd(opts), newProfileListCmd(opts))
+	return cmd
+}
+
+func newProfileSetCmd(opts *options) *cobra.Command {
+	var server, output string
+	cmd := &cobra.Command{
+		Use:     "set NAME",
+		Short:   "Create or update a profile",
+		Example: `  dyncredsctl profile set prod --server https://dyncreds.example.com --output json`,
+		Args:    exactArgs("NAME"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "" && output != outputTable && output != outputJSON {
+				return usageErrorf("invalid --output %q: must be %s or %s", output, outputTable, outputJSON)
+			}
+			name := args[0]
+			p, exists := opts.config.Profiles[name]
+			if !exists && server == "" {
+				return usageErrorf("--server is required for a new profile")
+			}
+			if server != "" {
+				p.Server = server
+			}
+			if cmd.Flags().Changed("output") {
+				p.Output = output
+			}
+			opts.config.Profiles[name] = p
+			if opts.config.CurrentProfile == "" {
+				opts.config.CurrentProfile = name
+			}
+			if err := opts.config.save(opts.configPath); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Saved profile %s\n", name)
+			return nil
+		},
+	}
+	// The root --server and --output flags are shadowed to edit the profile.
+	cmd.Flags().StringVar(&server, "server", "", "dyncreds server URL")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "default output format: table or json")
+	return cmd
+}
+
+func newProfileUseCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "use NAME",
+		Short: "Make a profile the current one",
+		Args:  exactArgs("NAME"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, ok := opts.config.Profiles[args[0]]; !ok {
+				return usageErrorf("profile %q is not configured", args[0])
+			}
+			opts.config.CurrentProfile = args[0]
+			if err := opts.config.save(opts.configPath); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Switched to profile %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newProfileListCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List profiles",
+		Args:  exactArgs(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			current, _, _ := opts.config.profile("")
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "CURRENT\tNAME\tSERVER\tOUTPUT")
+			for _, name := range opts.config.profileNames() {
+				p := opts.config.Profiles[name]
+				marker := ""
+				if name == current {
+					marker = "*"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", marker, name, p.Server, p.Output)
+			}
+			return tw.Flush()
+		},
+	}
+}
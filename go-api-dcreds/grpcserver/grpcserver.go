@@ -0,0 +1,243 @@
+// grpcserver/grpcserver.go
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"test-go/models"
+	"test-go/pb"
+	"test-go/policy"
+	"test-go/providers"
+	"test-go/services"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server implements pb.DynamicCredentialsServer on top of the services layer
+// shared with the REST handlers.
+type Server struct {
+	pb.UnimplementedDynamicCredentialsServer
+}
+
+// New creates a gRPC server with the DynamicCredentials service registered.
+// Like the REST API, it refuses changes in maintenance mode.
+func New(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{grpc.ChainUnaryInterceptor(maintenanceInterceptor)}, opts...)
+	s := grpc.NewServer(opts...)
+	pb.RegisterDynamicCredentialsServer(s, &Server{})
+	return s
+}
+
+// readOnlyMethods lists the RPCs served in maintenance mode; any other
+// could change something.
+var readOnlyMethods = map[string]bool{
+	pb.DynamicCredentials_GetDynamicCredential_FullMethodName:   true,
+	pb.DynamicCredentials_ListDynamicCredentials_FullMethodName: true,
+}
+
+// maintenanceInterceptor refuses RPCs that could change anything while
+// maintenance mode is enabled.
+func maintenanceInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !readOnlyMethods[info.FullMethod] {
+		if err := services.CheckWritable(); err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	return handler(ctx, req)
+}
+
+// CreateDynamicCredential creates a new dynamic credential.
+func (s *Server) CreateDynamicCredential(ctx context.Context, in *pb.CreateDynamicCredentialRequest) (*pb.DynamicCredential, error) {
+	if in.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if in.GetTtl() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "ttl must be greater than 0")
+	}
+	cred, err := services.CreateDynamicCredential(ctx, models.CreateDynamicCredentialRequest{
+		Name:           in.GetName(),
+		TTL:            int(in.GetTtl()),
+		Tags:           in.GetTags(),
+		Owner:          in.GetOwner(),
+		Provider:       in.GetProvider(),
+		ProviderConfig: in.GetProviderConfig(),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(cred), nil
+}
+
+// GetDynamicCredential retrieves a dynamic credential by ID, counting it as
+// a use.
+func (s *Server) GetDynamicCredential(ctx context.Context, in *pb.GetDynamicCredentialRequest) (*pb.DynamicCredential, error) {
+	if err := checkTeamless(ctx, in.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+	cred, err := services.FetchDynamicCredential(ctx, in.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(cred), nil
+}
+
+// ListDynamicCredentials lists credentials matching an optional selector.
+func (s *Server) ListDynamicCredentials(ctx context.Context, in *pb.ListDynamicCredentialsRequest) (*pb.ListDynamicCredentialsResponse, error) {
+	selector, err := services.ParseSelector(in.GetSelector())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &pb.ListDynamicCredentialsResponse{}
+	for _, cred := range services.ListDynamicCredentials(ctx, selector) {
+		resp.Dyncreds = append(resp.Dyncreds, toProto(cred))
+	}
+	return resp, nil
+}
+
+// UpdateDynamicCredential replaces the name, TTL and tags of a credential.
+func (s *Server) UpdateDynamicCredential(ctx context.Context, in *pb.UpdateDynamicCredentialRequest) (*pb.DynamicCredential, error) {
+	if in.GetExpectedVersion() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "expected_version is required")
+	}
+	if in.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if in.GetTtl() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "ttl must be greater than 0")
+	}
+	if err := checkTeamless(ctx, in.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+	cred, err := services.UpdateDynamicCredential(ctx, in.GetId(), int(in.GetExpectedVersion()), models.UpdateDynamicCredentialRequest{
+		Name: in.GetName(),
+		TTL:  int(in.GetTtl()),
+		Tags: in.GetTags(),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(cred), nil
+}
+
+// UpdateTTL updates the TTL and propagates it to Terraform workspaces.
+func (s *Server) UpdateTTL(ctx context.Context, in *pb.UpdateTTLRequest) (*pb.DynamicCredential, error) {
+	if in.GetExpectedVersion() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "expected_version is required")
+	}
+	if in.GetTtl() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "ttl must be greater than 0")
+	}
+	// The gRPC API does not know its callers, so it cannot request approvals.
+	if services.ApprovalsEnabled() {
+		return nil, status.Error(codes.FailedPrecondition,
+			"TTL changes need a second admin's approval; use PATCH /dyncreds/{id} on the HTTP API")
+	}
+	if err := checkTeamless(ctx, in.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+	cred, err := services.UpdateDynamicCredentialTTL(ctx, in.GetId(), int(in.GetExpectedVersion()), int(in.GetTtl()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if _, err := services.UpdateTTLForAllWorkspaces(ctx, in.GetId(), int(in.GetTtl())); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to update TTL in workspaces: %v", err)
+	}
+	return toProto(cred), nil
+}
+
+// DeleteDynamicCredential deletes a dynamic credential by ID.
+func (s *Server) DeleteDynamicCredential(ctx context.Context, in *pb.DeleteDynamicCredentialRequest) (*pb.DeleteDynamicCredentialResponse, error) {
+	// The gRPC API does not know its callers, so it cannot request approvals.
+	if services.ApprovalsEnabled() {
+		return nil, status.Error(codes.FailedPrecondition,
+			"deletions need a second admin's approval; use DELETE /dyncreds/{id} on the HTTP API")
+	}
+	if err := checkTeamless(ctx, in.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+	if err := services.DeleteDynamicCredential(ctx, in.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.DeleteDynamicCredentialResponse{Id: in.GetId()}, nil
+}
+
+// RotateDynamicCredential issues a new generation of a credential.
+func (s *Server) RotateDynamicCredential(ctx context.Context, in *pb.RotateDynamicCredentialRequest) (*pb.RotateDynamicCredentialResponse, error) {
+	if err := checkTeamless(ctx, in.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+	cred, event, err := services.RotateDynamicCredential(ctx, in.GetId(), services.RotationReasonManual)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.RotateDynamicCredentialResponse{
+		Dyncred: toProto(cred),
+		Rotation: &pb.RotationEvent{
+			DyncredId:    event.CredentialID,
+			Generation:   int32(event.Generation),
+			Reason:       event.Reason,
+			RotatedAt:    timestamppb.New(event.RotatedAt),
+			PreviousTtl:  int32(event.PreviousTTL),
+			EffectiveTtl: int32(event.EffectiveTTL),
+		},
+	}, nil
+}
+
+// checkTeamless reports team credentials as not found: the gRPC API does
+// not know its callers, so it cannot check their team membership.
+func checkTeamless(ctx context.Context, id string) error {
+	_, err := services.GetTeamCredential(ctx, "", id)
+	return err
+}
+
+// toStatus maps service errors to gRPC status codes.
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidTags), errors.Is(err, services.ErrInvalidSelector),
+		errors.Is(err, providers.ErrUnknownProvider), errors.Is(err, providers.ErrInvalidConfig):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, policy.ErrViolation):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, services.ErrVersionMismatch):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, services.ErrProvider), errors.Is(err, services.ErrMaintenance):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func toProto(cred *models.DynamicCredential) *pb.DynamicCredential {
+	out := &pb.DynamicCredential{
+		Id:             cred.ID,
+		Name:           cred.Name,
+		Ttl:            int32(cred.TTL),
+		Tags:           cred.Tags,
+		Owner:          cred.Owner,
+		Generation:     int32(cred.Generation),
+		Version:        int32(cred.Version),
+		CreatedAt:      timestamppb.New(cred.CreatedAt),
+		IssuedAt:       timestamppb.New(cred.IssuedAt),
+		ExpiresAt:      timestamppb.New(cred.ExpiresAt),
+		Provider:       cred.Provider,
+		ProviderConfig: cred.ProviderConfig,
+		ProviderKeyId:  cred.ProviderKeyID,
+		Secret:         cred.Secret,
+		UseCount:       cred.UseCount,
+	}
+	if cred.RotationDueAt != nil {
+		out.RotationDueAt = timestamppb.New(*cred.RotationDueAt)
+	}
+	if cred.SecretExpiresAt != nil {
+		out.SecretExpiresAt = timestamppb.New(*cred.SecretExpiresAt)
+	}
+	if cred.LastUsedAt != nil {
+		out.LastUsedAt = timestamppb.New(*cred.LastUsedAt)
+	}
+	return out
+}
@@ -0,0 +1,93 @@
+// handlers/approvals.go
+package handlers
+
+import (
+	"net/http"
+	"test-go/apierrors"
+	"test-go/middleware"
+	"test-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rejectApprovalRequest is the optional body of POST /approvals/:approvalId/reject.
+type rejectApprovalRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ListApprovalsHandler handles GET /approvals
+//
+// The status query parameter filters the approvals by state.
+func ListApprovalsHandler(c *gin.Context) {
+	list, err := services.ListApprovals(c.Query("status"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"approvals": list,
+		"count":     len(list),
+	})
+}
+
+// GetApprovalHandler handles GET /approvals/:approvalId
+func GetApprovalHandler(c *gin.Context) {
+	approval, err := services.GetApproval(c.Param("approvalId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"approval": approval,
+	})
+}
+
+// ApproveHandler handles POST /approvals/:approvalId/approve
+//
+// The approved operation runs before the response is sent.
+func ApproveHandler(c *gin.Context) {
+	approval, err := services.ApproveRequest(c.Request.Context(), c.Param("approvalId"), middleware.User(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Approval executed successfully",
+		"approval": approval,
+	})
+}
+
+// RejectHandler handles POST /approvals/:approvalId/reject
+func RejectHandler(c *gin.Context) {
+	var req rejectApprovalRequest
+	// The reason is optional, so an empty body is fine.
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(apierrors.InvalidRequest(err))
+			return
+		}
+	}
+
+	approval, err := services.RejectRequest(c.Param("approvalId"), middleware.User(c), req.Reason)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Approval rejected",
+		"approval": approval,
+	})
+}
+
+// respondPendingApproval answers 202 with approval, for operations that
+// wait for a second admin.
+func respondPendingApproval(c *gin.Context, approval any) {
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Awaiting approval by a second admin",
+		"approval": approval,
+	})
+}
@@ -0,0 +1,93 @@
+// handlers/events.go
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"test-go/apierrors"
+	"test-go/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventKeepAlive is how often an idle event stream sends a comment, so
+// proxies do not close it.
+const eventKeepAlive = 15 * time.Second
+
+// CredentialEventsHandler handles GET /dyncreds/events?type=created,deleted&selector=env=prod
+// and GET /teams/:team/dyncreds/events
+//
+// Events are sent as Server-Sent Events named after their type, with the
+// event as JSON data. Clients resume after a disconnect by sending the last
+// event ID they saw in Last-Event-ID, or in after. The stream can also be
+// narrowed to one credential with dyncredId, or to one team with team,
+// which is implied under /teams/:team.
+func CredentialEventsHandler(c *gin.Context) {
+	types, err := services.ParseEventTypes(c.Query("type"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	selector, err := services.ParseSelector(c.Query("selector"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	filter := services.EventFilter{
+		Types:        types,
+		CredentialID: c.Query("dyncredId"),
+		Team:         c.Query("team"),
+		Selector:     selector,
+	}
+	if team := c.Param("team"); team != "" {
+		filter.Team = team
+	}
+
+	var after uint64
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("after")
+	}
+	if raw != "" {
+		if after, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			c.Error(apierrors.New(http.StatusBadRequest, apierrors.CodeInvalidRequest,
+				"Last-Event-ID must be an event ID").WithDetails(gin.H{"last_event_id": raw}))
+			return
+		}
+	}
+
+	events, cancel := services.SubscribeEvents(after, filter)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case e, ok := <-events:
+			if !ok {
+				return false
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return false
+			}
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			return err == nil
+		}
+	})
+}
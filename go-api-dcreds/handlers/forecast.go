@@ -0,0 +1,97 @@
+// handlers/forecast.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"test-go/apierrors"
+	"test-go/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultForecastWindow is used when GET /dyncreds/expiring has no within.
+const defaultForecastWindow = 72 * time.Hour
+
+// ListExpiringCredentialsHandler handles GET /dyncreds/expiring?within=72h&selector=team=infra
+//
+// within is a Go duration or a whole number of days such as 7d.
+func ListExpiringCredentialsHandler(c *gin.Context) {
+	within := defaultForecastWindow
+	if raw := c.Query("within"); raw != "" {
+		var err error
+		if within, err = parseWindow(raw); err != nil {
+			c.Error(apierrors.Wrap(err, http.StatusBadRequest, apierrors.CodeInvalidRequest,
+				"within must be a duration such as 72h or 7d").WithDetails(gin.H{"within": raw}))
+			return
+		}
+	}
+	selector, err := services.ParseSelector(c.Query("selector"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	now := time.Now().UTC()
+	creds, err := services.ListExpiringCredentials(now, within, selector)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"dyncreds": creds,
+		"count":    len(creds),
+		"within":   within.String(),
+		"until":    now.Add(within),
+	})
+}
+
+// defaultStaleWindow is used when GET /dyncreds/stale has no unused_for.
+const defaultStaleWindow = 30 * 24 * time.Hour
+
+// ListStaleCredentialsHandler handles GET /dyncreds/stale?unused_for=30d&selector=team=infra
+//
+// It reports credentials nobody fetched, directly or through a lease, for
+// unused_for, which are likely safe to revoke.
+func ListStaleCredentialsHandler(c *gin.Context) {
+	unusedFor := defaultStaleWindow
+	if raw := c.Query("unused_for"); raw != "" {
+		var err error
+		if unusedFor, err = parseWindow(raw); err != nil || unusedFor <= 0 {
+			c.Error(apierrors.Wrap(err, http.StatusBadRequest, apierrors.CodeInvalidRequest,
+				"unused_for must be a positive duration such as 720h or 30d").WithDetails(gin.H{"unused_for": raw}))
+			return
+		}
+	}
+	selector, err := services.ParseSelector(c.Query("selector"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	now := time.Now().UTC()
+	creds, err := services.ListStaleCredentials(now, unusedFor, selector)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"dyncreds":     creds,
+		"count":        len(creds),
+		"unused_for":   unusedFor.String(),
+		"unused_since": now.Add(-unusedFor),
+	})
+}
+
+func parseWindow(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -3,26 +3,31 @@ package handlers
 
 import (
 	"net/http"
+	"test-go/apierrors"
+	"test-go/middleware"
 	"test-go/models"
 	"test-go/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CreateDynamicCredentialHandler handles POST /dyncreds
+// CreateDynamicCredentialHandler handles POST /dyncreds and
+// POST /teams/:team/dyncreds
 func CreateDynamicCredentialHandler(c *gin.Context) {
 	var req models.CreateDynamicCredentialRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apierrors.InvalidRequest(err))
 		return
 	}
+	req.Team = c.Param("team")
 
-	cred, err := services.CreateDynamicCredential(req)
+	cred, err := services.CreateDynamicCredential(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dynamic credential"})
+		c.Error(err)
 		return
 	}
 
+	setETag(c, cred)
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Dynamic credential created successfully",
 		"dyncred": cred,
@@ -32,32 +37,63 @@ func CreateDynamicCredentialHandler(c *gin.Context) {
 // GetDynamicCredentialHandler handles GET /dyncreds/:dyncredId
 func GetDynamicCredentialHandler(c *gin.Context) {
 	id := c.Param("dyncredId")
-	cred, err := services.GetDynamicCredential(id)
+	cred, err := services.FetchDynamicCredential(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
+	setETag(c, cred)
 	c.JSON(http.StatusOK, gin.H{
 		"dyncred": cred,
 	})
 }
 
+// ListDynamicCredentialsHandler handles GET /dyncreds?selector=team=infra,env!=prod
+//
+// Under /teams/:team/dyncreds only the team's credentials are listed.
+func ListDynamicCredentialsHandler(c *gin.Context) {
+	selector, err := services.ParseSelector(c.Query("selector"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var creds []*models.DynamicCredential
+	if team := c.Param("team"); team != "" {
+		creds = services.ListTeamCredentials(c.Request.Context(), team, selector)
+	} else {
+		creds = services.ListDynamicCredentials(c.Request.Context(), selector)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"dyncreds": creds,
+		"count":    len(creds),
+	})
+}
+
 // UpdateDynamicCredentialHandler handles PUT /dyncreds/:dyncredId
+//
+// The If-Match header must carry the version being updated.
 func UpdateDynamicCredentialHandler(c *gin.Context) {
 	id := c.Param("dyncredId")
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
 	var req models.UpdateDynamicCredentialRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apierrors.InvalidRequest(err))
 		return
 	}
 
-	cred, err := services.UpdateDynamicCredential(id, req)
+	cred, err := services.UpdateDynamicCredential(c.Request.Context(), id, version, req)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
+	setETag(c, cred)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Dynamic credential updated successfully",
 		"dyncred": cred,
@@ -65,11 +101,28 @@ func UpdateDynamicCredentialHandler(c *gin.Context) {
 }
 
 // DeleteDynamicCredentialHandler handles DELETE /dyncreds/:dyncredId
+//
+// With two-person approval enabled, the deletion waits for a second admin
+// instead, and the handler answers 202 with the pending approval.
 func DeleteDynamicCredentialHandler(c *gin.Context) {
 	id := c.Param("dyncredId")
-	err := services.DeleteDynamicCredential(id)
+	if services.ApprovalsEnabled() {
+		user := middleware.User(c)
+		if user == "" {
+			c.Error(middleware.ErrUnauthenticated())
+			return
+		}
+		approval, err := services.RequestCredentialDeletion(id, user)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		respondPendingApproval(c, approval)
+		return
+	}
+	err := services.DeleteDynamicCredential(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -79,32 +132,243 @@ func DeleteDynamicCredentialHandler(c *gin.Context) {
 	})
 }
 
+// RotateDynamicCredentialHandler handles POST /dyncreds/:dyncredId/rotate
+func RotateDynamicCredentialHandler(c *gin.Context) {
+	id := c.Param("dyncredId")
+	cred, event, err := services.RotateDynamicCredential(c.Request.Context(), id, services.RotationReasonManual)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	setETag(c, cred)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Dynamic credential rotated successfully",
+		"dyncred":  cred,
+		"rotation": event,
+	})
+}
+
+// GetRotationHistoryHandler handles GET /dyncreds/:dyncredId/history
+func GetRotationHistoryHandler(c *gin.Context) {
+	id := c.Param("dyncredId")
+	history, err := services.GetRotationHistory(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dyncredId": id,
+		"history":   history,
+	})
+}
+
+// ExportDynamicCredentialsHandler handles POST /dyncreds/export
+func ExportDynamicCredentialsHandler(c *gin.Context) {
+	var req models.ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+	selector, err := services.ParseSelector(req.Selector)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	bundle, err := services.ExportBundle(req.Passphrase, selector, req.IDs)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, bundle)
+}
+
+// ImportDynamicCredentialsHandler handles POST /dyncreds/import
+func ImportDynamicCredentialsHandler(c *gin.Context) {
+	var req models.ImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+
+	result, err := services.ImportBundle(req.Passphrase, req.Bundle, req.Conflict)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Dynamic credentials imported successfully",
+		"result":  result,
+	})
+}
+
 // PatchDynamicCredentialHandler handles PATCH /dyncreds/:dyncredId
+//
+// The If-Match header must carry the version being updated, except with
+// ?dry_run=true, where the credential is left untouched and the Terraform
+// workspace variables that would change are returned instead.
+//
+// With two-person approval enabled, the change waits for a second admin
+// instead, and the handler answers 202 with the pending approval.
 func PatchDynamicCredentialHandler(c *gin.Context) {
 	id := c.Param("dyncredId")
 	var req models.UpdateTTLRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+
+	if c.Query("dry_run") == "true" {
+		changes, err := services.PlanTTLPropagation(c.Request.Context(), id, req.TTL)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "Dry run: no changes applied",
+			"dry_run":     true,
+			"dyncredId":   id,
+			"ttl":         req.TTL,
+			"propagation": services.PropagationMode.Value(),
+			"changes":     changes,
+		})
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// The TTL propagates to every mapped Terraform workspace, so with
+	// two-person approval enabled it waits for a second admin.
+	if services.ApprovalsEnabled() {
+		user := middleware.User(c)
+		if user == "" {
+			c.Error(middleware.ErrUnauthenticated())
+			return
+		}
+		approval, err := services.RequestTTLChange(id, version, req.TTL, user)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		respondPendingApproval(c, approval)
 		return
 	}
 
 	// Update TTL in the credential
-	cred, err := services.UpdateDynamicCredentialTTL(id, req.TTL)
+	cred, err := services.UpdateDynamicCredentialTTL(c.Request.Context(), id, version, req.TTL)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	setETag(c, cred)
 
-	// Update TTL across all Terraform workspaces
-	err = services.UpdateTTLForAllWorkspaces(id, req.TTL)
+	// Update TTL across the mapped Terraform workspaces, or all of them
+	job, err := services.UpdateTTLForAllWorkspaces(c.Request.Context(), id, req.TTL)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update TTL in workspaces"})
+		apiErr := apierrors.Wrap(err, http.StatusBadGateway, apierrors.CodePropagation, "Failed to update TTL in workspaces")
+		if job != nil {
+			apiErr.WithDetails(gin.H{"job_id": job.ID})
+		}
+		c.Error(apiErr)
 		return
 	}
 
+	message := "TTL updated successfully for all workspaces"
+	if job != nil && job.State == services.JobPartial {
+		message = "TTL updated; some workspaces are paused by conflicts"
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"message":   "TTL updated successfully for all workspaces",
-		"dyncredId": id,
-		"ttl":       cred.TTL,
+		"message":     message,
+		"dyncredId":   id,
+		"ttl":         cred.TTL,
+		"version":     cred.Version,
+		"expires_at":  cred.ExpiresAt,
+		"propagation": services.PropagationMode.Value(),
+		"job":         job,
+	})
+}
+
+// SimulateTTLHandler handles POST /dyncreds/:dyncredId/ttl/simulate
+//
+// It reports the expiry, lease renewals, Terraform workspace writes and
+// policy violations setting the TTL would cause, without changing anything.
+// A TTL the policy rejects is reported, not refused.
+func SimulateTTLHandler(c *gin.Context) {
+	var req models.UpdateTTLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+
+	sim, err := services.SimulateTTL(c.Request.Context(), c.Param("dyncredId"), req.TTL)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Simulation only: no changes applied",
+		"simulation": sim,
+	})
+}
+
+// ListPropagationJobsHandler handles GET /propagation/jobs
+func ListPropagationJobsHandler(c *gin.Context) {
+	jobs := services.ListPropagationJobs()
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":      jobs,
+		"count":     len(jobs),
+		"conflicts": services.ListConflicts(),
+	})
+}
+
+// GetPropagationJobHandler handles GET /propagation/jobs/:jobId
+func GetPropagationJobHandler(c *gin.Context) {
+	job, err := services.GetPropagationJob(c.Param("jobId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job": job,
+	})
+}
+
+// ListConflictsHandler handles GET /propagation/conflicts
+func ListConflictsHandler(c *gin.Context) {
+	conflicts := services.ListConflicts()
+	c.JSON(http.StatusOK, gin.H{
+		"conflicts": conflicts,
+		"count":     len(conflicts),
+	})
+}
+
+// ResolveConflictHandler handles POST /propagation/conflicts/:workspaceId/resolve
+func ResolveConflictHandler(c *gin.Context) {
+	var req models.ResolveConflictRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+
+	conflict, err := services.ResolveConflict(c.Request.Context(), c.Param("workspaceId"), req.Resolution)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Conflict resolved, propagation resumed",
+		"resolution": req.Resolution,
+		"conflict":   conflict,
 	})
 }
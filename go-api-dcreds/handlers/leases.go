@@ -0,0 +1,103 @@
+// handlers/leases.go
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"test-go/apierrors"
+	"test-go/models"
+	"test-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindOptionalJSON binds a JSON body into obj, leaving obj at its zero
+// value when the request has no body.
+func bindOptionalJSON(c *gin.Context, obj any) error {
+	if err := c.ShouldBindJSON(obj); err != nil && !errors.Is(err, io.EOF) {
+		return apierrors.InvalidRequest(err)
+	}
+	return nil
+}
+
+// CreateLeaseHandler handles POST /dyncreds/:dyncredId/leases
+func CreateLeaseHandler(c *gin.Context) {
+	var req models.CreateLeaseRequest
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	lease, err := services.CreateLease(c.Request.Context(), c.Param("dyncredId"), req.TTL)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Lease created successfully",
+		"lease":   lease,
+	})
+}
+
+// ListLeasesHandler handles GET /dyncreds/:dyncredId/leases
+func ListLeasesHandler(c *gin.Context) {
+	leases, err := services.ListLeases(c.Param("dyncredId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"leases": leases,
+		"count":  len(leases),
+	})
+}
+
+// GetLeaseHandler handles GET /dyncreds/:dyncredId/leases/:leaseId
+func GetLeaseHandler(c *gin.Context) {
+	lease, err := services.GetLease(c.Param("dyncredId"), c.Param("leaseId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lease": lease,
+	})
+}
+
+// RenewLeaseHandler handles POST /dyncreds/:dyncredId/leases/:leaseId/renew
+func RenewLeaseHandler(c *gin.Context) {
+	var req models.RenewLeaseRequest
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	lease, err := services.RenewLease(c.Param("dyncredId"), c.Param("leaseId"), req.Increment)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Lease renewed successfully",
+		"lease":   lease,
+	})
+}
+
+// RevokeLeaseHandler handles DELETE /dyncreds/:dyncredId/leases/:leaseId
+func RevokeLeaseHandler(c *gin.Context) {
+	lease, err := services.RevokeLease(c.Request.Context(), c.Param("dyncredId"), c.Param("leaseId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Lease revoked successfully",
+		"lease":   lease,
+	})
+}
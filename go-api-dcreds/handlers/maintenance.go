@@ -0,0 +1,39 @@
+// handlers/maintenance.go
+package handlers
+
+import (
+	"net/http"
+	"test-go/apierrors"
+	"test-go/models"
+	"test-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMaintenanceHandler handles GET /admin/maintenance
+func GetMaintenanceHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"maintenance": services.GetMaintenance(),
+	})
+}
+
+// SetMaintenanceHandler handles PUT /admin/maintenance
+//
+// It lasts until the next restart, which reads DCREDS_MAINTENANCE again.
+func SetMaintenanceHandler(c *gin.Context) {
+	var req models.MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+	m := services.SetMaintenance(*req.Enabled, req.Message)
+
+	message := "Maintenance mode disabled"
+	if m.Enabled {
+		message = "Maintenance mode enabled"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":     message,
+		"maintenance": m,
+	})
+}
@@ -0,0 +1,95 @@
+// handlers/mappings.go
+package handlers
+
+import (
+	"net/http"
+	"test-go/apierrors"
+	"test-go/models"
+	"test-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateWorkspaceMappingHandler handles POST /dyncreds/:dyncredId/workspace-mappings
+//
+// Once a credential has a mapping, its TTL propagates to its mapped
+// workspaces only.
+func CreateWorkspaceMappingHandler(c *gin.Context) {
+	var req models.WorkspaceMappingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+
+	mapping, err := services.CreateWorkspaceMapping(c.Request.Context(), c.Param("dyncredId"), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Workspace mapping created successfully",
+		"mapping": mapping,
+	})
+}
+
+// ListWorkspaceMappingsHandler handles GET /dyncreds/:dyncredId/workspace-mappings
+func ListWorkspaceMappingsHandler(c *gin.Context) {
+	mappings, err := services.ListWorkspaceMappings(c.Param("dyncredId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mappings": mappings,
+		"count":    len(mappings),
+	})
+}
+
+// GetWorkspaceMappingHandler handles GET /dyncreds/:dyncredId/workspace-mappings/:mappingId
+func GetWorkspaceMappingHandler(c *gin.Context) {
+	mapping, err := services.GetWorkspaceMapping(c.Param("dyncredId"), c.Param("mappingId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mapping": mapping,
+	})
+}
+
+// UpdateWorkspaceMappingHandler handles PUT /dyncreds/:dyncredId/workspace-mappings/:mappingId
+func UpdateWorkspaceMappingHandler(c *gin.Context) {
+	var req models.WorkspaceMappingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+
+	mapping, err := services.UpdateWorkspaceMapping(c.Request.Context(), c.Param("dyncredId"), c.Param("mappingId"), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Workspace mapping updated successfully",
+		"mapping": mapping,
+	})
+}
+
+// DeleteWorkspaceMappingHandler handles DELETE /dyncreds/:dyncredId/workspace-mappings/:mappingId
+func DeleteWorkspaceMappingHandler(c *gin.Context) {
+	id := c.Param("mappingId")
+	if err := services.DeleteWorkspaceMapping(c.Param("dyncredId"), id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Workspace mapping deleted successfully",
+		"mappingId": id,
+	})
+}
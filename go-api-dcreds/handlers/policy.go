@@ -0,0 +1,67 @@
+// handlers/policy.go
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"test-go/apierrors"
+	"test-go/middleware"
+	"test-go/policy"
+	"test-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPolicyBytes caps the size of a policy document.
+const maxPolicyBytes = 1 << 20
+
+// GetPolicyHandler handles GET /admin/policy
+func GetPolicyHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"policy": services.GetPolicy(),
+	})
+}
+
+// SetPolicyHandler handles PUT /admin/policy
+//
+// The body is a complete policy in YAML or JSON. It replaces the running
+// policy until the next restart, which loads DCREDS_POLICY_FILE again.
+// With two-person approval enabled, changes to the TTL bounds answer 202
+// with a pending approval instead.
+func SetPolicyHandler(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPolicyBytes))
+	if err != nil {
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+	p, err := policy.Parse(data)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	// Changing the TTL bounds affects every credential, so with two-person
+	// approval enabled it waits for a second admin.
+	if services.ApprovalsEnabled() && p.TTL != services.GetPolicy().TTL {
+		user := middleware.User(c)
+		if user == "" {
+			c.Error(middleware.ErrUnauthenticated())
+			return
+		}
+		approval, err := services.RequestPolicyChange(p, user)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		respondPendingApproval(c, approval)
+		return
+	}
+	if err := services.SetPolicy(p); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Policy updated successfully",
+		"policy":  p,
+	})
+}
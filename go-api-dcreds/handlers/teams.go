@@ -0,0 +1,118 @@
+// handlers/teams.go
+package handlers
+
+import (
+	"net/http"
+	"test-go/apierrors"
+	"test-go/middleware"
+	"test-go/models"
+	"test-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateTeamHandler handles POST /admin/teams
+func CreateTeamHandler(c *gin.Context) {
+	var req models.CreateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+
+	team, err := services.CreateTeam(req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Team created successfully",
+		"team":    team,
+	})
+}
+
+// ListTeamsHandler handles GET /admin/teams
+func ListTeamsHandler(c *gin.Context) {
+	teams := services.ListTeams()
+	c.JSON(http.StatusOK, gin.H{
+		"teams": teams,
+		"count": len(teams),
+	})
+}
+
+// GetTeamHandler handles GET /admin/teams/:team and GET /teams/:team
+func GetTeamHandler(c *gin.Context) {
+	team, err := services.GetTeam(c.Param("team"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"team": team,
+	})
+}
+
+// DeleteTeamHandler handles DELETE /admin/teams/:team
+//
+// With two-person approval enabled, it answers 202 with a pending approval.
+func DeleteTeamHandler(c *gin.Context) {
+	name := c.Param("team")
+	if services.ApprovalsEnabled() {
+		user := middleware.User(c)
+		if user == "" {
+			c.Error(middleware.ErrUnauthenticated())
+			return
+		}
+		approval, err := services.RequestTeamDeletion(name, user)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		respondPendingApproval(c, approval)
+		return
+	}
+	if err := services.DeleteTeam(name); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Team deleted successfully",
+		"team":    name,
+	})
+}
+
+// SetTeamMemberHandler handles PUT /teams/:team/members/:user
+func SetTeamMemberHandler(c *gin.Context) {
+	var req models.SetTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierrors.InvalidRequest(err))
+		return
+	}
+
+	team, err := services.SetTeamMember(c.Param("team"), c.Param("user"), req.Role)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Team member updated successfully",
+		"team":    team,
+	})
+}
+
+// RemoveTeamMemberHandler handles DELETE /teams/:team/members/:user
+func RemoveTeamMemberHandler(c *gin.Context) {
+	team, err := services.RemoveTeamMember(c.Param("team"), c.Param("user"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Team member removed successfully",
+		"team":    team,
+	})
+}
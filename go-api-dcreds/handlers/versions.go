@@ -0,0 +1,34 @@
+// handlers/versions.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"test-go/apierrors"
+	"test-go/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setETag exposes the credential's version for use in If-Match.
+func setETag(c *gin.Context, cred *models.DynamicCredential) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(cred.Version)))
+}
+
+// ifMatchVersion returns the credential version a write expects, taken from
+// the If-Match header as returned in ETag. Quotes and a weak W/ prefix are
+// optional.
+func ifMatchVersion(c *gin.Context) (int, error) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return 0, apierrors.New(http.StatusPreconditionRequired, apierrors.CodeVersionRequired,
+			"If-Match header with the credential version is required")
+	}
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	if err != nil || version <= 0 {
+		return 0, apierrors.New(http.StatusBadRequest, apierrors.CodeInvalidRequest,
+			"If-Match must be a credential version").WithDetails(gin.H{"if_match": header})
+	}
+	return version, nil
+}
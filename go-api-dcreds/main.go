@@ -2,22 +2,317 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"test-go/archive"
+	"test-go/grpcserver"
 	"test-go/middleware"
+	"test-go/policy"
+	"test-go/providers"
 	"test-go/routes"
+	"test-go/services"
+	"test-go/terraform"
+	"test-go/tracing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-projects-root/pkg/featureflags"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	// SIGINT or SIGTERM starts a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers run until the servers are drained
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	startWorker := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workerCtx)
+		}()
+	}
+
+	// Load feature flag overrides from FF_* env vars and an optional JSON file
+	if err := featureflags.Default.LoadEnv("FF"); err != nil {
+		log.Fatalf("invalid feature flag: %v", err)
+	}
+	if path := os.Getenv("FEATURE_FLAGS_FILE"); path != "" {
+		startWorker(func(ctx context.Context) { featureflags.Default.WatchFile(ctx, path, 10*time.Second) })
+	}
+	featureflags.Default.OnChange("", func(c featureflags.Change) {
+		log.Printf("feature flag %s changed from %q to %q (%s)", c.Name, c.OldValue, c.NewValue, c.Source)
+	})
+
+	// Trace requests, exporting spans over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Enforce the global max credential lifetime
+	maxLifetime, err := durationFromEnv("DCREDS_MAX_LIFETIME", 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	notice, err := durationFromEnv("DCREDS_ROTATION_NOTICE", 24*time.Hour)
+	if err != nil {
+		log.Fatal(err)
+	}
+	interval, err := durationFromEnv("DCREDS_EXPIRY_INTERVAL", time.Minute)
+	if err != nil {
+		log.Fatal(err)
+	}
+	startupTimeout, err := durationFromEnv("DCREDS_STARTUP_TIMEOUT", 10*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shutdownTimeout, err := durationFromEnv("DCREDS_SHUTDOWN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	purgeInterval, err := durationFromEnv("DCREDS_PURGE_INTERVAL", time.Hour)
+	if err != nil {
+		log.Fatal(err)
+	}
+	services.ConfigureLifetime(maxLifetime, notice)
+
+	// Purge credentials DCREDS_RETENTION_DAYS after they expire, archiving them to DCREDS_ARCHIVE first
+	if days := os.Getenv("DCREDS_RETENTION_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid DCREDS_RETENTION_DAYS: %q is not a positive number of days", days)
+		}
+		target := os.Getenv("DCREDS_ARCHIVE")
+		if target == "" {
+			log.Fatal("DCREDS_ARCHIVE must name a directory or gs://bucket/prefix when DCREDS_RETENTION_DAYS is set")
+		}
+		a, err := archive.Parse(context.Background(), target)
+		if err != nil {
+			log.Fatal(err)
+		}
+		services.ConfigureRetention(time.Duration(n)*24*time.Hour, a)
+	}
+
+	// Terraform workspaces receiving TTL propagation
+	if org := os.Getenv("TFC_ORGANIZATION"); org != "" {
+		services.SetWorkspaceClient(terraform.NewTFEClient(os.Getenv("TFC_ADDRESS"), org, os.Getenv("TFC_TOKEN")))
+	} else if names := os.Getenv("TF_WORKSPACES"); names != "" {
+		// Local development: simulate the listed workspaces in memory
+		services.SetWorkspaceClient(terraform.NewMemoryClient(strings.Split(names, ",")...))
+	}
+
+	// Policy enforced on creates and updates; PUT /admin/policy replaces it at runtime
+	if path := os.Getenv("DCREDS_POLICY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("failed to read policy: %v", err)
+		}
+		p, err := policy.Parse(data)
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		if err := services.SetPolicy(p); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Cloud providers that credentials may select, besides the built-in token provider
+	if names := os.Getenv("DCREDS_PROVIDERS"); names != "" {
+		if err := registerProviders(context.Background(), strings.Split(names, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Start in maintenance mode, refusing changes, when DCREDS_MAINTENANCE is set;
+	// PUT /admin/maintenance toggles it at runtime
+	if v := os.Getenv("DCREDS_MAINTENANCE"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid DCREDS_MAINTENANCE: %q is not a boolean", v)
+		}
+		if enabled {
+			services.SetMaintenance(true, os.Getenv("DCREDS_MAINTENANCE_MESSAGE"))
+			log.Printf("maintenance mode enabled, changes are refused")
+		}
+	}
+
+	// Trust the X-User header only on requests carrying DCREDS_PROXY_SECRET,
+	// which the authenticating proxy adds in X-Proxy-Secret
+	proxySecret := os.Getenv("DCREDS_PROXY_SECRET")
+	middleware.SetProxySecret(proxySecret)
+
+	// Let the comma-separated DCREDS_ADMINS use the /admin endpoints and
+	// approve requests outside teams
+	var admins []string
+	for _, user := range strings.Split(os.Getenv("DCREDS_ADMINS"), ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			admins = append(admins, user)
+		}
+	}
+	services.SetOperatorAdmins(admins)
+
+	// Require a second admin to approve deletions, TTL changes and TTL policy changes
+	// when DCREDS_TWO_PERSON_APPROVAL is set; requests expire after DCREDS_APPROVAL_TTL
+	approvalTTL, err := durationFromEnv("DCREDS_APPROVAL_TTL", services.DefaultApprovalTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if v := os.Getenv("DCREDS_TWO_PERSON_APPROVAL"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid DCREDS_TWO_PERSON_APPROVAL: %q is not a boolean", v)
+		}
+		// Approvals hinge on who requested and who approved; without the
+		// secret anyone could approve their own request under another name.
+		if enabled && proxySecret == "" {
+			log.Fatal("DCREDS_TWO_PERSON_APPROVAL requires DCREDS_PROXY_SECRET, so X-User is only trusted from the authenticating proxy")
+		}
+		if enabled && len(admins) == 0 {
+			log.Fatal("DCREDS_TWO_PERSON_APPROVAL requires DCREDS_ADMINS to approve requests outside teams")
+		}
+		services.ConfigureApprovals(enabled, approvalTTL)
+	}
+
+	// Fail fast when the store or the Terraform API is unreachable
+	checkCtx, cancelCheck := context.WithTimeout(ctx, startupTimeout)
+	err = services.CheckDependencies(checkCtx)
+	cancelCheck()
+	if err != nil {
+		log.Fatalf("startup checks failed: %v", err)
+	}
+	startWorker(func(ctx context.Context) { services.RunExpiryEngine(ctx, interval) })
+	startWorker(func(ctx context.Context) { services.RunJanitor(ctx, purgeInterval) })
+
 	router := gin.Default()
 
 	// Apply middlewares
-	router.Use(middleware.LoggerMiddleware())
+	router.Use(tracing.Middleware())
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(middleware.LoggerMiddleware(middleware.LoggerConfig{
+		RedactFields: strings.Split(os.Getenv("DCREDS_LOG_REDACT"), ","),
+	}))
+	router.Use(middleware.ErrorHandlerMiddleware())
+	router.Use(middleware.MaintenanceMiddleware())
 	// router.Use(middleware.AuthenticationMiddleware()) // Uncomment if authentication is implemented
 
 	// Setup routes
 	routes.SetupRoutes(router)
 
+	// Start the gRPC API alongside the REST API
+	grpcAddr := os.Getenv("DCREDS_GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", grpcAddr, err)
+	}
+	grpcServer := grpcserver.New(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	go func() {
+		log.Printf("gRPC server listening at %v", lis.Addr())
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("gRPC server failed: %v", err)
+		}
+	}()
+
 	// Start server on port 8080
-	router.Run(":8080")
+	srv := &http.Server{Addr: ":8080", Handler: router}
+	// Event streams never finish on their own, so end them before draining
+	srv.RegisterOnShutdown(services.CloseEventStreams)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Printf("shutting down, draining in-flight requests for up to %s", shutdownTimeout)
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelDrain()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		log.Printf("HTTP server did not drain: %v", err)
+	}
+	stopGRPC(drainCtx, grpcServer)
+
+	stopWorkers()
+	workers.Wait()
+	// Flush the spans of the drained requests
+	if err := shutdownTracing(drainCtx); err != nil {
+		log.Printf("failed to flush traces: %v", err)
+	}
+	log.Printf("shutdown complete")
+}
+
+// stopGRPC waits for in-flight RPCs to finish, closing any that are still
+// running when ctx is done.
+func stopGRPC(ctx context.Context, s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Printf("gRPC server did not drain: %v", ctx.Err())
+		s.Stop()
+	}
+}
+
+// durationFromEnv parses a time.Duration from the named env var, or returns def.
+func durationFromEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
+
+// registerProviders sets up the named cloud providers from their standard
+// credential environment.
+func registerProviders(ctx context.Context, names []string) error {
+	for _, name := range names {
+		var (
+			p   providers.CredentialProvider
+			err error
+		)
+		switch name = strings.TrimSpace(name); name {
+		case "", providers.TokenProvider:
+			continue
+		case "aws":
+			p, err = providers.NewAWS(ctx)
+		case "gcp":
+			p, err = providers.NewGCP(ctx)
+		case "azure":
+			p, err = providers.NewAzureFromEnv()
+		default:
+			return fmt.Errorf("invalid DCREDS_PROVIDERS: unknown provider %q", name)
+		}
+		if err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
+		providers.Register(p)
+		log.Printf("registered credential provider %s", name)
+	}
+	return nil
 }
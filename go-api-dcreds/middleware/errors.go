@@ -0,0 +1,137 @@
+// middleware/errors.go
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"test-go/apierrors"
+	"test-go/models"
+	"test-go/policy"
+	"test-go/providers"
+	"test-go/services"
+	"test-go/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RequestIDHeader carries the request ID in requests and responses.
+	RequestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+// errorMappings translates service errors into API errors.
+var errorMappings = []struct {
+	target  error
+	status  int
+	code    string
+	message string
+}{
+	{services.ErrNotFound, http.StatusNotFound, apierrors.CodeNotFound, "Dynamic credential not found"},
+	{services.ErrInvalidTags, http.StatusBadRequest, apierrors.CodeInvalidTags, "Invalid tags"},
+	{services.ErrInvalidSelector, http.StatusBadRequest, apierrors.CodeInvalidSelector, "Invalid selector"},
+	{services.ErrInvalidEventFilter, http.StatusBadRequest, apierrors.CodeInvalidRequest, "Invalid event filter"},
+	{services.ErrInvalidWindow, http.StatusBadRequest, apierrors.CodeInvalidRequest, "Invalid forecast window"},
+	{services.ErrJobNotFound, http.StatusNotFound, apierrors.CodeJobNotFound, "Propagation job not found"},
+	{services.ErrConflictNotFound, http.StatusNotFound, apierrors.CodeNoConflict, "No open conflict for this workspace"},
+	{services.ErrInvalidResolution, http.StatusBadRequest, apierrors.CodeInvalidRequest, "Invalid conflict resolution"},
+	{services.ErrInvalidBundle, http.StatusBadRequest, apierrors.CodeInvalidBundle, "Bundle could not be decrypted"},
+	{services.ErrUnsupportedBundle, http.StatusBadRequest, apierrors.CodeInvalidBundle, "Unsupported bundle format"},
+	{services.ErrInvalidConflictPolicy, http.StatusBadRequest, apierrors.CodeInvalidRequest, "Invalid conflict policy"},
+	{services.ErrImportConflict, http.StatusConflict, apierrors.CodeImportConflict, "Dynamic credentials already exist"},
+	{services.ErrLeaseNotFound, http.StatusNotFound, apierrors.CodeLeaseNotFound, "Lease not found"},
+	{services.ErrLeaseInactive, http.StatusConflict, apierrors.CodeLeaseInactive, "Lease is not active"},
+	{services.ErrMappingNotFound, http.StatusNotFound, apierrors.CodeMappingNotFound, "Workspace mapping not found"},
+	{services.ErrMappingExists, http.StatusConflict, apierrors.CodeMappingExists, "Workspace mapping already exists"},
+	{services.ErrInvalidMapping, http.StatusBadRequest, apierrors.CodeInvalidMapping, "Invalid workspace mapping"},
+	{providers.ErrUnknownProvider, http.StatusBadRequest, apierrors.CodeInvalidProvider, "Unknown credential provider"},
+	{providers.ErrInvalidConfig, http.StatusBadRequest, apierrors.CodeInvalidProvider, "Invalid provider config"},
+	{services.ErrVersionMismatch, http.StatusConflict, apierrors.CodeVersionConflict, "Dynamic credential was modified by another request"},
+	{policy.ErrInvalid, http.StatusBadRequest, apierrors.CodeInvalidPolicy, "Invalid policy"},
+	{services.ErrTeamNotFound, http.StatusNotFound, apierrors.CodeTeamNotFound, "Team not found"},
+	{services.ErrTeamExists, http.StatusConflict, apierrors.CodeTeamExists, "Team already exists"},
+	{services.ErrInvalidTeam, http.StatusBadRequest, apierrors.CodeInvalidTeam, "Invalid team"},
+	{services.ErrTeamNotEmpty, http.StatusConflict, apierrors.CodeTeamNotEmpty, "Team still owns dynamic credentials"},
+	{services.ErrNotTeamMember, http.StatusForbidden, apierrors.CodeTeamForbidden, "Access to this team is denied"},
+	{services.ErrNotOperatorAdmin, http.StatusForbidden, apierrors.CodeAdminForbidden, "Operator admin role required"},
+	{services.ErrMemberNotFound, http.StatusNotFound, apierrors.CodeMemberNotFound, "Team member not found"},
+	{services.ErrLastTeamAdmin, http.StatusConflict, apierrors.CodeLastTeamAdmin, "Team must keep at least one admin"},
+	{services.ErrProvider, http.StatusBadGateway, apierrors.CodeProvider, "Credential provider failed"},
+	{services.ErrApprovalNotFound, http.StatusNotFound, apierrors.CodeApprovalMissing, "Approval not found"},
+	{services.ErrApprovalDecided, http.StatusConflict, apierrors.CodeApprovalDecided, "Approval is no longer pending"},
+	{services.ErrSelfApproval, http.StatusForbidden, apierrors.CodeSelfApproval, "Requests must be approved by a second admin"},
+	{services.ErrInvalidApprovalStatus, http.StatusBadRequest, apierrors.CodeInvalidRequest, "Invalid approval status"},
+	{services.ErrMaintenance, http.StatusServiceUnavailable, apierrors.CodeMaintenance, "Service is in maintenance mode"},
+}
+
+// RequestIDMiddleware assigns every request an ID, reusing the caller's
+// X-Request-ID when present, and echoes it in the response. The ID is also
+// recorded on the request's span.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" {
+			id = uuid.New().String()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("dcreds.request_id", id))
+		c.Next()
+	}
+}
+
+// RequestID returns the ID assigned by RequestIDMiddleware.
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// ErrorHandlerMiddleware renders the last error attached with c.Error as a
+// models.ErrorResponse, so handlers never build error bodies themselves.
+// The response carries the request and trace IDs for support to look up.
+func ErrorHandlerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		apiErr := toAPIError(c.Errors.Last().Err)
+		if apiErr.Status >= http.StatusInternalServerError {
+			log.Printf("request %s failed: %v trace_id=%s", RequestID(c), c.Errors.Last().Err, tracing.TraceID(c.Request.Context()))
+		}
+		c.JSON(apiErr.Status, models.ErrorResponse{
+			Code:      apiErr.Code,
+			Message:   apiErr.Message,
+			Details:   apiErr.Details,
+			RequestID: RequestID(c),
+			TraceID:   tracing.TraceID(c.Request.Context()),
+		})
+	}
+}
+
+func toAPIError(err error) *apierrors.Error {
+	var apiErr *apierrors.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var violation *policy.ViolationError
+	if errors.As(err, &violation) {
+		return apierrors.Wrap(err, http.StatusForbidden, apierrors.CodePolicyViolation, "Request violates policy").
+			WithDetails(violation.Violations)
+	}
+	for _, m := range errorMappings {
+		if errors.Is(err, m.target) {
+			apiErr := apierrors.Wrap(err, m.status, m.code, m.message)
+			if err != m.target {
+				// Wrapped errors carry context worth returning, e.g. which tag is invalid.
+				apiErr.Details = err.Error()
+			}
+			return apiErr
+		}
+	}
+	return apierrors.Wrap(err, http.StatusInternalServerError, apierrors.CodeInternal, "Internal server error")
+}
@@ -0,0 +1,193 @@
+// middleware/logging.go
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"test-go/tracing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-projects-root/pkg/featureflags"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// LogBodies enables logging of request and response bodies. It is off
+	// by default and meant for debugging, e.g. FF_DCREDS_LOG_BODIES=true in
+	// development only.
+	LogBodies = featureflags.Default.Bool("dcreds.log.bodies", false,
+		"Log redacted request and response bodies")
+
+	// DefaultRedactFields are masked in every logged body.
+	DefaultRedactFields = []string{
+		"secret", "passphrase", "token", "access_token", "password", "private_key", "client_secret",
+	}
+
+	// redactHeaders are logged as [REDACTED] whatever the config.
+	redactHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+)
+
+// LoggerConfig configures LoggerMiddleware.
+type LoggerConfig struct {
+	// RedactFields are field masks applied on top of DefaultRedactFields.
+	// A mask without dots matches a JSON field of that name at any depth,
+	// a dotted mask such as provider_config.key matches that path only.
+	// Matching is case-insensitive and a masked field's whole value is
+	// replaced, even if it is an object.
+	RedactFields []string
+	// MaxBodyBytes caps the size of a logged body; larger bodies are
+	// summarized by size only, and request bodies are only buffered up to
+	// the cap. Default 8KiB.
+	MaxBodyBytes int
+}
+
+// LoggerMiddleware logs each request with its status and duration. While
+// the LogBodies flag is on it also logs the request and response headers
+// and JSON bodies with secret fields redacted. Other bodies are never
+// logged verbatim since they cannot be redacted.
+func LoggerMiddleware(cfg LoggerConfig) gin.HandlerFunc {
+	masks := make(map[string]bool)
+	for _, f := range append(append([]string{}, DefaultRedactFields...), cfg.RedactFields...) {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			masks[f] = true
+		}
+	}
+	maxBody := cfg.MaxBodyBytes
+	if maxBody <= 0 {
+		maxBody = 8 << 10
+	}
+
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		logBodies := LogBodies.Enabled()
+
+		var reqBody []byte
+		var recorder *bodyRecorder
+		if logBodies {
+			if body := c.Request.Body; body != nil {
+				// Peek at most one byte past the cap, enough to tell the
+				// body is too large to log, and stream the rest as is.
+				reqBody, _ = io.ReadAll(io.LimitReader(body, int64(maxBody)+1))
+				c.Request.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(reqBody), body), body}
+			}
+			recorder = &bodyRecorder{ResponseWriter: c.Writer, limit: maxBody}
+			c.Writer = recorder
+		}
+
+		// Process request
+		c.Next()
+
+		// Log details
+		duration := time.Since(startTime)
+		status := c.Writer.Status()
+		method := c.Request.Method
+		path := c.Request.URL.Path
+
+		log.Printf("[%s] %s %d %s request_id=%s trace_id=%s", method, path, status, duration, RequestID(c), tracing.TraceID(c.Request.Context()))
+		if !logBodies {
+			return
+		}
+		log.Printf("request %s headers=%s body=%s", RequestID(c),
+			formatHeaders(c.Request.Header),
+			formatBody(c.Request.Header.Get("Content-Type"), reqBody, len(reqBody) > maxBody, masks))
+		log.Printf("response %s headers=%s body=%s", RequestID(c),
+			formatHeaders(c.Writer.Header()),
+			formatBody(c.Writer.Header().Get("Content-Type"), recorder.body.Bytes(), recorder.truncated, masks))
+	}
+}
+
+// bodyRecorder keeps a copy of up to limit bytes of the response body.
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.record(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyRecorder) record(b []byte) {
+	if w.truncated {
+		return
+	}
+	if w.body.Len()+len(b) > w.limit {
+		w.truncated = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(b)
+}
+
+func formatHeaders(h http.Header) string {
+	masked := h.Clone()
+	for _, name := range redactHeaders {
+		if masked.Get(name) != "" {
+			masked.Set(name, redacted)
+		}
+	}
+	out, _ := json.Marshal(masked)
+	return string(out)
+}
+
+// formatBody renders a body for the log. JSON is re-encoded with masked
+// fields redacted; anything else is described by its type and size.
+func formatBody(contentType string, body []byte, truncated bool, masks map[string]bool) string {
+	switch {
+	case truncated:
+		return "<body too large to log>"
+	case len(body) == 0:
+		return "<empty>"
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/json" {
+		return fmt.Sprintf("<%d bytes of %q>", len(body), contentType)
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("<%d bytes of malformed JSON>", len(body))
+	}
+	out, _ := json.Marshal(redact(v, "", masks))
+	return string(out)
+}
+
+// redact returns v with the values of masked fields replaced.
+func redact(v any, path string, masks map[string]bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			fieldPath := strings.ToLower(key)
+			if path != "" {
+				fieldPath = path + "." + fieldPath
+			}
+			if masks[strings.ToLower(key)] || masks[fieldPath] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redact(value, fieldPath, masks)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redact(value, path, masks)
+		}
+	}
+	return v
+}
@@ -0,0 +1,42 @@
+// middleware/maintenance.go
+package middleware
+
+import (
+	"net/http"
+	"test-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maintenanceExempt lists the routes that change nothing despite their
+// method, or that operators need during maintenance.
+var maintenanceExempt = map[string]bool{
+	"/dyncreds/export":                              true,
+	"/dyncreds/:dyncredId/ttl/simulate":             true,
+	"/teams/:team/dyncreds/:dyncredId/ttl/simulate": true,
+	"/admin/maintenance":                            true,
+	"/admin/flags":                                  true,
+	"/admin/flags/*name":                            true,
+}
+
+// MaintenanceMiddleware refuses requests that could change anything while
+// maintenance mode is enabled. GET, HEAD and OPTIONS requests pass.
+func MaintenanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if maintenanceExempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+		if err := services.CheckWritable(); err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,109 @@
+// middleware/teams.go
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"test-go/apierrors"
+	"test-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserHeader names the user making a request. dcreds trusts the
+// authenticating proxy in front of it to set it, until
+// AuthenticationMiddleware verifies callers itself.
+const UserHeader = "X-User"
+
+// ProxySecretHeader carries the secret shared with the authenticating
+// proxy, proving the proxy set UserHeader.
+const ProxySecretHeader = "X-Proxy-Secret"
+
+// proxySecret is set once at startup, before serving.
+var proxySecret string
+
+// SetProxySecret makes User trust UserHeader only on requests carrying
+// secret in ProxySecretHeader, so callers reaching dcreds around the proxy
+// cannot name themselves. An empty secret trusts UserHeader on every
+// request.
+func SetProxySecret(secret string) {
+	proxySecret = secret
+}
+
+// User returns the user making the request, or "" if unknown.
+func User(c *gin.Context) string {
+	if proxySecret != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader(ProxySecretHeader)), []byte(proxySecret)) != 1 {
+		return ""
+	}
+	return c.GetHeader(UserHeader)
+}
+
+// ErrUnauthenticated returns the error for requests without a UserHeader.
+func ErrUnauthenticated() error {
+	return apierrors.New(http.StatusUnauthorized, apierrors.CodeUnauthenticated,
+		"The "+UserHeader+" header naming the caller is required")
+}
+
+// RequireUserMiddleware only lets requests naming their user through.
+func RequireUserMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if User(c) == "" {
+			c.Error(ErrUnauthenticated())
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// OperatorAdminMiddleware only lets operator admins through.
+func OperatorAdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := User(c)
+		if user == "" {
+			c.Error(ErrUnauthenticated())
+			c.Abort()
+			return
+		}
+		if err := services.CheckOperatorAdmin(user); err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// TeamMembershipMiddleware only lets users holding at least role in the
+// team named by the :team path parameter through.
+func TeamMembershipMiddleware(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := User(c)
+		if user == "" {
+			c.Error(ErrUnauthenticated())
+			c.Abort()
+			return
+		}
+		if err := services.CheckTeamRole(c.Param("team"), user, role); err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// TeamCredentialMiddleware answers 404 for requests naming a :dyncredId
+// outside the :team they are made in, so handlers only ever act on the
+// team's own credentials. Outside a team, only credentials without one
+// are found.
+func TeamCredentialMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := services.GetTeamCredential(c.Request.Context(), c.Param("team"), c.Param("dyncredId")); err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
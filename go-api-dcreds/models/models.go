@@ -1,25 +1,254 @@
 // models/models.go
 package models
 
+import "time"
+
+// DynamicCredential is a credential whose TTL is propagated to Terraform
+// workspaces. TTL is expressed in seconds.
 type DynamicCredential struct {
-	ID   string `json:"id" bson:"id"`
-	Name string `json:"name" bson:"name"`
-	TTL  int    `json:"ttl" bson:"ttl"`
+	ID         string            `json:"id" bson:"id"`
+	Name       string            `json:"name" bson:"name"`
+	TTL        int               `json:"ttl" bson:"ttl"`
+	Tags       map[string]string `json:"tags,omitempty" bson:"tags,omitempty"`
+	Owner      string            `json:"owner,omitempty" bson:"owner,omitempty"`
+	Team       string            `json:"team,omitempty" bson:"team,omitempty"`
+	Generation int               `json:"generation" bson:"generation"`
+	// Version increases on every write; updates must name it in If-Match.
+	Version   int       `json:"version" bson:"version"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	IssuedAt  time.Time `json:"issued_at" bson:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	// RotationDueAt is when the max-lifetime policy forces a rotation, if set.
+	RotationDueAt    *time.Time `json:"rotation_due_at,omitempty" bson:"rotation_due_at,omitempty"`
+	RotationNoticeAt *time.Time `json:"rotation_notice_at,omitempty" bson:"rotation_notice_at,omitempty"`
+	// Provider names the CredentialProvider that issues the credential's
+	// secrets, configured by ProviderConfig.
+	Provider       string            `json:"provider" bson:"provider"`
+	ProviderConfig map[string]string `json:"provider_config,omitempty" bson:"provider_config,omitempty"`
+	// ProviderKeyID identifies the current generation's secret in the
+	// cloud until it is revoked; SecretExpiresAt is when the cloud
+	// invalidates it on its own, if ever.
+	ProviderKeyID   string     `json:"provider_key_id,omitempty" bson:"provider_key_id,omitempty"`
+	SecretExpiresAt *time.Time `json:"secret_expires_at,omitempty" bson:"secret_expires_at,omitempty"`
+	// Secret is only returned when the credential is created or rotated;
+	// it is never stored.
+	Secret map[string]string `json:"secret,omitempty" bson:"-"`
+	// UseCount counts fetches of the credential and of its leases;
+	// LastUsedAt is the latest, if any. They are not writes, so they leave
+	// Version alone.
+	UseCount   int64      `json:"use_count" bson:"use_count"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
 	// Add other fields as necessary
 }
 
+// RotationEvent records a single rotation of a dynamic credential.
+type RotationEvent struct {
+	CredentialID string    `json:"dyncred_id"`
+	Generation   int       `json:"generation"`
+	Reason       string    `json:"reason"`
+	RotatedAt    time.Time `json:"rotated_at"`
+	PreviousTTL  int       `json:"previous_ttl"`
+	EffectiveTTL int       `json:"effective_ttl"`
+}
+
+// CredentialEvent reports a step in the lifecycle of a dynamic credential,
+// carrying the credential as it was right after it, without any secret.
+// IDs increase with every event.
+type CredentialEvent struct {
+	ID         uint64            `json:"id"`
+	Type       string            `json:"type"`
+	Reason     string            `json:"reason,omitempty"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	Dyncred    DynamicCredential `json:"dyncred"`
+}
+
+// Lease is a short-lived secret issued for a dynamic credential. Secret is
+// only returned when the lease is created; it is never stored.
+type Lease struct {
+	ID           string            `json:"id" bson:"id"`
+	CredentialID string            `json:"dyncred_id" bson:"dyncred_id"`
+	Generation   int               `json:"generation" bson:"generation"`
+	State        string            `json:"state" bson:"-"`
+	Secret       map[string]string `json:"secret,omitempty" bson:"-"`
+	IssuedAt     time.Time         `json:"issued_at" bson:"issued_at"`
+	ExpiresAt    time.Time         `json:"expires_at" bson:"expires_at"`
+	Renewals     int               `json:"renewals" bson:"renewals"`
+	RenewedAt    *time.Time        `json:"renewed_at,omitempty" bson:"renewed_at,omitempty"`
+	RevokedAt    *time.Time        `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	// ProviderKeyID identifies the lease's secret in the cloud until it is
+	// revoked; SecretExpiresAt caps renewals when the cloud expires it.
+	ProviderKeyID   string     `json:"provider_key_id,omitempty" bson:"provider_key_id,omitempty"`
+	SecretExpiresAt *time.Time `json:"secret_expires_at,omitempty" bson:"secret_expires_at,omitempty"`
+}
+
+// CreateLeaseRequest asks for a lease lasting TTL seconds, defaulting to
+// the credential's TTL.
+type CreateLeaseRequest struct {
+	TTL int `json:"ttl" binding:"omitempty,gt=0"`
+}
+
+// RenewLeaseRequest extends a lease to Increment seconds from now,
+// defaulting to the credential's TTL.
+type RenewLeaseRequest struct {
+	Increment int `json:"increment" binding:"omitempty,gt=0"`
+}
+
 type CreateDynamicCredentialRequest struct {
-	Name string `json:"name" binding:"required"`
-	TTL  int    `json:"ttl" binding:"required,gt=0"`
+	Name  string            `json:"name" binding:"required"`
+	TTL   int               `json:"ttl" binding:"required,gt=0"`
+	Tags  map[string]string `json:"tags"`
+	Owner string            `json:"owner"`
+	// Provider selects the credential provider, defaulting to "token".
+	Provider       string            `json:"provider"`
+	ProviderConfig map[string]string `json:"provider_config"`
+	// Team is taken from the request path, never from the body.
+	Team string `json:"-"`
 	// Add other fields with validation tags
 }
 
 type UpdateDynamicCredentialRequest struct {
-	Name string `json:"name" binding:"required"`
-	TTL  int    `json:"ttl" binding:"required,gt=0"`
+	Name string            `json:"name" binding:"required"`
+	TTL  int               `json:"ttl" binding:"required,gt=0"`
+	Tags map[string]string `json:"tags"`
 	// Add other fields with validation tags
 }
 
 type UpdateTTLRequest struct {
 	TTL int `json:"ttl" binding:"required,gt=0"`
 }
+
+// Bundle is an encrypted, versioned export of dynamic credentials used to
+// migrate them between environments. Byte fields are base64 encoded in JSON.
+type Bundle struct {
+	Version    int       `json:"version" binding:"required"`
+	CreatedAt  time.Time `json:"created_at"`
+	KDF        string    `json:"kdf" binding:"required"`
+	Salt       []byte    `json:"salt" binding:"required"`
+	Nonce      []byte    `json:"nonce" binding:"required"`
+	Count      int       `json:"count"`
+	Ciphertext []byte    `json:"ciphertext" binding:"required"`
+}
+
+type ExportRequest struct {
+	Passphrase string   `json:"passphrase" binding:"required,min=12"`
+	Selector   string   `json:"selector"`
+	IDs        []string `json:"ids"`
+}
+
+type ImportRequest struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+	Bundle     Bundle `json:"bundle" binding:"required"`
+	// Conflict is one of skip, overwrite or fail (default).
+	Conflict string `json:"conflict" binding:"omitempty,oneof=skip overwrite fail"`
+}
+
+// WorkspaceMapping targets TTL propagation of a credential at one Terraform
+// workspace and variable. A credential with mappings propagates to its
+// mapped workspaces only; one without propagates to every workspace.
+type WorkspaceMapping struct {
+	ID            string `json:"id"`
+	CredentialID  string `json:"dyncred_id"`
+	WorkspaceID   string `json:"workspace_id"`
+	WorkspaceName string `json:"workspace_name"`
+	Variable      string `json:"variable"`
+	// Status is the outcome of the last propagation through the mapping:
+	// pending until the first one, then synced, conflict, paused, missing
+	// or failed, with Error saying why it failed.
+	Status           string     `json:"status"`
+	Error            string     `json:"error,omitempty"`
+	LastJobID        string     `json:"last_job_id,omitempty"`
+	LastPropagatedAt *time.Time `json:"last_propagated_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// WorkspaceMappingRequest maps a credential to Workspace, given by ID or
+// name, writing its TTL to Variable, which defaults to the credential's
+// TTL variable name.
+type WorkspaceMappingRequest struct {
+	Workspace string `json:"workspace" binding:"required"`
+	Variable  string `json:"variable"`
+}
+
+type ResolveConflictRequest struct {
+	// Resolution is overwrite (write dcreds' value) or accept (keep the manual value).
+	Resolution string `json:"resolution" binding:"required,oneof=overwrite accept"`
+}
+
+// ImportResult lists credential IDs by what happened to them on import.
+type ImportResult struct {
+	Imported    []string `json:"imported"`
+	Overwritten []string `json:"overwritten"`
+	Skipped     []string `json:"skipped"`
+}
+
+// Team is a namespace of dynamic credentials shared by its members.
+type Team struct {
+	Name string `json:"name"`
+	// Members maps each member to their role, member or admin.
+	Members   map[string]string `json:"members"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type CreateTeamRequest struct {
+	Name string `json:"name" binding:"required"`
+	// Admins are the team's first members, able to manage the rest.
+	Admins []string `json:"admins"`
+}
+
+type SetTeamMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=member admin"`
+}
+
+// Maintenance describes maintenance mode, during which changes are
+// refused and reads continue.
+type Maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+	// Since is when maintenance mode was last enabled.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+type MaintenanceRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Message string `json:"message"`
+}
+
+// Approval is a destructive operation waiting for, or decided by, a
+// second admin. Audit records every step, oldest first.
+type Approval struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	// Target names what the action applies to: a credential ID, a team
+	// name, or "policy".
+	Target string `json:"target"`
+	// Team is set for operations on a team's credentials, whose admins
+	// alone may approve them. Operator admins approve the rest.
+	Team        string     `json:"team,omitempty"`
+	RequestedBy string     `json:"requestedBy"`
+	RequestedAt time.Time  `json:"requestedAt"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	Status      string     `json:"status"`
+	DecidedBy   string     `json:"decidedBy,omitempty"`
+	DecidedAt   *time.Time `json:"decidedAt,omitempty"`
+	// Change is the requested change, for policy and TTL updates.
+	Change any             `json:"change,omitempty"`
+	Audit  []ApprovalEvent `json:"audit"`
+}
+
+// ApprovalEvent is one step in the life of an Approval.
+type ApprovalEvent struct {
+	At     time.Time `json:"at"`
+	Actor  string    `json:"actor,omitempty"`
+	Event  string    `json:"event"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// ErrorResponse is the body returned for every failed request.
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
+}
@@ -0,0 +1,355 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: dyncreds.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	DynamicCredentials_CreateDynamicCredential_FullMethodName = "/dyncreds.v1.DynamicCredentials/CreateDynamicCredential"
+	DynamicCredentials_GetDynamicCredential_FullMethodName    = "/dyncreds.v1.DynamicCredentials/GetDynamicCredential"
+	DynamicCredentials_ListDynamicCredentials_FullMethodName  = "/dyncreds.v1.DynamicCredentials/ListDynamicCredentials"
+	DynamicCredentials_UpdateDynamicCredential_FullMethodName = "/dyncreds.v1.DynamicCredentials/UpdateDynamicCredential"
+	DynamicCredentials_UpdateTTL_FullMethodName               = "/dyncreds.v1.DynamicCredentials/UpdateTTL"
+	DynamicCredentials_DeleteDynamicCredential_FullMethodName = "/dyncreds.v1.DynamicCredentials/DeleteDynamicCredential"
+	DynamicCredentials_RotateDynamicCredential_FullMethodName = "/dyncreds.v1.DynamicCredentials/RotateDynamicCredential"
+)
+
+// DynamicCredentialsClient is the client API for DynamicCredentials service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// DynamicCredentials mirrors the /dyncreds REST API for internal consumers.
+type DynamicCredentialsClient interface {
+	CreateDynamicCredential(ctx context.Context, in *CreateDynamicCredentialRequest, opts ...grpc.CallOption) (*DynamicCredential, error)
+	GetDynamicCredential(ctx context.Context, in *GetDynamicCredentialRequest, opts ...grpc.CallOption) (*DynamicCredential, error)
+	ListDynamicCredentials(ctx context.Context, in *ListDynamicCredentialsRequest, opts ...grpc.CallOption) (*ListDynamicCredentialsResponse, error)
+	UpdateDynamicCredential(ctx context.Context, in *UpdateDynamicCredentialRequest, opts ...grpc.CallOption) (*DynamicCredential, error)
+	// UpdateTTL changes the TTL and propagates it to Terraform workspaces.
+	UpdateTTL(ctx context.Context, in *UpdateTTLRequest, opts ...grpc.CallOption) (*DynamicCredential, error)
+	DeleteDynamicCredential(ctx context.Context, in *DeleteDynamicCredentialRequest, opts ...grpc.CallOption) (*DeleteDynamicCredentialResponse, error)
+	RotateDynamicCredential(ctx context.Context, in *RotateDynamicCredentialRequest, opts ...grpc.CallOption) (*RotateDynamicCredentialResponse, error)
+}
+
+type dynamicCredentialsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDynamicCredentialsClient(cc grpc.ClientConnInterface) DynamicCredentialsClient {
+	return &dynamicCredentialsClient{cc}
+}
+
+func (c *dynamicCredentialsClient) CreateDynamicCredential(ctx context.Context, in *CreateDynamicCredentialRequest, opts ...grpc.CallOption) (*DynamicCredential, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DynamicCredential)
+	err := c.cc.Invoke(ctx, DynamicCredentials_CreateDynamicCredential_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dynamicCredentialsClient) GetDynamicCredential(ctx context.Context, in *GetDynamicCredentialRequest, opts ...grpc.CallOption) (*DynamicCredential, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DynamicCredential)
+	err := c.cc.Invoke(ctx, DynamicCredentials_GetDynamicCredential_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dynamicCredentialsClient) ListDynamicCredentials(ctx context.Context, in *ListDynamicCredentialsRequest, opts ...grpc.CallOption) (*ListDynamicCredentialsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDynamicCredentialsResponse)
+	err := c.cc.Invoke(ctx, DynamicCredentials_ListDynamicCredentials_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dynamicCredentialsClient) UpdateDynamicCredential(ctx context.Context, in *UpdateDynamicCredentialRequest, opts ...grpc.CallOption) (*DynamicCredential, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DynamicCredential)
+	err := c.cc.Invoke(ctx, DynamicCredentials_UpdateDynamicCredential_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dynamicCredentialsClient) UpdateTTL(ctx context.Context, in *UpdateTTLRequest, opts ...grpc.CallOption) (*DynamicCredential, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DynamicCredential)
+	err := c.cc.Invoke(ctx, DynamicCredentials_UpdateTTL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dynamicCredentialsClient) DeleteDynamicCredential(ctx context.Context, in *DeleteDynamicCredentialRequest, opts ...grpc.CallOption) (*DeleteDynamicCredentialResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteDynamicCredentialResponse)
+	err := c.cc.Invoke(ctx, DynamicCredentials_DeleteDynamicCredential_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dynamicCredentialsClient) RotateDynamicCredential(ctx context.Context, in *RotateDynamicCredentialRequest, opts ...grpc.CallOption) (*RotateDynamicCredentialResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RotateDynamicCredentialResponse)
+	err := c.cc.Invoke(ctx, DynamicCredentials_RotateDynamicCredential_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DynamicCredentialsServer is the server API for DynamicCredentials service.
+// All implementations must embed UnimplementedDynamicCredentialsServer
+// for forward compatibility.
+//
+// DynamicCredentials mirrors the /dyncreds REST API for internal consumers.
+type DynamicCredentialsServer interface {
+	CreateDynamicCredential(context.Context, *CreateDynamicCredentialRequest) (*DynamicCredential, error)
+	GetDynamicCredential(context.Context, *GetDynamicCredentialRequest) (*DynamicCredential, error)
+	ListDynamicCredentials(context.Context, *ListDynamicCredentialsRequest) (*ListDynamicCredentialsResponse, error)
+	UpdateDynamicCredential(context.Context, *UpdateDynamicCredentialRequest) (*DynamicCredential, error)
+	// UpdateTTL changes the TTL and propagates it to Terraform workspaces.
+	UpdateTTL(context.Context, *UpdateTTLRequest) (*DynamicCredential, error)
+	DeleteDynamicCredential(context.Context, *DeleteDynamicCredentialRequest) (*DeleteDynamicCredentialResponse, error)
+	RotateDynamicCredential(context.Context, *RotateDynamicCredentialRequest) (*RotateDynamicCredentialResponse, error)
+	mustEmbedUnimplementedDynamicCredentialsServer()
+}
+
+// UnimplementedDynamicCredentialsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDynamicCredentialsServer struct{}
+
+func (UnimplementedDynamicCredentialsServer) CreateDynamicCredential(context.Context, *CreateDynamicCredentialRequest) (*DynamicCredential, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateDynamicCredential not implemented")
+}
+func (UnimplementedDynamicCredentialsServer) GetDynamicCredential(context.Context, *GetDynamicCredentialRequest) (*DynamicCredential, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDynamicCredential not implemented")
+}
+func (UnimplementedDynamicCredentialsServer) ListDynamicCredentials(context.Context, *ListDynamicCredentialsRequest) (*ListDynamicCredentialsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDynamicCredentials not implemented")
+}
+func (UnimplementedDynamicCredentialsServer) UpdateDynamicCredential(context.Context, *UpdateDynamicCredentialRequest) (*DynamicCredential, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateDynamicCredential not implemented")
+}
+func (UnimplementedDynamicCredentialsServer) UpdateTTL(context.Context, *UpdateTTLRequest) (*DynamicCredential, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateTTL not implemented")
+}
+func (UnimplementedDynamicCredentialsServer) DeleteDynamicCredential(context.Context, *DeleteDynamicCredentialRequest) (*DeleteDynamicCredentialResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteDynamicCredential not implemented")
+}
+func (UnimplementedDynamicCredentialsServer) RotateDynamicCredential(context.Context, *RotateDynamicCredentialRequest) (*RotateDynamicCredentialResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RotateDynamicCredential not implemented")
+}
+func (UnimplementedDynamicCredentialsServer) mustEmbedUnimplementedDynamicCredentialsServer() {}
+func (UnimplementedDynamicCredentialsServer) testEmbeddedByValue()                            {}
+
+// UnsafeDynamicCredentialsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DynamicCredentialsServer will
+// result in compilation errors.
+type UnsafeDynamicCredentialsServer interface {
+	mustEmbedUnimplementedDynamicCredentialsServer()
+}
+
+func RegisterDynamicCredentialsServer(s grpc.ServiceRegistrar, srv DynamicCredentialsServer) {
+	// If the following call pancis, it indicates UnimplementedDynamicCredentialsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&DynamicCredentials_ServiceDesc, srv)
+}
+
+func _DynamicCredentials_CreateDynamicCredential_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateDynamicCredentialRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DynamicCredentialsServer).CreateDynamicCredential(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DynamicCredentials_CreateDynamicCredential_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DynamicCredentialsServer).CreateDynamicCredential(ctx, req.(*CreateDynamicCredentialRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DynamicCredentials_GetDynamicCredential_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDynamicCredentialRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DynamicCredentialsServer).GetDynamicCredential(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DynamicCredentials_GetDynamicCredential_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DynamicCredentialsServer).GetDynamicCredential(ctx, req.(*GetDynamicCredentialRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DynamicCredentials_ListDynamicCredentials_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDynamicCredentialsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DynamicCredentialsServer).ListDynamicCredentials(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DynamicCredentials_ListDynamicCredentials_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DynamicCredentialsServer).ListDynamicCredentials(ctx, req.(*ListDynamicCredentialsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DynamicCredentials_UpdateDynamicCredential_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateDynamicCredentialRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DynamicCredentialsServer).UpdateDynamicCredential(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DynamicCredentials_UpdateDynamicCredential_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DynamicCredentialsServer).UpdateDynamicCredential(ctx, req.(*UpdateDynamicCredentialRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DynamicCredentials_UpdateTTL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateTTLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DynamicCredentialsServer).UpdateTTL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DynamicCredentials_UpdateTTL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DynamicCredentialsServer).UpdateTTL(ctx, req.(*UpdateTTLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DynamicCredentials_DeleteDynamicCredential_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteDynamicCredentialRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DynamicCredentialsServer).DeleteDynamicCredential(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DynamicCredentials_DeleteDynamicCredential_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DynamicCredentialsServer).DeleteDynamicCredential(ctx, req.(*DeleteDynamicCredentialRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DynamicCredentials_RotateDynamicCredential_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RotateDynamicCredentialRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DynamicCredentialsServer).RotateDynamicCredential(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DynamicCredentials_RotateDynamicCredential_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DynamicCredentialsServer).RotateDynamicCredential(ctx, req.(*RotateDynamicCredentialRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// DynamicCredentials_ServiceDesc is the grpc.ServiceDesc for DynamicCredentials service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DynamicCredentials_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dyncreds.v1.DynamicCredentials",
+	HandlerType: (*DynamicCredentialsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateDynamicCredential",
+			Handler:    _DynamicCredentials_CreateDynamicCredential_Handler,
+		},
+		{
+			MethodName: "GetDynamicCredential",
+			Handler:    _DynamicCredentials_GetDynamicCredential_Handler,
+		},
+		{
+			MethodName: "ListDynamicCredentials",
+			Handler:    _DynamicCredentials_ListDynamicCredentials_Handler,
+		},
+		{
+			MethodName: "UpdateDynamicCredential",
+			Handler:    _DynamicCredentials_UpdateDynamicCredential_Handler,
+		},
+		{
+			MethodName: "UpdateTTL",
+			Handler:    _DynamicCredentials_UpdateTTL_Handler,
+		},
+		{
+			MethodName: "DeleteDynamicCredential",
+			Handler:    _DynamicCredentials_DeleteDynamicCredential_Handler,
+		},
+		{
+			MethodName: "RotateDynamicCredential",
+			Handler:    _DynamicCredentials_RotateDynamicCredential_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "dyncreds.proto",
+}
@@ -0,0 +1,205 @@
+// policy/policy.go
+
+// Package policy defines the rules dynamic credentials must satisfy when
+// created or updated, loaded from YAML such as:
+//
+//	ttl:
+//	  min: 300
+//	  max: 86400
+//	names:
+//	  patterns: ["[a-z][a-z0-9-]*"]
+//	quotas:
+//	  default: 20
+//	  teams:
+//	    infra: 50
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultTeamTag is the tag identifying a credential's team for quotas.
+const DefaultTeamTag = "team"
+
+// Names of the individual rules, reported with violations.
+const (
+	RuleMinTTL    = "ttl.min"
+	RuleMaxTTL    = "ttl.max"
+	RuleName      = "names.patterns"
+	RuleTeamQuota = "quotas.team"
+)
+
+var (
+	// ErrInvalid is returned for policies that cannot be enforced.
+	ErrInvalid = errors.New("invalid policy")
+	// ErrViolation is matched by every *ViolationError.
+	ErrViolation = errors.New("policy violation")
+)
+
+// Policy bounds the dynamic credentials that may be created or updated.
+// Zero values disable a rule.
+type Policy struct {
+	TTL    TTLPolicy   `yaml:"ttl" json:"ttl"`
+	Names  NamePolicy  `yaml:"names" json:"names"`
+	Quotas QuotaPolicy `yaml:"quotas" json:"quotas"`
+}
+
+// TTLPolicy bounds credential TTLs, in seconds.
+type TTLPolicy struct {
+	Min int `yaml:"min" json:"min,omitempty"`
+	Max int `yaml:"max" json:"max,omitempty"`
+}
+
+// NamePolicy requires credential names to match at least one pattern.
+type NamePolicy struct {
+	// Patterns are regular expressions matched against the whole name.
+	Patterns []string `yaml:"patterns" json:"patterns,omitempty"`
+
+	compiled []*regexp.Regexp
+}
+
+// QuotaPolicy caps how many credentials each team may own. Credentials
+// without a team tag are not counted.
+type QuotaPolicy struct {
+	// TeamTag is the tag naming a credential's team, "team" by default.
+	TeamTag string `yaml:"team_tag" json:"team_tag,omitempty"`
+	// Default applies to teams not listed in Teams.
+	Default int            `yaml:"default" json:"default,omitempty"`
+	Teams   map[string]int `yaml:"teams" json:"teams,omitempty"`
+}
+
+// Violation is a single broken rule.
+type Violation struct {
+	Rule    string `json:"policy"`
+	Message string `json:"message"`
+}
+
+// ViolationError lists every rule a request broke.
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Rule + ": " + v.Message
+	}
+	return "policy violation: " + strings.Join(msgs, "; ")
+}
+
+func (e *ViolationError) Is(target error) bool { return target == ErrViolation }
+
+// Parse reads a policy from YAML, or JSON, rejecting unknown keys.
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if err := p.Compile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Compile checks the policy and prepares its name patterns. It must be
+// called before a policy built in code is enforced.
+func (p *Policy) Compile() error {
+	if p.TTL.Min < 0 || p.TTL.Max < 0 {
+		return fmt.Errorf("%w: ttl bounds must not be negative", ErrInvalid)
+	}
+	if p.TTL.Max > 0 && p.TTL.Min > p.TTL.Max {
+		return fmt.Errorf("%w: ttl.min %d exceeds ttl.max %d", ErrInvalid, p.TTL.Min, p.TTL.Max)
+	}
+	p.Names.compiled = make([]*regexp.Regexp, 0, len(p.Names.Patterns))
+	for _, pattern := range p.Names.Patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("%w: name pattern %q: %v", ErrInvalid, pattern, err)
+		}
+		p.Names.compiled = append(p.Names.compiled, re)
+	}
+	if p.Quotas.Default < 0 {
+		return fmt.Errorf("%w: quotas.default must not be negative", ErrInvalid)
+	}
+	for team, quota := range p.Quotas.Teams {
+		if quota < 0 {
+			return fmt.Errorf("%w: quota for team %q must not be negative", ErrInvalid, team)
+		}
+	}
+	if p.Quotas.TeamTag == "" {
+		p.Quotas.TeamTag = DefaultTeamTag
+	}
+	return nil
+}
+
+// CheckTTL reports a TTL outside the bounds.
+func (p *Policy) CheckTTL(ttl int) []Violation {
+	switch {
+	case p.TTL.Min > 0 && ttl < p.TTL.Min:
+		return []Violation{{RuleMinTTL, fmt.Sprintf("ttl %d is below the minimum of %d seconds", ttl, p.TTL.Min)}}
+	case p.TTL.Max > 0 && ttl > p.TTL.Max:
+		return []Violation{{RuleMaxTTL, fmt.Sprintf("ttl %d exceeds the maximum of %d seconds", ttl, p.TTL.Max)}}
+	}
+	return nil
+}
+
+// CheckName reports a name matching none of the patterns.
+func (p *Policy) CheckName(name string) []Violation {
+	if len(p.Names.compiled) == 0 {
+		return nil
+	}
+	for _, re := range p.Names.compiled {
+		if re.MatchString(name) {
+			return nil
+		}
+	}
+	return []Violation{{RuleName, fmt.Sprintf("name %q matches none of the allowed patterns %s",
+		name, strings.Join(p.Names.Patterns, ", "))}}
+}
+
+// Team returns the team owning a credential with tags, if any.
+func (p *Policy) Team(tags map[string]string) string {
+	return tags[p.Quotas.TeamTag]
+}
+
+// Quota returns the team's credential quota, or zero if unlimited.
+func (p *Policy) Quota(team string) int {
+	if quota, ok := p.Quotas.Teams[team]; ok {
+		return quota
+	}
+	return p.Quotas.Default
+}
+
+// CheckQuota reports adding a credential to a team that already owns
+// count credentials, if that exceeds its quota.
+func (p *Policy) CheckQuota(team string, count int) []Violation {
+	if team == "" {
+		return nil
+	}
+	quota := p.Quota(team)
+	if quota > 0 && count >= quota {
+		return []Violation{{RuleTeamQuota, fmt.Sprintf("team %q already owns %d of its %d dynamic credentials", team, count, quota)}}
+	}
+	return nil
+}
+
+// Err returns a *ViolationError for violations, or nil if there are none.
+func Err(violations ...[]Violation) error {
+	var all []Violation
+	for _, v := range violations {
+		all = append(all, v...)
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	return &ViolationError{Violations: all}
+}
@@ -0,0 +1,86 @@
+// providers/aws.go
+package providers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// STS accepts session durations between 15 minutes and 12 hours; the
+// role's own maximum may be lower.
+const (
+	minSTSDuration = 15 * time.Minute
+	maxSTSDuration = 12 * time.Hour
+)
+
+// sessionNameInvalid matches characters STS rejects in session names.
+var sessionNameInvalid = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// AWS issues temporary credentials by assuming an IAM role with STS.
+// Credentials need a "role_arn" and may set "external_id" and an inline
+// "session_policy" further restricting the role.
+type AWS struct {
+	client *sts.Client
+}
+
+// NewAWS creates the provider with the SDK's default credential chain
+// (environment, shared config, instance or task role).
+func NewAWS(ctx context.Context) (*AWS, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &AWS{client: sts.NewFromConfig(cfg)}, nil
+}
+
+func (p *AWS) Name() string { return "aws" }
+
+func (p *AWS) ValidateConfig(config map[string]string) error {
+	return requireConfig(p.Name(), config, "role_arn")
+}
+
+// Issue assumes the role for req.TTL, clamped to the range STS allows.
+func (p *AWS) Issue(ctx context.Context, req IssueRequest) (*Issued, error) {
+	duration := min(max(req.TTL, minSTSDuration), maxSTSDuration)
+	sessionName := sessionNameInvalid.ReplaceAllString("dcreds-"+req.Name, "-")
+	if len(sessionName) > 64 {
+		sessionName = sessionName[:64]
+	}
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(req.Config["role_arn"]),
+		RoleSessionName: aws.String(sessionName),
+		DurationSeconds: aws.Int32(int32(duration / time.Second)),
+	}
+	if v := req.Config["external_id"]; v != "" {
+		input.ExternalId = aws.String(v)
+	}
+	if v := req.Config["session_policy"]; v != "" {
+		input.Policy = aws.String(v)
+	}
+	out, err := p.client.AssumeRole(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("aws: assume role %s: %w", req.Config["role_arn"], err)
+	}
+	creds := out.Credentials
+	return &Issued{
+		KeyID: aws.ToString(creds.AccessKeyId),
+		Secret: map[string]string{
+			"access_key_id":     aws.ToString(creds.AccessKeyId),
+			"secret_access_key": aws.ToString(creds.SecretAccessKey),
+			"session_token":     aws.ToString(creds.SessionToken),
+		},
+		ExpiresAt: aws.ToTime(creds.Expiration).UTC(),
+	}, nil
+}
+
+// Revoke is a no-op: STS sessions cannot be revoked individually and
+// expire on their own.
+func (p *AWS) Revoke(ctx context.Context, config map[string]string, keyID string) error {
+	return nil
+}
@@ -0,0 +1,147 @@
+// providers/azure.go
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Azure adds client secrets to an Entra ID application registration
+// through Microsoft Graph. Credentials need the application's
+// "application_object_id" and "application_id" (client ID) and may set
+// "tenant_id" to hand out with the secret.
+type Azure struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// GraphEndpoint and LoginEndpoint are the Graph API and identity
+	// platform base URLs.
+	GraphEndpoint string
+	LoginEndpoint string
+	HTTPClient    *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewAzureFromEnv creates the provider with the service principal from
+// AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET. It needs the
+// Application.ReadWrite.All Graph permission, or ownership of the
+// applications it manages.
+func NewAzureFromEnv() (*Azure, error) {
+	p := &Azure{
+		TenantID:      os.Getenv("AZURE_TENANT_ID"),
+		ClientID:      os.Getenv("AZURE_CLIENT_ID"),
+		ClientSecret:  os.Getenv("AZURE_CLIENT_SECRET"),
+		GraphEndpoint: "https://graph.microsoft.com/v1.0",
+		LoginEndpoint: "https://login.microsoftonline.com",
+		HTTPClient:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if p.TenantID == "" || p.ClientID == "" || p.ClientSecret == "" {
+		return nil, fmt.Errorf("azure: AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET must be set")
+	}
+	return p, nil
+}
+
+func (p *Azure) Name() string { return "azure" }
+
+func (p *Azure) ValidateConfig(config map[string]string) error {
+	return requireConfig(p.Name(), config, "application_object_id", "application_id")
+}
+
+// Issue adds a password credential to the application that Azure expires
+// after req.TTL.
+func (p *Azure) Issue(ctx context.Context, req IssueRequest) (*Issued, error) {
+	expiresAt := time.Now().Add(req.TTL).UTC()
+	body := map[string]any{
+		"passwordCredential": map[string]any{
+			"displayName": "dcreds " + req.Name + " " + req.CredentialID,
+			"endDateTime": expiresAt.Format(time.RFC3339),
+		},
+	}
+	var cred struct {
+		KeyID      string `json:"keyId"`
+		SecretText string `json:"secretText"`
+	}
+	path := "/applications/" + url.PathEscape(req.Config["application_object_id"]) + "/addPassword"
+	if err := p.do(ctx, http.MethodPost, path, body, &cred); err != nil {
+		return nil, err
+	}
+	secret := map[string]string{
+		"client_id":     req.Config["application_id"],
+		"client_secret": cred.SecretText,
+	}
+	if tenantID := req.Config["tenant_id"]; tenantID != "" {
+		secret["tenant_id"] = tenantID
+	}
+	return &Issued{KeyID: cred.KeyID, Secret: secret, ExpiresAt: expiresAt}, nil
+}
+
+// Revoke removes the password credential keyID from the application.
+func (p *Azure) Revoke(ctx context.Context, config map[string]string, keyID string) error {
+	if keyID == "" {
+		return nil
+	}
+	path := "/applications/" + url.PathEscape(config["application_object_id"]) + "/removePassword"
+	return ignoreNotFound(p.do(ctx, http.MethodPost, path, map[string]string{"keyId": keyID}, nil))
+}
+
+func (p *Azure) do(ctx context.Context, method, path string, body, out any) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.GraphEndpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	return doJSON(p.HTTPClient, req, "azure", out)
+}
+
+// accessToken returns a cached Graph token, fetching a new one with the
+// client credentials grant shortly before the cached one expires.
+func (p *Azure) accessToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && time.Now().Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"scope":         {"https://graph.microsoft.com/.default"},
+	}
+	tokenURL := p.LoginEndpoint + "/" + url.PathEscape(p.TenantID) + "/oauth2/v2.0/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := doJSON(p.HTTPClient, req, "azure", &resp); err != nil {
+		return "", err
+	}
+	p.token = resp.AccessToken
+	p.tokenExpiry = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+	return p.token, nil
+}
@@ -0,0 +1,146 @@
+// providers/gcp.go
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// GCP issues service account keys through the IAM API. Credentials need
+// a "service_account" email. Keys do not expire on their own, so callers
+// must revoke them when they are rotated out.
+type GCP struct {
+	// Endpoint is the IAM API base URL.
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// NewGCP creates the provider with Application Default Credentials.
+func NewGCP(ctx context.Context) (*GCP, error) {
+	ts, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, err
+	}
+	client := oauth2.NewClient(ctx, ts)
+	client.Timeout = 30 * time.Second
+	return &GCP{Endpoint: "https://iam.googleapis.com/v1", HTTPClient: client}, nil
+}
+
+func (p *GCP) Name() string { return "gcp" }
+
+func (p *GCP) ValidateConfig(config map[string]string) error {
+	return requireConfig(p.Name(), config, "service_account")
+}
+
+// Issue creates a new JSON key for the service account. The key's
+// lifetime is not limited by req.TTL; the caller revokes it.
+func (p *GCP) Issue(ctx context.Context, req IssueRequest) (*Issued, error) {
+	path := "/projects/-/serviceAccounts/" + url.PathEscape(req.Config["service_account"]) + "/keys"
+	var key struct {
+		Name           string `json:"name"`
+		PrivateKeyData string `json:"privateKeyData"`
+	}
+	if err := p.do(ctx, http.MethodPost, path, map[string]string{}, &key); err != nil {
+		return nil, err
+	}
+	keyFile, err := base64.StdEncoding.DecodeString(key.PrivateKeyData)
+	if err != nil {
+		return nil, fmt.Errorf("gcp: decode key: %w", err)
+	}
+	return &Issued{
+		KeyID: key.Name,
+		Secret: map[string]string{
+			"service_account": req.Config["service_account"],
+			"key_json":        string(keyFile),
+		},
+	}, nil
+}
+
+// Revoke deletes the key named by keyID.
+func (p *GCP) Revoke(ctx context.Context, config map[string]string, keyID string) error {
+	if keyID == "" {
+		return nil
+	}
+	return ignoreNotFound(p.do(ctx, http.MethodDelete, "/"+strings.TrimPrefix(keyID, "/"), nil, nil))
+}
+
+func (p *GCP) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.Endpoint+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return doJSON(p.HTTPClient, req, "gcp", out)
+}
+
+// apiError is a non-2xx response from a cloud API.
+type apiError struct {
+	provider string
+	method   string
+	url      string
+	status   int
+	body     string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s %s: %d %s", e.provider, e.method, e.url, e.status, e.body)
+}
+
+// ignoreNotFound drops 404 errors, for deleting secrets that are already gone.
+func ignoreNotFound(err error) error {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// doJSON sends req and decodes a JSON response into out, returning an
+// *apiError for non-2xx responses.
+func doJSON(client *http.Client, req *http.Request, provider string, out any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &apiError{
+			provider: provider,
+			method:   req.Method,
+			url:      req.URL.Redacted(),
+			status:   resp.StatusCode,
+			body:     strings.TrimSpace(string(msg)),
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s: decode response: %w", provider, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// providers/providers.go
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TokenProvider is the name of the built-in provider that issues random
+// bearer tokens. It is used when a credential names no provider.
+const TokenProvider = "token"
+
+var (
+	// ErrUnknownProvider is returned for provider names that are not registered.
+	ErrUnknownProvider = errors.New("unknown credential provider")
+	// ErrInvalidConfig is returned when a credential's provider config is
+	// missing settings the provider needs.
+	ErrInvalidConfig = errors.New("invalid provider config")
+)
+
+// IssueRequest describes the cloud credential to provision.
+type IssueRequest struct {
+	// CredentialID and Name identify the dynamic credential, for naming
+	// the cloud-side secret.
+	CredentialID string
+	Name         string
+	// Config holds the provider settings stored on the credential.
+	Config map[string]string
+	TTL    time.Duration
+}
+
+// Issued is secret material returned by a provider. Secret is handed to
+// the caller once and never stored; KeyID is kept to revoke it later.
+// ExpiresAt is when the cloud itself invalidates the secret, and is zero
+// for secrets that stay valid until revoked.
+type Issued struct {
+	KeyID     string
+	Secret    map[string]string
+	ExpiresAt time.Time
+}
+
+// CredentialProvider provisions and revokes credentials in one cloud.
+type CredentialProvider interface {
+	// Name is the value of the credential's provider field selecting it.
+	Name() string
+	// ValidateConfig checks the provider settings of a credential before
+	// anything is provisioned.
+	ValidateConfig(config map[string]string) error
+	// Issue provisions a new secret valid for about req.TTL; providers
+	// may clamp the TTL to what their cloud allows.
+	Issue(ctx context.Context, req IssueRequest) (*Issued, error)
+	// Revoke invalidates a secret issued earlier. Revoking a secret that
+	// no longer exists is not an error, and providers whose secrets cannot
+	// be revoked only let them expire.
+	Revoke(ctx context.Context, config map[string]string, keyID string) error
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]CredentialProvider{TokenProvider: Token{}}
+)
+
+// Register makes p selectable by its name, replacing any provider
+// registered under the same name.
+func Register(p CredentialProvider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[p.Name()] = p
+}
+
+// Get returns the provider registered under name; an empty name selects
+// TokenProvider.
+func Get(name string) (CredentialProvider, error) {
+	if name == "" {
+		name = TokenProvider
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
+// Names returns the names of all registered providers, sorted.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requireConfig checks that every key is set in config.
+func requireConfig(provider string, config map[string]string, keys ...string) error {
+	for _, key := range keys {
+		if config[key] == "" {
+			return fmt.Errorf("%w: %s provider requires %q", ErrInvalidConfig, provider, key)
+		}
+	}
+	return nil
+}
+
+// Token issues random bearer tokens that exist only in this service, for
+// credentials not backed by a cloud.
+type Token struct{}
+
+func (Token) Name() string { return TokenProvider }
+
+func (Token) ValidateConfig(config map[string]string) error { return nil }
+
+// Issue returns a random 256-bit token.
+func (Token) Issue(ctx context.Context, req IssueRequest) (*Issued, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &Issued{Secret: map[string]string{"token": base64.RawURLEncoding.EncodeToString(b)}}, nil
+}
+
+// Revoke is a no-op; token validity is tracked by the lease or credential.
+func (Token) Revoke(ctx context.Context, config map[string]string, keyID string) error {
+	return nil
+}
@@ -2,18 +2,105 @@
 package routes
 
 import (
+	"net/http"
 	"test-go/handlers"
+	"test-go/middleware"
+	"test-go/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-projects-root/pkg/featureflags"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func SetupRoutes(router *gin.Engine) {
+	// Operator API; credentials of a team are only reachable by ID through it
 	dynCreds := router.Group("/dyncreds")
 	{
 		dynCreds.POST("", handlers.CreateDynamicCredentialHandler)
-		dynCreds.GET("/:dyncredId", handlers.GetDynamicCredentialHandler)
-		dynCreds.PUT("/:dyncredId", handlers.UpdateDynamicCredentialHandler)
-		dynCreds.DELETE("/:dyncredId", handlers.DeleteDynamicCredentialHandler)
-		dynCreds.PATCH("/:dyncredId", handlers.PatchDynamicCredentialHandler)
+		dynCreds.GET("", handlers.ListDynamicCredentialsHandler)
+		dynCreds.POST("/export", handlers.ExportDynamicCredentialsHandler)
+		dynCreds.POST("/import", handlers.ImportDynamicCredentialsHandler)
+		dynCreds.GET("/expiring", handlers.ListExpiringCredentialsHandler)
+		dynCreds.GET("/stale", handlers.ListStaleCredentialsHandler)
+		dynCreds.GET("/events", handlers.CredentialEventsHandler)
+		setupCredentialRoutes(dynCreds.Group("/:dyncredId", middleware.TeamCredentialMiddleware()))
 	}
+
+	// Team namespaces, open to team members only
+	team := router.Group("/teams/:team", middleware.TeamMembershipMiddleware(services.TeamRoleMember))
+	{
+		team.GET("", handlers.GetTeamHandler)
+		team.POST("/dyncreds", handlers.CreateDynamicCredentialHandler)
+		team.GET("/dyncreds", handlers.ListDynamicCredentialsHandler)
+		team.GET("/dyncreds/events", handlers.CredentialEventsHandler)
+		setupCredentialRoutes(team.Group("/dyncreds/:dyncredId", middleware.TeamCredentialMiddleware()))
+
+		members := team.Group("/members", middleware.TeamMembershipMiddleware(services.TeamRoleAdmin))
+		members.PUT("/:user", handlers.SetTeamMemberHandler)
+		members.DELETE("/:user", handlers.RemoveTeamMemberHandler)
+	}
+
+	propagation := router.Group("/propagation")
+	{
+		propagation.GET("/jobs", handlers.ListPropagationJobsHandler)
+		propagation.GET("/jobs/:jobId", handlers.GetPropagationJobHandler)
+		propagation.GET("/conflicts", handlers.ListConflictsHandler)
+		propagation.POST("/conflicts/:workspaceId/resolve", handlers.ResolveConflictHandler)
+	}
+
+	// Two-person approval of deletions, TTL changes and TTL policy changes
+	approvals := router.Group("/approvals", middleware.RequireUserMiddleware())
+	{
+		approvals.GET("", handlers.ListApprovalsHandler)
+		approvals.GET("/:approvalId", handlers.GetApprovalHandler)
+		approvals.POST("/:approvalId/approve", handlers.ApproveHandler)
+		approvals.POST("/:approvalId/reject", handlers.RejectHandler)
+	}
+
+	// Prometheus metrics, including the credential expiry forecast
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Admin endpoints, open to operator admins only
+	admin := router.Group("/admin", middleware.OperatorAdminMiddleware())
+	{
+		teams := admin.Group("/teams")
+		teams.POST("", handlers.CreateTeamHandler)
+		teams.GET("", handlers.ListTeamsHandler)
+		teams.GET("/:team", handlers.GetTeamHandler)
+		teams.DELETE("/:team", handlers.DeleteTeamHandler)
+		teams.PUT("/:team/members/:user", handlers.SetTeamMemberHandler)
+		teams.DELETE("/:team/members/:user", handlers.RemoveTeamMemberHandler)
+
+		admin.GET("/policy", handlers.GetPolicyHandler)
+		admin.PUT("/policy", handlers.SetPolicyHandler)
+
+		admin.GET("/maintenance", handlers.GetMaintenanceHandler)
+		admin.PUT("/maintenance", handlers.SetMaintenanceHandler)
+
+		flags := gin.WrapH(http.StripPrefix("/admin/flags", featureflags.Default.Handler()))
+		admin.Any("/flags", flags)
+		admin.Any("/flags/*name", flags)
+	}
+}
+
+// setupCredentialRoutes registers the routes acting on the credential
+// named by :dyncredId in cred.
+func setupCredentialRoutes(cred *gin.RouterGroup) {
+	cred.GET("", handlers.GetDynamicCredentialHandler)
+	cred.PUT("", handlers.UpdateDynamicCredentialHandler)
+	cred.DELETE("", handlers.DeleteDynamicCredentialHandler)
+	cred.PATCH("", handlers.PatchDynamicCredentialHandler)
+	cred.POST("/ttl/simulate", handlers.SimulateTTLHandler)
+	cred.POST("/rotate", handlers.RotateDynamicCredentialHandler)
+	cred.GET("/history", handlers.GetRotationHistoryHandler)
+	cred.POST("/leases", handlers.CreateLeaseHandler)
+	cred.GET("/leases", handlers.ListLeasesHandler)
+	cred.GET("/leases/:leaseId", handlers.GetLeaseHandler)
+	cred.POST("/leases/:leaseId/renew", handlers.RenewLeaseHandler)
+	cred.DELETE("/leases/:leaseId", handlers.RevokeLeaseHandler)
+	cred.POST("/workspace-mappings", handlers.CreateWorkspaceMappingHandler)
+	cred.GET("/workspace-mappings", handlers.ListWorkspaceMappingsHandler)
+	cred.GET("/workspace-mappings/:mappingId", handlers.GetWorkspaceMappingHandler)
+	cred.PUT("/workspace-mappings/:mappingId", handlers.UpdateWorkspaceMappingHandler)
+	cred.DELETE("/workspace-mappings/:mappingId", handlers.DeleteWorkspaceMappingHandler)
 }
@@ -0,0 +1,343 @@
+// services/approvals.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"test-go/models"
+	"test-go/policy"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions that need a second admin's approval when approvals are enabled.
+const (
+	ApprovalDeleteCredential = "delete_credential"
+	ApprovalDeleteTeam       = "delete_team"
+	// ApprovalSetPolicy covers policy updates changing the TTL bounds,
+	// which apply to every credential.
+	ApprovalSetPolicy = "set_policy"
+	// ApprovalUpdateTTL covers TTL changes, which propagate to Terraform
+	// workspaces.
+	ApprovalUpdateTTL = "update_ttl"
+)
+
+// Approval states. Pending approvals become expired once past ExpiresAt.
+const (
+	ApprovalPending  = "pending"
+	ApprovalExecuted = "executed"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+// ApprovalStatuses lists every approval state.
+var ApprovalStatuses = []string{ApprovalPending, ApprovalExecuted, ApprovalRejected, ApprovalExpired}
+
+// DefaultApprovalTTL is how long requests wait for approval by default.
+const DefaultApprovalTTL = 24 * time.Hour
+
+var (
+	// ErrApprovalNotFound is returned for unknown approval IDs.
+	ErrApprovalNotFound = errors.New("approval not found")
+	// ErrApprovalDecided is returned when acting on an approval that is no
+	// longer pending, or is being executed.
+	ErrApprovalDecided = errors.New("approval is no longer pending")
+	// ErrSelfApproval is returned when the requester tries to approve
+	// their own request.
+	ErrSelfApproval = errors.New("requests must be approved by a second admin")
+	// ErrInvalidApprovalStatus is returned when listing an unknown status.
+	ErrInvalidApprovalStatus = errors.New("invalid approval status")
+)
+
+// pendingApproval is an approval and the operation it runs once approved.
+type pendingApproval struct {
+	approval  models.Approval
+	execute   func(ctx context.Context) error
+	executing bool
+}
+
+var (
+	approvalsMu      sync.Mutex
+	approvalsEnabled bool
+	approvalTTL      = DefaultApprovalTTL
+	approvals        = make(map[string]*pendingApproval)
+)
+
+// ConfigureApprovals turns two-person approval of destructive operations
+// on or off, with requests expiring after ttl.
+func ConfigureApprovals(enabled bool, ttl time.Duration) {
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	approvalsEnabled = enabled
+	if ttl > 0 {
+		approvalTTL = ttl
+	}
+}
+
+// ApprovalsEnabled reports whether destructive operations need approval.
+func ApprovalsEnabled() bool {
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	return approvalsEnabled
+}
+
+// RequestCredentialDeletion asks for approval to delete the credential id.
+func RequestCredentialDeletion(id, user string) (*models.Approval, error) {
+	storeMu.RLock()
+	cred, exists := dynCredsStore[id]
+	team := ""
+	if exists {
+		team = cred.Team
+	}
+	storeMu.RUnlock()
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return requestApproval(ApprovalDeleteCredential, id, team, user, nil, func(ctx context.Context) error {
+		return deleteCredential(ctx, id, 0, "approved deletion")
+	})
+}
+
+// RequestTTLChange asks for approval to set the TTL of the credential id,
+// still at version, and propagate it to its Terraform workspaces.
+func RequestTTLChange(id string, version, ttl int, user string) (*models.Approval, error) {
+	storeMu.RLock()
+	cred, exists := dynCredsStore[id]
+	var err error
+	team := ""
+	if !exists {
+		err = ErrNotFound
+	} else {
+		err = checkVersionLocked(cred, version)
+		team = cred.Team
+	}
+	storeMu.RUnlock()
+	if err == nil {
+		err = policy.Err(GetPolicy().CheckTTL(ttl))
+	}
+	if err != nil {
+		return nil, err
+	}
+	change := models.UpdateTTLRequest{TTL: ttl}
+	return requestApproval(ApprovalUpdateTTL, id, team, user, change, func(ctx context.Context) error {
+		if _, err := UpdateDynamicCredentialTTL(ctx, id, version, ttl); err != nil {
+			return err
+		}
+		// The TTL is set; failed workspaces are left to the propagation
+		// job, so the approval is not run twice.
+		if job, err := UpdateTTLForAllWorkspaces(ctx, id, ttl); err != nil {
+			jobID := ""
+			if job != nil {
+				jobID = job.ID
+			}
+			log.Printf("approved TTL change of %s: propagation job %q failed: %v", id, jobID, err)
+		}
+		return nil
+	})
+}
+
+// RequestTeamDeletion asks for approval to delete the team name.
+func RequestTeamDeletion(name, user string) (*models.Approval, error) {
+	storeMu.RLock()
+	_, exists := teams[name]
+	storeMu.RUnlock()
+	if !exists {
+		return nil, ErrTeamNotFound
+	}
+	return requestApproval(ApprovalDeleteTeam, name, "", user, nil, func(context.Context) error {
+		return DeleteTeam(name)
+	})
+}
+
+// RequestPolicyChange asks for approval to replace the policy with p.
+func RequestPolicyChange(p *policy.Policy, user string) (*models.Approval, error) {
+	if err := p.Compile(); err != nil {
+		return nil, err
+	}
+	return requestApproval(ApprovalSetPolicy, "policy", "", user, p, func(context.Context) error {
+		return SetPolicy(p)
+	})
+}
+
+func requestApproval(action, target, team, user string, change any, execute func(ctx context.Context) error) (*models.Approval, error) {
+	now := time.Now().UTC()
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	a := &pendingApproval{
+		approval: models.Approval{
+			ID:          uuid.New().String(),
+			Action:      action,
+			Target:      target,
+			Team:        team,
+			RequestedBy: user,
+			RequestedAt: now,
+			ExpiresAt:   now.Add(approvalTTL),
+			Status:      ApprovalPending,
+			Change:      change,
+		},
+		execute: execute,
+	}
+	auditLocked(a, now, user, "requested", "")
+	approvals[a.approval.ID] = a
+	return cloneApproval(a), nil
+}
+
+// ApproveRequest runs the operation of approval id on behalf of user, who
+// must not have requested it, and must be an admin of the team the
+// request concerns, or an operator admin for requests outside teams.
+// If the operation fails the approval stays pending, so it can be
+// approved again once the cause is fixed.
+func ApproveRequest(ctx context.Context, id, user string) (*models.Approval, error) {
+	approvalsMu.Lock()
+	a, err := pendingLocked(id, time.Now().UTC())
+	if err == nil && a.approval.RequestedBy == user {
+		err = ErrSelfApproval
+	}
+	if err == nil {
+		err = checkApproverLocked(a, user)
+	}
+	if err != nil {
+		approvalsMu.Unlock()
+		return nil, err
+	}
+	a.executing = true
+	auditLocked(a, time.Now().UTC(), user, "approved", "")
+	approvalsMu.Unlock()
+
+	execErr := a.execute(ctx)
+
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	a.executing = false
+	now := time.Now().UTC()
+	if execErr != nil {
+		auditLocked(a, now, user, "failed", execErr.Error())
+		return nil, execErr
+	}
+	a.approval.Status, a.approval.DecidedBy, a.approval.DecidedAt = ApprovalExecuted, user, &now
+	auditLocked(a, now, user, "executed", "")
+	return cloneApproval(a), nil
+}
+
+// RejectRequest rejects approval id. Requesters may withdraw their own
+// requests; otherwise only those who may approve it can reject it.
+func RejectRequest(id, user, reason string) (*models.Approval, error) {
+	now := time.Now().UTC()
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	a, err := pendingLocked(id, now)
+	if err != nil {
+		return nil, err
+	}
+	if a.approval.RequestedBy != user {
+		if err := checkApproverLocked(a, user); err != nil {
+			return nil, err
+		}
+	}
+	a.approval.Status, a.approval.DecidedBy, a.approval.DecidedAt = ApprovalRejected, user, &now
+	auditLocked(a, now, user, "rejected", reason)
+	return cloneApproval(a), nil
+}
+
+// GetApproval returns approval id.
+func GetApproval(id string) (*models.Approval, error) {
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	a, exists := approvals[id]
+	if !exists {
+		return nil, ErrApprovalNotFound
+	}
+	expireLocked(a, time.Now().UTC())
+	return cloneApproval(a), nil
+}
+
+// ListApprovals returns the approvals in status, or all of them if status
+// is empty, oldest first.
+func ListApprovals(status string) ([]*models.Approval, error) {
+	if status != "" && !containsString(ApprovalStatuses, status) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidApprovalStatus, status)
+	}
+	now := time.Now().UTC()
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	list := []*models.Approval{}
+	for _, a := range approvals {
+		expireLocked(a, now)
+		if status == "" || a.approval.Status == status {
+			list = append(list, cloneApproval(a))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].RequestedAt.Equal(list[j].RequestedAt) {
+			return list[i].RequestedAt.Before(list[j].RequestedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+// checkApproverLocked checks user is an admin of the team a concerns, or
+// an operator admin when a is outside teams. Callers must hold approvalsMu.
+func checkApproverLocked(a *pendingApproval, user string) error {
+	if a.approval.Team != "" {
+		return CheckTeamRole(a.approval.Team, user, TeamRoleAdmin)
+	}
+	return CheckOperatorAdmin(user)
+}
+
+// pendingLocked returns approval id if it can still be decided. Callers
+// must hold approvalsMu.
+func pendingLocked(id string, now time.Time) (*pendingApproval, error) {
+	a, exists := approvals[id]
+	if !exists {
+		return nil, ErrApprovalNotFound
+	}
+	expireLocked(a, now)
+	if a.approval.Status != ApprovalPending || a.executing {
+		return nil, fmt.Errorf("%w: %s", ErrApprovalDecided, a.approval.Status)
+	}
+	return a, nil
+}
+
+// expireLocked expires a once it is past its deadline. An approval being
+// executed finishes first. Callers must hold approvalsMu.
+func expireLocked(a *pendingApproval, now time.Time) {
+	if a.approval.Status == ApprovalPending && !a.executing && !now.Before(a.approval.ExpiresAt) {
+		a.approval.Status = ApprovalExpired
+		auditLocked(a, a.approval.ExpiresAt, "", "expired", "")
+	}
+}
+
+// auditLocked appends an event to the audit trail of a and logs it.
+// Callers must hold approvalsMu.
+func auditLocked(a *pendingApproval, at time.Time, actor, event, detail string) {
+	a.approval.Audit = append(a.approval.Audit, models.ApprovalEvent{At: at, Actor: actor, Event: event, Detail: detail})
+	msg := fmt.Sprintf("approval %s (%s %s): %s", a.approval.ID, a.approval.Action, a.approval.Target, event)
+	if actor != "" {
+		msg += fmt.Sprintf(" by %q", actor)
+	}
+	if detail != "" {
+		msg += ": " + detail
+	}
+	log.Print(msg)
+}
+
+func cloneApproval(a *pendingApproval) *models.Approval {
+	c := a.approval
+	c.Audit = append([]models.ApprovalEvent(nil), a.approval.Audit...)
+	return &c
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+// services/bundle.go
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"test-go/models"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// BundleVersion is the bundle format written by ExportBundle.
+const BundleVersion = 1
+
+// Import conflict policies, applied when a credential ID already exists.
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+const (
+	bundleKDF      = "scrypt"
+	scryptN        = 1 << 15
+	scryptR        = 8
+	scryptP        = 1
+	bundleKeyBytes = 32
+	bundleSaltSize = 16
+)
+
+var (
+	// ErrInvalidBundle is returned when a bundle cannot be decrypted, either
+	// because the passphrase is wrong or the bundle was tampered with.
+	ErrInvalidBundle = errors.New("invalid bundle")
+	// ErrUnsupportedBundle is returned for bundle versions or KDFs this build cannot read.
+	ErrUnsupportedBundle = errors.New("unsupported bundle")
+	// ErrImportConflict is returned by the fail policy when IDs already exist.
+	ErrImportConflict = errors.New("credentials already exist")
+	// ErrInvalidConflictPolicy is returned for unknown conflict policies.
+	ErrInvalidConflictPolicy = errors.New("invalid conflict policy")
+)
+
+// bundlePayload is the plaintext sealed inside a bundle.
+type bundlePayload struct {
+	Credentials     []models.DynamicCredential        `json:"credentials"`
+	RotationHistory map[string][]models.RotationEvent `json:"rotation_history,omitempty"`
+}
+
+// ExportBundle encrypts the credentials matching selector, restricted to ids
+// when given, into a bundle sealed with passphrase.
+func ExportBundle(passphrase string, selector Selector, ids []string) (*models.Bundle, error) {
+	payload := bundlePayload{RotationHistory: make(map[string][]models.RotationEvent)}
+
+	storeMu.RLock()
+	if len(ids) > 0 {
+		for _, id := range ids {
+			cred, exists := dynCredsStore[id]
+			if !exists {
+				storeMu.RUnlock()
+				return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+			}
+			if selector.Matches(cred.Tags) {
+				payload.Credentials = append(payload.Credentials, *cred)
+			}
+		}
+	} else {
+		for _, cred := range dynCredsStore {
+			if selector.Matches(cred.Tags) {
+				payload.Credentials = append(payload.Credentials, *cred)
+			}
+		}
+	}
+	for _, cred := range payload.Credentials {
+		if history := rotationHistory[cred.ID]; len(history) > 0 {
+			payload.RotationHistory[cred.ID] = append([]models.RotationEvent{}, history...)
+		}
+	}
+	storeMu.RUnlock()
+
+	sort.Slice(payload.Credentials, func(i, j int) bool {
+		return payload.Credentials[i].ID < payload.Credentials[j].ID
+	})
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &models.Bundle{
+		Version:   BundleVersion,
+		CreatedAt: time.Now().UTC(),
+		KDF:       bundleKDF,
+		Salt:      make([]byte, bundleSaltSize),
+		Count:     len(payload.Credentials),
+	}
+	if _, err := rand.Read(bundle.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := bundleCipher(passphrase, bundle.Salt)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(bundle.Nonce); err != nil {
+		return nil, err
+	}
+	bundle.Ciphertext = aead.Seal(nil, bundle.Nonce, plaintext, bundleAAD(bundle))
+	return bundle, nil
+}
+
+// ImportBundle decrypts bundle and stores its credentials, resolving ID
+// conflicts with policy. The fail policy imports nothing when any conflict
+// exists. Imported credentials must satisfy the local policy and live in
+// an existing team, or have none; the skip policy skips those that do not,
+// the others import nothing. Imported credentials are re-evaluated against
+// the local lifetime policy.
+func ImportBundle(passphrase string, bundle models.Bundle, policy string) (*models.ImportResult, error) {
+	if policy == "" {
+		policy = ConflictFail
+	}
+	if policy != ConflictSkip && policy != ConflictOverwrite && policy != ConflictFail {
+		return nil, fmt.Errorf("%w: %q (want %s, %s or %s)", ErrInvalidConflictPolicy, policy, ConflictSkip, ConflictOverwrite, ConflictFail)
+	}
+	payload, err := openBundle(passphrase, bundle)
+	if err != nil {
+		return nil, err
+	}
+	for _, cred := range payload.Credentials {
+		if cred.ID == "" {
+			return nil, fmt.Errorf("%w: credential without ID", ErrInvalidBundle)
+		}
+		if err := ValidateTags(cred.Tags); err != nil {
+			return nil, fmt.Errorf("credential %s: %w", cred.ID, err)
+		}
+	}
+	p := GetPolicy()
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	if policy == ConflictFail {
+		var conflicts []string
+		for _, cred := range payload.Credentials {
+			if _, exists := dynCredsStore[cred.ID]; exists {
+				conflicts = append(conflicts, cred.ID)
+			}
+		}
+		if len(conflicts) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrImportConflict, strings.Join(conflicts, ", "))
+		}
+	}
+
+	// Credentials are stored one by one so each counts towards the quotas
+	// checked for the next; undo restores the store if one is rejected.
+	type replaced struct {
+		cred    *models.DynamicCredential
+		history []models.RotationEvent
+	}
+	undo := make(map[string]replaced)
+	rollback := func() {
+		for id, prev := range undo {
+			if prev.cred == nil {
+				delete(dynCredsStore, id)
+				delete(rotationHistory, id)
+				continue
+			}
+			dynCredsStore[id] = prev.cred
+			rotationHistory[id] = prev.history
+		}
+	}
+
+	result := &models.ImportResult{Imported: []string{}, Overwritten: []string{}, Skipped: []string{}}
+	var events []string
+	var imported []*models.DynamicCredential
+	for i := range payload.Credentials {
+		cred := payload.Credentials[i]
+		eventType := EventCreated
+		existing, exists := dynCredsStore[cred.ID]
+		if exists && policy == ConflictSkip {
+			result.Skipped = append(result.Skipped, cred.ID)
+			continue
+		}
+		err := checkTeamLocked(cred.Team)
+		if err == nil {
+			err = checkPolicyLocked(p, existing, cred.Team, cred.Name, cred.TTL, cred.Tags)
+		}
+		if err != nil {
+			if policy == ConflictSkip {
+				result.Skipped = append(result.Skipped, cred.ID)
+				continue
+			}
+			rollback()
+			return nil, fmt.Errorf("credential %s: %w", cred.ID, err)
+		}
+		if exists {
+			result.Overwritten = append(result.Overwritten, cred.ID)
+			// Invalidate versions read before the overwrite.
+			cred.Version = max(cred.Version, existing.Version)
+			eventType = EventUpdated
+		} else {
+			result.Imported = append(result.Imported, cred.ID)
+		}
+		if _, seen := undo[cred.ID]; !seen {
+			undo[cred.ID] = replaced{existing, rotationHistory[cred.ID]}
+		}
+		// Cloud secrets belong to the source environment, which revokes them.
+		cred.ProviderKeyID = ""
+		cred.SecretExpiresAt = nil
+		cred.Version++
+		applyLifetime(&cred)
+		dynCredsStore[cred.ID] = &cred
+		rotationHistory[cred.ID] = payload.RotationHistory[cred.ID]
+		events = append(events, eventType)
+		imported = append(imported, &cred)
+	}
+	for i, cred := range imported {
+		publishEvent(events[i], "import", cred)
+	}
+	return result, nil
+}
+
+func openBundle(passphrase string, bundle models.Bundle) (*bundlePayload, error) {
+	if bundle.Version != BundleVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupportedBundle, bundle.Version)
+	}
+	if bundle.KDF != bundleKDF {
+		return nil, fmt.Errorf("%w: kdf %q", ErrUnsupportedBundle, bundle.KDF)
+	}
+	aead, err := bundleCipher(passphrase, bundle.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundle.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: bad nonce", ErrInvalidBundle)
+	}
+	plaintext, err := aead.Open(nil, bundle.Nonce, bundle.Ciphertext, bundleAAD(&bundle))
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong passphrase or corrupted bundle", ErrInvalidBundle)
+	}
+	var payload bundlePayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if len(payload.Credentials) != bundle.Count {
+		return nil, fmt.Errorf("%w: count mismatch", ErrInvalidBundle)
+	}
+	return &payload, nil
+}
+
+// bundleCipher derives the AES-256-GCM key for a bundle from passphrase.
+func bundleCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, bundleKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// bundleAAD authenticates the unencrypted bundle header.
+func bundleAAD(bundle *models.Bundle) []byte {
+	return []byte(fmt.Sprintf("dcreds-bundle/v%d/%s/%d/%s",
+		bundle.Version, bundle.KDF, bundle.Count, bundle.CreatedAt.UTC().Format(time.RFC3339Nano)))
+}
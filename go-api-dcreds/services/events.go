@@ -0,0 +1,211 @@
+// services/events.go
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"test-go/models"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Credential lifecycle event types.
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventRotated = "rotated"
+	EventExpired = "expired"
+	EventDeleted = "deleted"
+)
+
+// EventTypes lists every event type, in lifecycle order.
+var EventTypes = []string{EventCreated, EventUpdated, EventRotated, EventExpired, EventDeleted}
+
+const (
+	// eventBacklog is how many recent events are kept for subscribers
+	// resuming after a disconnect.
+	eventBacklog = 1000
+	// subscriberBuffer is how many events a subscriber may fall behind
+	// before it is dropped.
+	subscriberBuffer = 64
+)
+
+// ErrInvalidEventFilter is returned for event filters naming unknown types.
+var ErrInvalidEventFilter = errors.New("invalid event filter")
+
+var (
+	eventsMu     sync.Mutex
+	lastEventID  uint64
+	recentEvents []models.CredentialEvent
+	subscribers  = make(map[*subscription]struct{})
+	eventsClosed bool
+
+	// announcedExpiry records, per credential ID, the expiry last
+	// announced with an expired event. It is guarded by storeMu.
+	announcedExpiry = make(map[string]time.Time)
+
+	eventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dcreds_events_published_total",
+		Help: "Credential lifecycle events published, by type.",
+	}, []string{"type"})
+	eventSubscribers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dcreds_event_subscribers",
+		Help: "Clients currently streaming credential lifecycle events.",
+	})
+)
+
+// EventFilter selects the events a subscriber receives. Zero fields match
+// everything.
+type EventFilter struct {
+	Types        []string
+	CredentialID string
+	Team         string
+	Selector     Selector
+}
+
+// ParseEventTypes parses a comma-separated list of event types.
+func ParseEventTypes(s string) ([]string, error) {
+	var types []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !slices.Contains(EventTypes, t) {
+			return nil, fmt.Errorf("%w: unknown event type %q (want one of %s)", ErrInvalidEventFilter, t, strings.Join(EventTypes, ", "))
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// Matches reports whether the filter selects e.
+func (f EventFilter) Matches(e models.CredentialEvent) bool {
+	return (len(f.Types) == 0 || slices.Contains(f.Types, e.Type)) &&
+		(f.CredentialID == "" || f.CredentialID == e.Dyncred.ID) &&
+		(f.Team == "" || f.Team == e.Dyncred.Team) &&
+		f.Selector.Matches(e.Dyncred.Tags)
+}
+
+type subscription struct {
+	filter EventFilter
+	ch     chan models.CredentialEvent
+}
+
+// publishEvent announces a lifecycle step of cred to every subscriber.
+// It never blocks, so it may be called with storeMu held; subscribers too
+// far behind are dropped and resume from the backlog when they return.
+func publishEvent(eventType, reason string, cred *models.DynamicCredential) {
+	e := models.CredentialEvent{
+		Type:       eventType,
+		Reason:     reason,
+		OccurredAt: time.Now().UTC(),
+		Dyncred:    *cred,
+	}
+	e.Dyncred.Secret = nil
+	e.Dyncred.Tags = cloneMap(cred.Tags)
+	e.Dyncred.ProviderConfig = cloneMap(cred.ProviderConfig)
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	lastEventID++
+	e.ID = lastEventID
+	recentEvents = append(recentEvents, e)
+	if len(recentEvents) > eventBacklog {
+		recentEvents = append(recentEvents[:0:0], recentEvents[len(recentEvents)-eventBacklog:]...)
+	}
+	eventsPublished.WithLabelValues(eventType).Inc()
+	for sub := range subscribers {
+		if !sub.filter.Matches(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			dropSubscriberLocked(sub)
+		}
+	}
+}
+
+func cloneMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]string, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+// SubscribeEvents streams the events matching filter, starting with those
+// still in the backlog whose ID is above after, if after is not zero. The
+// channel is closed when the subscriber falls too far behind or the server
+// shuts down; call cancel once done with it.
+func SubscribeEvents(after uint64, filter EventFilter) (events <-chan models.CredentialEvent, cancel func()) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	var replay []models.CredentialEvent
+	if after > 0 {
+		for _, e := range recentEvents {
+			if e.ID > after && filter.Matches(e) {
+				replay = append(replay, e)
+			}
+		}
+	}
+	sub := &subscription{filter: filter, ch: make(chan models.CredentialEvent, subscriberBuffer+len(replay))}
+	for _, e := range replay {
+		sub.ch <- e
+	}
+	if eventsClosed {
+		close(sub.ch)
+		return sub.ch, func() {}
+	}
+	subscribers[sub] = struct{}{}
+	eventSubscribers.Inc()
+	return sub.ch, func() {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		dropSubscriberLocked(sub)
+	}
+}
+
+// dropSubscriberLocked closes the channel of sub unless it is already
+// gone. Callers must hold eventsMu.
+func dropSubscriberLocked(sub *subscription) {
+	if _, ok := subscribers[sub]; !ok {
+		return
+	}
+	delete(subscribers, sub)
+	close(sub.ch)
+	eventSubscribers.Dec()
+}
+
+// CloseEventStreams ends every event subscription, and refuses new ones,
+// so streaming requests finish when the server shuts down.
+func CloseEventStreams() {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	eventsClosed = true
+	for sub := range subscribers {
+		dropSubscriberLocked(sub)
+	}
+}
+
+// announceExpiredLocked publishes an expired event for every credential
+// whose current generation expired by now, once per expiry. Callers must
+// hold storeMu.
+func announceExpiredLocked(now time.Time) {
+	for id, cred := range dynCredsStore {
+		if now.Before(cred.ExpiresAt) || announcedExpiry[id].Equal(cred.ExpiresAt) {
+			continue
+		}
+		announcedExpiry[id] = cred.ExpiresAt
+		publishEvent(EventExpired, "", cred)
+	}
+}
@@ -0,0 +1,81 @@
+// services/forecast.go
+package services
+
+import (
+	"errors"
+	"sort"
+	"test-go/models"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrInvalidWindow is returned when an expiry forecast window is not positive.
+var ErrInvalidWindow = errors.New("forecast window must be positive")
+
+// ForecastBuckets are the windows reported by the
+// dcreds_credentials_expiring gauge, labelled by their within value.
+var ForecastBuckets = []struct {
+	Label  string
+	Window time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"72h", 72 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+}
+
+func init() {
+	for _, b := range ForecastBuckets {
+		window := b.Window
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "dcreds_credentials_expiring",
+			Help:        "Dynamic credentials whose current generation expires within the window.",
+			ConstLabels: prometheus.Labels{"within": b.Label},
+		}, func() float64 {
+			return float64(countExpiring(time.Now().UTC(), window))
+		})
+	}
+}
+
+// ListExpiringCredentials returns the credentials matching the selector
+// whose current generation expires after now and no later than now+within,
+// soonest first. Credentials that already expired are left out.
+func ListExpiringCredentials(now time.Time, within time.Duration, selector Selector) ([]*models.DynamicCredential, error) {
+	if within <= 0 {
+		return nil, ErrInvalidWindow
+	}
+	deadline := now.Add(within)
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	var creds []*models.DynamicCredential
+	for _, cred := range dynCredsStore {
+		if expiresWithin(cred, now, deadline) && selector.Matches(cred.Tags) {
+			creds = append(creds, credentialView(cred))
+		}
+	}
+	sort.Slice(creds, func(i, j int) bool {
+		if !creds[i].ExpiresAt.Equal(creds[j].ExpiresAt) {
+			return creds[i].ExpiresAt.Before(creds[j].ExpiresAt)
+		}
+		return creds[i].ID < creds[j].ID
+	})
+	return creds, nil
+}
+
+func countExpiring(now time.Time, within time.Duration) int {
+	deadline := now.Add(within)
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	n := 0
+	for _, cred := range dynCredsStore {
+		if expiresWithin(cred, now, deadline) {
+			n++
+		}
+	}
+	return n
+}
+
+func expiresWithin(cred *models.DynamicCredential, now, deadline time.Time) bool {
+	return cred.ExpiresAt.After(now) && !cred.ExpiresAt.After(deadline)
+}
@@ -0,0 +1,40 @@
+// services/health.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CheckDependencies verifies that the credential store and the Terraform
+// API used for TTL propagation are reachable, so the service can refuse to
+// start instead of failing its first requests.
+func CheckDependencies(ctx context.Context) error {
+	var errs []error
+	if err := checkStore(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("credential store unavailable: %w", err))
+	}
+	if _, err := getWorkspaceClient().ListWorkspaces(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("terraform API unreachable: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// checkStore makes sure the store can be locked in time. The in-memory
+// store has nothing else to check; a persistent store pings its database
+// here.
+func checkStore(ctx context.Context) error {
+	locked := make(chan struct{})
+	go func() {
+		storeMu.RLock()
+		storeMu.RUnlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
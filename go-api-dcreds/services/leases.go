@@ -0,0 +1,260 @@
+// services/leases.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"test-go/models"
+	"test-go/providers"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Lease states, derived from the lease's times when it is read.
+const (
+	LeaseActive  = "active"
+	LeaseExpired = "expired"
+	LeaseRevoked = "revoked"
+)
+
+// leaseRetention is how long expired and revoked leases stay listed
+// before the expiry engine forgets them.
+const leaseRetention = time.Hour
+
+var (
+	// ErrLeaseNotFound is returned when a lease does not exist for the credential.
+	ErrLeaseNotFound = errors.New("lease not found")
+	// ErrLeaseInactive is returned when renewing an expired or revoked lease,
+	// or one issued for an earlier generation of the credential.
+	ErrLeaseInactive = errors.New("lease is not active")
+
+	// leases is keyed by credential ID, then lease ID, and guarded by storeMu.
+	leases = make(map[string]map[string]*models.Lease)
+)
+
+// leaseState returns the state of lease at now.
+func leaseState(lease *models.Lease, now time.Time) string {
+	switch {
+	case lease.RevokedAt != nil:
+		return LeaseRevoked
+	case !now.Before(lease.ExpiresAt):
+		return LeaseExpired
+	default:
+		return LeaseActive
+	}
+}
+
+// leaseView returns a copy of lease with its state set at now.
+func leaseView(lease *models.Lease, now time.Time) *models.Lease {
+	view := *lease
+	view.State = leaseState(lease, now)
+	return &view
+}
+
+// leaseExpiry caps a lease of ttl seconds from now by the credential's
+// TTL and by the expiry of its current generation, so no lease outlives
+// the credential it was issued for.
+func leaseExpiry(cred *models.DynamicCredential, ttl int, now time.Time) time.Time {
+	if ttl <= 0 || ttl > cred.TTL {
+		ttl = cred.TTL
+	}
+	expiresAt := now.Add(time.Duration(ttl) * time.Second)
+	if expiresAt.After(cred.ExpiresAt) {
+		expiresAt = cred.ExpiresAt
+	}
+	return expiresAt
+}
+
+// CreateLease issues a lease on the credential's current generation for
+// ttl seconds, or the credential's TTL when ttl is zero, with a secret from
+// the credential's provider, and counts it as a use of the credential. The
+// returned lease is the only copy carrying the secret.
+func CreateLease(ctx context.Context, credID string, ttl int) (*models.Lease, error) {
+	storeMu.RLock()
+	cred, exists := dynCredsStore[credID]
+	if !exists {
+		storeMu.RUnlock()
+		return nil, ErrNotFound
+	}
+	snapshot := *cred
+	storeMu.RUnlock()
+
+	now := time.Now().UTC()
+	if !now.Before(snapshot.ExpiresAt) {
+		return nil, fmt.Errorf("%w: credential generation %d expired at %s",
+			ErrLeaseInactive, snapshot.Generation, snapshot.ExpiresAt.Format(time.RFC3339))
+	}
+	provider, err := providers.Get(snapshot.Provider)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := leaseExpiry(&snapshot, ttl, now)
+	issued, err := issueSecret(ctx, provider, &snapshot, expiresAt.Sub(now))
+	if err != nil {
+		return nil, err
+	}
+
+	storeMu.Lock()
+	cred, exists = dynCredsStore[credID]
+	if !exists || cred.Generation != snapshot.Generation {
+		storeMu.Unlock()
+		// The credential was deleted or rotated while the secret was issued.
+		revokeAll(ctx, []revocation{{snapshot.Provider, snapshot.ProviderConfig, issued.KeyID}})
+		if !exists {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("%w: credential was rotated during issuance", ErrLeaseInactive)
+	}
+	defer storeMu.Unlock()
+	lease := &models.Lease{
+		ID:              uuid.New().String(),
+		CredentialID:    credID,
+		Generation:      cred.Generation,
+		IssuedAt:        now,
+		ExpiresAt:       capExpiry(expiresAt, secretExpiry(issued)),
+		ProviderKeyID:   issued.KeyID,
+		SecretExpiresAt: secretExpiry(issued),
+	}
+	if leases[credID] == nil {
+		leases[credID] = make(map[string]*models.Lease)
+	}
+	leases[credID][lease.ID] = lease
+	recordUseLocked(cred, now)
+
+	view := leaseView(lease, now)
+	view.Secret = issued.Secret
+	return view, nil
+}
+
+// ListLeases returns the credential's leases, newest first.
+func ListLeases(credID string) ([]*models.Lease, error) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if _, exists := dynCredsStore[credID]; !exists {
+		return nil, ErrNotFound
+	}
+	now := time.Now().UTC()
+	list := make([]*models.Lease, 0, len(leases[credID]))
+	for _, lease := range leases[credID] {
+		list = append(list, leaseView(lease, now))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].IssuedAt.Equal(list[j].IssuedAt) {
+			return list[i].IssuedAt.After(list[j].IssuedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+// GetLease returns a single lease of the credential, counting it as a use
+// of the credential.
+func GetLease(credID, leaseID string) (*models.Lease, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	lease, err := findLeaseLocked(credID, leaseID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	recordUseLocked(dynCredsStore[credID], now)
+	return leaseView(lease, now), nil
+}
+
+// RenewLease extends an active lease to increment seconds from now, or the
+// credential's TTL when increment is zero, within the same limits as a new
+// lease, and counts it as a use of the credential. Leases cannot outlive a
+// secret the cloud expires on its own.
+func RenewLease(credID, leaseID string, increment int) (*models.Lease, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	lease, err := findLeaseLocked(credID, leaseID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if state := leaseState(lease, now); state != LeaseActive {
+		return nil, fmt.Errorf("%w: lease is %s", ErrLeaseInactive, state)
+	}
+	cred := dynCredsStore[credID]
+	if lease.Generation != cred.Generation {
+		return nil, fmt.Errorf("%w: credential was rotated to generation %d", ErrLeaseInactive, cred.Generation)
+	}
+	lease.ExpiresAt = capExpiry(leaseExpiry(cred, increment, now), lease.SecretExpiresAt)
+	lease.Renewals++
+	lease.RenewedAt = &now
+	recordUseLocked(cred, now)
+	return leaseView(lease, now), nil
+}
+
+// RevokeLease ends a lease immediately and revokes its secret. Revoking a
+// revoked or expired lease is a no-op.
+func RevokeLease(ctx context.Context, credID, leaseID string) (*models.Lease, error) {
+	storeMu.RLock()
+	lease, err := findLeaseLocked(credID, leaseID)
+	if err != nil {
+		storeMu.RUnlock()
+		return nil, err
+	}
+	cred := dynCredsStore[credID]
+	pending := revocation{cred.Provider, cred.ProviderConfig, lease.ProviderKeyID}
+	revoke := pending.keyID != "" && leaseState(lease, time.Now().UTC()) == LeaseActive
+	storeMu.RUnlock()
+
+	// Expired leases keep their secret until the expiry engine revokes it.
+	if revoke {
+		if err := pending.revoke(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	lease, err = findLeaseLocked(credID, leaseID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if leaseState(lease, now) == LeaseActive {
+		lease.RevokedAt = &now
+	}
+	if revoke && lease.ProviderKeyID == pending.keyID {
+		lease.ProviderKeyID = ""
+	}
+	return leaseView(lease, now), nil
+}
+
+// findLeaseLocked looks up a lease. Callers must hold storeMu.
+func findLeaseLocked(credID, leaseID string) (*models.Lease, error) {
+	if _, exists := dynCredsStore[credID]; !exists {
+		return nil, ErrNotFound
+	}
+	lease, exists := leases[credID][leaseID]
+	if !exists {
+		return nil, ErrLeaseNotFound
+	}
+	return lease, nil
+}
+
+// pruneLeasesLocked forgets leases that ended more than leaseRetention
+// before now. Callers must hold storeMu.
+func pruneLeasesLocked(now time.Time) {
+	cutoff := now.Add(-leaseRetention)
+	for credID, byID := range leases {
+		for id, lease := range byID {
+			ended := lease.ExpiresAt
+			if lease.RevokedAt != nil {
+				ended = *lease.RevokedAt
+			}
+			if ended.Before(cutoff) {
+				delete(byID, id)
+			}
+		}
+		if len(byID) == 0 {
+			delete(leases, credID)
+		}
+	}
+}
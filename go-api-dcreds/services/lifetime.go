@@ -0,0 +1,235 @@
+// services/lifetime.go
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"test-go/models"
+	"test-go/providers"
+	"time"
+)
+
+const (
+	// RotationReasonManual is recorded for operator-requested rotations.
+	RotationReasonManual = "manual"
+	// RotationReasonMaxLifetime is recorded when the max-lifetime policy forces a rotation.
+	RotationReasonMaxLifetime = "max_lifetime"
+)
+
+// OwnerNotifier informs credential owners about upcoming forced rotations.
+type OwnerNotifier interface {
+	NotifyRotationDue(cred models.DynamicCredential, dueAt time.Time) error
+}
+
+// LogNotifier is the default OwnerNotifier and simply logs the notice.
+type LogNotifier struct{}
+
+// NotifyRotationDue logs that a credential will be rotated at dueAt.
+func (LogNotifier) NotifyRotationDue(cred models.DynamicCredential, dueAt time.Time) error {
+	log.Printf("notice to %q: dynamic credential %s (%s) will be force-rotated at %s",
+		cred.Owner, cred.ID, cred.Name, dueAt.Format(time.RFC3339))
+	return nil
+}
+
+var (
+	lifetimeMu    sync.RWMutex
+	maxLifetime   time.Duration
+	noticePeriod                = 24 * time.Hour
+	ownerNotifier OwnerNotifier = LogNotifier{}
+
+	// rotationHistory is keyed by credential ID and guarded by storeMu.
+	rotationHistory = make(map[string][]models.RotationEvent)
+)
+
+// ConfigureLifetime sets the global maximum credential lifetime and how long
+// before a forced rotation owners are notified. A zero maxLife disables the
+// policy. Existing credentials are re-evaluated immediately.
+func ConfigureLifetime(maxLife, notice time.Duration) {
+	lifetimeMu.Lock()
+	maxLifetime = maxLife
+	noticePeriod = notice
+	lifetimeMu.Unlock()
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	for _, cred := range dynCredsStore {
+		applyLifetime(cred)
+	}
+}
+
+// SetOwnerNotifier replaces the notifier used for rotation notices.
+func SetOwnerNotifier(n OwnerNotifier) {
+	lifetimeMu.Lock()
+	defer lifetimeMu.Unlock()
+	ownerNotifier = n
+}
+
+func lifetimeSettings() (time.Duration, time.Duration, OwnerNotifier) {
+	lifetimeMu.RLock()
+	defer lifetimeMu.RUnlock()
+	return maxLifetime, noticePeriod, ownerNotifier
+}
+
+// applyLifetime recomputes expiry for the current generation. When the TTL
+// would outlive the max lifetime the effective expiry is stepped down to the
+// forced rotation time, so TTL patches cannot extend a credential beyond it.
+// Callers must hold storeMu.
+func applyLifetime(cred *models.DynamicCredential) {
+	maxLife, _, _ := lifetimeSettings()
+	expiresAt := cred.IssuedAt.Add(time.Duration(cred.TTL) * time.Second)
+	cred.RotationDueAt = nil
+	if maxLife > 0 {
+		dueAt := cred.IssuedAt.Add(maxLife)
+		cred.RotationDueAt = &dueAt
+		if expiresAt.After(dueAt) {
+			expiresAt = dueAt
+		}
+	}
+	cred.ExpiresAt = expiresAt
+}
+
+// rotateLocked starts a new generation of cred. Callers must hold storeMu.
+func rotateLocked(cred *models.DynamicCredential, reason string, now time.Time) models.RotationEvent {
+	previousTTL := int(cred.ExpiresAt.Sub(cred.IssuedAt) / time.Second)
+	cred.Generation++
+	cred.Version++
+	cred.IssuedAt = now
+	cred.RotationNoticeAt = nil
+	applyLifetime(cred)
+
+	event := models.RotationEvent{
+		CredentialID: cred.ID,
+		Generation:   cred.Generation,
+		Reason:       reason,
+		RotatedAt:    now,
+		PreviousTTL:  previousTTL,
+		EffectiveTTL: int(cred.ExpiresAt.Sub(cred.IssuedAt) / time.Second),
+	}
+	rotationHistory[cred.ID] = append(rotationHistory[cred.ID], event)
+	return event
+}
+
+// RotateDynamicCredential issues a new generation of the credential with a
+// fresh secret from its provider, then revokes the previous secret. The
+// returned credential is the only copy carrying the new secret.
+func RotateDynamicCredential(ctx context.Context, id, reason string) (*models.DynamicCredential, *models.RotationEvent, error) {
+	storeMu.RLock()
+	cred, exists := dynCredsStore[id]
+	if !exists {
+		storeMu.RUnlock()
+		return nil, nil, ErrNotFound
+	}
+	next := *cred
+	storeMu.RUnlock()
+
+	provider, err := providers.Get(next.Provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC()
+	next.IssuedAt = now
+	applyLifetime(&next)
+	issued, err := issueSecret(ctx, provider, &next, next.ExpiresAt.Sub(now))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	storeMu.Lock()
+	cred, exists = dynCredsStore[id]
+	if !exists {
+		storeMu.Unlock()
+		revokeAll(ctx, []revocation{{next.Provider, next.ProviderConfig, issued.KeyID}})
+		return nil, nil, ErrNotFound
+	}
+	previous := revocation{cred.Provider, cred.ProviderConfig, cred.ProviderKeyID}
+	event := rotateLocked(cred, reason, now)
+	cred.ProviderKeyID = issued.KeyID
+	cred.SecretExpiresAt = secretExpiry(issued)
+	publishEvent(EventRotated, reason, cred)
+	view := credentialView(cred)
+	storeMu.Unlock()
+
+	if previous.keyID != "" {
+		revokeAll(ctx, []revocation{previous})
+	}
+	view.Secret = issued.Secret
+	return view, &event, nil
+}
+
+// GetRotationHistory returns the rotation events recorded for a credential.
+func GetRotationHistory(id string) ([]models.RotationEvent, error) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if _, exists := dynCredsStore[id]; !exists {
+		return nil, ErrNotFound
+	}
+	return append([]models.RotationEvent{}, rotationHistory[id]...), nil
+}
+
+// RunExpiryEngine periodically notifies owners of upcoming forced rotations,
+// rotates credentials that reached the max lifetime, revokes the secrets of
+// expired generations and leases and prunes ended leases, until ctx is done.
+func RunExpiryEngine(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runExpiryCycle(ctx, now.UTC())
+		}
+	}
+}
+
+func runExpiryCycle(ctx context.Context, now time.Time) {
+	storeMu.Lock()
+	expired := expiredSecretsLocked(now)
+	announceExpiredLocked(now)
+	pruneLeasesLocked(now)
+	storeMu.Unlock()
+	revokeAll(ctx, expired)
+
+	maxLife, notice, notifier := lifetimeSettings()
+	if maxLife <= 0 {
+		return
+	}
+
+	var notices []models.DynamicCredential
+	var retired []revocation
+	storeMu.Lock()
+	for _, cred := range dynCredsStore {
+		if cred.RotationDueAt == nil {
+			continue
+		}
+		dueAt := *cred.RotationDueAt
+		switch {
+		case !now.Before(dueAt):
+			// Nobody receives a secret for the forced generation; holders
+			// rotate or lease to get a new one.
+			if cred.ProviderKeyID != "" {
+				retired = append(retired, revocation{cred.Provider, cred.ProviderConfig, cred.ProviderKeyID})
+				cred.ProviderKeyID = ""
+				cred.SecretExpiresAt = nil
+			}
+			event := rotateLocked(cred, RotationReasonMaxLifetime, now)
+			publishEvent(EventRotated, RotationReasonMaxLifetime, cred)
+			log.Printf("force-rotated dynamic credential %s to generation %d", cred.ID, event.Generation)
+		case cred.RotationNoticeAt == nil && !now.Before(dueAt.Add(-notice)):
+			sentAt := now
+			cred.RotationNoticeAt = &sentAt
+			cred.Version++
+			publishEvent(EventUpdated, "rotation_notice", cred)
+			notices = append(notices, *cred)
+		}
+	}
+	storeMu.Unlock()
+	revokeAll(ctx, retired)
+
+	for _, cred := range notices {
+		if err := notifier.NotifyRotationDue(cred, *cred.RotationDueAt); err != nil {
+			log.Printf("failed to notify owner of dynamic credential %s: %v", cred.ID, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// services/maintenance.go
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"test-go/models"
+	"time"
+)
+
+// DefaultMaintenanceMessage is reported when maintenance mode is enabled
+// without a message.
+const DefaultMaintenanceMessage = "Changes are frozen for maintenance"
+
+// ErrMaintenance is returned for changes requested in maintenance mode.
+var ErrMaintenance = errors.New("maintenance mode")
+
+var (
+	maintenanceMu sync.RWMutex
+	maintenance   models.Maintenance
+)
+
+// SetMaintenance enables or disables maintenance mode, in which the APIs
+// refuse changes while reads continue. The expiry engine and janitor keep
+// running, so secrets are still revoked on time.
+func SetMaintenance(enabled bool, message string) models.Maintenance {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	if !enabled {
+		maintenance = models.Maintenance{}
+		return maintenance
+	}
+	if message == "" {
+		message = DefaultMaintenanceMessage
+	}
+	if !maintenance.Enabled {
+		now := time.Now().UTC()
+		maintenance.Since = &now
+	}
+	maintenance.Enabled, maintenance.Message = true, message
+	return maintenance
+}
+
+// GetMaintenance returns the maintenance mode in effect.
+func GetMaintenance() models.Maintenance {
+	maintenanceMu.RLock()
+	defer maintenanceMu.RUnlock()
+	return maintenance
+}
+
+// CheckWritable returns ErrMaintenance, with the maintenance message, if
+// changes are frozen.
+func CheckWritable() error {
+	m := GetMaintenance()
+	if m.Enabled {
+		return fmt.Errorf("%w: %s", ErrMaintenance, m.Message)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+// services/mappings.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"test-go/models"
+	"test-go/terraform"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Workspace mapping states.
+const (
+	MappingPending  = "pending"
+	MappingSynced   = "synced"
+	MappingConflict = "conflict"
+	MappingPaused   = "paused"
+	MappingMissing  = "missing"
+	MappingFailed   = "failed"
+)
+
+var (
+	// ErrMappingNotFound is returned when a workspace mapping does not
+	// exist for the credential.
+	ErrMappingNotFound = errors.New("workspace mapping not found")
+	// ErrMappingExists is returned when a credential is already mapped to
+	// the same workspace and variable.
+	ErrMappingExists = errors.New("workspace mapping already exists")
+	// ErrInvalidMapping is returned for mappings naming an unknown
+	// workspace or an invalid variable.
+	ErrInvalidMapping = errors.New("invalid workspace mapping")
+
+	// variableNamePattern matches the variable names Terraform accepts.
+	variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+	// mappings is keyed by credential ID, then mapping ID, and guarded by
+	// storeMu.
+	mappings = make(map[string]map[string]*models.WorkspaceMapping)
+)
+
+// resolveWorkspace finds the workspace with the given ID or name.
+func resolveWorkspace(ctx context.Context, ref string) (terraform.Workspace, error) {
+	workspaces, err := getWorkspaceClient().ListWorkspaces(ctx)
+	if err != nil {
+		return terraform.Workspace{}, fmt.Errorf("list workspaces: %w", err)
+	}
+	for _, ws := range workspaces {
+		if ws.ID == ref || ws.Name == ref {
+			return ws, nil
+		}
+	}
+	return terraform.Workspace{}, fmt.Errorf("%w: workspace %q does not exist", ErrInvalidMapping, ref)
+}
+
+// mappingTarget validates req for the credential named credName and
+// returns the workspace and variable it maps to.
+func mappingTarget(ctx context.Context, credName string, req models.WorkspaceMappingRequest) (terraform.Workspace, string, error) {
+	variable := req.Variable
+	if variable == "" {
+		variable = TTLVariableName(credName)
+	}
+	if !variableNamePattern.MatchString(variable) {
+		return terraform.Workspace{}, "", fmt.Errorf("%w: %q is not a valid Terraform variable name", ErrInvalidMapping, variable)
+	}
+	ws, err := resolveWorkspace(ctx, req.Workspace)
+	if err != nil {
+		return terraform.Workspace{}, "", err
+	}
+	return ws, variable, nil
+}
+
+// checkMappingUniqueLocked rejects a second mapping of credID to the same
+// workspace and variable, ignoring the mapping with ID except. Callers must
+// hold storeMu.
+func checkMappingUniqueLocked(credID, workspaceID, variable, except string) error {
+	for _, m := range mappings[credID] {
+		if m.ID != except && m.WorkspaceID == workspaceID && m.Variable == variable {
+			return fmt.Errorf("%w: %s in workspace %s", ErrMappingExists, variable, m.WorkspaceName)
+		}
+	}
+	return nil
+}
+
+// CreateWorkspaceMapping maps a credential to a workspace and variable.
+// From then on its TTL propagates to its mapped workspaces only.
+func CreateWorkspaceMapping(ctx context.Context, credID string, req models.WorkspaceMappingRequest) (*models.WorkspaceMapping, error) {
+	cred, err := GetDynamicCredential(ctx, credID)
+	if err != nil {
+		return nil, err
+	}
+	ws, variable, err := mappingTarget(ctx, cred.Name, req)
+	if err != nil {
+		return nil, err
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if _, exists := dynCredsStore[credID]; !exists {
+		return nil, ErrNotFound
+	}
+	if err := checkMappingUniqueLocked(credID, ws.ID, variable, ""); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	m := &models.WorkspaceMapping{
+		ID:            uuid.New().String(),
+		CredentialID:  credID,
+		WorkspaceID:   ws.ID,
+		WorkspaceName: ws.Name,
+		Variable:      variable,
+		Status:        MappingPending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if mappings[credID] == nil {
+		mappings[credID] = make(map[string]*models.WorkspaceMapping)
+	}
+	mappings[credID][m.ID] = m
+	copied := *m
+	return &copied, nil
+}
+
+// ListWorkspaceMappings returns the mappings of a credential ordered by
+// workspace name and variable.
+func ListWorkspaceMappings(credID string) ([]models.WorkspaceMapping, error) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if _, exists := dynCredsStore[credID]; !exists {
+		return nil, ErrNotFound
+	}
+	return credentialMappingsLocked(credID), nil
+}
+
+// credentialMappingsLocked returns copies of the mappings of credID in
+// ListWorkspaceMappings order. Callers must hold storeMu.
+func credentialMappingsLocked(credID string) []models.WorkspaceMapping {
+	out := make([]models.WorkspaceMapping, 0, len(mappings[credID]))
+	for _, m := range mappings[credID] {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].WorkspaceName != out[j].WorkspaceName {
+			return out[i].WorkspaceName < out[j].WorkspaceName
+		}
+		return out[i].Variable < out[j].Variable
+	})
+	return out
+}
+
+// GetWorkspaceMapping returns one mapping of a credential.
+func GetWorkspaceMapping(credID, mappingID string) (*models.WorkspaceMapping, error) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	if _, exists := dynCredsStore[credID]; !exists {
+		return nil, ErrNotFound
+	}
+	m, ok := mappings[credID][mappingID]
+	if !ok {
+		return nil, ErrMappingNotFound
+	}
+	copied := *m
+	return &copied, nil
+}
+
+// UpdateWorkspaceMapping points a mapping at another workspace or
+// variable. Its status goes back to pending until the next propagation.
+func UpdateWorkspaceMapping(ctx context.Context, credID, mappingID string, req models.WorkspaceMappingRequest) (*models.WorkspaceMapping, error) {
+	cred, err := GetDynamicCredential(ctx, credID)
+	if err != nil {
+		return nil, err
+	}
+	ws, variable, err := mappingTarget(ctx, cred.Name, req)
+	if err != nil {
+		return nil, err
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	m, ok := mappings[credID][mappingID]
+	if !ok {
+		return nil, ErrMappingNotFound
+	}
+	if err := checkMappingUniqueLocked(credID, ws.ID, variable, mappingID); err != nil {
+		return nil, err
+	}
+	if m.WorkspaceID != ws.ID || m.Variable != variable {
+		m.WorkspaceID, m.WorkspaceName, m.Variable = ws.ID, ws.Name, variable
+		m.Status, m.Error = MappingPending, ""
+	}
+	m.UpdatedAt = time.Now().UTC()
+	copied := *m
+	return &copied, nil
+}
+
+// DeleteWorkspaceMapping removes a mapping. The variable it wrote stays in
+// the workspace. Once a credential's last mapping is deleted, its TTL
+// propagates to every workspace again.
+func DeleteWorkspaceMapping(credID, mappingID string) error {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if _, exists := dynCredsStore[credID]; !exists {
+		return ErrNotFound
+	}
+	if _, ok := mappings[credID][mappingID]; !ok {
+		return ErrMappingNotFound
+	}
+	delete(mappings[credID], mappingID)
+	if len(mappings[credID]) == 0 {
+		delete(mappings, credID)
+	}
+	return nil
+}
+
+// recordMappingStatus records the outcome of propagation job jobID of
+// credential credID through a mapping, unless the mapping was since
+// deleted or retargeted.
+func recordMappingStatus(credID string, change WorkspaceChange, status, errMsg, jobID string, at time.Time) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	m, ok := mappings[credID][change.MappingID]
+	if !ok || m.WorkspaceID != change.WorkspaceID || m.Variable != change.Variable {
+		return
+	}
+	m.Status, m.Error, m.LastJobID = status, errMsg, jobID
+	// Workspaces can be renamed; keep the name current.
+	m.WorkspaceName = change.WorkspaceName
+	m.LastPropagatedAt = &at
+	m.UpdatedAt = at
+}
+
+// resolveMappingStatus sets the status of the mappings that ran into
+// conflict once it is resolved.
+func resolveMappingStatus(conflict *WorkspaceConflict, status string) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	now := time.Now().UTC()
+	for _, m := range mappings[conflict.CredentialID] {
+		if m.WorkspaceID == conflict.WorkspaceID && m.Variable == conflict.Variable {
+			m.Status, m.Error, m.UpdatedAt = status, "", now
+		}
+	}
+}
+
+// mappingStatus returns the mapping status for a propagated change.
+func mappingStatus(action string) string {
+	switch action {
+	case ActionConflict:
+		return MappingConflict
+	case ActionPaused:
+		return MappingPaused
+	case ActionMissing:
+		return MappingMissing
+	}
+	return MappingSynced
+}
@@ -0,0 +1,77 @@
+// services/policy.go
+package services
+
+import (
+	"sync"
+	"test-go/models"
+	"test-go/policy"
+)
+
+var (
+	policyMu      sync.RWMutex
+	currentPolicy = mustCompile(&policy.Policy{})
+)
+
+func mustCompile(p *policy.Policy) *policy.Policy {
+	if err := p.Compile(); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// SetPolicy replaces the policy enforced on creates and updates. Existing
+// credentials are not re-checked.
+func SetPolicy(p *policy.Policy) error {
+	if err := p.Compile(); err != nil {
+		return err
+	}
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	currentPolicy = p
+	return nil
+}
+
+// GetPolicy returns the policy currently enforced.
+func GetPolicy() *policy.Policy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return currentPolicy
+}
+
+// quotaTeam returns the team whose quota a credential counts against: the
+// team it lives in, or else the one named by its tags under p.
+func quotaTeam(p *policy.Policy, team string, tags map[string]string) string {
+	if team != "" {
+		return team
+	}
+	return p.Team(tags)
+}
+
+// teamCountLocked counts the credentials the team owns under p, skipping
+// excludeID. Callers must hold storeMu.
+func teamCountLocked(p *policy.Policy, team, excludeID string) int {
+	count := 0
+	for _, cred := range dynCredsStore {
+		if cred.ID != excludeID && quotaTeam(p, cred.Team, cred.Tags) == team {
+			count++
+		}
+	}
+	return count
+}
+
+// checkPolicyLocked checks a credential named name with ttl and tags,
+// living in team, against the policy. For updates, current is the
+// credential before the change; quotas only apply when it joins a team.
+// Callers must hold storeMu.
+func checkPolicyLocked(p *policy.Policy, current *models.DynamicCredential, team, name string, ttl int, tags map[string]string) error {
+	var quota []policy.Violation
+	team = quotaTeam(p, team, tags)
+	if current == nil || quotaTeam(p, current.Team, current.Tags) != team {
+		excludeID := ""
+		if current != nil {
+			excludeID = current.ID
+		}
+		quota = p.CheckQuota(team, teamCountLocked(p, team, excludeID))
+	}
+	return policy.Err(p.CheckName(name), p.CheckTTL(ttl), quota)
+}
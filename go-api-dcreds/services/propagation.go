@@ -0,0 +1,476 @@
+// services/propagation.go
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"test-go/models"
+	"test-go/policy"
+	"test-go/terraform"
+	"test-go/tracing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Workspace change actions.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	// ActionConflict marks a variable edited outside this service; the
+	// workspace is paused instead of being overwritten.
+	ActionConflict = "conflict"
+	// ActionPaused marks a workspace skipped because of an unresolved conflict.
+	ActionPaused = "paused"
+	// ActionMissing marks a mapped workspace that no longer exists.
+	ActionMissing = "missing"
+)
+
+// Propagation job states.
+const (
+	JobSucceeded = "succeeded"
+	JobPartial   = "partial"
+	JobFailed    = "failed"
+)
+
+// Conflict resolutions.
+const (
+	// ResolveOverwrite writes the service's value over the manual edit.
+	ResolveOverwrite = "overwrite"
+	// ResolveAccept keeps the manual value and takes ownership of it again.
+	ResolveAccept = "accept"
+)
+
+// maxPropagationJobs bounds the in-memory job history.
+const maxPropagationJobs = 100
+
+var (
+	// ErrJobNotFound is returned when a propagation job does not exist.
+	ErrJobNotFound = errors.New("propagation job not found")
+	// ErrConflictNotFound is returned when a workspace has no open conflict.
+	ErrConflictNotFound = errors.New("propagation conflict not found")
+	// ErrInvalidResolution is returned for unknown conflict resolutions.
+	ErrInvalidResolution = errors.New("invalid conflict resolution")
+
+	checksumPattern = regexp.MustCompile(`checksum=([0-9a-f]{16})`)
+)
+
+// WorkspaceChange describes one Terraform variable write needed to propagate
+// a credential's TTL, through the workspace mapping with MappingID if the
+// credential has any.
+type WorkspaceChange struct {
+	WorkspaceID   string             `json:"workspace_id"`
+	WorkspaceName string             `json:"workspace_name"`
+	MappingID     string             `json:"mapping_id,omitempty"`
+	Variable      string             `json:"variable"`
+	Action        string             `json:"action"`
+	OldValue      *string            `json:"old_value,omitempty"`
+	NewValue      string             `json:"new_value"`
+	Conflict      *WorkspaceConflict `json:"conflict,omitempty"`
+
+	variableID string
+}
+
+// WorkspaceConflict records a variable changed outside this service. The
+// workspace receives no further propagation until the conflict is resolved.
+type WorkspaceConflict struct {
+	WorkspaceID   string    `json:"workspace_id"`
+	WorkspaceName string    `json:"workspace_name"`
+	CredentialID  string    `json:"dyncred_id"`
+	Variable      string    `json:"variable"`
+	VariableID    string    `json:"variable_id"`
+	Reason        string    `json:"reason"`
+	CurrentValue  string    `json:"current_value"`
+	DesiredValue  string    `json:"desired_value"`
+	DetectedAt    time.Time `json:"detected_at"`
+}
+
+// PropagationJob records one propagation of a TTL change to all workspaces.
+type PropagationJob struct {
+	ID           string            `json:"id"`
+	CredentialID string            `json:"dyncred_id"`
+	TTL          int               `json:"ttl"`
+	State        string            `json:"state"`
+	Changes      []WorkspaceChange `json:"changes"`
+	Error        string            `json:"error,omitempty"`
+	StartedAt    time.Time         `json:"started_at"`
+	FinishedAt   time.Time         `json:"finished_at"`
+}
+
+var (
+	workspaceMu     sync.RWMutex
+	workspaceClient terraform.Client = terraform.NewMemoryClient()
+
+	// propagationMu guards conflicts and jobs.
+	propagationMu sync.Mutex
+	conflicts     = make(map[string]*WorkspaceConflict) // keyed by workspace ID
+	jobs          []*PropagationJob
+)
+
+// SetWorkspaceClient sets the Terraform API client used for propagation.
+func SetWorkspaceClient(c terraform.Client) {
+	workspaceMu.Lock()
+	defer workspaceMu.Unlock()
+	workspaceClient = c
+}
+
+func getWorkspaceClient() terraform.Client {
+	workspaceMu.RLock()
+	defer workspaceMu.RUnlock()
+	return workspaceClient
+}
+
+// TTLVariableName is the Terraform variable holding a credential's TTL,
+// e.g. "dyncred_ci_deployer_ttl" for a credential named "ci-deployer".
+func TTLVariableName(credName string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '_'
+		}
+	}, credName)
+	return "dyncred_" + name + "_ttl"
+}
+
+// valueChecksum fingerprints a value written by this service. It is stored
+// in the variable description so manual edits can be detected across restarts.
+func valueChecksum(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+func managedDescription(value string) string {
+	return "Managed by dcreds, do not edit manually. checksum=" + valueChecksum(value)
+}
+
+// detectConflict reports why v can no longer be safely overwritten, or ""
+// when it still holds the last value this service wrote.
+func detectConflict(v terraform.Variable) string {
+	m := checksumPattern.FindStringSubmatch(v.Description)
+	switch {
+	case m == nil:
+		return "variable is not managed by dcreds"
+	case v.Sensitive:
+		// Sensitive values cannot be read back; trust the marker.
+		return ""
+	case m[1] != valueChecksum(v.Value):
+		return "value was changed outside dcreds"
+	}
+	return ""
+}
+
+// PlanTTLPropagation computes the variable writes needed to set ttl for
+// credential id, without applying them. Credentials with workspace mappings
+// target their mapped workspaces and variables, the rest every workspace.
+// Workspaces with manual edits or unresolved conflicts are reported but
+// never written. A TTL the policy rejects fails the plan as it would fail
+// the update.
+func PlanTTLPropagation(ctx context.Context, id string, ttl int) ([]WorkspaceChange, error) {
+	plan, err := planTTLPropagation(ctx, id, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return plan.changes, nil
+}
+
+// propagationPlan holds the changes of a propagation, and the mapped
+// variables already holding the TTL, whose mappings are nonetheless synced.
+type propagationPlan struct {
+	changes   []WorkspaceChange
+	unchanged []WorkspaceChange
+}
+
+func planTTLPropagation(ctx context.Context, id string, ttl int) (*propagationPlan, error) {
+	cred, err := GetDynamicCredential(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Err(GetPolicy().CheckTTL(ttl)); err != nil {
+		return nil, err
+	}
+	return planWorkspaceChanges(ctx, cred, ttl)
+}
+
+// planWorkspaceChanges computes the propagation of ttl for cred, whether or
+// not the policy allows it.
+func planWorkspaceChanges(ctx context.Context, cred *models.DynamicCredential, ttl int) (*propagationPlan, error) {
+	id := cred.ID
+	client := getWorkspaceClient()
+	workspaces, err := client.ListWorkspaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list workspaces: %w", err)
+	}
+
+	value := strconv.Itoa(ttl)
+	plan := &propagationPlan{changes: []WorkspaceChange{}}
+	var targets []WorkspaceChange
+	storeMu.RLock()
+	mapped := credentialMappingsLocked(id)
+	storeMu.RUnlock()
+	if len(mapped) == 0 {
+		for _, ws := range workspaces {
+			targets = append(targets, WorkspaceChange{WorkspaceID: ws.ID, WorkspaceName: ws.Name, Variable: TTLVariableName(cred.Name)})
+		}
+	} else {
+		names := make(map[string]string, len(workspaces))
+		for _, ws := range workspaces {
+			names[ws.ID] = ws.Name
+		}
+		for _, m := range mapped {
+			target := WorkspaceChange{WorkspaceID: m.WorkspaceID, WorkspaceName: m.WorkspaceName, MappingID: m.ID, Variable: m.Variable}
+			name, ok := names[m.WorkspaceID]
+			if !ok {
+				target.Action = ActionMissing
+				target.NewValue = value
+				plan.changes = append(plan.changes, target)
+				continue
+			}
+			target.WorkspaceName = name
+			targets = append(targets, target)
+		}
+	}
+
+	for _, change := range targets {
+		change.Action = ActionCreate
+		change.NewValue = value
+		if conflict := workspaceConflict(change.WorkspaceID); conflict != nil {
+			change.Action = ActionPaused
+			change.Conflict = conflict
+			plan.changes = append(plan.changes, change)
+			continue
+		}
+
+		vars, err := client.ListVariables(ctx, change.WorkspaceID)
+		if err != nil {
+			return nil, fmt.Errorf("list variables of workspace %s: %w", change.WorkspaceName, err)
+		}
+		for _, v := range vars {
+			if v.Key != change.Variable {
+				continue
+			}
+			old := v.Value
+			change.OldValue = &old
+			change.Action = ActionUpdate
+			change.variableID = v.ID
+			if reason := detectConflict(v); reason != "" {
+				change.Action = ActionConflict
+				change.Conflict = &WorkspaceConflict{
+					WorkspaceID:   change.WorkspaceID,
+					WorkspaceName: change.WorkspaceName,
+					CredentialID:  cred.ID,
+					Variable:      change.Variable,
+					VariableID:    v.ID,
+					Reason:        reason,
+					CurrentValue:  v.Value,
+					DesiredValue:  value,
+				}
+			}
+			break
+		}
+		if change.Action == ActionUpdate && *change.OldValue == value {
+			plan.unchanged = append(plan.unchanged, change)
+			continue
+		}
+		plan.changes = append(plan.changes, change)
+	}
+	return plan, nil
+}
+
+// UpdateTTLForAllWorkspaces updates the TTL across all Terraform workspaces
+// and records the outcome as a propagation job. Conflicting workspaces are
+// paused and make the job partial rather than failing it.
+func UpdateTTLForAllWorkspaces(ctx context.Context, id string, ttl int) (*PropagationJob, error) {
+	if PropagationMode.Value() == PropagationOff {
+		fmt.Printf("Propagation disabled, skipping workspace update for dynamic credential %s\n", id)
+		return nil, nil
+	}
+
+	job := &PropagationJob{
+		ID:           uuid.New().String(),
+		CredentialID: id,
+		TTL:          ttl,
+		State:        JobSucceeded,
+		StartedAt:    time.Now().UTC(),
+	}
+	ctx, span := tracing.Start(ctx, "propagation.job",
+		attribute.String("dcreds.credential.id", id),
+		attribute.String("dcreds.job.id", job.ID),
+		attribute.Int("dcreds.ttl", ttl))
+	err := applyTTLPropagation(ctx, job)
+	job.FinishedAt = time.Now().UTC()
+	if err != nil {
+		job.State = JobFailed
+		job.Error = err.Error()
+	}
+	span.SetAttributes(attribute.String("dcreds.job.state", job.State))
+	tracing.End(span, err)
+	recordJob(job)
+	return job, err
+}
+
+func applyTTLPropagation(ctx context.Context, job *PropagationJob) error {
+	plan, err := planTTLPropagation(ctx, job.CredentialID, job.TTL)
+	if err != nil {
+		return err
+	}
+	job.Changes = plan.changes
+
+	record := func(change WorkspaceChange, status, errMsg string) {
+		if change.MappingID != "" {
+			recordMappingStatus(job.CredentialID, change, status, errMsg, job.ID, time.Now().UTC())
+		}
+	}
+	for _, change := range plan.unchanged {
+		record(change, MappingSynced, "")
+	}
+	client := getWorkspaceClient()
+	for i := range job.Changes {
+		change := &job.Changes[i]
+		v := terraform.Variable{
+			ID:          change.variableID,
+			Key:         change.Variable,
+			Value:       change.NewValue,
+			Description: managedDescription(change.NewValue),
+		}
+		wsCtx, span := tracing.Start(ctx, "propagation.workspace",
+			attribute.String("terraform.workspace.id", change.WorkspaceID),
+			attribute.String("terraform.workspace.name", change.WorkspaceName),
+			attribute.String("terraform.variable.key", change.Variable),
+			attribute.String("dcreds.propagation.action", change.Action))
+		switch change.Action {
+		case ActionCreate:
+			_, err = client.CreateVariable(wsCtx, change.WorkspaceID, v)
+		case ActionUpdate:
+			_, err = client.UpdateVariable(wsCtx, change.WorkspaceID, v)
+		case ActionConflict:
+			change.Conflict.DetectedAt = time.Now().UTC()
+			pauseWorkspace(change.Conflict)
+			job.State = JobPartial
+		case ActionPaused, ActionMissing:
+			job.State = JobPartial
+		}
+		tracing.End(span, err)
+		if err != nil {
+			record(*change, MappingFailed, err.Error())
+			return fmt.Errorf("%s %s in workspace %s: %w", change.Action, change.Variable, change.WorkspaceName, err)
+		}
+		record(*change, mappingStatus(change.Action), "")
+	}
+	return nil
+}
+
+func workspaceConflict(workspaceID string) *WorkspaceConflict {
+	propagationMu.Lock()
+	defer propagationMu.Unlock()
+	if c, ok := conflicts[workspaceID]; ok {
+		copied := *c
+		return &copied
+	}
+	return nil
+}
+
+func pauseWorkspace(conflict *WorkspaceConflict) {
+	propagationMu.Lock()
+	defer propagationMu.Unlock()
+	copied := *conflict
+	conflicts[conflict.WorkspaceID] = &copied
+}
+
+func recordJob(job *PropagationJob) {
+	propagationMu.Lock()
+	defer propagationMu.Unlock()
+	jobs = append(jobs, job)
+	if len(jobs) > maxPropagationJobs {
+		jobs = jobs[len(jobs)-maxPropagationJobs:]
+	}
+}
+
+// ListPropagationJobs returns recent propagation jobs, newest first.
+func ListPropagationJobs() []PropagationJob {
+	propagationMu.Lock()
+	defer propagationMu.Unlock()
+	out := make([]PropagationJob, 0, len(jobs))
+	for i := len(jobs) - 1; i >= 0; i-- {
+		out = append(out, *jobs[i])
+	}
+	return out
+}
+
+// GetPropagationJob returns a propagation job by ID.
+func GetPropagationJob(id string) (*PropagationJob, error) {
+	propagationMu.Lock()
+	defer propagationMu.Unlock()
+	for _, job := range jobs {
+		if job.ID == id {
+			copied := *job
+			return &copied, nil
+		}
+	}
+	return nil, ErrJobNotFound
+}
+
+// ListConflicts returns the open conflicts, i.e. the paused workspaces.
+func ListConflicts() []WorkspaceConflict {
+	propagationMu.Lock()
+	defer propagationMu.Unlock()
+	out := make([]WorkspaceConflict, 0, len(conflicts))
+	for _, c := range conflicts {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].WorkspaceName < out[j].WorkspaceName })
+	return out
+}
+
+// ResolveConflict resumes propagation to a paused workspace. ResolveOverwrite
+// writes the desired value; ResolveAccept keeps the manual value and marks it
+// as managed again. TTL changes of other credentials skipped while paused
+// reach the workspace with their next propagation.
+func ResolveConflict(ctx context.Context, workspaceID, resolution string) (*WorkspaceConflict, error) {
+	conflict := workspaceConflict(workspaceID)
+	if conflict == nil {
+		return nil, ErrConflictNotFound
+	}
+
+	v := terraform.Variable{ID: conflict.VariableID, Key: conflict.Variable}
+	switch resolution {
+	case ResolveOverwrite:
+		v.Value = conflict.DesiredValue
+		// Prefer the credential's current TTL in case it changed while paused.
+		if cred, err := GetDynamicCredential(ctx, conflict.CredentialID); err == nil {
+			v.Value = strconv.Itoa(cred.TTL)
+		}
+	case ResolveAccept:
+		v.Value = conflict.CurrentValue
+	default:
+		return nil, fmt.Errorf("%w: %q (want %s or %s)", ErrInvalidResolution, resolution, ResolveOverwrite, ResolveAccept)
+	}
+	v.Description = managedDescription(v.Value)
+	if _, err := getWorkspaceClient().UpdateVariable(ctx, workspaceID, v); err != nil {
+		return nil, fmt.Errorf("update %s in workspace %s: %w", conflict.Variable, conflict.WorkspaceName, err)
+	}
+
+	propagationMu.Lock()
+	delete(conflicts, workspaceID)
+	propagationMu.Unlock()
+	status := MappingSynced
+	if resolution == ResolveAccept {
+		// The workspace keeps a value dcreds did not choose until the
+		// credential's next propagation.
+		status = MappingPending
+	}
+	resolveMappingStatus(conflict, status)
+	return conflict, nil
+}
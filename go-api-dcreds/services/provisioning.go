@@ -0,0 +1,112 @@
+// services/provisioning.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"test-go/models"
+	"test-go/providers"
+	"time"
+)
+
+// ErrProvider is returned when a credential provider fails to issue or
+// revoke a secret.
+var ErrProvider = errors.New("credential provider failed")
+
+// providerFor returns the named provider after checking config against it.
+func providerFor(name string, config map[string]string) (providers.CredentialProvider, error) {
+	provider, err := providers.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := provider.ValidateConfig(config); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// issueSecret provisions a secret for cred valid for about ttl.
+func issueSecret(ctx context.Context, provider providers.CredentialProvider, cred *models.DynamicCredential, ttl time.Duration) (*providers.Issued, error) {
+	issued, err := provider.Issue(ctx, providers.IssueRequest{
+		CredentialID: cred.ID,
+		Name:         cred.Name,
+		Config:       cred.ProviderConfig,
+		TTL:          ttl,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProvider, err)
+	}
+	return issued, nil
+}
+
+// secretExpiry returns when the cloud invalidates an issued secret, or nil
+// if it stays valid until revoked.
+func secretExpiry(issued *providers.Issued) *time.Time {
+	if issued.ExpiresAt.IsZero() {
+		return nil
+	}
+	expiresAt := issued.ExpiresAt.UTC()
+	return &expiresAt
+}
+
+// capExpiry returns t, or limit if it is set and earlier.
+func capExpiry(t time.Time, limit *time.Time) time.Time {
+	if limit != nil && limit.Before(t) {
+		return *limit
+	}
+	return t
+}
+
+// revocation is a secret to revoke once storeMu is released, so slow
+// cloud calls never block the store.
+type revocation struct {
+	provider string
+	config   map[string]string
+	keyID    string
+}
+
+func (r revocation) revoke(ctx context.Context) error {
+	provider, err := providers.Get(r.provider)
+	if err != nil {
+		return err
+	}
+	if err := provider.Revoke(ctx, r.config, r.keyID); err != nil {
+		return fmt.Errorf("%w: revoke %s secret %s: %w", ErrProvider, r.provider, r.keyID, err)
+	}
+	return nil
+}
+
+// revokeAll revokes secrets in the background paths where no caller can
+// retry, logging failures.
+func revokeAll(ctx context.Context, pending []revocation) {
+	for _, r := range pending {
+		if err := r.revoke(ctx); err != nil {
+			log.Printf("failed to revoke secret: %v", err)
+		}
+	}
+}
+
+// expiredSecretsLocked detaches the secrets of credential generations and
+// leases that expired by now, for revoking with revokeAll. Providers whose
+// secrets expire on their own treat the revocation as a no-op. Callers
+// must hold storeMu.
+func expiredSecretsLocked(now time.Time) []revocation {
+	var pending []revocation
+	for _, cred := range dynCredsStore {
+		if cred.ProviderKeyID != "" && !now.Before(cred.ExpiresAt) {
+			pending = append(pending, revocation{cred.Provider, cred.ProviderConfig, cred.ProviderKeyID})
+			cred.ProviderKeyID = ""
+			cred.SecretExpiresAt = nil
+			cred.Version++
+		}
+		for _, lease := range leases[cred.ID] {
+			if lease.ProviderKeyID != "" && leaseState(lease, now) != LeaseActive {
+				pending = append(pending, revocation{cred.Provider, cred.ProviderConfig, lease.ProviderKeyID})
+				lease.ProviderKeyID = ""
+			}
+		}
+	}
+	return pending
+}
@@ -0,0 +1,132 @@
+// services/retention.go
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"test-go/archive"
+	"test-go/models"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	retentionMu sync.RWMutex
+	// retention is how long expired credentials are kept; zero keeps
+	// them forever.
+	retention time.Duration
+	archiver  archive.Archiver
+
+	purgedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dcreds_credentials_purged_total",
+		Help: "Expired dynamic credentials archived and deleted by the janitor.",
+	})
+	purgeFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dcreds_purge_failures_total",
+		Help: "Janitor runs that failed to archive or delete expired credentials.",
+	})
+	lastPurge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dcreds_purge_last_success_timestamp_seconds",
+		Help: "When the janitor last finished a run without errors.",
+	})
+)
+
+// ConfigureRetention sets how long credentials are kept after they
+// expire before the janitor purges them, and where they are archived
+// first. A zero keep disables purging; a nil a purges without archiving.
+func ConfigureRetention(keep time.Duration, a archive.Archiver) {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+	retention = keep
+	archiver = a
+}
+
+func retentionSettings() (time.Duration, archive.Archiver) {
+	retentionMu.RLock()
+	defer retentionMu.RUnlock()
+	return retention, archiver
+}
+
+// RunJanitor periodically purges credentials that expired more than the
+// retention period ago, until ctx is done.
+func RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := PurgeExpired(ctx, now.UTC())
+			if err != nil {
+				log.Printf("janitor: %v", err)
+			}
+			if n > 0 {
+				log.Printf("janitor purged %d expired dynamic credentials", n)
+			}
+		}
+	}
+}
+
+// PurgeExpired archives, then deletes, the credentials whose current
+// generation expired more than the retention period before now, revoking
+// any secrets they still hold. Nothing is deleted when archiving fails.
+// Credentials renewed or rotated in the meantime are kept. It returns how
+// many credentials were purged.
+func PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	keep, a := retentionSettings()
+	if keep <= 0 {
+		return 0, nil
+	}
+	cutoff := now.Add(-keep)
+
+	storeMu.RLock()
+	var records []archive.Record
+	for _, cred := range dynCredsStore {
+		if cred.ExpiresAt.Before(cutoff) {
+			records = append(records, archive.Record{
+				Credential: *cred,
+				History:    append([]models.RotationEvent(nil), rotationHistory[cred.ID]...),
+			})
+		}
+	}
+	storeMu.RUnlock()
+	if len(records) == 0 {
+		lastPurge.SetToCurrentTime()
+		return 0, nil
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Credential.ID < records[j].Credential.ID })
+
+	if a != nil {
+		if err := a.Store(ctx, archive.Archive{PurgedAt: now, Records: records}); err != nil {
+			purgeFailures.Inc()
+			return 0, err
+		}
+	}
+
+	purged := 0
+	var errs []error
+	for _, r := range records {
+		err := deleteCredential(ctx, r.Credential.ID, r.Credential.Version, "purged")
+		switch {
+		case err == nil:
+			purged++
+		case errors.Is(err, ErrNotFound), errors.Is(err, ErrVersionMismatch):
+			// Deleted by hand or brought back to life since it was archived.
+		default:
+			errs = append(errs, err)
+		}
+	}
+	purgedTotal.Add(float64(purged))
+	if err := errors.Join(errs...); err != nil {
+		purgeFailures.Inc()
+		return purged, err
+	}
+	lastPurge.SetToCurrentTime()
+	return purged, nil
+}
@@ -2,66 +2,291 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"test-go/models"
+	"test-go/policy"
+	"test-go/tracing"
+	"time"
 
+	"github.com/gnsalok/go-projects-root/pkg/featureflags"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// PropagationSync pushes TTL changes to Terraform workspaces inline.
+	PropagationSync = "sync"
+	// PropagationOff records TTL changes without touching any workspace.
+	PropagationOff = "off"
 )
 
 var (
+	// ErrNotFound is returned when a dynamic credential does not exist.
+	ErrNotFound = errors.New("dynamic credential not found")
+	// ErrVersionMismatch is returned when an update expects a version other
+	// than the credential's current one.
+	ErrVersionMismatch = errors.New("dynamic credential version mismatch")
+
 	// In-memory data store. Replace with persistent DB in production.
 	dynCredsStore = make(map[string]*models.DynamicCredential)
+	storeMu       sync.RWMutex
+
+	// PropagationMode selects how TTL changes reach Terraform workspaces.
+	PropagationMode = featureflags.Default.String("dcreds.propagation.mode", PropagationSync,
+		"How TTL changes are propagated to Terraform workspaces (sync|off)", PropagationSync, PropagationOff)
 )
 
-// CreateDynamicCredential creates a new dynamic credential.
-func CreateDynamicCredential(req models.CreateDynamicCredentialRequest) (*models.DynamicCredential, error) {
+// storeSpan starts a span for a store operation on the credential id, or
+// on the whole store when id is empty.
+func storeSpan(ctx context.Context, op, id string) (context.Context, trace.Span) {
+	if id == "" {
+		return tracing.Start(ctx, "store."+op)
+	}
+	return tracing.Start(ctx, "store."+op, attribute.String("dcreds.credential.id", id))
+}
+
+// CreateDynamicCredential creates a new dynamic credential allowed by the
+// policy and issues its first secret through the selected provider. The
+// returned credential is the only copy carrying the secret.
+func CreateDynamicCredential(ctx context.Context, req models.CreateDynamicCredentialRequest) (_ *models.DynamicCredential, err error) {
+	ctx, span := storeSpan(ctx, "create", "")
+	defer func() { tracing.End(span, err) }()
+	if err := ValidateTags(req.Tags); err != nil {
+		return nil, err
+	}
+	p := GetPolicy()
+	storeMu.RLock()
+	err = checkTeamLocked(req.Team)
+	if err == nil {
+		err = checkPolicyLocked(p, nil, req.Team, req.Name, req.TTL, req.Tags)
+	}
+	storeMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	provider, err := providerFor(req.Provider, req.ProviderConfig)
+	if err != nil {
+		return nil, err
+	}
 	id := uuid.New().String()
+	span.SetAttributes(attribute.String("dcreds.credential.id", id))
+	now := time.Now().UTC()
 	cred := &models.DynamicCredential{
-		ID:   id,
-		Name: req.Name,
-		TTL:  req.TTL,
+		ID:             id,
+		Name:           req.Name,
+		TTL:            req.TTL,
+		Tags:           req.Tags,
+		Owner:          req.Owner,
+		Team:           req.Team,
+		Generation:     1,
+		Version:        1,
+		CreatedAt:      now,
+		IssuedAt:       now,
+		Provider:       provider.Name(),
+		ProviderConfig: req.ProviderConfig,
+	}
+	applyLifetime(cred)
+	issued, err := issueSecret(ctx, provider, cred, cred.ExpiresAt.Sub(now))
+	if err != nil {
+		return nil, err
+	}
+	cred.ProviderKeyID = issued.KeyID
+	cred.SecretExpiresAt = secretExpiry(issued)
+	storeMu.Lock()
+	// Another create may have used up the team's quota, or the team may
+	// have been deleted, while issuing.
+	err = checkTeamLocked(cred.Team)
+	if err == nil {
+		err = checkPolicyLocked(p, nil, cred.Team, cred.Name, cred.TTL, cred.Tags)
+	}
+	if err != nil {
+		storeMu.Unlock()
+		revokeAll(ctx, []revocation{{cred.Provider, cred.ProviderConfig, issued.KeyID}})
+		return nil, err
 	}
 	dynCredsStore[id] = cred
-	return cred, nil
+	publishEvent(EventCreated, "", cred)
+	storeMu.Unlock()
+
+	view := credentialView(cred)
+	view.Secret = issued.Secret
+	return view, nil
 }
 
-// GetDynamicCredential retrieves a dynamic credential by ID.
-func GetDynamicCredential(id string) (*models.DynamicCredential, error) {
+// GetDynamicCredential retrieves a dynamic credential by ID. The returned
+// copy is safe to read after later writes.
+func GetDynamicCredential(ctx context.Context, id string) (_ *models.DynamicCredential, err error) {
+	_, span := storeSpan(ctx, "get", id)
+	defer func() { tracing.End(span, err) }()
+	storeMu.RLock()
+	defer storeMu.RUnlock()
 	cred, exists := dynCredsStore[id]
 	if !exists {
-		return nil, errors.New("dynamic credential not found")
+		return nil, ErrNotFound
 	}
-	return cred, nil
+	return credentialView(cred), nil
+}
+
+// credentialView copies a stored credential, maps included, so callers
+// can read it after storeMu is released while writers keep updating the
+// original.
+func credentialView(cred *models.DynamicCredential) *models.DynamicCredential {
+	view := *cred
+	view.Tags = cloneMap(cred.Tags)
+	view.ProviderConfig = cloneMap(cred.ProviderConfig)
+	return &view
 }
 
-// UpdateDynamicCredential updates an existing dynamic credential.
-func UpdateDynamicCredential(id string, req models.UpdateDynamicCredentialRequest) (*models.DynamicCredential, error) {
+// ListDynamicCredentials returns all credentials matching the selector,
+// ordered by name, as copies. A nil selector matches everything.
+func ListDynamicCredentials(ctx context.Context, selector Selector) []*models.DynamicCredential {
+	_, span := storeSpan(ctx, "list", "")
+	defer span.End()
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	creds := make([]*models.DynamicCredential, 0, len(dynCredsStore))
+	for _, cred := range dynCredsStore {
+		if selector.Matches(cred.Tags) {
+			creds = append(creds, credentialView(cred))
+		}
+	}
+	sort.Slice(creds, func(i, j int) bool {
+		if creds[i].Name != creds[j].Name {
+			return creds[i].Name < creds[j].Name
+		}
+		return creds[i].ID < creds[j].ID
+	})
+	span.SetAttributes(attribute.Int("dcreds.credential.count", len(creds)))
+	return creds
+}
+
+// UpdateDynamicCredential updates an existing dynamic credential if it is
+// still at version and the result is allowed by the policy.
+func UpdateDynamicCredential(ctx context.Context, id string, version int, req models.UpdateDynamicCredentialRequest) (_ *models.DynamicCredential, err error) {
+	_, span := storeSpan(ctx, "update", id)
+	defer func() { tracing.End(span, err) }()
+	if err := ValidateTags(req.Tags); err != nil {
+		return nil, err
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
 	cred, exists := dynCredsStore[id]
 	if !exists {
-		return nil, errors.New("dynamic credential not found")
+		return nil, ErrNotFound
+	}
+	if err := checkVersionLocked(cred, version); err != nil {
+		return nil, err
+	}
+	if err := checkPolicyLocked(GetPolicy(), cred, cred.Team, req.Name, req.TTL, req.Tags); err != nil {
+		return nil, err
 	}
 	cred.Name = req.Name
 	cred.TTL = req.TTL
+	cred.Tags = cloneMap(req.Tags)
+	cred.Version++
+	applyLifetime(cred)
 	// Update other fields as necessary
-	return cred, nil
+	publishEvent(EventUpdated, "", cred)
+	return credentialView(cred), nil
+}
+
+// DeleteDynamicCredential revokes the secrets of a dynamic credential and
+// its leases, then deletes it. Nothing is deleted if a revocation fails, so
+// the call can be retried without leaking cloud secrets.
+func DeleteDynamicCredential(ctx context.Context, id string) error {
+	return deleteCredential(ctx, id, 0, "")
 }
 
-// DeleteDynamicCredential deletes a dynamic credential by ID.
-func DeleteDynamicCredential(id string) error {
-	_, exists := dynCredsStore[id]
+// deleteCredential is DeleteDynamicCredential, only deleting the
+// credential while it is still at version unless version is zero. The
+// deleted event carries reason.
+func deleteCredential(ctx context.Context, id string, version int, reason string) (err error) {
+	ctx, span := storeSpan(ctx, "delete", id)
+	defer func() { tracing.End(span, err) }()
+	storeMu.RLock()
+	cred, exists := dynCredsStore[id]
 	if !exists {
-		return errors.New("dynamic credential not found")
+		storeMu.RUnlock()
+		return ErrNotFound
+	}
+	if version != 0 {
+		if err := checkVersionLocked(cred, version); err != nil {
+			storeMu.RUnlock()
+			return err
+		}
+	}
+	var pending []revocation
+	if cred.ProviderKeyID != "" {
+		pending = append(pending, revocation{cred.Provider, cred.ProviderConfig, cred.ProviderKeyID})
 	}
+	for _, lease := range leases[id] {
+		if lease.ProviderKeyID != "" {
+			pending = append(pending, revocation{cred.Provider, cred.ProviderConfig, lease.ProviderKeyID})
+		}
+	}
+	storeMu.RUnlock()
+
+	for _, r := range pending {
+		if err := r.revoke(ctx); err != nil {
+			return err
+		}
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	cred, exists = dynCredsStore[id]
+	if !exists {
+		return ErrNotFound
+	}
+	if version != 0 {
+		if err := checkVersionLocked(cred, version); err != nil {
+			return err
+		}
+	}
+	publishEvent(EventDeleted, reason, cred)
 	delete(dynCredsStore, id)
+	delete(rotationHistory, id)
+	delete(leases, id)
+	delete(mappings, id)
+	delete(announcedExpiry, id)
 	return nil
 }
 
-// UpdateTTLForAllWorkspaces updates the TTL across all Terraform workspaces.
-func UpdateTTLForAllWorkspaces(id string, ttl int) error {
-	// Implement actual Terraform workspace update logic here
-	// For demonstration, we'll simulate with a print statement
-	fmt.Printf("Updating TTL to %d for dynamic credential %s in all Terraform workspaces\n", ttl, id)
-	// Return error if Terraform update fails
+// UpdateDynamicCredentialTTL updates only the TTL of an existing dynamic
+// credential if it is still at version and the TTL is allowed by the policy.
+func UpdateDynamicCredentialTTL(ctx context.Context, id string, version, ttl int) (_ *models.DynamicCredential, err error) {
+	_, span := storeSpan(ctx, "update_ttl", id)
+	defer func() { tracing.End(span, err) }()
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	cred, exists := dynCredsStore[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if err := checkVersionLocked(cred, version); err != nil {
+		return nil, err
+	}
+	if err := policy.Err(GetPolicy().CheckTTL(ttl)); err != nil {
+		return nil, err
+	}
+	cred.TTL = ttl
+	cred.Version++
+	applyLifetime(cred)
+	publishEvent(EventUpdated, "ttl", cred)
+	return credentialView(cred), nil
+}
+
+// checkVersionLocked rejects writes based on a stale read of cred, so
+// concurrent operators cannot silently overwrite each other. Callers must
+// hold storeMu.
+func checkVersionLocked(cred *models.DynamicCredential, version int) error {
+	if cred.Version != version {
+		return fmt.Errorf("%w: expected version %d, current version is %d", ErrVersionMismatch, version, cred.Version)
+	}
 	return nil
 }
@@ -0,0 +1,163 @@
+// services/simulation.go
+package services
+
+import (
+	"context"
+	"sort"
+	"test-go/models"
+	"test-go/policy"
+	"time"
+)
+
+// Effects of a TTL change on an active lease.
+const (
+	// LeaseRenewalsShortened means renewals can no longer reach as far.
+	LeaseRenewalsShortened = "renewals_shortened"
+	// LeaseRenewalsExtended means renewals can reach further.
+	LeaseRenewalsExtended = "renewals_extended"
+	// LeaseRenewalsEnded means the credential generation would have
+	// expired, so the lease can no longer be renewed.
+	LeaseRenewalsEnded = "renewals_ended"
+)
+
+// TTLSimulation reports what setting a credential's TTL would do. Nothing
+// is changed to compute it.
+type TTLSimulation struct {
+	CredentialID string    `json:"dyncred_id"`
+	Version      int       `json:"version"`
+	SimulatedAt  time.Time `json:"simulated_at"`
+	CurrentTTL   int       `json:"current_ttl"`
+	ProposedTTL  int       `json:"proposed_ttl"`
+	// Allowed is false when the policy would reject the TTL, for the
+	// reasons in Violations.
+	Allowed    bool               `json:"allowed"`
+	Violations []policy.Violation `json:"violations"`
+	Expiry     ExpiryImpact       `json:"expiry"`
+	// Leases lists the active leases whose renewals the TTL would change;
+	// ActiveLeases counts all of them.
+	Leases       []LeaseImpact `json:"leases"`
+	ActiveLeases int           `json:"active_leases"`
+	// Workspaces lists the variable writes propagating the TTL would make
+	// under PropagationMode.
+	Workspaces      []WorkspaceChange `json:"workspaces"`
+	PropagationMode string            `json:"propagation"`
+}
+
+// ExpiryImpact compares when the current generation of a credential
+// expires now and under the proposed TTL.
+type ExpiryImpact struct {
+	CurrentExpiresAt  time.Time `json:"current_expires_at"`
+	ProposedExpiresAt time.Time `json:"proposed_expires_at"`
+	// Change is ProposedExpiresAt minus CurrentExpiresAt, in seconds.
+	Change int64 `json:"change_seconds"`
+	// ExpiresImmediately is set when the generation is older than the
+	// proposed TTL, so it would expire as soon as the TTL is set.
+	ExpiresImmediately bool `json:"expires_immediately"`
+	// CappedByMaxLifetime is set when the max-lifetime policy, rather than
+	// the TTL, would set the expiry.
+	CappedByMaxLifetime bool       `json:"capped_by_max_lifetime"`
+	RotationDueAt       *time.Time `json:"rotation_due_at,omitempty"`
+	// SecretExpiresFirst is set when the provider expires the current
+	// secret on its own before the proposed expiry.
+	SecretExpiresFirst bool `json:"secret_expires_first"`
+}
+
+// LeaseImpact describes how the proposed TTL changes an active lease.
+// Leases keep their expiry; only how far they can be renewed changes.
+type LeaseImpact struct {
+	LeaseID   string    `json:"lease_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// CurrentRenewalLimit and ProposedRenewalLimit are the furthest a
+	// renewal made now could extend the lease to.
+	CurrentRenewalLimit  time.Time `json:"current_renewal_limit"`
+	ProposedRenewalLimit time.Time `json:"proposed_renewal_limit"`
+	Effect               string    `json:"effect"`
+	// OutlivesCredential is set when the lease already runs past the
+	// proposed expiry of the credential generation it was issued for.
+	OutlivesCredential bool `json:"outlives_credential"`
+}
+
+// SimulateTTL reports when credential id would expire with ttl, which of
+// its leases and Terraform workspaces the change would affect, and which
+// policy rules it would break, without changing anything.
+func SimulateTTL(ctx context.Context, id string, ttl int) (*TTLSimulation, error) {
+	now := time.Now().UTC()
+	storeMu.RLock()
+	cred, exists := dynCredsStore[id]
+	if !exists {
+		storeMu.RUnlock()
+		return nil, ErrNotFound
+	}
+	current := *cred
+	var active []models.Lease
+	for _, lease := range leases[id] {
+		if leaseState(lease, now) == LeaseActive && lease.Generation == cred.Generation {
+			active = append(active, *lease)
+		}
+	}
+	storeMu.RUnlock()
+
+	proposed := current
+	proposed.TTL = ttl
+	applyLifetime(&proposed)
+
+	violations := GetPolicy().CheckTTL(ttl)
+	sim := &TTLSimulation{
+		CredentialID: id,
+		Version:      current.Version,
+		SimulatedAt:  now,
+		CurrentTTL:   current.TTL,
+		ProposedTTL:  ttl,
+		Allowed:      len(violations) == 0,
+		Violations:   append([]policy.Violation{}, violations...),
+		Expiry: ExpiryImpact{
+			CurrentExpiresAt:    current.ExpiresAt,
+			ProposedExpiresAt:   proposed.ExpiresAt,
+			Change:              int64(proposed.ExpiresAt.Sub(current.ExpiresAt) / time.Second),
+			ExpiresImmediately:  !now.Before(proposed.ExpiresAt),
+			CappedByMaxLifetime: proposed.RotationDueAt != nil && proposed.ExpiresAt.Equal(*proposed.RotationDueAt),
+			RotationDueAt:       proposed.RotationDueAt,
+			SecretExpiresFirst:  current.SecretExpiresAt != nil && current.SecretExpiresAt.Before(proposed.ExpiresAt),
+		},
+		Leases:          []LeaseImpact{},
+		ActiveLeases:    len(active),
+		PropagationMode: PropagationMode.Value(),
+	}
+
+	sort.Slice(active, func(i, j int) bool { return active[i].ID < active[j].ID })
+	for i := range active {
+		if impact, ok := leaseImpact(&active[i], &current, &proposed, now); ok {
+			sim.Leases = append(sim.Leases, impact)
+		}
+	}
+
+	plan, err := planWorkspaceChanges(ctx, &current, ttl)
+	if err != nil {
+		return nil, err
+	}
+	sim.Workspaces = plan.changes
+	return sim, nil
+}
+
+// leaseImpact compares how far lease could be renewed now under current
+// and proposed, reporting false when the change makes no difference.
+func leaseImpact(lease *models.Lease, current, proposed *models.DynamicCredential, now time.Time) (LeaseImpact, bool) {
+	impact := LeaseImpact{
+		LeaseID:              lease.ID,
+		ExpiresAt:            lease.ExpiresAt,
+		CurrentRenewalLimit:  capExpiry(leaseExpiry(current, 0, now), lease.SecretExpiresAt),
+		ProposedRenewalLimit: capExpiry(leaseExpiry(proposed, 0, now), lease.SecretExpiresAt),
+		OutlivesCredential:   lease.ExpiresAt.After(proposed.ExpiresAt),
+	}
+	switch {
+	case !now.Before(proposed.ExpiresAt):
+		impact.Effect = LeaseRenewalsEnded
+	case impact.ProposedRenewalLimit.Before(impact.CurrentRenewalLimit):
+		impact.Effect = LeaseRenewalsShortened
+	case impact.ProposedRenewalLimit.After(impact.CurrentRenewalLimit):
+		impact.Effect = LeaseRenewalsExtended
+	default:
+		return impact, false
+	}
+	return impact, true
+}
@@ -0,0 +1,128 @@
+// services/tags.go
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxTagKeyLength   = 63
+	maxTagValueLength = 255
+	maxTagsPerCred    = 32
+)
+
+var (
+	// ErrInvalidTags is returned when a credential's tags fail validation.
+	ErrInvalidTags = errors.New("invalid tags")
+	// ErrInvalidSelector is returned when a selector query cannot be parsed.
+	ErrInvalidSelector = errors.New("invalid selector")
+
+	tagKeyPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9._/-]*[a-z0-9])?$`)
+)
+
+// ValidateTags checks tag names and values. Names are lowercase
+// alphanumerics with '.', '_', '/' and '-' allowed in the middle.
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > maxTagsPerCred {
+		return fmt.Errorf("%w: at most %d tags allowed", ErrInvalidTags, maxTagsPerCred)
+	}
+	for k, v := range tags {
+		if len(k) > maxTagKeyLength || !tagKeyPattern.MatchString(k) {
+			return fmt.Errorf("%w: tag name %q must match %s and be at most %d characters",
+				ErrInvalidTags, k, tagKeyPattern, maxTagKeyLength)
+		}
+		if len(v) > maxTagValueLength || strings.ContainsAny(v, ",=!") {
+			return fmt.Errorf("%w: tag %q value must be at most %d characters and not contain ',', '=' or '!'",
+				ErrInvalidTags, k, maxTagValueLength)
+		}
+	}
+	return nil
+}
+
+type selectorOp int
+
+const (
+	opEquals selectorOp = iota
+	opNotEquals
+	opExists
+	opNotExists
+)
+
+type requirement struct {
+	key   string
+	op    selectorOp
+	value string
+}
+
+// Selector is a parsed label selector. All requirements must match.
+type Selector []requirement
+
+// ParseSelector parses a comma-separated list of requirements:
+//
+//	key=value  key==value  key!=value  key  !key
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		var req requirement
+		switch {
+		case term == "":
+			return nil, fmt.Errorf("%w: empty requirement", ErrInvalidSelector)
+		case strings.Contains(term, "!="):
+			k, v, _ := strings.Cut(term, "!=")
+			req = requirement{key: k, op: opNotEquals, value: v}
+		case strings.Contains(term, "=="):
+			k, v, _ := strings.Cut(term, "==")
+			req = requirement{key: k, op: opEquals, value: v}
+		case strings.Contains(term, "="):
+			k, v, _ := strings.Cut(term, "=")
+			req = requirement{key: k, op: opEquals, value: v}
+		case strings.HasPrefix(term, "!"):
+			req = requirement{key: term[1:], op: opNotExists}
+		default:
+			req = requirement{key: term, op: opExists}
+		}
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+		if !tagKeyPattern.MatchString(req.key) {
+			return nil, fmt.Errorf("%w: bad tag name in %q", ErrInvalidSelector, term)
+		}
+		if strings.ContainsAny(req.value, "=!") {
+			return nil, fmt.Errorf("%w: bad value in %q", ErrInvalidSelector, term)
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// Matches reports whether tags satisfy every requirement in the selector.
+func (s Selector) Matches(tags map[string]string) bool {
+	for _, r := range s {
+		v, ok := tags[r.key]
+		switch r.op {
+		case opEquals:
+			if !ok || v != r.value {
+				return false
+			}
+		case opNotEquals:
+			if ok && v == r.value {
+				return false
+			}
+		case opExists:
+			if !ok {
+				return false
+			}
+		case opNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,277 @@
+// services/teams.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"sort"
+	"strings"
+	"test-go/models"
+	"time"
+)
+
+// Roles a user can hold in a team. Admins also manage its membership.
+const (
+	TeamRoleMember = "member"
+	TeamRoleAdmin  = "admin"
+)
+
+const (
+	maxTeamNameLength = 63
+	maxUserLength     = 255
+)
+
+var (
+	// ErrTeamNotFound is returned when a team does not exist.
+	ErrTeamNotFound = errors.New("team not found")
+	// ErrTeamExists is returned when creating a team whose name is taken.
+	ErrTeamExists = errors.New("team already exists")
+	// ErrInvalidTeam is returned for invalid team names, members or roles.
+	ErrInvalidTeam = errors.New("invalid team")
+	// ErrTeamNotEmpty is returned when deleting a team that still owns
+	// dynamic credentials.
+	ErrTeamNotEmpty = errors.New("team still owns dynamic credentials")
+	// ErrNotTeamMember is returned when a user lacks the team role an
+	// operation requires.
+	ErrNotTeamMember = errors.New("not a member of the team")
+	// ErrMemberNotFound is returned when removing a user who is not a member.
+	ErrMemberNotFound = errors.New("team member not found")
+	// ErrLastTeamAdmin is returned when a change would leave a team
+	// without an admin to manage it.
+	ErrLastTeamAdmin = errors.New("team must keep at least one admin")
+	// ErrNotOperatorAdmin is returned when a user who is not an operator
+	// admin uses the admin endpoints or decides approvals outside teams.
+	ErrNotOperatorAdmin = errors.New("not an operator admin")
+
+	teamNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+	// Teams by name, guarded by storeMu along with the credentials they own.
+	teams = make(map[string]*models.Team)
+
+	// operatorAdmins use the admin endpoints and decide approvals outside
+	// teams; set once at startup, before serving.
+	operatorAdmins = make(map[string]bool)
+)
+
+// SetOperatorAdmins names the users allowed to use the admin endpoints,
+// managing teams, policy, maintenance and feature flags, and to decide
+// approvals outside teams. Without any, nobody is.
+func SetOperatorAdmins(users []string) {
+	operatorAdmins = make(map[string]bool, len(users))
+	for _, user := range users {
+		operatorAdmins[user] = true
+	}
+}
+
+// CheckOperatorAdmin returns ErrNotOperatorAdmin unless user is an
+// operator admin.
+func CheckOperatorAdmin(user string) error {
+	if !operatorAdmins[user] {
+		return fmt.Errorf("%w: %s", ErrNotOperatorAdmin, user)
+	}
+	return nil
+}
+
+// HasTeamRole reports whether role grants at least required.
+func HasTeamRole(role, required string) bool {
+	switch required {
+	case TeamRoleMember:
+		return role == TeamRoleMember || role == TeamRoleAdmin
+	case TeamRoleAdmin:
+		return role == TeamRoleAdmin
+	}
+	return false
+}
+
+func validateMember(user, role string) error {
+	if user == "" || len(user) > maxUserLength || strings.TrimSpace(user) != user {
+		return fmt.Errorf("%w: user %q must be non-empty, at most %d characters and not padded with spaces",
+			ErrInvalidTeam, user, maxUserLength)
+	}
+	if role != TeamRoleMember && role != TeamRoleAdmin {
+		return fmt.Errorf("%w: role %q (want %s or %s)", ErrInvalidTeam, role, TeamRoleMember, TeamRoleAdmin)
+	}
+	return nil
+}
+
+func cloneTeam(team *models.Team) *models.Team {
+	view := *team
+	view.Members = maps.Clone(team.Members)
+	return &view
+}
+
+// CreateTeam creates an empty credential namespace administered by the
+// requested admins.
+func CreateTeam(req models.CreateTeamRequest) (*models.Team, error) {
+	if len(req.Name) > maxTeamNameLength || !teamNamePattern.MatchString(req.Name) {
+		return nil, fmt.Errorf("%w: name %q must match %s and be at most %d characters",
+			ErrInvalidTeam, req.Name, teamNamePattern, maxTeamNameLength)
+	}
+	team := &models.Team{Name: req.Name, Members: make(map[string]string), CreatedAt: time.Now().UTC()}
+	for _, user := range req.Admins {
+		if err := validateMember(user, TeamRoleAdmin); err != nil {
+			return nil, err
+		}
+		team.Members[user] = TeamRoleAdmin
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if _, exists := teams[team.Name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrTeamExists, team.Name)
+	}
+	teams[team.Name] = team
+	return cloneTeam(team), nil
+}
+
+// GetTeam retrieves a team by name.
+func GetTeam(name string) (*models.Team, error) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	team, exists := teams[name]
+	if !exists {
+		return nil, ErrTeamNotFound
+	}
+	return cloneTeam(team), nil
+}
+
+// ListTeams returns all teams ordered by name.
+func ListTeams() []*models.Team {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	list := make([]*models.Team, 0, len(teams))
+	for _, team := range teams {
+		list = append(list, cloneTeam(team))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// DeleteTeam deletes a team that no longer owns any dynamic credentials.
+func DeleteTeam(name string) error {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if _, exists := teams[name]; !exists {
+		return ErrTeamNotFound
+	}
+	count := 0
+	for _, cred := range dynCredsStore {
+		if cred.Team == name {
+			count++
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %d remaining", ErrTeamNotEmpty, count)
+	}
+	delete(teams, name)
+	return nil
+}
+
+// SetTeamMember adds user to the team with role, or changes their role.
+func SetTeamMember(name, user, role string) (*models.Team, error) {
+	if err := validateMember(user, role); err != nil {
+		return nil, err
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	team, exists := teams[name]
+	if !exists {
+		return nil, ErrTeamNotFound
+	}
+	if role != TeamRoleAdmin {
+		if err := checkAdminLeftLocked(team, user); err != nil {
+			return nil, err
+		}
+	}
+	team.Members[user] = role
+	return cloneTeam(team), nil
+}
+
+// RemoveTeamMember removes user from the team.
+func RemoveTeamMember(name, user string) (*models.Team, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	team, exists := teams[name]
+	if !exists {
+		return nil, ErrTeamNotFound
+	}
+	if _, member := team.Members[user]; !member {
+		return nil, fmt.Errorf("%w: %s", ErrMemberNotFound, user)
+	}
+	if err := checkAdminLeftLocked(team, user); err != nil {
+		return nil, err
+	}
+	delete(team.Members, user)
+	return cloneTeam(team), nil
+}
+
+// checkAdminLeftLocked rejects demoting or removing user when they are
+// the team's last admin. Teams created without admins are left to the
+// operators. Callers must hold storeMu.
+func checkAdminLeftLocked(team *models.Team, user string) error {
+	if team.Members[user] != TeamRoleAdmin {
+		return nil
+	}
+	for other, role := range team.Members {
+		if other != user && role == TeamRoleAdmin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is the last admin of %s", ErrLastTeamAdmin, user, team.Name)
+}
+
+// checkTeamLocked returns ErrTeamNotFound unless name is empty, for
+// credentials outside any team, or an existing team. Callers must hold
+// storeMu.
+func checkTeamLocked(name string) error {
+	if _, exists := teams[name]; name != "" && !exists {
+		return ErrTeamNotFound
+	}
+	return nil
+}
+
+// CheckTeamRole returns ErrNotTeamMember unless user holds at least
+// required in the team.
+func CheckTeamRole(name, user, required string) error {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	team, exists := teams[name]
+	if !exists {
+		return ErrTeamNotFound
+	}
+	if !HasTeamRole(team.Members[user], required) {
+		return fmt.Errorf("%w: %s needs the %s role in %s", ErrNotTeamMember, user, required, name)
+	}
+	return nil
+}
+
+// GetTeamCredential retrieves a dynamic credential by ID if it lives in
+// the team. Credentials of other teams are reported as not found, so a
+// team cannot probe for them.
+func GetTeamCredential(ctx context.Context, team, id string) (*models.DynamicCredential, error) {
+	cred, err := GetDynamicCredential(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Team != team {
+		return nil, ErrNotFound
+	}
+	return cred, nil
+}
+
+// ListTeamCredentials returns the team's credentials matching the
+// selector, ordered by name.
+func ListTeamCredentials(ctx context.Context, team string, selector Selector) []*models.DynamicCredential {
+	creds := ListDynamicCredentials(ctx, selector)
+	n := 0
+	for _, cred := range creds {
+		if cred.Team == team {
+			creds[n] = cred
+			n++
+		}
+	}
+	return creds[:n]
+}
@@ -0,0 +1,68 @@
+// services/usage.go
+package services
+
+import (
+	"context"
+	"sort"
+	"test-go/models"
+	"test-go/tracing"
+	"time"
+)
+
+// FetchDynamicCredential retrieves a dynamic credential by ID for a
+// consumer, counting it as a use. The returned copy is safe to read after
+// later writes.
+func FetchDynamicCredential(ctx context.Context, id string) (_ *models.DynamicCredential, err error) {
+	_, span := storeSpan(ctx, "fetch", id)
+	defer func() { tracing.End(span, err) }()
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	cred, exists := dynCredsStore[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	recordUseLocked(cred, time.Now().UTC())
+	return credentialView(cred), nil
+}
+
+// recordUseLocked counts a use of cred at now. The caller must hold the
+// write lock.
+func recordUseLocked(cred *models.DynamicCredential, now time.Time) {
+	cred.UseCount++
+	cred.LastUsedAt = &now
+}
+
+// lastActivity is when cred was last used, or created if it never was.
+func lastActivity(cred *models.DynamicCredential) time.Time {
+	if cred.LastUsedAt != nil {
+		return *cred.LastUsedAt
+	}
+	return cred.CreatedAt
+}
+
+// ListStaleCredentials returns the credentials matching the selector that
+// nobody used for at least unusedFor before now, least recently used
+// first. Credentials never used count from their creation, so new ones are
+// not reported before they had a chance to be used.
+func ListStaleCredentials(now time.Time, unusedFor time.Duration, selector Selector) ([]*models.DynamicCredential, error) {
+	if unusedFor <= 0 {
+		return nil, ErrInvalidWindow
+	}
+	cutoff := now.Add(-unusedFor)
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	var creds []*models.DynamicCredential
+	for _, cred := range dynCredsStore {
+		if !lastActivity(cred).After(cutoff) && selector.Matches(cred.Tags) {
+			creds = append(creds, credentialView(cred))
+		}
+	}
+	sort.Slice(creds, func(i, j int) bool {
+		a, b := lastActivity(creds[i]), lastActivity(creds[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return creds[i].ID < creds[j].ID
+	})
+	return creds, nil
+}
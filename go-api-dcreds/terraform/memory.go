@@ -0,0 +1,85 @@
+// terraform/memory.go
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryClient is an in-memory Client for local development and tests.
+type MemoryClient struct {
+	mu         sync.Mutex
+	workspaces map[string]Workspace
+	vars       map[string]map[string]Variable // workspace ID -> variable ID -> variable
+	nextID     int
+}
+
+// NewMemoryClient creates a MemoryClient with one workspace per name.
+func NewMemoryClient(workspaceNames ...string) *MemoryClient {
+	c := &MemoryClient{
+		workspaces: make(map[string]Workspace),
+		vars:       make(map[string]map[string]Variable),
+	}
+	for _, name := range workspaceNames {
+		c.nextID++
+		ws := Workspace{ID: fmt.Sprintf("ws-%04d", c.nextID), Name: name}
+		c.workspaces[ws.ID] = ws
+		c.vars[ws.ID] = make(map[string]Variable)
+	}
+	return c
+}
+
+func (c *MemoryClient) ListWorkspaces(ctx context.Context) ([]Workspace, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]Workspace, 0, len(c.workspaces))
+	for _, ws := range c.workspaces {
+		out = append(out, ws)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (c *MemoryClient) ListVariables(ctx context.Context, workspaceID string) ([]Variable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vars, ok := c.vars[workspaceID]
+	if !ok {
+		return nil, ErrWorkspaceNotFound
+	}
+	out := make([]Variable, 0, len(vars))
+	for _, v := range vars {
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+func (c *MemoryClient) CreateVariable(ctx context.Context, workspaceID string, v Variable) (Variable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vars, ok := c.vars[workspaceID]
+	if !ok {
+		return Variable{}, ErrWorkspaceNotFound
+	}
+	c.nextID++
+	v.ID = fmt.Sprintf("var-%04d", c.nextID)
+	vars[v.ID] = v
+	return v, nil
+}
+
+func (c *MemoryClient) UpdateVariable(ctx context.Context, workspaceID string, v Variable) (Variable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vars, ok := c.vars[workspaceID]
+	if !ok {
+		return Variable{}, ErrWorkspaceNotFound
+	}
+	if _, ok := vars[v.ID]; !ok {
+		return Variable{}, fmt.Errorf("variable %s not found in workspace %s", v.ID, workspaceID)
+	}
+	vars[v.ID] = v
+	return v, nil
+}
@@ -0,0 +1,34 @@
+// terraform/terraform.go
+package terraform
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrWorkspaceNotFound is returned when a workspace does not exist.
+var ErrWorkspaceNotFound = errors.New("terraform workspace not found")
+
+// Workspace is a Terraform workspace.
+type Workspace struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Variable is a Terraform variable set on a workspace.
+type Variable struct {
+	ID          string `json:"id"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description"`
+	Sensitive   bool   `json:"sensitive"`
+}
+
+// Client is the subset of the Terraform Cloud/Enterprise API used to
+// propagate credential TTLs to workspaces.
+type Client interface {
+	ListWorkspaces(ctx context.Context) ([]Workspace, error)
+	ListVariables(ctx context.Context, workspaceID string) ([]Variable, error)
+	CreateVariable(ctx context.Context, workspaceID string, v Variable) (Variable, error)
+	UpdateVariable(ctx context.Context, workspaceID string, v Variable) (Variable, error)
+}
@@ -0,0 +1,212 @@
+// terraform/tfe.go
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"test-go/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const jsonAPIContentType = "application/vnd.api+json"
+
+// TFEClient talks to the Terraform Cloud/Enterprise v2 API.
+type TFEClient struct {
+	Address      string
+	Organization string
+	Token        string
+	HTTPClient   *http.Client
+}
+
+// NewTFEClient creates a client for the given organization. An empty address
+// defaults to https://app.terraform.io.
+func NewTFEClient(address, organization, token string) *TFEClient {
+	if address == "" {
+		address = "https://app.terraform.io"
+	}
+	return &TFEClient{
+		Address:      strings.TrimSuffix(address, "/"),
+		Organization: organization,
+		Token:        token,
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type tfeResource struct {
+	ID         string          `json:"id,omitempty"`
+	Type       string          `json:"type"`
+	Attributes json.RawMessage `json:"attributes"`
+}
+
+type tfeList struct {
+	Data []tfeResource `json:"data"`
+	Meta struct {
+		Pagination struct {
+			NextPage *int `json:"next-page"`
+		} `json:"pagination"`
+	} `json:"meta"`
+}
+
+type tfeSingle struct {
+	Data tfeResource `json:"data"`
+}
+
+type tfeVarAttributes struct {
+	Key         string `json:"key,omitempty"`
+	Value       string `json:"value"`
+	Description string `json:"description"`
+	Category    string `json:"category,omitempty"`
+	Sensitive   bool   `json:"sensitive"`
+	HCL         bool   `json:"hcl"`
+}
+
+// span starts a client span for the API operation op on the organization
+// and, unless workspaceID is empty, the workspace.
+func (c *TFEClient) span(ctx context.Context, op, workspaceID string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("terraform.organization", c.Organization),
+	}
+	if u, err := url.Parse(c.Address); err == nil {
+		attrs = append(attrs, semconv.ServerAddress(u.Hostname()))
+	}
+	if workspaceID != "" {
+		attrs = append(attrs, attribute.String("terraform.workspace.id", workspaceID))
+	}
+	return tracing.Start(ctx, "terraform."+op, attrs...)
+}
+
+// do sends one API request. The span in ctx gets the method and status of
+// the request, the last one for paged lists.
+func (c *TFEClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.Address+"/api/v2"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", jsonAPIContentType)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	trace.SpanFromContext(ctx).SetAttributes(
+		semconv.HTTPRequestMethodKey.String(method),
+		semconv.HTTPResponseStatusCode(resp.StatusCode),
+	)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrWorkspaceNotFound
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("terraform API %s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ListWorkspaces lists every workspace in the organization.
+func (c *TFEClient) ListWorkspaces(ctx context.Context) (_ []Workspace, err error) {
+	ctx, span := c.span(ctx, "ListWorkspaces", "")
+	defer func() { tracing.End(span, err) }()
+	var workspaces []Workspace
+	page := 1
+	for {
+		var list tfeList
+		path := fmt.Sprintf("/organizations/%s/workspaces?page%%5Bnumber%%5D=%d&page%%5Bsize%%5D=100",
+			url.PathEscape(c.Organization), page)
+		if err := c.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+			return nil, err
+		}
+		for _, r := range list.Data {
+			var attrs struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(r.Attributes, &attrs); err != nil {
+				return nil, err
+			}
+			workspaces = append(workspaces, Workspace{ID: r.ID, Name: attrs.Name})
+		}
+		if list.Meta.Pagination.NextPage == nil {
+			span.SetAttributes(attribute.Int("terraform.workspace.count", len(workspaces)))
+			return workspaces, nil
+		}
+		page = *list.Meta.Pagination.NextPage
+	}
+}
+
+// ListVariables lists the variables of a workspace.
+func (c *TFEClient) ListVariables(ctx context.Context, workspaceID string) (_ []Variable, err error) {
+	ctx, span := c.span(ctx, "ListVariables", workspaceID)
+	defer func() { tracing.End(span, err) }()
+	var list tfeList
+	if err := c.do(ctx, http.MethodGet, "/workspaces/"+url.PathEscape(workspaceID)+"/vars", nil, &list); err != nil {
+		return nil, err
+	}
+	vars := make([]Variable, 0, len(list.Data))
+	for _, r := range list.Data {
+		v, err := toVariable(r)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
+
+// CreateVariable creates a terraform-category variable on a workspace.
+func (c *TFEClient) CreateVariable(ctx context.Context, workspaceID string, v Variable) (_ Variable, err error) {
+	ctx, span := c.span(ctx, "CreateVariable", workspaceID)
+	defer func() { tracing.End(span, err) }()
+	span.SetAttributes(attribute.String("terraform.variable.key", v.Key))
+	attrs, _ := json.Marshal(tfeVarAttributes{Key: v.Key, Value: v.Value, Description: v.Description, Category: "terraform", Sensitive: v.Sensitive})
+	body := tfeSingle{Data: tfeResource{Type: "vars", Attributes: attrs}}
+	var out tfeSingle
+	if err := c.do(ctx, http.MethodPost, "/workspaces/"+url.PathEscape(workspaceID)+"/vars", body, &out); err != nil {
+		return Variable{}, err
+	}
+	return toVariable(out.Data)
+}
+
+// UpdateVariable updates the value and description of an existing variable.
+func (c *TFEClient) UpdateVariable(ctx context.Context, workspaceID string, v Variable) (_ Variable, err error) {
+	ctx, span := c.span(ctx, "UpdateVariable", workspaceID)
+	defer func() { tracing.End(span, err) }()
+	span.SetAttributes(attribute.String("terraform.variable.key", v.Key))
+	attrs, _ := json.Marshal(tfeVarAttributes{Value: v.Value, Description: v.Description, Sensitive: v.Sensitive})
+	body := tfeSingle{Data: tfeResource{ID: v.ID, Type: "vars", Attributes: attrs}}
+	var out tfeSingle
+	path := "/workspaces/" + url.PathEscape(workspaceID) + "/vars/" + url.PathEscape(v.ID)
+	if err := c.do(ctx, http.MethodPatch, path, body, &out); err != nil {
+		return Variable{}, err
+	}
+	return toVariable(out.Data)
+}
+
+func toVariable(r tfeResource) (Variable, error) {
+	var attrs tfeVarAttributes
+	if err := json.Unmarshal(r.Attributes, &attrs); err != nil {
+		return Variable{}, err
+	}
+	return Variable{ID: r.ID, Key: attrs.Key, Value: attrs.Value, Description: attrs.Description, Sensitive: attrs.Sensitive}, nil
+}
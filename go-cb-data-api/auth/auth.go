@@ -0,0 +1,146 @@
+// Package auth identifies callers by bearer token and carries their role
+// through the request context, so handlers can shape responses by role.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Anonymous is the role of requests without a bearer token.
+const Anonymous = ""
+
+type contextKey struct{}
+
+type sessionKey struct{}
+
+// WithRole returns a copy of ctx carrying the caller's role.
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, contextKey{}, role)
+}
+
+// RoleFromContext returns the caller's role carried by ctx, or Anonymous.
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(contextKey{}).(string)
+	return role
+}
+
+// WithSession returns a copy of ctx carrying the caller's session.
+func WithSession(ctx context.Context, session Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// SessionFromContext returns the session carried by ctx, if the caller
+// authenticated with a session token.
+func SessionFromContext(ctx context.Context) (Session, bool) {
+	session, ok := ctx.Value(sessionKey{}).(Session)
+	return session, ok
+}
+
+// Config maps bearer tokens to roles.
+type Config struct {
+	// Tokens maps each accepted token to the role of its holder.
+	Tokens map[string]string
+	// Sessions, if set, also accepts the tokens of its sessions, whose
+	// holders get the User role.
+	Sessions *SessionStore
+	// Required rejects requests without a token. Otherwise they are
+	// served as Anonymous.
+	Required bool
+}
+
+// ConfigFromEnv reads AUTH_TOKENS, a comma-separated list of role:token
+// pairs such as "admin:s3cret,support:t0ken", and AUTH_REQUIRED.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Tokens: make(map[string]string), Required: os.Getenv("AUTH_REQUIRED") == "true"}
+	for _, pair := range strings.Split(os.Getenv("AUTH_TOKENS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		role, token, ok := strings.Cut(pair, ":")
+		role, token = strings.TrimSpace(role), strings.TrimSpace(token)
+		if !ok || role == "" || token == "" {
+			return Config{}, fmt.Errorf("AUTH_TOKENS: %q is not role:token", pair)
+		}
+		cfg.Tokens[token] = role
+	}
+	return cfg, nil
+}
+
+// role returns the role of token, comparing it with every configured
+// token in constant time.
+func (c Config) role(token string) (string, bool) {
+	role, found := "", false
+	for candidate, r := range c.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			role, found = r, true
+		}
+	}
+	return role, found
+}
+
+// session returns the session of token, if sessions are enabled.
+func (c Config) session(token string) (Session, bool) {
+	if c.Sessions == nil {
+		return Session{}, false
+	}
+	return c.Sessions.Lookup(token)
+}
+
+// Middleware resolves the role of each request from its Authorization
+// bearer token and stores it in the request context, along with the
+// session of session tokens. Unknown tokens get a 401, as do requests
+// without a token when cfg.Required is set.
+func Middleware(cfg Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			if cfg.Required {
+				c.Header("WWW-Authenticate", "Bearer")
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+				return
+			}
+			c.Next()
+			return
+		}
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		token = strings.TrimSpace(token)
+		ctx := c.Request.Context()
+		if role, known := cfg.role(token); ok && known {
+			ctx = WithRole(ctx, role)
+		} else if session, known := cfg.session(token); ok && known {
+			ctx = WithSession(WithRole(ctx, User), session)
+		} else {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// RequireRole lets through only requests whose role, resolved by
+// Middleware, is one of roles. Others get a 403, or a 401 without a token.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := RoleFromContext(c.Request.Context())
+		if role == Anonymous {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		if !slices.Contains(roles, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,137 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConfigFromEnv checks AUTH_TOKENS parsing, including malformed pairs.
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("AUTH_TOKENS", " admin:s3cret, support:t0ken ,")
+	t.Setenv("AUTH_REQUIRED", "true")
+	cfg, err := auth.ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, auth.Config{Tokens: map[string]string{"s3cret": "admin", "t0ken": "support"}, Required: true}, cfg)
+
+	t.Setenv("AUTH_TOKENS", "admin")
+	_, err = auth.ConfigFromEnv()
+	assert.ErrorContains(t, err, `"admin" is not role:token`)
+}
+
+// TestMiddleware checks requests reach the handler with the role of their
+// token, or as anonymous callers when tokens are optional.
+func TestMiddleware(t *testing.T) {
+	tokens := map[string]string{"s3cret": "admin", "t0ken": "support"}
+	newRouter := func(cfg auth.Config) *gin.Engine {
+		router := gin.New()
+		router.Use(auth.Middleware(cfg))
+		router.GET("/users/:id", func(c *gin.Context) {
+			c.String(http.StatusOK, auth.RoleFromContext(c.Request.Context()))
+		})
+		return router
+	}
+
+	testCases := []struct {
+		name          string
+		required      bool
+		authorization string
+		expectedCode  int
+		expectedBody  string
+	}{
+		{name: "Admin", authorization: "Bearer s3cret", expectedCode: http.StatusOK, expectedBody: "admin"},
+		{name: "Support", authorization: "Bearer t0ken", expectedCode: http.StatusOK, expectedBody: "support"},
+		{name: "Anonymous", expectedCode: http.StatusOK, expectedBody: auth.Anonymous},
+		{name: "Token Required", required: true, expectedCode: http.StatusUnauthorized, expectedBody: `{"error":"Authentication required"}`},
+		{name: "Unknown Token", authorization: "Bearer guess", expectedCode: http.StatusUnauthorized, expectedBody: `{"error":"Invalid token"}`},
+		{name: "Not Bearer", authorization: "Basic s3cret", expectedCode: http.StatusUnauthorized, expectedBody: `{"error":"Invalid token"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rr := httptest.NewRecorder()
+			newRouter(auth.Config{Tokens: tokens, Required: tc.required}).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			assert.Equal(t, tc.expectedBody, rr.Body.String())
+		})
+	}
+}
+
+// TestMiddlewareSessions checks session tokens authenticate as the user
+// role and carry their session.
+func TestMiddlewareSessions(t *testing.T) {
+	sessions := auth.NewSessionStore(time.Hour)
+	session, err := sessions.Create("user1", "")
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(auth.Middleware(auth.Config{Tokens: map[string]string{"s3cret": "admin"}, Sessions: sessions}))
+	router.GET("/users/:id", func(c *gin.Context) {
+		got, _ := auth.SessionFromContext(c.Request.Context())
+		c.String(http.StatusOK, auth.RoleFromContext(c.Request.Context())+" "+got.UserID)
+	})
+
+	testCases := []struct {
+		name          string
+		authorization string
+		expectedCode  int
+		expectedBody  string
+	}{
+		{name: "Session", authorization: "Bearer " + session.Token, expectedCode: http.StatusOK, expectedBody: "user user1"},
+		{name: "Static Token", authorization: "Bearer s3cret", expectedCode: http.StatusOK, expectedBody: "admin "},
+		{name: "Unknown Token", authorization: "Bearer guess", expectedCode: http.StatusUnauthorized, expectedBody: `{"error":"Invalid token"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/user1", nil)
+			req.Header.Set("Authorization", tc.authorization)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			assert.Equal(t, tc.expectedBody, rr.Body.String())
+		})
+	}
+}
+
+// TestRequireRole checks only the listed roles get through.
+func TestRequireRole(t *testing.T) {
+	router := gin.New()
+	router.Use(auth.Middleware(auth.Config{Tokens: map[string]string{"s3cret": "admin", "t0ken": "support"}}))
+	router.DELETE("/users", auth.RequireRole("admin"), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	testCases := []struct {
+		name          string
+		authorization string
+		expectedCode  int
+	}{
+		{name: "Admin", authorization: "Bearer s3cret", expectedCode: http.StatusNoContent},
+		{name: "Support", authorization: "Bearer t0ken", expectedCode: http.StatusForbidden},
+		{name: "Anonymous", expectedCode: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/users", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter blocks keys, such as a user or a client address, after too many
+// failed attempts, to slow down password guessing. Counts are per process.
+type Limiter struct {
+	maxFailures int
+	window      time.Duration
+	mu          sync.Mutex
+	failures    map[string]failureCount
+}
+
+type failureCount struct {
+	count int
+	// until is when the count is forgotten: window after the first failure.
+	until time.Time
+}
+
+// NewLimiter returns a Limiter blocking a key once it failed maxFailures
+// times within window, until window has passed since its first failure.
+func NewLimiter(maxFailures int, window time.Duration) *Limiter {
+	return &Limiter{maxFailures: maxFailures, window: window, failures: make(map[string]failureCount)}
+}
+
+// MaxFailures returns how many failures block a key.
+func (l *Limiter) MaxFailures() int { return l.maxFailures }
+
+// Window returns how long failures are counted.
+func (l *Limiter) Window() time.Duration { return l.window }
+
+// Blocked returns how long until the most blocked of keys may try again,
+// or 0 if none is blocked.
+func (l *Limiter) Blocked(keys ...string) time.Duration {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var wait time.Duration
+	for _, key := range keys {
+		f, ok := l.failures[key]
+		if ok && f.count >= l.maxFailures && now.Before(f.until) {
+			wait = max(wait, f.until.Sub(now))
+		}
+	}
+	return wait
+}
+
+// Fail counts a failed attempt against each of keys.
+func (l *Limiter) Fail(keys ...string) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Forget expired counts as new ones come in, so they do not pile up.
+	for key, f := range l.failures {
+		if !now.Before(f.until) {
+			delete(l.failures, key)
+		}
+	}
+	for _, key := range keys {
+		f, ok := l.failures[key]
+		if !ok {
+			f.until = now.Add(l.window)
+		}
+		f.count++
+		l.failures[key] = f
+	}
+}
+
+// Reset forgets the failures of key, e.g. once its user logged in.
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
@@ -0,0 +1,29 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLimiter checks keys are blocked once they reach the failure limit,
+// until the window passes or they are reset.
+func TestLimiter(t *testing.T) {
+	limiter := auth.NewLimiter(2, time.Hour)
+	limiter.Fail("user:a", "ip:1")
+	assert.Zero(t, limiter.Blocked("user:a", "ip:1"))
+
+	limiter.Fail("user:b", "ip:1")
+	assert.Zero(t, limiter.Blocked("user:a"))
+	assert.InDelta(t, time.Hour, limiter.Blocked("user:a", "ip:1"), float64(time.Minute))
+
+	limiter.Reset("ip:1")
+	assert.Zero(t, limiter.Blocked("user:a", "ip:1"))
+
+	short := auth.NewLimiter(1, time.Millisecond)
+	short.Fail("user:a")
+	time.Sleep(5 * time.Millisecond)
+	assert.Zero(t, short.Blocked("user:a"), "window passed")
+}
@@ -0,0 +1,26 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHashPassword checks hashes match their password only, and that
+// passwords outside the length limits are rejected.
+func TestHashPassword(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.NotContains(t, hash, "correct horse")
+	assert.True(t, auth.CheckPassword(hash, "correct horse"))
+	assert.False(t, auth.CheckPassword(hash, "battery staple"))
+	assert.False(t, auth.CheckPassword("", ""), "no hash matches nothing")
+
+	_, err = auth.HashPassword("short")
+	assert.ErrorIs(t, err, auth.ErrInvalidPassword)
+	_, err = auth.HashPassword(strings.Repeat("x", auth.MaxPasswordLength+1))
+	assert.ErrorIs(t, err, auth.ErrInvalidPassword)
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// User is the role of callers holding a session token from logging in.
+const User = "user"
+
+// Session is a user's login, identified by its bearer token.
+type Session struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"user_id"`
+	Tenant    string    `json:"tenant,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SessionStore keeps the sessions of logged in users in memory, so they
+// end with the process.
+type SessionStore struct {
+	ttl time.Duration
+	mu  sync.Mutex
+	// sessions is keyed by the SHA-256 of the token, so lookups do not
+	// leak tokens through timing.
+	sessions map[string]Session
+}
+
+// NewSessionStore returns a store of sessions lasting ttl.
+func NewSessionStore(ttl time.Duration) *SessionStore {
+	return &SessionStore{ttl: ttl, sessions: make(map[string]Session)}
+}
+
+// TTL returns how long sessions last.
+func (s *SessionStore) TTL() time.Duration { return s.ttl }
+
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create starts a session for the user with ID userID in tenant, "" for
+// users outside any tenant.
+func (s *SessionStore) Create(userID, tenant string) (Session, error) {
+	var token [32]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		return Session{}, err
+	}
+	now := time.Now()
+	session := Session{
+		Token:     hex.EncodeToString(token[:]),
+		UserID:    userID,
+		Tenant:    tenant,
+		ExpiresAt: now.Add(s.ttl).UTC(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Drop expired sessions as new ones come in, so they do not pile up.
+	for key, existing := range s.sessions {
+		if !now.Before(existing.ExpiresAt) {
+			delete(s.sessions, key)
+		}
+	}
+	s.sessions[tokenKey(session.Token)] = session
+	return session, nil
+}
+
+// Lookup returns the unexpired session of token.
+func (s *SessionStore) Lookup(token string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[tokenKey(token)]
+	if !ok || !time.Now().Before(session.ExpiresAt) {
+		return Session{}, false
+	}
+	return session, true
+}
+
+// RevokeUser ends every session of the user with ID userID in tenant.
+func (s *SessionStore) RevokeUser(userID, tenant string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, session := range s.sessions {
+		if session.UserID == userID && session.Tenant == tenant {
+			delete(s.sessions, key)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSessionStore checks sessions are found by token until they expire
+// or their user's sessions are revoked.
+func TestSessionStore(t *testing.T) {
+	store := auth.NewSessionStore(time.Hour)
+	session, err := store.Create("user1", "acme")
+	require.NoError(t, err)
+	other, err := store.Create("user1", "")
+	require.NoError(t, err)
+	assert.NotEqual(t, session.Token, other.Token)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), session.ExpiresAt, time.Minute)
+
+	got, ok := store.Lookup(session.Token)
+	assert.True(t, ok)
+	assert.Equal(t, session, got)
+	_, ok = store.Lookup("guess")
+	assert.False(t, ok)
+
+	store.RevokeUser("user1", "acme")
+	_, ok = store.Lookup(session.Token)
+	assert.False(t, ok, "revoked")
+	_, ok = store.Lookup(other.Token)
+	assert.True(t, ok, "same user ID in another tenant")
+
+	expired := auth.NewSessionStore(-time.Second)
+	session, err = expired.Create("user1", "")
+	require.NoError(t, err)
+	_, ok = expired.Lookup(session.Token)
+	assert.False(t, ok, "expired")
+}
@@ -0,0 +1,475 @@
+// Package backup exports the users collection to object storage and restores
+// it from a chosen backup.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+)
+
+var (
+	// ErrJobRunning is returned when a backup or restore is already in progress.
+	ErrJobRunning = errors.New("a backup or restore job is already running")
+	// ErrBackupNotFound is returned when the requested backup has no manifest.
+	ErrBackupNotFound = errors.New("backup not found")
+	// ErrInvalidPolicy is returned for an unknown conflict policy.
+	ErrInvalidPolicy = errors.New("invalid conflict policy")
+)
+
+// ConflictPolicy decides what a restore does with users that already exist.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keeps the existing user.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing user with the backed up one.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictFail aborts the restore at the first existing user.
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// ParseConflictPolicy validates a policy name, defaulting to ConflictSkip.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return p, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidPolicy, s)
+	}
+}
+
+// Chunk describes one compressed NDJSON object of a backup.
+type Chunk struct {
+	Key    string `json:"key"`
+	Users  int    `json:"users"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest is written last and marks a backup as complete.
+type Manifest struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Users     int       `json:"users"`
+	Chunks    []Chunk   `json:"chunks"`
+}
+
+// Job reports the progress of a backup or restore.
+type Job struct {
+	ID         string         `json:"id"`
+	Kind       string         `json:"kind"`
+	BackupID   string         `json:"backup_id"`
+	Policy     ConflictPolicy `json:"policy,omitempty"`
+	State      string         `json:"state"`
+	Processed  int            `json:"processed"`
+	Skipped    int            `json:"skipped"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// Job states.
+const (
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+// Manager runs backup and restore jobs, one at a time.
+type Manager struct {
+	Repo      repository.UserRepository
+	Store     ObjectStore
+	Prefix    string
+	ChunkSize int
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	running bool
+}
+
+// NewManager creates a Manager writing under the "backups/" prefix in
+// chunks of 1000 users.
+func NewManager(repo repository.UserRepository, store ObjectStore) *Manager {
+	return &Manager{
+		Repo:      repo,
+		Store:     store,
+		Prefix:    "backups/",
+		ChunkSize: 1000,
+		jobs:      make(map[string]*Job),
+	}
+}
+
+// StartBackup launches a backup in the background.
+func (m *Manager) StartBackup() (*Job, error) {
+	job, err := m.start("backup", newBackupID(time.Now()), "")
+	if err != nil {
+		return nil, err
+	}
+	go m.finish(job, m.runBackup(context.Background(), job))
+	return m.snapshot(job), nil
+}
+
+// newBackupID names a backup after its start time, so IDs sort oldest to
+// newest, with a random suffix keeping backups started within the same
+// second apart.
+func newBackupID(now time.Time) string {
+	var suffix [4]byte
+	_, _ = rand.Read(suffix[:])
+	return now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix[:])
+}
+
+// idPattern matches the IDs newBackupID generates, and the IDs of backups
+// taken before they had a suffix.
+var idPattern = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z(-[0-9a-f]{8})?$`)
+
+// ValidID reports whether id has the form of a backup ID. IDs become part
+// of object keys, so anything else, such as "..", must be rejected before
+// it reaches the store.
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// StartRestore launches a restore of backupID in the background.
+func (m *Manager) StartRestore(ctx context.Context, backupID string, policy ConflictPolicy) (*Job, error) {
+	manifest, err := m.manifest(ctx, backupID)
+	if err != nil {
+		return nil, err
+	}
+	job, err := m.start("restore", backupID, policy)
+	if err != nil {
+		return nil, err
+	}
+	go m.finish(job, m.runRestore(context.Background(), job, manifest))
+	return m.snapshot(job), nil
+}
+
+// Job returns the current state of a job.
+func (m *Manager) Job(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *job
+	return &copied, true
+}
+
+// ListBackups returns the manifests of all complete backups, newest first.
+func (m *Manager) ListBackups(ctx context.Context) ([]Manifest, error) {
+	keys, err := m.Store.List(ctx, m.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	var manifests []Manifest
+	for _, key := range keys {
+		if path.Base(key) != "manifest.json" {
+			continue
+		}
+		id := path.Base(path.Dir(key))
+		if !ValidID(id) {
+			continue
+		}
+		manifest, err := m.manifest(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, *manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].ID > manifests[j].ID })
+	return manifests, nil
+}
+
+// RunSchedule starts a backup every interval until ctx is cancelled.
+func (m *Manager) RunSchedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := m.StartBackup(); err != nil {
+				log.Printf("scheduled backup skipped: %v", err)
+			}
+		}
+	}
+}
+
+func (m *Manager) start(kind, backupID string, policy ConflictPolicy) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running {
+		return nil, ErrJobRunning
+	}
+	m.running = true
+	job := &Job{
+		ID:        fmt.Sprintf("%s-%s-%d", kind, backupID, time.Now().UnixNano()),
+		Kind:      kind,
+		BackupID:  backupID,
+		Policy:    policy,
+		State:     StateRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	m.jobs[job.ID] = job
+	return job, nil
+}
+
+func (m *Manager) finish(job *Job, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	job.State = StateSucceeded
+	if err != nil {
+		job.State = StateFailed
+		job.Error = err.Error()
+		log.Printf("%s job %s failed: %v", job.Kind, job.ID, err)
+	}
+	m.running = false
+}
+
+func (m *Manager) snapshot(job *Job) *Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *job
+	return &copied
+}
+
+func (m *Manager) progress(job *Job, processed, skipped int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.Processed += processed
+	job.Skipped += skipped
+}
+
+func (m *Manager) key(backupID, name string) string {
+	return strings.TrimSuffix(m.Prefix, "/") + "/" + backupID + "/" + name
+}
+
+func (m *Manager) manifest(ctx context.Context, backupID string) (*Manifest, error) {
+	if !ValidID(backupID) {
+		return nil, fmt.Errorf("%w: %s", ErrBackupNotFound, backupID)
+	}
+	r, err := m.Store.Get(ctx, m.key(backupID, "manifest.json"))
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrBackupNotFound, backupID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var manifest Manifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("read manifest %s: %w", backupID, err)
+	}
+	return &manifest, nil
+}
+
+func (m *Manager) runBackup(ctx context.Context, job *Job) error {
+	manifest := Manifest{ID: job.BackupID, CreatedAt: job.StartedAt}
+	var cw *chunkWriter
+
+	flush := func() error {
+		if cw == nil {
+			return nil
+		}
+		chunk, err := cw.Close()
+		cw = nil
+		if err != nil {
+			return err
+		}
+		manifest.Chunks = append(manifest.Chunks, chunk)
+		manifest.Users += chunk.Users
+		m.progress(job, chunk.Users, 0)
+		return nil
+	}
+
+	err := m.Repo.ScanUsers(ctx, func(user *model.User) error {
+		if cw == nil {
+			key := m.key(job.BackupID, fmt.Sprintf("chunk-%05d.ndjson.gz", len(manifest.Chunks)))
+			cw = newChunkWriter(ctx, m.Store, key)
+		}
+		if err := cw.Write(user); err != nil {
+			return err
+		}
+		if cw.users >= m.ChunkSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if cw != nil {
+			cw.Abort(err)
+		}
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return m.Store.Put(ctx, m.key(job.BackupID, "manifest.json"), strings.NewReader(string(data)))
+}
+
+func (m *Manager) runRestore(ctx context.Context, job *Job, manifest *Manifest) error {
+	for _, chunk := range manifest.Chunks {
+		if err := m.restoreChunk(ctx, job, chunk); err != nil {
+			return fmt.Errorf("restore %s: %w", chunk.Key, err)
+		}
+	}
+	return nil
+}
+
+// restoreChunk applies the users in chunk only after its checksum matches,
+// so a corrupt or tampered chunk changes nothing. The chunk is staged in a
+// temporary file while it is hashed, keeping memory flat for large chunks.
+func (m *Manager) restoreChunk(ctx context.Context, job *Job, chunk Chunk) error {
+	staged, err := m.stageChunk(ctx, chunk)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		staged.Close()
+		os.Remove(staged.Name())
+	}()
+
+	gz, err := gzip.NewReader(bufio.NewReader(staged))
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(gz)
+	for {
+		var user model.User
+		if err := dec.Decode(&user); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch job.Policy {
+		case ConflictOverwrite:
+			err = m.Repo.UpsertUser(ctx, &user)
+		default:
+			err = m.Repo.InsertUser(ctx, &user)
+		}
+		switch {
+		case errors.Is(err, repository.ErrAlreadyExists) && job.Policy == ConflictSkip:
+			m.progress(job, 0, 1)
+		case err != nil:
+			return fmt.Errorf("user %s: %w", user.ID, err)
+		default:
+			m.progress(job, 1, 0)
+		}
+	}
+	return nil
+}
+
+// stageChunk copies chunk into a temporary file, rewound for reading, and
+// fails unless the copy's SHA-256 matches the manifest.
+func (m *Manager) stageChunk(ctx context.Context, chunk Chunk) (*os.File, error) {
+	r, err := m.Store.Get(ctx, chunk.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := os.CreateTemp("", "restore-*.ndjson.gz")
+	if err != nil {
+		return nil, err
+	}
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hasher), r)
+	if err == nil {
+		if sum := hex.EncodeToString(hasher.Sum(nil)); sum != chunk.SHA256 {
+			err = fmt.Errorf("checksum mismatch: got %s, want %s", sum, chunk.SHA256)
+		}
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// chunkWriter streams gzip-compressed NDJSON to the object store while the
+// users are still being scanned.
+type chunkWriter struct {
+	key    string
+	pw     *io.PipeWriter
+	gz     *gzip.Writer
+	enc    *json.Encoder
+	hasher hash.Hash
+	users  int
+	done   chan error
+}
+
+func newChunkWriter(ctx context.Context, store ObjectStore, key string) *chunkWriter {
+	pr, pw := io.Pipe()
+	hasher := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(pw, hasher))
+	cw := &chunkWriter{
+		key:    key,
+		pw:     pw,
+		gz:     gz,
+		enc:    json.NewEncoder(gz),
+		hasher: hasher,
+		done:   make(chan error, 1),
+	}
+	go func() {
+		err := store.Put(ctx, key, pr)
+		pr.CloseWithError(err)
+		cw.done <- err
+	}()
+	return cw
+}
+
+func (cw *chunkWriter) Write(user *model.User) error {
+	cw.users++
+	return cw.enc.Encode(user)
+}
+
+func (cw *chunkWriter) Close() (Chunk, error) {
+	if err := cw.gz.Close(); err != nil {
+		cw.Abort(err)
+		return Chunk{}, err
+	}
+	cw.pw.Close()
+	if err := <-cw.done; err != nil {
+		return Chunk{}, err
+	}
+	return Chunk{Key: cw.key, Users: cw.users, SHA256: hex.EncodeToString(cw.hasher.Sum(nil))}, nil
+}
+
+func (cw *chunkWriter) Abort(err error) {
+	cw.pw.CloseWithError(err)
+	<-cw.done
+}
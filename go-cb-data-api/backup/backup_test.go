@@ -0,0 +1,147 @@
+package backup_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/backup"
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForJob polls the manager until the job leaves the running state.
+func waitForJob(t *testing.T, m *backup.Manager, id string) *backup.Job {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		job, ok := m.Job(id)
+		require.True(t, ok)
+		if job.State != backup.StateRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+// TestBackupAndRestore backs up users in chunks and restores them with the skip policy.
+func TestBackupAndRestore(t *testing.T) {
+	users := []*model.User{
+		{ID: "user1", Name: "John Doe", Email: "john.doe@example.com"},
+		{ID: "user2", Name: "Jane Smith", Email: "jane.smith@example.com"},
+		{ID: "user3", Name: "Max Mustermann", Email: "max@example.com"},
+	}
+
+	mockRepo := mocks.NewUserRepository(t)
+	mockRepo.On("ScanUsers", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, fn func(*model.User) error) error {
+			for _, u := range users {
+				if err := fn(u); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	mockRepo.On("InsertUser", mock.Anything, mock.MatchedBy(func(u *model.User) bool { return u.ID == "user1" })).
+		Return(repository.ErrAlreadyExists)
+	mockRepo.On("InsertUser", mock.Anything, mock.Anything).Return(nil)
+
+	manager := backup.NewManager(mockRepo, &backup.FileStore{Dir: t.TempDir()})
+	manager.ChunkSize = 2
+
+	job, err := manager.StartBackup()
+	require.NoError(t, err)
+	job = waitForJob(t, manager, job.ID)
+	assert.Equal(t, backup.StateSucceeded, job.State, job.Error)
+	assert.Equal(t, 3, job.Processed)
+
+	manifests, err := manager.ListBackups(context.Background())
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	assert.Equal(t, 3, manifests[0].Users)
+	assert.Len(t, manifests[0].Chunks, 2)
+
+	job, err = manager.StartRestore(context.Background(), manifests[0].ID, backup.ConflictSkip)
+	require.NoError(t, err)
+	job = waitForJob(t, manager, job.ID)
+	assert.Equal(t, backup.StateSucceeded, job.State, job.Error)
+	assert.Equal(t, 2, job.Processed)
+	assert.Equal(t, 1, job.Skipped)
+
+	_, err = manager.StartRestore(context.Background(), "missing", backup.ConflictSkip)
+	assert.ErrorIs(t, err, backup.ErrBackupNotFound)
+	_, err = manager.StartRestore(context.Background(), "../"+manifests[0].ID, backup.ConflictSkip)
+	assert.ErrorIs(t, err, backup.ErrBackupNotFound)
+}
+
+// TestRestoreTamperedChunk checks a chunk failing its checksum restores no users.
+func TestRestoreTamperedChunk(t *testing.T) {
+	mockRepo := mocks.NewUserRepository(t)
+	mockRepo.On("ScanUsers", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, fn func(*model.User) error) error {
+			return fn(&model.User{ID: "user1", Name: "John Doe", Email: "john.doe@example.com"})
+		})
+
+	dir := t.TempDir()
+	manager := backup.NewManager(mockRepo, &backup.FileStore{Dir: dir})
+	job, err := manager.StartBackup()
+	require.NoError(t, err)
+	job = waitForJob(t, manager, job.ID)
+	require.Equal(t, backup.StateSucceeded, job.State, job.Error)
+
+	manifests, err := manager.ListBackups(context.Background())
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	chunk := filepath.Join(dir, filepath.FromSlash(manifests[0].Chunks[0].Key))
+	f, err := os.OpenFile(chunk, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("tampered")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// InsertUser is not expected: the mock fails the test if it is called.
+	job, err = manager.StartRestore(context.Background(), manifests[0].ID, backup.ConflictSkip)
+	require.NoError(t, err)
+	job = waitForJob(t, manager, job.ID)
+	assert.Equal(t, backup.StateFailed, job.State)
+	assert.Contains(t, job.Error, "checksum mismatch")
+	assert.Zero(t, job.Processed)
+}
+
+// TestBackupIDsUnique checks backups started within the same second get
+// their own IDs rather than overwriting each other.
+func TestBackupIDsUnique(t *testing.T) {
+	mockRepo := mocks.NewUserRepository(t)
+	mockRepo.On("ScanUsers", mock.Anything, mock.Anything).Return(nil)
+	manager := backup.NewManager(mockRepo, &backup.FileStore{Dir: t.TempDir()})
+
+	ids := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		job, err := manager.StartBackup()
+		require.NoError(t, err)
+		job = waitForJob(t, manager, job.ID)
+		require.Equal(t, backup.StateSucceeded, job.State, job.Error)
+		ids[job.BackupID] = true
+	}
+	assert.Len(t, ids, 3)
+
+	manifests, err := manager.ListBackups(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, manifests, 3)
+}
+
+// TestValidID checks only IDs of the generated form are accepted.
+func TestValidID(t *testing.T) {
+	assert.True(t, backup.ValidID("20240102T030405Z-0a1b2c3d"))
+	assert.True(t, backup.ValidID("20240102T030405Z"))
+	for _, id := range []string{"", "..", "../20240102T030405Z", "20240102T030405Z/..", "20240102T030405Z-0A1B2C3D", "missing"} {
+		assert.False(t, backup.ValidID(id), id)
+	}
+}
@@ -1,16 +1,32 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/couchbase/gocb/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/gnsalok/go-project-root/go-db-data-api/avatar"
+	"github.com/gnsalok/go-project-root/go-db-data-api/backup"
+	"github.com/gnsalok/go-project-root/go-db-data-api/docs"
+	"github.com/gnsalok/go-project-root/go-db-data-api/durability"
 	"github.com/gnsalok/go-project-root/go-db-data-api/handler"
+	"github.com/gnsalok/go-project-root/go-db-data-api/middleware"
+	"github.com/gnsalok/go-project-root/go-db-data-api/outbox"
+	"github.com/gnsalok/go-project-root/go-db-data-api/quota"
+	"github.com/gnsalok/go-project-root/go-db-data-api/reindex"
 	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
 	"github.com/gnsalok/go-project-root/go-db-data-api/router"
-	"github.com/swaggo/swag/example/basic/docs"
-	// Update with your module path
+	"github.com/gnsalok/go-project-root/go-db-data-api/seed"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
 )
 
 // @title Gin Couchbase API
@@ -19,9 +35,13 @@ import (
 // @host localhost:8080
 // @BasePath /
 func main() {
+	seedFile := flag.String("seed", "", "load the users of this fixtures JSON file before serving")
+	flag.Parse()
+
 	// Initialize Couchbase
-	cluster, err := gocb.Connect("couchbase://localhost", gocb.ClusterOptions{
-		Username: "Administrator",
+	const connStr, username, bucketName = "couchbase://localhost", "Administrator", "users"
+	cluster, err := gocb.Connect(connStr, gocb.ClusterOptions{
+		Username: username,
 		Password: "password",
 	})
 
@@ -30,20 +50,250 @@ func main() {
 	}
 
 	// Open bucket
-	bucket := cluster.Bucket("users")
+	bucket := cluster.Bucket(bucketName)
 	err = bucket.WaitUntilReady(10*time.Second, nil)
 	if err != nil {
 		log.Fatalf("Bucket not ready: %v", err)
 	}
 
-	var user *gocb.Bucket
-	// Initialize repository and handler
-	userRepo := repository.NewUserRepository(user)
+	// Initialize repository and handler, writing with the durability
+	// levels of COUCHBASE_DURABILITY and COUCHBASE_DURABILITY_<OP>, which
+	// requests may raise with the DURABILITY_HEADER header
+	durabilityConfig, err := durability.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid durability config: %v", err)
+	}
+	userRepo := repository.NewUserRepository(bucket, durabilityConfig)
+
+	// Publish user changes to Kafka through the outbox when
+	// OUTBOX_KAFKA_BROKERS is set
+	if brokers := os.Getenv("OUTBOX_KAFKA_BROKERS"); brokers != "" {
+		relay, err := newOutboxRelay(bucket, strings.Split(brokers, ","))
+		if err != nil {
+			log.Fatalf("Failed to configure outbox: %v", err)
+		}
+		userRepo = repository.WithOutbox(userRepo, relay.Store)
+		go relay.Run(context.Background())
+	}
+
+	// Repeat reads on the bucket at SHADOW_COUCHBASE_URL, when set, and
+	// compare the results, to check a migration to it before switching
+	shadowStats, shadowConfig, err := withShadowReads(&userRepo)
+	if err != nil {
+		log.Fatalf("Failed to configure shadow reads: %v", err)
+	}
+
+	// Hide PII such as email from callers whose role, resolved from
+	// AUTH_TOKENS, may not see it
+	userHandler := &handler.UserHandler{Repo: userRepo, MaskFields: true}
+	bulkDeleteHandler := &handler.BulkDeleteHandler{Repo: userRepo}
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid auth config: %v", err)
+	}
+
+	// Initialize backups
+	backupStore, err := newBackupStore()
+	if err != nil {
+		log.Fatalf("Failed to configure backup store: %v", err)
+	}
+	backupManager := backup.NewManager(userRepo, backupStore)
+	if interval := os.Getenv("BACKUP_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid BACKUP_INTERVAL: %v", err)
+		}
+		go backupManager.RunSchedule(context.Background(), d)
+	}
+	backupHandler := &handler.BackupHandler{Manager: backupManager}
+
+	// Initialize reindexing, checkpointed to REINDEX_CHECKPOINT
+	checkpointPath := os.Getenv("REINDEX_CHECKPOINT")
+	if checkpointPath == "" {
+		checkpointPath = "./reindex-checkpoint.json"
+	}
+	reindexHandler := &handler.ReindexHandler{
+		Reindexer: reindex.NewReindexer(userRepo, &reindex.FileCheckpoint{Path: checkpointPath}),
+	}
+
+	// Initialize tenants, resolved from TENANT_HEADER or TENANT_BASE_DOMAIN
+	tenantHandler := &handler.TenantHandler{Repo: repository.NewTenantRepository(bucket)}
+
+	// Load the fixtures of --seed before serving; users already matching
+	// them are left alone, so the flag can stay set across restarts
+	seedLoader := &seed.Loader{Users: userRepo, Tenants: tenantHandler.Repo}
+	if *seedFile != "" {
+		if err := seedFixtures(seedLoader, *seedFile); err != nil {
+			log.Fatalf("Failed to seed %s: %v", *seedFile, err)
+		}
+	}
+
+	// Initialize avatars, stored in AVATAR_STORE
+	avatarStore, err := newAvatarStore()
+	if err != nil {
+		log.Fatalf("Failed to configure avatar store: %v", err)
+	}
+	avatarHandler := &handler.AvatarHandler{
+		Repo:     userRepo,
+		Store:    avatarStore,
+		MaxBytes: 5 << 20,
+		URLTTL:   15 * time.Minute,
+	}
+	if v := os.Getenv("AVATAR_MAX_BYTES"); v != "" {
+		avatarHandler.MaxBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || avatarHandler.MaxBytes <= 0 {
+			log.Fatalf("Invalid AVATAR_MAX_BYTES: %q", v)
+		}
+	}
+	if v := os.Getenv("AVATAR_URL_TTL"); v != "" {
+		avatarHandler.URLTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid AVATAR_URL_TTL: %v", err)
+		}
+	}
+
+	// Bound every request by REQUEST_TIMEOUT so slow Couchbase calls fail
+	// with 504 instead of hanging; 0 disables the deadline.
+	requestTimeout := 5 * time.Second
+	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
+		requestTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid REQUEST_TIMEOUT: %v", err)
+		}
+	}
+
+	// Let browser apps on CORS_ALLOWED_ORIGINS call the API directly,
+	// sending the tenant header when TENANT_HEADER renames it, and the
+	// durability and API key headers, and reading their quota
+	tenantConfig := tenant.ConfigFromEnv()
+	quotaConfig, err := quota.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid quota config: %v", err)
+	}
+	corsConfig, err := middleware.CORSConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid CORS config: %v", err)
+	}
+	if os.Getenv("CORS_ALLOWED_HEADERS") == "" {
+		if tenantConfig.Header != "" {
+			corsConfig.AllowedHeaders = append(corsConfig.AllowedHeaders, tenantConfig.Header)
+		}
+		corsConfig.AllowedHeaders = append(corsConfig.AllowedHeaders, durabilityConfig.Header, quotaConfig.HeaderName())
+	}
+	if os.Getenv("CORS_EXPOSED_HEADERS") == "" {
+		corsConfig.ExposedHeaders = append(corsConfig.ExposedHeaders,
+			quota.HeaderLimit, quota.HeaderRemaining, quota.HeaderReset, "Retry-After")
+	}
+
+	// Log users in with their passwords, for sessions lasting SESSION_TTL;
+	// LOGIN_MAX_FAILURES wrong passwords block the user or client address
+	// for LOGIN_LOCKOUT
+	sessionTTL, lockout, maxFailures := 24*time.Hour, 15*time.Minute, 5
+	if v := os.Getenv("SESSION_TTL"); v != "" {
+		sessionTTL, err = time.ParseDuration(v)
+		if err != nil || sessionTTL <= 0 {
+			log.Fatalf("Invalid SESSION_TTL: %q", v)
+		}
+	}
+	if v := os.Getenv("LOGIN_LOCKOUT"); v != "" {
+		lockout, err = time.ParseDuration(v)
+		if err != nil || lockout <= 0 {
+			log.Fatalf("Invalid LOGIN_LOCKOUT: %q", v)
+		}
+	}
+	if v := os.Getenv("LOGIN_MAX_FAILURES"); v != "" {
+		maxFailures, err = strconv.Atoi(v)
+		if err != nil || maxFailures <= 0 {
+			log.Fatalf("Invalid LOGIN_MAX_FAILURES: %q", v)
+		}
+	}
+	authConfig.Sessions = auth.NewSessionStore(sessionTTL)
+	credentialsHandler := &handler.CredentialsHandler{
+		Repo:     userRepo,
+		Sessions: authConfig.Sessions,
+		Limiter:  auth.NewLimiter(maxFailures, lockout),
+	}
+
+	// Limit each API key, sent in QUOTA_HEADER, to its daily quota, or
+	// QUOTA_DEFAULT_DAILY requests for keys without one
+	quotaStore, err := newQuotaStore(bucket)
+	if err != nil {
+		log.Fatalf("Failed to configure quotas: %v", err)
+	}
+	quotaHandler := &handler.QuotaHandler{Store: quotaStore, Config: quotaConfig}
 
-	userHandler := &handler.UserHandler{Repo: userRepo}
+	// Serve stats and the effective configuration to admins
+	adminHandler := &handler.AdminHandler{
+		Users:    userRepo,
+		Tenants:  tenantHandler.Repo,
+		Requests: middleware.NewRequestStats(),
+		Shadow:   shadowStats,
+		Config: gin.H{
+			"couchbase": gin.H{"connection_string": connStr, "username": username, "bucket": bucketName},
+			"auth": gin.H{
+				"required":    authConfig.Required,
+				"roles":       tokenCounts(authConfig),
+				"session_ttl": sessionTTL.String(),
+				"login":       gin.H{"max_failures": maxFailures, "lockout": lockout.String()},
+			},
+			"tenant": gin.H{
+				"header":      envOr("TENANT_HEADER", tenant.DefaultHeader),
+				"base_domain": tenantConfig.BaseDomain,
+				"required":    tenantConfig.Required,
+			},
+			"cors": gin.H{
+				"allowed_origins":   corsConfig.AllowedOrigins,
+				"allowed_methods":   corsConfig.AllowedMethods,
+				"allowed_headers":   corsConfig.AllowedHeaders,
+				"exposed_headers":   corsConfig.ExposedHeaders,
+				"allow_credentials": corsConfig.AllowCredentials,
+				"max_age":           corsConfig.MaxAge.String(),
+			},
+			"outbox": gin.H{
+				"brokers":       os.Getenv("OUTBOX_KAFKA_BROKERS"),
+				"topic":         envOr("OUTBOX_KAFKA_TOPIC", "user-changes"),
+				"poll_interval": envOr("OUTBOX_POLL_INTERVAL", "1s"),
+			},
+			"backup":  gin.H{"store": storeConfig("BACKUP", "./backups"), "interval": os.Getenv("BACKUP_INTERVAL")},
+			"reindex": gin.H{"checkpoint": checkpointPath},
+			"avatar": gin.H{
+				"store":     storeConfig("AVATAR", "./avatars"),
+				"max_bytes": avatarHandler.MaxBytes,
+				"url_ttl":   avatarHandler.URLTTL.String(),
+			},
+			"quota": gin.H{
+				"header":        quotaConfig.HeaderName(),
+				"default_daily": quotaConfig.Default,
+				"required":      quotaConfig.Required,
+			},
+			"seed": gin.H{
+				"file":     *seedFile,
+				"endpoint": router.DevBuild,
+			},
+			"durability":      durabilityConfig,
+			"shadow_reads":    shadowConfig,
+			"request_timeout": requestTimeout.String(),
+		},
+	}
 
 	// Setup router
-	r := router.SetupRouter(userHandler)
+	r := router.SetupRouter(router.Deps{
+		User:             userHandler,
+		BulkDelete:       bulkDeleteHandler,
+		Backup:           backupHandler,
+		Reindex:          reindexHandler,
+		Tenant:           tenantHandler,
+		Avatar:           avatarHandler,
+		Admin:            adminHandler,
+		Credentials:      credentialsHandler,
+		Quota:            quotaHandler,
+		Seed:             &handler.SeedHandler{Loader: seedLoader},
+		TenantConfig:     tenantConfig,
+		AuthConfig:       authConfig,
+		CORSConfig:       corsConfig,
+		DurabilityConfig: durabilityConfig,
+		RequestTimeout:   requestTimeout,
+	})
 
 	// Initialize Swagger docs
 	docs.SwaggerInfo.Title = "Gin Couchbase API"
@@ -57,3 +307,190 @@ func main() {
 		log.Fatalf("Failed to run server: %v", err)
 	}
 }
+
+// newOutboxRelay provisions the outbox collection and returns a relay
+// publishing it to OUTBOX_KAFKA_TOPIC (default "user-changes") every
+// OUTBOX_POLL_INTERVAL (default 1s).
+func newOutboxRelay(bucket *gocb.Bucket, brokers []string) (*outbox.Relay, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := repository.ProvisionOutbox(ctx, bucket); err != nil {
+		return nil, err
+	}
+	relay := &outbox.Relay{
+		Store:     repository.NewOutboxStore(bucket),
+		Publisher: outbox.NewKafkaPublisher(brokers, envOr("OUTBOX_KAFKA_TOPIC", "user-changes")),
+	}
+	if v := os.Getenv("OUTBOX_POLL_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OUTBOX_POLL_INTERVAL: %w", err)
+		}
+		relay.Interval = interval
+	}
+	return relay, nil
+}
+
+// seedFixtures loads the fixtures file at path with loader.
+func seedFixtures(loader *seed.Loader, path string) error {
+	fixtures, err := seed.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	res, err := loader.Load(ctx, fixtures)
+	if err != nil {
+		return err
+	}
+	log.Printf("Seeded %s: %d created, %d updated, %d unchanged, %d tenants provisioned",
+		path, res.Created, res.Updated, res.Unchanged, res.TenantsProvisioned)
+	return nil
+}
+
+// newQuotaStore provisions the quota collection and returns a store on it.
+func newQuotaStore(bucket *gocb.Bucket) (quota.Store, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := repository.ProvisionQuotas(ctx, bucket); err != nil {
+		return nil, err
+	}
+	return repository.NewQuotaStore(bucket), nil
+}
+
+// withShadowReads wraps *repo with shadow reads against the users bucket
+// SHADOW_COUCHBASE_BUCKET (default "users") of the cluster at
+// SHADOW_COUCHBASE_URL, signing in with SHADOW_COUCHBASE_USERNAME and
+// SHADOW_COUCHBASE_PASSWORD. SHADOW_READ_SAMPLE_RATE repeats only a share
+// of the reads and SHADOW_READ_TIMEOUT bounds each. Without
+// SHADOW_COUCHBASE_URL it returns nil stats and leaves *repo alone.
+func withShadowReads(repo *repository.UserRepository) (*repository.ShadowStats, gin.H, error) {
+	connStr := os.Getenv("SHADOW_COUCHBASE_URL")
+	if connStr == "" {
+		return nil, gin.H{"enabled": false}, nil
+	}
+	var cfg repository.ShadowConfig
+	var err error
+	if v := os.Getenv("SHADOW_READ_SAMPLE_RATE"); v != "" {
+		cfg.SampleRate, err = strconv.ParseFloat(v, 64)
+		if err != nil || cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+			return nil, nil, fmt.Errorf("invalid SHADOW_READ_SAMPLE_RATE %q: must be above 0 and at most 1", v)
+		}
+	}
+	if v := os.Getenv("SHADOW_READ_TIMEOUT"); v != "" {
+		cfg.Timeout, err = time.ParseDuration(v)
+		if err != nil || cfg.Timeout <= 0 {
+			return nil, nil, fmt.Errorf("invalid SHADOW_READ_TIMEOUT %q", v)
+		}
+	}
+	cluster, err := gocb.Connect(connStr, gocb.ClusterOptions{
+		Username: os.Getenv("SHADOW_COUCHBASE_USERNAME"),
+		Password: os.Getenv("SHADOW_COUCHBASE_PASSWORD"),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	bucketName := envOr("SHADOW_COUCHBASE_BUCKET", "users")
+	bucket := cluster.Bucket(bucketName)
+	if err := bucket.WaitUntilReady(10*time.Second, nil); err != nil {
+		return nil, nil, fmt.Errorf("shadow bucket not ready: %w", err)
+	}
+	stats := repository.NewShadowStats()
+	*repo = repository.WithShadowReads(*repo, repository.NewUserRepository(bucket, durability.Config{}), stats, cfg)
+	return stats, gin.H{
+		"enabled":           true,
+		"connection_string": connStr,
+		"username":          os.Getenv("SHADOW_COUCHBASE_USERNAME"),
+		"bucket":            bucketName,
+		"sample_rate":       envOr("SHADOW_READ_SAMPLE_RATE", "1"),
+		"timeout":           envOr("SHADOW_READ_TIMEOUT", "2s"),
+	}, nil
+}
+
+// newBackupStore selects the backup object store from BACKUP_STORE
+// ("file", the default, or "s3" for S3 and GCS interoperability endpoints).
+func newBackupStore() (backup.ObjectStore, error) {
+	switch os.Getenv("BACKUP_STORE") {
+	case "", "file":
+		return &backup.FileStore{Dir: envOr("BACKUP_DIR", "./backups")}, nil
+	case "s3":
+		return backup.NewS3Store(backup.S3Config{
+			Endpoint:  os.Getenv("BACKUP_S3_ENDPOINT"),
+			Bucket:    os.Getenv("BACKUP_S3_BUCKET"),
+			AccessKey: os.Getenv("BACKUP_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("BACKUP_S3_SECRET_KEY"),
+			UseSSL:    os.Getenv("BACKUP_S3_INSECURE") != "true",
+		})
+	default:
+		return nil, fmt.Errorf("unknown BACKUP_STORE %q", os.Getenv("BACKUP_STORE"))
+	}
+}
+
+// tokenCounts returns the number of tokens configured for each role,
+// keeping the tokens themselves out of the admin config.
+func tokenCounts(cfg auth.Config) map[string]int {
+	counts := make(map[string]int)
+	for _, role := range cfg.Tokens {
+		counts[role]++
+	}
+	return counts
+}
+
+// envOr returns the environment variable name, or def if it is unset.
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// storeConfig describes the object store configured by the prefix_STORE
+// variables, as newBackupStore and newAvatarStore read them, leaving out
+// keys. File stores default to dir.
+func storeConfig(prefix, dir string) gin.H {
+	kind := os.Getenv(prefix + "_STORE")
+	if kind == "s3" {
+		return gin.H{
+			"type":     kind,
+			"endpoint": os.Getenv(prefix + "_S3_ENDPOINT"),
+			"bucket":   os.Getenv(prefix + "_S3_BUCKET"),
+			"insecure": os.Getenv(prefix+"_S3_INSECURE") == "true",
+		}
+	}
+	if kind == "" {
+		kind = "file"
+	}
+	store := gin.H{"type": kind, "dir": envOr(prefix+"_DIR", dir)}
+	if prefix == "AVATAR" {
+		store["base_url"] = envOr("AVATAR_BASE_URL", "http://localhost:8080")
+		store["signing_key_set"] = os.Getenv("AVATAR_SIGNING_KEY") != ""
+	}
+	return store
+}
+
+// newAvatarStore selects the avatar object store from AVATAR_STORE ("file",
+// the default, served by this API, or "s3").
+func newAvatarStore() (avatar.Store, error) {
+	switch os.Getenv("AVATAR_STORE") {
+	case "", "file":
+		// Without a configured key, signed URLs stop working on restart.
+		key := []byte(os.Getenv("AVATAR_SIGNING_KEY"))
+		if len(key) == 0 {
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, err
+			}
+		}
+		return &avatar.FileStore{Dir: envOr("AVATAR_DIR", "./avatars"), BaseURL: envOr("AVATAR_BASE_URL", "http://localhost:8080"), SigningKey: key}, nil
+	case "s3":
+		return avatar.NewS3Store(avatar.S3Config{
+			Endpoint:  os.Getenv("AVATAR_S3_ENDPOINT"),
+			Bucket:    os.Getenv("AVATAR_S3_BUCKET"),
+			AccessKey: os.Getenv("AVATAR_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("AVATAR_S3_SECRET_KEY"),
+			UseSSL:    os.Getenv("AVATAR_S3_INSECURE") != "true",
+		})
+	default:
+		return nil, fmt.Errorf("unknown AVATAR_STORE %q", os.Getenv("AVATAR_STORE"))
+	}
+}
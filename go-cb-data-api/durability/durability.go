@@ -0,0 +1,181 @@
+// Package durability chooses how durable each Couchbase write must be
+// before it is acknowledged. Levels are configured per operation, and a
+// request may raise the level of its own writes with a header, so critical
+// writes can wait for replication or persistence that routine ones skip.
+package durability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultHeader is the request header a level is read from by default.
+const DefaultHeader = "X-Durability"
+
+// Level is a durability requirement. Levels are ordered from weakest to
+// strongest.
+type Level uint8
+
+const (
+	// LevelDefault leaves durability to the bucket's minimum durability
+	// level, if any.
+	LevelDefault Level = iota
+	// LevelMajority waits until a majority of replicas hold the write in
+	// memory.
+	LevelMajority
+	// LevelMajorityAndPersistActive also waits until the active node has
+	// persisted the write.
+	LevelMajorityAndPersistActive
+	// LevelPersistToMajority waits until a majority of replicas have
+	// persisted the write.
+	LevelPersistToMajority
+)
+
+var levelNames = []string{"default", "majority", "majority_and_persist_active", "persist_to_majority"}
+
+// ErrInvalidLevel is returned when parsing an unknown level.
+var ErrInvalidLevel = errors.New("durability must be one of " + strings.Join(levelNames, ", "))
+
+// ErrUnavailable is wrapped by write errors when the cluster cannot meet
+// the requested level, e.g. because too few replicas are up.
+var ErrUnavailable = errors.New("requested durability cannot be met")
+
+// String returns the name of l, as ParseLevel accepts it.
+func (l Level) String() string {
+	if int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("Level(%d)", l)
+}
+
+// MarshalText encodes l by name, for the admin config endpoint.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// ParseLevel parses a level name, ignoring case and surrounding space.
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range levelNames {
+		if s == name {
+			return Level(i), nil
+		}
+	}
+	return LevelDefault, fmt.Errorf("%w, got %q", ErrInvalidLevel, s)
+}
+
+// Op is a kind of write.
+type Op string
+
+// Writes the repository makes.
+const (
+	OpInsert Op = "insert"
+	OpUpsert Op = "upsert"
+	// OpUpdate covers partial updates, such as setting an avatar or a
+	// password.
+	OpUpdate Op = "update"
+	OpDelete Op = "delete"
+)
+
+// Ops lists every kind of write.
+var Ops = []Op{OpInsert, OpUpsert, OpUpdate, OpDelete}
+
+// Config sets the level of each kind of write.
+type Config struct {
+	// Default applies to operations without a level in Ops.
+	Default Level `json:"default"`
+	// Ops overrides Default per operation.
+	Ops map[Op]Level `json:"ops,omitempty"`
+	// Header is the request header holding a level. Empty means
+	// DefaultHeader.
+	Header string `json:"header"`
+}
+
+// ConfigFromEnv reads the default level from COUCHBASE_DURABILITY, the
+// level of each operation from COUCHBASE_DURABILITY_INSERT, _UPSERT,
+// _UPDATE and _DELETE, and the header from DURABILITY_HEADER.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Header: os.Getenv("DURABILITY_HEADER")}
+	if v := os.Getenv("COUCHBASE_DURABILITY"); v != "" {
+		level, err := ParseLevel(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid COUCHBASE_DURABILITY: %w", err)
+		}
+		cfg.Default = level
+	}
+	for _, op := range Ops {
+		name := "COUCHBASE_DURABILITY_" + strings.ToUpper(string(op))
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		level, err := ParseLevel(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		if cfg.Ops == nil {
+			cfg.Ops = make(map[Op]Level)
+		}
+		cfg.Ops[op] = level
+	}
+	if cfg.Header == "" {
+		cfg.Header = DefaultHeader
+	}
+	return cfg, nil
+}
+
+// Level returns the level of op for a request carrying ctx: the configured
+// one, raised to the level the request asked for. Requests cannot lower it.
+func (c Config) Level(ctx context.Context, op Op) Level {
+	level, ok := c.Ops[op]
+	if !ok {
+		level = c.Default
+	}
+	if requested, ok := FromContext(ctx); ok {
+		level = max(level, requested)
+	}
+	return level
+}
+
+type contextKey struct{}
+
+// WithLevel returns a copy of ctx asking for writes of at least level.
+func WithLevel(ctx context.Context, level Level) context.Context {
+	return context.WithValue(ctx, contextKey{}, level)
+}
+
+// FromContext returns the level ctx asks for, if any.
+func FromContext(ctx context.Context) (Level, bool) {
+	level, ok := ctx.Value(contextKey{}).(Level)
+	return level, ok
+}
+
+// Middleware stores the level named by the request's cfg.Header in the
+// request context. Unknown levels are rejected with a 400 rather than
+// silently written with less durability than asked for.
+func Middleware(cfg Config) gin.HandlerFunc {
+	header := cfg.Header
+	if header == "" {
+		header = DefaultHeader
+	}
+	return func(c *gin.Context) {
+		v := c.GetHeader(header)
+		if v == "" {
+			c.Next()
+			return
+		}
+		level, err := ParseLevel(v)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request = c.Request.WithContext(WithLevel(c.Request.Context(), level))
+		c.Next()
+	}
+}
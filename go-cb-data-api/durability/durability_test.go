@@ -0,0 +1,106 @@
+package durability_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/durability"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConfigFromEnv checks per-operation levels override the default and
+// invalid levels are rejected.
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("COUCHBASE_DURABILITY", "majority")
+	t.Setenv("COUCHBASE_DURABILITY_DELETE", " Persist_To_Majority ")
+	cfg, err := durability.ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, durability.DefaultHeader, cfg.Header)
+
+	ctx := context.Background()
+	assert.Equal(t, durability.LevelMajority, cfg.Level(ctx, durability.OpInsert))
+	assert.Equal(t, durability.LevelPersistToMajority, cfg.Level(ctx, durability.OpDelete))
+
+	t.Setenv("COUCHBASE_DURABILITY_UPSERT", "always")
+	_, err = durability.ConfigFromEnv()
+	assert.ErrorIs(t, err, durability.ErrInvalidLevel)
+}
+
+// TestLevel checks requests can raise the configured level but not lower
+// it.
+func TestLevel(t *testing.T) {
+	cfg := durability.Config{
+		Default: durability.LevelMajority,
+		Ops:     map[durability.Op]durability.Level{durability.OpUpdate: durability.LevelDefault},
+	}
+
+	testCases := []struct {
+		name      string
+		op        durability.Op
+		requested *durability.Level
+		expected  durability.Level
+	}{
+		{name: "Default", op: durability.OpInsert, expected: durability.LevelMajority},
+		{name: "Per Operation", op: durability.OpUpdate, expected: durability.LevelDefault},
+		{name: "Raised", op: durability.OpUpdate, requested: levelPtr(durability.LevelPersistToMajority), expected: durability.LevelPersistToMajority},
+		{name: "Not Lowered", op: durability.OpInsert, requested: levelPtr(durability.LevelDefault), expected: durability.LevelMajority},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.requested != nil {
+				ctx = durability.WithLevel(ctx, *tc.requested)
+			}
+			assert.Equal(t, tc.expected, cfg.Level(ctx, tc.op))
+		})
+	}
+}
+
+// TestMiddleware checks the header's level reaches the handler and unknown
+// levels are rejected.
+func TestMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(durability.Middleware(durability.Config{}))
+	router.POST("/users/:id/password", func(c *gin.Context) {
+		level, ok := durability.FromContext(c.Request.Context())
+		if !ok {
+			c.String(http.StatusOK, "none")
+			return
+		}
+		c.String(http.StatusOK, level.String())
+	})
+
+	testCases := []struct {
+		name           string
+		header         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "No Header", expectedStatus: http.StatusOK, expectedBody: "none"},
+		{name: "Level", header: "majority_and_persist_active", expectedStatus: http.StatusOK, expectedBody: "majority_and_persist_active"},
+		{name: "Unknown Level", header: "eventually", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users/1/password", nil)
+			if tc.header != "" {
+				req.Header.Set(durability.DefaultHeader, tc.header)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func levelPtr(l durability.Level) *durability.Level { return &l }
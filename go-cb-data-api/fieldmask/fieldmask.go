@@ -0,0 +1,154 @@
+// Package fieldmask hides sensitive fields from responses depending on the
+// caller's role. Fields opt in with a struct tag listing the roles that
+// may see them:
+//
+//	Email string `json:"email" visible:"admin,support"`
+//
+// Fields without the tag are visible to everyone, so a new PII field is
+// protected by tagging it and nothing else.
+package fieldmask
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Tag is the struct tag listing the roles allowed to see a field.
+const Tag = "visible"
+
+// Visible reports whether role may see the field of struct type t whose
+// JSON name is name. Unknown names are visible; there is nothing to hide.
+func Visible(t reflect.Type, name, role string) bool {
+	visible, _ := lookup(t, name, role)
+	return visible
+}
+
+// lookup is Visible that also reports whether t has the field, looking
+// into embedded structs the way encoding/json flattens them.
+func lookup(t reflect.Type, name, role string) (visible, found bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return true, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			if visible, found := lookup(f.Type, name, role); found {
+				return visible && allowed(f, role), true
+			}
+			continue
+		}
+		if n, _, ok := jsonName(f); ok && n == name {
+			return allowed(f, role), true
+		}
+	}
+	return true, false
+}
+
+// Apply returns v ready to be serialized to JSON for role. Structs become
+// maps without the fields role may not see, also in nested structs, maps
+// and slices; other values are returned as they are. Types with their own
+// MarshalJSON, such as time.Time, are left to it.
+func Apply(v any, role string) any {
+	if v == nil {
+		return nil
+	}
+	return apply(reflect.ValueOf(v), role)
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func apply(v reflect.Value, role string) any {
+	if v.Type().Implements(marshalerType) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return apply(v.Elem(), role)
+	case reflect.Struct:
+		out := make(map[string]any)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, omitEmpty, ok := jsonName(f)
+			if !ok || !allowed(f, role) {
+				continue
+			}
+			fv := v.Field(i)
+			if omitEmpty && fv.IsZero() {
+				continue
+			}
+			// Untagged embedded structs are flattened, as encoding/json does.
+			if f.Anonymous && f.Tag.Get("json") == "" {
+				if fields, ok := apply(fv, role).(map[string]any); ok {
+					for k, fieldValue := range fields {
+						out[k] = fieldValue
+					}
+					continue
+				}
+			}
+			out[name] = apply(fv, role)
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface() // []byte is base64, not a list
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = apply(v.Index(i), role)
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[iter.Key().String()] = apply(iter.Value(), role)
+		}
+		return out
+	}
+	return v.Interface()
+}
+
+// jsonName returns the JSON name of an exported field and whether it has
+// omitempty; ok is false for fields encoding/json skips.
+func jsonName(f reflect.StructField) (name string, omitEmpty, ok bool) {
+	if !f.IsExported() {
+		return "", false, false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, slices.Contains(strings.Split(opts, ","), "omitempty"), true
+}
+
+func allowed(f reflect.StructField, role string) bool {
+	roles, tagged := f.Tag.Lookup(Tag)
+	if !tagged {
+		return true
+	}
+	for _, r := range strings.Split(roles, ",") {
+		if r = strings.TrimSpace(r); r != "" && r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package fieldmask_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/fieldmask"
+	"github.com/stretchr/testify/assert"
+)
+
+type contact struct {
+	Phone string `json:"phone" visible:"admin"`
+	City  string `json:"city"`
+}
+
+type Audit struct {
+	UpdatedBy string `json:"updated_by" visible:"admin, support"`
+}
+
+type profile struct {
+	Audit
+	ID        string            `json:"id"`
+	Email     string            `json:"email" visible:"admin,support"`
+	Nickname  string            `json:"nickname,omitempty"`
+	Contacts  []contact         `json:"contacts"`
+	Primary   *contact          `json:"primary,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	Internal  string            `json:"-"`
+	secret    string
+}
+
+// TestApply checks masked fields are dropped at every depth while the
+// rest serializes as encoding/json would.
+func TestApply(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	p := &profile{
+		Audit:     Audit{UpdatedBy: "ops"},
+		ID:        "u1",
+		Email:     "a@example.com",
+		Contacts:  []contact{{Phone: "555", City: "Oslo"}},
+		Primary:   &contact{Phone: "555", City: "Oslo"},
+		CreatedAt: created,
+		Internal:  "x",
+		secret:    "y",
+	}
+
+	testCases := []struct {
+		role     string
+		expected string
+	}{
+		{role: "admin", expected: `{"updated_by":"ops","id":"u1","email":"a@example.com",
+			"contacts":[{"phone":"555","city":"Oslo"}],"primary":{"phone":"555","city":"Oslo"},"created_at":"2024-05-01T12:00:00Z"}`},
+		{role: "support", expected: `{"updated_by":"ops","id":"u1","email":"a@example.com",
+			"contacts":[{"city":"Oslo"}],"primary":{"city":"Oslo"},"created_at":"2024-05-01T12:00:00Z"}`},
+		{role: "", expected: `{"id":"u1","contacts":[{"city":"Oslo"}],"primary":{"city":"Oslo"},"created_at":"2024-05-01T12:00:00Z"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run("role="+tc.role, func(t *testing.T) {
+			out, err := json.Marshal(fieldmask.Apply(p, tc.role))
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(out))
+		})
+	}
+}
+
+// TestVisible checks lookups by JSON name, used for field projections.
+func TestVisible(t *testing.T) {
+	typ := reflect.TypeOf(&profile{})
+	assert.True(t, fieldmask.Visible(typ, "email", "support"))
+	assert.False(t, fieldmask.Visible(typ, "email", "guest"))
+	assert.True(t, fieldmask.Visible(typ, "id", "guest"))
+	assert.False(t, fieldmask.Visible(typ, "updated_by", "guest"))
+	assert.True(t, fieldmask.Visible(typ, "updated_by", "support"))
+	assert.True(t, fieldmask.Visible(typ, "unknown", "guest"))
+}
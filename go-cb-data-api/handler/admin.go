@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/middleware"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+)
+
+// AdminHandler exposes operational stats and configuration to admins.
+type AdminHandler struct {
+	Users   repository.UserRepository
+	Tenants repository.TenantRepository
+	// Requests, if set, counts the requests served by this process.
+	Requests *middleware.RequestStats
+	// Shadow, if set, counts the comparisons of shadow reads.
+	Shadow *repository.ShadowStats
+	// Config is the effective configuration, with secrets left out.
+	Config any
+}
+
+// AdminStats aggregates users and requests.
+type AdminStats struct {
+	// Users counts the users outside any tenant, and Tenants those of
+	// each tenant.
+	Users    UserStats                   `json:"users"`
+	Tenants  map[string]UserStats        `json:"tenants"`
+	Requests *middleware.RequestSnapshot `json:"requests,omitempty"`
+	// ShadowReads compares reads with the backend being migrated to, if
+	// one is configured.
+	ShadowReads *repository.ShadowSnapshot `json:"shadow_reads,omitempty"`
+}
+
+// UserStats counts users and recent signups. Users stored before
+// creation times were recorded count only towards Total.
+type UserStats struct {
+	Total           int `json:"total"`
+	SignupsLastDay  int `json:"signups_last_day"`
+	SignupsLastWeek int `json:"signups_last_week"`
+}
+
+// Stats godoc
+// @Summary Get operational stats
+// @Description User counts and recent signups, overall and per tenant, and the request rates and ETag revalidation hit rate of this instance, and how its shadow reads compared
+// @Tags admin
+// @Produce json
+// @Success 200 {object} AdminStats
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /admin/stats [get]
+func (h *AdminHandler) Stats(c *gin.Context) {
+	ctx := c.Request.Context()
+	now := time.Now()
+	var stats AdminStats
+	var err error
+	if stats.Users, err = h.userStats(ctx, now); err != nil {
+		writeServerError(c, err)
+		return
+	}
+
+	ids, err := h.Tenants.ListTenants(ctx)
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+	stats.Tenants = make(map[string]UserStats, len(ids))
+	for _, id := range ids {
+		if stats.Tenants[id], err = h.userStats(tenant.WithID(ctx, id), now); err != nil {
+			writeServerError(c, err)
+			return
+		}
+	}
+
+	if h.Requests != nil {
+		snap := h.Requests.Snapshot()
+		stats.Requests = &snap
+	}
+	if h.Shadow != nil {
+		snap := h.Shadow.Snapshot()
+		stats.ShadowReads = &snap
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// userStats counts the users of the tenant in ctx.
+func (h *AdminHandler) userStats(ctx context.Context, now time.Time) (UserStats, error) {
+	var stats UserStats
+	var err error
+	if stats.Total, err = h.Users.CountUsers(ctx); err != nil {
+		return UserStats{}, err
+	}
+	if stats.SignupsLastDay, err = h.Users.CountUsersCreatedSince(ctx, now.Add(-24*time.Hour)); err != nil {
+		return UserStats{}, err
+	}
+	if stats.SignupsLastWeek, err = h.Users.CountUsersCreatedSince(ctx, now.Add(-7*24*time.Hour)); err != nil {
+		return UserStats{}, err
+	}
+	return stats, nil
+}
+
+// GetConfig godoc
+// @Summary Get the effective configuration
+// @Description Settings in effect, after defaults, with passwords, keys and tokens left out
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /admin/config [get]
+func (h *AdminHandler) GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Config)
+}
@@ -0,0 +1,99 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/handler"
+	"github.com/gnsalok/go-project-root/go-db-data-api/middleware"
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository/mocks"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAdminStats tests user counts overall and per tenant, with users
+// stored before creation times were recorded counting only in the total.
+func TestAdminStats(t *testing.T) {
+	repo := repository.NewMemoryUserRepository()
+	ctx := context.Background()
+	lastWeek := time.Now().Add(-3 * 24 * time.Hour)
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "user1"}))
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "user2", CreatedAt: &lastWeek}))
+	require.NoError(t, repo.UpsertUser(ctx, &model.User{ID: "legacy"}))
+	require.NoError(t, repo.InsertUser(tenant.WithID(ctx, "acme"), &model.User{ID: "user1"}))
+
+	tenants := mocks.NewTenantRepository(t)
+	tenants.On("ListTenants", mock.Anything).Return([]string{"acme", "globex"}, nil)
+
+	adminHandler := &handler.AdminHandler{Users: repo, Tenants: tenants, Requests: middleware.NewRequestStats()}
+	router := gin.Default()
+	router.Use(adminHandler.Requests.Middleware())
+	router.GET("/admin/stats", adminHandler.Stats)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/stats", nil))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/stats", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var stats handler.AdminStats
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	assert.Equal(t, handler.UserStats{Total: 3, SignupsLastDay: 1, SignupsLastWeek: 2}, stats.Users)
+	assert.Equal(t, map[string]handler.UserStats{
+		"acme":   {Total: 1, SignupsLastDay: 1, SignupsLastWeek: 1},
+		"globex": {},
+	}, stats.Tenants)
+	require.NotNil(t, stats.Requests)
+	assert.Equal(t, uint64(1), stats.Requests.Total, "requests served before this one")
+}
+
+// TestAdminStatsErrors tests repository errors become 500s, or 504s once
+// the request deadline passes.
+func TestAdminStatsErrors(t *testing.T) {
+	testCases := []struct {
+		name         string
+		err          error
+		expectedCode int
+	}{
+		{name: "Database Error", err: errors.New("database error"), expectedCode: http.StatusInternalServerError},
+		{name: "Timeout", err: context.DeadlineExceeded, expectedCode: http.StatusGatewayTimeout},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			users := mocks.NewUserRepository(t)
+			users.On("CountUsers", mock.Anything).Return(0, tc.err)
+
+			adminHandler := &handler.AdminHandler{Users: users, Tenants: mocks.NewTenantRepository(t)}
+			router := gin.Default()
+			router.GET("/admin/stats", adminHandler.Stats)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/stats", nil))
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+		})
+	}
+}
+
+// TestAdminConfig tests the configuration is served as given.
+func TestAdminConfig(t *testing.T) {
+	adminHandler := &handler.AdminHandler{Config: gin.H{"request_timeout": "5s"}}
+	router := gin.Default()
+	router.GET("/admin/config", adminHandler.GetConfig)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/config", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"request_timeout":"5s"}`, rr.Body.String())
+}
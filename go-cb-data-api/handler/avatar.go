@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/gnsalok/go-project-root/go-db-data-api/avatar"
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+)
+
+// avatarTypes maps the accepted image types to their file extensions.
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// AvatarHandler handles uploading and downloading user avatars.
+type AvatarHandler struct {
+	Repo  repository.UserRepository
+	Store avatar.Store
+	// MaxBytes caps the size of an uploaded image.
+	MaxBytes int64
+	// URLTTL is how long signed download URLs stay valid.
+	URLTTL time.Duration
+}
+
+// AvatarResponse is an avatar with a signed download URL.
+type AvatarResponse struct {
+	model.Avatar
+	DownloadURL string    `json:"download_url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Upload godoc
+// @Summary Upload a user's avatar
+// @Description Store a PNG, JPEG, GIF or WebP image in object storage and record it on the user. Admins may replace any user's avatar, users their own.
+// @Tags users
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "User ID"
+// @Param avatar formData file true "Avatar image"
+// @Param Authorization header string true "Bearer token of an admin or of the user's session"
+// @Success 200 {object} AvatarResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id}/avatar [post]
+func (h *AvatarHandler) Upload(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	if auth.RoleFromContext(ctx) != "admin" {
+		tenantID, _ := tenant.FromContext(ctx)
+		if !authorizeSelf(c, id, tenantID) {
+			return
+		}
+	}
+
+	// Leave room for the multipart framing around the file.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.MaxBytes+64<<10)
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar file is required"})
+		return
+	}
+	if header.Size > h.MaxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar is too large"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+	defer file.Close()
+
+	// Trust the content, not the client's Content-Type header.
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		writeServerError(c, err)
+		return
+	}
+	contentType := http.DetectContentType(sniff[:n])
+	ext, ok := avatarTypes[contentType]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Avatar must be a PNG, JPEG, GIF or WebP image"})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		writeServerError(c, err)
+		return
+	}
+
+	user, err := h.Repo.GetUserByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		writeServerError(c, err)
+		return
+	}
+
+	// Every upload gets a new key, so cached signed URLs never serve a
+	// mix of old and new images.
+	key := avatarKey(ctx, id, ext)
+	if err := h.Store.Put(ctx, key, file, header.Size, contentType); err != nil {
+		writeServerError(c, err)
+		return
+	}
+	a := &model.Avatar{
+		Key:         key,
+		URL:         h.Store.URL(key),
+		ContentType: contentType,
+		Size:        header.Size,
+		UpdatedAt:   time.Now().UTC(),
+	}
+	if err := h.Repo.SetUserAvatar(ctx, id, a); err != nil {
+		if delErr := h.Store.Delete(ctx, key); delErr != nil {
+			log.Printf("avatar: delete orphaned %s: %v", key, delErr)
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		writeServerError(c, err)
+		return
+	}
+	if user.Avatar != nil {
+		if err := h.Store.Delete(ctx, user.Avatar.Key); err != nil {
+			log.Printf("avatar: delete replaced %s: %v", user.Avatar.Key, err)
+		}
+	}
+
+	h.respond(c, a)
+}
+
+// Get godoc
+// @Summary Get a user's avatar
+// @Description Return the avatar with a signed download URL that expires after a while
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} AvatarResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id}/avatar [get]
+func (h *AvatarHandler) Get(c *gin.Context) {
+	user, err := h.Repo.GetUserByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		writeServerError(c, err)
+		return
+	}
+	if user.Avatar == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+		return
+	}
+
+	h.respond(c, user.Avatar)
+}
+
+// respond writes a with a freshly signed download URL.
+func (h *AvatarHandler) respond(c *gin.Context, a *model.Avatar) {
+	expiresAt := time.Now().Add(h.URLTTL).UTC()
+	downloadURL, err := h.Store.SignedURL(c.Request.Context(), a.Key, h.URLTTL)
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, AvatarResponse{Avatar: *a, DownloadURL: downloadURL, ExpiresAt: expiresAt})
+}
+
+// avatarKey returns a new object key for a user's avatar, prefixed by the
+// tenant in ctx so tenants never share keys.
+func avatarKey(ctx context.Context, userID, ext string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	key := "avatars/"
+	if id, ok := tenant.FromContext(ctx); ok {
+		key += id + "/"
+	}
+	return key + userID + "/" + hex.EncodeToString(b) + ext
+}
@@ -0,0 +1,161 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/gnsalok/go-project-root/go-db-data-api/avatar"
+	"github.com/gnsalok/go-project-root/go-db-data-api/handler"
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAvatarRouter serves the avatar routes from an in-memory repository
+// holding user1 and a file store in a temporary directory. The token
+// s3cret is an admin's; others come from the returned session store.
+func newAvatarRouter(t *testing.T) (*gin.Engine, *auth.SessionStore) {
+	repo := repository.NewMemoryUserRepository()
+	require.NoError(t, repo.InsertUser(context.Background(), &model.User{ID: "user1", Name: "John Doe"}))
+	store := &avatar.FileStore{Dir: t.TempDir(), BaseURL: "http://example.com", SigningKey: []byte("secret")}
+	avatarHandler := &handler.AvatarHandler{Repo: repo, Store: store, MaxBytes: 1 << 20, URLTTL: time.Minute}
+
+	sessions := auth.NewSessionStore(time.Hour)
+	router := gin.Default()
+	users := router.Group("/users", auth.Middleware(auth.Config{Tokens: map[string]string{"s3cret": "admin"}, Sessions: sessions}))
+	users.POST("/:id/avatar", avatarHandler.Upload)
+	users.GET("/:id/avatar", avatarHandler.Get)
+	router.GET("/avatars/*key", gin.WrapH(store))
+	return router, sessions
+}
+
+// uploadRequest builds a multipart avatar upload of content, sent with the
+// bearer token unless it is empty.
+func uploadRequest(t *testing.T, token, userID string, content []byte) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("avatar", "avatar.png")
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/users/"+userID+"/avatar", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func pngImage(t *testing.T) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	return buf.Bytes()
+}
+
+// TestAvatarUploadAndDownload uploads an avatar, then downloads it through
+// the signed URL returned by GET /users/:id/avatar.
+func TestAvatarUploadAndDownload(t *testing.T) {
+	router, _ := newAvatarRouter(t)
+	content := pngImage(t)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, uploadRequest(t, "s3cret", "user1", content))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var uploaded handler.AvatarResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &uploaded))
+	assert.Equal(t, "image/png", uploaded.ContentType)
+	assert.Equal(t, int64(len(content)), uploaded.Size)
+	assert.Equal(t, "http://example.com/"+uploaded.Key, uploaded.URL)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/user1/avatar", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var got handler.AvatarResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, uploaded.Avatar, got.Avatar)
+
+	download, err := url.Parse(got.DownloadURL)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, download.RequestURI(), nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, content, rr.Body.Bytes())
+
+	// The signature covers the key and expiry, so neither can be altered.
+	q := download.Query()
+	q.Set("expires", "9999999999")
+	download.RawQuery = q.Encode()
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, download.RequestURI(), nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+// TestAvatarUploadErrors tests the rejected uploads.
+func TestAvatarUploadErrors(t *testing.T) {
+	router, _ := newAvatarRouter(t)
+
+	testCases := []struct {
+		name         string
+		userID       string
+		content      []byte
+		expectedCode int
+	}{
+		{name: "Non-Existing User", userID: "user2", content: pngImage(t), expectedCode: http.StatusNotFound},
+		{name: "Not An Image", userID: "user1", content: []byte("#!/bin/sh\necho hi\n"), expectedCode: http.StatusUnsupportedMediaType},
+		{name: "Too Large", userID: "user1", content: append(pngImage(t), make([]byte, 2<<20)...), expectedCode: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, uploadRequest(t, "s3cret", tc.userID, tc.content))
+			assert.Equal(t, tc.expectedCode, rr.Code, rr.Body.String())
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/user1/avatar", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// TestAvatarUploadAuthorization tests that users may only replace their
+// own avatar.
+func TestAvatarUploadAuthorization(t *testing.T) {
+	router, sessions := newAvatarRouter(t)
+	own, err := sessions.Create("user1", "")
+	require.NoError(t, err)
+	other, err := sessions.Create("user2", "")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{name: "Anonymous", token: "", expectedCode: http.StatusUnauthorized},
+		{name: "Other User", token: other.Token, expectedCode: http.StatusForbidden},
+		{name: "Own Avatar", token: own.Token, expectedCode: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, uploadRequest(t, tc.token, "user1", pngImage(t)))
+			assert.Equal(t, tc.expectedCode, rr.Code, rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/backup"
+)
+
+// BackupHandler exposes admin endpoints for backing up and restoring users.
+type BackupHandler struct {
+	Manager *backup.Manager
+}
+
+// StartBackup godoc
+// @Summary Start a backup
+// @Description Export the users collection to object storage in the background
+// @Tags admin
+// @Produce json
+// @Success 202 {object} backup.Job
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /admin/backups [post]
+func (h *BackupHandler) StartBackup(c *gin.Context) {
+	job, err := h.Manager.StartBackup()
+	if err != nil {
+		if errors.Is(err, backup.ErrJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListBackups godoc
+// @Summary List backups
+// @Description List the manifests of all complete backups, newest first
+// @Tags admin
+// @Produce json
+// @Success 200 {array} backup.Manifest
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/backups [get]
+func (h *BackupHandler) ListBackups(c *gin.Context) {
+	manifests, err := h.Manager.ListBackups(c.Request.Context())
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, manifests)
+}
+
+// GetJob godoc
+// @Summary Get backup or restore job status
+// @Tags admin
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} backup.Job
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/backups/jobs/{id} [get]
+func (h *BackupHandler) GetJob(c *gin.Context) {
+	job, ok := h.Manager.Job(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// Restore godoc
+// @Summary Restore a backup
+// @Description Restore users from a backup in the background
+// @Tags admin
+// @Produce json
+// @Param id path string true "Backup ID"
+// @Param conflict query string false "Conflict policy: skip, overwrite or fail" default(skip)
+// @Success 202 {object} backup.Job
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /admin/backups/{id}/restore [post]
+func (h *BackupHandler) Restore(c *gin.Context) {
+	policy, err := backup.ParseConflictPolicy(c.Query("conflict"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	if !backup.ValidID(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backup ID"})
+		return
+	}
+
+	job, err := h.Manager.StartRestore(c.Request.Context(), id, policy)
+	if err != nil {
+		switch {
+		case errors.Is(err, backup.ErrBackupNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+		case errors.Is(err, backup.ErrJobRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			writeServerError(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
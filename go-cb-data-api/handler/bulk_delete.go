@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+)
+
+// defaultPreviewTTL is how long a dry run's confirm token stays valid when
+// BulkDeleteHandler.PreviewTTL is unset.
+const defaultPreviewTTL = 5 * time.Minute
+
+// BulkDeleteHandler deletes the users matching a selector in two steps: a
+// dry run counts them and returns a confirm token, and only a delete
+// presenting that token removes them.
+type BulkDeleteHandler struct {
+	Repo repository.UserRepository
+	// PreviewTTL is how long a confirm token stays valid.
+	PreviewTTL time.Duration
+
+	mu       sync.Mutex
+	previews map[string]preview
+}
+
+// preview is a dry run awaiting confirmation.
+type preview struct {
+	tenant   string
+	selector string
+	count    int
+	expires  time.Time
+}
+
+// BulkDeletePreview is the result of a dry run.
+type BulkDeletePreview struct {
+	Selector string `json:"selector"`
+	// Count is how many users the delete would remove.
+	Count int `json:"count"`
+	// Confirm must be passed back to delete the users. It can be used
+	// once.
+	Confirm   string    `json:"confirm"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BulkDeleteResult reports a completed delete.
+type BulkDeleteResult struct {
+	Selector string `json:"selector"`
+	Deleted  int    `json:"deleted"`
+}
+
+// Delete godoc
+// @Summary Delete users matching a selector
+// @Description Preview with dryRun=true, which counts the matching users and returns a confirm token, then delete them by passing the token back.
+// @Description The selector is a comma-separated list of field=value or field!=value conditions on id, name, email or email_lower; * matches any run of characters.
+// @Tags users
+// @Produce json
+// @Param selector query string true "Users to delete, e.g. email_lower=*@example.com"
+// @Param dryRun query bool false "Only count the matching users"
+// @Param confirm query string false "Confirm token of a dry run with the same selector"
+// @Param Authorization header string true "Bearer token of the admin role"
+// @Success 200 {object} handler.BulkDeleteResult
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users [delete]
+func (h *BulkDeleteHandler) Delete(c *gin.Context) {
+	sel, err := repository.ParseSelector(c.Query("selector"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	tenantID, _ := tenant.FromContext(ctx)
+
+	if c.Query("dryRun") == "true" {
+		count, err := h.Repo.CountUsersMatching(ctx, sel)
+		if err != nil {
+			writeServerError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, h.newPreview(tenantID, sel.String(), count))
+		return
+	}
+
+	p, ok := h.takePreview(c.Query("confirm"))
+	if !ok || p.tenant != tenantID || p.selector != sel.String() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing or expired confirm token; preview the delete with dryRun=true first"})
+		return
+	}
+	// Refuse to delete more, or other, users than the preview showed.
+	count, err := h.Repo.CountUsersMatching(ctx, sel)
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+	if count != p.count {
+		c.JSON(http.StatusConflict, gin.H{"error": "The matching users changed since the preview; preview the delete again"})
+		return
+	}
+
+	deleted, err := h.Repo.DeleteUsersMatching(ctx, sel)
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, BulkDeleteResult{Selector: sel.String(), Deleted: len(deleted)})
+}
+
+// newPreview records a dry run and returns it with a fresh confirm token.
+func (h *BulkDeleteHandler) newPreview(tenantID, selector string, count int) BulkDeletePreview {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	token := hex.EncodeToString(b[:])
+	ttl := h.PreviewTTL
+	if ttl <= 0 {
+		ttl = defaultPreviewTTL
+	}
+	now := time.Now()
+	expires := now.Add(ttl)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.previews == nil {
+		h.previews = make(map[string]preview)
+	}
+	for t, p := range h.previews {
+		if now.After(p.expires) {
+			delete(h.previews, t)
+		}
+	}
+	h.previews[token] = preview{tenant: tenantID, selector: selector, count: count, expires: expires}
+	return BulkDeletePreview{Selector: selector, Count: count, Confirm: token, ExpiresAt: expires.UTC()}
+}
+
+// takePreview removes and returns the unexpired preview of token.
+func (h *BulkDeleteHandler) takePreview(token string) (preview, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p, ok := h.previews[token]
+	delete(h.previews, token)
+	return p, ok && time.Now().Before(p.expires)
+}
@@ -0,0 +1,73 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/handler"
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBulkDelete walks through a dry run and the confirmed delete, and
+// checks deletes without a matching preview are refused.
+func TestBulkDelete(t *testing.T) {
+	repo := repository.NewMemoryUserRepository()
+	ctx := context.Background()
+	for _, id := range []string{"user1", "user2", "user3"} {
+		require.NoError(t, repo.InsertUser(ctx, &model.User{ID: id, Email: id + "@example.com"}))
+	}
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "admin", Email: "admin@example.org"}))
+
+	bulkDeleteHandler := &handler.BulkDeleteHandler{Repo: repo}
+	router := gin.Default()
+	router.DELETE("/users", bulkDeleteHandler.Delete)
+	send := func(query url.Values) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/users?"+query.Encode(), nil))
+		return rr
+	}
+	dryRun := func(selector string) handler.BulkDeletePreview {
+		t.Helper()
+		rr := send(url.Values{"selector": {selector}, "dryRun": {"true"}})
+		require.Equal(t, http.StatusOK, rr.Code)
+		var preview handler.BulkDeletePreview
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &preview))
+		return preview
+	}
+
+	rr := send(url.Values{"selector": {""}, "dryRun": {"true"}})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = send(url.Values{"selector": {"email=*@example.com"}})
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "delete without a dry run")
+
+	preview := dryRun("email=*@example.com")
+	assert.Equal(t, 3, preview.Count)
+	assert.NotEmpty(t, preview.Confirm)
+	rr = send(url.Values{"selector": {"email=*"}, "confirm": {preview.Confirm}})
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "token of another selector")
+	rr = send(url.Values{"selector": {"email=*@example.com"}, "confirm": {preview.Confirm}})
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "token reused")
+
+	preview = dryRun("email=*@example.com")
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "user4", Email: "user4@example.com"}))
+	rr = send(url.Values{"selector": {"email=*@example.com"}, "confirm": {preview.Confirm}})
+	assert.Equal(t, http.StatusConflict, rr.Code, "users changed since the preview")
+
+	preview = dryRun("email=*@example.com")
+	assert.Equal(t, 4, preview.Count)
+	rr = send(url.Values{"selector": {"email=*@example.com"}, "confirm": {preview.Confirm}})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"selector":"email=*@example.com","deleted":4}`, rr.Body.String())
+
+	count, err := repo.CountUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
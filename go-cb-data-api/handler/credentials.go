@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+)
+
+// CredentialsHandler sets user passwords and logs users in.
+type CredentialsHandler struct {
+	Repo     repository.UserRepository
+	Sessions *auth.SessionStore
+	// Limiter blocks users and client addresses after too many wrong
+	// passwords.
+	Limiter *auth.Limiter
+}
+
+// SetPasswordRequest is the body of POST /users/:id/password.
+type SetPasswordRequest struct {
+	Password string `json:"password" binding:"required"`
+	// CurrentPassword is required unless an admin sets the password.
+	CurrentPassword string `json:"current_password"`
+}
+
+// LoginRequest is the body of POST /login.
+type LoginRequest struct {
+	UserID   string `json:"user_id" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// SetPassword godoc
+// @Summary Set a user's password
+// @Description Admins may set any user's password. Users may change their own, logged in and giving their current password. Every session of the user ends.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body SetPasswordRequest true "New password, 8 to 72 bytes long"
+// @Param Authorization header string true "Bearer token of an admin or of the user's session"
+// @Success 204 "Password set"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /users/{id}/password [post]
+func (h *CredentialsHandler) SetPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	tenantID, _ := tenant.FromContext(ctx)
+
+	var req SetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is required"})
+		return
+	}
+
+	admin := auth.RoleFromContext(ctx) == "admin"
+	keys := limiterKeys(c, tenantID, id)
+	if !admin {
+		if !authorizeSelf(c, id, tenantID) || h.blocked(c, keys) {
+			return
+		}
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if errors.Is(err, auth.ErrInvalidPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+
+	user, err := h.Repo.GetUserByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		writeServerError(c, err)
+		return
+	}
+	if !admin && !auth.CheckPassword(user.PasswordHash, req.CurrentPassword) {
+		h.Limiter.Fail(keys...)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if err := h.Repo.SetUserPassword(ctx, id, hash); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		writeServerError(c, err)
+		return
+	}
+	// Whoever knew the old password must log in again.
+	h.Sessions.RevokeUser(id, tenantID)
+	c.Status(http.StatusNoContent)
+}
+
+// authorizeSelf checks the request comes from a session of the user id in
+// tenantID, responding 401 or 403 and returning false otherwise.
+func authorizeSelf(c *gin.Context, id, tenantID string) bool {
+	session, ok := auth.SessionFromContext(c.Request.Context())
+	if !ok {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return false
+	}
+	if session.UserID != id || session.Tenant != tenantID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+		return false
+	}
+	return true
+}
+
+// Login godoc
+// @Summary Log a user in
+// @Description Check a user's password and start a session. Its token authenticates as the user role until it expires or the password changes. Users and client addresses with too many wrong passwords are blocked for a while.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body LoginRequest true "Credentials"
+// @Success 200 {object} auth.Session
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Header 429 {integer} Retry-After "Seconds until the next attempt is allowed"
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /login [post]
+func (h *CredentialsHandler) Login(c *gin.Context) {
+	ctx := c.Request.Context()
+	tenantID, _ := tenant.FromContext(ctx)
+
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID and password are required"})
+		return
+	}
+	keys := limiterKeys(c, tenantID, req.UserID)
+	if h.blocked(c, keys) {
+		return
+	}
+
+	// Unknown users are checked against no hash, which fails as slowly as
+	// a wrong password.
+	var hash string
+	user, err := h.Repo.GetUserByID(ctx, req.UserID)
+	switch {
+	case err == nil:
+		hash = user.PasswordHash
+	case !errors.Is(err, repository.ErrNotFound):
+		writeServerError(c, err)
+		return
+	}
+	if !auth.CheckPassword(hash, req.Password) {
+		h.Limiter.Fail(keys...)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	// Only the user's count is reset: one account's password must not
+	// buy an address more guesses at others.
+	h.Limiter.Reset(keys[0])
+	session, err := h.Sessions.Create(req.UserID, tenantID)
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+// limiterKeys returns the Limiter keys of attempts on the user with ID
+// userID in tenantID: first the user's, then the client address's.
+func limiterKeys(c *gin.Context, tenantID, userID string) []string {
+	return []string{"user:" + tenantID + "/" + userID, "ip:" + c.ClientIP()}
+}
+
+// blocked responds with 429 and reports true if any of keys is blocked.
+func (h *CredentialsHandler) blocked(c *gin.Context, keys []string) bool {
+	wait := h.Limiter.Blocked(keys...)
+	if wait <= 0 {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+	return true
+}
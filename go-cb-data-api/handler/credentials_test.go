@@ -0,0 +1,149 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/gnsalok/go-project-root/go-db-data-api/handler"
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCredentialsRouter serves logins and password changes from an
+// in-memory repository holding user1 and user2, whose password is
+// "user2 password". The admin token is "s3cret"; three wrong passwords
+// block a user or address.
+func newCredentialsRouter(t *testing.T) *gin.Engine {
+	repo := repository.NewMemoryUserRepository()
+	ctx := context.Background()
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "user1", Name: "John Doe"}))
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "user2", Name: "Jane Doe"}))
+	hash, err := auth.HashPassword("user2 password")
+	require.NoError(t, err)
+	require.NoError(t, repo.SetUserPassword(ctx, "user2", hash))
+
+	sessions := auth.NewSessionStore(time.Hour)
+	credentialsHandler := &handler.CredentialsHandler{Repo: repo, Sessions: sessions, Limiter: auth.NewLimiter(3, time.Hour)}
+	userHandler := &handler.UserHandler{Repo: repo}
+
+	router := gin.Default()
+	users := router.Group("/users", auth.Middleware(auth.Config{Tokens: map[string]string{"s3cret": "admin"}, Sessions: sessions}))
+	users.GET("/:id", userHandler.GetUserByID)
+	users.POST("/:id/password", credentialsHandler.SetPassword)
+	router.POST("/login", credentialsHandler.Login)
+	return router
+}
+
+func postJSON(router *gin.Engine, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func login(t *testing.T, router *gin.Engine, userID, password string) string {
+	rr := postJSON(router, "/login", "", `{"user_id":"`+userID+`","password":"`+password+`"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var session auth.Session
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &session))
+	assert.Equal(t, userID, session.UserID)
+	return session.Token
+}
+
+// TestPasswordAndLogin sets a password as an admin, logs in with it and
+// changes it, which ends the session.
+func TestPasswordAndLogin(t *testing.T) {
+	router := newCredentialsRouter(t)
+
+	rr := postJSON(router, "/users/user1/password", "s3cret", `{"password":"first password"}`)
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+	rr = postJSON(router, "/login", "", `{"user_id":"user1","password":"wrong password"}`)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.JSONEq(t, `{"error":"Invalid credentials"}`, rr.Body.String())
+	token := login(t, router, "user1", "first password")
+
+	// The session authenticates, and the hash is never served.
+	req := httptest.NewRequest(http.MethodGet, "/users/user1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "password")
+
+	rr = postJSON(router, "/users/user1/password", token, `{"password":"second password","current_password":"first password"}`)
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+	rr = postJSON(router, "/users/user1/password", token, `{"password":"third password","current_password":"second password"}`)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "session ended by the change")
+	login(t, router, "user1", "second password")
+}
+
+// TestSetPasswordRejected checks who may set which password.
+func TestSetPasswordRejected(t *testing.T) {
+	router := newCredentialsRouter(t)
+	token := login(t, router, "user2", "user2 password")
+
+	testCases := []struct {
+		name         string
+		path         string
+		token        string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "Anonymous", path: "/users/user2/password", body: `{"password":"new password","current_password":"user2 password"}`,
+			expectedCode: http.StatusUnauthorized, expectedBody: `{"error":"Authentication required"}`},
+		{name: "Other User", path: "/users/user1/password", token: token, body: `{"password":"new password","current_password":"user2 password"}`,
+			expectedCode: http.StatusForbidden, expectedBody: `{"error":"Forbidden"}`},
+		{name: "Wrong Current Password", path: "/users/user2/password", token: token, body: `{"password":"new password","current_password":"guess"}`,
+			expectedCode: http.StatusForbidden, expectedBody: `{"error":"Current password is incorrect"}`},
+		{name: "Too Short", path: "/users/user2/password", token: token, body: `{"password":"short","current_password":"user2 password"}`,
+			expectedCode: http.StatusBadRequest, expectedBody: `{"error":"password must be 8 to 72 bytes long"}`},
+		{name: "Missing Password", path: "/users/user2/password", token: "s3cret", body: `{}`,
+			expectedCode: http.StatusBadRequest, expectedBody: `{"error":"Password is required"}`},
+		{name: "Unknown User", path: "/users/missing/password", token: "s3cret", body: `{"password":"new password"}`,
+			expectedCode: http.StatusNotFound, expectedBody: `{"error":"User not found"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := postJSON(router, tc.path, tc.token, tc.body)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			assert.JSONEq(t, tc.expectedBody, rr.Body.String())
+		})
+	}
+}
+
+// TestLoginRateLimit checks a user is blocked after too many wrong
+// passwords, even with the right one, and unknown users fail alike.
+func TestLoginRateLimit(t *testing.T) {
+	router := newCredentialsRouter(t)
+
+	rr := postJSON(router, "/login", "", `{"user_id":"missing","password":"user2 password"}`)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.JSONEq(t, `{"error":"Invalid credentials"}`, rr.Body.String())
+
+	for i := 0; i < 2; i++ {
+		rr = postJSON(router, "/login", "", `{"user_id":"user2","password":"guess"}`)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	}
+	// The address has failed three times now, whichever the user.
+	rr = postJSON(router, "/login", "", `{"user_id":"user2","password":"user2 password"}`)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "3600", rr.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"Too many failed attempts, try again later"}`, rr.Body.String())
+}
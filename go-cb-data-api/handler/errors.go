@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/durability"
+)
+
+// writeServerError responds to an unexpected error: 504 when the request
+// deadline passed or Couchbase timed out, 503 when the cluster cannot meet
+// the write durability, 500 otherwise.
+func writeServerError(c *gin.Context, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out"})
+		return
+	}
+	if errors.Is(err, durability.ErrUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Requested durability cannot be met"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+}
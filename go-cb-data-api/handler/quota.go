@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/quota"
+)
+
+// QuotaHandler exposes admin endpoints for adjusting API key quotas.
+type QuotaHandler struct {
+	Store  quota.Store
+	Config quota.Config
+}
+
+// SetQuotaRequest sets the daily request limit of an API key.
+type SetQuotaRequest struct {
+	DailyLimit *int64 `json:"daily_limit" binding:"required"`
+}
+
+// QuotaStatus is the quota of an API key and its use today.
+type QuotaStatus struct {
+	// DailyLimit is nil for keys without any limit.
+	DailyLimit *int64 `json:"daily_limit"`
+	// Default is set when the key has no quota of its own.
+	Default   bool      `json:"default"`
+	UsedToday int64     `json:"used_today"`
+	Remaining *int64    `json:"remaining,omitempty"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// Get godoc
+// @Summary Get an API key's quota
+// @Description The daily request limit of an API key, whether it is the default, and how much of it was used today
+// @Tags admin
+// @Produce json
+// @Param key path string true "API key"
+// @Success 200 {object} QuotaStatus
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/quotas/{key} [get]
+func (h *QuotaHandler) Get(c *gin.Context) {
+	h.writeStatus(c, http.StatusOK)
+}
+
+// Set godoc
+// @Summary Set an API key's quota
+// @Description Replace the daily request limit of an API key; 0 blocks the key
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key path string true "API key"
+// @Param quota body SetQuotaRequest true "Quota"
+// @Success 200 {object} QuotaStatus
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/quotas/{key} [put]
+func (h *QuotaHandler) Set(c *gin.Context) {
+	var req SetQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil || *req.DailyLimit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "daily_limit must be a non-negative number"})
+		return
+	}
+	key := strings.TrimSpace(c.Param("key"))
+	q := &quota.Quota{Daily: *req.DailyLimit, UpdatedAt: time.Now().UTC()}
+	if err := h.Store.SetQuota(c.Request.Context(), key, q); err != nil {
+		writeServerError(c, err)
+		return
+	}
+	h.writeStatus(c, http.StatusOK)
+}
+
+// Delete godoc
+// @Summary Reset an API key's quota
+// @Description Remove the key's own quota, leaving it with the default
+// @Tags admin
+// @Param key path string true "API key"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/quotas/{key} [delete]
+func (h *QuotaHandler) Delete(c *gin.Context) {
+	if err := h.Store.DeleteQuota(c.Request.Context(), strings.TrimSpace(c.Param("key"))); err != nil {
+		writeServerError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// writeStatus responds with the quota of the key in the path, falling back
+// to the default as quota.Middleware does.
+func (h *QuotaHandler) writeStatus(c *gin.Context, code int) {
+	ctx := c.Request.Context()
+	key := strings.TrimSpace(c.Param("key"))
+	q, err := h.Store.Quota(ctx, key)
+	if errors.Is(err, quota.ErrNotFound) {
+		q = nil
+	} else if err != nil {
+		writeServerError(c, err)
+		return
+	}
+	day := quota.Day(time.Now())
+	used, err := h.Store.Usage(ctx, key, day)
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+
+	status := QuotaStatus{Default: q == nil, UsedToday: used, ResetAt: day.Add(24 * time.Hour)}
+	limit := h.Config.Default
+	if q != nil {
+		limit = q.Daily
+	}
+	if q != nil || limit > 0 {
+		remaining := max(limit-used, 0)
+		status.DailyLimit, status.Remaining = &limit, &remaining
+	}
+	c.JSON(code, status)
+}
@@ -0,0 +1,67 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/handler"
+	"github.com/gnsalok/go-project-root/go-db-data-api/quota"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestQuota tests admins can set a key's quota, see its use today, and
+// reset it to the default.
+func TestQuota(t *testing.T) {
+	store := quota.NewMemoryStore()
+	quotaHandler := &handler.QuotaHandler{Store: store, Config: quota.Config{Default: 100}}
+	router := gin.Default()
+	router.GET("/admin/quotas/:key", quotaHandler.Get)
+	router.PUT("/admin/quotas/:key", quotaHandler.Set)
+	router.DELETE("/admin/quotas/:key", quotaHandler.Delete)
+	router.GET("/users/:id", quota.Middleware(quotaHandler.Config, store), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(method, path, body string) (*httptest.ResponseRecorder, handler.QuotaStatus) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(quota.DefaultHeader, "partner")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var status handler.QuotaStatus
+		if strings.HasPrefix(path, "/admin") && rr.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		}
+		return rr, status
+	}
+
+	rr, status := do(http.MethodGet, "/admin/quotas/partner", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, status.Default)
+	require.NotNil(t, status.DailyLimit)
+	assert.Equal(t, int64(100), *status.DailyLimit)
+
+	rr, status = do(http.MethodPut, "/admin/quotas/partner", `{"daily_limit": 2}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, status.Default)
+	assert.Equal(t, int64(2), *status.DailyLimit)
+
+	do(http.MethodGet, "/users/1", "")
+	_, status = do(http.MethodGet, "/admin/quotas/partner", "")
+	assert.Equal(t, int64(1), status.UsedToday)
+	assert.Equal(t, int64(1), *status.Remaining)
+
+	rr, _ = do(http.MethodDelete, "/admin/quotas/partner", "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	_, status = do(http.MethodGet, "/admin/quotas/partner", "")
+	assert.True(t, status.Default)
+	assert.Equal(t, int64(99), *status.Remaining)
+
+	for _, body := range []string{`{}`, `{"daily_limit": -1}`} {
+		rr, _ = do(http.MethodPut, "/admin/quotas/partner", body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/reindex"
+)
+
+// ReindexHandler exposes admin endpoints for rebuilding derived user fields.
+type ReindexHandler struct {
+	Reindexer *reindex.Reindexer
+}
+
+// Start godoc
+// @Summary Start a reindex
+// @Description Rebuild derived fields of all users in the background, resuming from the last checkpoint
+// @Tags admin
+// @Produce json
+// @Param restart query bool false "Ignore the checkpoint and start from the beginning"
+// @Success 202 {object} reindex.Status
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/reindex [post]
+func (h *ReindexHandler) Start(c *gin.Context) {
+	status, err := h.Reindexer.Start(c.Query("restart") == "true")
+	if err != nil {
+		if errors.Is(err, reindex.ErrRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, status)
+}
+
+// Status godoc
+// @Summary Get reindex progress
+// @Description Progress, throughput and ETA of the current or last reindex
+// @Tags admin
+// @Produce json
+// @Success 200 {object} reindex.Status
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /admin/reindex/status [get]
+func (h *ReindexHandler) Status(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Reindexer.Status())
+}
+
+// Cancel godoc
+// @Summary Cancel a running reindex
+// @Description Stop after the current batch; the next start resumes from the checkpoint
+// @Tags admin
+// @Produce json
+// @Success 200 {object} reindex.Status
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /admin/reindex/cancel [post]
+func (h *ReindexHandler) Cancel(c *gin.Context) {
+	if !h.Reindexer.Cancel() {
+		c.JSON(http.StatusConflict, gin.H{"error": "No reindex is running"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.Reindexer.Status())
+}
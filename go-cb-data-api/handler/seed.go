@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/seed"
+)
+
+// SeedHandler loads fixture users on request. Its route is only
+// registered in dev builds.
+type SeedHandler struct {
+	Loader *seed.Loader
+}
+
+// Seed godoc
+// @Summary Load fixture users
+// @Description Provision the fixture tenants and create or update the fixture users, leaving users that already match alone. Only served by dev builds.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param fixtures body seed.Fixtures true "Fixtures"
+// @Success 200 {object} seed.Result
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /admin/seed [post]
+func (h *SeedHandler) Seed(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	fixtures, err := seed.Parse(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	res, err := h.Loader.Load(c.Request.Context(), fixtures)
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+)
+
+// TenantHandler exposes admin endpoints for provisioning tenants.
+type TenantHandler struct {
+	Repo repository.TenantRepository
+}
+
+// ProvisionTenantRequest names the tenant to provision.
+type ProvisionTenantRequest struct {
+	ID string `json:"id" binding:"required"`
+}
+
+// Provision godoc
+// @Summary Provision a tenant
+// @Description Create the Couchbase scope, users collection and primary index for a tenant
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param tenant body ProvisionTenantRequest true "Tenant"
+// @Success 201 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/tenants [post]
+func (h *TenantHandler) Provision(c *gin.Context) {
+	var req ProvisionTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tenant ID is required"})
+		return
+	}
+	if err := tenant.ValidateID(req.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Repo.ProvisionTenant(c.Request.Context(), req.ID); err != nil {
+		if errors.Is(err, repository.ErrTenantExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		writeServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": req.ID})
+}
+
+// List godoc
+// @Summary List tenants
+// @Tags admin
+// @Produce json
+// @Success 200 {array} string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/tenants [get]
+func (h *TenantHandler) List(c *gin.Context) {
+	ids, err := h.Repo.ListTenants(c.Request.Context())
+	if err != nil {
+		writeServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ids)
+}
@@ -0,0 +1,82 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/handler"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestProvisionTenant tests the Provision handler.
+func TestProvisionTenant(t *testing.T) {
+	mockRepo := mocks.NewTenantRepository(t)
+	mockRepo.On("ProvisionTenant", mock.Anything, "acme").Return(nil)
+	mockRepo.On("ProvisionTenant", mock.Anything, "globex").Return(repository.ErrTenantExists)
+	mockRepo.On("ProvisionTenant", mock.Anything, "initech").Return(errors.New("database error"))
+
+	tenantHandler := &handler.TenantHandler{Repo: mockRepo}
+	router := gin.Default()
+	router.POST("/admin/tenants", tenantHandler.Provision)
+
+	testCases := []struct {
+		name         string
+		body         string
+		expectedCode int
+		expectedBody map[string]string
+	}{
+		{
+			name:         "New Tenant",
+			body:         `{"id":"acme"}`,
+			expectedCode: http.StatusCreated,
+			expectedBody: map[string]string{"id": "acme"},
+		},
+		{
+			name:         "Existing Tenant",
+			body:         `{"id":"globex"}`,
+			expectedCode: http.StatusConflict,
+			expectedBody: map[string]string{"error": repository.ErrTenantExists.Error()},
+		},
+		{
+			name:         "Missing ID",
+			body:         `{}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]string{"error": "Tenant ID is required"},
+		},
+		{
+			name:         "Reserved ID",
+			body:         `{"id":"_default"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Database Error",
+			body:         `{"id":"initech"}`,
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: map[string]string{"error": "Internal server error"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/tenants", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedBody != nil {
+				var respBody map[string]string
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &respBody))
+				assert.Equal(t, tc.expectedBody, respBody)
+			}
+		})
+	}
+}
@@ -1,16 +1,40 @@
 package handler
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/gnsalok/go-project-root/go-db-data-api/fieldmask"
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
 	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
 )
 
 // UserHandler handles user-related HTTP requests.
 type UserHandler struct {
 	Repo repository.UserRepository
+	// MaskFields hides the user fields the caller's role may not see, as
+	// declared by their visible tags; see package fieldmask.
+	MaskFields bool
+}
+
+// respond writes a user or user projection, masked for the caller's role
+// when MaskFields is set.
+func (h *UserHandler) respond(c *gin.Context, v any) {
+	if !h.MaskFields {
+		c.JSON(http.StatusOK, v)
+		return
+	}
+	// The body depends on the caller, so shared caches must not mix them up.
+	c.Writer.Header().Add("Vary", "Authorization")
+	c.JSON(http.StatusOK, fieldmask.Apply(v, auth.RoleFromContext(c.Request.Context())))
 }
 
 // GetUserByID godoc
@@ -20,22 +44,122 @@ type UserHandler struct {
 // @Accept json
 // @Produce json
 // @Param id path string true "User ID"
+// @Param fields query string false "Comma-separated fields to return, e.g. name,email"
+// @Param If-None-Match header string false "ETag of a cached copy of the user"
+// @Param Authorization header string false "Bearer token; email is only returned to the admin and support roles"
 // @Success 200 {object} model.User
+// @Header 200 {string} ETag "Version of the user; changes whenever it is written"
+// @Success 304 "The user has not changed since the ETag in If-None-Match"
+// @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
 // @Router /users/{id} [get]
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	id := c.Param("id")
 
-	user, err := h.Repo.GetUserByID(c.Request.Context(), id)
+	if raw, ok := c.GetQuery("fields"); ok {
+		fields, err := parseFields(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.getUserFields(c, id, fields)
+		return
+	}
+
+	user, cas, err := h.Repo.GetUserWithCAS(c.Request.Context(), id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		writeServerError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	// Clients revalidate their copy on every use, which costs a 304 and no
+	// body while the user is unchanged.
+	etag := userETag(cas)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	// The password hash never leaves the service, whatever the role.
+	user.PasswordHash = ""
+	h.respond(c, user)
+}
+
+// userETag derives the ETag of a user from its document CAS. It is weak
+// because the same user may be sent gzip-compressed or not.
+func userETag(cas uint64) string {
+	return `W/"` + strconv.FormatUint(cas, 16) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using
+// the weak comparison RFC 9110 prescribes for it.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// getUserFields responds with only the requested fields of the user.
+// Fields the caller may not see are not fetched, as if they were unset.
+func (h *UserHandler) getUserFields(c *gin.Context, id string, fields []string) {
+	if h.MaskFields {
+		role := auth.RoleFromContext(c.Request.Context())
+		fields = slices.DeleteFunc(fields, func(f string) bool {
+			return !fieldmask.Visible(reflect.TypeOf(model.User{}), f, role)
+		})
+	}
+	// With every requested field hidden, still look the user up so unknown
+	// users get a 404.
+	lookup := fields
+	if len(lookup) == 0 {
+		lookup = []string{"id"}
+	}
+	values, err := h.Repo.GetUserFields(c.Request.Context(), id, lookup)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		writeServerError(c, err)
+		return
+	}
+	if len(fields) == 0 {
+		values = map[string]json.RawMessage{}
+	}
+
+	h.respond(c, values)
+}
+
+// parseFields splits a comma-separated fields parameter, dropping blanks
+// and duplicates, and rejects fields the user model does not have.
+func parseFields(raw string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || slices.Contains(fields, field) {
+			continue
+		}
+		if !slices.Contains(model.UserFields, field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("fields must name at least one field")
+	}
+	return fields, nil
 }
@@ -1,13 +1,16 @@
 package handler_test
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
 	"github.com/gnsalok/go-project-root/go-db-data-api/handler"
 	"github.com/gnsalok/go-project-root/go-db-data-api/model"
 	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
@@ -29,9 +32,10 @@ func TestGetUserByID(t *testing.T) {
 	}
 
 	// Setup expectations
-	mockRepo.On("GetUserByID", mock.Anything, "user1").Return(sampleUser, nil)
-	mockRepo.On("GetUserByID", mock.Anything, "user2").Return(nil, repository.ErrNotFound)
-	mockRepo.On("GetUserByID", mock.Anything, "user3").Return(nil, errors.New("database error"))
+	mockRepo.On("GetUserWithCAS", mock.Anything, "user1").Return(sampleUser, uint64(0x17a3), nil)
+	mockRepo.On("GetUserWithCAS", mock.Anything, "user2").Return(nil, uint64(0), repository.ErrNotFound)
+	mockRepo.On("GetUserWithCAS", mock.Anything, "user3").Return(nil, uint64(0), errors.New("database error"))
+	mockRepo.On("GetUserWithCAS", mock.Anything, "user4").Return(nil, uint64(0), fmt.Errorf("%w: unambiguous timeout", context.DeadlineExceeded))
 
 	// Initialize handler with mock repository
 	userHandler := &handler.UserHandler{Repo: mockRepo}
@@ -57,13 +61,19 @@ func TestGetUserByID(t *testing.T) {
 			name:         "Non-Existing User",
 			userID:       "user2",
 			expectedCode: http.StatusNotFound,
-			expectedBody: gin.H{"error": "User not found"},
+			expectedBody: map[string]string{"error": "User not found"},
 		},
 		{
 			name:         "Database Error",
 			userID:       "user3",
 			expectedCode: http.StatusInternalServerError,
-			expectedBody: gin.H{"error": "Internal server error"},
+			expectedBody: map[string]string{"error": "Internal server error"},
+		},
+		{
+			name:         "Timeout",
+			userID:       "user4",
+			expectedCode: http.StatusGatewayTimeout,
+			expectedBody: map[string]string{"error": "Request timed out"},
 		},
 	}
 
@@ -100,3 +110,190 @@ func TestGetUserByID(t *testing.T) {
 	// Assert that the expectations were met
 	mockRepo.AssertExpectations(t)
 }
+
+// TestGetUserByIDConditional tests the ETag derived from the document CAS
+// and the 304 response to a matching If-None-Match.
+func TestGetUserByIDConditional(t *testing.T) {
+	mockRepo := new(mocks.UserRepository)
+	sampleUser := &model.User{ID: "user1", Name: "John Doe"}
+	mockRepo.On("GetUserWithCAS", mock.Anything, "user1").Return(sampleUser, uint64(0x17a3), nil)
+
+	userHandler := &handler.UserHandler{Repo: mockRepo}
+	router := gin.New()
+	router.GET("/users/:id", userHandler.GetUserByID)
+
+	testCases := []struct {
+		name         string
+		ifNoneMatch  string
+		expectedCode int
+	}{
+		{name: "No Validator", expectedCode: http.StatusOK},
+		{name: "Matching ETag", ifNoneMatch: `W/"17a3"`, expectedCode: http.StatusNotModified},
+		{name: "Strong Form Of ETag", ifNoneMatch: `"17a3"`, expectedCode: http.StatusNotModified},
+		{name: "ETag In List", ifNoneMatch: `W/"1", W/"17a3"`, expectedCode: http.StatusNotModified},
+		{name: "Any", ifNoneMatch: "*", expectedCode: http.StatusNotModified},
+		{name: "Stale ETag", ifNoneMatch: `W/"17a2"`, expectedCode: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/user1", nil)
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			assert.Equal(t, `W/"17a3"`, rr.Header().Get("ETag"))
+			if tc.expectedCode == http.StatusNotModified {
+				assert.Empty(t, rr.Body.String())
+			} else {
+				assert.Contains(t, rr.Body.String(), `"name":"John Doe"`)
+			}
+		})
+	}
+}
+
+// TestGetUserByIDWithFields tests field projection with the fields query
+// parameter.
+func TestGetUserByIDWithFields(t *testing.T) {
+	mockRepo := mocks.NewUserRepository(t)
+	mockRepo.On("GetUserFields", mock.Anything, "user1", []string{"name", "email"}).
+		Return(map[string]json.RawMessage{"name": json.RawMessage(`"John Doe"`), "email": json.RawMessage(`"john.doe@example.com"`)}, nil)
+	mockRepo.On("GetUserFields", mock.Anything, "user2", []string{"name"}).Return(nil, repository.ErrNotFound)
+
+	userHandler := &handler.UserHandler{Repo: mockRepo}
+	router := gin.Default()
+	router.GET("/users/:id", userHandler.GetUserByID)
+
+	testCases := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedBody map[string]string
+	}{
+		{
+			name:         "Selected Fields",
+			url:          "/users/user1?fields=name,%20email,name",
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]string{"name": "John Doe", "email": "john.doe@example.com"},
+		},
+		{
+			name:         "Non-Existing User",
+			url:          "/users/user2?fields=name",
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]string{"error": "User not found"},
+		},
+		{
+			name:         "Unknown Field",
+			url:          "/users/user1?fields=name,password",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]string{"error": `unknown field "password"`},
+		},
+		{
+			name:         "Empty Fields",
+			url:          "/users/user1?fields=",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]string{"error": "fields must name at least one field"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(t, err)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			var respBody map[string]string
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &respBody))
+			assert.Equal(t, tc.expectedBody, respBody)
+		})
+	}
+}
+
+// TestGetUserByIDMasked tests that email is only returned to the roles
+// allowed to see it, for whole users and field projections.
+func TestGetUserByIDMasked(t *testing.T) {
+	mockRepo := mocks.NewUserRepository(t)
+	mockRepo.On("GetUserWithCAS", mock.Anything, "user1").
+		Return(&model.User{ID: "user1", Name: "John Doe", Email: "john.doe@example.com", EmailLower: "john.doe@example.com"}, uint64(1), nil)
+	mockRepo.On("GetUserFields", mock.Anything, "user1", []string{"name", "email"}).
+		Return(map[string]json.RawMessage{"name": json.RawMessage(`"John Doe"`), "email": json.RawMessage(`"john.doe@example.com"`)}, nil)
+	mockRepo.On("GetUserFields", mock.Anything, "user1", []string{"name"}).
+		Return(map[string]json.RawMessage{"name": json.RawMessage(`"John Doe"`)}, nil)
+	mockRepo.On("GetUserFields", mock.Anything, "user1", []string{"id"}).
+		Return(map[string]json.RawMessage{"id": json.RawMessage(`"user1"`)}, nil)
+	mockRepo.On("GetUserFields", mock.Anything, "user2", []string{"id"}).Return(nil, repository.ErrNotFound)
+
+	userHandler := &handler.UserHandler{Repo: mockRepo, MaskFields: true}
+	router := gin.Default()
+	router.Use(auth.Middleware(auth.Config{Tokens: map[string]string{"s3cret": "admin"}}))
+	router.GET("/users/:id", userHandler.GetUserByID)
+
+	testCases := []struct {
+		name         string
+		url          string
+		token        string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Admin",
+			url:          "/users/user1",
+			token:        "s3cret",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"user1","name":"John Doe","email":"john.doe@example.com","email_lower":"john.doe@example.com"}`,
+		},
+		{
+			name:         "Anonymous",
+			url:          "/users/user1",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"user1","name":"John Doe"}`,
+		},
+		{
+			name:         "Admin Fields",
+			url:          "/users/user1?fields=name,email",
+			token:        "s3cret",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"name":"John Doe","email":"john.doe@example.com"}`,
+		},
+		{
+			name:         "Anonymous Fields",
+			url:          "/users/user1?fields=name,email",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"name":"John Doe"}`,
+		},
+		{
+			name:         "Only Hidden Fields",
+			url:          "/users/user1?fields=email",
+			expectedCode: http.StatusOK,
+			expectedBody: `{}`,
+		},
+		{
+			name:         "Only Hidden Fields of Non-Existing User",
+			url:          "/users/user2?fields=email",
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"error":"User not found"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			assert.JSONEq(t, tc.expectedBody, rr.Body.String())
+			if rr.Code == http.StatusOK {
+				assert.Equal(t, "Authorization", rr.Header().Get("Vary"))
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCORS checks the headers sent for allowed and other origins, and that
+// preflights are answered without reaching the routes.
+func TestCORS(t *testing.T) {
+	cfg := middleware.DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"https://app.example.com", "https://*.preview.example.com"}
+	cfg.AllowCredentials = true
+	cfg.MaxAge = 5 * time.Minute
+	router := gin.New()
+	router.Use(middleware.CORS(cfg), middleware.Gzip())
+	router.GET("/users/:id", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"id": c.Param("id")}) })
+
+	testCases := []struct {
+		name          string
+		method        string
+		origin        string
+		preflight     bool
+		expectedCode  int
+		expectedAllow string
+	}{
+		{name: "Same Origin", method: http.MethodGet, expectedCode: http.StatusOK},
+		{name: "Allowed Origin", method: http.MethodGet, origin: "https://app.example.com", expectedCode: http.StatusOK, expectedAllow: "https://app.example.com"},
+		{name: "Wildcard Subdomain", method: http.MethodGet, origin: "https://pr-42.preview.example.com", expectedCode: http.StatusOK, expectedAllow: "https://pr-42.preview.example.com"},
+		{name: "Other Origin", method: http.MethodGet, origin: "https://evil.example.org", expectedCode: http.StatusOK},
+		{name: "Preflight", method: http.MethodOptions, origin: "https://app.example.com", preflight: true, expectedCode: http.StatusNoContent, expectedAllow: "https://app.example.com"},
+		{name: "Preflight From Other Origin", method: http.MethodOptions, origin: "https://evil.example.org", preflight: true, expectedCode: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/users/user1", nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+				req.Header.Set("Access-Control-Request-Headers", "authorization")
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			assert.Equal(t, tc.expectedAllow, rr.Header().Get("Access-Control-Allow-Origin"))
+			if tc.origin != "" {
+				assert.Contains(t, rr.Header().Values("Vary"), "Origin")
+			}
+			if tc.expectedAllow == "" {
+				return
+			}
+			assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+			if tc.preflight {
+				assert.Contains(t, rr.Header().Get("Access-Control-Allow-Methods"), http.MethodGet)
+				assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+				assert.Equal(t, "300", rr.Header().Get("Access-Control-Max-Age"))
+			} else {
+				assert.Equal(t, "ETag", rr.Header().Get("Access-Control-Expose-Headers"))
+			}
+		})
+	}
+}
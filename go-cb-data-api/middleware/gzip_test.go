@@ -0,0 +1,65 @@
+package middleware_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGzip checks which responses get compressed and that compressed
+// bodies decode to the original.
+func TestGzip(t *testing.T) {
+	large := strings.Repeat(`{"name":"John Doe"},`, 100)
+	router := gin.New()
+	router.Use(middleware.Gzip())
+	router.GET("/json", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(large)) })
+	router.GET("/small", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"id": "user1"}) })
+	router.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(large)) })
+	router.GET("/not-modified", func(c *gin.Context) { c.Status(http.StatusNotModified) })
+
+	testCases := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		expectedCode   int
+		compressed     bool
+	}{
+		{name: "Large JSON", path: "/json", acceptEncoding: "gzip, deflate, br", expectedCode: http.StatusOK, compressed: true},
+		{name: "Gzip Not Accepted", path: "/json", acceptEncoding: "br", expectedCode: http.StatusOK},
+		{name: "Gzip Refused", path: "/json", acceptEncoding: "gzip;q=0, identity", expectedCode: http.StatusOK},
+		{name: "Small Body", path: "/small", acceptEncoding: "gzip", expectedCode: http.StatusOK},
+		{name: "Image", path: "/image", acceptEncoding: "gzip", expectedCode: http.StatusOK},
+		{name: "Not Modified", path: "/not-modified", acceptEncoding: "gzip", expectedCode: http.StatusNotModified},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+			if !tc.compressed {
+				assert.Empty(t, rr.Header().Get("Content-Encoding"))
+				return
+			}
+			assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+			assert.Less(t, rr.Body.Len(), len(large))
+			zr, err := gzip.NewReader(rr.Body)
+			require.NoError(t, err)
+			body, err := io.ReadAll(zr)
+			require.NoError(t, err)
+			assert.Equal(t, large, string(body))
+		})
+	}
+}
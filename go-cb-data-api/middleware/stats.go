@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateWindow is how many recent seconds request rates are averaged over.
+const rateWindow = 60
+
+// RequestStats counts the requests served since it was created, for the
+// admin stats endpoint. Counts are per process.
+type RequestStats struct {
+	mu      sync.Mutex
+	started time.Time
+	total   uint64
+	// byClass counts responses by status class, 1xx to 5xx.
+	byClass [5]uint64
+	// conditional counts requests with If-None-Match, and notModified
+	// those answered 304 from the client's cached copy.
+	conditional uint64
+	notModified uint64
+	// seconds counts requests per second over the last rateWindow
+	// seconds, indexed by Unix second modulo rateWindow.
+	seconds [rateWindow]secondCount
+}
+
+type secondCount struct {
+	unix  int64
+	count uint64
+}
+
+// RequestSnapshot is a copy of the counts of RequestStats.
+type RequestSnapshot struct {
+	Total uint64 `json:"total"`
+	// ByStatus counts responses by status class, such as "2xx".
+	ByStatus map[string]uint64 `json:"by_status"`
+	// RatePerSecond averages the requests of the last minute, or of the
+	// uptime if shorter but at least a second.
+	RatePerSecond float64 `json:"rate_per_second"`
+	// Conditional counts requests revalidating a cached copy with
+	// If-None-Match; NotModified those whose copy was still current.
+	Conditional uint64 `json:"conditional"`
+	NotModified uint64 `json:"not_modified"`
+	// CacheHitRate is NotModified over Conditional, or 0 without
+	// conditional requests.
+	CacheHitRate  float64 `json:"cache_hit_rate"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+}
+
+// NewRequestStats returns empty RequestStats.
+func NewRequestStats() *RequestStats {
+	return &RequestStats{started: time.Now()}
+}
+
+// Middleware counts every request once it has been served.
+func (s *RequestStats) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		s.record(time.Now(), c.Writer.Status(), c.GetHeader("If-None-Match") != "")
+	}
+}
+
+func (s *RequestStats) record(now time.Time, status int, conditional bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	if class := status/100 - 1; class >= 0 && class < len(s.byClass) {
+		s.byClass[class]++
+	}
+	if conditional {
+		s.conditional++
+		if status == http.StatusNotModified {
+			s.notModified++
+		}
+	}
+	sec := &s.seconds[now.Unix()%rateWindow]
+	if sec.unix != now.Unix() {
+		*sec = secondCount{unix: now.Unix()}
+	}
+	sec.count++
+}
+
+// Snapshot returns the current counts.
+func (s *RequestStats) Snapshot() RequestSnapshot {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := RequestSnapshot{
+		Total:         s.total,
+		ByStatus:      make(map[string]uint64, len(s.byClass)),
+		Conditional:   s.conditional,
+		NotModified:   s.notModified,
+		UptimeSeconds: now.Sub(s.started).Seconds(),
+	}
+	for i, n := range s.byClass {
+		snap.ByStatus[fmt.Sprintf("%dxx", i+1)] = n
+	}
+	if s.conditional > 0 {
+		snap.CacheHitRate = float64(s.notModified) / float64(s.conditional)
+	}
+	var recent uint64
+	for _, sec := range s.seconds {
+		if now.Unix()-sec.unix < rateWindow {
+			recent += sec.count
+		}
+	}
+	// Average over at least a second, so a burst right after start does
+	// not read as a huge rate.
+	window := max(min(snap.UptimeSeconds, rateWindow), 1)
+	snap.RatePerSecond = float64(recent) / window
+	return snap
+}
@@ -0,0 +1,56 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRequestStats checks requests are counted by status class and that
+// only conditional requests answered 304 count as cache hits.
+func TestRequestStats(t *testing.T) {
+	stats := middleware.NewRequestStats()
+	router := gin.New()
+	router.Use(stats.Middleware())
+	router.GET("/users/:id", func(c *gin.Context) {
+		switch {
+		case c.Param("id") == "missing":
+			c.Status(http.StatusNotFound)
+		case c.GetHeader("If-None-Match") == `W/"1"`:
+			c.Status(http.StatusNotModified)
+		default:
+			c.Status(http.StatusOK)
+		}
+	})
+
+	testCases := []struct {
+		path        string
+		ifNoneMatch string
+	}{
+		{path: "/users/user1"},
+		{path: "/users/user1", ifNoneMatch: `W/"1"`},
+		{path: "/users/user1", ifNoneMatch: `W/"1"`},
+		{path: "/users/user1", ifNoneMatch: `W/"0"`},
+		{path: "/users/missing"},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", tc.ifNoneMatch)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	snap := stats.Snapshot()
+	assert.Equal(t, uint64(5), snap.Total)
+	assert.Equal(t, map[string]uint64{"1xx": 0, "2xx": 2, "3xx": 2, "4xx": 1, "5xx": 0}, snap.ByStatus)
+	assert.Equal(t, uint64(3), snap.Conditional)
+	assert.Equal(t, uint64(2), snap.NotModified)
+	assert.InDelta(t, 2.0/3, snap.CacheHitRate, 1e-9)
+	// Less than a second has passed, so the rate is averaged over one.
+	assert.InDelta(t, 5, snap.RatePerSecond, 1e-9)
+}
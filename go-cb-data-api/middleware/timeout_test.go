@@ -0,0 +1,55 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTimeout checks handlers see the request deadline, and none when the
+// timeout is disabled.
+func TestTimeout(t *testing.T) {
+	testCases := []struct {
+		name        string
+		timeout     time.Duration
+		hasDeadline bool
+	}{
+		{name: "Enabled", timeout: 20 * time.Millisecond, hasDeadline: true},
+		{name: "Disabled", timeout: 0, hasDeadline: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var ctxErr error
+			hasDeadline := false
+			router := gin.New()
+			router.Use(middleware.Timeout(tc.timeout))
+			router.GET("/slow", func(c *gin.Context) {
+				ctx := c.Request.Context()
+				_, hasDeadline = ctx.Deadline()
+				select {
+				case <-ctx.Done():
+				case <-time.After(200 * time.Millisecond):
+				}
+				ctxErr = ctx.Err()
+				c.Status(http.StatusOK)
+			})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+			assert.Equal(t, tc.hasDeadline, hasDeadline)
+			if tc.hasDeadline {
+				assert.ErrorIs(t, ctxErr, context.DeadlineExceeded)
+			} else {
+				assert.NoError(t, ctxErr)
+			}
+		})
+	}
+}
@@ -1,8 +1,63 @@
 package model
 
+import (
+	"strings"
+	"time"
+)
+
 // User represents a user entity in the system.
 type User struct {
-	ID    string `json:"id" couchbase:"id"`
-	Name  string `json:"name" couchbase:"name"`
-	Email string `json:"email" couchbase:"email"`
+	ID   string `json:"id" couchbase:"id"`
+	Name string `json:"name" couchbase:"name"`
+
+	// PII is visible only to the roles listed in its visible tag; see
+	// package fieldmask.
+	Email string `json:"email" couchbase:"email" visible:"admin,support"`
+
+	// EmailLower is derived from Email for case-insensitive search.
+	EmailLower string `json:"email_lower,omitempty" couchbase:"email_lower" visible:"admin,support"`
+
+	Avatar *Avatar `json:"avatar,omitempty" couchbase:"avatar"`
+
+	// CreatedAt is set when the user is first inserted. Users stored
+	// before it was introduced have none.
+	CreatedAt *time.Time `json:"created_at,omitempty" couchbase:"created_at"`
+
+	// PasswordHash is the bcrypt hash of the user's password, if they have
+	// one. It is stored and backed up with the user but never served.
+	PasswordHash string `json:"password_hash,omitempty" couchbase:"password_hash"`
+}
+
+// Avatar describes a user's avatar image kept in object storage. URL is
+// the permanent object location; clients download through signed URLs.
+type Avatar struct {
+	Key         string    `json:"key" couchbase:"key"`
+	URL         string    `json:"url" couchbase:"url"`
+	ContentType string    `json:"content_type" couchbase:"content_type"`
+	Size        int64     `json:"size" couchbase:"size"`
+	UpdatedAt   time.Time `json:"updated_at" couchbase:"updated_at"`
+}
+
+// UserFields lists the JSON fields of User that can be requested
+// individually, e.g. with GET /users/:id?fields=name,email.
+var UserFields = []string{"id", "name", "email", "email_lower", "avatar", "created_at"}
+
+// ApplyDerivedFields recomputes the denormalized fields of the user and
+// reports whether any of them changed.
+func (u *User) ApplyDerivedFields() bool {
+	emailLower := strings.ToLower(strings.TrimSpace(u.Email))
+	if u.EmailLower == emailLower {
+		return false
+	}
+	u.EmailLower = emailLower
+	return true
+}
+
+// SetCreatedAt records now as the creation time of a user that has none,
+// keeping the original time of users being restored or re-inserted.
+func (u *User) SetCreatedAt(now time.Time) {
+	if u.CreatedAt == nil {
+		now = now.UTC()
+		u.CreatedAt = &now
+	}
 }
@@ -0,0 +1,53 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher publishes changes as JSON messages keyed by tenant and
+// user ID, so all changes to one user land on the same partition in order.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher publishes to topic on the given brokers, waiting for
+// every in-sync replica to acknowledge each batch.
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, changes []*Change) error {
+	msgs := make([]kafka.Message, len(changes))
+	for i, c := range changes {
+		value, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		key := c.UserID
+		if c.Tenant != "" {
+			key = c.Tenant + "/" + c.UserID
+		}
+		msgs[i] = kafka.Message{
+			Key:     []byte(key),
+			Value:   value,
+			Time:    c.CreatedAt,
+			Headers: []kafka.Header{{Key: "op", Value: []byte(c.Op)}},
+		}
+	}
+	return p.writer.WriteMessages(ctx, msgs...)
+}
+
+// Close flushes and closes the connection to the brokers.
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,124 @@
+// Package outbox ships user changes to downstream consumers. Every user
+// write appends a Change to an outbox Store, and a Relay publishes pending
+// changes, oldest first, and removes them only once the Publisher has
+// acknowledged them. A change is therefore delivered at least once, even
+// if the broker or this process is down when the write happens, and
+// consumers must tolerate duplicates.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+)
+
+// Op names the kind of write a Change records.
+type Op string
+
+const (
+	OpInsert Op = "insert"
+	OpUpsert Op = "upsert"
+	OpAvatar Op = "avatar"
+	OpDelete Op = "delete"
+)
+
+// Change records one user write. User is the user as stored after it, or
+// as it was before a delete.
+type Change struct {
+	// ID sorts in creation order.
+	ID        string      `json:"id"`
+	Tenant    string      `json:"tenant,omitempty"`
+	Op        Op          `json:"op"`
+	UserID    string      `json:"user_id"`
+	User      *model.User `json:"user"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// NewChange returns a change recorded at now with a fresh ID. The user's
+// password hash is left out; consumers have no use for it.
+func NewChange(now time.Time, tenant string, op Op, user *model.User) *Change {
+	copied := *user
+	copied.PasswordHash = ""
+	var suffix [6]byte
+	_, _ = rand.Read(suffix[:])
+	now = now.UTC()
+	return &Change{
+		ID:        now.Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix[:]),
+		Tenant:    tenant,
+		Op:        op,
+		UserID:    user.ID,
+		User:      &copied,
+		CreatedAt: now,
+	}
+}
+
+// Store keeps changes until they are published.
+type Store interface {
+	Append(ctx context.Context, change *Change) error
+	// Pending returns up to limit changes in ID order.
+	Pending(ctx context.Context, limit int) ([]*Change, error)
+	// Remove deletes published changes. Unknown IDs are ignored.
+	Remove(ctx context.Context, ids []string) error
+}
+
+// Publisher delivers changes to consumers. Publish returns nil only once
+// every change is acknowledged; after an error some of them may have been
+// delivered and will be published again.
+type Publisher interface {
+	Publish(ctx context.Context, changes []*Change) error
+}
+
+// MemoryStore is a Store for tests and local development.
+type MemoryStore struct {
+	mu      sync.Mutex
+	changes map[string]*Change
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{changes: make(map[string]*Change)}
+}
+
+func (s *MemoryStore) Append(ctx context.Context, change *Change) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes[change.ID] = change
+	return nil
+}
+
+func (s *MemoryStore) Pending(ctx context.Context, limit int) ([]*Change, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := make([]*Change, 0, len(s.changes))
+	for _, c := range s.changes {
+		pending = append(pending, c)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (s *MemoryStore) Remove(ctx context.Context, ids []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.changes, id)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Relay moves changes from a Store to a Publisher.
+type Relay struct {
+	Store     Store
+	Publisher Publisher
+	// BatchSize caps the changes published at once. Default 100.
+	BatchSize int
+	// Interval is how often an idle relay polls the store. Default 1s.
+	Interval time.Duration
+	// MaxBackoff caps the wait after consecutive failures. Default 30s.
+	MaxBackoff time.Duration
+}
+
+// RelayOnce publishes the oldest pending batch and removes it from the
+// store, returning how many changes it published. If removing fails the
+// batch is published again next time.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	pending, err := r.Store.Pending(ctx, r.batchSize())
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+	if err := r.Publisher.Publish(ctx, pending); err != nil {
+		return 0, err
+	}
+	ids := make([]string, len(pending))
+	for i, c := range pending {
+		ids[i] = c.ID
+	}
+	if err := r.Store.Remove(ctx, ids); err != nil {
+		return 0, err
+	}
+	return len(pending), nil
+}
+
+// Run relays until ctx is done. Full batches are followed by the next one
+// straight away; failures are logged and retried with exponential backoff.
+func (r *Relay) Run(ctx context.Context) {
+	interval, maxBackoff := r.Interval, r.MaxBackoff
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	backoff := interval
+	for {
+		n, err := r.RelayOnce(ctx)
+		wait := interval
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			log.Printf("outbox relay failed, retrying in %s: %v", backoff, err)
+			wait = backoff
+			backoff = min(2*backoff, maxBackoff)
+		case n == r.batchSize():
+			backoff = interval
+			continue
+		default:
+			backoff = interval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (r *Relay) batchSize() int {
+	if r.BatchSize <= 0 {
+		return 100
+	}
+	return r.BatchSize
+}
@@ -0,0 +1,90 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePublisher records published user IDs and fails while err is set.
+type fakePublisher struct {
+	published []string
+	err       error
+}
+
+func (p *fakePublisher) Publish(_ context.Context, changes []*outbox.Change) error {
+	if p.err != nil {
+		return p.err
+	}
+	for _, c := range changes {
+		p.published = append(p.published, c.UserID)
+	}
+	return nil
+}
+
+func appendChanges(t *testing.T, store outbox.Store, userIDs ...string) {
+	t.Helper()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range userIDs {
+		change := outbox.NewChange(start.Add(time.Duration(i)*time.Millisecond), "", outbox.OpUpsert, &model.User{ID: id})
+		require.NoError(t, store.Append(context.Background(), change))
+	}
+}
+
+// TestRelayOnce checks changes are published in order, in batches, and
+// stay in the store until a publish succeeds.
+func TestRelayOnce(t *testing.T) {
+	ctx := context.Background()
+	store := outbox.NewMemoryStore()
+	publisher := &fakePublisher{err: errors.New("broker down")}
+	relay := &outbox.Relay{Store: store, Publisher: publisher, BatchSize: 2}
+	appendChanges(t, store, "user3", "user1", "user2")
+
+	_, err := relay.RelayOnce(ctx)
+	assert.Error(t, err)
+	pending, err := store.Pending(ctx, 10)
+	require.NoError(t, err)
+	assert.Len(t, pending, 3, "failed publish removed changes")
+
+	publisher.err = nil
+	n, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.Equal(t, []string{"user3", "user1", "user2"}, publisher.published)
+}
+
+// TestRelayRun checks the relay drains the store and stops with ctx.
+func TestRelayRun(t *testing.T) {
+	store := outbox.NewMemoryStore()
+	publisher := &fakePublisher{}
+	relay := &outbox.Relay{Store: store, Publisher: publisher, BatchSize: 2, Interval: time.Millisecond}
+	appendChanges(t, store, "user1", "user2", "user3", "user4", "user5")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		pending, _ := store.Pending(context.Background(), 10)
+		return len(pending) == 0
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, []string{"user1", "user2", "user3", "user4", "user5"}, publisher.published)
+}
@@ -0,0 +1,224 @@
+// Package quota limits how many requests each API key may make per UTC
+// day. Every request presenting a key counts against it in a Store shared
+// by all instances, and responses tell the caller their limit, what is left
+// of it and when it resets.
+//
+// Limiting is soft: requests without a key, and every request while the
+// Store cannot be reached, are let through, so a quota outage never takes
+// the API down with it.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultHeader is the request header the API key is read from by default.
+const DefaultHeader = "X-API-Key"
+
+// Response headers describing the caller's quota.
+const (
+	HeaderLimit     = "X-RateLimit-Limit"
+	HeaderRemaining = "X-RateLimit-Remaining"
+	// HeaderReset is when the quota resets, in Unix seconds.
+	HeaderReset = "X-RateLimit-Reset"
+)
+
+// ErrNotFound is returned for API keys without a quota of their own.
+var ErrNotFound = errors.New("quota not found")
+
+// Quota is the daily request limit of an API key.
+type Quota struct {
+	// Daily is the number of requests allowed per UTC day. Zero blocks
+	// the key.
+	Daily     int64     `json:"daily_limit"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store keeps quotas and counts requests per key and day.
+type Store interface {
+	// Quota returns the quota set for key, or ErrNotFound.
+	Quota(ctx context.Context, key string) (*Quota, error)
+	SetQuota(ctx context.Context, key string, q *Quota) error
+	// DeleteQuota removes the quota set for key. Unknown keys are ignored.
+	DeleteQuota(ctx context.Context, key string) error
+	// Increment counts a request of key on day, the UTC midnight starting
+	// it, and returns the day's count including it.
+	Increment(ctx context.Context, key string, day time.Time) (int64, error)
+	// Usage returns the day's count without changing it.
+	Usage(ctx context.Context, key string, day time.Time) (int64, error)
+}
+
+// Config controls which requests count against which quota.
+type Config struct {
+	// Header is the request header holding the API key. Empty means
+	// DefaultHeader.
+	Header string
+	// Default is the daily limit of keys without a quota of their own.
+	// Zero leaves them unlimited.
+	Default int64
+	// Required rejects requests without an API key.
+	Required bool
+}
+
+// ConfigFromEnv reads QUOTA_HEADER, QUOTA_DEFAULT_DAILY and QUOTA_REQUIRED.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Header: os.Getenv("QUOTA_HEADER"), Required: os.Getenv("QUOTA_REQUIRED") == "true"}
+	if v := os.Getenv("QUOTA_DEFAULT_DAILY"); v != "" {
+		daily, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || daily < 0 {
+			return Config{}, fmt.Errorf("QUOTA_DEFAULT_DAILY: %q is not a non-negative number", v)
+		}
+		cfg.Default = daily
+	}
+	return cfg, nil
+}
+
+// HeaderName returns the request header holding the API key.
+func (c Config) HeaderName() string {
+	if c.Header == "" {
+		return DefaultHeader
+	}
+	return c.Header
+}
+
+// Limit returns the daily limit of key: its own quota, or else the
+// default. It reports false for keys without any limit.
+func (c Config) Limit(ctx context.Context, store Store, key string) (int64, bool, error) {
+	q, err := store.Quota(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return c.Default, c.Default > 0, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return q.Daily, true, nil
+}
+
+// Day returns the UTC day t falls on, as its starting midnight.
+func Day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// Middleware counts each request presenting an API key against the key's
+// quota and sets the X-RateLimit headers. Requests over the quota get a
+// 429 until it resets; requests without a key get a 401 when cfg.Required
+// is set. Errors from store are logged and the request is let through.
+func Middleware(cfg Config, store Store) gin.HandlerFunc {
+	header := cfg.HeaderName()
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(header))
+		if key == "" {
+			if cfg.Required {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key is required", "code": "api_key_required"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		limit, limited, err := cfg.Limit(ctx, store, key)
+		if err != nil {
+			logStoreError(err)
+			c.Next()
+			return
+		}
+		if !limited {
+			c.Next()
+			return
+		}
+		now := time.Now()
+		day := Day(now)
+		used, err := store.Increment(ctx, key, day)
+		if err != nil {
+			logStoreError(err)
+			c.Next()
+			return
+		}
+
+		reset := day.Add(24 * time.Hour)
+		c.Header(HeaderLimit, strconv.FormatInt(limit, 10))
+		c.Header(HeaderRemaining, strconv.FormatInt(max(limit-used, 0), 10))
+		c.Header(HeaderReset, strconv.FormatInt(reset.Unix(), 10))
+		if used > limit {
+			// Round up so clients retrying after Retry-After are not early.
+			c.Header("Retry-After", strconv.FormatInt(int64((reset.Sub(now)+time.Second-1)/time.Second), 10))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":    "Daily request quota exceeded",
+				"code":     "quota_exceeded",
+				"limit":    limit,
+				"reset_at": reset,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func logStoreError(err error) {
+	log.Printf("quota: letting request through: %v", err)
+}
+
+// MemoryStore is a Store for tests and local development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	quotas map[string]Quota
+	usage  map[string]int64
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{quotas: make(map[string]Quota), usage: make(map[string]int64)}
+}
+
+func usageKey(key string, day time.Time) string {
+	return day.Format("20060102") + "/" + key
+}
+
+func (s *MemoryStore) Quota(ctx context.Context, key string) (*Quota, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.quotas[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &q, nil
+}
+
+func (s *MemoryStore) SetQuota(ctx context.Context, key string, q *Quota) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quotas[key] = *q
+	return nil
+}
+
+func (s *MemoryStore) DeleteQuota(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.quotas, key)
+	return nil
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, day time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage[usageKey(key, day)]++
+	return s.usage[usageKey(key, day)], nil
+}
+
+func (s *MemoryStore) Usage(ctx context.Context, key string, day time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[usageKey(key, day)], nil
+}
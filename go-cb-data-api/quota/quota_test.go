@@ -0,0 +1,117 @@
+package quota_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/quota"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConfigFromEnv checks the default limit is parsed and negative
+// limits are rejected.
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("QUOTA_DEFAULT_DAILY", "1000")
+	t.Setenv("QUOTA_REQUIRED", "true")
+	cfg, err := quota.ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, quota.Config{Default: 1000, Required: true}, cfg)
+	assert.Equal(t, quota.DefaultHeader, cfg.HeaderName())
+
+	t.Setenv("QUOTA_DEFAULT_DAILY", "-1")
+	_, err = quota.ConfigFromEnv()
+	assert.Error(t, err)
+}
+
+// TestMiddleware checks requests count against the key's own quota or the
+// default, with headers reporting what is left, until they get a 429.
+func TestMiddleware(t *testing.T) {
+	store := quota.NewMemoryStore()
+	require.NoError(t, store.SetQuota(context.Background(), "partner", &quota.Quota{Daily: 3}))
+	require.NoError(t, store.SetQuota(context.Background(), "blocked", &quota.Quota{Daily: 0}))
+
+	router := gin.New()
+	router.Use(quota.Middleware(quota.Config{Default: 1}, store))
+	router.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		if key != "" {
+			req.Header.Set(quota.DefaultHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	reset := strconv.FormatInt(quota.Day(time.Now()).Add(24*time.Hour).Unix(), 10)
+	for _, remaining := range []string{"2", "1", "0"} {
+		rr := do("partner")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "3", rr.Header().Get(quota.HeaderLimit))
+		assert.Equal(t, remaining, rr.Header().Get(quota.HeaderRemaining))
+		assert.Equal(t, reset, rr.Header().Get(quota.HeaderReset))
+	}
+
+	rr := do("partner")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "0", rr.Header().Get(quota.HeaderRemaining))
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.Equal(t, "quota_exceeded", body["code"])
+	assert.Equal(t, float64(3), body["limit"])
+
+	assert.Equal(t, http.StatusTooManyRequests, do("blocked").Code)
+	assert.Equal(t, http.StatusOK, do("other").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do("other").Code, "default quota")
+	assert.Equal(t, http.StatusOK, do("").Code, "requests without a key are not limited")
+}
+
+// TestMiddlewareRequired checks requests without a key are rejected when
+// keys are required.
+func TestMiddlewareRequired(t *testing.T) {
+	router := gin.New()
+	router.Use(quota.Middleware(quota.Config{Header: "X-Client-Key", Required: true}, quota.NewMemoryStore()))
+	router.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("X-Client-Key", "partner")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(quota.HeaderLimit), "no quota applies")
+}
+
+// failingStore is a Store whose cluster is unreachable.
+type failingStore struct{ *quota.MemoryStore }
+
+func (failingStore) Quota(ctx context.Context, key string) (*quota.Quota, error) {
+	return nil, errors.New("cluster unavailable")
+}
+
+// TestMiddlewareStoreError checks requests are let through when quotas
+// cannot be read.
+func TestMiddlewareStoreError(t *testing.T) {
+	router := gin.New()
+	router.Use(quota.Middleware(quota.Config{Default: 1}, failingStore{quota.NewMemoryStore()}))
+	router.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set(quota.DefaultHeader, "partner")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
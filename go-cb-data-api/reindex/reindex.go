@@ -0,0 +1,277 @@
+// Package reindex rebuilds the derived fields of every user document with a
+// resumable background worker.
+package reindex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+)
+
+// ErrRunning is returned when a reindex is already in progress.
+var ErrRunning = errors.New("a reindex is already running")
+
+// Reindex states.
+const (
+	StateIdle      = "idle"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+)
+
+// Checkpoint is the persisted position of a reindex, written after every batch.
+type Checkpoint struct {
+	LastID    string    `json:"last_id"`
+	Processed int       `json:"processed"`
+	Updated   int       `json:"updated"`
+	Completed bool      `json:"completed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CheckpointStore persists checkpoints so a reindex survives restarts.
+type CheckpointStore interface {
+	Load() (*Checkpoint, error)
+	Save(cp *Checkpoint) error
+}
+
+// FileCheckpoint stores the checkpoint as JSON in a local file.
+type FileCheckpoint struct {
+	Path string
+}
+
+// Load returns the saved checkpoint, or nil when there is none.
+func (f *FileCheckpoint) Load() (*Checkpoint, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("read checkpoint %s: %w", f.Path, err)
+	}
+	return &cp, nil
+}
+
+// Save atomically replaces the checkpoint file.
+func (f *FileCheckpoint) Save(cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+// Status reports the progress of the current or last reindex.
+type Status struct {
+	State      string     `json:"state"`
+	Resumed    bool       `json:"resumed"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Updated    int        `json:"updated"`
+	LastID     string     `json:"last_id,omitempty"`
+	Percent    float64    `json:"percent"`
+	Rate       float64    `json:"rate_per_second"`
+	ETASeconds *float64   `json:"eta_seconds,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Reindexer walks the users collection in ID order and rewrites documents
+// whose derived fields are stale. Only one reindex runs at a time.
+type Reindexer struct {
+	Repo        repository.UserRepository
+	Checkpoints CheckpointStore
+	BatchSize   int
+
+	mu       sync.Mutex
+	status   Status
+	runStart int
+	cancel   context.CancelFunc
+	done     chan struct{}
+	clock    func() time.Time
+}
+
+// NewReindexer creates a Reindexer processing users in batches of 500.
+func NewReindexer(repo repository.UserRepository, checkpoints CheckpointStore) *Reindexer {
+	return &Reindexer{
+		Repo:        repo,
+		Checkpoints: checkpoints,
+		BatchSize:   500,
+		status:      Status{State: StateIdle},
+		clock:       time.Now,
+	}
+}
+
+// Start launches a reindex in the background. It resumes from the saved
+// checkpoint unless restart is set or the previous reindex completed.
+func (r *Reindexer) Start(restart bool) (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status.State == StateRunning {
+		return r.status, ErrRunning
+	}
+
+	cp, err := r.Checkpoints.Load()
+	if err != nil {
+		return r.status, err
+	}
+	resumed := cp != nil && !cp.Completed && !restart
+	if !resumed {
+		cp = &Checkpoint{}
+	}
+	total, err := r.Repo.CountUsers(context.Background())
+	if err != nil {
+		return r.status, fmt.Errorf("count users: %w", err)
+	}
+
+	now := r.clock().UTC()
+	r.status = Status{
+		State:     StateRunning,
+		Resumed:   resumed,
+		Total:     total,
+		Processed: cp.Processed,
+		Updated:   cp.Updated,
+		LastID:    cp.LastID,
+		StartedAt: &now,
+	}
+	r.runStart = cp.Processed
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go r.run(ctx, cp, r.done)
+	return r.snapshotLocked(), nil
+}
+
+// Cancel stops a running reindex after its current batch. The checkpoint is
+// kept so the next Start resumes where it stopped.
+func (r *Reindexer) Cancel() bool {
+	r.mu.Lock()
+	if r.status.State != StateRunning {
+		r.mu.Unlock()
+		return false
+	}
+	r.cancel()
+	done := r.done
+	r.mu.Unlock()
+	<-done
+	return true
+}
+
+// Status returns the progress of the current or last reindex, including an
+// ETA based on this run's throughput.
+func (r *Reindexer) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshotLocked()
+}
+
+func (r *Reindexer) snapshotLocked() Status {
+	s := r.status
+	if s.Total > 0 {
+		s.Percent = float64(s.Processed) / float64(s.Total) * 100
+		if s.Percent > 100 {
+			s.Percent = 100
+		}
+	}
+	if s.StartedAt == nil {
+		return s
+	}
+	end := r.clock()
+	if s.FinishedAt != nil {
+		end = *s.FinishedAt
+	}
+	if elapsed := end.Sub(*s.StartedAt).Seconds(); elapsed > 0 {
+		s.Rate = float64(s.Processed-r.runStart) / elapsed
+	}
+	if s.State == StateRunning && s.Rate > 0 {
+		remaining := s.Total - s.Processed
+		if remaining < 0 {
+			remaining = 0
+		}
+		eta := float64(remaining) / s.Rate
+		s.ETASeconds = &eta
+	}
+	return s
+}
+
+func (r *Reindexer) run(ctx context.Context, cp *Checkpoint, done chan struct{}) {
+	defer close(done)
+	err := r.process(ctx, cp)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock().UTC()
+	r.status.FinishedAt = &now
+	switch {
+	case errors.Is(err, context.Canceled):
+		r.status.State = StateCancelled
+	case err != nil:
+		r.status.State = StateFailed
+		r.status.Error = err.Error()
+		log.Printf("reindex failed after %s: %v", cp.LastID, err)
+	default:
+		r.status.State = StateSucceeded
+	}
+}
+
+func (r *Reindexer) process(ctx context.Context, cp *Checkpoint) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		users, err := r.Repo.ListUsersAfter(ctx, cp.LastID, r.BatchSize)
+		if err != nil {
+			return fmt.Errorf("list users after %q: %w", cp.LastID, err)
+		}
+		if len(users) == 0 {
+			cp.Completed = true
+			cp.UpdatedAt = r.clock().UTC()
+			return r.Checkpoints.Save(cp)
+		}
+
+		updated := 0
+		for _, user := range users {
+			if user.ApplyDerivedFields() {
+				if err := r.Repo.UpsertUser(ctx, user); err != nil {
+					return fmt.Errorf("user %s: %w", user.ID, err)
+				}
+				updated++
+			}
+		}
+
+		cp.LastID = users[len(users)-1].ID
+		cp.Processed += len(users)
+		cp.Updated += updated
+		cp.UpdatedAt = r.clock().UTC()
+		if err := r.Checkpoints.Save(cp); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+
+		r.mu.Lock()
+		r.status.Processed = cp.Processed
+		r.status.Updated = cp.Updated
+		r.status.LastID = cp.LastID
+		r.mu.Unlock()
+	}
+}
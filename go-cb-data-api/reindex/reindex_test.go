@@ -0,0 +1,95 @@
+package reindex_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/reindex"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForReindex polls until the reindex leaves the running state.
+func waitForReindex(t *testing.T, r *reindex.Reindexer) reindex.Status {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		status := r.Status()
+		if status.State != reindex.StateRunning {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("reindex did not finish")
+	return reindex.Status{}
+}
+
+// TestReindexResumesFromCheckpoint fails part-way through, then resumes
+// from the saved checkpoint without revisiting finished batches.
+func TestReindexResumesFromCheckpoint(t *testing.T) {
+	users := []*model.User{
+		{ID: "user1", Email: "John.Doe@Example.com"},
+		{ID: "user2", Email: "jane@example.com", EmailLower: "jane@example.com"},
+		{ID: "user3", Email: "MAX@example.com"},
+		{ID: "user4", Email: "Erika@example.com"},
+	}
+	listAfter := func(ctx context.Context, afterID string, limit int) ([]*model.User, error) {
+		i := sort.Search(len(users), func(i int) bool { return users[i].ID > afterID })
+		end := i + limit
+		if end > len(users) {
+			end = len(users)
+		}
+		// Copy like a real query would, so failed writes are not kept.
+		page := make([]*model.User, 0, end-i)
+		for _, u := range users[i:end] {
+			copied := *u
+			page = append(page, &copied)
+		}
+		return page, nil
+	}
+
+	mockRepo := mocks.NewUserRepository(t)
+	mockRepo.On("CountUsers", mock.Anything).Return(len(users), nil)
+	mockRepo.On("ListUsersAfter", mock.Anything, mock.Anything, mock.Anything).Return(listAfter)
+	mockRepo.On("UpsertUser", mock.Anything, mock.MatchedBy(func(u *model.User) bool { return u.ID == "user1" })).
+		Return(nil).Once()
+	mockRepo.On("UpsertUser", mock.Anything, mock.MatchedBy(func(u *model.User) bool { return u.ID == "user3" })).
+		Return(errors.New("temporary failure")).Once()
+
+	checkpoints := &reindex.FileCheckpoint{Path: filepath.Join(t.TempDir(), "checkpoint.json")}
+	r := reindex.NewReindexer(mockRepo, checkpoints)
+	r.BatchSize = 2
+
+	_, err := r.Start(false)
+	require.NoError(t, err)
+	status := waitForReindex(t, r)
+	assert.Equal(t, reindex.StateFailed, status.State)
+	assert.Equal(t, 2, status.Processed)
+	assert.Equal(t, "user2", status.LastID)
+
+	mockRepo.On("UpsertUser", mock.Anything, mock.Anything).Return(nil)
+	status, err = r.Start(false)
+	require.NoError(t, err)
+	assert.True(t, status.Resumed)
+	status = waitForReindex(t, r)
+	assert.Equal(t, reindex.StateSucceeded, status.State, status.Error)
+	assert.Equal(t, 4, status.Processed)
+	assert.Equal(t, 3, status.Updated)
+	assert.Equal(t, 100.0, status.Percent)
+
+	cp, err := checkpoints.Load()
+	require.NoError(t, err)
+	assert.True(t, cp.Completed)
+
+	// A completed checkpoint starts over instead of resuming.
+	status, err = r.Start(false)
+	require.NoError(t, err)
+	assert.False(t, status.Resumed)
+	waitForReindex(t, r)
+}
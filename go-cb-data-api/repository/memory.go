@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+)
+
+// memoryUserRepository implements UserRepository in memory, keeping a
+// separate set of users per tenant like the Couchbase scopes do. It is
+// meant for tests and local development.
+type memoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[string]map[string]model.User
+	// cas holds each user's CAS, keyed like users, taken from lastCAS on
+	// every write.
+	cas     map[string]map[string]uint64
+	lastCAS uint64
+}
+
+// NewMemoryUserRepository creates an empty in-memory UserRepository.
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{
+		users: make(map[string]map[string]model.User),
+		cas:   make(map[string]map[string]uint64),
+	}
+}
+
+// store saves user for the tenant in ctx under a new CAS. Callers must
+// hold the write lock.
+func (r *memoryUserRepository) store(ctx context.Context, user model.User) {
+	r.tenantUsers(ctx, true)[user.ID] = user
+	id, _ := tenant.FromContext(ctx)
+	if r.cas[id] == nil {
+		r.cas[id] = make(map[string]uint64)
+	}
+	r.lastCAS++
+	r.cas[id][user.ID] = r.lastCAS
+}
+
+// tenantUsers returns the users of the tenant in ctx, creating the map if
+// create is set. Callers must hold the lock.
+func (r *memoryUserRepository) tenantUsers(ctx context.Context, create bool) map[string]model.User {
+	id, _ := tenant.FromContext(ctx)
+	users := r.users[id]
+	if users == nil && create {
+		users = make(map[string]model.User)
+		r.users[id] = users
+	}
+	return users
+}
+
+// sorted returns copies of the users of the tenant in ctx in ID order.
+func (r *memoryUserRepository) sorted(ctx context.Context) []*model.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	users := r.tenantUsers(ctx, false)
+	sorted := make([]*model.User, 0, len(users))
+	for _, u := range users {
+		u := u
+		sorted = append(sorted, &u)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return sorted
+}
+
+func (r *memoryUserRepository) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	user, _, err := r.GetUserWithCAS(ctx, id)
+	return user, err
+}
+
+func (r *memoryUserRepository) GetUserWithCAS(ctx context.Context, id string) (*model.User, uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	user, ok := r.tenantUsers(ctx, false)[id]
+	if !ok {
+		return nil, 0, ErrNotFound
+	}
+	tenantID, _ := tenant.FromContext(ctx)
+	return &user, r.cas[tenantID][id], nil
+}
+
+func (r *memoryUserRepository) GetUserFields(ctx context.Context, id string, fields []string) (map[string]json.RawMessage, error) {
+	user, err := r.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Go through JSON so fields match the stored document, omitempty and all.
+	b, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	values := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := doc[field]; ok {
+			values[field] = value
+		}
+	}
+	return values, nil
+}
+
+func (r *memoryUserRepository) InsertUser(ctx context.Context, user *model.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	user.ApplyDerivedFields()
+	user.SetCreatedAt(time.Now())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tenantUsers(ctx, false)[user.ID]; ok {
+		return ErrAlreadyExists
+	}
+	r.store(ctx, *user)
+	return nil
+}
+
+func (r *memoryUserRepository) UpsertUser(ctx context.Context, user *model.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	user.ApplyDerivedFields()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store(ctx, *user)
+	return nil
+}
+
+func (r *memoryUserRepository) SetUserAvatar(ctx context.Context, id string, avatar *model.Avatar) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.tenantUsers(ctx, false)[id]
+	if !ok {
+		return ErrNotFound
+	}
+	copied := *avatar
+	user.Avatar = &copied
+	r.store(ctx, user)
+	return nil
+}
+
+func (r *memoryUserRepository) SetUserPassword(ctx context.Context, id string, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.tenantUsers(ctx, false)[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.PasswordHash = hash
+	r.store(ctx, user)
+	return nil
+}
+
+func (r *memoryUserRepository) ScanUsers(ctx context.Context, fn func(*model.User) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, user := range r.sorted(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) ListUsersAfter(ctx context.Context, afterID string, limit int) ([]*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	users := r.sorted(ctx)
+	i := sort.Search(len(users), func(i int) bool { return users[i].ID > afterID })
+	users = users[i:]
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	return users, nil
+}
+
+func (r *memoryUserRepository) CountUsers(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.tenantUsers(ctx, false)), nil
+}
+
+func (r *memoryUserRepository) CountUsersCreatedSince(ctx context.Context, since time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	count := 0
+	for _, user := range r.tenantUsers(ctx, false) {
+		if user.CreatedAt != nil && !user.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryUserRepository) CountUsersMatching(ctx context.Context, sel Selector) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	count := 0
+	for _, user := range r.tenantUsers(ctx, false) {
+		if sel.Matches(&user) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryUserRepository) DeleteUsersMatching(ctx context.Context, sel Selector) ([]*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	users := r.tenantUsers(ctx, false)
+	tenantID, _ := tenant.FromContext(ctx)
+	var deleted []*model.User
+	for id, user := range users {
+		if !sel.Matches(&user) {
+			continue
+		}
+		user := user
+		deleted = append(deleted, &user)
+		delete(users, id)
+		delete(r.cas[tenantID], id)
+	}
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].ID < deleted[j].ID })
+	return deleted, nil
+}
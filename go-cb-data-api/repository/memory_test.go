@@ -0,0 +1,83 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/outbox"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository/repositorytest"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryUserRepositoryContract(t *testing.T) {
+	repositorytest.RunUserRepositoryContract(t, func(t *testing.T) (repository.UserRepository, context.Context) {
+		return repository.NewMemoryUserRepository(), context.Background()
+	})
+}
+
+// TestMemoryUserRepositoryTenants checks each tenant only sees its own users.
+func TestMemoryUserRepositoryTenants(t *testing.T) {
+	repo := repository.NewMemoryUserRepository()
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+
+	require.NoError(t, repo.InsertUser(acme, &model.User{ID: "user1", Name: "John Doe"}))
+	require.NoError(t, repo.InsertUser(globex, &model.User{ID: "user1", Name: "Jane Smith"}))
+
+	got, err := repo.GetUserByID(acme, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "John Doe", got.Name)
+
+	_, err = repo.GetUserByID(context.Background(), "user1")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	count, err := repo.CountUsers(globex)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestWithOutboxContract(t *testing.T) {
+	repositorytest.RunUserRepositoryContract(t, func(t *testing.T) (repository.UserRepository, context.Context) {
+		return repository.WithOutbox(repository.NewMemoryUserRepository(), outbox.NewMemoryStore()), context.Background()
+	})
+}
+
+// TestWithOutbox checks every successful write is recorded with its tenant
+// and the stored user, and failed writes are not.
+func TestWithOutbox(t *testing.T) {
+	store := outbox.NewMemoryStore()
+	repo := repository.WithOutbox(repository.NewMemoryUserRepository(), store)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "user1", Name: "John Doe", Email: "John@Example.com"}))
+	assert.ErrorIs(t, repo.InsertUser(ctx, &model.User{ID: "user1"}), repository.ErrAlreadyExists)
+	require.NoError(t, repo.UpsertUser(ctx, &model.User{ID: "user2", Name: "Jane Smith"}))
+	require.NoError(t, repo.SetUserAvatar(ctx, "user1", &model.Avatar{Key: "avatars/user1/a.png"}))
+	assert.ErrorIs(t, repo.SetUserAvatar(ctx, "missing", &model.Avatar{}), repository.ErrNotFound)
+
+	changes, err := store.Pending(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, outbox.OpInsert, changes[0].Op)
+	assert.Equal(t, "acme", changes[0].Tenant)
+	assert.Equal(t, "john@example.com", changes[0].User.EmailLower)
+	assert.Equal(t, outbox.OpUpsert, changes[1].Op)
+	assert.Equal(t, "user2", changes[1].UserID)
+	assert.Equal(t, outbox.OpAvatar, changes[2].Op)
+	assert.Equal(t, "John Doe", changes[2].User.Name, "avatar change lacks the rest of the user")
+	assert.Equal(t, "avatars/user1/a.png", changes[2].User.Avatar.Key)
+
+	require.NoError(t, store.Remove(context.Background(), []string{changes[0].ID, changes[1].ID, changes[2].ID}))
+	_, err = repo.DeleteUsersMatching(ctx, repository.Selector{{Field: "id", Value: "user*"}})
+	require.NoError(t, err)
+	changes, err = store.Pending(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, outbox.OpDelete, changes[0].Op)
+	assert.ElementsMatch(t, []string{"user1", "user2"}, []string{changes[0].UserID, changes[1].UserID})
+	assert.Equal(t, "acme", changes[1].Tenant)
+}
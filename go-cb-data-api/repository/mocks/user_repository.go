@@ -5,8 +5,14 @@ package mocks
 import (
 	context "context"
 
+	json "encoding/json"
+
 	model "github.com/gnsalok/go-project-root/go-db-data-api/model"
 	mock "github.com/stretchr/testify/mock"
+
+	repository "github.com/gnsalok/go-project-root/go-db-data-api/repository"
+
+	time "time"
 )
 
 // UserRepository is an autogenerated mock type for the UserRepository type
@@ -14,6 +20,120 @@ type UserRepository struct {
 	mock.Mock
 }
 
+// CountUsers provides a mock function with given fields: ctx
+func (_m *UserRepository) CountUsers(ctx context.Context) (int, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CountUsers")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (int, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) int); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountUsersCreatedSince provides a mock function with given fields: ctx, since
+func (_m *UserRepository) CountUsersCreatedSince(ctx context.Context, since time.Time) (int, error) {
+	ret := _m.Called(ctx, since)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CountUsersCreatedSince")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) (int, error)); ok {
+		return rf(ctx, since)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int); ok {
+		r0 = rf(ctx, since)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountUsersMatching provides a mock function with given fields: ctx, sel
+func (_m *UserRepository) CountUsersMatching(ctx context.Context, sel repository.Selector) (int, error) {
+	ret := _m.Called(ctx, sel)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CountUsersMatching")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, repository.Selector) (int, error)); ok {
+		return rf(ctx, sel)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, repository.Selector) int); ok {
+		r0 = rf(ctx, sel)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, repository.Selector) error); ok {
+		r1 = rf(ctx, sel)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteUsersMatching provides a mock function with given fields: ctx, sel
+func (_m *UserRepository) DeleteUsersMatching(ctx context.Context, sel repository.Selector) ([]*model.User, error) {
+	ret := _m.Called(ctx, sel)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteUsersMatching")
+	}
+
+	var r0 []*model.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, repository.Selector) ([]*model.User, error)); ok {
+		return rf(ctx, sel)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, repository.Selector) []*model.User); ok {
+		r0 = rf(ctx, sel)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, repository.Selector) error); ok {
+		r1 = rf(ctx, sel)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUserByID provides a mock function with given fields: ctx, id
 func (_m *UserRepository) GetUserByID(ctx context.Context, id string) (*model.User, error) {
 	ret := _m.Called(ctx, id)
@@ -44,6 +164,193 @@ func (_m *UserRepository) GetUserByID(ctx context.Context, id string) (*model.Us
 	return r0, r1
 }
 
+// GetUserFields provides a mock function with given fields: ctx, id, fields
+func (_m *UserRepository) GetUserFields(ctx context.Context, id string, fields []string) (map[string]json.RawMessage, error) {
+	ret := _m.Called(ctx, id, fields)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUserFields")
+	}
+
+	var r0 map[string]json.RawMessage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) (map[string]json.RawMessage, error)); ok {
+		return rf(ctx, id, fields)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) map[string]json.RawMessage); ok {
+		r0 = rf(ctx, id, fields)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]json.RawMessage)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
+		r1 = rf(ctx, id, fields)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserWithCAS provides a mock function with given fields: ctx, id
+func (_m *UserRepository) GetUserWithCAS(ctx context.Context, id string) (*model.User, uint64, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUserWithCAS")
+	}
+
+	var r0 *model.User
+	var r1 uint64
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*model.User, uint64, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) uint64); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Get(1).(uint64)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string) error); ok {
+		r2 = rf(ctx, id)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// InsertUser provides a mock function with given fields: ctx, user
+func (_m *UserRepository) InsertUser(ctx context.Context, user *model.User) error {
+	ret := _m.Called(ctx, user)
+
+	if len(ret) == 0 {
+		panic("no return value specified for InsertUser")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.User) error); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ListUsersAfter provides a mock function with given fields: ctx, afterID, limit
+func (_m *UserRepository) ListUsersAfter(ctx context.Context, afterID string, limit int) ([]*model.User, error) {
+	ret := _m.Called(ctx, afterID, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListUsersAfter")
+	}
+
+	var r0 []*model.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) ([]*model.User, error)); ok {
+		return rf(ctx, afterID, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []*model.User); ok {
+		r0 = rf(ctx, afterID, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, afterID, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ScanUsers provides a mock function with given fields: ctx, fn
+func (_m *UserRepository) ScanUsers(ctx context.Context, fn func(*model.User) error) error {
+	ret := _m.Called(ctx, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ScanUsers")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(*model.User) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetUserAvatar provides a mock function with given fields: ctx, id, avatar
+func (_m *UserRepository) SetUserAvatar(ctx context.Context, id string, avatar *model.Avatar) error {
+	ret := _m.Called(ctx, id, avatar)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetUserAvatar")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *model.Avatar) error); ok {
+		r0 = rf(ctx, id, avatar)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetUserPassword provides a mock function with given fields: ctx, id, hash
+func (_m *UserRepository) SetUserPassword(ctx context.Context, id string, hash string) error {
+	ret := _m.Called(ctx, id, hash)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetUserPassword")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, hash)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpsertUser provides a mock function with given fields: ctx, user
+func (_m *UserRepository) UpsertUser(ctx context.Context, user *model.User) error {
+	ret := _m.Called(ctx, user)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpsertUser")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.User) error); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewUserRepository creates a new instance of UserRepository. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewUserRepository(t interface {
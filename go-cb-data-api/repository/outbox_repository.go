@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/outbox"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+)
+
+// OutboxCollection is the collection in the bucket's default scope holding
+// unpublished user changes of every tenant.
+const OutboxCollection = "outbox"
+
+// outboxStore implements outbox.Store with one document per change, keyed
+// by its ID.
+type outboxStore struct {
+	bucket *gocb.Bucket
+}
+
+// NewOutboxStore creates an outbox.Store in OutboxCollection. Call
+// ProvisionOutbox before using it.
+func NewOutboxStore(bucket *gocb.Bucket) outbox.Store {
+	return &outboxStore{bucket: bucket}
+}
+
+// ProvisionOutbox creates OutboxCollection and its primary index unless
+// they exist.
+func ProvisionOutbox(ctx context.Context, bucket *gocb.Bucket) error {
+	scope := bucket.DefaultScope().Name()
+	err := bucket.CollectionsV2().CreateCollection(scope, OutboxCollection, nil,
+		&gocb.CreateCollectionOptions{Context: ctx, Timeout: timeout(ctx)})
+	if err != nil && !errors.Is(err, gocb.ErrCollectionExists) {
+		return contextError(ctx, err)
+	}
+	err = bucket.DefaultScope().Collection(OutboxCollection).QueryIndexes().CreatePrimaryIndex(
+		&gocb.CreatePrimaryQueryIndexOptions{Context: ctx, Timeout: timeout(ctx), IgnoreIfExists: true})
+	return contextError(ctx, err)
+}
+
+func (s *outboxStore) collection() *gocb.Collection {
+	return s.bucket.DefaultScope().Collection(OutboxCollection)
+}
+
+func (s *outboxStore) Append(ctx context.Context, change *outbox.Change) error {
+	_, err := s.collection().Insert(change.ID, change, &gocb.InsertOptions{Context: ctx, Timeout: timeout(ctx)})
+	return contextError(ctx, err)
+}
+
+func (s *outboxStore) Pending(ctx context.Context, limit int) ([]*outbox.Change, error) {
+	query := fmt.Sprintf("SELECT o.* FROM `%s` o ORDER BY META(o).id LIMIT $1", OutboxCollection)
+	rows, err := s.bucket.DefaultScope().Query(query, &gocb.QueryOptions{
+		Context:              ctx,
+		Timeout:              timeout(ctx),
+		PositionalParameters: []interface{}{limit},
+		ScanConsistency:      gocb.QueryScanConsistencyRequestPlus,
+	})
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var changes []*outbox.Change
+	for rows.Next() {
+		var change outbox.Change
+		if err := rows.Row(&change); err != nil {
+			return nil, err
+		}
+		changes = append(changes, &change)
+	}
+	return changes, contextError(ctx, rows.Err())
+}
+
+func (s *outboxStore) Remove(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		_, err := s.collection().Remove(id, &gocb.RemoveOptions{Context: ctx, Timeout: timeout(ctx)})
+		if err != nil && !errors.Is(err, gocb.ErrDocumentNotFound) {
+			return contextError(ctx, err)
+		}
+	}
+	return nil
+}
+
+// outboxUserRepository records every successful write of the wrapped
+// repository as an outbox.Change.
+type outboxUserRepository struct {
+	UserRepository
+	store outbox.Store
+}
+
+// WithOutbox wraps repo so that inserts, upserts, avatar changes and
+// deletes append a change to store once they succeed. The write and its record are not
+// atomic: if appending fails the write stands but its error is returned,
+// so the caller retries and the change is recorded then.
+func WithOutbox(repo UserRepository, store outbox.Store) UserRepository {
+	return &outboxUserRepository{UserRepository: repo, store: store}
+}
+
+func (r *outboxUserRepository) record(ctx context.Context, op outbox.Op, user *model.User) error {
+	tenantID, _ := tenant.FromContext(ctx)
+	copied := *user
+	if err := r.store.Append(ctx, outbox.NewChange(time.Now(), tenantID, op, &copied)); err != nil {
+		return fmt.Errorf("user %s saved but its change was not recorded: %w", user.ID, err)
+	}
+	return nil
+}
+
+func (r *outboxUserRepository) InsertUser(ctx context.Context, user *model.User) error {
+	if err := r.UserRepository.InsertUser(ctx, user); err != nil {
+		return err
+	}
+	return r.record(ctx, outbox.OpInsert, user)
+}
+
+func (r *outboxUserRepository) UpsertUser(ctx context.Context, user *model.User) error {
+	if err := r.UserRepository.UpsertUser(ctx, user); err != nil {
+		return err
+	}
+	return r.record(ctx, outbox.OpUpsert, user)
+}
+
+// SetUserAvatar records the whole user, read back after the update.
+func (r *outboxUserRepository) SetUserAvatar(ctx context.Context, id string, avatar *model.Avatar) error {
+	if err := r.UserRepository.SetUserAvatar(ctx, id, avatar); err != nil {
+		return err
+	}
+	user, err := r.UserRepository.GetUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("user %s saved but its change was not recorded: %w", id, err)
+	}
+	return r.record(ctx, outbox.OpAvatar, user)
+}
+
+// DeleteUsersMatching records each deleted user as it was before deletion.
+// Unlike other writes, a retry finds nothing left to delete, so it tries
+// to record every user and reports those it could not.
+func (r *outboxUserRepository) DeleteUsersMatching(ctx context.Context, sel Selector) ([]*model.User, error) {
+	users, err := r.UserRepository.DeleteUsersMatching(ctx, sel)
+	if err != nil {
+		return users, err
+	}
+	var errs []error
+	for _, user := range users {
+		tenantID, _ := tenant.FromContext(ctx)
+		copied := *user
+		if err := r.store.Append(ctx, outbox.NewChange(time.Now(), tenantID, outbox.OpDelete, &copied)); err != nil {
+			errs = append(errs, fmt.Errorf("user %s deleted but its change was not recorded: %w", user.ID, err))
+		}
+	}
+	return users, errors.Join(errs...)
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/gnsalok/go-project-root/go-db-data-api/quota"
+)
+
+// QuotaCollection is the collection in the bucket's default scope holding
+// API key quotas and their daily request counters.
+const QuotaCollection = "quotas"
+
+// usageExpiry keeps a day's counter around for a day after it ends, for
+// the admin API, and then lets Couchbase drop it.
+const usageExpiry = 48 * time.Hour
+
+// quotaStore implements quota.Store with a document per key holding its
+// quota and a counter per key and day. Documents are keyed by a hash of
+// the API key so the keys themselves are not stored.
+type quotaStore struct {
+	bucket *gocb.Bucket
+}
+
+// NewQuotaStore creates a quota.Store in QuotaCollection. Call
+// ProvisionQuotas before using it.
+func NewQuotaStore(bucket *gocb.Bucket) quota.Store {
+	return &quotaStore{bucket: bucket}
+}
+
+// ProvisionQuotas creates QuotaCollection unless it exists.
+func ProvisionQuotas(ctx context.Context, bucket *gocb.Bucket) error {
+	err := bucket.CollectionsV2().CreateCollection(bucket.DefaultScope().Name(), QuotaCollection, nil,
+		&gocb.CreateCollectionOptions{Context: ctx, Timeout: timeout(ctx)})
+	if err != nil && !errors.Is(err, gocb.ErrCollectionExists) {
+		return contextError(ctx, err)
+	}
+	return nil
+}
+
+func (s *quotaStore) collection() *gocb.Collection {
+	return s.bucket.DefaultScope().Collection(QuotaCollection)
+}
+
+func quotaID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "quota::" + hex.EncodeToString(sum[:])
+}
+
+func usageID(key string, day time.Time) string {
+	return quotaID(key) + "::" + day.Format("20060102")
+}
+
+func (s *quotaStore) Quota(ctx context.Context, key string) (*quota.Quota, error) {
+	res, err := s.collection().Get(quotaID(key), &gocb.GetOptions{Context: ctx, Timeout: timeout(ctx)})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil, quota.ErrNotFound
+	}
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	var q quota.Quota
+	if err := res.Content(&q); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+func (s *quotaStore) SetQuota(ctx context.Context, key string, q *quota.Quota) error {
+	_, err := s.collection().Upsert(quotaID(key), q, &gocb.UpsertOptions{Context: ctx, Timeout: timeout(ctx)})
+	return contextError(ctx, err)
+}
+
+func (s *quotaStore) DeleteQuota(ctx context.Context, key string) error {
+	_, err := s.collection().Remove(quotaID(key), &gocb.RemoveOptions{Context: ctx, Timeout: timeout(ctx)})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil
+	}
+	return contextError(ctx, err)
+}
+
+// Increment uses a Couchbase counter, so concurrent requests on any
+// instance are all counted.
+func (s *quotaStore) Increment(ctx context.Context, key string, day time.Time) (int64, error) {
+	res, err := s.collection().Binary().Increment(usageID(key, day), &gocb.IncrementOptions{
+		Context: ctx,
+		Timeout: timeout(ctx),
+		Initial: 1,
+		Delta:   1,
+		Expiry:  usageExpiry,
+	})
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+	return int64(res.Content()), nil
+}
+
+func (s *quotaStore) Usage(ctx context.Context, key string, day time.Time) (int64, error) {
+	res, err := s.collection().Get(usageID(key, day), &gocb.GetOptions{Context: ctx, Timeout: timeout(ctx)})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+	var used int64
+	if err := res.Content(&used); err != nil {
+		return 0, err
+	}
+	return used, nil
+}
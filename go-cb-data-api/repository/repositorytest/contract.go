@@ -0,0 +1,319 @@
+// Package repositorytest holds the contract every UserRepository
+// implementation must satisfy, so the Couchbase repository and the
+// in-memory one used in tests cannot drift apart.
+package repositorytest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Setup returns an empty repository and the context to use it with. The
+// context may carry a tenant, letting implementations backed by a shared
+// database give each test its own scope.
+type Setup func(t *testing.T) (repository.UserRepository, context.Context)
+
+// RunUserRepositoryContract runs the UserRepository contract against the
+// implementation returned by setup, calling it once per test case.
+func RunUserRepositoryContract(t *testing.T, setup Setup) {
+	t.Run("GetUserByID", func(t *testing.T) { testGetUserByID(t, setup) })
+	t.Run("GetUserWithCAS", func(t *testing.T) { testGetUserWithCAS(t, setup) })
+	t.Run("GetUserFields", func(t *testing.T) { testGetUserFields(t, setup) })
+	t.Run("InsertUser", func(t *testing.T) { testInsertUser(t, setup) })
+	t.Run("UpsertUser", func(t *testing.T) { testUpsertUser(t, setup) })
+	t.Run("SetUserAvatar", func(t *testing.T) { testSetUserAvatar(t, setup) })
+	t.Run("SetUserPassword", func(t *testing.T) { testSetUserPassword(t, setup) })
+	t.Run("ListUsersAfter", func(t *testing.T) { testListUsersAfter(t, setup) })
+	t.Run("ScanUsers", func(t *testing.T) { testScanUsers(t, setup) })
+	t.Run("CountUsersCreatedSince", func(t *testing.T) { testCountUsersCreatedSince(t, setup) })
+	t.Run("DeleteUsersMatching", func(t *testing.T) { testDeleteUsersMatching(t, setup) })
+	t.Run("ContextCanceled", func(t *testing.T) { testContextCanceled(t, setup) })
+}
+
+// insertUsers stores users with the given IDs and returns them.
+func insertUsers(t *testing.T, ctx context.Context, repo repository.UserRepository, ids ...string) []*model.User {
+	t.Helper()
+	users := make([]*model.User, len(ids))
+	for i, id := range ids {
+		users[i] = &model.User{ID: id, Name: "User " + id, Email: id + "@Example.com"}
+		require.NoError(t, repo.InsertUser(ctx, users[i]))
+	}
+	return users
+}
+
+func testGetUserByID(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+
+	_, err := repo.GetUserByID(ctx, "missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	users := insertUsers(t, ctx, repo, "user1")
+	got, err := repo.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, users[0], got)
+}
+
+// testGetUserWithCAS checks the CAS stays put between reads and changes
+// with every write.
+func testGetUserWithCAS(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+
+	_, _, err := repo.GetUserWithCAS(ctx, "missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	users := insertUsers(t, ctx, repo, "user1")
+	got, cas, err := repo.GetUserWithCAS(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, users[0], got)
+	assert.NotZero(t, cas)
+
+	_, again, err := repo.GetUserWithCAS(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, cas, again, "CAS changed without a write")
+
+	require.NoError(t, repo.UpsertUser(ctx, &model.User{ID: "user1", Name: "Jane Smith"}))
+	_, upserted, err := repo.GetUserWithCAS(ctx, "user1")
+	require.NoError(t, err)
+	assert.NotEqual(t, cas, upserted, "CAS unchanged by UpsertUser")
+
+	require.NoError(t, repo.SetUserAvatar(ctx, "user1", &model.Avatar{Key: "avatars/user1/a.png"}))
+	_, avatarSet, err := repo.GetUserWithCAS(ctx, "user1")
+	require.NoError(t, err)
+	assert.NotEqual(t, upserted, avatarSet, "CAS unchanged by SetUserAvatar")
+}
+
+func testGetUserFields(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+
+	_, err := repo.GetUserFields(ctx, "missing", []string{"name"})
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "user1", Name: "John Doe"}))
+	got, err := repo.GetUserFields(ctx, "user1", []string{"name", "email_lower"})
+	require.NoError(t, err)
+	// email_lower is empty, so it is omitted from the stored document.
+	assert.Equal(t, map[string]json.RawMessage{"name": json.RawMessage(`"John Doe"`)}, got)
+}
+
+func testInsertUser(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+
+	user := &model.User{ID: "user1", Name: "John Doe", Email: " John.Doe@Example.com"}
+	require.NoError(t, repo.InsertUser(ctx, user))
+	assert.Equal(t, "john.doe@example.com", user.EmailLower)
+	assert.NotNil(t, user.CreatedAt)
+
+	err := repo.InsertUser(ctx, &model.User{ID: "user1", Name: "Jane Smith"})
+	assert.ErrorIs(t, err, repository.ErrAlreadyExists)
+
+	got, err := repo.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "John Doe", got.Name)
+}
+
+func testUpsertUser(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+
+	require.NoError(t, repo.UpsertUser(ctx, &model.User{ID: "user1", Name: "John Doe"}))
+	require.NoError(t, repo.UpsertUser(ctx, &model.User{ID: "user1", Name: "Jane Smith", Email: "JANE@example.com"}))
+
+	got, err := repo.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, &model.User{ID: "user1", Name: "Jane Smith", Email: "JANE@example.com", EmailLower: "jane@example.com"}, got)
+
+	count, err := repo.CountUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func testSetUserAvatar(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+
+	avatar := &model.Avatar{
+		Key:         "avatars/user1/a.png",
+		URL:         "https://objects.example.com/avatars/user1/a.png",
+		ContentType: "image/png",
+		Size:        42,
+		UpdatedAt:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	err := repo.SetUserAvatar(ctx, "missing", avatar)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	users := insertUsers(t, ctx, repo, "user1")
+	require.NoError(t, repo.SetUserAvatar(ctx, "user1", avatar))
+
+	got, err := repo.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	users[0].Avatar = avatar
+	assert.Equal(t, users[0], got)
+}
+
+func testSetUserPassword(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+
+	err := repo.SetUserPassword(ctx, "missing", "$2a$10$hash")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	users := insertUsers(t, ctx, repo, "user1")
+	require.NoError(t, repo.SetUserPassword(ctx, "user1", "$2a$10$hash"))
+
+	got, err := repo.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	users[0].PasswordHash = "$2a$10$hash"
+	assert.Equal(t, users[0], got)
+}
+
+func testListUsersAfter(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+	users := insertUsers(t, ctx, repo, "user3", "user1", "user4", "user2")
+
+	page, err := repo.ListUsersAfter(ctx, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []*model.User{users[1], users[3]}, page)
+
+	page, err = repo.ListUsersAfter(ctx, "user2", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []*model.User{users[0], users[2]}, page)
+
+	page, err = repo.ListUsersAfter(ctx, "user4", 10)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+
+	count, err := repo.CountUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+}
+
+func testScanUsers(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+	insertUsers(t, ctx, repo, "user1", "user2", "user3")
+
+	seen := map[string]bool{}
+	require.NoError(t, repo.ScanUsers(ctx, func(u *model.User) error {
+		seen[u.ID] = true
+		return nil
+	}))
+	assert.Equal(t, map[string]bool{"user1": true, "user2": true, "user3": true}, seen)
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := repo.ScanUsers(ctx, func(u *model.User) error {
+		calls++
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, calls)
+}
+
+// testDeleteUsersMatching checks the selector decides which users are
+// counted and deleted, wildcards and missing fields included.
+// testCountUsersCreatedSince checks only users created since the given
+// time count, and that inserting keeps a creation time already set.
+func testCountUsersCreatedSince(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+
+	old := time.Now().Add(-48 * time.Hour).UTC()
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "old", CreatedAt: &old}))
+	require.NoError(t, repo.UpsertUser(ctx, &model.User{ID: "legacy"}))
+	insertUsers(t, ctx, repo, "new1", "new2")
+
+	got, err := repo.GetUserByID(ctx, "old")
+	require.NoError(t, err)
+	require.NotNil(t, got.CreatedAt)
+	assert.True(t, old.Equal(*got.CreatedAt), "creation time replaced")
+
+	for _, tt := range []struct {
+		since time.Time
+		want  int
+	}{
+		{time.Now().Add(-time.Hour), 2},
+		{time.Now().Add(-72 * time.Hour), 3},
+		{time.Now().Add(time.Hour), 0},
+	} {
+		count, err := repo.CountUsersCreatedSince(ctx, tt.since)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, count, "since %s", tt.since)
+	}
+}
+
+func testDeleteUsersMatching(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+	users := insertUsers(t, ctx, repo, "user1", "user2", "user3")
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "test_1", Name: "Test 100%"}))
+
+	count := func(selector string) int {
+		t.Helper()
+		sel, err := repository.ParseSelector(selector)
+		require.NoError(t, err)
+		n, err := repo.CountUsersMatching(ctx, sel)
+		require.NoError(t, err)
+		return n
+	}
+	assert.Equal(t, 3, count("email_lower=*@example.com"))
+	assert.Equal(t, 1, count("email="), "missing email")
+	assert.Equal(t, 1, count("id=test_*"))
+	assert.Equal(t, 0, count("id=test%*"), "LIKE characters matched as wildcards")
+	assert.Equal(t, 1, count("name=*100%"))
+	assert.Equal(t, 2, count("email_lower=*@example.com,id!=user2"))
+
+	sel, err := repository.ParseSelector("id=user*,name!=User user2")
+	require.NoError(t, err)
+	deleted, err := repo.DeleteUsersMatching(ctx, sel)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*model.User{users[0], users[2]}, deleted)
+
+	_, err = repo.GetUserByID(ctx, "user1")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	total, err := repo.CountUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+
+	deleted, err = repo.DeleteUsersMatching(ctx, sel)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+}
+
+// testContextCanceled checks every operation fails with an error matching
+// context.Canceled once the caller's context is canceled, whatever error
+// the underlying store reports.
+func testContextCanceled(t *testing.T, setup Setup) {
+	repo, ctx := setup(t)
+	insertUsers(t, ctx, repo, "user1")
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err := repo.GetUserByID(ctx, "user1")
+	assert.ErrorIs(t, err, context.Canceled, "GetUserByID")
+	_, _, err = repo.GetUserWithCAS(ctx, "user1")
+	assert.ErrorIs(t, err, context.Canceled, "GetUserWithCAS")
+	_, err = repo.GetUserFields(ctx, "user1", []string{"name"})
+	assert.ErrorIs(t, err, context.Canceled, "GetUserFields")
+	err = repo.InsertUser(ctx, &model.User{ID: "user2"})
+	assert.ErrorIs(t, err, context.Canceled, "InsertUser")
+	err = repo.UpsertUser(ctx, &model.User{ID: "user1"})
+	assert.ErrorIs(t, err, context.Canceled, "UpsertUser")
+	err = repo.SetUserAvatar(ctx, "user1", &model.Avatar{})
+	assert.ErrorIs(t, err, context.Canceled, "SetUserAvatar")
+	err = repo.SetUserPassword(ctx, "user1", "$2a$10$hash")
+	assert.ErrorIs(t, err, context.Canceled, "SetUserPassword")
+	err = repo.ScanUsers(ctx, func(*model.User) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled, "ScanUsers")
+	_, err = repo.ListUsersAfter(ctx, "", 10)
+	assert.ErrorIs(t, err, context.Canceled, "ListUsersAfter")
+	_, err = repo.CountUsers(ctx)
+	assert.ErrorIs(t, err, context.Canceled, "CountUsers")
+	sel := repository.Selector{{Field: "id", Value: "user1"}}
+	_, err = repo.CountUsersMatching(ctx, sel)
+	assert.ErrorIs(t, err, context.Canceled, "CountUsersMatching")
+	_, err = repo.DeleteUsersMatching(ctx, sel)
+	assert.ErrorIs(t, err, context.Canceled, "DeleteUsersMatching")
+}
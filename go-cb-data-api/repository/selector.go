@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+)
+
+// Selector picks users by their fields for bulk operations. Every
+// condition must hold.
+type Selector []Condition
+
+// Condition compares one field of a user with a value, in which * matches
+// any run of characters. Missing fields compare as empty.
+type Condition struct {
+	Field  string
+	Negate bool
+	Value  string
+}
+
+// SelectorFields lists the fields a Selector may compare.
+var SelectorFields = []string{"id", "name", "email", "email_lower"}
+
+// ParseSelector parses a comma-separated list of field=value and
+// field!=value conditions, such as "email_lower=*@example.com,name!=Admin".
+// Values cannot contain commas. At least one condition is required, so a
+// selector never matches every user by accident.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		var cond Condition
+		field, value, ok := strings.Cut(part, "!=")
+		if ok {
+			cond.Negate = true
+		} else if field, value, ok = strings.Cut(part, "="); !ok {
+			return nil, fmt.Errorf("condition %q is not field=value or field!=value", part)
+		}
+		cond.Field, cond.Value = strings.TrimSpace(field), strings.TrimSpace(value)
+		if !slices.Contains(SelectorFields, cond.Field) {
+			return nil, fmt.Errorf("unknown selector field %q", cond.Field)
+		}
+		sel = append(sel, cond)
+	}
+	if len(sel) == 0 {
+		return nil, errors.New("selector must have at least one condition")
+	}
+	return sel, nil
+}
+
+// String formats s the way ParseSelector reads it.
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, cond := range s {
+		op := "="
+		if cond.Negate {
+			op = "!="
+		}
+		parts[i] = cond.Field + op + cond.Value
+	}
+	return strings.Join(parts, ",")
+}
+
+// Matches reports whether user satisfies every condition of s.
+func (s Selector) Matches(user *model.User) bool {
+	for _, cond := range s {
+		var value string
+		switch cond.Field {
+		case "id":
+			value = user.ID
+		case "name":
+			value = user.Name
+		case "email":
+			value = user.Email
+		case "email_lower":
+			value = user.EmailLower
+		}
+		if wildcardMatch(cond.Value, value) == cond.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// where returns the N1QL condition for s on the documents aliased as
+// alias, with its values as positional parameters. Values never become
+// part of the statement.
+func (s Selector) where(alias string) (string, []interface{}) {
+	clauses := make([]string, len(s))
+	params := make([]interface{}, len(s))
+	for i, cond := range s {
+		expr := fmt.Sprintf("IFMISSINGORNULL(%s.`%s`, \"\")", alias, cond.Field)
+		if cond.Field == "id" {
+			expr = fmt.Sprintf("META(%s).id", alias)
+		}
+		wildcard := strings.Contains(cond.Value, "*")
+		var op string
+		switch {
+		case wildcard && cond.Negate:
+			op = "NOT LIKE"
+		case wildcard:
+			op = "LIKE"
+		case cond.Negate:
+			op = "!="
+		default:
+			op = "="
+		}
+		clauses[i] = fmt.Sprintf("%s %s $%d", expr, op, i+1)
+		params[i] = cond.Value
+		if wildcard {
+			params[i] = likePattern(cond.Value)
+		}
+	}
+	return strings.Join(clauses, " AND "), params
+}
+
+// likePattern turns a * wildcard pattern into a LIKE pattern, escaping
+// the characters LIKE treats specially.
+func likePattern(pattern string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%")
+	return r.Replace(pattern)
+}
+
+// wildcardMatch reports whether s matches pattern, in which * matches any
+// run of characters.
+func wildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseSelector checks selectors round-trip through String and that
+// empty or unknown conditions are rejected.
+func TestParseSelector(t *testing.T) {
+	sel, err := repository.ParseSelector(" email_lower=*@example.com, name!=Admin,,email=")
+	require.NoError(t, err)
+	assert.Equal(t, repository.Selector{
+		{Field: "email_lower", Value: "*@example.com"},
+		{Field: "name", Negate: true, Value: "Admin"},
+		{Field: "email", Value: ""},
+	}, sel)
+	assert.Equal(t, "email_lower=*@example.com,name!=Admin,email=", sel.String())
+
+	for _, bad := range []string{"", " , ", "name", "avatar=x", "password=x"} {
+		_, err := repository.ParseSelector(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// TestSelectorMatches checks wildcards match any run of characters,
+// including none.
+func TestSelectorMatches(t *testing.T) {
+	user := &model.User{ID: "user1", Name: "John Doe", Email: "John@Example.com", EmailLower: "john@example.com"}
+	testCases := []struct {
+		selector string
+		matches  bool
+	}{
+		{selector: "id=user1", matches: true},
+		{selector: "id=user", matches: false},
+		{selector: "id=user*", matches: true},
+		{selector: "id=*1", matches: true},
+		{selector: "name=J*n*Doe", matches: true},
+		{selector: "name=*Doe*", matches: true},
+		{selector: "name=J*x*", matches: false},
+		{selector: "email=john@example.com", matches: false},
+		{selector: "email_lower=*@example.com,name!=John Doe", matches: false},
+		{selector: "id=user1*1", matches: false},
+	}
+	for _, tc := range testCases {
+		sel, err := repository.ParseSelector(tc.selector)
+		require.NoError(t, err)
+		assert.Equal(t, tc.matches, sel.Matches(user), tc.selector)
+	}
+}
@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+)
+
+// maxRecentMismatches is how many mismatches ShadowStats keeps for
+// inspection.
+const maxRecentMismatches = 20
+
+// ShadowConfig tunes WithShadowReads.
+type ShadowConfig struct {
+	// SampleRate is the share of reads repeated on the shadow, from 0 to
+	// 1; 0 means all of them.
+	SampleRate float64
+	// Timeout bounds each shadow read; 0 means 2s.
+	Timeout time.Duration
+	// MaxInFlight bounds concurrent shadow reads; reads beyond it are
+	// dropped rather than queued. 0 means 64.
+	MaxInFlight int
+}
+
+// ShadowStats counts the comparisons of shadow reads, for the admin stats
+// endpoint. Counts are per process.
+type ShadowStats struct {
+	mu       sync.Mutex
+	byMethod map[string]*ShadowCounts
+	recent   []ShadowMismatch
+}
+
+// ShadowCounts counts the shadow reads of one method. Errors are failed
+// shadow reads, which are not compared; Dropped reads were skipped because
+// too many were in flight.
+type ShadowCounts struct {
+	Matches    uint64 `json:"matches"`
+	Mismatches uint64 `json:"mismatches"`
+	Errors     uint64 `json:"errors"`
+	Dropped    uint64 `json:"dropped"`
+}
+
+// ShadowMismatch identifies a read whose results differed. The results
+// themselves are left out, as they hold user data.
+type ShadowMismatch struct {
+	Method string    `json:"method"`
+	Tenant string    `json:"tenant,omitempty"`
+	Key    string    `json:"key"`
+	At     time.Time `json:"at"`
+}
+
+// ShadowSnapshot is a copy of the counts of ShadowStats.
+type ShadowSnapshot struct {
+	ShadowCounts
+	ByMethod map[string]ShadowCounts `json:"by_method"`
+	// RecentMismatches lists the latest mismatches, newest last.
+	RecentMismatches []ShadowMismatch `json:"recent_mismatches"`
+}
+
+// NewShadowStats returns empty ShadowStats.
+func NewShadowStats() *ShadowStats {
+	return &ShadowStats{byMethod: make(map[string]*ShadowCounts)}
+}
+
+func (s *ShadowStats) record(method string, f func(*ShadowCounts)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := s.byMethod[method]
+	if counts == nil {
+		counts = new(ShadowCounts)
+		s.byMethod[method] = counts
+	}
+	f(counts)
+}
+
+func (s *ShadowStats) mismatch(m ShadowMismatch) {
+	s.record(m.Method, func(c *ShadowCounts) { c.Mismatches++ })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recent = append(s.recent, m)
+	if len(s.recent) > maxRecentMismatches {
+		s.recent = s.recent[len(s.recent)-maxRecentMismatches:]
+	}
+}
+
+// Snapshot returns the current counts, in total and by method.
+func (s *ShadowStats) Snapshot() ShadowSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := ShadowSnapshot{
+		ByMethod:         make(map[string]ShadowCounts, len(s.byMethod)),
+		RecentMismatches: append([]ShadowMismatch{}, s.recent...),
+	}
+	for method, c := range s.byMethod {
+		snap.ByMethod[method] = *c
+		snap.Matches += c.Matches
+		snap.Mismatches += c.Mismatches
+		snap.Errors += c.Errors
+		snap.Dropped += c.Dropped
+	}
+	return snap
+}
+
+// shadowUserRepository serves everything from the wrapped primary and
+// repeats reads on the shadow in the background.
+type shadowUserRepository struct {
+	UserRepository
+	shadow   UserRepository
+	stats    *ShadowStats
+	cfg      ShadowConfig
+	inFlight chan struct{}
+}
+
+// WithShadowReads wraps primary so that reads are repeated on shadow, the
+// backend being migrated to, and their results compared into stats. The
+// caller always gets the primary's result, without waiting for the shadow.
+// Writes only go to primary; keeping shadow in sync is up to the migration.
+// Scans are not repeated, as they read every user.
+func WithShadowReads(primary, shadow UserRepository, stats *ShadowStats, cfg ShadowConfig) UserRepository {
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		cfg.SampleRate = 1
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = 64
+	}
+	return &shadowUserRepository{
+		UserRepository: primary,
+		shadow:         shadow,
+		stats:          stats,
+		cfg:            cfg,
+		inFlight:       make(chan struct{}, cfg.MaxInFlight),
+	}
+}
+
+// compare runs read on the shadow in the background and compares its
+// result with want, the primary's result, encoded as JSON. Reads the
+// primary failed are not compared, except for ErrNotFound.
+func (r *shadowUserRepository) compare(ctx context.Context, method, key string, want any, primaryErr error, read func(context.Context) (any, error)) {
+	if primaryErr != nil && !errors.Is(primaryErr, ErrNotFound) {
+		return
+	}
+	if r.cfg.SampleRate < 1 && rand.Float64() >= r.cfg.SampleRate {
+		return
+	}
+	// Encode now: the caller owns want once this returns.
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		return
+	}
+	select {
+	case r.inFlight <- struct{}{}:
+	default:
+		r.stats.record(method, func(c *ShadowCounts) { c.Dropped++ })
+		return
+	}
+	// The shadow read outlives the request, but keeps its tenant.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.cfg.Timeout)
+	go func() {
+		defer func() { <-r.inFlight }()
+		defer cancel()
+		got, err := read(ctx)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			r.stats.record(method, func(c *ShadowCounts) { c.Errors++ })
+			log.Printf("shadow %s %s failed: %v", method, key, err)
+			return
+		}
+		gotJSON, jsonErr := json.Marshal(got)
+		if jsonErr == nil && errors.Is(err, ErrNotFound) == errors.Is(primaryErr, ErrNotFound) && bytes.Equal(gotJSON, wantJSON) {
+			r.stats.record(method, func(c *ShadowCounts) { c.Matches++ })
+			return
+		}
+		tenantID, _ := tenant.FromContext(ctx)
+		r.stats.mismatch(ShadowMismatch{Method: method, Tenant: tenantID, Key: key, At: time.Now().UTC()})
+		log.Printf("shadow %s %s differs from the primary (tenant %q)", method, key, tenantID)
+	}()
+}
+
+func (r *shadowUserRepository) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	user, err := r.UserRepository.GetUserByID(ctx, id)
+	r.compare(ctx, "GetUserByID", id, user, err, func(ctx context.Context) (any, error) {
+		return r.shadow.GetUserByID(ctx, id)
+	})
+	return user, err
+}
+
+// GetUserWithCAS compares only the users: each backend has its own CAS.
+func (r *shadowUserRepository) GetUserWithCAS(ctx context.Context, id string) (*model.User, uint64, error) {
+	user, cas, err := r.UserRepository.GetUserWithCAS(ctx, id)
+	r.compare(ctx, "GetUserWithCAS", id, user, err, func(ctx context.Context) (any, error) {
+		return r.shadow.GetUserByID(ctx, id)
+	})
+	return user, cas, err
+}
+
+func (r *shadowUserRepository) GetUserFields(ctx context.Context, id string, fields []string) (map[string]json.RawMessage, error) {
+	values, err := r.UserRepository.GetUserFields(ctx, id, fields)
+	r.compare(ctx, "GetUserFields", id, values, err, func(ctx context.Context) (any, error) {
+		return r.shadow.GetUserFields(ctx, id, fields)
+	})
+	return values, err
+}
+
+func (r *shadowUserRepository) ListUsersAfter(ctx context.Context, afterID string, limit int) ([]*model.User, error) {
+	users, err := r.UserRepository.ListUsersAfter(ctx, afterID, limit)
+	r.compare(ctx, "ListUsersAfter", "after:"+afterID, users, err, func(ctx context.Context) (any, error) {
+		return r.shadow.ListUsersAfter(ctx, afterID, limit)
+	})
+	return users, err
+}
+
+func (r *shadowUserRepository) CountUsers(ctx context.Context) (int, error) {
+	count, err := r.UserRepository.CountUsers(ctx)
+	r.compare(ctx, "CountUsers", "*", count, err, func(ctx context.Context) (any, error) {
+		return r.shadow.CountUsers(ctx)
+	})
+	return count, err
+}
+
+func (r *shadowUserRepository) CountUsersCreatedSince(ctx context.Context, since time.Time) (int, error) {
+	count, err := r.UserRepository.CountUsersCreatedSince(ctx, since)
+	r.compare(ctx, "CountUsersCreatedSince", since.UTC().Format(time.RFC3339), count, err, func(ctx context.Context) (any, error) {
+		return r.shadow.CountUsersCreatedSince(ctx, since)
+	})
+	return count, err
+}
+
+func (r *shadowUserRepository) CountUsersMatching(ctx context.Context, sel Selector) (int, error) {
+	count, err := r.UserRepository.CountUsersMatching(ctx, sel)
+	r.compare(ctx, "CountUsersMatching", sel.String(), count, err, func(ctx context.Context) (any, error) {
+		return r.shadow.CountUsersMatching(ctx, sel)
+	})
+	return count, err
+}
@@ -0,0 +1,79 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository/repositorytest"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithShadowReadsContract(t *testing.T) {
+	repositorytest.RunUserRepositoryContract(t, func(t *testing.T) (repository.UserRepository, context.Context) {
+		shadow := repository.NewMemoryUserRepository()
+		return repository.WithShadowReads(repository.NewMemoryUserRepository(), shadow, repository.NewShadowStats(), repository.ShadowConfig{}), context.Background()
+	})
+}
+
+// TestWithShadowReads checks reads are compared with the shadow in the
+// background, while callers get the primary's results.
+func TestWithShadowReads(t *testing.T) {
+	primary, shadow := repository.NewMemoryUserRepository(), repository.NewMemoryUserRepository()
+	stats := repository.NewShadowStats()
+	repo := repository.WithShadowReads(primary, shadow, stats, repository.ShadowConfig{})
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	// user1 is migrated as is, user2 with a different name.
+	require.NoError(t, primary.InsertUser(ctx, &model.User{ID: "user1", Name: "John Doe"}))
+	migrated, err := primary.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	require.NoError(t, shadow.UpsertUser(ctx, migrated))
+	require.NoError(t, primary.InsertUser(ctx, &model.User{ID: "user2", Name: "Jane Smith"}))
+	require.NoError(t, shadow.UpsertUser(ctx, &model.User{ID: "user2", Name: "Jane Smyth"}))
+	require.NoError(t, primary.InsertUser(ctx, &model.User{ID: "user3", Name: "Not Migrated"}))
+
+	user, err := repo.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "John Doe", user.Name)
+	user, err = repo.GetUserByID(ctx, "user2")
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Smith", user.Name, "caller got the shadow's result")
+	_, err = repo.GetUserByID(ctx, "user3")
+	require.NoError(t, err)
+	_, err = repo.GetUserByID(ctx, "missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = repo.GetUserFields(ctx, "user1", []string{"name"})
+	require.NoError(t, err)
+	_, err = repo.CountUsers(ctx)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		snap := stats.Snapshot()
+		return snap.Matches+snap.Mismatches == 6
+	}, time.Second, 10*time.Millisecond)
+	snap := stats.Snapshot()
+	assert.Equal(t, repository.ShadowCounts{Matches: 2, Mismatches: 2}, snap.ByMethod["GetUserByID"])
+	assert.Equal(t, uint64(1), snap.ByMethod["GetUserFields"].Matches)
+	assert.Equal(t, uint64(1), snap.ByMethod["CountUsers"].Mismatches)
+	require.Len(t, snap.RecentMismatches, 3)
+	assert.ElementsMatch(t, []string{"user2", "user3", "*"}, []string{snap.RecentMismatches[0].Key, snap.RecentMismatches[1].Key, snap.RecentMismatches[2].Key})
+	assert.Equal(t, "acme", snap.RecentMismatches[0].Tenant)
+}
+
+// TestWithShadowReadsWrites checks writes only reach the primary.
+func TestWithShadowReadsWrites(t *testing.T) {
+	primary, shadow := repository.NewMemoryUserRepository(), repository.NewMemoryUserRepository()
+	repo := repository.WithShadowReads(primary, shadow, repository.NewShadowStats(), repository.ShadowConfig{})
+	ctx := context.Background()
+
+	require.NoError(t, repo.InsertUser(ctx, &model.User{ID: "user1", Name: "John Doe"}))
+	_, err := primary.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	_, err = shadow.GetUserByID(ctx, "user1")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
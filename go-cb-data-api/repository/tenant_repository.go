@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/couchbase/gocb/v2"
+)
+
+// TenantCollection is the collection holding users in each tenant's scope.
+const TenantCollection = "users"
+
+// ErrTenantExists is returned when provisioning a tenant that already exists.
+var ErrTenantExists = errors.New("tenant already exists")
+
+// TenantRepository manages the Couchbase scopes that isolate tenants.
+type TenantRepository interface {
+	ProvisionTenant(ctx context.Context, id string) error
+	ListTenants(ctx context.Context) ([]string, error)
+	TenantExists(ctx context.Context, id string) (bool, error)
+}
+
+// tenantRepository implements TenantRepository with one scope per tenant,
+// each holding a TenantCollection with a primary index.
+type tenantRepository struct {
+	bucket *gocb.Bucket
+
+	mu    sync.RWMutex
+	known map[string]bool
+}
+
+// NewTenantRepository creates a new instance of TenantRepository.
+func NewTenantRepository(bucket *gocb.Bucket) TenantRepository {
+	return &tenantRepository{bucket: bucket, known: make(map[string]bool)}
+}
+
+// ProvisionTenant creates the tenant's scope, users collection and primary
+// index. It completes a previous attempt that failed part-way, and returns
+// ErrTenantExists only when everything was already in place.
+func (r *tenantRepository) ProvisionTenant(ctx context.Context, id string) error {
+	mgr := r.bucket.CollectionsV2()
+	created := false
+	err := mgr.CreateScope(id, &gocb.CreateScopeOptions{Context: ctx, Timeout: timeout(ctx)})
+	switch {
+	case err == nil:
+		created = true
+	case !errors.Is(err, gocb.ErrScopeExists):
+		return contextError(ctx, err)
+	}
+	err = mgr.CreateCollection(id, TenantCollection, nil, &gocb.CreateCollectionOptions{Context: ctx, Timeout: timeout(ctx)})
+	switch {
+	case err == nil:
+		created = true
+	case !errors.Is(err, gocb.ErrCollectionExists):
+		return contextError(ctx, err)
+	}
+	collection := r.bucket.Scope(id).Collection(TenantCollection)
+	err = collection.QueryIndexes().CreatePrimaryIndex(&gocb.CreatePrimaryQueryIndexOptions{Context: ctx, Timeout: timeout(ctx)})
+	switch {
+	case err == nil:
+		created = true
+	case !errors.Is(err, gocb.ErrIndexExists):
+		return contextError(ctx, err)
+	}
+
+	r.mu.Lock()
+	r.known[id] = true
+	r.mu.Unlock()
+	if !created {
+		return ErrTenantExists
+	}
+	return nil
+}
+
+// ListTenants returns the IDs of all provisioned tenants in name order.
+func (r *tenantRepository) ListTenants(ctx context.Context) ([]string, error) {
+	scopes, err := r.bucket.CollectionsV2().GetAllScopes(&gocb.GetAllScopesOptions{Context: ctx, Timeout: timeout(ctx)})
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	ids := []string{}
+	for _, scope := range scopes {
+		if hasTenantCollection(scope) {
+			ids = append(ids, scope.Name)
+		}
+	}
+	sort.Strings(ids)
+
+	r.mu.Lock()
+	for _, id := range ids {
+		r.known[id] = true
+	}
+	r.mu.Unlock()
+	return ids, nil
+}
+
+// TenantExists reports whether the tenant has been provisioned. Tenants
+// seen once are cached, so only unknown IDs reach the cluster.
+func (r *tenantRepository) TenantExists(ctx context.Context, id string) (bool, error) {
+	r.mu.RLock()
+	known := r.known[id]
+	r.mu.RUnlock()
+	if known {
+		return true, nil
+	}
+
+	ids, err := r.ListTenants(ctx)
+	if err != nil {
+		return false, err
+	}
+	i := sort.SearchStrings(ids, id)
+	return i < len(ids) && ids[i] == id, nil
+}
+
+func hasTenantCollection(scope gocb.ScopeSpec) bool {
+	for _, c := range scope.Collections {
+		if c.Name == TenantCollection {
+			return true
+		}
+	}
+	return false
+}
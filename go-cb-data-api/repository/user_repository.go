@@ -2,47 +2,396 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/couchbase/gocb/v2"
+	"github.com/gnsalok/go-project-root/go-db-data-api/durability"
 	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
 )
 
 var (
 	// ErrNotFound is returned when a user is not found in the database.
 	ErrNotFound = errors.New("user not found")
+	// ErrAlreadyExists is returned when inserting a user whose ID is taken.
+	ErrAlreadyExists = errors.New("user already exists")
 )
 
 // UserRepository defines the methods that any
 // data storage provider must implement to get User information.
 type UserRepository interface {
 	GetUserByID(ctx context.Context, id string) (*model.User, error)
+	// GetUserWithCAS is GetUserByID that also returns the document's CAS,
+	// which changes on every write, so callers can tell versions apart.
+	GetUserWithCAS(ctx context.Context, id string) (*model.User, uint64, error)
+	GetUserFields(ctx context.Context, id string, fields []string) (map[string]json.RawMessage, error)
+	InsertUser(ctx context.Context, user *model.User) error
+	UpsertUser(ctx context.Context, user *model.User) error
+	SetUserAvatar(ctx context.Context, id string, avatar *model.Avatar) error
+	// SetUserPassword replaces only the password hash of an existing user.
+	SetUserPassword(ctx context.Context, id string, hash string) error
+	ScanUsers(ctx context.Context, fn func(*model.User) error) error
+	ListUsersAfter(ctx context.Context, afterID string, limit int) ([]*model.User, error)
+	CountUsers(ctx context.Context) (int, error)
+	// CountUsersCreatedSince returns the number of users inserted at or
+	// after since. Users without a creation time are not counted.
+	CountUsersCreatedSince(ctx context.Context, since time.Time) (int, error)
+	// CountUsersMatching returns the number of users sel matches.
+	CountUsersMatching(ctx context.Context, sel Selector) (int, error)
+	// DeleteUsersMatching deletes the users sel matches and returns them
+	// as they were before deletion.
+	DeleteUsersMatching(ctx context.Context, sel Selector) ([]*model.User, error)
 }
 
 // userRepository implements UserRepository interface.
 type userRepository struct {
-	bucket *gocb.Bucket
+	bucket     *gocb.Bucket
+	durability durability.Config
 }
 
-// NewUserRepository creates a new instance of UserRepository.
-func NewUserRepository(bucket *gocb.Bucket) UserRepository {
-	return &userRepository{bucket: bucket}
+// NewUserRepository creates a new instance of UserRepository. Operations
+// whose context carries a tenant use that tenant's scope; the rest use the
+// bucket's default collection. Writes wait for the durability level dur
+// sets for them, raised to the level their context asks for.
+func NewUserRepository(bucket *gocb.Bucket, dur durability.Config) UserRepository {
+	return &userRepository{bucket: bucket, durability: dur}
+}
+
+// durabilityLevel returns the SDK durability level of op for ctx.
+func (r *userRepository) durabilityLevel(ctx context.Context, op durability.Op) gocb.DurabilityLevel {
+	switch r.durability.Level(ctx, op) {
+	case durability.LevelMajority:
+		return gocb.DurabilityLevelMajority
+	case durability.LevelMajorityAndPersistActive:
+		return gocb.DurabilityLevelMajorityAndPersistOnMaster
+	case durability.LevelPersistToMajority:
+		return gocb.DurabilityLevelPersistToMajority
+	}
+	return gocb.DurabilityLevelUnknown
+}
+
+// queryDurabilityLevel returns the durability_level query parameter of op
+// for ctx, or "" for the bucket default. N1QL DML only honors it from
+// Couchbase Server 7.6.
+func (r *userRepository) queryDurabilityLevel(ctx context.Context, op durability.Op) string {
+	switch r.durability.Level(ctx, op) {
+	case durability.LevelMajority:
+		return "majority"
+	case durability.LevelMajorityAndPersistActive:
+		return "majorityAndPersistActive"
+	case durability.LevelPersistToMajority:
+		return "persistToMajority"
+	}
+	return ""
+}
+
+// scope returns the scope holding the users of the tenant in ctx.
+func (r *userRepository) scope(ctx context.Context) *gocb.Scope {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return r.bucket.Scope(id)
+	}
+	return r.bucket.DefaultScope()
+}
+
+// collection returns the users collection of the tenant in ctx.
+func (r *userRepository) collection(ctx context.Context) *gocb.Collection {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return r.bucket.Scope(id).Collection(TenantCollection)
+	}
+	return r.bucket.DefaultCollection()
+}
+
+// timeout returns the time left until the deadline of ctx, or zero for
+// the SDK default. Passing it as the operation timeout makes the SDK give
+// up, and stop retrying, when the request deadline passes.
+func timeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	// A zero timeout means the SDK default, so keep it positive.
+	return max(time.Until(deadline), time.Millisecond)
+}
+
+// contextError wraps err with the context's error once ctx is done, so
+// callers can check for context.Canceled or context.DeadlineExceeded
+// whichever error the SDK reported. SDK timeouts count as
+// context.DeadlineExceeded too, and durability levels the cluster cannot
+// meet as durability.ErrUnavailable.
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		err = fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	if errors.Is(err, gocb.ErrTimeout) && !errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+	if errors.Is(err, gocb.ErrDurabilityImpossible) || errors.Is(err, gocb.ErrDurabilityLevelNotAvailable) {
+		err = fmt.Errorf("%w: %w", durability.ErrUnavailable, err)
+	}
+	return err
 }
 
 // GetUserByID retrieves a user by their ID from Couchbase.
 func (r *userRepository) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	user, _, err := r.GetUserWithCAS(ctx, id)
+	return user, err
+}
+
+// GetUserWithCAS retrieves a user and the CAS of its document.
+func (r *userRepository) GetUserWithCAS(ctx context.Context, id string) (*model.User, uint64, error) {
 	var user model.User
-	collection := r.bucket.DefaultCollection()
-	getResult, err := collection.Get(id, nil)
+	collection := r.collection(ctx)
+	getResult, err := collection.Get(id, &gocb.GetOptions{Context: ctx, Timeout: timeout(ctx)})
 	if err != nil {
 		if errors.Is(err, gocb.ErrDocumentNotFound) {
-			return nil, ErrNotFound
+			return nil, 0, ErrNotFound
 		}
-		return nil, err
+		return nil, 0, contextError(ctx, err)
 	}
 	err = getResult.Content(&user)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	return &user, uint64(getResult.Cas()), nil
+}
+
+// GetUserFields retrieves only the given top-level fields of a user with a
+// sub-document lookup, so the rest of the document is never transferred.
+// Fields missing from the document are left out of the result.
+func (r *userRepository) GetUserFields(ctx context.Context, id string, fields []string) (map[string]json.RawMessage, error) {
+	specs := make([]gocb.LookupInSpec, len(fields))
+	for i, field := range fields {
+		specs[i] = gocb.GetSpec(field, nil)
+	}
+	result, err := r.collection(ctx).LookupIn(id, specs, &gocb.LookupInOptions{Context: ctx, Timeout: timeout(ctx)})
+	if err != nil {
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, contextError(ctx, err)
+	}
+
+	values := make(map[string]json.RawMessage, len(fields))
+	for i, field := range fields {
+		if !result.Exists(uint(i)) {
+			continue
+		}
+		var value json.RawMessage
+		if err := result.ContentAt(uint(i), &value); err != nil {
+			return nil, err
+		}
+		values[field] = value
+	}
+	return values, nil
+}
+
+// InsertUser stores a new user keyed by its ID, failing if it already exists.
+func (r *userRepository) InsertUser(ctx context.Context, user *model.User) error {
+	user.ApplyDerivedFields()
+	user.SetCreatedAt(time.Now())
+	collection := r.collection(ctx)
+	_, err := collection.Insert(user.ID, user, &gocb.InsertOptions{
+		Context:         ctx,
+		Timeout:         timeout(ctx),
+		DurabilityLevel: r.durabilityLevel(ctx, durability.OpInsert),
+	})
+	if errors.Is(err, gocb.ErrDocumentExists) {
+		return ErrAlreadyExists
+	}
+	return contextError(ctx, err)
+}
+
+// UpsertUser creates or replaces a user keyed by its ID.
+func (r *userRepository) UpsertUser(ctx context.Context, user *model.User) error {
+	user.ApplyDerivedFields()
+	collection := r.collection(ctx)
+	_, err := collection.Upsert(user.ID, user, &gocb.UpsertOptions{
+		Context:         ctx,
+		Timeout:         timeout(ctx),
+		DurabilityLevel: r.durabilityLevel(ctx, durability.OpUpsert),
+	})
+	return contextError(ctx, err)
+}
+
+// SetUserAvatar replaces only the avatar of an existing user.
+func (r *userRepository) SetUserAvatar(ctx context.Context, id string, avatar *model.Avatar) error {
+	specs := []gocb.MutateInSpec{gocb.UpsertSpec("avatar", avatar, nil)}
+	_, err := r.collection(ctx).MutateIn(id, specs, &gocb.MutateInOptions{
+		Context:         ctx,
+		Timeout:         timeout(ctx),
+		DurabilityLevel: r.durabilityLevel(ctx, durability.OpUpdate),
+	})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return ErrNotFound
+	}
+	return contextError(ctx, err)
+}
+
+// SetUserPassword replaces only the password hash of an existing user.
+func (r *userRepository) SetUserPassword(ctx context.Context, id string, hash string) error {
+	specs := []gocb.MutateInSpec{gocb.UpsertSpec("password_hash", hash, nil)}
+	_, err := r.collection(ctx).MutateIn(id, specs, &gocb.MutateInOptions{
+		Context:         ctx,
+		Timeout:         timeout(ctx),
+		DurabilityLevel: r.durabilityLevel(ctx, durability.OpUpdate),
+	})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return ErrNotFound
+	}
+	return contextError(ctx, err)
+}
+
+// ScanUsers streams every user in the collection to fn, stopping at the
+// first error returned by fn. Like the other queries it waits for pending
+// writes to be indexed, so it sees every user stored before the call.
+func (r *userRepository) ScanUsers(ctx context.Context, fn func(*model.User) error) error {
+	scope := r.scope(ctx)
+	query := fmt.Sprintf("SELECT u.* FROM `%s` u", r.collection(ctx).Name())
+	rows, err := scope.Query(query, &gocb.QueryOptions{
+		Context:         ctx,
+		Timeout:         timeout(ctx),
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+	})
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user model.User
+		if err := rows.Row(&user); err != nil {
+			return err
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+	return contextError(ctx, rows.Err())
+}
+
+// ListUsersAfter returns up to limit users whose IDs sort after afterID, in
+// ID order, so callers can page through the collection and resume later.
+func (r *userRepository) ListUsersAfter(ctx context.Context, afterID string, limit int) ([]*model.User, error) {
+	scope := r.scope(ctx)
+	query := fmt.Sprintf("SELECT u.* FROM `%s` u WHERE META(u).id > $1 ORDER BY META(u).id LIMIT $2",
+		r.collection(ctx).Name())
+	rows, err := scope.Query(query, &gocb.QueryOptions{
+		Context:              ctx,
+		Timeout:              timeout(ctx),
+		PositionalParameters: []interface{}{afterID, limit},
+		ScanConsistency:      gocb.QueryScanConsistencyRequestPlus,
+	})
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		var user model.User
+		if err := rows.Row(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, contextError(ctx, rows.Err())
+}
+
+// CountUsers returns the number of users in the collection.
+func (r *userRepository) CountUsers(ctx context.Context) (int, error) {
+	scope := r.scope(ctx)
+	query := fmt.Sprintf("SELECT RAW COUNT(*) FROM `%s`", r.collection(ctx).Name())
+	rows, err := scope.Query(query, &gocb.QueryOptions{
+		Context:         ctx,
+		Timeout:         timeout(ctx),
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+	})
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+	var count int
+	if err := rows.One(&count); err != nil {
+		return 0, contextError(ctx, err)
+	}
+	return count, nil
+}
+
+// CountUsersCreatedSince returns the number of users created at or after
+// since. Creation times are compared as milliseconds, since their RFC 3339
+// strings do not sort by time when their fractional seconds differ.
+func (r *userRepository) CountUsersCreatedSince(ctx context.Context, since time.Time) (int, error) {
+	query := fmt.Sprintf("SELECT RAW COUNT(*) FROM `%s` u WHERE STR_TO_MILLIS(u.created_at) >= $1",
+		r.collection(ctx).Name())
+	rows, err := r.scope(ctx).Query(query, &gocb.QueryOptions{
+		Context:              ctx,
+		Timeout:              timeout(ctx),
+		PositionalParameters: []interface{}{since.UnixMilli()},
+		ScanConsistency:      gocb.QueryScanConsistencyRequestPlus,
+	})
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+	var count int
+	if err := rows.One(&count); err != nil {
+		return 0, contextError(ctx, err)
+	}
+	return count, nil
+}
+
+// CountUsersMatching returns the number of users sel matches.
+func (r *userRepository) CountUsersMatching(ctx context.Context, sel Selector) (int, error) {
+	where, params := sel.where("u")
+	query := fmt.Sprintf("SELECT RAW COUNT(*) FROM `%s` u WHERE %s", r.collection(ctx).Name(), where)
+	rows, err := r.scope(ctx).Query(query, &gocb.QueryOptions{
+		Context:              ctx,
+		Timeout:              timeout(ctx),
+		PositionalParameters: params,
+		ScanConsistency:      gocb.QueryScanConsistencyRequestPlus,
+	})
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+	var count int
+	if err := rows.One(&count); err != nil {
+		return 0, contextError(ctx, err)
+	}
+	return count, nil
+}
+
+// DeleteUsersMatching deletes the users sel matches with a single N1QL
+// DELETE, returning the deleted documents. The delete durability level
+// applies to every document.
+func (r *userRepository) DeleteUsersMatching(ctx context.Context, sel Selector) ([]*model.User, error) {
+	where, params := sel.where("u")
+	query := fmt.Sprintf("DELETE FROM `%s` u WHERE %s RETURNING u.*", r.collection(ctx).Name(), where)
+	opts := &gocb.QueryOptions{
+		Context:              ctx,
+		Timeout:              timeout(ctx),
+		PositionalParameters: params,
+		ScanConsistency:      gocb.QueryScanConsistencyRequestPlus,
+	}
+	if level := r.queryDurabilityLevel(ctx, durability.OpDelete); level != "" {
+		opts.Raw = map[string]interface{}{"durability_level": level}
+	}
+	rows, err := r.scope(ctx).Query(query, opts)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		var user model.User
+		if err := rows.Row(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
 	}
-	return &user, nil
+	return users, contextError(ctx, rows.Err())
 }
@@ -0,0 +1,56 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/gnsalok/go-project-root/go-db-data-api/durability"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository/repositorytest"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCouchbaseUserRepositoryContract runs the contract against a real
+// cluster. It is skipped unless COUCHBASE_CONNSTR is set, e.g. to
+// couchbase://localhost after make docker-up; COUCHBASE_USERNAME,
+// COUCHBASE_PASSWORD and COUCHBASE_BUCKET default to the docker-compose
+// setup. Every test case gets a freshly provisioned tenant scope, which is
+// dropped afterwards.
+func TestCouchbaseUserRepositoryContract(t *testing.T) {
+	connStr := os.Getenv("COUCHBASE_CONNSTR")
+	if connStr == "" {
+		t.Skip("COUCHBASE_CONNSTR not set")
+	}
+	cluster, err := gocb.Connect(connStr, gocb.ClusterOptions{
+		Username: envOr("COUCHBASE_USERNAME", "Administrator"),
+		Password: envOr("COUCHBASE_PASSWORD", "password"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { cluster.Close(nil) })
+
+	bucket := cluster.Bucket(envOr("COUCHBASE_BUCKET", "users"))
+	require.NoError(t, bucket.WaitUntilReady(10*time.Second, nil))
+
+	tenants := repository.NewTenantRepository(bucket)
+	users := repository.NewUserRepository(bucket, durability.Config{})
+	repositorytest.RunUserRepositoryContract(t, func(t *testing.T) (repository.UserRepository, context.Context) {
+		id := fmt.Sprintf("contract-%d", time.Now().UnixNano())
+		require.NoError(t, tenants.ProvisionTenant(context.Background(), id))
+		t.Cleanup(func() {
+			_ = bucket.CollectionsV2().DropScope(id, nil)
+		})
+		return users, tenant.WithID(context.Background(), id)
+	})
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,16 @@
+//go:build dev
+
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// DevBuild reports whether this binary was built with the dev tag.
+const DevBuild = true
+
+// setupDevRoutes adds the admin routes only dev builds serve: POST
+// /admin/seed, loading fixture users.
+func setupDevRoutes(admin *gin.RouterGroup, d Deps) {
+	admin.POST("/seed", d.Seed.Seed)
+}
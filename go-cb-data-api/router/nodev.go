@@ -0,0 +1,13 @@
+//go:build !dev
+
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// DevBuild reports whether this binary was built with the dev tag.
+const DevBuild = false
+
+// setupDevRoutes adds nothing outside dev builds.
+func setupDevRoutes(admin *gin.RouterGroup, d Deps) {}
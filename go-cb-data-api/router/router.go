@@ -1,18 +1,89 @@
 package router
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/gnsalok/go-project-root/go-db-data-api/durability"
 	"github.com/gnsalok/go-project-root/go-db-data-api/handler"
+	"github.com/gnsalok/go-project-root/go-db-data-api/middleware"
+	"github.com/gnsalok/go-project-root/go-db-data-api/quota"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-// SetupRouter initializes the Gin router with all routes.
-func SetupRouter(userHandler *handler.UserHandler) *gin.Engine {
+// Deps are the handlers and settings the router wires together.
+type Deps struct {
+	User        *handler.UserHandler
+	BulkDelete  *handler.BulkDeleteHandler
+	Backup      *handler.BackupHandler
+	Reindex     *handler.ReindexHandler
+	Tenant      *handler.TenantHandler
+	Avatar      *handler.AvatarHandler
+	Admin       *handler.AdminHandler
+	Credentials *handler.CredentialsHandler
+	Quota       *handler.QuotaHandler
+	// Seed serves POST /admin/seed in dev builds; other builds ignore it.
+	Seed *handler.SeedHandler
+
+	TenantConfig     tenant.Config
+	AuthConfig       auth.Config
+	CORSConfig       middleware.CORSConfig
+	DurabilityConfig durability.Config
+	RequestTimeout   time.Duration
+}
+
+// SetupRouter initializes the Gin router with all routes. User routes are
+// scoped to the caller's tenant and role; only admins may use /admin.
+func SetupRouter(d Deps) *gin.Engine {
 	r := gin.Default()
+	if d.Admin.Requests != nil {
+		r.Use(d.Admin.Requests.Middleware())
+	}
+	r.Use(middleware.CORS(d.CORSConfig), middleware.Timeout(d.RequestTimeout), middleware.Gzip(), durability.Middleware(d.DurabilityConfig))
+
+	quotas := quota.Middleware(d.Quota.Config, d.Quota.Store)
 
 	// User routes
-	r.GET("/users/:id", userHandler.GetUserByID)
+	users := r.Group("/users", auth.Middleware(d.AuthConfig), tenant.Middleware(d.TenantConfig, d.Tenant.Repo), quotas)
+	{
+		users.GET("/:id", d.User.GetUserByID)
+		users.POST("/:id/avatar", d.Avatar.Upload)
+		users.GET("/:id/avatar", d.Avatar.Get)
+		users.POST("/:id/password", d.Credentials.SetPassword)
+		users.DELETE("", auth.RequireRole("admin"), d.BulkDelete.Delete)
+	}
+
+	// Login, issuing session tokens
+	r.POST("/login", tenant.Middleware(d.TenantConfig, d.Tenant.Repo), quotas, d.Credentials.Login)
+
+	// Avatar downloads, for stores that serve signed URLs themselves
+	if files, ok := d.Avatar.Store.(http.Handler); ok {
+		r.GET("/avatars/*key", gin.WrapH(files))
+	}
+
+	// Admin routes, all requiring the admin role
+	admin := r.Group("/admin", auth.Middleware(d.AuthConfig), auth.RequireRole("admin"))
+	{
+		admin.POST("/backups", d.Backup.StartBackup)
+		admin.GET("/backups", d.Backup.ListBackups)
+		admin.GET("/backups/jobs/:id", d.Backup.GetJob)
+		admin.POST("/backups/:id/restore", d.Backup.Restore)
+		admin.POST("/reindex", d.Reindex.Start)
+		admin.GET("/reindex/status", d.Reindex.Status)
+		admin.POST("/reindex/cancel", d.Reindex.Cancel)
+		admin.POST("/tenants", d.Tenant.Provision)
+		admin.GET("/tenants", d.Tenant.List)
+		admin.GET("/stats", d.Admin.Stats)
+		admin.GET("/config", d.Admin.GetConfig)
+		admin.GET("/quotas/:key", d.Quota.Get)
+		admin.PUT("/quotas/:key", d.Quota.Set)
+		admin.DELETE("/quotas/:key", d.Quota.Delete)
+		setupDevRoutes(admin, d)
+	}
 
 	// Swagger route
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -0,0 +1,224 @@
+// Package seed loads fixture users into Couchbase, so demos and
+// integration environments start with predictable data. Loading is
+// idempotent: users already matching their fixture are left alone, so the
+// same fixtures can be loaded on every start.
+package seed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+)
+
+// ErrInvalid is returned for fixtures that cannot be loaded.
+var ErrInvalid = errors.New("invalid fixtures")
+
+// Fixtures are the users to load outside any tenant, and the tenants to
+// provision with their own users.
+//
+//	{
+//	  "users": [{"id": "user1", "name": "John Doe", "email": "john.doe@example.com", "password": "changeme1"}],
+//	  "tenants": [{"id": "acme", "users": [{"id": "user1", "name": "Road Runner"}]}]
+//	}
+type Fixtures struct {
+	Users   []User   `json:"users"`
+	Tenants []Tenant `json:"tenants"`
+}
+
+// Tenant is a tenant to provision and the users to load into it.
+type Tenant struct {
+	ID    string `json:"id"`
+	Users []User `json:"users"`
+}
+
+// User is a fixture user. Password, if set, is stored as its bcrypt hash;
+// without it the user's password is left as it is. CreatedAt pins the
+// creation time, e.g. to make signup stats predictable.
+type User struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	Password  string     `json:"password,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Result counts what a load did.
+type Result struct {
+	TenantsProvisioned int `json:"tenants_provisioned"`
+	Created            int `json:"created"`
+	Updated            int `json:"updated"`
+	Unchanged          int `json:"unchanged"`
+}
+
+// Parse decodes and validates fixtures. Unknown fields are rejected, so a
+// typo does not silently load a user without its email.
+func Parse(data []byte) (*Fixtures, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var f Fixtures
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// ReadFile parses the fixtures in the file at path.
+func ReadFile(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Validate checks every user has an ID unique within its tenant and a
+// usable password, and every tenant a valid, unique ID.
+func (f *Fixtures) Validate() error {
+	if err := validateUsers("", f.Users); err != nil {
+		return err
+	}
+	tenants := make(map[string]bool, len(f.Tenants))
+	for _, t := range f.Tenants {
+		if err := tenant.ValidateID(t.ID); err != nil {
+			return fmt.Errorf("%w: tenant %q: %v", ErrInvalid, t.ID, err)
+		}
+		if tenants[t.ID] {
+			return fmt.Errorf("%w: tenant %q is listed twice", ErrInvalid, t.ID)
+		}
+		tenants[t.ID] = true
+		if err := validateUsers(t.ID, t.Users); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateUsers(tenantID string, users []User) error {
+	where := ""
+	if tenantID != "" {
+		where = fmt.Sprintf(" of tenant %q", tenantID)
+	}
+	ids := make(map[string]bool, len(users))
+	for i, u := range users {
+		if u.ID == "" {
+			return fmt.Errorf("%w: user %d%s has no id", ErrInvalid, i, where)
+		}
+		if ids[u.ID] {
+			return fmt.Errorf("%w: user %q%s is listed twice", ErrInvalid, u.ID, where)
+		}
+		ids[u.ID] = true
+		if u.Password != "" && (len(u.Password) < auth.MinPasswordLength || len(u.Password) > auth.MaxPasswordLength) {
+			return fmt.Errorf("%w: user %q%s: %v", ErrInvalid, u.ID, where, auth.ErrInvalidPassword)
+		}
+	}
+	return nil
+}
+
+// Loader loads fixtures into the user and tenant repositories.
+type Loader struct {
+	Users   repository.UserRepository
+	Tenants repository.TenantRepository
+}
+
+// Load provisions the fixture tenants and creates or updates the fixture
+// users. Users are matched by ID; fields a fixture does not mention, such
+// as avatars, are kept. Loading stops at the first error, and loading the
+// fixtures again completes the rest.
+func (l *Loader) Load(ctx context.Context, f *Fixtures) (Result, error) {
+	var res Result
+	if err := l.loadUsers(ctx, f.Users, &res); err != nil {
+		return res, err
+	}
+	for _, t := range f.Tenants {
+		err := l.Tenants.ProvisionTenant(ctx, t.ID)
+		switch {
+		case err == nil:
+			res.TenantsProvisioned++
+		case !errors.Is(err, repository.ErrTenantExists):
+			return res, fmt.Errorf("provision tenant %s: %w", t.ID, err)
+		}
+		if err := l.loadUsers(tenant.WithID(ctx, t.ID), t.Users, &res); err != nil {
+			return res, fmt.Errorf("tenant %s: %w", t.ID, err)
+		}
+	}
+	return res, nil
+}
+
+func (l *Loader) loadUsers(ctx context.Context, users []User, res *Result) error {
+	for _, u := range users {
+		if err := l.loadUser(ctx, u, res); err != nil {
+			return fmt.Errorf("user %s: %w", u.ID, err)
+		}
+	}
+	return nil
+}
+
+// loadUser inserts u, or updates the stored user if it differs from u.
+// When another loader inserts the user first, it is compared once more.
+func (l *Loader) loadUser(ctx context.Context, u User, res *Result) error {
+	for attempt := 0; ; attempt++ {
+		existing, err := l.Users.GetUserByID(ctx, u.ID)
+		if errors.Is(err, repository.ErrNotFound) {
+			user := &model.User{ID: u.ID, Name: u.Name, Email: u.Email, CreatedAt: u.CreatedAt}
+			if user.PasswordHash, err = hashPassword(u.Password); err != nil {
+				return err
+			}
+			err = l.Users.InsertUser(ctx, user)
+			if errors.Is(err, repository.ErrAlreadyExists) && attempt == 0 {
+				continue
+			}
+			if err == nil {
+				res.Created++
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		changed := existing.Name != u.Name || existing.Email != u.Email
+		existing.Name, existing.Email = u.Name, u.Email
+		if u.CreatedAt != nil && (existing.CreatedAt == nil || !existing.CreatedAt.Equal(*u.CreatedAt)) {
+			existing.CreatedAt = u.CreatedAt
+			changed = true
+		}
+		if u.Password != "" && !auth.CheckPassword(existing.PasswordHash, u.Password) {
+			if existing.PasswordHash, err = hashPassword(u.Password); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if !changed {
+			res.Unchanged++
+			return nil
+		}
+		if err := l.Users.UpsertUser(ctx, existing); err != nil {
+			return err
+		}
+		res.Updated++
+		return nil
+	}
+}
+
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	return auth.HashPassword(password)
+}
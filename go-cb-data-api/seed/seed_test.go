@@ -0,0 +1,99 @@
+package seed_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/go-db-data-api/auth"
+	"github.com/gnsalok/go-project-root/go-db-data-api/model"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository/mocks"
+	"github.com/gnsalok/go-project-root/go-db-data-api/seed"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const fixtures = `{
+  "users": [
+    {"id": "user1", "name": "John Doe", "email": "john.doe@example.com", "password": "changeme1"},
+    {"id": "user2", "name": "Jane Doe", "email": "jane.doe@example.com", "created_at": "2024-01-02T03:04:05Z"}
+  ],
+  "tenants": [{"id": "acme", "users": [{"id": "user1", "name": "Road Runner"}]}]
+}`
+
+// TestParse checks invalid fixtures are rejected before anything loads.
+func TestParse(t *testing.T) {
+	f, err := seed.Parse([]byte(fixtures))
+	require.NoError(t, err)
+	assert.Len(t, f.Users, 2)
+	assert.Equal(t, "acme", f.Tenants[0].ID)
+
+	testCases := map[string]string{
+		"unknown field":   `{"users": [{"id": "user1", "mail": "john.doe@example.com"}]}`,
+		"missing id":      `{"users": [{"name": "John Doe"}]}`,
+		"duplicate user":  `{"users": [{"id": "user1"}, {"id": "user1"}]}`,
+		"short password":  `{"users": [{"id": "user1", "password": "short"}]}`,
+		"invalid tenant":  `{"tenants": [{"id": "_system"}]}`,
+		"duplicate scope": `{"tenants": [{"id": "acme"}, {"id": "acme"}]}`,
+		"not JSON":        `users: []`,
+	}
+	for name, doc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := seed.Parse([]byte(doc))
+			assert.ErrorIs(t, err, seed.ErrInvalid)
+		})
+	}
+}
+
+// TestLoad checks loading creates the users and tenants once, and loading
+// again only updates what changed, keeping fields the fixtures leave out.
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tenants := mocks.NewTenantRepository(t)
+	tenants.On("ProvisionTenant", mock.Anything, "acme").Return(nil).Once()
+	tenants.On("ProvisionTenant", mock.Anything, "acme").Return(repository.ErrTenantExists)
+	loader := &seed.Loader{Users: users, Tenants: tenants}
+
+	f, err := seed.Parse([]byte(fixtures))
+	require.NoError(t, err)
+	res, err := loader.Load(ctx, f)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{TenantsProvisioned: 1, Created: 3}, res)
+
+	user1, err := users.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "john.doe@example.com", user1.EmailLower)
+	assert.True(t, auth.CheckPassword(user1.PasswordHash, "changeme1"))
+	user2, err := users.GetUserByID(ctx, "user2")
+	require.NoError(t, err)
+	assert.True(t, user2.CreatedAt.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+	runner, err := users.GetUserByID(tenant.WithID(ctx, "acme"), "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "Road Runner", runner.Name)
+
+	res, err = loader.Load(ctx, f)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{Unchanged: 3}, res)
+
+	// A user edited since is put back; its avatar stays.
+	user1.Name = "Johnny"
+	user1.Avatar = &model.Avatar{Key: "user1.png"}
+	require.NoError(t, users.UpsertUser(ctx, user1))
+	f.Users[1].Password = "changeme2"
+	res, err = loader.Load(ctx, f)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{Updated: 2, Unchanged: 1}, res)
+
+	user1, err = users.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "John Doe", user1.Name)
+	require.NotNil(t, user1.Avatar)
+	assert.Equal(t, "user1.png", user1.Avatar.Key)
+	user2, err = users.GetUserByID(ctx, "user2")
+	require.NoError(t, err)
+	assert.True(t, auth.CheckPassword(user2.PasswordHash, "changeme2"))
+}
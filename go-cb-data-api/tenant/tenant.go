@@ -0,0 +1,137 @@
+// Package tenant resolves the tenant a request belongs to and carries it
+// through the request context, so the repository can route each operation
+// to the tenant's own Couchbase scope.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultHeader is the request header the tenant is read from by default.
+const DefaultHeader = "X-Tenant-ID"
+
+// ErrInvalidID is returned for tenant IDs that cannot name a scope.
+var ErrInvalidID = errors.New("tenant ID must be 1-64 letters, digits, '-' or '_' and start with a letter or digit")
+
+// idPattern is a subset of the Couchbase scope name rules: scopes starting
+// with '_' or '%' are reserved, so tenants may not use them.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// ValidateID reports whether id can be used as a tenant ID.
+func ValidateID(id string) error {
+	if !idPattern.MatchString(id) {
+		return ErrInvalidID
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+// WithID returns a copy of ctx carrying the tenant ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ID carried by ctx, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// Lookup reports whether a tenant has been provisioned.
+type Lookup interface {
+	TenantExists(ctx context.Context, id string) (bool, error)
+}
+
+// Config controls how tenants are resolved from requests.
+type Config struct {
+	// Header is the request header holding the tenant ID. Empty means
+	// DefaultHeader.
+	Header string
+	// BaseDomain enables subdomain resolution: a request for
+	// acme.api.example.com with BaseDomain "api.example.com" belongs to
+	// tenant "acme". The header takes precedence when both are present.
+	BaseDomain string
+	// Required rejects requests without a tenant. Otherwise they are
+	// served from the bucket's default scope.
+	Required bool
+}
+
+// ConfigFromEnv reads TENANT_HEADER, TENANT_BASE_DOMAIN and TENANT_REQUIRED.
+func ConfigFromEnv() Config {
+	return Config{
+		Header:     os.Getenv("TENANT_HEADER"),
+		BaseDomain: os.Getenv("TENANT_BASE_DOMAIN"),
+		Required:   os.Getenv("TENANT_REQUIRED") == "true",
+	}
+}
+
+// Resolve returns the tenant ID named by the request, or "" if there is
+// none.
+func (c Config) Resolve(r *http.Request) string {
+	header := c.Header
+	if header == "" {
+		header = DefaultHeader
+	}
+	if id := strings.TrimSpace(r.Header.Get(header)); id != "" {
+		return id
+	}
+	if c.BaseDomain == "" {
+		return ""
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	sub, ok := strings.CutSuffix(host, "."+strings.ToLower(c.BaseDomain))
+	if !ok || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
+
+// Middleware resolves the tenant of each request, checks it with lookup
+// and stores it in the request context. Unknown tenants get a 404 rather
+// than reaching Couchbase, where operations on a missing scope only fail
+// after the retry timeout.
+func Middleware(cfg Config, lookup Lookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := cfg.Resolve(c.Request)
+		if id == "" {
+			if cfg.Required {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Tenant is required"})
+				return
+			}
+			c.Next()
+			return
+		}
+		if err := ValidateID(id); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		exists, err := lookup.TenantExists(c.Request.Context(), id)
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.Request = c.Request.WithContext(WithID(c.Request.Context(), id))
+		c.Next()
+	}
+}
@@ -0,0 +1,93 @@
+package tenant_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnsalok/go-project-root/go-db-data-api/repository/mocks"
+	"github.com/gnsalok/go-project-root/go-db-data-api/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestResolve checks the header takes precedence over the subdomain and
+// that only direct subdomains of the base domain name a tenant.
+func TestResolve(t *testing.T) {
+	cfg := tenant.Config{BaseDomain: "api.example.com"}
+
+	testCases := []struct {
+		name     string
+		host     string
+		header   string
+		expected string
+	}{
+		{name: "Header", host: "api.example.com", header: "acme", expected: "acme"},
+		{name: "Header Wins", host: "globex.api.example.com", header: "acme", expected: "acme"},
+		{name: "Subdomain", host: "Globex.API.example.com:8080", expected: "globex"},
+		{name: "Base Domain", host: "api.example.com", expected: ""},
+		{name: "Nested Subdomain", host: "a.b.api.example.com", expected: ""},
+		{name: "Other Domain", host: "acme.example.org", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Host = tc.host
+			if tc.header != "" {
+				req.Header.Set(tenant.DefaultHeader, tc.header)
+			}
+			assert.Equal(t, tc.expected, cfg.Resolve(req))
+		})
+	}
+}
+
+// TestMiddleware checks requests reach the handler only for provisioned
+// tenants, with the tenant stored in the request context.
+func TestMiddleware(t *testing.T) {
+	lookup := mocks.NewTenantRepository(t)
+	lookup.On("TenantExists", mock.Anything, "acme").Return(true, nil)
+	lookup.On("TenantExists", mock.Anything, "globex").Return(false, nil)
+	lookup.On("TenantExists", mock.Anything, "initech").Return(false, errors.New("cluster unavailable"))
+
+	newRouter := func(cfg tenant.Config) *gin.Engine {
+		router := gin.New()
+		router.Use(tenant.Middleware(cfg, lookup))
+		router.GET("/users/:id", func(c *gin.Context) {
+			id, _ := tenant.FromContext(c.Request.Context())
+			c.String(http.StatusOK, id)
+		})
+		return router
+	}
+
+	testCases := []struct {
+		name         string
+		required     bool
+		tenantID     string
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "Provisioned Tenant", tenantID: "acme", expectedCode: http.StatusOK, expectedBody: "acme"},
+		{name: "No Tenant", expectedCode: http.StatusOK, expectedBody: ""},
+		{name: "Tenant Required", required: true, expectedCode: http.StatusBadRequest, expectedBody: `{"error":"Tenant is required"}`},
+		{name: "Invalid Tenant", tenantID: "_system", expectedCode: http.StatusBadRequest, expectedBody: `{"error":"` + tenant.ErrInvalidID.Error() + `"}`},
+		{name: "Unknown Tenant", tenantID: "globex", expectedCode: http.StatusNotFound, expectedBody: `{"error":"Tenant not found"}`},
+		{name: "Lookup Error", tenantID: "initech", expectedCode: http.StatusInternalServerError, expectedBody: `{"error":"Internal server error"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			if tc.tenantID != "" {
+				req.Header.Set(tenant.DefaultHeader, tc.tenantID)
+			}
+			rr := httptest.NewRecorder()
+			newRouter(tenant.Config{Required: tc.required}).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			assert.Equal(t, tc.expectedBody, rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Account list page sizes.
+const (
+	defaultAccountPageSize = 50
+	maxAccountPageSize     = 200
+)
+
+// Account list sort keys. Each is backed by an index on the column and id,
+// and a leading "-" sorts descending.
+const (
+	SortByID        = "id"
+	SortByBalance   = "balance"
+	SortByCreatedAt = "createdAt"
+	SortByLastName  = "lastname"
+)
+
+// AccountQuery selects one page of accounts. Accounts are ordered by the
+// sort key and then by id, so pages are stable while accounts change.
+type AccountQuery struct {
+	// OwnerID restricts the list to a customer's accounts; zero lists all.
+	OwnerID int
+	// Name matches accounts whose first or last name starts with it,
+	// ignoring case.
+	Name       string
+	MinBalance *int64
+	MaxBalance *int64
+	// Statuses keeps accounts in any of the given lifecycle states; empty
+	// keeps all.
+	Statuses []string
+	Sort     string
+	Desc     bool
+	Limit    int
+	// After is the position of the last account on the previous page.
+	After *AccountCursor
+}
+
+// AccountCursor is the sort key and id of the last account on a page.
+// Key is the sort column formatted by sortKeyOf.
+type AccountCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	Key  string `json:"k"`
+	ID   int    `json:"i"`
+}
+
+func (c *AccountCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeAccountCursor(s string) (*AccountCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := new(AccountCursor)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AccountPage is one page of accounts. NextCursor is empty on the last page.
+type AccountPage struct {
+	Accounts   []*Account
+	NextCursor string
+}
+
+// sortKeyOf formats acc's value for the sort key, as stored in cursors.
+func sortKeyOf(sortBy string, acc *Account) string {
+	switch sortBy {
+	case SortByBalance:
+		return strconv.FormatInt(acc.Balance, 10)
+	case SortByCreatedAt:
+		return acc.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case SortByLastName:
+		return strings.ToLower(acc.LastName)
+	}
+	return strconv.Itoa(acc.ID)
+}
+
+// ParseAccountQuery reads the limit, cursor, name, minBalance, maxBalance,
+// status and sort query parameters, reporting every invalid one together.
+func ParseAccountQuery(params url.Values) (*AccountQuery, error) {
+	var v Validator
+	q := &AccountQuery{Sort: SortByID, Limit: defaultAccountPageSize}
+
+	if s := params.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		v.Checkf(err == nil && limit > 0 && limit <= maxAccountPageSize, "limit", "must be between 1 and %d", maxAccountPageSize)
+		q.Limit = limit
+	}
+	q.Name = strings.TrimSpace(params.Get("name"))
+	v.Check(len(q.Name) <= 100, "name", "must be at most 100 characters")
+	for _, bound := range []struct {
+		field string
+		dst   **int64
+	}{{"minBalance", &q.MinBalance}, {"maxBalance", &q.MaxBalance}} {
+		if s := params.Get(bound.field); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			v.Check(err == nil, bound.field, "must be an integer amount in minor units")
+			*bound.dst = &n
+		}
+	}
+	if q.MinBalance != nil && q.MaxBalance != nil {
+		v.Check(*q.MinBalance <= *q.MaxBalance, "maxBalance", "must not be less than minBalance")
+	}
+	if s := params.Get("status"); s != "" {
+		for _, status := range strings.Split(s, ",") {
+			_, known := accountTransitions[status]
+			v.Checkf(known, "status", "unknown status %q", status)
+			q.Statuses = append(q.Statuses, status)
+		}
+	}
+	if s := params.Get("sort"); s != "" {
+		q.Sort, q.Desc = strings.CutPrefix(s, "-")
+		switch q.Sort {
+		case SortByID, SortByBalance, SortByCreatedAt, SortByLastName:
+		default:
+			v.Checkf(false, "sort", "must be one of %s, %s, %s or %s, optionally prefixed with -",
+				SortByID, SortByBalance, SortByCreatedAt, SortByLastName)
+		}
+	}
+	if s := params.Get("cursor"); s != "" {
+		after, err := decodeAccountCursor(s)
+		switch {
+		case err != nil:
+			v.Check(false, "cursor", "is malformed")
+		case after.Sort != q.Sort || after.Desc != q.Desc:
+			v.Check(false, "cursor", "was issued for a different sort")
+		case !validSortKey(after):
+			v.Check(false, "cursor", "is malformed")
+		default:
+			q.After = after
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func validSortKey(c *AccountCursor) bool {
+	var err error
+	switch c.Sort {
+	case SortByBalance:
+		_, err = strconv.ParseInt(c.Key, 10, 64)
+	case SortByCreatedAt:
+		_, err = time.Parse(time.RFC3339Nano, c.Key)
+	case SortByID:
+		_, err = strconv.Atoi(c.Key)
+	}
+	return err == nil
+}
+
+// page trims accounts, fetched with one extra row, to the query's limit
+// and sets the cursor for the next page.
+func (q *AccountQuery) page(accounts []*Account) *AccountPage {
+	p := &AccountPage{Accounts: accounts}
+	if len(accounts) > q.Limit {
+		p.Accounts = accounts[:q.Limit]
+		last := p.Accounts[q.Limit-1]
+		next := &AccountCursor{Sort: q.Sort, Desc: q.Desc, Key: sortKeyOf(q.Sort, last), ID: last.ID}
+		p.NextCursor = next.Encode()
+	}
+	return p
+}
+
+// handleListAccounts lists every account for the admin token and the
+// caller's own accounts for customers.
+func (s *APIServer) handleListAccounts(w http.ResponseWriter, r *http.Request) error {
+	q, err := ParseAccountQuery(r.URL.Query())
+	if err != nil {
+		return validationFailed(err)
+	}
+	if p := principalFrom(r.Context()); !p.admin {
+		q.OwnerID = p.customer.ID
+	}
+	page, err := s.store.ListAccounts(q)
+	if err != nil {
+		return err
+	}
+	meta := Meta{"limit": q.Limit}
+	if page.NextCursor != "" {
+		meta["nextCursor"] = page.NextCursor
+	}
+	return writeData(w, http.StatusOK, page.Accounts, meta)
+}
+
+// accountSortColumns maps sort keys to the indexed expressions ordering them.
+var accountSortColumns = map[string]string{
+	SortByID:        "id",
+	SortByBalance:   "balance",
+	SortByCreatedAt: "created_at",
+	SortByLastName:  "lower(last_name)",
+}
+
+// likePrefix escapes s for use as a LIKE prefix pattern.
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(s)) + "%"
+}
+
+func (s *PostgresStore) ListAccounts(q *AccountQuery) (*AccountPage, error) {
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if q.OwnerID != 0 {
+		where = append(where, "id in (select account_id from account_owner where customer_id = "+arg(q.OwnerID)+")")
+	}
+	if q.Name != "" {
+		p := arg(likePrefix(q.Name))
+		where = append(where, "(lower(first_name) like "+p+" or lower(last_name) like "+p+")")
+	}
+	if q.MinBalance != nil {
+		where = append(where, "balance >= "+arg(*q.MinBalance))
+	}
+	if q.MaxBalance != nil {
+		where = append(where, "balance <= "+arg(*q.MaxBalance))
+	}
+	if len(q.Statuses) > 0 {
+		where = append(where, "status = any("+arg(pq.Array(q.Statuses))+")")
+	}
+	column, dir, op := accountSortColumns[q.Sort], "asc", ">"
+	if q.Desc {
+		dir, op = "desc", "<"
+	}
+	if q.After != nil {
+		var key any = q.After.Key
+		switch q.Sort {
+		case SortByBalance:
+			key, _ = strconv.ParseInt(q.After.Key, 10, 64)
+		case SortByCreatedAt:
+			key, _ = time.Parse(time.RFC3339Nano, q.After.Key)
+		case SortByID:
+			key, _ = strconv.Atoi(q.After.Key)
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", column, op, arg(key), arg(q.After.ID)))
+	}
+	query := `select ` + accountColumns + ` from account`
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += fmt.Sprintf(" order by %s %s, id %s limit %s", column, dir, dir, arg(q.Limit+1))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	accounts := []*Account{}
+	for rows.Next() {
+		acc, err := scanIntoAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, acc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return q.page(accounts), nil
+}
+
+// matches reports whether acc passes the query's filters and comes after
+// its cursor.
+func (q *AccountQuery) matches(acc *Account) bool {
+	if q.Name != "" {
+		name := strings.ToLower(q.Name)
+		if !strings.HasPrefix(strings.ToLower(acc.FirstName), name) && !strings.HasPrefix(strings.ToLower(acc.LastName), name) {
+			return false
+		}
+	}
+	if (q.MinBalance != nil && acc.Balance < *q.MinBalance) || (q.MaxBalance != nil && acc.Balance > *q.MaxBalance) {
+		return false
+	}
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, acc.Status) {
+		return false
+	}
+	if q.After != nil {
+		after := &Account{ID: q.After.ID}
+		switch q.Sort {
+		case SortByBalance:
+			after.Balance, _ = strconv.ParseInt(q.After.Key, 10, 64)
+		case SortByCreatedAt:
+			after.CreatedAt, _ = time.Parse(time.RFC3339Nano, q.After.Key)
+		case SortByLastName:
+			after.LastName = q.After.Key
+		}
+		return q.less(after, acc)
+	}
+	return true
+}
+
+// less orders accounts by the query's sort key and then id.
+func (q *AccountQuery) less(a, b *Account) bool {
+	c := 0
+	switch q.Sort {
+	case SortByBalance:
+		c = cmp.Compare(a.Balance, b.Balance)
+	case SortByCreatedAt:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case SortByLastName:
+		c = strings.Compare(strings.ToLower(a.LastName), strings.ToLower(b.LastName))
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	if q.Desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+// sortAccounts orders accounts for q.
+func (q *AccountQuery) sortAccounts(accounts []*Account) {
+	sort.Slice(accounts, func(i, j int) bool { return q.less(accounts[i], accounts[j]) })
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Account search page sizes and the deepest offset served; searches are
+// for finding an account, so callers should refine q rather than page on.
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+	maxSearchOffset       = 1000
+)
+
+// trigramThreshold is the least similarity of a fuzzy match. It is the
+// default of pg_trgm's similarity_threshold, which the % operator uses.
+const trigramThreshold = 0.3
+
+// How a search result matched.
+const (
+	MatchAccountNumber = "accountNumber"
+	MatchPrefix        = "prefix"
+	MatchFuzzy         = "fuzzy"
+)
+
+// AccountSearch finds accounts by account number, when Text is all
+// digits, or else by first, last or full name: names starting with Text
+// come first, then names similar to it by trigrams, most similar first.
+type AccountSearch struct {
+	// OwnerID restricts the search to a customer's accounts; zero searches
+	// all.
+	OwnerID int
+	Text    string
+	Limit   int
+	Offset  int
+}
+
+// AccountMatch is a search result. Score is the trigram similarity of the
+// best matching name, 1 for account numbers.
+type AccountMatch struct {
+	*Account
+	Match string  `json:"match"`
+	Score float64 `json:"score"`
+}
+
+// accountNumber returns the account number searched for, if Text is one.
+func (q *AccountSearch) accountNumber() (int64, bool) {
+	if strings.IndexFunc(q.Text, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(q.Text, 10, 64)
+	return n, err == nil
+}
+
+// ParseAccountSearch reads the q, limit and offset query parameters,
+// reporting every invalid one together.
+func ParseAccountSearch(params url.Values) (*AccountSearch, error) {
+	var v Validator
+	q := &AccountSearch{Limit: defaultSearchPageSize}
+
+	// Spaces and dashes people type in account numbers are dropped.
+	q.Text = strings.Join(strings.Fields(params.Get("q")), " ")
+	if digits := strings.NewReplacer(" ", "", "-", "").Replace(q.Text); digits != "" && strings.Trim(digits, "0123456789") == "" {
+		q.Text = digits
+	}
+	v.Check(q.Text != "", "q", "is required")
+	v.Check(len(q.Text) <= 100, "q", "must be at most 100 characters")
+	if s := params.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		v.Checkf(err == nil && limit > 0 && limit <= maxSearchPageSize, "limit", "must be between 1 and %d", maxSearchPageSize)
+		q.Limit = limit
+	}
+	if s := params.Get("offset"); s != "" {
+		offset, err := strconv.Atoi(s)
+		v.Checkf(err == nil && offset >= 0 && offset <= maxSearchOffset, "offset", "must be between 0 and %d", maxSearchOffset)
+		q.Offset = offset
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// handleSearchAccounts searches every account for the admin token and the
+// caller's own accounts for customers.
+func (s *APIServer) handleSearchAccounts(w http.ResponseWriter, r *http.Request) error {
+	q, err := ParseAccountSearch(r.URL.Query())
+	if err != nil {
+		return validationFailed(err)
+	}
+	if p := principalFrom(r.Context()); !p.admin {
+		q.OwnerID = p.customer.ID
+	}
+	matches, err := s.store.SearchAccounts(q)
+	if err != nil {
+		return err
+	}
+	meta := Meta{"limit": q.Limit, "offset": q.Offset}
+	// Stores return one extra match when there are more.
+	if len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+		if next := q.Offset + q.Limit; next <= maxSearchOffset {
+			meta["nextOffset"] = next
+		}
+	}
+	return writeData(w, http.StatusOK, matches, meta)
+}
+
+// searchName is the full name matched by searches, as indexed.
+const searchName = `lower(first_name || ' ' || last_name)`
+
+// SearchAccounts returns up to q.Limit+1 matches from q.Offset on. Name
+// searches use the trigram indexes of migration 18, so pg_trgm scores them
+// as trigramSimilarity does for InMemoryStorage.
+func (s *PostgresStore) SearchAccounts(q *AccountSearch) ([]*AccountMatch, error) {
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	var found string
+	if number, ok := q.accountNumber(); ok {
+		found = `select *, '` + MatchAccountNumber + `' as match_kind, 1::float8 as score from account where number = ` + arg(number)
+	} else {
+		text, prefix := arg(strings.ToLower(q.Text)), arg(likePrefix(q.Text))
+		isPrefix := "(lower(first_name) like " + prefix + " or lower(last_name) like " + prefix + " or " + searchName + " like " + prefix + ")"
+		found = `select *,
+			case when ` + isPrefix + ` then '` + MatchPrefix + `' else '` + MatchFuzzy + `' end as match_kind,
+			greatest(similarity(lower(first_name), ` + text + `), similarity(lower(last_name), ` + text + `),
+				similarity(` + searchName + `, ` + text + `))::float8 as score
+		from account
+		where ` + isPrefix + ` or lower(first_name) % ` + text + ` or lower(last_name) % ` + text + ` or ` + searchName + ` % ` + text
+	}
+	query := `select ` + accountColumns + `, match_kind, score from (` + found + `) as found`
+	if q.OwnerID != 0 {
+		query += " where id in (select account_id from account_owner where customer_id = " + arg(q.OwnerID) + ")"
+	}
+	query += " order by match_kind = '" + MatchFuzzy + "', score desc, id limit " + arg(q.Limit+1) + " offset " + arg(q.Offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	matches := []*AccountMatch{}
+	for rows.Next() {
+		m := new(AccountMatch)
+		if m.Account, err = scanIntoAccount(rows, &m.Match, &m.Score); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// match scores acc for q, reporting false if it does not match.
+func (q *AccountSearch) match(acc *Account) (*AccountMatch, bool) {
+	if number, ok := q.accountNumber(); ok {
+		return &AccountMatch{Account: acc, Match: MatchAccountNumber, Score: 1}, acc.AccountNo == number
+	}
+	text := strings.ToLower(q.Text)
+	first, last := strings.ToLower(acc.FirstName), strings.ToLower(acc.LastName)
+	full := first + " " + last
+	m := &AccountMatch{Account: acc, Match: MatchFuzzy}
+	m.Score = max(trigramSimilarity(first, text), trigramSimilarity(last, text), trigramSimilarity(full, text))
+	if strings.HasPrefix(first, text) || strings.HasPrefix(last, text) || strings.HasPrefix(full, text) {
+		m.Match = MatchPrefix
+		return m, true
+	}
+	return m, m.Score >= trigramThreshold
+}
+
+// compareMatches orders prefix matches before fuzzy ones, then by
+// descending score and id.
+func compareMatches(a, b *AccountMatch) int {
+	if c := cmp.Compare(boolRank(a.Match == MatchFuzzy), boolRank(b.Match == MatchFuzzy)); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(b.Score, a.Score); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// trigramSimilarity is pg_trgm's similarity: the share of the distinct
+// trigrams of the two strings they have in common. Like pg_trgm, it splits
+// s and t into words of letters and digits, each padded with two spaces in
+// front and one behind.
+func trigramSimilarity(s, t string) float64 {
+	a, b := trigrams(s), trigrams(t)
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for g := range a {
+		if _, ok := b[g]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for _, w := range words {
+		padded := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
+
+func (s *InMemoryStorage) SearchAccounts(q *AccountSearch) ([]*AccountMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matches := []*AccountMatch{}
+	for id, acc := range s.accounts {
+		if q.OwnerID != 0 {
+			if _, ok := s.owners[id][q.OwnerID]; !ok {
+				continue
+			}
+		}
+		if m, ok := q.match(copyAccount(acc)); ok {
+			matches = append(matches, m)
+		}
+	}
+	slices.SortFunc(matches, compareMatches)
+	matches = matches[min(q.Offset, len(matches)):]
+	return matches[:min(q.Limit+1, len(matches))], nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Account rows carry a version that PostgreSQL increases on every update,
+// including balance changes (see migration 21). Changes made by reading an
+// account and writing part of it back outside a transaction, such as
+// profile edits and limit changes, go through ModifyAccount: the write only
+// succeeds if the version is still the one read, and otherwise the change
+// is applied again to a fresh read, so concurrent writes are never lost.
+
+// ErrVersionConflict is returned when an account kept changing while it
+// was being updated.
+var ErrVersionConflict = errors.New("account was changed concurrently")
+
+// accountUpdateAttempts bounds how often ModifyAccount applies a change
+// before giving up with ErrVersionConflict.
+const accountUpdateAttempts = 5
+
+// UpdateAccountRequest edits the account holder's name. Omitted fields
+// are left unchanged.
+type UpdateAccountRequest struct {
+	FirstName *string `json:"firstname"`
+	LastName  *string `json:"lastname"`
+}
+
+// Validate trims the names and checks those that are set.
+func (r *UpdateAccountRequest) Validate() error {
+	var v Validator
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{{"firstname", r.FirstName}, {"lastname", r.LastName}} {
+		if f.value == nil {
+			continue
+		}
+		*f.value = strings.TrimSpace(*f.value)
+		v.Check(*f.value != "", f.name, "must not be empty")
+		v.Check(len(*f.value) <= 100, f.name, "must be at most 100 characters")
+	}
+	v.Check(r.FirstName != nil || r.LastName != nil, "firstname", "is required when lastname is not set")
+	return v.Err()
+}
+
+// handleUpdateAccount applies a PATCH to the {id} account's profile.
+func (s *APIServer) handleUpdateAccount(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	req := new(UpdateAccountRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	account, err := s.store.ModifyAccount(id, func(acc *Account) error {
+		if req.FirstName != nil {
+			acc.FirstName = *req.FirstName
+		}
+		if req.LastName != nil {
+			acc.LastName = *req.LastName
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, account, nil)
+}
+
+// ModifyAccount reads account id, lets apply change it and saves the names,
+// overdraft limit, interest rate and transfer limits if the account has
+// not changed since it was read. Otherwise it starts over, up to
+// accountUpdateAttempts times, so apply may be called more than once. An
+// error from apply is returned unchanged.
+func (s *PostgresStore) ModifyAccount(id int, apply func(*Account) error) (*Account, error) {
+	for attempt := 1; ; attempt++ {
+		acc, err := s.GetAccountByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := apply(acc); err != nil {
+			return nil, err
+		}
+		saved, err := scanIntoAccount(s.db.QueryRow(`update account set first_name = $3, last_name = $4,
+			overdraft_limit = $5, interest_rate_bps = $6, daily_transfer_limit = $7, weekly_transfer_limit = $8
+		where id = $1 and version = $2 returning `+accountColumns,
+			id, acc.Version, acc.FirstName, acc.LastName, acc.OverdraftLimit, acc.InterestRateBps,
+			acc.DailyTransferLimit, acc.WeeklyTransferLimit))
+		if !errors.Is(err, sql.ErrNoRows) {
+			return saved, err
+		}
+		if attempt == accountUpdateAttempts {
+			accountVersionConflicts.WithLabelValues("exhausted").Inc()
+			return nil, fmt.Errorf("%w: account %d after %d attempts", ErrVersionConflict, id, attempt)
+		}
+		accountVersionConflicts.WithLabelValues("retried").Inc()
+	}
+}
+
+// versionConflict explains why a compare-and-swap of account id matched
+// no row: the account is gone, or another write changed its version.
+func (s *PostgresStore) versionConflict(id int) error {
+	var exists bool
+	if err := s.db.QueryRow(`select exists (select 1 from account where id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+	}
+	return fmt.Errorf("%w: account %d", ErrVersionConflict, id)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// adminRoutes registers the operator API under /admin. Every route needs
+// the admin token, which is separate from any customer credentials.
+func (s *APIServer) adminRoutes(router *mux.Router) {
+	admin := func(f apiFunc) http.HandlerFunc { return makeHTTPHandleFunc(s.requireAdmin(f)) }
+	router.HandleFunc("/admin/stats", admin(s.handleStats)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/account/{id}/activate", admin(s.handleSetStatus(AccountActive))).Methods(http.MethodPost)
+	router.HandleFunc("/admin/account/{id}/freeze", admin(s.handleSetStatus(AccountFrozen))).Methods(http.MethodPost)
+	router.HandleFunc("/admin/account/{id}/unfreeze", admin(s.handleSetStatus(AccountActive))).Methods(http.MethodPost)
+	router.HandleFunc("/admin/account/{id}/close", admin(s.handleSetStatus(AccountClosed))).Methods(http.MethodPost)
+	router.HandleFunc("/admin/account/{id}/limits", admin(s.handleSetLimits)).Methods(http.MethodPut)
+	router.HandleFunc("/admin/interest/accrue", admin(s.handleAccrueInterest)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/exports/regulatory", admin(s.handleStartRegulatoryExport)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/exports/regulatory/{exportId}", admin(s.handleGetRegulatoryExport)).Methods(http.MethodGet)
+}
+
+// requireAdmin only lets requests carrying the admin bearer token through.
+// Without a configured token the admin routes behave as if they did not exist.
+func (s *APIServer) requireAdmin(f apiFunc) apiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if s.adminToken == "" {
+			return &apiError{status: http.StatusNotFound, code: CodeNotFound, err: fmt.Errorf("%s not found", r.URL.Path)}
+		}
+		if token, ok := bearerToken(r); !ok || !s.isAdminToken(token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			return &apiError{status: http.StatusUnauthorized, code: CodeUnauthorized, err: errors.New("admin token required")}
+		}
+		return f(w, r)
+	}
+}
+
+func (s *APIServer) handleStats(w http.ResponseWriter, r *http.Request) error {
+	stats, err := s.store.Stats()
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, stats, nil)
+}
+
+// handleSetStatus moves the {id} account to status; the storage layer
+// rejects transitions the state machine does not allow.
+func (s *APIServer) handleSetStatus(status string) apiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		id, err := getID(r)
+		if err != nil {
+			return err
+		}
+		account, err := s.store.SetStatus(id, status)
+		if err != nil {
+			return err
+		}
+		return writeData(w, http.StatusOK, account, nil)
+	}
+}
+
+func (s *APIServer) handleSetLimits(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	req := new(LimitsRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	account, err := s.store.SetTransferLimits(id, req.DailyTransferLimit, req.WeeklyTransferLimit)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, account, nil)
+}
+
+// handleAccrueInterest runs interest accrual now, optionally only up to the
+// date given as {"through": "2006-01-02"}.
+func (s *APIServer) handleAccrueInterest(w http.ResponseWriter, r *http.Request) error {
+	if s.interest == nil {
+		return &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: errors.New("interest accrual is not configured")}
+	}
+	var req struct {
+		Through string `json:"through"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return badRequest(fmt.Errorf("invalid request body: %w", err))
+		}
+	}
+	var through time.Time
+	if req.Through != "" {
+		var err error
+		if through, err = time.Parse(time.DateOnly, req.Through); err != nil {
+			return validationFailed(fmt.Errorf("through must be a date like 2006-01-02"))
+		}
+	}
+	run, err := s.interest.AccrueThrough(r.Context(), through)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, run, nil)
+}
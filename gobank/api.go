@@ -1,95 +1,387 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// hanling JSON
-func WriteJSON(w http.ResponseWriter, status int, v any) error {
-	w.WriteHeader(status)
-	w.Header().Set("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(v)
-}
-
-// Error
-type apiError struct {
-	Error string
-}
-
 type apiFunc func(http.ResponseWriter, *http.Request) error
 
 // makeHTTPHandleFunc is decorator to http.HandlerFunc
 func makeHTTPHandleFunc(f apiFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := f(w, r); err != nil {
-			WriteJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+			writeError(w, r, err)
 		}
 	}
 }
 
+// IdempotencyKeyHeader lets clients retry mutating requests safely.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 type APIServer struct {
-	listenAddr string
+	config ServerConfig
+	store  Storage
+	server *http.Server
+	// overdraftLimit is the overdraft limit given to new accounts.
+	overdraftLimit int64
+	// savingsRateBps is the annual interest rate given to new savings accounts.
+	savingsRateBps int
+	// requireActivation opens new accounts as pending until an operator
+	// activates them.
+	requireActivation bool
+	// adminToken guards /admin routes; they are disabled when it is empty.
+	adminToken string
+	interest   *InterestAccrual
+	// idempotency stores responses for the Idempotency-Key middleware;
+	// nil disables it.
+	idempotency    IdempotencyStore
+	idempotencyTTL time.Duration
+	// standingOrders backs the standing order routes; nil disables them.
+	standingOrders StandingOrderStore
+	// holds stores transfers held by the velocity rule; nil disables holds.
+	holds    TransferHoldStore
+	velocity VelocityRule
+	// fraud screens transfers and withdrawals; a nil Checker disables it.
+	fraud FraudConfig
+	// approvals stores transfers waiting for approval; nil disables them.
+	approvals TransferApprovalStore
+	approval  ApprovalPolicy
+	// kycs stores KYC applications; nil disables onboarding.
+	kycs KYCStore
+	kyc  KYCConfig
+	// apiKeys stores API keys for integrations; nil disables them.
+	apiKeys APIKeyStore
+	// regulatory runs regulatory exports; nil disables them.
+	regulatory *RegulatoryExporter
+	// notifications stores notification preferences; nil disables them.
+	notifications NotificationStore
 }
 
-func NewAPIServer(listenAddr string) *APIServer {
-	return &APIServer{
-		listenAddr: listenAddr,
+func NewAPIServer(config ServerConfig, store Storage) *APIServer {
+	s := &APIServer{
+		config: config,
+		store:  store,
 	}
+	s.server = &http.Server{
+		Addr:              config.ListenAddr,
+		Handler:           observe(s.routes()),
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+	return s
 }
 
-func (s *APIServer) Run() {
-	log.Println("API server runing on port: ", s.listenAddr)
+// Run serves until Shutdown is called. It returns nil after a graceful
+// shutdown and the listener error otherwise.
+func (s *APIServer) Run() error {
+	var err error
+	if s.config.TLSEnabled() {
+		slog.Info("API server listening", "addr", s.config.ListenAddr, "tls", true)
+		err = s.server.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+	} else {
+		slog.Info("API server listening", "addr", s.config.ListenAddr, "tls", false)
+		err = s.server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// to finish or ctx to expire.
+func (s *APIServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// routes registers one handler per path and method. Requests with a known
+// path but an unsupported method get a 405 listing the allowed methods.
+func (s *APIServer) routes() *mux.Router {
 	router := mux.NewRouter()
-	router.HandleFunc("/health", makeHTTPHandleFunc(s.handleHealth))
-	router.HandleFunc("/account", makeHTTPHandleFunc(s.handleAccount))
-	router.HandleFunc("/account/{id}", makeHTTPHandleFunc(s.handleGetAccount))
-	http.ListenAndServe(s.listenAddr, router)
+	router.Use(routeLabel, s.idempotent)
+	router.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
+	router.HandleFunc("/openapi.json", handleOpenAPI).Methods(http.MethodGet)
+	router.HandleFunc("/health", makeHTTPHandleFunc(s.handleHealth)).Methods(http.MethodGet)
+	router.HandleFunc("/account", makeHTTPHandleFunc(s.authenticated(s.handleListAccounts))).Methods(http.MethodGet)
+	router.HandleFunc("/account", makeHTTPHandleFunc(s.authenticated(s.handleCreateAccount))).Methods(http.MethodPost)
+	router.HandleFunc("/account/search", makeHTTPHandleFunc(s.authenticated(s.handleSearchAccounts))).Methods(http.MethodGet)
+	router.HandleFunc("/account/{id}", makeHTTPHandleFunc(s.accountOwner(s.handleGetAccount))).Methods(http.MethodGet)
+	router.HandleFunc("/account/{id}", makeHTTPHandleFunc(s.accountOwner(s.handleUpdateAccount))).Methods(http.MethodPatch)
+	router.HandleFunc("/account/{id}", makeHTTPHandleFunc(s.accountOwner(s.handleDeleteAccount))).Methods(http.MethodDelete)
+	router.HandleFunc("/account/{id}/statement", makeHTTPHandleFunc(s.accountOwner(s.handleStatement))).Methods(http.MethodGet)
+	router.HandleFunc("/account/{id}/deposit", makeHTTPHandleFunc(s.accountOwner(s.handleDeposit))).Methods(http.MethodPost)
+	router.HandleFunc("/account/{id}/withdraw", makeHTTPHandleFunc(s.accountOwner(s.handleWithdraw))).Methods(http.MethodPost)
+	router.HandleFunc("/account/{id}/close", makeHTTPHandleFunc(s.accountOwner(s.handleSetStatus(AccountClosed)))).Methods(http.MethodPost)
+	router.HandleFunc("/transfer", makeHTTPHandleFunc(s.authenticated(s.handleTransfer))).Methods(http.MethodPost)
+	s.customerRoutes(router)
+	s.standingOrderRoutes(router)
+	s.adminRoutes(router)
+	s.transferHoldRoutes(router)
+	s.transferApprovalRoutes(router)
+	s.kycRoutes(router)
+	s.apiKeyRoutes(router)
+	s.notificationRoutes(router)
+	router.MethodNotAllowedHandler = methodNotAllowedHandler(router)
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeErrorf(w, r, http.StatusNotFound, CodeNotFound, "%s not found", r.URL.Path)
+	})
+	return router
+}
 
+// methodNotAllowedHandler responds with 405 and an Allow header built from
+// the methods of the routes matching the request path.
+func methodNotAllowedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			methods, err := route.GetMethods()
+			if err != nil {
+				return nil
+			}
+			for _, method := range methods {
+				req := r.Clone(r.Context())
+				req.Method = method
+				var match mux.RouteMatch
+				if route.Match(req, &match) {
+					allowed = append(allowed, method)
+				}
+			}
+			return nil
+		})
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeErrorf(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "%s Method not allowed", r.Method)
+	})
 }
 
-func (s *APIServer) handleAccount(w http.ResponseWriter, r *http.Request) error {
-	switch r.Method {
-	case "GET":
-		s.handleGetAccount(w, r)
-	case "POST":
-		s.handleCreateAccount(w, r)
-	case "DELETE":
-		s.handleDeleteAccount(w, r)
-	default:
-		return fmt.Errorf("%s Method not allowed", r.Method)
+// handleStatement streams the account statement for ?from=&to= as a CSV or
+// PDF download in the language of Accept-Language. Errors found before the
+// first byte is written get a JSON error response; later ones can only abort
+// the download.
+func (s *APIServer) handleStatement(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = StatementCSV
+	}
+	loc := localeFor(r)
+	next, err := NewStatementWriter(format, w, loc)
+	if err != nil {
+		return validationFailed(err)
+	}
+	from, to, err := ParseStatementPeriod(q.Get("from"), q.Get("to"), time.Now())
+	if err != nil {
+		return validationFailed(err)
+	}
+
+	sw := &statementDownload{w: w, next: next, format: format, lang: loc.Tag, from: from, to: to}
+	if err := s.store.WriteStatement(r.Context(), id, from, to, sw); err != nil {
+		if !sw.started {
+			return err
+		}
+		// The client cannot tell a truncated body from a complete one,
+		// so break the connection instead of ending the response.
+		loggerFrom(r.Context()).Error("statement aborted", "account_id", id, "error", err)
+		panic(http.ErrAbortHandler)
 	}
 	return nil
 }
 
+// statementDownload sets the download headers once the account is known,
+// just before the first line of the statement is written.
+type statementDownload struct {
+	w        http.ResponseWriter
+	next     StatementWriter
+	format   string
+	lang     string
+	from, to time.Time
+	started  bool
+}
+
+func (d *statementDownload) Begin(st *Statement) error {
+	d.started = true
+	h := d.w.Header()
+	h.Set("Content-Type", StatementContentType(d.format))
+	h.Set("Content-Language", d.lang)
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%d-%s-%s.%s"`,
+		st.Account.AccountNo, d.from.Format(time.DateOnly), d.to.Format(time.DateOnly), d.format))
+	d.w.WriteHeader(http.StatusOK)
+	return d.next.Begin(st)
+}
+
+func (d *statementDownload) Line(line StatementLine) error { return d.next.Line(line) }
+func (d *statementDownload) End(st *Statement) error       { return d.next.End(st) }
+
 func (s *APIServer) handleHealth(w http.ResponseWriter, r *http.Request) error {
-	if r.Method == "GET" {
-		WriteJSON(w, http.StatusOK, "service is running")
-	} else {
-		return fmt.Errorf("%s Method not allowed", r.Method)
-	}
-	return nil
+	return writeData(w, http.StatusOK, "service is running", nil)
 }
 
 func (s *APIServer) handleGetAccount(w http.ResponseWriter, r *http.Request) error {
-	vars := mux.Vars(r)
-	// account := NewAccount("Alok", "Tripathi")
-	return WriteJSON(w, http.StatusOK, vars)
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	account, err := s.store.GetAccountByID(id)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, account, nil)
 
 }
 
 func (s *APIServer) handleCreateAccount(w http.ResponseWriter, r *http.Request) error {
-	return nil
+	req := new(CreateAccountRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	account, err := s.openAccount(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusCreated, account, nil)
+}
+
+// openAccount opens an account for the caller in ctx, for both APIs.
+// Customers own the accounts they open and need approved KYC; the
+// operator opens unowned accounts and links owners afterwards.
+func (s *APIServer) openAccount(ctx context.Context, req *CreateAccountRequest) (*Account, error) {
+	p := principalFrom(ctx)
+	if p == nil {
+		return nil, ErrUnauthenticated
+	}
+	var owners []int
+	if p.customer != nil {
+		if err := s.requireKYC(p.customer.ID); err != nil {
+			return nil, err
+		}
+		owners = append(owners, p.customer.ID)
+	}
+	return s.createAccount(req, owners...)
+}
+
+// createAccount opens an account from a validated request with the
+// server's default overdraft limit and savings rate.
+func (s *APIServer) createAccount(req *CreateAccountRequest, ownerIDs ...int) (*Account, error) {
+	account := NewAccount(req.FirstName, req.LastName)
+	account.OverdraftLimit = s.overdraftLimit
+	account.Currency = Currency(req.Currency)
+	account.Type = req.Type
+	if account.Type == AccountSavings {
+		account.InterestRateBps = s.savingsRateBps
+	}
+	if s.requireActivation {
+		account.Status = AccountPending
+	}
+	if err := s.store.CreateAccount(account, ownerIDs...); err != nil {
+		return nil, err
+	}
+	return account, nil
 }
 
 func (s *APIServer) handleDeleteAccount(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	if err := s.store.DeleteAccount(id); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
-func (s *APIServer) handleTransferAccount(w http.ResponseWriter, r *http.Request) error {
-	return nil
+func (s *APIServer) handleDeposit(w http.ResponseWriter, r *http.Request) error {
+	return s.handleAccountEntry(w, r, s.store.Deposit)
+}
+
+func (s *APIServer) handleWithdraw(w http.ResponseWriter, r *http.Request) error {
+	return s.handleAccountEntry(w, r, func(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+		tx := Transaction{Kind: FraudWithdrawal, AccountID: id, Amount: amount}
+		s.fraud.httpCaller(r, &tx)
+		if _, err := s.screen(r.Context(), tx); err != nil {
+			return nil, err
+		}
+		return s.store.Withdraw(id, amount, idempotencyKey)
+	})
+}
+
+// handleAccountEntry decodes an amount and applies it with op, passing the
+// Idempotency-Key header so retried requests are applied only once.
+func (s *APIServer) handleAccountEntry(w http.ResponseWriter, r *http.Request,
+	op func(id int, amount int64, idempotencyKey string) (*AccountEntry, error)) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if len(key) > 255 {
+		return badRequest(fmt.Errorf("%s must be at most 255 characters", IdempotencyKeyHeader))
+	}
+	req := new(AmountRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+
+	entry, err := op(id, req.Amount, key)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, entry, Meta{"replayed": entry.Replayed})
+}
+
+func (s *APIServer) handleTransfer(w http.ResponseWriter, r *http.Request) error {
+	req := new(TransferRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	// Only the source account must belong to the caller.
+	if err := s.authorizeAccount(r.Context(), req.FromAccount); err != nil {
+		return err
+	}
+	tx := Transaction{Kind: FraudTransfer, AccountID: req.FromAccount, ToAccount: req.ToAccount, Amount: req.Amount}
+	s.fraud.httpCaller(r, &tx)
+	held, err := s.holdForReview(r.Context(), req, tx)
+	if err != nil {
+		return err
+	}
+	if held != nil {
+		return writeData(w, http.StatusAccepted, held, Meta{"held": true})
+	}
+	pending, err := s.requestApproval(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	if pending != nil {
+		return writeData(w, http.StatusAccepted, pending, Meta{"pendingApproval": true})
+	}
+	record, err := s.store.Transfer(req.FromAccount, req.ToAccount, req.Amount)
+	observeTransfer(record, err)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, record, nil)
+}
+
+func getID(r *http.Request) (int, error) {
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, badRequest(fmt.Errorf("invalid account id %q", idStr))
+	}
+	return id, nil
 }
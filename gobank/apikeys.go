@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gnsalok/go-projects-root/gobank/pb"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// API key scopes. Keys act for the customer who issued them, but only on
+// the routes in apiKeyRoutes their scopes allow.
+const (
+	// ScopeRead reads accounts, statements, owners and standing orders.
+	ScopeRead = "read"
+	// ScopeTransfer initiates transfers from the customer's accounts.
+	ScopeTransfer = "transfer"
+)
+
+// apiKeyPrefix starts every API key, telling them apart from customer
+// tokens.
+const apiKeyPrefix = "gbkey_"
+
+// apiKeyTouchInterval limits how often a key's last use is written back.
+const apiKeyTouchInterval = time.Minute
+
+var (
+	// ErrAPIKeyNotFound is returned for unknown API key IDs.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrInsufficientScope is returned when an API key calls a route its
+	// scopes do not allow.
+	ErrInsufficientScope = errors.New("api key scope does not allow this request")
+)
+
+// apiKeyRoutes maps the routes API keys may call, and the gRPC methods,
+// to the scope each needs. Keys are refused everywhere else, including key
+// management, KYC and the operator API.
+var apiKeyRoutes = map[string]string{
+	"GET /account":                                ScopeRead,
+	"GET /account/{id}":                           ScopeRead,
+	"GET /account/{id}/statement":                 ScopeRead,
+	"GET /account/{id}/owners":                    ScopeRead,
+	"GET /account/{id}/standing-orders":           ScopeRead,
+	"GET /account/{id}/standing-orders/{orderId}": ScopeRead,
+	"GET /customer/me":                            ScopeRead,
+	"POST /transfer":                              ScopeTransfer,
+
+	pb.AccountService_GetAccount_FullMethodName: ScopeRead,
+	pb.TransferService_Transfer_FullMethodName:  ScopeTransfer,
+}
+
+// APIKey lets a third-party integration call the API for a customer. Only
+// a hash of the key is stored; Prefix is kept to tell keys apart.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	CustomerID int        `json:"customerId"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIP string     `json:"lastUsedIp,omitempty"`
+}
+
+// active reports whether the key may still authenticate at now.
+func (k *APIKey) active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// CreateAPIKeyRequest issues an API key.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (r *CreateAPIKeyRequest) Validate() error {
+	var v Validator
+	r.Name = strings.TrimSpace(r.Name)
+	v.Check(r.Name != "", "name", "is required")
+	v.Check(len(r.Name) <= 100, "name", "must be at most 100 characters")
+	v.Check(len(r.Scopes) > 0, "scopes", "is required")
+	seen := make(map[string]bool)
+	for _, scope := range r.Scopes {
+		v.Checkf(scope == ScopeRead || scope == ScopeTransfer, "scopes", "must only contain %s and %s", ScopeRead, ScopeTransfer)
+		v.Check(!seen[scope], "scopes", "must not repeat a scope")
+		seen[scope] = true
+	}
+	slices.Sort(r.Scopes)
+	if r.ExpiresAt != nil {
+		v.Check(r.ExpiresAt.After(time.Now()), "expiresAt", "must be in the future")
+		utc := r.ExpiresAt.UTC()
+		r.ExpiresAt = &utc
+	}
+	return v.Err()
+}
+
+// APIKeyStore persists API keys.
+type APIKeyStore interface {
+	CreateAPIKey(k *APIKey, keyHash string) error
+	// APIKeyByHash returns the key with the hash, revoked or not, and the
+	// customer it acts for.
+	APIKeyByHash(keyHash string) (*APIKey, *Customer, error)
+	// APIKeys lists a customer's keys, or every key for customerID 0, by ID.
+	APIKeys(customerID int) ([]*APIKey, error)
+	// RevokeAPIKey revokes a key of the customer, or any key for
+	// customerID 0. Revoking a revoked key keeps its revocation time.
+	RevokeAPIKey(id int64, customerID int) (*APIKey, error)
+	// TouchAPIKey records that the key was used at a time from an address.
+	TouchAPIKey(id int64, at time.Time, ip string) error
+}
+
+// newAPIKey returns a random API key and the hash stored for it.
+func newAPIKey() (key, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	key = apiKeyPrefix + hex.EncodeToString(b)
+	return key, hashToken(key)
+}
+
+// authenticateAPIKey resolves an API key to the key and its customer,
+// recording its use from ip. Unknown, revoked and expired keys are
+// ErrUnauthenticated.
+func (s *APIServer) authenticateAPIKey(ctx context.Context, token, ip string) (*APIKey, *Customer, error) {
+	key, customer, err := s.apiKeys.APIKeyByHash(hashToken(token))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		apiKeyRequests.WithLabelValues("rejected").Inc()
+		return nil, nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC()
+	if !key.active(now) {
+		apiKeyRequests.WithLabelValues("rejected").Inc()
+		return nil, nil, ErrUnauthenticated
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.apiKeys.TouchAPIKey(key.ID, now, ip); err != nil {
+			loggerFrom(ctx).Warn("record api key use", "api_key_id", key.ID, "error", err)
+		}
+	}
+	return key, customer, nil
+}
+
+// checkScope fails unless the API key may call the matched route.
+func checkScope(r *http.Request, key *APIKey) error {
+	var tpl string
+	if route := mux.CurrentRoute(r); route != nil {
+		tpl, _ = route.GetPathTemplate()
+	}
+	return checkRouteScope(key, r.Method+" "+tpl)
+}
+
+// checkRouteScope fails unless the API key may call route, an HTTP method
+// and path template or a gRPC full method name.
+func checkRouteScope(key *APIKey, route string) error {
+	scope, ok := apiKeyRoutes[route]
+	if !ok {
+		apiKeyRequests.WithLabelValues("denied").Inc()
+		return fmt.Errorf("%w: api keys cannot call %s", ErrInsufficientScope, route)
+	}
+	if !slices.Contains(key.Scopes, scope) {
+		apiKeyRequests.WithLabelValues("denied").Inc()
+		return fmt.Errorf("%w: %s needs the %s scope", ErrInsufficientScope, route, scope)
+	}
+	apiKeyRequests.WithLabelValues("allowed").Inc()
+	return nil
+}
+
+func (s *APIServer) apiKeyRoutes(router *mux.Router) {
+	customer := func(f apiFunc) http.HandlerFunc { return makeHTTPHandleFunc(s.authenticated(s.requireAPIKeys(f))) }
+	admin := func(f apiFunc) http.HandlerFunc { return makeHTTPHandleFunc(s.requireAdmin(s.requireAPIKeys(f))) }
+	router.HandleFunc("/customers/me/api-keys", customer(s.handleCreateAPIKey)).Methods(http.MethodPost)
+	router.HandleFunc("/customers/me/api-keys", customer(s.handleListMyAPIKeys)).Methods(http.MethodGet)
+	router.HandleFunc("/customers/me/api-keys/{keyId}", customer(s.handleRevokeMyAPIKey)).Methods(http.MethodDelete)
+	router.HandleFunc("/admin/api-keys", admin(s.handleListAPIKeys)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/api-keys/{keyId}", admin(s.handleRevokeAPIKey)).Methods(http.MethodDelete)
+}
+
+func (s *APIServer) requireAPIKeys(f apiFunc) apiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if s.apiKeys == nil {
+			return &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: errors.New("api keys are not configured")}
+		}
+		return f(w, r)
+	}
+}
+
+// handleCreateAPIKey issues an API key for the calling customer. The key
+// is shown only once; only its hash is stored.
+func (s *APIServer) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) error {
+	customer, err := customerOnly(r.Context())
+	if err != nil {
+		return err
+	}
+	req := new(CreateAPIKeyRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	key, hash := newAPIKey()
+	apiKey := &APIKey{
+		CustomerID: customer.ID,
+		Name:       req.Name,
+		Prefix:     key[:len(apiKeyPrefix)+8],
+		Scopes:     req.Scopes,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if err := s.apiKeys.CreateAPIKey(apiKey, hash); err != nil {
+		return err
+	}
+	return writeData(w, http.StatusCreated, map[string]any{"apiKey": apiKey, "key": key}, nil)
+}
+
+func (s *APIServer) handleListMyAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	customer, err := customerOnly(r.Context())
+	if err != nil {
+		return err
+	}
+	keys, err := s.apiKeys.APIKeys(customer.ID)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, keys, nil)
+}
+
+func apiKeyID(r *http.Request) (int64, error) {
+	idStr := mux.Vars(r)["keyId"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, badRequest(fmt.Errorf("invalid api key id %q", idStr))
+	}
+	return id, nil
+}
+
+func (s *APIServer) handleRevokeMyAPIKey(w http.ResponseWriter, r *http.Request) error {
+	customer, err := customerOnly(r.Context())
+	if err != nil {
+		return err
+	}
+	id, err := apiKeyID(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.apiKeys.RevokeAPIKey(id, customer.ID); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// handleListAPIKeys lists every customer's keys, or one customer's with
+// ?customerId=, with when and where each was last used.
+func (s *APIServer) handleListAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	var customerID int
+	if v := r.URL.Query().Get("customerId"); v != "" {
+		var err error
+		if customerID, err = strconv.Atoi(v); err != nil || customerID <= 0 {
+			return badRequest(fmt.Errorf("invalid customer id %q", v))
+		}
+	}
+	keys, err := s.apiKeys.APIKeys(customerID)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, keys, nil)
+}
+
+func (s *APIServer) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) error {
+	id, err := apiKeyID(r)
+	if err != nil {
+		return err
+	}
+	key, err := s.apiKeys.RevokeAPIKey(id, 0)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, key, nil)
+}
+
+const apiKeyColumns = `id, customer_id, name, prefix, scopes, created_at, expires_at, revoked_at, last_used_at, last_used_ip`
+
+func scanIntoAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+	k := new(APIKey)
+	var scopes pq.StringArray
+	var expiresAt, revokedAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.CustomerID, &k.Name, &k.Prefix, &scopes, &k.CreatedAt,
+		&expiresAt, &revokedAt, &lastUsedAt, &k.LastUsedIP); err != nil {
+		return nil, err
+	}
+	k.Scopes = []string(scopes)
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	return k, nil
+}
+
+func (s *PostgresStore) CreateAPIKey(k *APIKey, keyHash string) error {
+	err := s.db.QueryRow(`insert into api_key (customer_id, name, prefix, key_hash, scopes, expires_at)
+	values ($1, $2, $3, $4, $5, $6) returning id, created_at`,
+		k.CustomerID, k.Name, k.Prefix, keyHash, pq.Array(k.Scopes), k.ExpiresAt).Scan(&k.ID, &k.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return fmt.Errorf("%w: %d", ErrCustomerNotFound, k.CustomerID)
+	}
+	return err
+}
+
+func (s *PostgresStore) APIKeyByHash(keyHash string) (*APIKey, *Customer, error) {
+	row := s.db.QueryRow(`select k.id, k.customer_id, k.name, k.prefix, k.scopes, k.created_at, k.expires_at,
+		k.revoked_at, k.last_used_at, k.last_used_ip, c.id, c.first_name, c.last_name, c.email, c.created_at
+	from api_key k join customer c on c.id = k.customer_id where k.key_hash = $1`, keyHash)
+	var c Customer
+	k, err := scanIntoAPIKey(scanFunc(func(dest ...any) error {
+		return row.Scan(append(dest, &c.ID, &c.FirstName, &c.LastName, &c.Email, &c.CreatedAt)...)
+	}))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return k, &c, nil
+}
+
+// scanFunc adapts a function to the Scan method the scanInto helpers take.
+type scanFunc func(dest ...any) error
+
+func (f scanFunc) Scan(dest ...any) error { return f(dest...) }
+
+func (s *PostgresStore) APIKeys(customerID int) ([]*APIKey, error) {
+	rows, err := s.db.Query(`select `+apiKeyColumns+` from api_key
+	where $1 = 0 or customer_id = $1 order by id`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []*APIKey{}
+	for rows.Next() {
+		k, err := scanIntoAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *PostgresStore) RevokeAPIKey(id int64, customerID int) (*APIKey, error) {
+	k, err := scanIntoAPIKey(s.db.QueryRow(`update api_key set revoked_at = coalesce(revoked_at, now())
+	where id = $1 and ($2 = 0 or customer_id = $2) returning `+apiKeyColumns, id, customerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrAPIKeyNotFound, id)
+	}
+	return k, err
+}
+
+func (s *PostgresStore) TouchAPIKey(id int64, at time.Time, ip string) error {
+	_, err := s.db.Exec(`update api_key set last_used_at = $2, last_used_ip = $3
+	where id = $1 and (last_used_at is null or last_used_at < $2)`, id, at, ip)
+	return err
+}
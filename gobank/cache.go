@@ -0,0 +1,380 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AccountCache holds encoded accounts by ID for CachingStorage. Entries
+// expire after the cache's TTL, which bounds how stale an account can be
+// when it changes without passing through this process, as writes by
+// other replicas do when each keeps its own in-memory cache.
+type AccountCache interface {
+	Get(ctx context.Context, id int) ([]byte, bool, error)
+	Set(ctx context.Context, id int, data []byte) error
+	Delete(ctx context.Context, ids ...int) error
+	// Clear drops every entry.
+	Clear(ctx context.Context) error
+}
+
+const (
+	defaultAccountCacheSize = 10000
+	defaultAccountCacheTTL  = 30 * time.Second
+	// accountCacheTimeout bounds each call to a remote cache, so a slow
+	// cache degrades to reading the database instead of stalling requests.
+	accountCacheTimeout = 250 * time.Millisecond
+)
+
+// accountCacheFromEnv reads GOBANK_ACCOUNT_CACHE ("memory", "redis", or
+// unset to disable caching), GOBANK_ACCOUNT_CACHE_TTL (default 30s),
+// GOBANK_ACCOUNT_CACHE_SIZE (default 10000, memory only) and
+// GOBANK_ACCOUNT_CACHE_REDIS_URL. The returned closeCache releases the cache's
+// connections.
+func accountCacheFromEnv() (cache AccountCache, closeCache func() error, err error) {
+	closeCache = func() error { return nil }
+	kind := os.Getenv("GOBANK_ACCOUNT_CACHE")
+	if kind == "" || kind == "off" {
+		return nil, closeCache, nil
+	}
+	ttl := defaultAccountCacheTTL
+	if v := os.Getenv("GOBANK_ACCOUNT_CACHE_TTL"); v != "" {
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+			return nil, closeCache, errors.New("GOBANK_ACCOUNT_CACHE_TTL must be a positive duration")
+		}
+	}
+	switch kind {
+	case "memory":
+		size := defaultAccountCacheSize
+		if v := os.Getenv("GOBANK_ACCOUNT_CACHE_SIZE"); v != "" {
+			if size, err = strconv.Atoi(v); err != nil || size <= 0 {
+				return nil, closeCache, errors.New("GOBANK_ACCOUNT_CACHE_SIZE must be a positive integer")
+			}
+		}
+		return NewLRUAccountCache(size, ttl), closeCache, nil
+	case "redis":
+		url := os.Getenv("GOBANK_ACCOUNT_CACHE_REDIS_URL")
+		if url == "" {
+			return nil, closeCache, errors.New("GOBANK_ACCOUNT_CACHE_REDIS_URL is required for the redis account cache")
+		}
+		opts, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, closeCache, fmt.Errorf("GOBANK_ACCOUNT_CACHE_REDIS_URL: %w", err)
+		}
+		client := redis.NewClient(opts)
+		return NewRedisAccountCache(client, ttl), client.Close, nil
+	default:
+		return nil, closeCache, fmt.Errorf("GOBANK_ACCOUNT_CACHE must be memory, redis or off, got %q", kind)
+	}
+}
+
+// LRUAccountCache is an in-process AccountCache that evicts the least
+// recently used account once it holds size accounts.
+type LRUAccountCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // of *lruEntry, most recently used first
+	entries map[int]*list.Element
+}
+
+type lruEntry struct {
+	id      int
+	data    []byte
+	expires time.Time
+}
+
+func NewLRUAccountCache(size int, ttl time.Duration) *LRUAccountCache {
+	return &LRUAccountCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[int]*list.Element),
+	}
+}
+
+func (c *LRUAccountCache) Get(ctx context.Context, id int) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[id]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*lruEntry)
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(el)
+	return e.data, true, nil
+}
+
+func (c *LRUAccountCache) Set(ctx context.Context, id int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.entries[id]; ok {
+		e := el.Value.(*lruEntry)
+		e.data, e.expires = data, expires
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.entries[id] = c.order.PushFront(&lruEntry{id: id, data: data, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *LRUAccountCache) Delete(ctx context.Context, ids ...int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		if el, ok := c.entries[id]; ok {
+			c.remove(el)
+		}
+	}
+	return nil
+}
+
+func (c *LRUAccountCache) Clear(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.entries)
+	return nil
+}
+
+func (c *LRUAccountCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).id)
+}
+
+// redisAccountKeyPrefix namespaces the account keys in a shared Redis.
+const redisAccountKeyPrefix = "gobank:account:"
+
+// RedisAccountCache is an AccountCache in Redis, which replicas can share
+// so a write through one invalidates the account for all of them.
+type RedisAccountCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewRedisAccountCache(client *redis.Client, ttl time.Duration) *RedisAccountCache {
+	return &RedisAccountCache{client: client, ttl: ttl}
+}
+
+func redisAccountKey(id int) string {
+	return redisAccountKeyPrefix + strconv.Itoa(id)
+}
+
+func (c *RedisAccountCache) Get(ctx context.Context, id int) ([]byte, bool, error) {
+	data, err := c.client.Get(ctx, redisAccountKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (c *RedisAccountCache) Set(ctx context.Context, id int, data []byte) error {
+	return c.client.Set(ctx, redisAccountKey(id), data, c.ttl).Err()
+}
+
+func (c *RedisAccountCache) Delete(ctx context.Context, ids ...int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = redisAccountKey(id)
+	}
+	return c.client.Del(ctx, keys...).Err()
+}
+
+func (c *RedisAccountCache) Clear(ctx context.Context) error {
+	iter := c.client.Scan(ctx, 0, redisAccountKeyPrefix+"*", 500).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 500 {
+			if err := c.client.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return c.client.Del(ctx, keys...).Err()
+	}
+	return nil
+}
+
+// CachingStorage wraps a Storage and serves GetAccountByID from an
+// AccountCache, dropping an account from the cache whenever a write through
+// it may have changed the account. Balance-polling clients then mostly hit
+// the cache instead of the database.
+//
+// Cache failures are counted and logged, and fall back to the wrapped Storage, so the
+// cache never fails a request on its own.
+type CachingStorage struct {
+	Storage
+	cache AccountCache
+}
+
+// NewCachingStorage wraps next with cache.
+func NewCachingStorage(next Storage, cache AccountCache) *CachingStorage {
+	return &CachingStorage{Storage: next, cache: cache}
+}
+
+func (s *CachingStorage) GetAccountByID(id int) (*Account, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), accountCacheTimeout)
+	data, ok, err := s.cache.Get(ctx, id)
+	cancel()
+	switch {
+	case err != nil:
+		accountCacheLookups.WithLabelValues("error").Inc()
+		slog.Warn("account cache get failed", "account", id, "error", err)
+	case ok:
+		acc := new(Account)
+		if err := json.Unmarshal(data, acc); err == nil {
+			accountCacheLookups.WithLabelValues("hit").Inc()
+			return acc, nil
+		}
+		accountCacheLookups.WithLabelValues("error").Inc()
+	default:
+		accountCacheLookups.WithLabelValues("miss").Inc()
+	}
+
+	acc, err := s.Storage.GetAccountByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(acc); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), accountCacheTimeout)
+		defer cancel()
+		if err := s.cache.Set(ctx, id, data); err != nil {
+			slog.Warn("account cache set failed", "account", id, "error", err)
+		}
+	}
+	return acc, nil
+}
+
+// invalidate drops ids from the cache. Writes call it whether or not they
+// failed, since a failed write may still have committed.
+func (s *CachingStorage) invalidate(ids ...int) {
+	invalidateAccounts(s.cache, ids...)
+}
+
+func (s *CachingStorage) DeleteAccount(id int) error {
+	defer s.invalidate(id)
+	return s.Storage.DeleteAccount(id)
+}
+
+func (s *CachingStorage) UpdateAccount(acc *Account) error {
+	defer s.invalidate(acc.ID)
+	return s.Storage.UpdateAccount(acc)
+}
+
+func (s *CachingStorage) ModifyAccount(id int, apply func(*Account) error) (*Account, error) {
+	defer s.invalidate(id)
+	return s.Storage.ModifyAccount(id, apply)
+}
+
+func (s *CachingStorage) Transfer(fromID, toID int, amount int64) (*TransferRecord, error) {
+	defer s.invalidate(fromID, toID)
+	return s.Storage.Transfer(fromID, toID, amount)
+}
+
+func (s *CachingStorage) Deposit(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+	defer s.invalidate(id)
+	return s.Storage.Deposit(id, amount, idempotencyKey)
+}
+
+func (s *CachingStorage) Withdraw(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+	defer s.invalidate(id)
+	return s.Storage.Withdraw(id, amount, idempotencyKey)
+}
+
+func (s *CachingStorage) SetStatus(id int, status string) (*Account, error) {
+	defer s.invalidate(id)
+	return s.Storage.SetStatus(id, status)
+}
+
+func (s *CachingStorage) SetTransferLimits(id int, daily, weekly *int64) (*Account, error) {
+	defer s.invalidate(id)
+	return s.Storage.SetTransferLimits(id, daily, weekly)
+}
+
+// cachingHoldStore invalidates the accounts of released held transfers,
+// which move money without passing through Storage.
+type cachingHoldStore struct {
+	TransferHoldStore
+	cache AccountCache
+}
+
+func (s *cachingHoldStore) ReleaseHeldTransfer(id int64, note string) (*HeldTransfer, *TransferRecord, error) {
+	held, record, err := s.TransferHoldStore.ReleaseHeldTransfer(id, note)
+	if record != nil {
+		invalidateAccounts(s.cache, record.FromAccount, record.ToAccount)
+	}
+	return held, record, err
+}
+
+// cachingApprovalStore invalidates the accounts of approved transfers.
+type cachingApprovalStore struct {
+	TransferApprovalStore
+	cache AccountCache
+}
+
+func (s *cachingApprovalStore) ApprovePendingTransfer(id int64, approver, note string) (*PendingTransfer, *TransferRecord, error) {
+	pending, record, err := s.TransferApprovalStore.ApprovePendingTransfer(id, approver, note)
+	if record != nil {
+		invalidateAccounts(s.cache, record.FromAccount, record.ToAccount)
+	}
+	return pending, record, err
+}
+
+// cachingInterestStore clears the cache after interest accrual, which
+// credits any number of savings accounts directly.
+type cachingInterestStore struct {
+	InterestStore
+	cache AccountCache
+}
+
+func (s *cachingInterestStore) AccrueInterest(ctx context.Context, through time.Time) (*InterestRun, error) {
+	run, err := s.InterestStore.AccrueInterest(ctx, through)
+	if err != nil || run.Entries > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), accountCacheTimeout)
+		defer cancel()
+		if err := s.cache.Clear(ctx); err != nil {
+			slog.Warn("account cache clear failed", "error", err)
+		}
+	}
+	return run, err
+}
+
+func invalidateAccounts(cache AccountCache, ids ...int) {
+	ctx, cancel := context.WithTimeout(context.Background(), accountCacheTimeout)
+	defer cancel()
+	if err := cache.Delete(ctx, ids...); err != nil {
+		slog.Warn("account cache invalidation failed", "accounts", ids, "error", err)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrChaosCommitUnknown is returned by ChaosStorage after a transfer was
+// committed but the caller is told it failed, as happens when a connection
+// drops during COMMIT. Reconciliation must detect the applied transfer.
+var ErrChaosCommitUnknown = errors.New("chaos: transfer commit outcome unknown")
+
+// ChaosError is an injected transient failure.
+type ChaosError struct {
+	Op string
+}
+
+func (e *ChaosError) Error() string {
+	return fmt.Sprintf("chaos: injected transient failure in %s", e.Op)
+}
+
+// Temporary marks the error as retryable.
+func (e *ChaosError) Temporary() bool { return true }
+
+// ChaosConfig controls fault injection. Rates are probabilities in [0, 1].
+type ChaosConfig struct {
+	Enabled            bool
+	MaxLatency         time.Duration
+	ErrorRate          float64
+	TransferCommitRate float64
+	Seed               int64
+}
+
+// ChaosConfigFromEnv reads GOBANK_CHAOS_* variables. Chaos is refused when
+// GOBANK_ENV is "production".
+func ChaosConfigFromEnv() (ChaosConfig, error) {
+	var cfg ChaosConfig
+	var err error
+	if cfg.Enabled, err = envBool("GOBANK_CHAOS_ENABLED"); err != nil || !cfg.Enabled {
+		return cfg, err
+	}
+	if os.Getenv("GOBANK_ENV") == "production" {
+		return cfg, errors.New("chaos storage cannot be enabled in production")
+	}
+	if v := os.Getenv("GOBANK_CHAOS_LATENCY"); v != "" {
+		if cfg.MaxLatency, err = time.ParseDuration(v); err != nil {
+			return cfg, fmt.Errorf("GOBANK_CHAOS_LATENCY: %w", err)
+		}
+	}
+	if cfg.ErrorRate, err = envRate("GOBANK_CHAOS_ERROR_RATE"); err != nil {
+		return cfg, err
+	}
+	if cfg.TransferCommitRate, err = envRate("GOBANK_CHAOS_TRANSFER_COMMIT_RATE"); err != nil {
+		return cfg, err
+	}
+	cfg.Seed = time.Now().UnixNano()
+	if v := os.Getenv("GOBANK_CHAOS_SEED"); v != "" {
+		if cfg.Seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return cfg, fmt.Errorf("GOBANK_CHAOS_SEED: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+func envBool(name string) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+func envRate(name string) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("%s must be a number between 0 and 1", name)
+	}
+	return rate, nil
+}
+
+// ChaosStorage wraps a Storage and injects latency, transient errors and
+// partial transfer failures. It is intended for non-production testing of
+// retry and reconciliation logic.
+type ChaosStorage struct {
+	next Storage
+	cfg  ChaosConfig
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewChaosStorage wraps next with the fault injection described by cfg.
+func NewChaosStorage(next Storage, cfg ChaosConfig) *ChaosStorage {
+	return &ChaosStorage{
+		next: next,
+		cfg:  cfg,
+		rnd:  rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+func (s *ChaosStorage) roll() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rnd.Float64()
+}
+
+// inject sleeps for a random latency and may return a transient error.
+func (s *ChaosStorage) inject(op string) error {
+	if s.cfg.MaxLatency > 0 {
+		time.Sleep(time.Duration(s.roll() * float64(s.cfg.MaxLatency)))
+	}
+	if s.roll() < s.cfg.ErrorRate {
+		return &ChaosError{Op: op}
+	}
+	return nil
+}
+
+func (s *ChaosStorage) CreateAccount(acc *Account, ownerIDs ...int) error {
+	if err := s.inject("CreateAccount"); err != nil {
+		return err
+	}
+	return s.next.CreateAccount(acc, ownerIDs...)
+}
+
+func (s *ChaosStorage) DeleteAccount(id int) error {
+	if err := s.inject("DeleteAccount"); err != nil {
+		return err
+	}
+	return s.next.DeleteAccount(id)
+}
+
+func (s *ChaosStorage) UpdateAccount(acc *Account) error {
+	if err := s.inject("UpdateAccount"); err != nil {
+		return err
+	}
+	return s.next.UpdateAccount(acc)
+}
+
+func (s *ChaosStorage) ModifyAccount(id int, apply func(*Account) error) (*Account, error) {
+	if err := s.inject("ModifyAccount"); err != nil {
+		return nil, err
+	}
+	return s.next.ModifyAccount(id, apply)
+}
+
+func (s *ChaosStorage) GetAccountByID(id int) (*Account, error) {
+	if err := s.inject("GetAccountByID"); err != nil {
+		return nil, err
+	}
+	return s.next.GetAccountByID(id)
+}
+
+func (s *ChaosStorage) ListAccounts(q *AccountQuery) (*AccountPage, error) {
+	if err := s.inject("ListAccounts"); err != nil {
+		return nil, err
+	}
+	return s.next.ListAccounts(q)
+}
+
+func (s *ChaosStorage) SearchAccounts(q *AccountSearch) ([]*AccountMatch, error) {
+	if err := s.inject("SearchAccounts"); err != nil {
+		return nil, err
+	}
+	return s.next.SearchAccounts(q)
+}
+
+func (s *ChaosStorage) Transfer(fromID, toID int, amount int64) (*TransferRecord, error) {
+	if err := s.inject("Transfer"); err != nil {
+		return nil, err
+	}
+	record, err := s.next.Transfer(fromID, toID, amount)
+	if err != nil {
+		return nil, err
+	}
+	if s.roll() < s.cfg.TransferCommitRate {
+		return nil, ErrChaosCommitUnknown
+	}
+	return record, nil
+}
+
+func (s *ChaosStorage) Deposit(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+	if err := s.inject("Deposit"); err != nil {
+		return nil, err
+	}
+	return s.next.Deposit(id, amount, idempotencyKey)
+}
+
+func (s *ChaosStorage) Withdraw(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+	if err := s.inject("Withdraw"); err != nil {
+		return nil, err
+	}
+	return s.next.Withdraw(id, amount, idempotencyKey)
+}
+
+func (s *ChaosStorage) WriteStatement(ctx context.Context, id int, from, to time.Time, w StatementWriter) error {
+	if err := s.inject("WriteStatement"); err != nil {
+		return err
+	}
+	return s.next.WriteStatement(ctx, id, from, to, w)
+}
+
+func (s *ChaosStorage) WriteRegulatoryExport(ctx context.Context, from, to time.Time, w RegulatoryWriter) error {
+	if err := s.inject("WriteRegulatoryExport"); err != nil {
+		return err
+	}
+	return s.next.WriteRegulatoryExport(ctx, from, to, w)
+}
+
+func (s *ChaosStorage) SetStatus(id int, status string) (*Account, error) {
+	if err := s.inject("SetStatus"); err != nil {
+		return nil, err
+	}
+	return s.next.SetStatus(id, status)
+}
+
+func (s *ChaosStorage) SetTransferLimits(id int, daily, weekly *int64) (*Account, error) {
+	if err := s.inject("SetTransferLimits"); err != nil {
+		return nil, err
+	}
+	return s.next.SetTransferLimits(id, daily, weekly)
+}
+
+func (s *ChaosStorage) Stats() (*BankStats, error) {
+	if err := s.inject("Stats"); err != nil {
+		return nil, err
+	}
+	return s.next.Stats()
+}
+
+func (s *ChaosStorage) CreateCustomer(c *Customer, tokenHash string) error {
+	if err := s.inject("CreateCustomer"); err != nil {
+		return err
+	}
+	return s.next.CreateCustomer(c, tokenHash)
+}
+
+func (s *ChaosStorage) CustomerByTokenHash(tokenHash string) (*Customer, error) {
+	if err := s.inject("CustomerByTokenHash"); err != nil {
+		return nil, err
+	}
+	return s.next.CustomerByTokenHash(tokenHash)
+}
+
+func (s *ChaosStorage) AccountsForCustomer(customerID int, includeClosed bool) ([]*Account, error) {
+	if err := s.inject("AccountsForCustomer"); err != nil {
+		return nil, err
+	}
+	return s.next.AccountsForCustomer(customerID, includeClosed)
+}
+
+func (s *ChaosStorage) IsOwner(accountID, customerID int) (bool, error) {
+	if err := s.inject("IsOwner"); err != nil {
+		return false, err
+	}
+	return s.next.IsOwner(accountID, customerID)
+}
+
+func (s *ChaosStorage) Owners(accountID int) ([]*Customer, error) {
+	if err := s.inject("Owners"); err != nil {
+		return nil, err
+	}
+	return s.next.Owners(accountID)
+}
+
+func (s *ChaosStorage) AddOwner(accountID, customerID int) error {
+	if err := s.inject("AddOwner"); err != nil {
+		return err
+	}
+	return s.next.AddOwner(accountID, customerID)
+}
+
+func (s *ChaosStorage) RemoveOwner(accountID, customerID int) error {
+	if err := s.inject("RemoveOwner"); err != nil {
+		return err
+	}
+	return s.next.RemoveOwner(accountID, customerID)
+}
@@ -0,0 +1,14 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// BearerToken authenticates requests with a customer or admin token.
+func BearerToken(token string) RequestEditorFn {
+	return func(ctx context.Context, req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
@@ -0,0 +1,9 @@
+// Package client is a Go client for the gobank HTTP API, generated from
+// the OpenAPI document the server serves at /openapi.json.
+//
+//	c, err := client.NewClientWithResponses("http://localhost:3000",
+//		client.WithRequestEditorFn(client.BearerToken(token)))
+//	resp, err := c.GetAccountWithResponse(ctx, id)
+package client
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen -config oapi-codegen.yaml ../openapi.json
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gnsalok/go-projects-root/gobank/client"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+	"github.com/spf13/cobra"
+)
+
+func newAccountCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "account",
+		Aliases: []string{"accounts"},
+		Short:   "Create, inspect and freeze accounts",
+	}
+	cmd.AddCommand(
+		newAccountCreateCommand(o),
+		newAccountGetCommand(o),
+		newAccountListCommand(o),
+		newAccountLedgerCommand(o),
+		newAccountStatusCommand(o, "freeze", "Freeze an account, blocking withdrawals and transfers"),
+		newAccountStatusCommand(o, "unfreeze", "Unfreeze a frozen account"),
+	)
+	return cmd
+}
+
+// accountID parses an account ID argument.
+func accountID(arg string) (int, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("account ID %q is not a positive number", arg)
+	}
+	return id, nil
+}
+
+// printAccount renders a single account as field/value rows.
+func (o *options) printAccount(cmd *cobra.Command, body []byte) error {
+	data, err := envelopeData(body)
+	if err != nil {
+		return err
+	}
+	var acc client.Account
+	if err := json.Unmarshal(data, &acc); err != nil {
+		return fmt.Errorf("decoding account: %w", err)
+	}
+	return o.render(cmd, data, func(w io.Writer) {
+		fmt.Fprintf(w, "ID\t%d\n", acc.Id)
+		fmt.Fprintf(w, "Account number\t%d\n", acc.Accountnumber)
+		fmt.Fprintf(w, "Holder\t%s %s\n", acc.Firstname, acc.Lastname)
+		fmt.Fprintf(w, "Type\t%s\n", acc.Type)
+		fmt.Fprintf(w, "Status\t%s\n", acc.Status)
+		fmt.Fprintf(w, "Balance\t%d %s\n", acc.Balance, acc.Currency)
+		fmt.Fprintf(w, "Overdraft limit\t%d\n", acc.OverdraftLimit)
+		fmt.Fprintf(w, "Daily transfer limit\t%s\n", optional(acc.DailyTransferLimit))
+		fmt.Fprintf(w, "Weekly transfer limit\t%s\n", optional(acc.WeeklyTransferLimit))
+		fmt.Fprintf(w, "Created\t%s\n", acc.CreatedAt.Format(time.RFC3339))
+	})
+}
+
+func newAccountCreateCommand(o *options) *cobra.Command {
+	var req client.CreateAccountRequest
+	var currency, accountType, idempotencyKey string
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Open an account for the authenticated customer",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.customer()
+			if err != nil {
+				return err
+			}
+			if currency != "" {
+				req.Currency = &currency
+			}
+			if accountType != "" {
+				t := client.CreateAccountRequestType(accountType)
+				req.Type = &t
+			}
+			var params client.CreateAccountParams
+			if idempotencyKey != "" {
+				params.IdempotencyKey = &idempotencyKey
+			}
+			resp, err := c.CreateAccountWithResponse(cmd.Context(), &params, req)
+			if err != nil {
+				return err
+			}
+			if err := checkResponse(resp.HTTPResponse, resp.Body); err != nil {
+				return err
+			}
+			return o.printAccount(cmd, resp.Body)
+		},
+	}
+	cmd.Flags().StringVar(&req.Firstname, "firstname", "", "account holder's first name")
+	cmd.Flags().StringVar(&req.Lastname, "lastname", "", "account holder's last name")
+	cmd.Flags().StringVar(&currency, "currency", "", "ISO 4217 currency code (default USD)")
+	cmd.Flags().StringVar(&accountType, "type", "", "checking (default) or savings")
+	cmd.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "makes retries of this command open only one account")
+	cmd.MarkFlagRequired("firstname")
+	cmd.MarkFlagRequired("lastname")
+	return cmd
+}
+
+func newAccountGetCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <id>",
+		Short: "Show an account and its balance",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := accountID(args[0])
+			if err != nil {
+				return err
+			}
+			c, err := o.customer()
+			if err != nil {
+				return err
+			}
+			resp, err := c.GetAccountWithResponse(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			if err := checkResponse(resp.HTTPResponse, resp.Body); err != nil {
+				return err
+			}
+			return o.printAccount(cmd, resp.Body)
+		},
+	}
+}
+
+func newAccountListCommand(o *options) *cobra.Command {
+	var params client.ListAccountsParams
+	var name, status, cursor string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the customer's accounts and their balances",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.customer()
+			if err != nil {
+				return err
+			}
+			if name != "" {
+				params.Name = &name
+			}
+			if status != "" {
+				params.Status = &status
+			}
+			if cursor != "" {
+				params.Cursor = &cursor
+			}
+			if limit > 0 {
+				params.Limit = &limit
+			}
+			resp, err := c.ListAccountsWithResponse(cmd.Context(), &params)
+			if err != nil {
+				return err
+			}
+			if err := checkResponse(resp.HTTPResponse, resp.Body); err != nil {
+				return err
+			}
+			page := resp.JSON200
+			if page == nil {
+				return errors.New("unexpected response body")
+			}
+			return o.render(cmd, page, func(w io.Writer) {
+				fmt.Fprintln(w, "ID\tACCOUNT NUMBER\tHOLDER\tTYPE\tSTATUS\tBALANCE\tCURRENCY")
+				for _, a := range page.Data {
+					fmt.Fprintf(w, "%d\t%d\t%s %s\t%s\t%s\t%d\t%s\n",
+						a.Id, a.Accountnumber, a.Firstname, a.Lastname, a.Type, a.Status, a.Balance, a.Currency)
+				}
+				if page.Meta.NextCursor != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "more accounts: --cursor %s\n", *page.Meta.NextCursor)
+				}
+			})
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", "", "prefix of the holder's first or last name")
+	cmd.Flags().StringVar(&status, "status", "", "comma-separated statuses to keep")
+	cmd.Flags().StringVar(&cursor, "cursor", "", "next page, as printed after the previous one")
+	cmd.Flags().IntVar(&limit, "limit", 0, "accounts per page")
+	return cmd
+}
+
+// Ledger is an account's statement as gobankctl prints it in JSON.
+// Amounts are formatted by the server.
+type Ledger struct {
+	Account        string        `json:"account"`
+	Name           string        `json:"name"`
+	Currency       string        `json:"currency"`
+	From           string        `json:"from"`
+	To             string        `json:"to"`
+	OpeningBalance string        `json:"openingBalance"`
+	ClosingBalance string        `json:"closingBalance"`
+	Entries        []LedgerEntry `json:"entries"`
+}
+
+// LedgerEntry is one balance movement; Amount is negative for debits.
+type LedgerEntry struct {
+	ID          string `json:"id"`
+	Date        string `json:"date"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+	Balance     string `json:"balance"`
+}
+
+// parseLedger reads the CSV statement the server writes: key/value
+// summary rows, the entry header and entries, then the closing balance.
+func parseLedger(body []byte) (*Ledger, error) {
+	r := csv.NewReader(bytes.NewReader(body))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("decoding statement: %w", err)
+	}
+	l := &Ledger{Entries: []LedgerEntry{}}
+	inEntries := false
+	for _, row := range rows {
+		switch {
+		case len(row) >= 2 && row[0] == "closing_balance":
+			l.ClosingBalance = row[1]
+			inEntries = false
+		case inEntries && len(row) == 6:
+			l.Entries = append(l.Entries, LedgerEntry{row[0], row[1], row[2], row[3], row[4], row[5]})
+		case len(row) == 6 && row[0] == "id":
+			inEntries = true
+		case len(row) >= 3 && row[0] == "period":
+			l.From, l.To = row[1], row[2]
+		case len(row) >= 2:
+			switch row[0] {
+			case "account":
+				l.Account = row[1]
+			case "name":
+				l.Name = row[1]
+			case "currency":
+				l.Currency = row[1]
+			case "opening_balance":
+				l.OpeningBalance = row[1]
+			}
+		}
+	}
+	return l, nil
+}
+
+func newAccountLedgerCommand(o *options) *cobra.Command {
+	var from, to string
+	cmd := &cobra.Command{
+		Use:   "ledger <id>",
+		Short: "Show an account's entries and balances over a period",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := accountID(args[0])
+			if err != nil {
+				return err
+			}
+			format := client.Csv
+			params := client.GetStatementParams{Format: &format}
+			for _, d := range []struct {
+				flag, value string
+				dst         **openapi_types.Date
+			}{{"from", from, &params.From}, {"to", to, &params.To}} {
+				if d.value == "" {
+					continue
+				}
+				t, err := time.Parse(time.DateOnly, d.value)
+				if err != nil {
+					return fmt.Errorf("--%s must be a date like 2006-01-02", d.flag)
+				}
+				*d.dst = &openapi_types.Date{Time: t}
+			}
+			c, err := o.customer()
+			if err != nil {
+				return err
+			}
+			resp, err := c.GetStatementWithResponse(cmd.Context(), id, &params)
+			if err != nil {
+				return err
+			}
+			if err := checkResponse(resp.HTTPResponse, resp.Body); err != nil {
+				return err
+			}
+			l, err := parseLedger(resp.Body)
+			if err != nil {
+				return err
+			}
+			return o.render(cmd, l, func(w io.Writer) {
+				fmt.Fprintf(w, "Account %s (%s), %s to %s, %s\n", l.Account, l.Name, l.From, l.To, l.Currency)
+				fmt.Fprintf(w, "Opening balance %s\n", l.OpeningBalance)
+				fmt.Fprintln(w, "ID\tDATE\tKIND\tDESCRIPTION\tAMOUNT\tBALANCE")
+				for _, e := range l.Entries {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Date, e.Kind, e.Description, e.Amount, e.Balance)
+				}
+				fmt.Fprintf(w, "Closing balance %s\n", l.ClosingBalance)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "first day, YYYY-MM-DD (default 30 days before --to)")
+	cmd.Flags().StringVar(&to, "to", "", "last day, YYYY-MM-DD (default today)")
+	return cmd
+}
+
+// newAccountStatusCommand builds the operator commands freeze and
+// unfreeze.
+func newAccountStatusCommand(o *options, action, short string) *cobra.Command {
+	var idempotencyKey string
+	cmd := &cobra.Command{
+		Use:   action + " <id>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := accountID(args[0])
+			if err != nil {
+				return err
+			}
+			c, err := o.admin()
+			if err != nil {
+				return err
+			}
+			var key *string
+			if idempotencyKey != "" {
+				key = &idempotencyKey
+			}
+			var resp *http.Response
+			var body []byte
+			if action == "freeze" {
+				r, err := c.AdminFreezeAccountWithResponse(cmd.Context(), id, &client.AdminFreezeAccountParams{IdempotencyKey: key})
+				if err != nil {
+					return err
+				}
+				resp, body = r.HTTPResponse, r.Body
+			} else {
+				r, err := c.AdminUnfreezeAccountWithResponse(cmd.Context(), id, &client.AdminUnfreezeAccountParams{IdempotencyKey: key})
+				if err != nil {
+					return err
+				}
+				resp, body = r.HTTPResponse, r.Body
+			}
+			if err := checkResponse(resp, body); err != nil {
+				return err
+			}
+			return o.printAccount(cmd, body)
+		},
+	}
+	cmd.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "makes retries of this command apply only once")
+	return cmd
+}
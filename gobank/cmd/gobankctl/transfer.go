@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gnsalok/go-projects-root/gobank/client"
+	"github.com/spf13/cobra"
+)
+
+func newTransferCommand(o *options) *cobra.Command {
+	var req client.TransferRequest
+	var idempotencyKey string
+	cmd := &cobra.Command{
+		Use:   "transfer",
+		Short: "Move money between two accounts",
+		Long: `Move --amount, in minor units of the source account's currency, from one
+account to another. Transfers the fraud checks hold, or that need
+approval from other owners, are reported as accepted rather than done.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.customer()
+			if err != nil {
+				return err
+			}
+			var params client.CreateTransferParams
+			if idempotencyKey != "" {
+				params.IdempotencyKey = &idempotencyKey
+			}
+			resp, err := c.CreateTransferWithResponse(cmd.Context(), &params, req)
+			if err != nil {
+				return err
+			}
+			if err := checkResponse(resp.HTTPResponse, resp.Body); err != nil {
+				return err
+			}
+			data, err := envelopeData(resp.Body)
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode() == http.StatusAccepted {
+				return o.printAcceptedTransfer(cmd, resp.Body, data)
+			}
+			var t client.TransferRecord
+			if err := json.Unmarshal(data, &t); err != nil {
+				return fmt.Errorf("decoding transfer: %w", err)
+			}
+			return o.render(cmd, data, func(w io.Writer) {
+				fmt.Fprintf(w, "Transfer\t%d\n", t.Id)
+				fmt.Fprintf(w, "From\t%d\n", t.FromAccount)
+				fmt.Fprintf(w, "To\t%d\n", t.ToAccount)
+				fmt.Fprintf(w, "Debit\t%d %s\n", t.Debit.Amount, t.Debit.Currency)
+				fmt.Fprintf(w, "Credit\t%d %s\n", t.Credit.Amount, t.Credit.Currency)
+				fmt.Fprintf(w, "Created\t%s\n", t.CreatedAt.Format(time.RFC3339))
+			})
+		},
+	}
+	cmd.Flags().IntVar(&req.FromAccount, "from", 0, "source account ID")
+	cmd.Flags().IntVar(&req.ToAccount, "to", 0, "destination account ID")
+	cmd.Flags().Int64Var(&req.Amount, "amount", 0, "amount in minor units, e.g. cents")
+	cmd.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "makes retries of this command transfer only once")
+	for _, f := range []string{"from", "to", "amount"} {
+		cmd.MarkFlagRequired(f)
+	}
+	return cmd
+}
+
+// printAcceptedTransfer renders a 202 response: a transfer held for fraud
+// review, or one waiting for other owners to approve it.
+func (o *options) printAcceptedTransfer(cmd *cobra.Command, body []byte, data json.RawMessage) error {
+	var held client.HeldTransferEnvelope
+	if err := json.Unmarshal(body, &held); err != nil {
+		return fmt.Errorf("decoding transfer: %w", err)
+	}
+	if held.Meta.Held {
+		t := held.Data
+		return o.render(cmd, data, func(w io.Writer) {
+			fmt.Fprintf(w, "Held transfer\t%d\n", t.Id)
+			fmt.Fprintf(w, "From\t%d\n", t.FromAccount)
+			fmt.Fprintf(w, "To\t%d\n", t.ToAccount)
+			fmt.Fprintf(w, "Amount\t%d\n", t.Amount)
+			fmt.Fprintf(w, "Status\t%s\n", t.Status)
+			fmt.Fprintf(w, "Reason\t%s\n", t.Reason)
+		})
+	}
+	var pending client.PendingTransfer
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return fmt.Errorf("decoding transfer: %w", err)
+	}
+	return o.render(cmd, data, func(w io.Writer) {
+		fmt.Fprintf(w, "Pending transfer\t%d\n", pending.Id)
+		fmt.Fprintf(w, "From\t%d\n", pending.FromAccount)
+		fmt.Fprintf(w, "To\t%d\n", pending.ToAccount)
+		fmt.Fprintf(w, "Amount\t%d\n", pending.Amount)
+		fmt.Fprintf(w, "Status\t%s\n", pending.Status)
+		fmt.Fprintf(w, "Approvals\t%d of %d\n", len(pending.Approvals), pending.RequiredApprovals)
+		fmt.Fprintf(w, "Expires\t%s\n", pending.ExpiresAt.Format(time.RFC3339))
+	})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ServerConfig controls how the HTTP server listens and shuts down.
+type ServerConfig struct {
+	ListenAddr string
+	// GRPCListenAddr is where the gRPC services listen.
+	GRPCListenAddr string
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout bounds how long in-flight requests may take to drain.
+	ShutdownTimeout time.Duration
+}
+
+// DefaultServerConfig returns the settings used when no env vars are set.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		ListenAddr:        ":3000",
+		GRPCListenAddr:    ":9090",
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      15 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+	}
+}
+
+// TLSEnabled reports whether the server should serve HTTPS.
+func (c ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// ServerConfigFromEnv overrides the defaults with GOBANK_LISTEN_ADDR,
+// GOBANK_GRPC_LISTEN_ADDR, GOBANK_TLS_CERT, GOBANK_TLS_KEY and the GOBANK_*_TIMEOUT durations.
+func ServerConfigFromEnv() (ServerConfig, error) {
+	cfg := DefaultServerConfig()
+	if v := os.Getenv("GOBANK_LISTEN_ADDR"); v != "" {
+		cfg.ListenAddr = v
+	}
+	if v := os.Getenv("GOBANK_GRPC_LISTEN_ADDR"); v != "" {
+		cfg.GRPCListenAddr = v
+	}
+	cfg.TLSCertFile = os.Getenv("GOBANK_TLS_CERT")
+	cfg.TLSKeyFile = os.Getenv("GOBANK_TLS_KEY")
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return cfg, errors.New("GOBANK_TLS_CERT and GOBANK_TLS_KEY must be set together")
+	}
+
+	timeouts := []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"GOBANK_READ_HEADER_TIMEOUT", &cfg.ReadHeaderTimeout},
+		{"GOBANK_READ_TIMEOUT", &cfg.ReadTimeout},
+		{"GOBANK_WRITE_TIMEOUT", &cfg.WriteTimeout},
+		{"GOBANK_IDLE_TIMEOUT", &cfg.IdleTimeout},
+		{"GOBANK_SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		v := os.Getenv(t.name)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", t.name, err)
+		}
+		if d < 0 {
+			return cfg, fmt.Errorf("%s must not be negative", t.name)
+		}
+		*t.dst = d
+	}
+	return cfg, nil
+}
+
+// DBConfig tunes the Postgres connection pool, statement timeouts and the
+// retrying of transient errors.
+type DBConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// QueryTimeout makes Postgres cancel statements running longer; 0
+	// means no limit.
+	QueryTimeout time.Duration
+	// RetryAttempts is how many times an operation is tried in all when
+	// it fails with a transient error; 1 disables retries.
+	RetryAttempts int
+	// RetryBaseDelay is the backoff before the first retry, doubling for
+	// each further one up to RetryMaxDelay.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+// DefaultDBConfig returns the settings used when no env vars are set.
+// Connections are recycled every few minutes, so that after a failover
+// the pool moves to the new primary.
+func DefaultDBConfig() DBConfig {
+	return DBConfig{
+		MaxOpenConns:    25,
+		MaxIdleConns:    10,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		QueryTimeout:    10 * time.Second,
+		RetryAttempts:   4,
+		RetryBaseDelay:  100 * time.Millisecond,
+		RetryMaxDelay:   2 * time.Second,
+	}
+}
+
+// DBConfigFromEnv overrides the defaults with GOBANK_DB_MAX_OPEN_CONNS,
+// GOBANK_DB_MAX_IDLE_CONNS, GOBANK_DB_RETRY_ATTEMPTS and the durations
+// GOBANK_DB_CONN_MAX_LIFETIME, GOBANK_DB_CONN_MAX_IDLE_TIME,
+// GOBANK_DB_QUERY_TIMEOUT, GOBANK_DB_RETRY_BASE_DELAY and
+// GOBANK_DB_RETRY_MAX_DELAY.
+func DBConfigFromEnv() (DBConfig, error) {
+	cfg := DefaultDBConfig()
+	counts := []struct {
+		name string
+		dst  *int
+		min  int
+	}{
+		{"GOBANK_DB_MAX_OPEN_CONNS", &cfg.MaxOpenConns, 1},
+		{"GOBANK_DB_MAX_IDLE_CONNS", &cfg.MaxIdleConns, 0},
+		{"GOBANK_DB_RETRY_ATTEMPTS", &cfg.RetryAttempts, 1},
+	}
+	for _, c := range counts {
+		v := os.Getenv(c.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", c.name, err)
+		}
+		if n < c.min {
+			return cfg, fmt.Errorf("%s must be at least %d", c.name, c.min)
+		}
+		*c.dst = n
+	}
+
+	durations := []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"GOBANK_DB_CONN_MAX_LIFETIME", &cfg.ConnMaxLifetime},
+		{"GOBANK_DB_CONN_MAX_IDLE_TIME", &cfg.ConnMaxIdleTime},
+		{"GOBANK_DB_QUERY_TIMEOUT", &cfg.QueryTimeout},
+		{"GOBANK_DB_RETRY_BASE_DELAY", &cfg.RetryBaseDelay},
+		{"GOBANK_DB_RETRY_MAX_DELAY", &cfg.RetryMaxDelay},
+	}
+	for _, d := range durations {
+		v := os.Getenv(d.name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", d.name, err)
+		}
+		if parsed < 0 {
+			return cfg, fmt.Errorf("%s must not be negative", d.name)
+		}
+		*d.dst = parsed
+	}
+	if cfg.MaxIdleConns > cfg.MaxOpenConns {
+		return cfg, errors.New("GOBANK_DB_MAX_IDLE_CONNS must not exceed GOBANK_DB_MAX_OPEN_CONNS")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrCustomerNotFound is returned when no customer has the requested ID.
+	ErrCustomerNotFound = errors.New("customer not found")
+	// ErrCustomerExists is returned when an email is already registered.
+	ErrCustomerExists = errors.New("customer already exists")
+	// ErrUnauthenticated is returned when a request carries no valid token.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrForbidden is returned when the caller does not own the account.
+	ErrForbidden = errors.New("not an owner of this account")
+	// ErrLastOwner is returned when unlinking would leave an account without owners.
+	ErrLastOwner = errors.New("an account must keep at least one owner")
+)
+
+// Customer is a person who can own accounts, alone or jointly.
+type Customer struct {
+	ID        int       `json:"id"`
+	FirstName string    `json:"firstname"`
+	LastName  string    `json:"lastname"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateCustomerRequest registers a customer.
+type CreateCustomerRequest struct {
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	Email     string `json:"email"`
+}
+
+func (r *CreateCustomerRequest) Validate() error {
+	var v Validator
+	r.FirstName = strings.TrimSpace(r.FirstName)
+	r.LastName = strings.TrimSpace(r.LastName)
+	r.Email = strings.ToLower(strings.TrimSpace(r.Email))
+	v.Check(r.FirstName != "", "firstname", "is required")
+	v.Check(len(r.FirstName) <= 100, "firstname", "must be at most 100 characters")
+	v.Check(r.LastName != "", "lastname", "is required")
+	v.Check(len(r.LastName) <= 100, "lastname", "must be at most 100 characters")
+	addr, err := mail.ParseAddress(r.Email)
+	v.Check(err == nil && addr.Address == r.Email && len(r.Email) <= 255, "email", "must be a valid email address")
+	return v.Err()
+}
+
+// OwnerRequest links a customer to an account.
+type OwnerRequest struct {
+	CustomerID int `json:"customerId"`
+}
+
+func (r *OwnerRequest) Validate() error {
+	var v Validator
+	v.Check(r.CustomerID > 0, "customerId", "is required")
+	return v.Err()
+}
+
+// CustomerStore persists customers and account ownership.
+type CustomerStore interface {
+	CreateCustomer(c *Customer, tokenHash string) error
+	CustomerByTokenHash(tokenHash string) (*Customer, error)
+	// AccountsForCustomer lists the customer's accounts, leaving out
+	// closed ones unless includeClosed is set.
+	AccountsForCustomer(customerID int, includeClosed bool) ([]*Account, error)
+	IsOwner(accountID, customerID int) (bool, error)
+	Owners(accountID int) ([]*Customer, error)
+	AddOwner(accountID, customerID int) error
+	RemoveOwner(accountID, customerID int) error
+}
+
+// principal is the authenticated caller: a customer or the operator. When
+// a customer calls through an API key, apiKey is that key.
+type principal struct {
+	customer *Customer
+	apiKey   *APIKey
+	admin    bool
+}
+
+func principalFrom(ctx context.Context) *principal {
+	p, _ := ctx.Value(principalKey).(*principal)
+	return p
+}
+
+// newCustomerToken returns a random API token and the hash stored for it.
+func newCustomerToken() (token, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = "gbk_" + hex.EncodeToString(b)
+	return token, hashToken(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	return strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func (s *APIServer) isAdminToken(token string) bool {
+	return s.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+// authenticated resolves the bearer token to a principal before calling
+// f. API keys only get through to routes their scopes allow.
+func (s *APIServer) authenticated(f apiFunc) apiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := bearerToken(r)
+		if !ok {
+			token = ""
+		}
+		p, err := s.authenticate(r.Context(), token, clientIP(r))
+		if errors.Is(err, ErrUnauthenticated) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			return ErrUnauthenticated
+		}
+		if err != nil {
+			return err
+		}
+		if p.apiKey != nil {
+			if err := checkScope(r, p.apiKey); err != nil {
+				return err
+			}
+		}
+		return f(w, r.WithContext(context.WithValue(r.Context(), principalKey, p)))
+	}
+}
+
+// authenticate resolves a bearer token to the operator for the admin
+// token, to the customer an API key acts for, or to the customer holding
+// the token. ip is where the call comes from, recorded on API key use.
+// Missing and unknown tokens are ErrUnauthenticated.
+func (s *APIServer) authenticate(ctx context.Context, token, ip string) (*principal, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	p := &principal{admin: s.isAdminToken(token)}
+	var err error
+	switch {
+	case p.admin:
+	case s.apiKeys != nil && strings.HasPrefix(token, apiKeyPrefix):
+		p.apiKey, p.customer, err = s.authenticateAPIKey(ctx, token, ip)
+	default:
+		p.customer, err = s.store.CustomerByTokenHash(hashToken(token))
+	}
+	if errors.Is(err, ErrCustomerNotFound) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// accountOwner authenticates the caller and requires them to own the
+// account in the {id} path variable.
+func (s *APIServer) accountOwner(f apiFunc) apiFunc {
+	return s.authenticated(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := getID(r)
+		if err != nil {
+			return err
+		}
+		if err := s.authorizeAccount(r.Context(), id); err != nil {
+			return err
+		}
+		return f(w, r)
+	})
+}
+
+// authorizeAccount checks the caller may operate on account id.
+func (s *APIServer) authorizeAccount(ctx context.Context, id int) error {
+	p := principalFrom(ctx)
+	if p == nil {
+		return ErrUnauthenticated
+	}
+	if p.admin {
+		return nil
+	}
+	owner, err := s.store.IsOwner(id, p.customer.ID)
+	if err != nil {
+		return err
+	}
+	if !owner {
+		return fmt.Errorf("%w: %d", ErrForbidden, id)
+	}
+	return nil
+}
+
+func (s *APIServer) customerRoutes(router *mux.Router) {
+	router.HandleFunc("/customer", makeHTTPHandleFunc(s.handleCreateCustomer)).Methods(http.MethodPost)
+	router.HandleFunc("/customer/me", makeHTTPHandleFunc(s.authenticated(s.handleGetMe))).Methods(http.MethodGet)
+	router.HandleFunc("/account/{id}/owners", makeHTTPHandleFunc(s.accountOwner(s.handleListOwners))).Methods(http.MethodGet)
+	router.HandleFunc("/account/{id}/owners", makeHTTPHandleFunc(s.accountOwner(s.handleAddOwner))).Methods(http.MethodPost)
+	router.HandleFunc("/account/{id}/owners/{customerId}", makeHTTPHandleFunc(s.accountOwner(s.handleRemoveOwner))).Methods(http.MethodDelete)
+}
+
+// handleCreateCustomer registers a customer and returns their API token.
+// The token is shown only once; only its hash is stored.
+func (s *APIServer) handleCreateCustomer(w http.ResponseWriter, r *http.Request) error {
+	req := new(CreateCustomerRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	customer := &Customer{FirstName: req.FirstName, LastName: req.LastName, Email: req.Email}
+	token, hash := newCustomerToken()
+	if err := s.store.CreateCustomer(customer, hash); err != nil {
+		return err
+	}
+	return writeData(w, http.StatusCreated, map[string]any{"customer": customer, "token": token}, nil)
+}
+
+func (s *APIServer) handleGetMe(w http.ResponseWriter, r *http.Request) error {
+	p := principalFrom(r.Context())
+	if p.customer == nil {
+		return badRequest(errors.New("the admin token does not belong to a customer"))
+	}
+	var includeClosed bool
+	if v := r.URL.Query().Get("includeClosed"); v != "" {
+		var err error
+		if includeClosed, err = strconv.ParseBool(v); err != nil {
+			return badRequest(errors.New("includeClosed must be true or false"))
+		}
+	}
+	accounts, err := s.store.AccountsForCustomer(p.customer.ID, includeClosed)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, map[string]any{"customer": p.customer, "accounts": accounts}, nil)
+}
+
+func (s *APIServer) handleListOwners(w http.ResponseWriter, r *http.Request) error {
+	id, _ := getID(r)
+	owners, err := s.store.Owners(id)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, owners, nil)
+}
+
+// handleAddOwner makes another customer a joint owner of the account. When
+// KYC is required, they must have been approved.
+func (s *APIServer) handleAddOwner(w http.ResponseWriter, r *http.Request) error {
+	id, _ := getID(r)
+	req := new(OwnerRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	if err := s.requireKYC(req.CustomerID); err != nil {
+		return err
+	}
+	if err := s.store.AddOwner(id, req.CustomerID); err != nil {
+		return err
+	}
+	owners, err := s.store.Owners(id)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, owners, nil)
+}
+
+// handleRemoveOwner unlinks an owner. Owners may remove themselves or a
+// joint owner, but an account always keeps at least one owner.
+func (s *APIServer) handleRemoveOwner(w http.ResponseWriter, r *http.Request) error {
+	id, _ := getID(r)
+	idStr := mux.Vars(r)["customerId"]
+	customerID, err := strconv.Atoi(idStr)
+	if err != nil {
+		return badRequest(fmt.Errorf("invalid customer id %q", idStr))
+	}
+	if err := s.store.RemoveOwner(id, customerID); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+const customerColumns = `id, first_name, last_name, email, created_at`
+
+func scanIntoCustomer(row interface{ Scan(...any) error }) (*Customer, error) {
+	c := new(Customer)
+	if err := row.Scan(&c.ID, &c.FirstName, &c.LastName, &c.Email, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *PostgresStore) CreateCustomer(c *Customer, tokenHash string) error {
+	err := s.db.QueryRow(`insert into customer (first_name, last_name, email, token_hash)
+	values ($1, $2, $3, $4) returning id, created_at`, c.FirstName, c.LastName, c.Email, tokenHash).
+		Scan(&c.ID, &c.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: %s", ErrCustomerExists, c.Email)
+	}
+	return err
+}
+
+func (s *PostgresStore) CustomerByTokenHash(tokenHash string) (*Customer, error) {
+	c, err := scanIntoCustomer(s.db.QueryRow(`select `+customerColumns+` from customer where token_hash = $1`, tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCustomerNotFound
+	}
+	return c, err
+}
+
+func (s *PostgresStore) AccountsForCustomer(customerID int, includeClosed bool) ([]*Account, error) {
+	rows, err := s.db.Query(`select `+accountColumns+` from account
+	where id in (select account_id from account_owner where customer_id = $1)
+	and ($2 or status <> $3)
+	order by id`, customerID, includeClosed, AccountClosed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	accounts := []*Account{}
+	for rows.Next() {
+		acc, err := scanIntoAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, acc)
+	}
+	return accounts, rows.Err()
+}
+
+func (s *PostgresStore) IsOwner(accountID, customerID int) (bool, error) {
+	var owner bool
+	err := s.db.QueryRow(`select exists (select 1 from account_owner where account_id = $1 and customer_id = $2)`,
+		accountID, customerID).Scan(&owner)
+	return owner, err
+}
+
+func (s *PostgresStore) Owners(accountID int) ([]*Customer, error) {
+	rows, err := s.db.Query(`select c.id, c.first_name, c.last_name, c.email, c.created_at
+	from customer c join account_owner o on o.customer_id = c.id
+	where o.account_id = $1 order by o.created_at, c.id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	owners := []*Customer{}
+	for rows.Next() {
+		c, err := scanIntoCustomer(rows)
+		if err != nil {
+			return nil, err
+		}
+		owners = append(owners, c)
+	}
+	return owners, rows.Err()
+}
+
+// AddOwner links a customer to an account; linking an existing owner is a no-op.
+func (s *PostgresStore) AddOwner(accountID, customerID int) error {
+	_, err := s.db.Exec(`insert into account_owner (account_id, customer_id) values ($1, $2)
+	on conflict do nothing`, accountID, customerID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		if pqErr.Constraint == "account_owner_customer_id_fkey" {
+			return fmt.Errorf("%w: %d", ErrCustomerNotFound, customerID)
+		}
+		return fmt.Errorf("%w: %d", ErrAccountNotFound, accountID)
+	}
+	return err
+}
+
+// RemoveOwner unlinks a customer, refusing to remove an account's last owner.
+func (s *PostgresStore) RemoveOwner(accountID, customerID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the account so concurrent unlinks cannot both pass the check.
+	if err := tx.QueryRow("select id from account where id = $1 for update", accountID).Scan(&accountID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %d", ErrAccountNotFound, accountID)
+		}
+		return err
+	}
+	var owners int
+	var linked bool
+	if err := tx.QueryRow(`select count(*), coalesce(bool_or(customer_id = $2), false)
+	from account_owner where account_id = $1`, accountID, customerID).Scan(&owners, &linked); err != nil {
+		return err
+	}
+	if !linked {
+		return fmt.Errorf("%w: customer %d does not own account %d", ErrCustomerNotFound, customerID, accountID)
+	}
+	if owners == 1 {
+		return ErrLastOwner
+	}
+	if _, err := tx.Exec(`delete from account_owner where account_id = $1 and customer_id = $2`, accountID, customerID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
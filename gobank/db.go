@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgreSQL error codes of failures that leave nothing done.
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+	readOnlyTransaction  = "25006"
+	adminShutdown        = "57P01"
+	crashShutdown        = "57P02"
+	cannotConnectNow     = "57P03"
+	// connectionException is the class of errors setting up connections.
+	connectionException = "08"
+)
+
+// pgDB is the connection pool of PostgresStore. Statements outside
+// transactions, and the start of transactions, are retried with backoff
+// when they fail with an error guaranteeing they had no effect, as seen
+// while the database restarts or fails over. Statements inside
+// transactions are not: their caller sees the error and rolls back.
+type pgDB struct {
+	*sql.DB
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// openDB opens a pool connecting to connStr, configured by cfg, and waits
+// for the database to answer.
+func openDB(connStr string, cfg DBConfig) (*pgDB, error) {
+	if cfg.QueryTimeout > 0 {
+		var err error
+		if connStr, err = withStatementTimeout(connStr, cfg.QueryTimeout); err != nil {
+			return nil, err
+		}
+	}
+	sqlDB, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	db := &pgDB{DB: sqlDB, attempts: cfg.RetryAttempts, baseDelay: cfg.RetryBaseDelay, maxDelay: cfg.RetryMaxDelay}
+	ctx := context.Background()
+	if err := db.retry(ctx, "ping", func() error { return sqlDB.PingContext(ctx) }); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// withStatementTimeout sets the statement_timeout of the sessions opened
+// with connStr, a URL or key=value connection string, so that Postgres
+// cancels statements running longer than timeout.
+func withStatementTimeout(connStr string, timeout time.Duration) (string, error) {
+	if strings.HasPrefix(connStr, "postgres://") || strings.HasPrefix(connStr, "postgresql://") {
+		var err error
+		if connStr, err = pq.ParseURL(connStr); err != nil {
+			return "", fmt.Errorf("DATABASE_URL: %w", err)
+		}
+	}
+	return fmt.Sprintf("%s statement_timeout=%d", connStr, timeout.Milliseconds()), nil
+}
+
+func (db *pgDB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+func (db *pgDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := db.retry(ctx, "exec", func() (err error) {
+		res, err = db.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
+
+func (db *pgDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db *pgDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := db.retry(ctx, "query", func() (err error) {
+		rows, err = db.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (db *pgDB) QueryRow(query string, args ...any) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext retries on the error of running the query; errors
+// scanning its row are the caller's.
+func (db *pgDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	var row *sql.Row
+	_ = db.retry(ctx, "query", func() error {
+		row = db.DB.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	return row
+}
+
+func (db *pgDB) Begin() (*sql.Tx, error) {
+	return db.BeginTx(context.Background(), nil)
+}
+
+func (db *pgDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := db.retry(ctx, "begin", func() (err error) {
+		tx, err = db.DB.BeginTx(ctx, opts)
+		return err
+	})
+	return tx, err
+}
+
+// retry calls fn until it succeeds, fails with an error that is not
+// retryable, or has been called db.attempts times, sleeping with
+// exponential backoff and jitter in between.
+func (db *pgDB) retry(ctx context.Context, operation string, fn func() error) error {
+	err := fn()
+	backoff := db.baseDelay
+	for attempt := 1; attempt < db.attempts && retryable(err); attempt++ {
+		// Spread out the retries of concurrent requests.
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		backoff = min(backoff*2, db.maxDelay)
+		slog.Warn("retrying database operation", "operation", operation, "attempt", attempt, "delay", delay, "err", err)
+		dbRetries.WithLabelValues(operation).Inc()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = fn()
+	}
+	if retryable(err) {
+		dbRetriesExhausted.WithLabelValues(operation).Inc()
+	}
+	return err
+}
+
+// retryable reports whether err guarantees that the failed operation had
+// no effect and may succeed if tried again: the connection was found
+// broken before use, the database refused it while starting, stopping or
+// failing over, or aborted it for a serialization conflict.
+func retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case serializationFailure, deadlockDetected, readOnlyTransaction, adminShutdown, crashShutdown, cannotConnectNow:
+			return true
+		}
+		return pqErr.Code.Class() == connectionException
+	}
+	// Failing to dial means nothing was sent. Other network errors may
+	// come after a statement ran, so it is not safe to run it again.
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Fraud check verdicts.
+const (
+	FraudAllow  = "allow"
+	FraudReview = "review"
+	FraudBlock  = "block"
+)
+
+// Kinds of transaction screened by a FraudChecker.
+const (
+	FraudTransfer   = "transfer"
+	FraudWithdrawal = "withdrawal"
+)
+
+var (
+	// ErrFraudSuspected is returned when a fraud check refuses a transaction.
+	ErrFraudSuspected = errors.New("transaction refused by fraud check")
+	// ErrFraudCheckUnavailable is returned when the fraud checker fails and
+	// is not configured to fail open.
+	ErrFraudCheckUnavailable = errors.New("fraud check unavailable")
+)
+
+// Transaction is what a FraudChecker sees of a transfer or withdrawal
+// before it is executed.
+type Transaction struct {
+	Kind      string `json:"kind"`
+	AccountID int    `json:"accountId"`
+	// ToAccount is the destination of a transfer.
+	ToAccount int   `json:"toAccount,omitempty"`
+	Amount    int64 `json:"amount"`
+	// Velocity counts transfers from the account within VelocityWindow.
+	Velocity       int           `json:"velocity"`
+	VelocityWindow time.Duration `json:"-"`
+	// ClientIP and Country locate the caller, taken from the request
+	// headers or gRPC metadata when a proxy sets them.
+	ClientIP  string    `json:"clientIp,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// MarshalJSON reports the velocity window in seconds.
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	type plain Transaction
+	return json.Marshal(struct {
+		plain
+		VelocityWindowSeconds int64 `json:"velocityWindowSeconds"`
+	}{plain(t), int64(t.VelocityWindow / time.Second)})
+}
+
+// FraudVerdict is a FraudChecker's decision on a transaction.
+type FraudVerdict struct {
+	Decision string   `json:"decision"`
+	Score    float64  `json:"score,omitempty"`
+	Reasons  []string `json:"reasons,omitempty"`
+}
+
+func (v FraudVerdict) reason() string {
+	if len(v.Reasons) == 0 {
+		return "flagged by fraud check"
+	}
+	return strings.Join(v.Reasons, "; ")
+}
+
+// FraudChecker screens transfers and withdrawals before they execute.
+// Transfers to review are held for an operator like those over the
+// velocity rule; withdrawals cannot be held, so review refuses them too.
+type FraudChecker interface {
+	Check(ctx context.Context, tx Transaction) (FraudVerdict, error)
+}
+
+// RuleFraudChecker is the built-in FraudChecker. Zero fields disable their
+// rule, so the zero checker allows everything.
+type RuleFraudChecker struct {
+	// BlockAmount refuses transactions of at least this amount.
+	BlockAmount int64
+	// ReviewAmount sends transactions of at least this amount to review.
+	ReviewAmount int64
+	// MaxVelocity sends transactions to review once the account made this
+	// many transfers within the velocity window.
+	MaxVelocity int
+	// BlockedCountries refuses callers located in these ISO country codes.
+	BlockedCountries []string
+}
+
+func (c RuleFraudChecker) Check(_ context.Context, tx Transaction) (FraudVerdict, error) {
+	verdict := FraudVerdict{Decision: FraudAllow}
+	flag := func(decision, reason string) {
+		if verdict.Decision != FraudBlock {
+			verdict.Decision = decision
+		}
+		verdict.Reasons = append(verdict.Reasons, reason)
+	}
+	for _, country := range c.BlockedCountries {
+		if tx.Country != "" && strings.EqualFold(tx.Country, country) {
+			flag(FraudBlock, fmt.Sprintf("caller located in blocked country %s", strings.ToUpper(tx.Country)))
+		}
+	}
+	switch {
+	case c.BlockAmount > 0 && tx.Amount >= c.BlockAmount:
+		flag(FraudBlock, fmt.Sprintf("amount %d is at least %d", tx.Amount, c.BlockAmount))
+	case c.ReviewAmount > 0 && tx.Amount >= c.ReviewAmount:
+		flag(FraudReview, fmt.Sprintf("amount %d is at least %d", tx.Amount, c.ReviewAmount))
+	}
+	if c.MaxVelocity > 0 && tx.Velocity >= c.MaxVelocity {
+		flag(FraudReview, fmt.Sprintf("%d transfers in the last %s", tx.Velocity, tx.VelocityWindow))
+	}
+	return verdict, nil
+}
+
+// HTTPFraudChecker asks an external scoring service. It POSTs the
+// Transaction as JSON to URL and expects a FraudVerdict back.
+type HTTPFraudChecker struct {
+	URL    string
+	Client *http.Client
+}
+
+func (c *HTTPFraudChecker) Check(ctx context.Context, tx Transaction) (FraudVerdict, error) {
+	var verdict FraudVerdict
+	body, err := json.Marshal(tx)
+	if err != nil {
+		return verdict, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return verdict, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return verdict, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return verdict, fmt.Errorf("fraud scorer returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return verdict, fmt.Errorf("fraud scorer response: %w", err)
+	}
+	switch verdict.Decision {
+	case FraudAllow, FraudReview, FraudBlock:
+		return verdict, nil
+	}
+	return verdict, fmt.Errorf("fraud scorer returned unknown decision %q", verdict.Decision)
+}
+
+// FraudConfig wires a FraudChecker into the API server.
+type FraudConfig struct {
+	Checker FraudChecker
+	// VelocityWindow is the window Transaction.Velocity counts over.
+	VelocityWindow time.Duration
+	// CountryHeader names the header or gRPC metadata key carrying the
+	// caller's country, as set by a CDN or load balancer.
+	CountryHeader string
+	// FailOpen allows transactions when the checker fails instead of
+	// refusing them.
+	FailOpen bool
+}
+
+// fraudFromEnv configures fraud checks from GOBANK_FRAUD_CHECKER: "rules"
+// (the default) uses GOBANK_FRAUD_BLOCK_AMOUNT, GOBANK_FRAUD_REVIEW_AMOUNT,
+// GOBANK_FRAUD_MAX_VELOCITY and GOBANK_FRAUD_BLOCKED_COUNTRIES and is off
+// when none are set; "http" calls GOBANK_FRAUD_URL within
+// GOBANK_FRAUD_TIMEOUT; "off" disables checks. GOBANK_FRAUD_VELOCITY_WINDOW,
+// GOBANK_FRAUD_COUNTRY_HEADER and GOBANK_FRAUD_FAIL_OPEN apply to both.
+func fraudFromEnv() (FraudConfig, error) {
+	cfg := FraudConfig{VelocityWindow: time.Hour, CountryHeader: "X-Client-Country"}
+	if v := os.Getenv("GOBANK_FRAUD_VELOCITY_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, errors.New("GOBANK_FRAUD_VELOCITY_WINDOW must be a positive duration")
+		}
+		cfg.VelocityWindow = d
+	}
+	if v := os.Getenv("GOBANK_FRAUD_COUNTRY_HEADER"); v != "" {
+		cfg.CountryHeader = v
+	}
+	var err error
+	if cfg.FailOpen, err = envBool("GOBANK_FRAUD_FAIL_OPEN"); err != nil {
+		return cfg, err
+	}
+
+	switch kind := os.Getenv("GOBANK_FRAUD_CHECKER"); kind {
+	case "off":
+	case "", "rules":
+		var rules RuleFraudChecker
+		for _, a := range []struct {
+			name string
+			dst  *int64
+		}{
+			{"GOBANK_FRAUD_BLOCK_AMOUNT", &rules.BlockAmount},
+			{"GOBANK_FRAUD_REVIEW_AMOUNT", &rules.ReviewAmount},
+		} {
+			if v := os.Getenv(a.name); v != "" {
+				if *a.dst, err = strconv.ParseInt(v, 10, 64); err != nil || *a.dst <= 0 {
+					return cfg, fmt.Errorf("%s must be a positive integer", a.name)
+				}
+			}
+		}
+		if v := os.Getenv("GOBANK_FRAUD_MAX_VELOCITY"); v != "" {
+			if rules.MaxVelocity, err = strconv.Atoi(v); err != nil || rules.MaxVelocity <= 0 {
+				return cfg, errors.New("GOBANK_FRAUD_MAX_VELOCITY must be a positive integer")
+			}
+		}
+		for _, c := range strings.Split(os.Getenv("GOBANK_FRAUD_BLOCKED_COUNTRIES"), ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				rules.BlockedCountries = append(rules.BlockedCountries, c)
+			}
+		}
+		if rules.BlockAmount > 0 || rules.ReviewAmount > 0 || rules.MaxVelocity > 0 || len(rules.BlockedCountries) > 0 {
+			cfg.Checker = rules
+		}
+	case "http":
+		url := os.Getenv("GOBANK_FRAUD_URL")
+		if url == "" {
+			return cfg, errors.New("GOBANK_FRAUD_URL is required when GOBANK_FRAUD_CHECKER is http")
+		}
+		timeout := 2 * time.Second
+		if v := os.Getenv("GOBANK_FRAUD_TIMEOUT"); v != "" {
+			if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 {
+				return cfg, errors.New("GOBANK_FRAUD_TIMEOUT must be a positive duration")
+			}
+		}
+		cfg.Checker = &HTTPFraudChecker{URL: url, Client: &http.Client{Timeout: timeout}}
+	default:
+		return cfg, fmt.Errorf("GOBANK_FRAUD_CHECKER must be rules, http or off, got %q", kind)
+	}
+	return cfg, nil
+}
+
+// clientIP returns the address an HTTP request comes from. The first
+// X-Forwarded-For address wins over the peer address.
+func clientIP(r *http.Request) string {
+	ip, _, _ := strings.Cut(r.Header.Get("X-Forwarded-For"), ",")
+	if ip = strings.TrimSpace(ip); ip == "" {
+		ip, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	return ip
+}
+
+// httpCaller fills in where an HTTP request comes from.
+func (c FraudConfig) httpCaller(r *http.Request, tx *Transaction) {
+	tx.ClientIP = clientIP(r)
+	tx.Country = r.Header.Get(c.CountryHeader)
+	tx.UserAgent = r.UserAgent()
+}
+
+// grpcClientIP returns the address a gRPC call comes from. The first
+// x-forwarded-for address wins over the peer address.
+func grpcClientIP(ctx context.Context) string {
+	var ip string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("x-forwarded-for"); len(v) > 0 {
+		ip, _, _ = strings.Cut(v[0], ",")
+		ip = strings.TrimSpace(ip)
+	}
+	if p, ok := peer.FromContext(ctx); ok && ip == "" {
+		ip, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+	return ip
+}
+
+// grpcCaller fills in where a gRPC call comes from, reading the same
+// headers from the incoming metadata.
+func (c FraudConfig) grpcCaller(ctx context.Context, tx *Transaction) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	tx.ClientIP = grpcClientIP(ctx)
+	tx.Country = first(c.CountryHeader)
+	tx.UserAgent = first("user-agent")
+}
+
+// screen runs the fraud check on tx and returns the verdict, or an error
+// when the transaction must not go ahead. A review verdict is returned
+// without error only for transfers, which the caller holds.
+func (s *APIServer) screen(ctx context.Context, tx Transaction) (FraudVerdict, error) {
+	allow := FraudVerdict{Decision: FraudAllow}
+	if s.fraud.Checker == nil {
+		return allow, nil
+	}
+	tx.At = time.Now().UTC()
+	tx.VelocityWindow = s.fraud.VelocityWindow
+	if s.holds != nil {
+		n, err := s.holds.CountTransfersSince(tx.AccountID, tx.At.Add(-tx.VelocityWindow))
+		if err != nil {
+			return allow, err
+		}
+		tx.Velocity = n
+	}
+
+	verdict, err := s.fraud.Checker.Check(ctx, tx)
+	if err != nil {
+		if s.fraud.FailOpen {
+			slog.Warn("fraud check failed, allowing transaction", "kind", tx.Kind, "account_id", tx.AccountID, "error", err)
+			return allow, nil
+		}
+		slog.Error("fraud check failed", "kind", tx.Kind, "account_id", tx.AccountID, "error", err)
+		return allow, &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: ErrFraudCheckUnavailable}
+	}
+	fraudChecks.WithLabelValues(tx.Kind, verdict.Decision).Inc()
+	if verdict.Decision == FraudAllow {
+		return verdict, nil
+	}
+	slog.Warn("transaction flagged by fraud check", "kind", tx.Kind, "account_id", tx.AccountID,
+		"amount", tx.Amount, "decision", verdict.Decision, "score", verdict.Score, "reasons", verdict.Reasons,
+		"client_ip", tx.ClientIP, "country", tx.Country)
+	if verdict.Decision == FraudReview && tx.Kind == FraudTransfer && s.holds != nil {
+		return verdict, nil
+	}
+	return verdict, fmt.Errorf("%w: %s", ErrFraudSuspected, verdict.reason())
+}
+
+// holdForReview screens a transfer and holds it if the fraud check wants it
+// reviewed or it is over the velocity rule; otherwise it returns nil.
+func (s *APIServer) holdForReview(ctx context.Context, req *TransferRequest, tx Transaction) (*HeldTransfer, error) {
+	verdict, err := s.screen(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if verdict.Decision == FraudReview {
+		return s.holdTransfer(req, verdict.reason())
+	}
+	return s.holdIfTooFast(req)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gnsalok/go-projects-root/gobank/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer implements the AccountService and TransferService protos on
+// the same Storage and request validation as the REST API.
+type grpcServer struct {
+	pb.UnimplementedAccountServiceServer
+	pb.UnimplementedTransferServiceServer
+	api *APIServer
+}
+
+// NewGRPCServer creates a gRPC server with the banking services registered.
+// Every call must authenticate like REST requests do, with a bearer token
+// in the authorization metadata.
+func NewGRPCServer(api *APIServer, opts ...grpc.ServerOption) *grpc.Server {
+	srv := &grpcServer{api: api}
+	s := grpc.NewServer(append(opts, grpc.ChainUnaryInterceptor(srv.authenticate))...)
+	pb.RegisterAccountServiceServer(s, srv)
+	pb.RegisterTransferServiceServer(s, srv)
+	return s
+}
+
+// authenticate resolves the bearer token of the call to a principal, as
+// authenticated does for HTTP requests, so RPCs can authorize the caller.
+// API keys only get through to methods their scopes allow.
+func (s *grpcServer) authenticate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("authorization"); len(v) > 0 {
+		token, _ = strings.CutPrefix(v[0], "Bearer ")
+		if token == v[0] {
+			token = ""
+		}
+	}
+	p, err := s.api.authenticate(ctx, token, grpcClientIP(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if p.apiKey != nil {
+		if err := checkRouteScope(p.apiKey, info.FullMethod); err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	return handler(context.WithValue(ctx, principalKey, p), req)
+}
+
+func (s *grpcServer) CreateAccount(ctx context.Context, in *pb.CreateAccountRequest) (*pb.Account, error) {
+	req := &CreateAccountRequest{
+		FirstName: in.GetFirstName(),
+		LastName:  in.GetLastName(),
+		Currency:  in.GetCurrency(),
+		Type:      in.GetType(),
+	}
+	if err := req.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	account, err := s.api.openAccount(ctx, req)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return accountToProto(account), nil
+}
+
+func (s *grpcServer) GetAccount(ctx context.Context, in *pb.GetAccountRequest) (*pb.Account, error) {
+	if err := s.api.authorizeAccount(ctx, int(in.GetId())); err != nil {
+		return nil, toStatus(err)
+	}
+	account, err := s.api.store.GetAccountByID(int(in.GetId()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return accountToProto(account), nil
+}
+
+func (s *grpcServer) DeleteAccount(ctx context.Context, in *pb.DeleteAccountRequest) (*pb.DeleteAccountResponse, error) {
+	if err := s.api.authorizeAccount(ctx, int(in.GetId())); err != nil {
+		return nil, toStatus(err)
+	}
+	if err := s.api.store.DeleteAccount(int(in.GetId())); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.DeleteAccountResponse{}, nil
+}
+
+func (s *grpcServer) Deposit(ctx context.Context, in *pb.AmountRequest) (*pb.AccountEntry, error) {
+	return s.accountEntry(ctx, in, s.api.store.Deposit)
+}
+
+func (s *grpcServer) Withdraw(ctx context.Context, in *pb.AmountRequest) (*pb.AccountEntry, error) {
+	return s.accountEntry(ctx, in, func(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+		tx := Transaction{Kind: FraudWithdrawal, AccountID: id, Amount: amount}
+		s.api.fraud.grpcCaller(ctx, &tx)
+		if _, err := s.api.screen(ctx, tx); err != nil {
+			return nil, err
+		}
+		return s.api.store.Withdraw(id, amount, idempotencyKey)
+	})
+}
+
+// accountEntry applies op to the account of in if the caller may operate
+// on it.
+func (s *grpcServer) accountEntry(ctx context.Context, in *pb.AmountRequest,
+	op func(id int, amount int64, idempotencyKey string) (*AccountEntry, error)) (*pb.AccountEntry, error) {
+	if err := s.api.authorizeAccount(ctx, int(in.GetAccountId())); err != nil {
+		return nil, toStatus(err)
+	}
+	if len(in.GetIdempotencyKey()) > 255 {
+		return nil, status.Error(codes.InvalidArgument, "idempotency_key must be at most 255 characters")
+	}
+	req := &AmountRequest{Amount: in.GetAmount()}
+	if err := req.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	entry, err := op(int(in.GetAccountId()), req.Amount, in.GetIdempotencyKey())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.AccountEntry{
+		Id:             entry.ID,
+		AccountId:      int32(entry.AccountID),
+		Kind:           entry.Kind,
+		Amount:         entry.Amount,
+		BalanceAfter:   entry.BalanceAfter,
+		IdempotencyKey: entry.IdempotencyKey,
+		Replayed:       entry.Replayed,
+		CreatedAt:      timestamppb.New(entry.CreatedAt),
+	}, nil
+}
+
+func (s *grpcServer) Transfer(ctx context.Context, in *pb.TransferRequest) (*pb.TransferRecord, error) {
+	req := &TransferRequest{
+		FromAccount: int(in.GetFromAccount()),
+		ToAccount:   int(in.GetToAccount()),
+		Amount:      in.GetAmount(),
+	}
+	if err := req.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// Only the source account must belong to the caller.
+	if err := s.api.authorizeAccount(ctx, req.FromAccount); err != nil {
+		return nil, toStatus(err)
+	}
+	tx := Transaction{Kind: FraudTransfer, AccountID: req.FromAccount, ToAccount: req.ToAccount, Amount: req.Amount}
+	s.api.fraud.grpcCaller(ctx, &tx)
+	held, err := s.api.holdForReview(ctx, req, tx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if held != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "transfer held for review as held transfer %d: %s", held.ID, held.Reason)
+	}
+	pending, err := s.api.requestApproval(ctx, req)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if pending != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "transfer awaits %d approvals as pending transfer %d",
+			pending.RequiredApprovals, pending.ID)
+	}
+	record, err := s.api.store.Transfer(req.FromAccount, req.ToAccount, req.Amount)
+	observeTransfer(record, err)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.TransferRecord{
+		Id:          record.ID,
+		FromAccount: int32(record.FromAccount),
+		ToAccount:   int32(record.ToAccount),
+		Debit:       moneyToProto(record.Debit),
+		Credit:      moneyToProto(record.Credit),
+		CreatedAt:   timestamppb.New(record.CreatedAt),
+	}, nil
+}
+
+func moneyToProto(m Money) *pb.Money {
+	return &pb.Money{Amount: m.Amount, Currency: string(m.Currency)}
+}
+
+func accountToProto(a *Account) *pb.Account {
+	return &pb.Account{
+		Id:                  int32(a.ID),
+		FirstName:           a.FirstName,
+		LastName:            a.LastName,
+		AccountNumber:       a.AccountNo,
+		Balance:             moneyToProto(a.BalanceMoney()),
+		OverdraftLimit:      a.OverdraftLimit,
+		Type:                a.Type,
+		InterestRateBps:     int32(a.InterestRateBps),
+		Frozen:              a.Status == AccountFrozen,
+		Status:              a.Status,
+		DailyTransferLimit:  a.DailyTransferLimit,
+		WeeklyTransferLimit: a.WeeklyTransferLimit,
+		CreatedAt:           timestamppb.New(a.CreatedAt),
+	}
+}
+
+// httpToCode translates the statuses chosen by errorResponse so both APIs
+// classify storage errors from the same errorMappings table.
+var httpToCode = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusUnprocessableEntity: codes.FailedPrecondition,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	httpStatus, body := errorResponse(err)
+	code, ok := httpToCode[httpStatus]
+	if !ok {
+		return status.Error(codes.Internal, body.Message)
+	}
+	return status.Error(code, body.Message)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// localeFS holds one message catalog per language, named by its BCP 47 tag.
+//
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// defaultLanguage is used when Accept-Language matches no catalog. Its
+// catalog keeps the English error messages as written, with their details,
+// and formats amounts as Money.String does.
+const defaultLanguage = "en"
+
+// Locale is the message catalog and number format of one language.
+type Locale struct {
+	Tag string `json:"-"`
+	// Decimal separates major from minor units; Group, if not empty,
+	// separates thousands.
+	Decimal string `json:"decimal"`
+	Group   string `json:"group"`
+	// Money places a formatted amount and its currency code, as in
+	// "{amount} {currency}".
+	Money string `json:"money"`
+	// Errors translates error messages by error code. Codes without a
+	// translation keep the English message.
+	Errors map[string]string `json:"errors"`
+	// Statement holds the labels and line descriptions of statements,
+	// falling back to the default catalog.
+	Statement map[string]string `json:"statement"`
+
+	fallback *Locale
+}
+
+var (
+	locales       = mustLoadLocales(localeFS)
+	localeMatcher language.Matcher
+	localeTags    []string
+)
+
+// mustLoadLocales reads the embedded catalogs, which must include the
+// default language, and builds the matcher for Accept-Language.
+func mustLoadLocales(fsys fs.FS) map[string]*Locale {
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]*Locale, len(files))
+	var order []string
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			panic(err)
+		}
+		loc := new(Locale)
+		if err := json.Unmarshal(data, loc); err != nil {
+			panic(fmt.Sprintf("locale %s: %v", file, err))
+		}
+		loc.Tag = strings.TrimSuffix(path.Base(file), ".json")
+		loaded[loc.Tag] = loc
+		order = append(order, loc.Tag)
+	}
+	def, ok := loaded[defaultLanguage]
+	if !ok {
+		panic("no catalog for the default language " + defaultLanguage)
+	}
+	// The matcher falls back to its first tag.
+	tags := []language.Tag{language.Make(defaultLanguage)}
+	localeTags = []string{defaultLanguage}
+	for _, tag := range order {
+		if tag == defaultLanguage {
+			continue
+		}
+		loaded[tag].fallback = def
+		tags = append(tags, language.Make(tag))
+		localeTags = append(localeTags, tag)
+	}
+	localeMatcher = language.NewMatcher(tags)
+	return loaded
+}
+
+// localeFor picks the catalog best matching the request's Accept-Language.
+func localeFor(r *http.Request) *Locale {
+	_, i := language.MatchStrings(localeMatcher, r.Header.Get("Accept-Language"))
+	return locales[localeTags[i]]
+}
+
+// localizeError translates the message of body, keeping the English one as
+// its detail.
+func (l *Locale) localizeError(body *ErrorBody) {
+	if msg, ok := l.Errors[body.Code]; ok {
+		body.Detail = body.Message
+		body.Message = msg
+	}
+}
+
+// text returns the statement label key formatted with args.
+func (l *Locale) text(key string, args ...any) string {
+	format, ok := l.Statement[key]
+	if !ok && l.fallback != nil {
+		format, ok = l.fallback.Statement[key]
+	}
+	if !ok {
+		format = key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// describeLine describes a statement line in the locale's language.
+func (l *Locale) describeLine(line StatementLine) string {
+	switch line.Kind {
+	case EntryDeposit, EntryWithdrawal, EntryInterest:
+		return l.text(line.Kind)
+	case "transfer_in", "transfer_out":
+		return l.text(line.Kind, line.Counterparty)
+	}
+	return line.Description
+}
+
+// FormatAmount formats minor units in currency as a number, with thousands
+// grouped if grouped is set.
+func (l *Locale) FormatAmount(amount int64, currency Currency, grouped bool) string {
+	exp := currencyExponents[currency]
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	unit := int64(math.Pow10(exp))
+	whole := strconv.FormatInt(amount/unit, 10)
+	if grouped && l.Group != "" {
+		var b strings.Builder
+		for i, d := range whole {
+			if i > 0 && (len(whole)-i)%3 == 0 {
+				b.WriteString(l.Group)
+			}
+			b.WriteRune(d)
+		}
+		whole = b.String()
+	}
+	if exp == 0 {
+		return sign + whole
+	}
+	return fmt.Sprintf("%s%s%s%0*d", sign, whole, l.Decimal, exp, amount%unit)
+}
+
+// FormatMoney formats minor units in currency with grouping and the code.
+func (l *Locale) FormatMoney(amount int64, currency Currency) string {
+	return strings.NewReplacer("{amount}", l.FormatAmount(amount, currency, true),
+		"{currency}", string(currency)).Replace(l.Money)
+}
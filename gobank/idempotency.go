@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrIdempotencyInProgress is returned when a request is retried while
+// the original with the same Idempotency-Key is still being processed.
+var ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+
+// IdempotentReplayedHeader marks responses replayed from the idempotency store.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// idempotencyLock is how long a claimed key blocks retries before another
+// request may take it over, in case the original request's process died.
+const idempotencyLock = time.Minute
+
+// StoredResponse is a response saved for replay.
+type StoredResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyStore persists responses by idempotency key.
+type IdempotencyStore interface {
+	// Claim reserves key for a request with fingerprint. It returns the
+	// stored response if the key was already completed, ErrIdempotencyMismatch
+	// if it was used for a different request and ErrIdempotencyInProgress
+	// if the original is still running.
+	Claim(ctx context.Context, key, fingerprint string, ttl time.Duration) (*StoredResponse, error)
+	Complete(ctx context.Context, key string, resp *StoredResponse) error
+	// Release drops an unfinished claim so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// requestFingerprint identifies a request by caller, method, path and body
+// so a key reused for something else, or by someone else, is rejected
+// rather than replayed.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n%s\n", r.Method, r.URL.RequestURI(), hashToken(r.Header.Get("Authorization")))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseCapture tees the response so it can be stored after the handler returns.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *responseCapture) Unwrap() http.ResponseWriter { return c.ResponseWriter }
+
+// idempotent is router middleware for POST, PUT, PATCH and DELETE requests
+// carrying an Idempotency-Key. The first request's response is stored and
+// replayed for retries within the TTL; 5xx responses are not stored so
+// failed requests can be retried.
+func (s *APIServer) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if s.idempotency == nil || key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			writeError(w, r, badRequest(fmt.Errorf("%s must be at most 255 characters", IdempotencyKeyHeader)))
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			writeError(w, r, badRequest(fmt.Errorf("invalid request body: %w", err)))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		stored, err := s.idempotency.Claim(r.Context(), key, requestFingerprint(r, body), s.idempotencyTTL)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if stored != nil {
+			w.Header().Set("Content-Type", stored.ContentType)
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		capture := &responseCapture{ResponseWriter: w}
+		completed := false
+		defer func() {
+			// Runs on panic too, so an aborted request does not hold the key.
+			if completed {
+				return
+			}
+			if err := s.idempotency.Release(context.WithoutCancel(r.Context()), key); err != nil {
+				loggerFrom(r.Context()).Error("release idempotency key", "error", err)
+			}
+		}()
+		next.ServeHTTP(capture, r)
+		if capture.status == 0 {
+			capture.status = http.StatusOK
+		}
+		if capture.status >= 500 {
+			return
+		}
+		resp := &StoredResponse{
+			Status:      capture.status,
+			ContentType: capture.Header().Get("Content-Type"),
+			Body:        capture.body.Bytes(),
+		}
+		if err := s.idempotency.Complete(context.WithoutCancel(r.Context()), key, resp); err != nil {
+			loggerFrom(r.Context()).Error("store idempotent response", "error", err)
+			return
+		}
+		completed = true
+	})
+}
+
+// Claim implements IdempotencyStore. Expired keys and stale claims are
+// taken over in the same statement that claims a new key.
+func (s *PostgresStore) Claim(ctx context.Context, key, fingerprint string, ttl time.Duration) (*StoredResponse, error) {
+	var claimed bool
+	err := s.db.QueryRowContext(ctx, `insert into idempotency_response (key, fingerprint, expires_at, locked_until)
+	values ($1, $2, now() + $3 * interval '1 second', now() + $4 * interval '1 second')
+	on conflict (key) do update set fingerprint = excluded.fingerprint, expires_at = excluded.expires_at,
+		locked_until = excluded.locked_until, status = null, content_type = null, body = null
+	where idempotency_response.expires_at < now()
+		or (idempotency_response.status is null and idempotency_response.locked_until < now())
+	returning true`, key, fingerprint, ttl.Seconds(), idempotencyLock.Seconds()).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	var storedFingerprint string
+	var status sql.NullInt32
+	resp := new(StoredResponse)
+	err = s.db.QueryRowContext(ctx, `select fingerprint, status, coalesce(content_type, ''), body
+	from idempotency_response where key = $1`, key).Scan(&storedFingerprint, &status, &resp.ContentType, &resp.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released between the two statements; let the client retry.
+		return nil, ErrIdempotencyInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case storedFingerprint != fingerprint:
+		return nil, ErrIdempotencyMismatch
+	case !status.Valid:
+		return nil, ErrIdempotencyInProgress
+	}
+	resp.Status = int(status.Int32)
+	return resp, nil
+}
+
+func (s *PostgresStore) Complete(ctx context.Context, key string, resp *StoredResponse) error {
+	_, err := s.db.ExecContext(ctx, `update idempotency_response
+	set status = $2, content_type = $3, body = $4, locked_until = null where key = $1`,
+		key, resp.Status, resp.ContentType, resp.Body)
+	return err
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `delete from idempotency_response where key = $1 and status is null`, key)
+	return err
+}
+
+// PurgeIdempotency deletes expired responses.
+func (s *PostgresStore) PurgeIdempotency(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `delete from idempotency_response where expires_at < now()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,503 @@
+//go:build integration
+
+// Integration tests run the HTTP API against a real Postgres:
+//
+//	go test -tags=integration -v ./...
+//
+// They start a throwaway postgres container with docker unless
+// GOBANK_TEST_DATABASE_URL points at a database to use instead. That
+// database's public schema is dropped before every test, so never point it
+// at data you want to keep.
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "integration-admin-token"
+
+// testDatabaseURL is set by TestMain.
+var testDatabaseURL string
+
+func TestMain(m *testing.M) {
+	url := os.Getenv("GOBANK_TEST_DATABASE_URL")
+	cleanup := func() {}
+	if url == "" {
+		var err error
+		url, cleanup, err = startPostgres()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "integration: start postgres:", err)
+			os.Exit(1)
+		}
+	}
+	testDatabaseURL = url
+	code := m.Run()
+	cleanup()
+	os.Exit(code)
+}
+
+// startPostgres runs a postgres container on a random local port and waits
+// until it accepts connections.
+func startPostgres() (url string, cleanup func(), err error) {
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"-e", "POSTGRES_PASSWORD=gobank", "-p", "127.0.0.1::5432", "postgres:16-alpine").Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("docker run: %w", err)
+	}
+	id := strings.TrimSpace(string(out))
+	cleanup = func() { exec.Command("docker", "rm", "-f", id).Run() }
+
+	out, err = exec.Command("docker", "port", id, "5432/tcp").Output()
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("docker port: %w", err)
+	}
+	// e.g. 127.0.0.1:55012, possibly followed by an IPv6 mapping.
+	addr := strings.Fields(string(out))[0]
+	host, port, _ := strings.Cut(addr, ":")
+	url = fmt.Sprintf("host=%s port=%s user=postgres password=gobank dbname=postgres sslmode=disable", host, port)
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	defer db.Close()
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if err = db.Ping(); err == nil {
+			return url, cleanup, nil
+		}
+		if time.Now().After(deadline) {
+			cleanup()
+			return "", nil, fmt.Errorf("postgres not ready: %w", err)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// testBank is an APIServer over a freshly migrated database, served by
+// httptest.
+type testBank struct {
+	t     *testing.T
+	store *PostgresStore
+	srv   *httptest.Server
+}
+
+func newTestBank(t *testing.T) *testBank {
+	t.Helper()
+	t.Setenv("DATABASE_URL", testDatabaseURL)
+	store, err := NewPostgresStore(DefaultDBConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.db.Exec(`drop schema public cascade; create schema public`); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Init(); err != nil {
+		t.Fatal(err)
+	}
+	// Concurrent transfers need more connections than the driver's idle default.
+	store.db.SetMaxIdleConns(20)
+
+	s := NewAPIServer(DefaultServerConfig(), store)
+	s.adminToken = testAdminToken
+	s.idempotency = store
+	s.idempotencyTTL = time.Hour
+	srv := httptest.NewServer(s.server.Handler)
+	t.Cleanup(func() {
+		srv.Close()
+		store.Close()
+	})
+	return &testBank{t: t, store: store, srv: srv}
+}
+
+// do sends body as JSON with token and decodes the envelope's data into
+// out, if given. It returns the status and the error code, if any.
+func (b *testBank) do(method, path, token string, body, out any, header ...string) (int, string) {
+	b.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			b.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, b.srv.URL+path, &buf)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := b.srv.Client().Do(req)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var env struct {
+		Data  json.RawMessage `json:"data"`
+		Error *ErrorBody      `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		b.t.Fatalf("%s %s: decode response: %v", method, path, err)
+	}
+	if env.Error != nil {
+		return resp.StatusCode, env.Error.Code
+	}
+	if out != nil {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			b.t.Fatalf("%s %s: decode data: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode, ""
+}
+
+// openAccount opens an account as the operator and deposits balance.
+func (b *testBank) openAccount(name string, balance int64) *Account {
+	b.t.Helper()
+	acc := new(Account)
+	if status, code := b.do(http.MethodPost, "/account", testAdminToken,
+		CreateAccountRequest{FirstName: name, LastName: "Test"}, acc); status != http.StatusCreated {
+		b.t.Fatalf("create account: %d %s", status, code)
+	}
+	if balance > 0 {
+		if status, code := b.do(http.MethodPost, fmt.Sprintf("/account/%d/deposit", acc.ID), testAdminToken,
+			AmountRequest{Amount: balance}, nil); status != http.StatusOK {
+			b.t.Fatalf("deposit: %d %s", status, code)
+		}
+	}
+	return acc
+}
+
+func (b *testBank) balance(id int) int64 {
+	b.t.Helper()
+	acc := new(Account)
+	if status, code := b.do(http.MethodGet, fmt.Sprintf("/account/%d", id), testAdminToken, nil, acc); status != http.StatusOK {
+		b.t.Fatalf("get account %d: %d %s", id, status, code)
+	}
+	return acc.Balance
+}
+
+// checkLedger asserts that every balance equals the account's deposits,
+// interest and incoming transfers less its withdrawals and outgoing transfers.
+func (b *testBank) checkLedger() {
+	b.t.Helper()
+	rows, err := b.store.db.Query(`select a.id, a.balance,
+		coalesce((select sum(case kind when 'withdrawal' then -amount else amount end)
+			from account_entry e where e.account_id = a.id), 0)
+		+ coalesce((select sum(credit_amount) from transfer t where t.to_account = a.id), 0)
+		- coalesce((select sum(amount) from transfer t where t.from_account = a.id), 0)
+	from account a order by a.id`)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var balance, ledger int64
+		if err := rows.Scan(&id, &balance, &ledger); err != nil {
+			b.t.Fatal(err)
+		}
+		if balance != ledger {
+			b.t.Errorf("account %d: balance %d, ledger says %d", id, balance, ledger)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		b.t.Fatal(err)
+	}
+}
+
+func TestIntegrationConcurrentTransfers(t *testing.T) {
+	b := newTestBank(t)
+	const (
+		accounts  = 5
+		initial   = 10_000
+		workers   = 20
+		perWorker = 25
+	)
+	var ids []int
+	for i := 0; i < accounts; i++ {
+		ids = append(ids, b.openAccount(fmt.Sprintf("Account%d", i), initial).ID)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		refused   int
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for i := 0; i < perWorker; i++ {
+				from := ids[rng.Intn(len(ids))]
+				to := ids[rng.Intn(len(ids))]
+				if from == to {
+					continue
+				}
+				req := TransferRequest{FromAccount: from, ToAccount: to, Amount: int64(1 + rng.Intn(3_000))}
+				status, code := b.do(http.MethodPost, "/transfer", testAdminToken, req, nil)
+				mu.Lock()
+				switch {
+				case status == http.StatusOK:
+					succeeded++
+				case code == CodeInsufficientFunds:
+					refused++
+				default:
+					t.Errorf("transfer %d -> %d: %d %s", from, to, status, code)
+				}
+				mu.Unlock()
+			}
+		}(int64(w))
+	}
+	wg.Wait()
+	t.Logf("%d transfers succeeded, %d refused for insufficient funds", succeeded, refused)
+
+	var total int64
+	for _, id := range ids {
+		balance := b.balance(id)
+		if balance < 0 {
+			t.Errorf("account %d overdrawn: %d", id, balance)
+		}
+		total += balance
+	}
+	if want := int64(accounts * initial); total != want {
+		t.Errorf("total balance %d, want %d", total, want)
+	}
+	var recorded int
+	if err := b.store.db.QueryRow(`select count(*) from transfer`).Scan(&recorded); err != nil {
+		t.Fatal(err)
+	}
+	if recorded != succeeded {
+		t.Errorf("%d transfers recorded, %d succeeded", recorded, succeeded)
+	}
+	b.checkLedger()
+}
+
+// Transfers in opposite directions between the same accounts lock both
+// rows; they must serialize rather than deadlock.
+func TestIntegrationOpposingTransfers(t *testing.T) {
+	b := newTestBank(t)
+	a := b.openAccount("Alice", 50_000)
+	c := b.openAccount("Carol", 50_000)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		from, to := a.ID, c.ID
+		if i%2 == 1 {
+			from, to = to, from
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, code := b.do(http.MethodPost, "/transfer", testAdminToken,
+				TransferRequest{FromAccount: from, ToAccount: to, Amount: 100}, nil)
+			if status != http.StatusOK {
+				t.Errorf("transfer %d -> %d: %d %s", from, to, status, code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := b.balance(a.ID)+b.balance(c.ID), int64(100_000); got != want {
+		t.Errorf("total balance %d, want %d", got, want)
+	}
+	b.checkLedger()
+}
+
+// Concurrent withdrawals may not overdraw the account between them.
+func TestIntegrationConcurrentWithdrawals(t *testing.T) {
+	b := newTestBank(t)
+	acc := b.openAccount("Dave", 1_000)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	withdrawn := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, code := b.do(http.MethodPost, fmt.Sprintf("/account/%d/withdraw", acc.ID), testAdminToken,
+				AmountRequest{Amount: 100}, nil)
+			switch {
+			case status == http.StatusOK:
+				mu.Lock()
+				withdrawn++
+				mu.Unlock()
+			case code != CodeInsufficientFunds:
+				t.Errorf("withdraw: %d %s", status, code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if withdrawn != 10 {
+		t.Errorf("%d withdrawals succeeded, want 10", withdrawn)
+	}
+	if balance := b.balance(acc.ID); balance != 0 {
+		t.Errorf("balance %d, want 0", balance)
+	}
+	b.checkLedger()
+}
+
+// Retries of a deposit with the same Idempotency-Key, even concurrent ones,
+// credit the account once.
+func TestIntegrationIdempotentDeposit(t *testing.T) {
+	b := newTestBank(t)
+	acc := b.openAccount("Erin", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, code := b.do(http.MethodPost, fmt.Sprintf("/account/%d/deposit", acc.ID), testAdminToken,
+				AmountRequest{Amount: 500}, nil, IdempotencyKeyHeader, "deposit-erin-1")
+			// A retry racing the first request is told to try again later.
+			if status != http.StatusOK && status != http.StatusConflict {
+				t.Errorf("deposit: %d %s", status, code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if balance := b.balance(acc.ID); balance != 500 {
+		t.Errorf("balance %d, want 500", balance)
+	}
+	b.checkLedger()
+}
+
+// Customers may only transfer out of accounts they own.
+func TestIntegrationTransferAuthorization(t *testing.T) {
+	b := newTestBank(t)
+	var created struct {
+		Token string `json:"token"`
+	}
+	if status, code := b.do(http.MethodPost, "/customer", "",
+		CreateCustomerRequest{FirstName: "Frank", LastName: "Test", Email: "frank@example.com"}, &created); status != http.StatusCreated {
+		t.Fatalf("create customer: %d %s", status, code)
+	}
+	own := new(Account)
+	if status, code := b.do(http.MethodPost, "/account", created.Token,
+		CreateAccountRequest{FirstName: "Frank", LastName: "Test"}, own); status != http.StatusCreated {
+		t.Fatalf("create account: %d %s", status, code)
+	}
+	other := b.openAccount("Grace", 1_000)
+
+	if status, code := b.do(http.MethodPost, "/transfer", created.Token,
+		TransferRequest{FromAccount: other.ID, ToAccount: own.ID, Amount: 500}, nil); status != http.StatusForbidden {
+		t.Errorf("transfer from another customer's account: %d %s, want 403", status, code)
+	}
+	if status, code := b.do(http.MethodPost, "/transfer", "",
+		TransferRequest{FromAccount: other.ID, ToAccount: own.ID, Amount: 500}, nil); status != http.StatusUnauthorized {
+		t.Errorf("unauthenticated transfer: %d %s, want 401", status, code)
+	}
+	if balance := b.balance(other.ID); balance != 1_000 {
+		t.Errorf("balance %d, want 1000", balance)
+	}
+}
+
+// Concurrent edits of different fields of an account, and deposits racing
+// them, all survive.
+func TestIntegrationConcurrentAccountUpdates(t *testing.T) {
+	b := newTestBank(t)
+	acc := b.openAccount("Heidi", 0)
+	path := fmt.Sprintf("/account/%d", acc.ID)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			first := "Heidi"
+			if status, code := b.do(http.MethodPatch, path, testAdminToken, UpdateAccountRequest{FirstName: &first}, nil); status != http.StatusOK {
+				t.Errorf("edit first name: %d %s", status, code)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			last := "Renamed"
+			if status, code := b.do(http.MethodPatch, path, testAdminToken, UpdateAccountRequest{LastName: &last}, nil); status != http.StatusOK {
+				t.Errorf("edit last name: %d %s", status, code)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if status, code := b.do(http.MethodPost, path+"/deposit", testAdminToken, AmountRequest{Amount: 100}, nil); status != http.StatusOK {
+				t.Errorf("deposit: %d %s", status, code)
+			}
+		}()
+	}
+	daily := int64(5_000)
+	if status, code := b.do(http.MethodPut, fmt.Sprintf("/admin/account/%d/limits", acc.ID), testAdminToken,
+		LimitsRequest{DailyTransferLimit: &daily}, nil); status != http.StatusOK {
+		t.Errorf("set limits: %d %s", status, code)
+	}
+	wg.Wait()
+
+	got := new(Account)
+	if status, code := b.do(http.MethodGet, path, testAdminToken, nil, got); status != http.StatusOK {
+		t.Fatalf("get account: %d %s", status, code)
+	}
+	if got.FirstName != "Heidi" || got.LastName != "Renamed" {
+		t.Errorf("name %q %q, want Heidi Renamed", got.FirstName, got.LastName)
+	}
+	if got.DailyTransferLimit == nil || *got.DailyTransferLimit != daily {
+		t.Errorf("daily limit %v, want %d", got.DailyTransferLimit, daily)
+	}
+	if got.Balance != 1_000 {
+		t.Errorf("balance %d, want 1000", got.Balance)
+	}
+	// Every write bumped the version: 20 edits, 10 deposits and the limits.
+	if want := acc.Version + 31; got.Version != want {
+		t.Errorf("version %d, want %d", got.Version, want)
+	}
+	b.checkLedger()
+
+	// A write made from a stale read is refused.
+	if err := b.store.UpdateAccount(acc); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale update: %v, want ErrVersionConflict", err)
+	}
+}
+
+// An account that changes under every attempt gives up with a 409 after
+// accountUpdateAttempts tries.
+func TestIntegrationAccountUpdateConflict(t *testing.T) {
+	b := newTestBank(t)
+	acc := b.openAccount("Ivan", 0)
+
+	attempts := 0
+	_, err := b.store.ModifyAccount(acc.ID, func(a *Account) error {
+		attempts++
+		_, err := b.store.db.Exec(`update account set overdraft_limit = overdraft_limit + 1 where id = $1`, a.ID)
+		return err
+	})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("modify: %v, want ErrVersionConflict", err)
+	}
+	if attempts != accountUpdateAttempts {
+		t.Errorf("%d attempts, want %d", attempts, accountUpdateAttempts)
+	}
+	if status, _ := errorResponse(err); status != http.StatusConflict {
+		t.Errorf("status %d, want 409", status)
+	}
+}
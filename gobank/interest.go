@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// interestDenominator converts an annual rate in basis points into a daily
+// rate: daily interest = balance * bps / interestDenominator. Fractions of
+// a minor unit are carried to the next day rather than rounded away.
+const interestDenominator = 10_000 * 365
+
+// maxInterestRateBps caps per-account rates at 100% a year.
+const maxInterestRateBps = 10_000
+
+// ErrAccrualNotDue is returned when asked to accrue a day that has not ended.
+var ErrAccrualNotDue = errors.New("interest can only be accrued for days that have ended")
+
+// InterestRun summarizes one accrual pass.
+type InterestRun struct {
+	Through  string `json:"through"`
+	Accounts int    `json:"accounts"`
+	Days     int    `json:"days"`
+	Entries  int    `json:"entries"`
+}
+
+// InterestStore accrues interest on savings accounts up to a date.
+type InterestStore interface {
+	AccrueInterest(ctx context.Context, through time.Time) (*InterestRun, error)
+}
+
+// dailyInterest returns the interest for one day on balance at rateBps and
+// the sub-unit remainder to carry forward. Overdrawn balances earn nothing.
+func dailyInterest(balance int64, rateBps int, carry int64) (amount, remainder int64) {
+	if balance <= 0 || rateBps <= 0 {
+		return 0, carry
+	}
+	n := balance*int64(rateBps) + carry
+	return n / interestDenominator, n % interestDenominator
+}
+
+// InterestAccrual runs accrual on a schedule and on demand. Each account
+// remembers the last day it was accrued for, so a run after downtime
+// catches up on every missed day and repeated runs are harmless.
+type InterestAccrual struct {
+	store InterestStore
+	now   func() time.Time
+	// mu keeps the scheduled and manual runs from overlapping.
+	mu sync.Mutex
+}
+
+func NewInterestAccrual(store InterestStore) *InterestAccrual {
+	return &InterestAccrual{store: store, now: time.Now}
+}
+
+// lastClosedDay is the most recent UTC day that has fully ended.
+func (a *InterestAccrual) lastClosedDay() time.Time {
+	y, m, d := a.now().UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+}
+
+// AccrueThrough accrues interest for every day up to and including through.
+// A zero through means the last closed day.
+func (a *InterestAccrual) AccrueThrough(ctx context.Context, through time.Time) (*InterestRun, error) {
+	last := a.lastClosedDay()
+	if through.IsZero() {
+		through = last
+	}
+	if through.After(last) {
+		return nil, fmt.Errorf("%w: %s", ErrAccrualNotDue, through.Format(time.DateOnly))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.store.AccrueInterest(ctx, through)
+}
+
+// Run accrues once at startup, to catch up on missed days, and then every
+// interval until ctx is cancelled.
+func (a *InterestAccrual) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		run, err := a.AccrueThrough(ctx, time.Time{})
+		if err != nil {
+			slog.Error("interest accrual failed", "error", err)
+		} else if run.Entries > 0 {
+			slog.Info("accrued interest", "through", run.Through, "entries", run.Entries, "accounts", run.Accounts)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// interestFromEnv reads GOBANK_INTEREST_INTERVAL (default 1h, "0" disables
+// the scheduled job) and GOBANK_SAVINGS_RATE_BPS, the annual rate given to
+// new savings accounts.
+func interestFromEnv() (interval time.Duration, rateBps int, err error) {
+	interval = time.Hour
+	if v := os.Getenv("GOBANK_INTEREST_INTERVAL"); v != "" {
+		if interval, err = time.ParseDuration(v); err != nil {
+			return 0, 0, fmt.Errorf("GOBANK_INTEREST_INTERVAL: %w", err)
+		}
+	}
+	if v := os.Getenv("GOBANK_SAVINGS_RATE_BPS"); v != "" {
+		rateBps, err = strconv.Atoi(v)
+		if err != nil || rateBps < 0 || rateBps > maxInterestRateBps {
+			return 0, 0, fmt.Errorf("GOBANK_SAVINGS_RATE_BPS must be between 0 and %d", maxInterestRateBps)
+		}
+	}
+	return interval, rateBps, nil
+}
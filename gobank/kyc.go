@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// KYC application statuses. Customers submit documents, an operator starts
+// a review, which runs the verification provider, and then approves or
+// rejects the application. Rejected customers may submit again; approval
+// is final.
+const (
+	KYCSubmitted = "submitted"
+	KYCInReview  = "in_review"
+	KYCApproved  = "approved"
+	KYCRejected  = "rejected"
+)
+
+// Verification provider decisions. Whatever the provider decides, the
+// operator makes the final call.
+const (
+	KYCCheckClear    = "clear"
+	KYCCheckConsider = "consider"
+	KYCCheckFail     = "fail"
+)
+
+// Document types a customer may submit. At least one must prove identity.
+var kycDocumentTypes = []string{"passport", "national_id", "drivers_license", "residence_permit", "proof_of_address"}
+
+var (
+	// ErrKYCNotFound is returned for customers who never submitted KYC.
+	ErrKYCNotFound = errors.New("kyc application not found")
+	// ErrInvalidKYCTransition is returned when the review state machine
+	// does not allow moving an application to the requested status.
+	ErrInvalidKYCTransition = errors.New("invalid kyc status transition")
+	// ErrKYCNotApproved is returned when opening or joining an account
+	// requires approved KYC the customer does not have.
+	ErrKYCNotApproved = errors.New("kyc approval required")
+	// ErrKYCVerificationUnavailable is returned when the verification
+	// provider fails.
+	ErrKYCVerificationUnavailable = errors.New("kyc verification provider unavailable")
+)
+
+// kycTransitions lists the statuses each status may move to. Submitting
+// again replaces the documents of an application that is not in review.
+var kycTransitions = map[string][]string{
+	KYCSubmitted: {KYCSubmitted, KYCInReview},
+	KYCInReview:  {KYCApproved, KYCRejected},
+	KYCRejected:  {KYCSubmitted},
+	KYCApproved:  {},
+}
+
+// checkKYCTransition fails unless the customer's application may move from
+// one status to another.
+func checkKYCTransition(customerID int, from, to string) error {
+	if !slices.Contains(kycTransitions[from], to) {
+		return fmt.Errorf("%w: application of customer %d cannot go from %s to %s", ErrInvalidKYCTransition, customerID, from, to)
+	}
+	return nil
+}
+
+// KYCDocument is the metadata of an identity or address document. The
+// scan itself is kept elsewhere; FileRef points at it.
+type KYCDocument struct {
+	Type string `json:"type"`
+	// Country is the ISO 3166-1 alpha-2 code of the issuing country.
+	Country string `json:"country"`
+	Number  string `json:"number"`
+	// ExpiresOn is the expiry date as YYYY-MM-DD, if the document has one.
+	ExpiresOn string `json:"expiresOn,omitempty"`
+	FileRef   string `json:"fileRef,omitempty"`
+}
+
+// KYCVerification is a verification provider's opinion of an application.
+type KYCVerification struct {
+	Decision string `json:"decision"`
+	// Reference identifies the check at the provider.
+	Reference string    `json:"reference,omitempty"`
+	Reasons   []string  `json:"reasons,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// KYCApplication is a customer's know-your-customer application. Each
+// customer has at most one; resubmitting replaces it.
+type KYCApplication struct {
+	CustomerID   int              `json:"customerId"`
+	Status       string           `json:"status"`
+	Documents    []KYCDocument    `json:"documents"`
+	Verification *KYCVerification `json:"verification,omitempty"`
+	// Note is the operator's reason for approving or rejecting.
+	Note        string     `json:"note,omitempty"`
+	SubmittedAt time.Time  `json:"submittedAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	ReviewedAt  *time.Time `json:"reviewedAt,omitempty"`
+}
+
+// SubmitKYCRequest submits the customer's documents for review.
+type SubmitKYCRequest struct {
+	Documents []KYCDocument `json:"documents"`
+}
+
+func (r *SubmitKYCRequest) Validate() error {
+	var v Validator
+	v.Check(len(r.Documents) > 0, "documents", "is required")
+	v.Check(len(r.Documents) <= 5, "documents", "must hold at most 5 documents")
+	today := time.Now().UTC().Format(time.DateOnly)
+	identity := false
+	for i := range r.Documents {
+		d := &r.Documents[i]
+		field := func(name string) string { return fmt.Sprintf("documents[%d].%s", i, name) }
+		d.Type = strings.ToLower(strings.TrimSpace(d.Type))
+		d.Country = strings.ToUpper(strings.TrimSpace(d.Country))
+		d.Number = strings.TrimSpace(d.Number)
+		d.FileRef = strings.TrimSpace(d.FileRef)
+		v.Checkf(slices.Contains(kycDocumentTypes, d.Type), field("type"), "must be one of %s", strings.Join(kycDocumentTypes, ", "))
+		v.Check(len(d.Country) == 2 && strings.Trim(d.Country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == "", field("country"),
+			"must be an ISO 3166-1 alpha-2 country code")
+		v.Check(d.Number != "", field("number"), "is required")
+		v.Check(len(d.Number) <= 64, field("number"), "must be at most 64 characters")
+		if d.ExpiresOn != "" {
+			_, err := time.Parse(time.DateOnly, d.ExpiresOn)
+			v.Check(err == nil, field("expiresOn"), "must be a date formatted YYYY-MM-DD")
+			v.Check(d.ExpiresOn > today, field("expiresOn"), "document has expired")
+		}
+		v.Check(len(d.FileRef) <= 500, field("fileRef"), "must be at most 500 characters")
+		identity = identity || d.Type != "proof_of_address"
+	}
+	v.Check(len(r.Documents) == 0 || identity, "documents", "must include an identity document")
+	return v.Err()
+}
+
+// KYCStore persists KYC applications. Status changes go through the
+// review state machine.
+type KYCStore interface {
+	// SubmitKYC creates the customer's application, or replaces the
+	// documents of one that is submitted or rejected, and marks it
+	// submitted.
+	SubmitKYC(customerID int, docs []KYCDocument) (*KYCApplication, error)
+	KYCApplication(customerID int) (*KYCApplication, error)
+	// KYCApplications lists applications in a status, oldest first.
+	KYCApplications(status string, limit int) ([]*KYCApplication, error)
+	// SetKYCStatus moves an application to status, recording the
+	// operator's note.
+	SetKYCStatus(customerID int, status, note string) (*KYCApplication, error)
+	// SetKYCVerification records the provider's verification of an
+	// application in review.
+	SetKYCVerification(customerID int, v *KYCVerification) (*KYCApplication, error)
+}
+
+// KYCVerifier checks submitted documents with an identity verification
+// provider when an operator starts reviewing an application.
+type KYCVerifier interface {
+	Verify(ctx context.Context, app *KYCApplication) (KYCVerification, error)
+}
+
+// HTTPKYCVerifier asks an external verification service. It POSTs the
+// KYCApplication as JSON to URL and expects a KYCVerification back.
+type HTTPKYCVerifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (c *HTTPKYCVerifier) Verify(ctx context.Context, app *KYCApplication) (KYCVerification, error) {
+	var verification KYCVerification
+	body, err := json.Marshal(app)
+	if err != nil {
+		return verification, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return verification, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return verification, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return verification, fmt.Errorf("kyc verifier returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&verification); err != nil {
+		return verification, fmt.Errorf("kyc verifier response: %w", err)
+	}
+	switch verification.Decision {
+	case KYCCheckClear, KYCCheckConsider, KYCCheckFail:
+		return verification, nil
+	}
+	return verification, fmt.Errorf("kyc verifier returned unknown decision %q", verification.Decision)
+}
+
+// KYCConfig wires KYC onboarding into the API server.
+type KYCConfig struct {
+	// Required refuses to open accounts for, or link them to, customers
+	// without approved KYC.
+	Required bool
+	// Verifier runs when a review starts; nil leaves reviews manual.
+	Verifier KYCVerifier
+}
+
+// kycFromEnv reads GOBANK_KYC_REQUIRED and GOBANK_KYC_VERIFIER: "manual"
+// (the default) leaves document checks to the operator, "http" calls
+// GOBANK_KYC_VERIFIER_URL within GOBANK_KYC_VERIFIER_TIMEOUT (default 10s).
+func kycFromEnv() (KYCConfig, error) {
+	var cfg KYCConfig
+	var err error
+	if cfg.Required, err = envBool("GOBANK_KYC_REQUIRED"); err != nil {
+		return cfg, err
+	}
+	switch kind := os.Getenv("GOBANK_KYC_VERIFIER"); kind {
+	case "", "manual":
+	case "http":
+		url := os.Getenv("GOBANK_KYC_VERIFIER_URL")
+		if url == "" {
+			return cfg, errors.New("GOBANK_KYC_VERIFIER_URL is required when GOBANK_KYC_VERIFIER is http")
+		}
+		timeout := 10 * time.Second
+		if v := os.Getenv("GOBANK_KYC_VERIFIER_TIMEOUT"); v != "" {
+			if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 {
+				return cfg, errors.New("GOBANK_KYC_VERIFIER_TIMEOUT must be a positive duration")
+			}
+		}
+		cfg.Verifier = &HTTPKYCVerifier{URL: url, Client: &http.Client{Timeout: timeout}}
+	default:
+		return cfg, fmt.Errorf("GOBANK_KYC_VERIFIER must be manual or http, got %q", kind)
+	}
+	return cfg, nil
+}
+
+// requireKYC fails unless the customer may own accounts: either KYC is not
+// required or their application was approved.
+func (s *APIServer) requireKYC(customerID int) error {
+	if !s.kyc.Required {
+		return nil
+	}
+	if s.kycs == nil {
+		return &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: errors.New("kyc is not configured")}
+	}
+	app, err := s.kycs.KYCApplication(customerID)
+	if errors.Is(err, ErrKYCNotFound) {
+		return fmt.Errorf("%w: customer %d has not submitted kyc documents", ErrKYCNotApproved, customerID)
+	}
+	if err != nil {
+		return err
+	}
+	if app.Status != KYCApproved {
+		return fmt.Errorf("%w: kyc application of customer %d is %s", ErrKYCNotApproved, customerID, app.Status)
+	}
+	return nil
+}
+
+func (s *APIServer) kycRoutes(router *mux.Router) {
+	customer := func(f apiFunc) http.HandlerFunc { return makeHTTPHandleFunc(s.authenticated(s.requireKYCStore(f))) }
+	admin := func(f apiFunc) http.HandlerFunc { return makeHTTPHandleFunc(s.requireAdmin(s.requireKYCStore(f))) }
+	router.HandleFunc("/customers/me/kyc", customer(s.handleGetMyKYC)).Methods(http.MethodGet)
+	router.HandleFunc("/customers/me/kyc", customer(s.handleSubmitKYC)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/kyc", admin(s.handleListKYC)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/kyc/{customerId}", admin(s.handleGetKYC)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/kyc/{customerId}/review", admin(s.handleReviewKYC)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/kyc/{customerId}/approve", admin(s.handleResolveKYC(KYCApproved))).Methods(http.MethodPost)
+	router.HandleFunc("/admin/kyc/{customerId}/reject", admin(s.handleResolveKYC(KYCRejected))).Methods(http.MethodPost)
+}
+
+func (s *APIServer) requireKYCStore(f apiFunc) apiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if s.kycs == nil {
+			return &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: errors.New("kyc is not configured")}
+		}
+		return f(w, r)
+	}
+}
+
+// customerOnly returns the calling customer, refusing the admin token.
+func customerOnly(ctx context.Context) (*Customer, error) {
+	p := principalFrom(ctx)
+	if p.customer == nil {
+		return nil, badRequest(errors.New("the admin token does not belong to a customer"))
+	}
+	return p.customer, nil
+}
+
+func (s *APIServer) handleGetMyKYC(w http.ResponseWriter, r *http.Request) error {
+	customer, err := customerOnly(r.Context())
+	if err != nil {
+		return err
+	}
+	app, err := s.kycs.KYCApplication(customer.ID)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, app, nil)
+}
+
+// handleSubmitKYC submits the caller's documents. Customers may correct
+// their documents until a review starts, and submit again once rejected.
+func (s *APIServer) handleSubmitKYC(w http.ResponseWriter, r *http.Request) error {
+	customer, err := customerOnly(r.Context())
+	if err != nil {
+		return err
+	}
+	req := new(SubmitKYCRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	app, err := s.kycs.SubmitKYC(customer.ID, req.Documents)
+	if err != nil {
+		return err
+	}
+	kycApplications.WithLabelValues(KYCSubmitted).Inc()
+	return writeData(w, http.StatusAccepted, app, nil)
+}
+
+// handleListKYC lists up to 100 applications, by default those waiting
+// for a review to start.
+func (s *APIServer) handleListKYC(w http.ResponseWriter, r *http.Request) error {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = KYCSubmitted
+	}
+	if _, ok := kycTransitions[status]; !ok {
+		return validationFailed(ValidationErrors{{Field: "status", Message: fmt.Sprintf("must be %s, %s, %s or %s",
+			KYCSubmitted, KYCInReview, KYCApproved, KYCRejected)}})
+	}
+	apps, err := s.kycs.KYCApplications(status, 100)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, apps, nil)
+}
+
+func kycCustomerID(r *http.Request) (int, error) {
+	idStr := mux.Vars(r)["customerId"]
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, badRequest(fmt.Errorf("invalid customer id %q", idStr))
+	}
+	return id, nil
+}
+
+func (s *APIServer) handleGetKYC(w http.ResponseWriter, r *http.Request) error {
+	id, err := kycCustomerID(r)
+	if err != nil {
+		return err
+	}
+	app, err := s.kycs.KYCApplication(id)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, app, nil)
+}
+
+// handleReviewKYC starts reviewing a submitted application, freezing its
+// documents, and runs the verification provider on it. Calling it again
+// while in review repeats the verification, for when the provider failed.
+func (s *APIServer) handleReviewKYC(w http.ResponseWriter, r *http.Request) error {
+	id, err := kycCustomerID(r)
+	if err != nil {
+		return err
+	}
+	app, err := s.kycs.KYCApplication(id)
+	if err != nil {
+		return err
+	}
+	if app.Status != KYCInReview {
+		if app, err = s.kycs.SetKYCStatus(id, KYCInReview, ""); err != nil {
+			return err
+		}
+		kycApplications.WithLabelValues(KYCInReview).Inc()
+	}
+	if s.kyc.Verifier == nil {
+		return writeData(w, http.StatusOK, app, nil)
+	}
+
+	verification, err := s.kyc.Verifier.Verify(r.Context(), app)
+	if err != nil {
+		kycVerifications.WithLabelValues("error").Inc()
+		slog.Error("kyc verification failed", "customer_id", id, "error", err)
+		return &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: ErrKYCVerificationUnavailable}
+	}
+	kycVerifications.WithLabelValues(verification.Decision).Inc()
+	verification.CheckedAt = time.Now().UTC()
+	if app, err = s.kycs.SetKYCVerification(id, &verification); err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, app, nil)
+}
+
+// handleResolveKYC approves or rejects an application in review with an
+// optional note, which rejected customers see.
+func (s *APIServer) handleResolveKYC(status string) apiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		id, err := kycCustomerID(r)
+		if err != nil {
+			return err
+		}
+		note, err := resolutionNote(r)
+		if err != nil {
+			return err
+		}
+		app, err := s.kycs.SetKYCStatus(id, status, note)
+		if err != nil {
+			return err
+		}
+		kycApplications.WithLabelValues(status).Inc()
+		return writeData(w, http.StatusOK, app, nil)
+	}
+}
+
+const kycColumns = `customer_id, status, documents, verification, note, submitted_at, updated_at, reviewed_at`
+
+func scanIntoKYCApplication(row interface{ Scan(...any) error }) (*KYCApplication, error) {
+	app := new(KYCApplication)
+	var documents, verification []byte
+	var reviewedAt sql.NullTime
+	if err := row.Scan(&app.CustomerID, &app.Status, &documents, &verification, &app.Note,
+		&app.SubmittedAt, &app.UpdatedAt, &reviewedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(documents, &app.Documents); err != nil {
+		return nil, fmt.Errorf("kyc documents of customer %d: %w", app.CustomerID, err)
+	}
+	if verification != nil {
+		app.Verification = new(KYCVerification)
+		if err := json.Unmarshal(verification, app.Verification); err != nil {
+			return nil, fmt.Errorf("kyc verification of customer %d: %w", app.CustomerID, err)
+		}
+	}
+	if reviewedAt.Valid {
+		app.ReviewedAt = &reviewedAt.Time
+	}
+	return app, nil
+}
+
+// resubmittable lists the statuses from which an application may be
+// submitted again.
+func resubmittable() []string {
+	var statuses []string
+	for from, to := range kycTransitions {
+		if slices.Contains(to, KYCSubmitted) {
+			statuses = append(statuses, from)
+		}
+	}
+	return statuses
+}
+
+func (s *PostgresStore) SubmitKYC(customerID int, docs []KYCDocument) (*KYCApplication, error) {
+	documents, err := json.Marshal(docs)
+	if err != nil {
+		return nil, err
+	}
+	app, err := scanIntoKYCApplication(s.db.QueryRow(`insert into kyc_application (customer_id, status, documents)
+	values ($1, $2, $3)
+	on conflict (customer_id) do update set status = excluded.status, documents = excluded.documents,
+		verification = null, note = '', submitted_at = now(), updated_at = now(), reviewed_at = null
+	where kyc_application.status = any($4)
+	returning `+kycColumns, customerID, KYCSubmitted, documents, pq.Array(resubmittable())))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return nil, fmt.Errorf("%w: %d", ErrCustomerNotFound, customerID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		// The application exists in a status that cannot be resubmitted.
+		current, err := s.KYCApplication(customerID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, checkKYCTransition(customerID, current.Status, KYCSubmitted)
+	}
+	return app, err
+}
+
+func (s *PostgresStore) KYCApplication(customerID int) (*KYCApplication, error) {
+	app, err := scanIntoKYCApplication(s.db.QueryRow(`select `+kycColumns+` from kyc_application
+	where customer_id = $1`, customerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: customer %d", ErrKYCNotFound, customerID)
+	}
+	return app, err
+}
+
+func (s *PostgresStore) KYCApplications(status string, limit int) ([]*KYCApplication, error) {
+	rows, err := s.db.Query(`select `+kycColumns+` from kyc_application
+	where status = $1 order by submitted_at, customer_id limit $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	apps := []*KYCApplication{}
+	for rows.Next() {
+		app, err := scanIntoKYCApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, app)
+	}
+	return apps, rows.Err()
+}
+
+func (s *PostgresStore) SetKYCStatus(customerID int, status, note string) (*KYCApplication, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var current string
+	err = tx.QueryRow(`select status from kyc_application where customer_id = $1 for update`, customerID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: customer %d", ErrKYCNotFound, customerID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKYCTransition(customerID, current, status); err != nil {
+		return nil, err
+	}
+	app, err := scanIntoKYCApplication(tx.QueryRow(`update kyc_application set status = $2, note = $3,
+		updated_at = now(), reviewed_at = case when $2 in ($4, $5) then now() end
+	where customer_id = $1 returning `+kycColumns, customerID, status, note, KYCApproved, KYCRejected))
+	if err != nil {
+		return nil, err
+	}
+	return app, tx.Commit()
+}
+
+func (s *PostgresStore) SetKYCVerification(customerID int, v *KYCVerification) (*KYCApplication, error) {
+	verification, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	app, err := scanIntoKYCApplication(s.db.QueryRow(`update kyc_application set verification = $2, updated_at = now()
+	where customer_id = $1 and status = $3 returning `+kycColumns, customerID, verification, KYCInReview))
+	if errors.Is(err, sql.ErrNoRows) {
+		current, err := s.KYCApplication(customerID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: application of customer %d is %s, not in review", ErrInvalidKYCTransition, customerID, current.Status)
+	}
+	return app, err
+}
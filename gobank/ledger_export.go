@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Ledger export formats.
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+const ledgerManifestKey = "ledger/manifest.json"
+
+// LedgerEntry is one committed transfer as exported for analytics.
+type LedgerEntry struct {
+	ID          int64     `json:"id" parquet:"id"`
+	FromAccount int       `json:"fromAccount" parquet:"from_account"`
+	ToAccount   int       `json:"toAccount" parquet:"to_account"`
+	Amount      int64     `json:"amount" parquet:"amount"`
+	CreatedAt   time.Time `json:"createdAt" parquet:"created_at,timestamp(microsecond)"`
+}
+
+// LedgerReader pages through the append-only ledger in ID order.
+type LedgerReader interface {
+	// LedgerAfter returns up to limit entries with ID > afterID created
+	// before the given time.
+	LedgerAfter(afterID int64, before time.Time, limit int) ([]LedgerEntry, error)
+}
+
+// LedgerBatch describes one exported file.
+type LedgerBatch struct {
+	Key       string    `json:"key"`
+	Format    string    `json:"format"`
+	FirstID   int64     `json:"firstId"`
+	LastID    int64     `json:"lastId"`
+	Rows      int       `json:"rows"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// LedgerManifest lists every exported batch. LastID is the export watermark.
+type LedgerManifest struct {
+	LastID    int64         `json:"lastId"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+	Batches   []LedgerBatch `json:"batches"`
+}
+
+// LedgerExporter incrementally writes new ledger entries to a sink.
+type LedgerExporter struct {
+	source    LedgerReader
+	sink      ExportSink
+	format    string
+	batchSize int
+	// lag keeps the exporter behind the head of the ledger so transfers
+	// whose IDs were allocated but not yet committed are not skipped.
+	lag time.Duration
+
+	mu sync.Mutex
+}
+
+// NewLedgerExporter creates an exporter writing batches of up to 10000
+// entries in the given format.
+func NewLedgerExporter(source LedgerReader, sink ExportSink, format string) (*LedgerExporter, error) {
+	if format != FormatCSV && format != FormatParquet {
+		return nil, fmt.Errorf("unknown ledger export format %q", format)
+	}
+	return &LedgerExporter{
+		source:    source,
+		sink:      sink,
+		format:    format,
+		batchSize: 10000,
+		lag:       time.Minute,
+	}, nil
+}
+
+// ExportOnce exports every entry past the manifest watermark and returns
+// the number of entries written. The manifest is updated after each batch,
+// so an interrupted export resumes without duplicates.
+func (e *LedgerExporter) ExportOnce(ctx context.Context) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	manifest, err := e.loadManifest(ctx)
+	if err != nil {
+		return 0, err
+	}
+	before := time.Now().Add(-e.lag)
+	exported := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return exported, err
+		}
+		entries, err := e.source.LedgerAfter(manifest.LastID, before, e.batchSize)
+		if err != nil {
+			return exported, err
+		}
+		if len(entries) == 0 {
+			return exported, nil
+		}
+
+		data, err := e.encode(entries)
+		if err != nil {
+			return exported, err
+		}
+		sum := sha256.Sum256(data)
+		first, last := entries[0].ID, entries[len(entries)-1].ID
+		batch := LedgerBatch{
+			Key:       fmt.Sprintf("ledger/batch-%012d-%012d.%s", first, last, e.format),
+			Format:    e.format,
+			FirstID:   first,
+			LastID:    last,
+			Rows:      len(entries),
+			SHA256:    hex.EncodeToString(sum[:]),
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := e.sink.Put(ctx, batch.Key, data); err != nil {
+			return exported, fmt.Errorf("write %s: %w", batch.Key, err)
+		}
+
+		manifest.Batches = append(manifest.Batches, batch)
+		manifest.LastID = last
+		manifest.UpdatedAt = batch.CreatedAt
+		if err := e.saveManifest(ctx, manifest); err != nil {
+			return exported, err
+		}
+		exported += len(entries)
+	}
+}
+
+// Run exports every interval until ctx is cancelled.
+func (e *LedgerExporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := e.ExportOnce(ctx)
+			if err != nil {
+				slog.Error("ledger export failed", "error", err)
+			} else if n > 0 {
+				slog.Info("exported ledger entries", "count", n)
+			}
+		}
+	}
+}
+
+func (e *LedgerExporter) encode(entries []LedgerEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	switch e.format {
+	case FormatParquet:
+		w := parquet.NewGenericWriter[LedgerEntry](&buf)
+		if _, err := w.Write(entries); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"id", "from_account", "to_account", "amount", "created_at"})
+		for _, entry := range entries {
+			w.Write([]string{
+				strconv.FormatInt(entry.ID, 10),
+				strconv.Itoa(entry.FromAccount),
+				strconv.Itoa(entry.ToAccount),
+				strconv.FormatInt(entry.Amount, 10),
+				entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *LedgerExporter) loadManifest(ctx context.Context) (*LedgerManifest, error) {
+	data, err := e.sink.Get(ctx, ledgerManifestKey)
+	if errors.Is(err, ErrObjectNotFound) {
+		return &LedgerManifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest LedgerManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("read ledger manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+func (e *LedgerExporter) saveManifest(ctx context.Context, manifest *LedgerManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return e.sink.Put(ctx, ledgerManifestKey, data)
+}
+
+// ledgerExporterFromEnv configures the exporter from LEDGER_EXPORT_* env
+// vars. It returns a nil exporter when LEDGER_EXPORT_INTERVAL is unset.
+func ledgerExporterFromEnv(source LedgerReader) (*LedgerExporter, time.Duration, error) {
+	v := os.Getenv("LEDGER_EXPORT_INTERVAL")
+	if v == "" {
+		return nil, 0, nil
+	}
+	interval, err := time.ParseDuration(v)
+	if err != nil {
+		return nil, 0, fmt.Errorf("LEDGER_EXPORT_INTERVAL: %w", err)
+	}
+
+	sink, err := exportSinkFromEnv("LEDGER_EXPORT")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	format := os.Getenv("LEDGER_EXPORT_FORMAT")
+	if format == "" {
+		format = FormatCSV
+	}
+	exporter, err := NewLedgerExporter(source, sink, format)
+	return exporter, interval, err
+}
+
+// exportSinkFromEnv configures a sink from the <prefix>_S3_* env vars when
+// <prefix>_S3_BUCKET is set, or else the <prefix>_DIR directory, ./exports
+// by default.
+func exportSinkFromEnv(prefix string) (ExportSink, error) {
+	if bucket := os.Getenv(prefix + "_S3_BUCKET"); bucket != "" {
+		sink, err := NewS3Sink(
+			os.Getenv(prefix+"_S3_ENDPOINT"),
+			bucket,
+			os.Getenv(prefix+"_S3_PREFIX"),
+			os.Getenv(prefix+"_S3_ACCESS_KEY"),
+			os.Getenv(prefix+"_S3_SECRET_KEY"),
+			os.Getenv(prefix+"_S3_INSECURE") != "true",
+		)
+		if err != nil {
+			return nil, err
+		}
+		return sink, nil
+	}
+	dir := os.Getenv(prefix + "_DIR")
+	if dir == "" {
+		dir = "./exports"
+	}
+	return &DirSink{Dir: dir}, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Account statuses. New accounts are active unless the server requires
+// operator activation, in which case they start pending. Closed is final.
+const (
+	AccountPending = "pending"
+	AccountActive  = "active"
+	AccountFrozen  = "frozen"
+	AccountClosed  = "closed"
+)
+
+var (
+	// ErrAccountPending is returned when an account awaiting activation is
+	// debited or takes part in a transfer.
+	ErrAccountPending = errors.New("account is pending activation")
+	// ErrAccountClosed is returned for any movement on a closed account.
+	ErrAccountClosed = errors.New("account is closed")
+	// ErrInvalidStatusTransition is returned when the state machine does
+	// not allow moving an account to the requested status.
+	ErrInvalidStatusTransition = errors.New("invalid account status transition")
+	// ErrBalanceNotZero is returned when closing an account with money in it.
+	ErrBalanceNotZero = errors.New("account balance must be zero to close")
+)
+
+// accountTransitions lists the statuses each status may move to.
+var accountTransitions = map[string][]string{
+	AccountPending: {AccountActive, AccountClosed},
+	AccountActive:  {AccountFrozen, AccountClosed},
+	AccountFrozen:  {AccountActive, AccountClosed},
+	AccountClosed:  {},
+}
+
+// checkTransition fails unless an account with balance may move from one
+// status to another. Only empty accounts can be closed.
+func checkTransition(id int, from, to string, balance int64) error {
+	if !slices.Contains(accountTransitions[from], to) {
+		return fmt.Errorf("%w: account %d cannot go from %s to %s", ErrInvalidStatusTransition, id, from, to)
+	}
+	if to == AccountClosed && balance != 0 {
+		return fmt.Errorf("%w: account %d holds %d", ErrBalanceNotZero, id, balance)
+	}
+	return nil
+}
+
+// checkMovement fails if an account in status cannot take part in a
+// movement. Closed accounts reject everything; pending and frozen ones
+// still accept deposits but cannot be debited or join transfers.
+func checkMovement(id int, status string, deposit bool) error {
+	switch {
+	case status == AccountClosed:
+		return fmt.Errorf("%w: %d", ErrAccountClosed, id)
+	case deposit:
+		return nil
+	case status == AccountFrozen:
+		return fmt.Errorf("%w: %d", ErrAccountFrozen, id)
+	case status == AccountPending:
+		return fmt.Errorf("%w: %d", ErrAccountPending, id)
+	}
+	return nil
+}
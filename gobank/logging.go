@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader carries the request ID in and out. A well-formed
+// incoming value is kept so IDs can be followed across services.
+const RequestIDHeader = "X-Request-ID"
+
+type ctxKey int
+
+const (
+	requestInfoKey ctxKey = iota
+	principalKey
+)
+
+// requestInfo is shared between the outer middleware and the router so
+// the route template and logger are available to both.
+type requestInfo struct {
+	id     string
+	route  string
+	logger *slog.Logger
+}
+
+// loggerFrom returns the request-scoped logger, or the default logger
+// outside a request.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		return info.logger
+	}
+	return slog.Default()
+}
+
+// loggerFromEnv builds the process logger from GOBANK_LOG_FORMAT (json or
+// text, default json) and GOBANK_LOG_LEVEL (debug, info, warn, error).
+func loggerFromEnv() (*slog.Logger, error) {
+	var level slog.Level
+	if v := os.Getenv("GOBANK_LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return nil, fmt.Errorf("GOBANK_LOG_LEVEL: %w", err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch format := os.Getenv("GOBANK_LOG_FORMAT"); format {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("GOBANK_LOG_FORMAT must be json or text, got %q", format)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts short IDs made of characters safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool {
+		return !(r == '-' || r == '_' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	}) < 0
+}
+
+// statusRecorder captures the status written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// observe assigns each request an ID and request-scoped logger, then logs
+// and records metrics for it once it completes.
+func observe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		info := &requestInfo{
+			id:     id,
+			route:  "unmatched",
+			logger: slog.Default().With("request_id", id),
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			elapsed := time.Since(start)
+			observeRequest(r.Method, info.route, rec.status, elapsed)
+			info.logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", info.route),
+				slog.Int("status", rec.status),
+				slog.Duration("duration", elapsed),
+			)
+		}()
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey, info)))
+	})
+}
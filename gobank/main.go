@@ -1,8 +1,281 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
 func main() {
+	logger, err := loggerFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	config, err := ServerConfigFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	dbConfig, err := DBConfigFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+
+	rates, err := ratesFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	interestInterval, savingsRate, err := interestFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	velocity, err := velocityFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	fraud, err := fraudFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	approval, err := approvalsFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	kyc, err := kycFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	orderInterval := time.Minute
+	if v := os.Getenv("GOBANK_STANDING_ORDER_INTERVAL"); v != "" {
+		orderInterval, err = time.ParseDuration(v)
+		if err != nil || orderInterval < 0 {
+			fatal(errors.New("GOBANK_STANDING_ORDER_INTERVAL must be a non-negative duration"))
+		}
+	}
+
+	cache, closeCache, err := accountCacheFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var (
+		store       Storage
+		idempotency IdempotencyStore
+		orders      StandingOrderStore
+		holds       TransferHoldStore
+		approvals   TransferApprovalStore
+		kycs        KYCStore
+		apiKeys     APIKeyStore
+		notify      NotificationStore
+		interest    *InterestAccrual
+		closeStore  = func() error { return nil }
+	)
+	switch kind := os.Getenv("GOBANK_STORAGE"); kind {
+	case "memory":
+		slog.Warn("using in-memory storage; all data is lost on exit")
+		mem := NewInMemoryStorage(rates)
+		store, idempotency, orders, holds, approvals, kycs, apiKeys, notify = mem, mem, mem, mem, mem, mem, mem, mem
+	case "", "postgres":
+		pg, err := NewPostgresStore(dbConfig)
+		if err != nil {
+			fatal(err)
+		}
+		// Pool utilization, as go_sql_* metrics
+		prometheus.MustRegister(collectors.NewDBStatsCollector(pg.db.DB, "gobank"))
+		if err := pg.Init(); err != nil {
+			fatal(err)
+		}
+		if rates != nil {
+			pg.SetRateProvider(rates)
+		}
+		store, idempotency, orders, holds, approvals, kycs, apiKeys, notify, closeStore = pg, pg, pg, pg, pg, pg, pg, pg, pg.Close
+
+		exporter, interval, err := ledgerExporterFromEnv(pg)
+		if err != nil {
+			fatal(err)
+		}
+		if exporter != nil {
+			go exporter.Run(ctx, interval)
+		}
+		var accruals InterestStore = pg
+		if cache != nil {
+			accruals = &cachingInterestStore{InterestStore: pg, cache: cache}
+		}
+		interest = NewInterestAccrual(accruals)
+		if interestInterval > 0 {
+			go interest.Run(ctx, interestInterval)
+		}
+		go purgeIdempotency(ctx, pg)
+	default:
+		fatal(fmt.Errorf("GOBANK_STORAGE must be postgres or memory, got %q", kind))
+	}
 
-	server := NewAPIServer(":3000")
-	server.Run()
+	chaos, err := ChaosConfigFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	if chaos.Enabled {
+		slog.Warn("chaos storage enabled")
+		store = NewChaosStorage(store, chaos)
+	}
+	// The cache wraps chaos, so cached reads skip injected faults like a
+	// real cache would skip a flaky database.
+	if cache != nil {
+		slog.Info("account cache enabled", "backend", os.Getenv("GOBANK_ACCOUNT_CACHE"))
+		store = NewCachingStorage(store, cache)
+		holds = &cachingHoldStore{TransferHoldStore: holds, cache: cache}
+		approvals = &cachingApprovalStore{TransferApprovalStore: approvals, cache: cache}
+	}
+	// Notifications wrap the cache, so they see every committed deposit,
+	// withdrawal and transfer, whether made over HTTP, gRPC or by a
+	// background job.
+	notifiers, maxAttempts, err := notificationsFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	if len(notifiers) > 0 {
+		dispatcher := NewNotificationDispatcher(notify, store, notifiers...)
+		dispatcher.MaxAttempts = maxAttempts
+		store = NewNotifyingStorage(store, dispatcher)
+		holds = &notifyingHoldStore{TransferHoldStore: holds, notify: dispatcher.Enqueue}
+		approvals = &notifyingApprovalStore{TransferApprovalStore: approvals, notify: dispatcher.Enqueue}
+		go dispatcher.Run(ctx)
+	} else {
+		notify = nil
+	}
+	if approval.Enabled() {
+		go expirePendingTransfers(ctx, approvals, time.Minute)
+	}
+	// Standing orders transfer through store, so they see injected faults too.
+	if orderInterval > 0 {
+		go NewStandingOrderScheduler(orders, store).Run(ctx, orderInterval)
+	}
+
+	server := NewAPIServer(config, store)
+	if server.adminToken = os.Getenv("GOBANK_ADMIN_TOKEN"); server.adminToken != "" {
+		sink, err := exportSinkFromEnv("REGULATORY_EXPORT")
+		if err != nil {
+			fatal(err)
+		}
+		server.regulatory = NewRegulatoryExporter(store, sink)
+		go server.regulatory.Run(ctx)
+	}
+	if v := os.Getenv("GOBANK_OVERDRAFT_LIMIT"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit < 0 {
+			fatal(errors.New("GOBANK_OVERDRAFT_LIMIT must be a non-negative integer"))
+		}
+		server.overdraftLimit = limit
+	}
+	server.savingsRateBps = savingsRate
+	if server.requireActivation, err = envBool("GOBANK_REQUIRE_ACTIVATION"); err != nil {
+		fatal(err)
+	}
+	server.interest = interest
+	server.idempotency = idempotency
+	server.standingOrders = orders
+	server.holds = holds
+	server.velocity = velocity
+	server.fraud = fraud
+	server.approvals = approvals
+	server.approval = approval
+	server.kycs = kycs
+	server.kyc = kyc
+	server.apiKeys = apiKeys
+	server.notifications = notify
+	server.idempotencyTTL = 24 * time.Hour
+	if v := os.Getenv("GOBANK_IDEMPOTENCY_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			fatal(errors.New("GOBANK_IDEMPOTENCY_TTL must be a positive duration"))
+		}
+		server.idempotencyTTL = ttl
+	}
+
+	var grpcOpts []grpc.ServerOption
+	if config.TLSEnabled() {
+		creds, err := credentials.NewServerTLSFromFile(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			fatal(err)
+		}
+		grpcOpts = append(grpcOpts, grpc.Creds(creds))
+	}
+	grpcServer := NewGRPCServer(server, grpcOpts...)
+	lis, err := net.Listen("tcp", config.GRPCListenAddr)
+	if err != nil {
+		fatal(err)
+	}
+
+	errc := make(chan error, 2)
+	go func() { errc <- server.Run() }()
+	go func() {
+		slog.Info("gRPC server listening", "addr", config.GRPCListenAddr)
+		errc <- grpcServer.Serve(lis)
+	}()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			fatal(err)
+		}
+	case <-ctx.Done():
+		stop()
+		slog.Info("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		defer cancel()
+		go func() {
+			<-shutdownCtx.Done()
+			grpcServer.Stop()
+		}()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("shutdown", "error", err)
+		}
+		grpcServer.GracefulStop()
+	}
+	if err := closeStore(); err != nil {
+		slog.Error("close store", "error", err)
+	}
+	if err := closeCache(); err != nil {
+		slog.Error("close account cache", "error", err)
+	}
+}
+
+func fatal(err error) {
+	slog.Error("gobank stopped", "error", err)
+	os.Exit(1)
+}
 
+// purgeIdempotency deletes expired idempotent responses every hour.
+func purgeIdempotency(ctx context.Context, pg *PostgresStore) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := pg.PurgeIdempotency(ctx)
+			if err != nil {
+				slog.Error("purge idempotency keys", "error", err)
+			} else if n > 0 {
+				slog.Info("purged idempotency keys", "count", n)
+			}
+		}
+	}
 }
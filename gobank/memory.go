@@ -0,0 +1,1165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InMemoryStorage implements Storage, IdempotencyStore, StandingOrderStore,
+// TransferHoldStore, TransferApprovalStore, KYCStore, APIKeyStore and
+// NotificationStore in process memory for handler tests and local
+// development without Postgres. IDs and account numbers are allocated
+// sequentially from 1 and accountNumberBase, so runs are reproducible. All methods are safe for
+// concurrent use; a single mutex makes every operation atomic.
+type InMemoryStorage struct {
+	mu sync.Mutex
+	// Now is the clock used for timestamps; tests may replace it.
+	Now   func() time.Time
+	rates RateProvider
+
+	accounts    map[int]*Account
+	nextID      int
+	nextNumber  int64
+	entries     []*AccountEntry
+	transfers   []*TransferRecord
+	customers   map[int]*Customer
+	tokens      map[string]int
+	owners      map[int]map[int]time.Time
+	idempotency map[string]*memoryIdempotency
+	orders      []*StandingOrder
+	orderRuns   []*StandingOrderRun
+	held        []*HeldTransfer
+	pending     []*PendingTransfer
+	kyc         map[int]*KYCApplication
+	apiKeys     []*APIKey
+	apiKeyIDs   map[string]int64
+	notify      map[int]*NotificationPreferences
+}
+
+type memoryIdempotency struct {
+	fingerprint string
+	resp        *StoredResponse
+	lockedUntil time.Time
+	expiresAt   time.Time
+}
+
+// NewInMemoryStorage creates an empty store. rates may be nil, which
+// rejects cross-currency transfers as PostgresStore does.
+func NewInMemoryStorage(rates RateProvider) *InMemoryStorage {
+	return &InMemoryStorage{
+		Now:         time.Now,
+		rates:       rates,
+		accounts:    make(map[int]*Account),
+		nextNumber:  accountNumberBase,
+		customers:   make(map[int]*Customer),
+		tokens:      make(map[string]int),
+		owners:      make(map[int]map[int]time.Time),
+		idempotency: make(map[string]*memoryIdempotency),
+		kyc:         make(map[int]*KYCApplication),
+		apiKeyIDs:   make(map[string]int64),
+		notify:      make(map[int]*NotificationPreferences),
+	}
+}
+
+func (s *InMemoryStorage) now() time.Time { return s.Now().UTC() }
+
+// account returns the stored account; callers must hold mu.
+func (s *InMemoryStorage) account(id int) (*Account, error) {
+	acc, ok := s.accounts[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+	}
+	return acc, nil
+}
+
+func copyLimit(limit *int64) *int64 {
+	if limit == nil {
+		return nil
+	}
+	l := *limit
+	return &l
+}
+
+func copyAccount(acc *Account) *Account {
+	c := *acc
+	c.DailyTransferLimit = copyLimit(acc.DailyTransferLimit)
+	c.WeeklyTransferLimit = copyLimit(acc.WeeklyTransferLimit)
+	if acc.ClosedAt != nil {
+		closedAt := *acc.ClosedAt
+		c.ClosedAt = &closedAt
+	}
+	return &c
+}
+
+func (s *InMemoryStorage) CreateAccount(acc *Account, ownerIDs ...int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if acc.AccountNo == 0 {
+		if s.nextNumber > accountNumberMax {
+			return fmt.Errorf("account number sequence exhausted at %d", s.nextNumber)
+		}
+		acc.AccountNo = withCheckDigits(s.nextNumber)
+		s.nextNumber++
+	} else if !ValidAccountNumber(acc.AccountNo) {
+		return fmt.Errorf("%w: invalid account number %d", ErrInvalidAccountNumber, acc.AccountNo)
+	}
+	for _, other := range s.accounts {
+		if other.AccountNo == acc.AccountNo {
+			return fmt.Errorf("%w: number %d", ErrAccountExists, acc.AccountNo)
+		}
+	}
+	for _, customerID := range ownerIDs {
+		if _, ok := s.customers[customerID]; !ok {
+			return fmt.Errorf("%w: %d", ErrCustomerNotFound, customerID)
+		}
+	}
+	if acc.Currency == "" {
+		acc.Currency = DefaultCurrency
+	}
+	if acc.Type == "" {
+		acc.Type = AccountChecking
+	}
+	if acc.Status == "" {
+		acc.Status = AccountActive
+	}
+
+	s.nextID++
+	acc.ID = s.nextID
+	acc.Version = 1
+	acc.CreatedAt = s.now()
+	s.accounts[acc.ID] = copyAccount(acc)
+	s.owners[acc.ID] = make(map[int]time.Time)
+	for _, customerID := range ownerIDs {
+		s.owners[acc.ID][customerID] = acc.CreatedAt
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) DeleteAccount(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.account(id); err != nil {
+		return err
+	}
+	delete(s.accounts, id)
+	delete(s.owners, id)
+	delete(s.notify, id)
+	return nil
+}
+
+func (s *InMemoryStorage) UpdateAccount(acc *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.account(acc.ID)
+	if err != nil {
+		return err
+	}
+	if stored.Version != acc.Version {
+		return fmt.Errorf("%w: account %d", ErrVersionConflict, acc.ID)
+	}
+	stored.FirstName = acc.FirstName
+	stored.LastName = acc.LastName
+	stored.Balance = acc.Balance
+	stored.OverdraftLimit = acc.OverdraftLimit
+	stored.InterestRateBps = acc.InterestRateBps
+	stored.Version++
+	acc.Version = stored.Version
+	return nil
+}
+
+// ModifyAccount applies apply to a copy of the account and saves the
+// fields PostgresStore.ModifyAccount saves. The mutex keeps the account
+// from changing in between, so apply is called once.
+func (s *InMemoryStorage) ModifyAccount(id int, apply func(*Account) error) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.account(id)
+	if err != nil {
+		return nil, err
+	}
+	acc := copyAccount(stored)
+	if err := apply(acc); err != nil {
+		return nil, err
+	}
+	stored.FirstName, stored.LastName = acc.FirstName, acc.LastName
+	stored.OverdraftLimit, stored.InterestRateBps = acc.OverdraftLimit, acc.InterestRateBps
+	stored.DailyTransferLimit = copyLimit(acc.DailyTransferLimit)
+	stored.WeeklyTransferLimit = copyLimit(acc.WeeklyTransferLimit)
+	stored.Version++
+	return copyAccount(stored), nil
+}
+
+func (s *InMemoryStorage) GetAccountByID(id int) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, err := s.account(id)
+	if err != nil {
+		return nil, err
+	}
+	return copyAccount(acc), nil
+}
+
+func (s *InMemoryStorage) ListAccounts(q *AccountQuery) (*AccountPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accounts := []*Account{}
+	for id, acc := range s.accounts {
+		if q.OwnerID != 0 {
+			if _, ok := s.owners[id][q.OwnerID]; !ok {
+				continue
+			}
+		}
+		if q.matches(acc) {
+			accounts = append(accounts, copyAccount(acc))
+		}
+	}
+	q.sortAccounts(accounts)
+	if len(accounts) > q.Limit+1 {
+		accounts = accounts[:q.Limit+1]
+	}
+	return q.page(accounts), nil
+}
+
+// debitedSince sums outgoing transfers and withdrawals at or after start;
+// callers must hold mu.
+func (s *InMemoryStorage) debitedSince(id int, start time.Time) int64 {
+	var total int64
+	for _, t := range s.transfers {
+		if t.FromAccount == id && !t.CreatedAt.Before(start) {
+			total += t.Debit.Amount
+		}
+	}
+	for _, e := range s.entries {
+		if e.AccountID == id && e.Kind == EntryWithdrawal && !e.CreatedAt.Before(start) {
+			total += e.Amount
+		}
+	}
+	return total
+}
+
+// checkDebit applies the status, daily limit and overdraft rules shared by
+// transfers and withdrawals; callers must hold mu.
+func (s *InMemoryStorage) checkDebit(acc *Account, amount int64) error {
+	if err := checkMovement(acc.ID, acc.Status, false); err != nil {
+		return err
+	}
+	y, m, d := s.now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if limit := acc.DailyTransferLimit; limit != nil {
+		spent := s.debitedSince(acc.ID, today)
+		if spent+amount > *limit {
+			return fmt.Errorf("%w: %d of %d already used today", ErrDailyLimitExceeded, spent, *limit)
+		}
+	}
+	if limit := acc.WeeklyTransferLimit; limit != nil {
+		// Weeks start on Monday, as date_trunc('week') does in Postgres.
+		week := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+		spent := s.debitedSince(acc.ID, week)
+		if spent+amount > *limit {
+			return fmt.Errorf("%w: %d of %d already used this week", ErrWeeklyLimitExceeded, spent, *limit)
+		}
+	}
+	if acc.Balance-amount < -acc.OverdraftLimit {
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) Transfer(fromID, toID int, amount int64) (*TransferRecord, error) {
+	if amount <= 0 || fromID == toID {
+		return nil, ErrInvalidTransfer
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transfer(fromID, toID, amount)
+}
+
+// transfer performs a Transfer; callers must hold mu.
+func (s *InMemoryStorage) transfer(fromID, toID int, amount int64) (*TransferRecord, error) {
+	from, err := s.account(fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.account(toID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMovement(toID, to.Status, false); err != nil {
+		return nil, err
+	}
+	if err := s.checkDebit(from, amount); err != nil {
+		return nil, err
+	}
+	debit := NewMoney(amount, from.Currency)
+	credit, err := Convert(debit, to.Currency, s.rates)
+	if err != nil {
+		return nil, err
+	}
+	if credit.Amount <= 0 {
+		return nil, fmt.Errorf("%w: amount too small to convert", ErrInvalidTransfer)
+	}
+	if _, err := to.BalanceMoney().Add(credit); err != nil {
+		return nil, err
+	}
+
+	from.Balance -= debit.Amount
+	to.Balance += credit.Amount
+	from.Version++
+	to.Version++
+	record := &TransferRecord{
+		ID:          int64(len(s.transfers) + 1),
+		FromAccount: fromID,
+		ToAccount:   toID,
+		Debit:       debit,
+		Credit:      credit,
+		CreatedAt:   s.now(),
+	}
+	s.transfers = append(s.transfers, record)
+	c := *record
+	return &c, nil
+}
+
+func (s *InMemoryStorage) Deposit(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+	return s.applyEntry(id, EntryDeposit, amount, idempotencyKey)
+}
+
+func (s *InMemoryStorage) Withdraw(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+	return s.applyEntry(id, EntryWithdrawal, amount, idempotencyKey)
+}
+
+func (s *InMemoryStorage) applyEntry(id int, kind string, amount int64, key string) (*AccountEntry, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidTransfer)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key != "" {
+		for _, e := range s.entries {
+			if e.IdempotencyKey != key {
+				continue
+			}
+			if e.AccountID != id || e.Kind != kind || e.Amount != amount {
+				return nil, ErrIdempotencyMismatch
+			}
+			replay := *e
+			replay.Replayed = true
+			return &replay, nil
+		}
+	}
+	acc, err := s.account(id)
+	if err != nil {
+		return nil, err
+	}
+	delta := amount
+	if kind == EntryWithdrawal {
+		if err := s.checkDebit(acc, amount); err != nil {
+			return nil, err
+		}
+		delta = -amount
+	} else if err := checkMovement(id, acc.Status, true); err != nil {
+		return nil, err
+	}
+	acc.Balance += delta
+	acc.Version++
+	entry := &AccountEntry{
+		ID:             int64(len(s.entries) + 1),
+		AccountID:      id,
+		Kind:           kind,
+		Amount:         amount,
+		BalanceAfter:   acc.Balance,
+		IdempotencyKey: key,
+		CreatedAt:      s.now(),
+	}
+	s.entries = append(s.entries, entry)
+	c := *entry
+	return &c, nil
+}
+
+// WriteStatement builds the statement from the recorded entries and
+// transfers. The lines are collected under the lock and written after it
+// is released so a slow writer does not block other requests.
+func (s *InMemoryStorage) WriteStatement(ctx context.Context, id int, from, to time.Time, w StatementWriter) error {
+	s.mu.Lock()
+	acc, err := s.account(id)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	st := &Statement{Account: copyAccount(acc), From: from, To: to}
+
+	var lines []StatementLine
+	for _, e := range s.entries {
+		if e.AccountID != id {
+			continue
+		}
+		amount := e.Amount
+		if e.Kind == EntryWithdrawal {
+			amount = -amount
+		}
+		lines = append(lines, StatementLine{ID: e.ID, Date: e.CreatedAt, Kind: e.Kind, Description: describeLine(e.Kind, 0), Amount: amount})
+	}
+	for _, t := range s.transfers {
+		switch id {
+		case t.FromAccount:
+			lines = append(lines, StatementLine{ID: t.ID, Date: t.CreatedAt, Kind: "transfer_out", Counterparty: t.ToAccount,
+				Description: describeLine("transfer_out", t.ToAccount), Amount: -t.Debit.Amount})
+		case t.ToAccount:
+			lines = append(lines, StatementLine{ID: t.ID, Date: t.CreatedAt, Kind: "transfer_in", Counterparty: t.FromAccount,
+				Description: describeLine("transfer_in", t.FromAccount), Amount: t.Credit.Amount})
+		}
+	}
+	s.mu.Unlock()
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.ID < b.ID
+	})
+	end := to.AddDate(0, 0, 1)
+	st.Opening = st.Account.Balance
+	for _, l := range lines {
+		if !l.Date.Before(from) {
+			st.Opening -= l.Amount
+		}
+	}
+	if err := w.Begin(st); err != nil {
+		return err
+	}
+	balance := st.Opening
+	for _, l := range lines {
+		if l.Date.Before(from) || !l.Date.Before(end) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		balance += l.Amount
+		l.Balance = balance
+		if err := w.Line(l); err != nil {
+			return err
+		}
+	}
+	st.Closing = balance
+	return w.End(st)
+}
+
+func (s *InMemoryStorage) SetStatus(id int, status string) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, err := s.account(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTransition(id, acc.Status, status, acc.Balance); err != nil {
+		return nil, err
+	}
+	acc.Status = status
+	acc.Version++
+	if status == AccountClosed {
+		closedAt := s.now()
+		acc.ClosedAt = &closedAt
+		for _, o := range s.orders {
+			if (o.FromAccount == id || o.ToAccount == id) && o.Status == OrderActive {
+				o.Status, o.NextRunAt = OrderCancelled, nil
+			}
+		}
+	}
+	return copyAccount(acc), nil
+}
+
+func (s *InMemoryStorage) SetTransferLimits(id int, daily, weekly *int64) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, err := s.account(id)
+	if err != nil {
+		return nil, err
+	}
+	acc.DailyTransferLimit = copyLimit(daily)
+	acc.WeeklyTransferLimit = copyLimit(weekly)
+	acc.Version++
+	return copyAccount(acc), nil
+}
+
+func (s *InMemoryStorage) Stats() (*BankStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := &BankStats{Balances: make(map[Currency]int64)}
+	for _, acc := range s.accounts {
+		switch acc.Status {
+		case AccountClosed:
+			stats.ClosedAccounts++
+		case AccountFrozen:
+			stats.FrozenAccounts++
+			stats.Accounts++
+		default:
+			stats.Accounts++
+		}
+		stats.Balances[acc.Currency] += acc.Balance
+	}
+	y, m, d := s.now().Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	for _, t := range s.transfers {
+		if !t.CreatedAt.Before(start) {
+			stats.TransfersToday++
+		}
+	}
+	return stats, nil
+}
+
+func (s *InMemoryStorage) CreateCustomer(c *Customer, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.customers {
+		if other.Email == c.Email {
+			return fmt.Errorf("%w: %s", ErrCustomerExists, c.Email)
+		}
+	}
+	c.ID = len(s.customers) + 1
+	c.CreatedAt = s.now()
+	stored := *c
+	s.customers[c.ID] = &stored
+	s.tokens[tokenHash] = c.ID
+	return nil
+}
+
+func (s *InMemoryStorage) CustomerByTokenHash(tokenHash string) (*Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.tokens[tokenHash]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	c := *s.customers[id]
+	return &c, nil
+}
+
+func (s *InMemoryStorage) AccountsForCustomer(customerID int, includeClosed bool) ([]*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accounts := []*Account{}
+	for accountID, owners := range s.owners {
+		if _, ok := owners[customerID]; ok && (includeClosed || s.accounts[accountID].Status != AccountClosed) {
+			accounts = append(accounts, copyAccount(s.accounts[accountID]))
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts, nil
+}
+
+func (s *InMemoryStorage) IsOwner(accountID, customerID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.owners[accountID][customerID]
+	return ok, nil
+}
+
+func (s *InMemoryStorage) Owners(accountID int) ([]*Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owners := []*Customer{}
+	for customerID := range s.owners[accountID] {
+		c := *s.customers[customerID]
+		owners = append(owners, &c)
+	}
+	linked := s.owners[accountID]
+	sort.Slice(owners, func(i, j int) bool {
+		a, b := linked[owners[i].ID], linked[owners[j].ID]
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return owners[i].ID < owners[j].ID
+	})
+	return owners, nil
+}
+
+func (s *InMemoryStorage) AddOwner(accountID, customerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.account(accountID); err != nil {
+		return err
+	}
+	if _, ok := s.customers[customerID]; !ok {
+		return fmt.Errorf("%w: %d", ErrCustomerNotFound, customerID)
+	}
+	if _, ok := s.owners[accountID][customerID]; !ok {
+		s.owners[accountID][customerID] = s.now()
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) RemoveOwner(accountID, customerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.account(accountID); err != nil {
+		return err
+	}
+	owners := s.owners[accountID]
+	if _, ok := owners[customerID]; !ok {
+		return fmt.Errorf("%w: customer %d does not own account %d", ErrCustomerNotFound, customerID, accountID)
+	}
+	if len(owners) == 1 {
+		return ErrLastOwner
+	}
+	delete(owners, customerID)
+	return nil
+}
+
+func (s *InMemoryStorage) Claim(ctx context.Context, key, fingerprint string, ttl time.Duration) (*StoredResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	rec, ok := s.idempotency[key]
+	if !ok || now.After(rec.expiresAt) || (rec.resp == nil && now.After(rec.lockedUntil)) {
+		s.idempotency[key] = &memoryIdempotency{
+			fingerprint: fingerprint,
+			lockedUntil: now.Add(idempotencyLock),
+			expiresAt:   now.Add(ttl),
+		}
+		return nil, nil
+	}
+	switch {
+	case rec.fingerprint != fingerprint:
+		return nil, ErrIdempotencyMismatch
+	case rec.resp == nil:
+		return nil, ErrIdempotencyInProgress
+	}
+	return rec.resp, nil
+}
+
+func (s *InMemoryStorage) Complete(ctx context.Context, key string, resp *StoredResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.idempotency[key]; ok {
+		stored := *resp
+		stored.Body = append([]byte(nil), resp.Body...)
+		rec.resp = &stored
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.idempotency[key]; ok && rec.resp == nil {
+		delete(s.idempotency, key)
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) CreateStandingOrder(o *StandingOrder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range []int{o.FromAccount, o.ToAccount} {
+		if _, err := s.account(id); err != nil {
+			return err
+		}
+	}
+	o.ID = int64(len(s.orders) + 1)
+	o.CreatedAt = s.now()
+	stored := *o
+	s.orders = append(s.orders, &stored)
+	return nil
+}
+
+func (s *InMemoryStorage) StandingOrders(accountID int) ([]*StandingOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders := []*StandingOrder{}
+	for _, o := range s.orders {
+		if o.FromAccount == accountID {
+			c := *o
+			orders = append(orders, &c)
+		}
+	}
+	return orders, nil
+}
+
+// standingOrder returns the stored order; callers must hold mu.
+func (s *InMemoryStorage) standingOrder(id int64) (*StandingOrder, error) {
+	if id < 1 || id > int64(len(s.orders)) {
+		return nil, fmt.Errorf("%w: %d", ErrStandingOrderNotFound, id)
+	}
+	return s.orders[id-1], nil
+}
+
+func (s *InMemoryStorage) StandingOrder(id int64) (*StandingOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, err := s.standingOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	c := *o
+	return &c, nil
+}
+
+func (s *InMemoryStorage) StandingOrderRuns(orderID int64, limit int) ([]*StandingOrderRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := []*StandingOrderRun{}
+	for i := len(s.orderRuns) - 1; i >= 0 && len(runs) < limit; i-- {
+		if run := s.orderRuns[i]; run.OrderID == orderID {
+			c := *run
+			runs = append(runs, &c)
+		}
+	}
+	return runs, nil
+}
+
+func (s *InMemoryStorage) CancelStandingOrder(id int64) (*StandingOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, err := s.standingOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	if o.Status == OrderActive {
+		o.Status = OrderCancelled
+		o.NextRunAt = nil
+	}
+	c := *o
+	return &c, nil
+}
+
+func (s *InMemoryStorage) DueStandingOrders(now time.Time, limit int) ([]*StandingOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := []*StandingOrder{}
+	for _, o := range s.orders {
+		if o.Status == OrderActive && o.NextRunAt != nil && !o.NextRunAt.After(now) {
+			c := *o
+			due = append(due, &c)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextRunAt.Before(*due[j].NextRunAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (s *InMemoryStorage) ClaimStandingOrderRun(orderID int64, scheduledFor time.Time) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.orderRuns {
+		if run.OrderID == orderID && run.ScheduledFor.Equal(scheduledFor) {
+			return 0, false, nil
+		}
+	}
+	run := &StandingOrderRun{
+		ID:           int64(len(s.orderRuns) + 1),
+		OrderID:      orderID,
+		ScheduledFor: scheduledFor,
+		CreatedAt:    s.now(),
+	}
+	s.orderRuns = append(s.orderRuns, run)
+	return run.ID, true, nil
+}
+
+func (s *InMemoryStorage) FinishStandingOrderRun(run *StandingOrderRun, next *time.Time, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.orderRuns[run.ID-1]
+	stored.TransferID, stored.Error = run.TransferID, run.Error
+	o, err := s.standingOrder(run.OrderID)
+	if err != nil {
+		return err
+	}
+	if o.Status == OrderActive {
+		o.NextRunAt, o.Status = next, status
+	}
+	lastRun := run.ScheduledFor
+	o.LastRunAt = &lastRun
+	o.LastError = run.Error
+	if run.Error == "" {
+		o.Failures = 0
+	} else {
+		o.Failures++
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) CountTransfersSince(accountID int, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, t := range s.transfers {
+		if t.FromAccount == accountID && !t.CreatedAt.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *InMemoryStorage) CreateHeldTransfer(h *HeldTransfer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h.ID = int64(len(s.held) + 1)
+	h.Status = HoldPending
+	h.CreatedAt = s.now()
+	c := *h
+	s.held = append(s.held, &c)
+	return nil
+}
+
+func (s *InMemoryStorage) HeldTransfers(status string, limit int) ([]*HeldTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	held := []*HeldTransfer{}
+	for _, h := range s.held {
+		if h.Status == status && len(held) < limit {
+			c := *h
+			held = append(held, &c)
+		}
+	}
+	return held, nil
+}
+
+// pendingHold returns a held transfer still waiting for review; callers
+// must hold mu.
+func (s *InMemoryStorage) pendingHold(id int64) (*HeldTransfer, error) {
+	if id < 1 || id > int64(len(s.held)) {
+		return nil, fmt.Errorf("%w: %d", ErrHeldTransferNotFound, id)
+	}
+	h := s.held[id-1]
+	if h.Status != HoldPending {
+		return nil, fmt.Errorf("%w: %d is %s", ErrHoldResolved, id, h.Status)
+	}
+	return h, nil
+}
+
+func (s *InMemoryStorage) ReleaseHeldTransfer(id int64, note string) (*HeldTransfer, *TransferRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.pendingHold(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	record, err := s.transfer(h.FromAccount, h.ToAccount, h.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	now, transferID := s.now(), record.ID
+	h.Status, h.TransferID, h.Note, h.ResolvedAt = HoldReleased, &transferID, note, &now
+	c := *h
+	return &c, record, nil
+}
+
+func (s *InMemoryStorage) RejectHeldTransfer(id int64, note string) (*HeldTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.pendingHold(id)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	h.Status, h.Note, h.ResolvedAt = HoldRejected, note, &now
+	c := *h
+	return &c, nil
+}
+
+func copyPendingTransfer(p *PendingTransfer) *PendingTransfer {
+	c := *p
+	c.Approvals = append([]Approval{}, p.Approvals...)
+	return &c
+}
+
+func (s *InMemoryStorage) CreatePendingTransfer(p *PendingTransfer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.ID = int64(len(s.pending) + 1)
+	p.Status = ApprovalPending
+	p.Approvals = []Approval{}
+	p.CreatedAt = s.now()
+	s.pending = append(s.pending, copyPendingTransfer(p))
+	return nil
+}
+
+func (s *InMemoryStorage) PendingTransfers(status string, limit int) ([]*PendingTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := []*PendingTransfer{}
+	for _, p := range s.pending {
+		if p.Status == status && len(pending) < limit {
+			pending = append(pending, copyPendingTransfer(p))
+		}
+	}
+	return pending, nil
+}
+
+// pendingTransfer returns a pending transfer still waiting for approval,
+// expiring it first if its time is up; callers must hold mu.
+func (s *InMemoryStorage) pendingTransfer(id int64) (*PendingTransfer, error) {
+	if id < 1 || id > int64(len(s.pending)) {
+		return nil, fmt.Errorf("%w: %d", ErrPendingTransferNotFound, id)
+	}
+	p := s.pending[id-1]
+	if now := s.now(); p.Status == ApprovalPending && !now.Before(p.ExpiresAt) {
+		p.Status, p.ResolvedAt = ApprovalExpired, &now
+		transferApprovals.WithLabelValues(ApprovalExpired).Inc()
+	}
+	if p.Status != ApprovalPending {
+		return nil, fmt.Errorf("%w: %d is %s", ErrApprovalResolved, id, p.Status)
+	}
+	return p, nil
+}
+
+func (s *InMemoryStorage) ApprovePendingTransfer(id int64, approver, note string) (*PendingTransfer, *TransferRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.pendingTransfer(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range p.Approvals {
+		if a.Approver == approver {
+			return nil, nil, fmt.Errorf("%w: %s on %d", ErrAlreadyApproved, approver, id)
+		}
+	}
+	now := s.now()
+	var record *TransferRecord
+	if len(p.Approvals)+1 >= p.RequiredApprovals {
+		if record, err = s.transfer(p.FromAccount, p.ToAccount, p.Amount); err != nil {
+			return nil, nil, err
+		}
+		transferID := record.ID
+		p.Status, p.TransferID, p.ResolvedAt = ApprovalApproved, &transferID, &now
+	}
+	p.Approvals = append(p.Approvals, Approval{Approver: approver, Note: note, CreatedAt: now})
+	return copyPendingTransfer(p), record, nil
+}
+
+func (s *InMemoryStorage) RejectPendingTransfer(id int64, approver, note string) (*PendingTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.pendingTransfer(id)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	p.Status, p.RejectedBy, p.Note, p.ResolvedAt = ApprovalRejected, approver, note, &now
+	return copyPendingTransfer(p), nil
+}
+
+func (s *InMemoryStorage) ExpirePendingTransfers() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now, n := s.now(), 0
+	for _, p := range s.pending {
+		if p.Status == ApprovalPending && !now.Before(p.ExpiresAt) {
+			p.Status, p.ResolvedAt = ApprovalExpired, &now
+			n++
+		}
+	}
+	return n, nil
+}
+
+func copyKYCApplication(app *KYCApplication) *KYCApplication {
+	c := *app
+	c.Documents = append([]KYCDocument{}, app.Documents...)
+	if app.Verification != nil {
+		v := *app.Verification
+		v.Reasons = append([]string(nil), v.Reasons...)
+		c.Verification = &v
+	}
+	return &c
+}
+
+func (s *InMemoryStorage) SubmitKYC(customerID int, docs []KYCDocument) (*KYCApplication, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.customers[customerID]; !ok {
+		return nil, fmt.Errorf("%w: %d", ErrCustomerNotFound, customerID)
+	}
+	if app, ok := s.kyc[customerID]; ok {
+		if err := checkKYCTransition(customerID, app.Status, KYCSubmitted); err != nil {
+			return nil, err
+		}
+	}
+	now := s.now()
+	app := &KYCApplication{
+		CustomerID:  customerID,
+		Status:      KYCSubmitted,
+		Documents:   append([]KYCDocument{}, docs...),
+		SubmittedAt: now,
+		UpdatedAt:   now,
+	}
+	s.kyc[customerID] = app
+	return copyKYCApplication(app), nil
+}
+
+func (s *InMemoryStorage) KYCApplication(customerID int) (*KYCApplication, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	app, ok := s.kyc[customerID]
+	if !ok {
+		return nil, fmt.Errorf("%w: customer %d", ErrKYCNotFound, customerID)
+	}
+	return copyKYCApplication(app), nil
+}
+
+func (s *InMemoryStorage) KYCApplications(status string, limit int) ([]*KYCApplication, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	apps := []*KYCApplication{}
+	for _, app := range s.kyc {
+		if app.Status == status {
+			apps = append(apps, copyKYCApplication(app))
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if !apps[i].SubmittedAt.Equal(apps[j].SubmittedAt) {
+			return apps[i].SubmittedAt.Before(apps[j].SubmittedAt)
+		}
+		return apps[i].CustomerID < apps[j].CustomerID
+	})
+	if len(apps) > limit {
+		apps = apps[:limit]
+	}
+	return apps, nil
+}
+
+func (s *InMemoryStorage) SetKYCStatus(customerID int, status, note string) (*KYCApplication, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	app, ok := s.kyc[customerID]
+	if !ok {
+		return nil, fmt.Errorf("%w: customer %d", ErrKYCNotFound, customerID)
+	}
+	if err := checkKYCTransition(customerID, app.Status, status); err != nil {
+		return nil, err
+	}
+	now := s.now()
+	app.Status, app.Note, app.UpdatedAt, app.ReviewedAt = status, note, now, nil
+	if status == KYCApproved || status == KYCRejected {
+		app.ReviewedAt = &now
+	}
+	return copyKYCApplication(app), nil
+}
+
+func (s *InMemoryStorage) SetKYCVerification(customerID int, v *KYCVerification) (*KYCApplication, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	app, ok := s.kyc[customerID]
+	if !ok {
+		return nil, fmt.Errorf("%w: customer %d", ErrKYCNotFound, customerID)
+	}
+	if app.Status != KYCInReview {
+		return nil, fmt.Errorf("%w: application of customer %d is %s, not in review", ErrInvalidKYCTransition, customerID, app.Status)
+	}
+	c := *v
+	app.Verification, app.UpdatedAt = &c, s.now()
+	return copyKYCApplication(app), nil
+}
+
+func copyAPIKey(k *APIKey) *APIKey {
+	c := *k
+	c.Scopes = append([]string{}, k.Scopes...)
+	return &c
+}
+
+func (s *InMemoryStorage) CreateAPIKey(k *APIKey, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.customers[k.CustomerID]; !ok {
+		return fmt.Errorf("%w: %d", ErrCustomerNotFound, k.CustomerID)
+	}
+	k.ID = int64(len(s.apiKeys) + 1)
+	k.CreatedAt = s.now()
+	s.apiKeys = append(s.apiKeys, copyAPIKey(k))
+	s.apiKeyIDs[keyHash] = k.ID
+	return nil
+}
+
+func (s *InMemoryStorage) APIKeyByHash(keyHash string) (*APIKey, *Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.apiKeyIDs[keyHash]
+	if !ok {
+		return nil, nil, ErrAPIKeyNotFound
+	}
+	k := s.apiKeys[id-1]
+	c := *s.customers[k.CustomerID]
+	return copyAPIKey(k), &c, nil
+}
+
+func (s *InMemoryStorage) APIKeys(customerID int) ([]*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []*APIKey{}
+	for _, k := range s.apiKeys {
+		if customerID == 0 || k.CustomerID == customerID {
+			keys = append(keys, copyAPIKey(k))
+		}
+	}
+	return keys, nil
+}
+
+func (s *InMemoryStorage) RevokeAPIKey(id int64, customerID int) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > int64(len(s.apiKeys)) || customerID != 0 && s.apiKeys[id-1].CustomerID != customerID {
+		return nil, fmt.Errorf("%w: %d", ErrAPIKeyNotFound, id)
+	}
+	k := s.apiKeys[id-1]
+	if k.RevokedAt == nil {
+		now := s.now()
+		k.RevokedAt = &now
+	}
+	return copyAPIKey(k), nil
+}
+
+func (s *InMemoryStorage) TouchAPIKey(id int64, at time.Time, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > int64(len(s.apiKeys)) {
+		return fmt.Errorf("%w: %d", ErrAPIKeyNotFound, id)
+	}
+	k := s.apiKeys[id-1]
+	if k.LastUsedAt == nil || k.LastUsedAt.Before(at) {
+		k.LastUsedAt, k.LastUsedIP = &at, ip
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) NotificationPreferences(accountID int) (*NotificationPreferences, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.notify[accountID]
+	if !ok {
+		return nil, fmt.Errorf("%w: account %d", ErrNotificationsNotFound, accountID)
+	}
+	c := *p
+	c.Events = append([]string{}, p.Events...)
+	return &c, nil
+}
+
+func (s *InMemoryStorage) SetNotificationPreferences(p *NotificationPreferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.account(p.AccountID); err != nil {
+		return err
+	}
+	p.UpdatedAt = s.now()
+	c := *p
+	c.Events = append([]string{}, p.Events...)
+	s.notify[p.AccountID] = &c
+	return nil
+}
+
+func (s *InMemoryStorage) DeleteNotificationPreferences(accountID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notify, accountID)
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gobank_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	transfersTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_transfers_total",
+		Help: "Completed transfers by source currency.",
+	}, []string{"currency"})
+	transferVolume = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_transfer_volume_minor_units_total",
+		Help: "Amount debited by completed transfers, in minor units of the source currency.",
+	}, []string{"currency"})
+	transfersFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_transfers_failed_total",
+		Help: "Rejected or failed transfers by error code.",
+	}, []string{"code"})
+	transfersHeld = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gobank_transfers_held_total",
+		Help: "Transfers held for review by the velocity rule or a fraud check.",
+	})
+	transferApprovals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_transfer_approvals_total",
+		Help: "Transfers sent to approval and how their approval ended.",
+	}, []string{"outcome"})
+	fraudChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_fraud_checks_total",
+		Help: "Fraud checks by transaction kind and decision.",
+	}, []string{"kind", "decision"})
+	kycApplications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_kyc_applications_total",
+		Help: "KYC applications moved to each review status.",
+	}, []string{"status"})
+	kycVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_kyc_verifications_total",
+		Help: "KYC verification provider checks by decision, or error.",
+	}, []string{"decision"})
+	apiKeyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_api_key_requests_total",
+		Help: "Requests authenticated with API keys, by whether the key and its scopes allowed them.",
+	}, []string{"outcome"})
+	accountCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_account_cache_lookups_total",
+		Help: "Account cache lookups by result: hit, miss, or error when the cache could not be read.",
+	}, []string{"result"})
+	dbRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_db_retries_total",
+		Help: "Database operations retried after a transient error, by operation.",
+	}, []string{"operation"})
+	dbRetriesExhausted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_db_retries_exhausted_total",
+		Help: "Database operations that still failed with a transient error after every attempt, by operation.",
+	}, []string{"operation"})
+	accountVersionConflicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_account_version_conflicts_total",
+		Help: "Account updates that found the account changed concurrently, by result: retried, or exhausted after every attempt.",
+	}, []string{"result"})
+	notificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gobank_notifications_total",
+		Help: "Balance change notification attempts by channel and result: delivered, retried or failed.",
+	}, []string{"channel", "result"})
+	notificationsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gobank_notifications_dropped_total",
+		Help: "Balance changes not notified because the notification queue was full.",
+	})
+)
+
+func observeRequest(method, route string, status int, elapsed time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// observeTransfer records the outcome of a transfer request.
+func observeTransfer(record *TransferRecord, err error) {
+	if err != nil {
+		_, body := errorResponse(err)
+		transfersFailed.WithLabelValues(body.Code).Inc()
+		return
+	}
+	currency := string(record.Debit.Currency)
+	transfersTotal.WithLabelValues(currency).Inc()
+	transferVolume.WithLabelValues(currency).Add(float64(record.Debit.Amount))
+}
+
+// routeLabel is router middleware that reports the matched route template
+// to observe, keeping metric label cardinality bounded by the routes.
+func routeLabel(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(requestInfoKey).(*requestInfo); ok {
+			if tpl, err := mux.CurrentRoute(r).GetPathTemplate(); err == nil {
+				info.route = tpl
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// migrations are applied in order at startup and recorded in
+// schema_migrations. Never edit a released migration; append a new one.
+var migrations = []string{
+	// 1: accounts
+	`create table account (
+		id serial primary key,
+		first_name varchar(100) not null,
+		last_name varchar(100) not null,
+		number bigint not null unique,
+		balance bigint not null default 0,
+		created_at timestamptz not null default now()
+	)`,
+	// 2: transfer history
+	`create table transfer (
+		id bigserial primary key,
+		from_account integer not null references account (id),
+		to_account integer not null references account (id),
+		amount bigint not null check (amount > 0),
+		created_at timestamptz not null default now()
+	)`,
+	// 3: overdraft limits
+	`alter table account add column overdraft_limit bigint not null default 0 check (overdraft_limit >= 0)`,
+	// 4: deposits and withdrawals, deduplicated by idempotency key
+	`create table account_entry (
+		id bigserial primary key,
+		account_id integer not null references account (id),
+		kind varchar(20) not null,
+		amount bigint not null check (amount > 0),
+		balance_after bigint not null,
+		idempotency_key varchar(255) unique,
+		created_at timestamptz not null default now()
+	)`,
+	// 5: account numbers allocated from a sequence, see accountnumber.go
+	`create sequence account_number_seq minvalue 10000000 maxvalue 99999999 start 10000000`,
+	// 6: currencies; existing rows predate multi-currency support and are USD
+	`alter table account add column currency char(3) not null default 'USD';
+	alter table transfer add column currency char(3) not null default 'USD';
+	alter table transfer add column credit_amount bigint;
+	alter table transfer add column credit_currency char(3);
+	update transfer set credit_amount = amount, credit_currency = currency;
+	alter table transfer alter column credit_amount set not null;
+	alter table transfer alter column credit_currency set not null`,
+	// 7: savings accounts and interest accrual, see interest.go
+	`alter table account add column account_type varchar(20) not null default 'checking';
+	alter table account add column interest_rate_bps integer not null default 0
+		check (interest_rate_bps between 0 and 10000);
+	alter table account add column interest_remainder bigint not null default 0;
+	alter table account add column interest_accrued_through date not null default current_date - 1`,
+	// 8: admin controls; a null daily_transfer_limit means unlimited
+	`alter table account add column frozen boolean not null default false;
+	alter table account add column daily_transfer_limit bigint check (daily_transfer_limit >= 0)`,
+	// 9: stored responses for the Idempotency-Key middleware; a null status
+	// means the original request is still in progress
+	`create table idempotency_response (
+		key varchar(255) primary key,
+		fingerprint char(64) not null,
+		status integer,
+		content_type text,
+		body bytea,
+		locked_until timestamptz,
+		expires_at timestamptz not null
+	)`,
+	// 10: customers and (joint) account ownership; accounts created before
+	// this have no owners and are only reachable with the admin token
+	`create table customer (
+		id serial primary key,
+		first_name varchar(100) not null,
+		last_name varchar(100) not null,
+		email varchar(255) not null unique,
+		token_hash char(64) not null unique,
+		created_at timestamptz not null default now()
+	);
+	create table account_owner (
+		account_id integer not null references account (id) on delete cascade,
+		customer_id integer not null references customer (id) on delete cascade,
+		created_at timestamptz not null default now(),
+		primary key (account_id, customer_id)
+	);
+	create index account_owner_customer_idx on account_owner (customer_id)`,
+
+	// 11: standing orders and the history of their runs. A run row is
+	// inserted before the transfer, so each occurrence runs at most once.
+	`create table standing_order (
+		id bigserial primary key,
+		from_account integer not null references account (id) on delete cascade,
+		to_account integer not null references account (id) on delete cascade,
+		amount bigint not null check (amount > 0),
+		schedule text not null,
+		end_date date,
+		status varchar(20) not null default 'active',
+		next_run_at timestamptz,
+		last_run_at timestamptz,
+		last_error text,
+		failures integer not null default 0,
+		created_at timestamptz not null default now()
+	);
+	create index standing_order_due_idx on standing_order (next_run_at) where status = 'active';
+	create index standing_order_from_idx on standing_order (from_account);
+	create table standing_order_run (
+		id bigserial primary key,
+		order_id bigint not null references standing_order (id) on delete cascade,
+		scheduled_for timestamptz not null,
+		transfer_id bigint,
+		error text,
+		created_at timestamptz not null default now(),
+		unique (order_id, scheduled_for)
+	)`,
+
+	// 12: account lifecycle status, replacing the frozen flag.
+	`alter table account add column status varchar(20) not null default 'active'
+		check (status in ('pending', 'active', 'frozen', 'closed'));
+	alter table account add column closed_at timestamptz;
+	update account set status = 'frozen' where frozen;
+	alter table account drop column frozen`,
+
+	// 13: indexes for GET /account sorting, keyset pagination and name
+	// prefix filters, see account_list.go
+	`create index account_balance_idx on account (balance, id);
+	create index account_created_at_idx on account (created_at, id);
+	create index account_last_name_idx on account (lower(last_name), id);
+	create index account_first_name_prefix_idx on account (lower(first_name) text_pattern_ops);
+	create index account_last_name_prefix_idx on account (lower(last_name) text_pattern_ops)`,
+
+	// 14: weekly transfer limits and transfers held by the velocity rule,
+	// see transfer_holds.go
+	`alter table account add column weekly_transfer_limit bigint check (weekly_transfer_limit >= 0);
+	create index transfer_from_created_idx on transfer (from_account, created_at);
+	create table held_transfer (
+		id bigserial primary key,
+		from_account integer not null references account (id) on delete cascade,
+		to_account integer not null references account (id) on delete cascade,
+		amount bigint not null check (amount > 0),
+		reason text not null,
+		status varchar(20) not null default 'held' check (status in ('held', 'released', 'rejected')),
+		transfer_id bigint references transfer (id),
+		note text not null default '',
+		created_at timestamptz not null default now(),
+		resolved_at timestamptz
+	);
+	create index held_transfer_status_idx on held_transfer (status, created_at)`,
+
+	// 15: transfers above the approval threshold and their approvals, see
+	// transfer_approvals.go
+	`create table pending_transfer (
+		id bigserial primary key,
+		from_account integer not null references account (id) on delete cascade,
+		to_account integer not null references account (id) on delete cascade,
+		amount bigint not null check (amount > 0),
+		requested_by integer references customer (id) on delete set null,
+		status varchar(20) not null default 'pending'
+			check (status in ('pending', 'approved', 'rejected', 'expired')),
+		required_approvals integer not null check (required_approvals > 0),
+		transfer_id bigint references transfer (id),
+		rejected_by text not null default '',
+		note text not null default '',
+		created_at timestamptz not null default now(),
+		expires_at timestamptz not null,
+		resolved_at timestamptz
+	);
+	create index pending_transfer_status_idx on pending_transfer (status, created_at);
+	create index pending_transfer_expires_idx on pending_transfer (expires_at) where status = 'pending';
+	create table transfer_approval (
+		pending_transfer_id bigint not null references pending_transfer (id) on delete cascade,
+		approver text not null,
+		note text not null default '',
+		created_at timestamptz not null default now(),
+		primary key (pending_transfer_id, approver)
+	)`,
+
+	// 16: customer KYC applications, see kyc.go
+	`create table kyc_application (
+		customer_id integer primary key references customer (id) on delete cascade,
+		status varchar(20) not null default 'submitted'
+			check (status in ('submitted', 'in_review', 'approved', 'rejected')),
+		documents jsonb not null,
+		verification jsonb,
+		note text not null default '',
+		submitted_at timestamptz not null default now(),
+		updated_at timestamptz not null default now(),
+		reviewed_at timestamptz
+	);
+	create index kyc_application_status_idx on kyc_application (status, submitted_at)`,
+
+	// 17: scoped API keys for third-party integrations, see apikeys.go
+	`create table api_key (
+		id bigserial primary key,
+		customer_id integer not null references customer (id) on delete cascade,
+		name text not null,
+		prefix text not null,
+		key_hash char(64) not null unique,
+		scopes text[] not null,
+		created_at timestamptz not null default now(),
+		expires_at timestamptz,
+		revoked_at timestamptz,
+		last_used_at timestamptz,
+		last_used_ip text not null default ''
+	);
+	create index api_key_customer_idx on api_key (customer_id, id)`,
+
+	// 18: trigram indexes for GET /account/search, see account_search.go;
+	// they also serve its prefix matches on the full name
+	`create extension if not exists pg_trgm;
+	create index account_first_name_trgm_idx on account using gin (lower(first_name) gin_trgm_ops);
+	create index account_last_name_trgm_idx on account using gin (lower(last_name) gin_trgm_ops);
+	create index account_full_name_trgm_idx on account using gin (lower(first_name || ' ' || last_name) gin_trgm_ops)`,
+	// 19: booking date indexes for regulatory exports, see regulatory_export.go
+	`create index transfer_created_at_idx on transfer (created_at);
+	create index account_entry_created_at_idx on account_entry (created_at)`,
+	// 20: balance change notification preferences, see notifications.go
+	`create table notification_preferences (
+		account_id integer primary key references account(id) on delete cascade,
+		email text not null default '',
+		webhook_url text not null default '',
+		events text[] not null default '{}',
+		min_amount bigint not null default 0 check (min_amount >= 0),
+		updated_at timestamptz not null default now()
+	)`,
+	// 21: account versions for optimistic locking, see account_update.go;
+	// the trigger bumps the version on every update, including balance
+	// changes made under row locks
+	`alter table account add column version bigint not null default 1;
+	create function account_bump_version() returns trigger language plpgsql as $$
+	begin
+		new.version := old.version + 1;
+		return new;
+	end
+	$$;
+	create trigger account_version before update on account
+		for each row execute function account_bump_version()`,
+}
+
+func (s *PostgresStore) migrate() error {
+	if _, err := s.db.Exec(`create table if not exists schema_migrations (
+		version integer primary key,
+		applied_at timestamptz not null default now()
+	)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := s.db.QueryRow("select coalesce(max(version), 0) from schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec("insert into schema_migrations (version) values ($1)", version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		slog.Info("applied migration", "version", version)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrCurrencyMismatch is returned when amounts in different currencies
+	// are combined without an exchange rate.
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrUnsupportedCurrency is returned for unknown currency codes.
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	// ErrNoExchangeRate is returned when no rate is known for a currency pair.
+	ErrNoExchangeRate = errors.New("no exchange rate")
+	// ErrAmountOverflow is returned when arithmetic exceeds int64 minor units.
+	ErrAmountOverflow = errors.New("amount overflow")
+)
+
+// Currency is an ISO 4217 currency code.
+type Currency string
+
+// DefaultCurrency is used for accounts created without a currency.
+const DefaultCurrency Currency = "USD"
+
+// currencyExponents maps supported currencies to their number of minor units.
+var currencyExponents = map[Currency]int{
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CHF": 2,
+	"INR": 2,
+	"JPY": 0,
+}
+
+// ParseCurrency validates and normalizes a currency code.
+func ParseCurrency(code string) (Currency, error) {
+	c := Currency(strings.ToUpper(strings.TrimSpace(code)))
+	if _, ok := currencyExponents[c]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedCurrency, code)
+	}
+	return c, nil
+}
+
+// Money is an amount in minor units (e.g. cents) of a currency.
+type Money struct {
+	Amount   int64    `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+// NewMoney creates an amount of minor units in currency.
+func NewMoney(amount int64, currency Currency) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Add returns m + o. Both must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	if (o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount) || (o.Amount < 0 && m.Amount < math.MinInt64-o.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - o. Both must be in the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, ErrAmountOverflow
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// String formats m in major units, e.g. "12.34 USD".
+func (m Money) String() string {
+	exp := currencyExponents[m.Currency]
+	if exp == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	unit := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/unit, exp, amount%unit, m.Currency)
+}
+
+// RateProvider supplies exchange rates. A rate converts one major unit of
+// from into major units of to.
+type RateProvider interface {
+	Rate(from, to Currency) (*big.Rat, error)
+}
+
+// Convert converts m to currency to, rounding half away from zero to the
+// target's minor units.
+func Convert(m Money, to Currency, rates RateProvider) (Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+	if rates == nil {
+		return Money{}, fmt.Errorf("%w: %s to %s", ErrCurrencyMismatch, m.Currency, to)
+	}
+	toExp, ok := currencyExponents[to]
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, to)
+	}
+	rate, err := rates.Rate(m.Currency, to)
+	if err != nil {
+		return Money{}, err
+	}
+
+	// minor(to) = minor(from) / 10^fromExp * rate * 10^toExp
+	v := new(big.Rat).SetInt64(m.Amount)
+	v.Mul(v, rate)
+	v.Mul(v, new(big.Rat).SetFrac(pow10(toExp), pow10(currencyExponents[m.Currency])))
+
+	num, den := v.Num(), v.Denom()
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+	if !q.IsInt64() {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Amount: q.Int64(), Currency: to}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// StaticRates is a RateProvider backed by a fixed table of rates.
+type StaticRates struct {
+	mu    sync.RWMutex
+	rates map[[2]Currency]*big.Rat
+}
+
+// NewStaticRates creates an empty rate table.
+func NewStaticRates() *StaticRates {
+	return &StaticRates{rates: make(map[[2]Currency]*big.Rat)}
+}
+
+// Set records the rate for converting from into to.
+func (s *StaticRates) Set(from, to Currency, rate *big.Rat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rates[[2]Currency{from, to}] = rate
+}
+
+func (s *StaticRates) Rate(from, to Currency) (*big.Rat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rate, ok := s.rates[[2]Currency{from, to}]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s to %s", ErrNoExchangeRate, from, to)
+	}
+	return rate, nil
+}
+
+// ratesFromEnv parses GOBANK_FX_RATES, e.g. "EUR/USD=1.08,USD/EUR=0.925".
+// It returns nil when unset, which disables cross-currency transfers.
+func ratesFromEnv() (RateProvider, error) {
+	v := os.Getenv("GOBANK_FX_RATES")
+	if v == "" {
+		return nil, nil
+	}
+	rates := NewStaticRates()
+	for _, pair := range strings.Split(v, ",") {
+		codes, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		fromCode, toCode, ok2 := strings.Cut(codes, "/")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("GOBANK_FX_RATES: invalid entry %q", pair)
+		}
+		from, err := ParseCurrency(fromCode)
+		if err != nil {
+			return nil, fmt.Errorf("GOBANK_FX_RATES: %w", err)
+		}
+		to, err := ParseCurrency(toCode)
+		if err != nil {
+			return nil, fmt.Errorf("GOBANK_FX_RATES: %w", err)
+		}
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("GOBANK_FX_RATES: invalid rate %q", value)
+		}
+		rates.Set(from, to, rate)
+	}
+	return rates, nil
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Balance change kinds, which accounts choose to be notified of.
+const (
+	NotifyDeposit     = "deposit"
+	NotifyWithdrawal  = "withdrawal"
+	NotifyTransferIn  = "transfer_in"
+	NotifyTransferOut = "transfer_out"
+)
+
+var notificationKinds = []string{NotifyDeposit, NotifyWithdrawal, NotifyTransferIn, NotifyTransferOut}
+
+// Notification channels, as used in metrics and logs.
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// notificationQueueSize bounds the balance changes waiting for dispatch;
+// further changes are dropped rather than slowing down the money movement
+// that caused them.
+const notificationQueueSize = 1000
+
+// notificationWorkers is how many balance changes are delivered at once.
+const notificationWorkers = 4
+
+// ErrNotificationsNotFound is returned for accounts without notification
+// preferences.
+var ErrNotificationsNotFound = errors.New("notification preferences not found")
+
+// NotificationPreferences choose where and about what an account's owners
+// are notified. An account without an email address or webhook URL gets
+// no notifications.
+type NotificationPreferences struct {
+	AccountID  int    `json:"accountId"`
+	Email      string `json:"email,omitempty"`
+	WebhookURL string `json:"webhookUrl,omitempty"`
+	// Events lists the balance change kinds to notify of; empty means all.
+	Events []string `json:"events"`
+	// MinAmount skips changes smaller than it, in minor units.
+	MinAmount int64     `json:"minAmount"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// wants reports whether c should be notified under p.
+func (p *NotificationPreferences) wants(c *BalanceChange) bool {
+	return (len(p.Events) == 0 || slices.Contains(p.Events, c.Kind)) && c.Amount.Amount >= p.MinAmount
+}
+
+// NotificationPreferencesRequest replaces an account's preferences.
+type NotificationPreferencesRequest struct {
+	Email      string   `json:"email"`
+	WebhookURL string   `json:"webhookUrl"`
+	Events     []string `json:"events"`
+	MinAmount  int64    `json:"minAmount"`
+}
+
+func (r *NotificationPreferencesRequest) Validate() error {
+	var v Validator
+	r.Email = strings.TrimSpace(r.Email)
+	r.WebhookURL = strings.TrimSpace(r.WebhookURL)
+	if r.Email != "" {
+		addr, err := mail.ParseAddress(r.Email)
+		v.Check(err == nil && addr.Name == "", "email", "must be an email address")
+	}
+	if r.WebhookURL != "" {
+		u, err := url.Parse(r.WebhookURL)
+		v.Check(err == nil && u.Scheme == "https" && u.Host != "", "webhookUrl", "must be an https URL")
+	}
+	v.Check(r.Email != "" || r.WebhookURL != "", "email", "or webhookUrl is required")
+	seen := make(map[string]bool)
+	for _, kind := range r.Events {
+		v.Checkf(slices.Contains(notificationKinds, kind), "events", "must only contain %s", strings.Join(notificationKinds, ", "))
+		v.Check(!seen[kind], "events", "must not repeat an event")
+		seen[kind] = true
+	}
+	slices.Sort(r.Events)
+	v.Check(r.MinAmount >= 0, "minAmount", "must not be negative")
+	return v.Err()
+}
+
+// NotificationStore persists notification preferences.
+type NotificationStore interface {
+	// NotificationPreferences returns the account's preferences, or
+	// ErrNotificationsNotFound.
+	NotificationPreferences(accountID int) (*NotificationPreferences, error)
+	// SetNotificationPreferences creates or replaces p.AccountID's
+	// preferences, setting UpdatedAt.
+	SetNotificationPreferences(p *NotificationPreferences) error
+	// DeleteNotificationPreferences turns an account's notifications off.
+	// Deleting missing preferences is not an error.
+	DeleteNotificationPreferences(accountID int) error
+}
+
+// BalanceChange is sent for a deposit, a withdrawal or one side of a
+// transfer once it is committed.
+type BalanceChange struct {
+	AccountID int    `json:"accountId"`
+	Kind      string `json:"kind"`
+	// Amount is what the account was credited or debited.
+	Amount Money `json:"amount"`
+	// BalanceAfter is only known for deposits and withdrawals.
+	BalanceAfter *int64 `json:"balanceAfter,omitempty"`
+	// Counterparty is the other account of a transfer.
+	Counterparty int `json:"counterparty,omitempty"`
+	// Reference identifies the entry or transfer, e.g. "transfer-42";
+	// receivers use it to drop the duplicates retries may cause.
+	Reference  string    `json:"reference"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// Notifier delivers balance changes through one channel.
+type Notifier interface {
+	// Channel names the notifier, e.g. "email".
+	Channel() string
+	// Notify delivers c to the recipient in p, if p names one for this
+	// channel. Errors wrapped by permanent are not retried.
+	Notify(ctx context.Context, p *NotificationPreferences, c *BalanceChange) error
+}
+
+// permanentError marks delivery failures that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error { return &permanentError{err} }
+
+// SMTPNotifier emails balance changes.
+type SMTPNotifier struct {
+	// Addr is the SMTP server, as host:port.
+	Addr string
+	From string
+	// Auth may be nil for servers that do not need it.
+	Auth smtp.Auth
+	// send is smtp.SendMail; tests may replace it.
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func (n *SMTPNotifier) Channel() string { return ChannelEmail }
+
+func (n *SMTPNotifier) Notify(_ context.Context, p *NotificationPreferences, c *BalanceChange) error {
+	if p.Email == "" {
+		return nil
+	}
+	send := n.send
+	if send == nil {
+		send = smtp.SendMail
+	}
+	return send(n.Addr, n.Auth, n.From, []string{p.Email}, balanceChangeEmail(n.From, p.Email, c))
+}
+
+// balanceChangeEmail formats c as a plain text email.
+func balanceChangeEmail(from, to string, c *BalanceChange) []byte {
+	var what string
+	switch c.Kind {
+	case NotifyDeposit:
+		what = fmt.Sprintf("%s was deposited to account %d.", c.Amount, c.AccountID)
+	case NotifyWithdrawal:
+		what = fmt.Sprintf("%s was withdrawn from account %d.", c.Amount, c.AccountID)
+	case NotifyTransferIn:
+		what = fmt.Sprintf("Account %d received %s from account %d.", c.AccountID, c.Amount, c.Counterparty)
+	case NotifyTransferOut:
+		what = fmt.Sprintf("Account %d sent %s to account %d.", c.AccountID, c.Amount, c.Counterparty)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\n", from, to)
+	fmt.Fprintf(&b, "Subject: Balance change on account %d\r\n", c.AccountID)
+	fmt.Fprintf(&b, "Date: %s\r\n", c.OccurredAt.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(what + "\r\n")
+	if c.BalanceAfter != nil {
+		fmt.Fprintf(&b, "The new balance is %s.\r\n", NewMoney(*c.BalanceAfter, c.Amount.Currency))
+	}
+	fmt.Fprintf(&b, "\r\nReference: %s\r\n", c.Reference)
+	return []byte(b.String())
+}
+
+// WebhookSignatureHeader carries the hex HMAC-SHA256 of a webhook body,
+// keyed with the webhook secret, as "sha256=<hex>".
+const WebhookSignatureHeader = "X-Gobank-Signature"
+
+// WebhookNotifier POSTs balance changes as JSON to the account's webhook
+// URL, signed with Secret.
+type WebhookNotifier struct {
+	Secret []byte
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Channel() string { return ChannelWebhook }
+
+func (n *WebhookNotifier) Notify(ctx context.Context, p *NotificationPreferences, c *BalanceChange) error {
+	if p.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(c)
+	if err != nil {
+		return permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return permanent(err)
+	}
+	mac := hmac.New(sha256.New, n.Secret)
+	mac.Write(body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return permanent(fmt.Errorf("webhook returned %s", resp.Status))
+	}
+	return fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+// NotificationDispatcher delivers balance changes in the background.
+// Delivery is at least once while the process runs, with retries, but
+// changes still queued at shutdown are lost.
+type NotificationDispatcher struct {
+	prefs     NotificationStore
+	accounts  interface{ GetAccountByID(int) (*Account, error) }
+	notifiers []Notifier
+	queue     chan BalanceChange
+	// MaxAttempts bounds the deliveries of a change per channel.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling for each
+	// further one.
+	Backoff time.Duration
+}
+
+// NewNotificationDispatcher delivers changes through notifiers to the
+// accounts with preferences in prefs. accounts fills in the currency of
+// deposits and withdrawals.
+func NewNotificationDispatcher(prefs NotificationStore, accounts interface{ GetAccountByID(int) (*Account, error) }, notifiers ...Notifier) *NotificationDispatcher {
+	return &NotificationDispatcher{
+		prefs:       prefs,
+		accounts:    accounts,
+		notifiers:   notifiers,
+		queue:       make(chan BalanceChange, notificationQueueSize),
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+	}
+}
+
+// Enqueue queues c for delivery without blocking. It drops c when the
+// queue is full.
+func (d *NotificationDispatcher) Enqueue(c BalanceChange) {
+	select {
+	case d.queue <- c:
+	default:
+		notificationsDropped.Inc()
+		slog.Warn("notification queue full, dropping balance change", "account", c.AccountID, "reference", c.Reference)
+	}
+}
+
+// Run delivers queued changes until ctx is done.
+func (d *NotificationDispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < notificationWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case c := <-d.queue:
+					d.dispatch(ctx, &c)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(d.queue); n > 0 {
+		slog.Warn("dropping undelivered notifications at shutdown", "count", n)
+	}
+}
+
+func (d *NotificationDispatcher) dispatch(ctx context.Context, c *BalanceChange) {
+	p, err := d.prefs.NotificationPreferences(c.AccountID)
+	if errors.Is(err, ErrNotificationsNotFound) {
+		return
+	}
+	if err != nil {
+		slog.Error("load notification preferences", "account", c.AccountID, "error", err)
+		return
+	}
+	if !p.wants(c) {
+		return
+	}
+	if c.Amount.Currency == "" {
+		acc, err := d.accounts.GetAccountByID(c.AccountID)
+		if err != nil {
+			slog.Error("load account for notification", "account", c.AccountID, "error", err)
+			return
+		}
+		c.Amount.Currency = acc.Currency
+	}
+	for _, n := range d.notifiers {
+		d.deliver(ctx, n, p, c)
+	}
+}
+
+// deliver sends c through n, retrying with exponential backoff.
+func (d *NotificationDispatcher) deliver(ctx context.Context, n Notifier, p *NotificationPreferences, c *BalanceChange) {
+	wait := d.Backoff
+	for attempt := 1; ; attempt++ {
+		err := n.Notify(ctx, p, c)
+		if err == nil {
+			notificationsSent.WithLabelValues(n.Channel(), "delivered").Inc()
+			return
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) || attempt >= d.MaxAttempts {
+			notificationsSent.WithLabelValues(n.Channel(), "failed").Inc()
+			slog.Error("notification failed", "channel", n.Channel(), "account", c.AccountID,
+				"reference", c.Reference, "attempts", attempt, "error", err)
+			return
+		}
+		notificationsSent.WithLabelValues(n.Channel(), "retried").Inc()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// NotifyingStorage wraps a Storage to queue a BalanceChange for every
+// committed deposit, withdrawal and transfer, whichever API or background
+// job made it. Replayed idempotent requests are not notified again.
+// Released holds and approved transfers are notified by
+// notifyingHoldStore and notifyingApprovalStore.
+type NotifyingStorage struct {
+	Storage
+	notify func(BalanceChange)
+}
+
+// NewNotifyingStorage queues the balance changes of next on d.
+func NewNotifyingStorage(next Storage, d *NotificationDispatcher) *NotifyingStorage {
+	return &NotifyingStorage{Storage: next, notify: d.Enqueue}
+}
+
+func (s *NotifyingStorage) Deposit(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+	entry, err := s.Storage.Deposit(id, amount, idempotencyKey)
+	s.entryChanged(NotifyDeposit, entry, err)
+	return entry, err
+}
+
+func (s *NotifyingStorage) Withdraw(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+	entry, err := s.Storage.Withdraw(id, amount, idempotencyKey)
+	s.entryChanged(NotifyWithdrawal, entry, err)
+	return entry, err
+}
+
+func (s *NotifyingStorage) entryChanged(kind string, entry *AccountEntry, err error) {
+	if err != nil || entry.Replayed {
+		return
+	}
+	balance := entry.BalanceAfter
+	s.notify(BalanceChange{
+		AccountID:    entry.AccountID,
+		Kind:         kind,
+		Amount:       Money{Amount: entry.Amount},
+		BalanceAfter: &balance,
+		Reference:    "entry-" + strconv.FormatInt(entry.ID, 10),
+		OccurredAt:   entry.CreatedAt,
+	})
+}
+
+func (s *NotifyingStorage) Transfer(fromID, toID int, amount int64) (*TransferRecord, error) {
+	record, err := s.Storage.Transfer(fromID, toID, amount)
+	if err != nil {
+		return record, err
+	}
+	notifyTransfer(s.notify, record)
+	return record, nil
+}
+
+// notifyTransfer queues the balance changes of both sides of record.
+func notifyTransfer(notify func(BalanceChange), record *TransferRecord) {
+	ref := "transfer-" + strconv.FormatInt(record.ID, 10)
+	notify(BalanceChange{AccountID: record.FromAccount, Kind: NotifyTransferOut, Amount: record.Debit,
+		Counterparty: record.ToAccount, Reference: ref, OccurredAt: record.CreatedAt})
+	notify(BalanceChange{AccountID: record.ToAccount, Kind: NotifyTransferIn, Amount: record.Credit,
+		Counterparty: record.FromAccount, Reference: ref, OccurredAt: record.CreatedAt})
+}
+
+// notifyingHoldStore queues the balance changes of released held
+// transfers, which move money without passing through Storage.
+type notifyingHoldStore struct {
+	TransferHoldStore
+	notify func(BalanceChange)
+}
+
+func (s *notifyingHoldStore) ReleaseHeldTransfer(id int64, note string) (*HeldTransfer, *TransferRecord, error) {
+	held, record, err := s.TransferHoldStore.ReleaseHeldTransfer(id, note)
+	if err == nil {
+		notifyTransfer(s.notify, record)
+	}
+	return held, record, err
+}
+
+// notifyingApprovalStore queues the balance changes of transfers once
+// their last approval executes them.
+type notifyingApprovalStore struct {
+	TransferApprovalStore
+	notify func(BalanceChange)
+}
+
+func (s *notifyingApprovalStore) ApprovePendingTransfer(id int64, approver, note string) (*PendingTransfer, *TransferRecord, error) {
+	pending, record, err := s.TransferApprovalStore.ApprovePendingTransfer(id, approver, note)
+	if err == nil && record != nil {
+		notifyTransfer(s.notify, record)
+	}
+	return pending, record, err
+}
+
+// notificationsFromEnv configures the notifiers: email through the SMTP
+// server at GOBANK_SMTP_ADDR, sending as GOBANK_SMTP_FROM and logging in
+// with GOBANK_SMTP_USERNAME and GOBANK_SMTP_PASSWORD if set, and webhooks
+// signed with GOBANK_WEBHOOK_SECRET, timing out after
+// GOBANK_WEBHOOK_TIMEOUT. GOBANK_NOTIFY_MAX_ATTEMPTS bounds deliveries per
+// channel. It returns no notifiers when neither channel is configured.
+func notificationsFromEnv() ([]Notifier, int, error) {
+	var notifiers []Notifier
+	if addr := os.Getenv("GOBANK_SMTP_ADDR"); addr != "" {
+		from := os.Getenv("GOBANK_SMTP_FROM")
+		if _, err := mail.ParseAddress(from); err != nil {
+			return nil, 0, errors.New("GOBANK_SMTP_FROM must be an email address when GOBANK_SMTP_ADDR is set")
+		}
+		n := &SMTPNotifier{Addr: addr, From: from}
+		if user := os.Getenv("GOBANK_SMTP_USERNAME"); user != "" {
+			host, _, _ := strings.Cut(addr, ":")
+			n.Auth = smtp.PlainAuth("", user, os.Getenv("GOBANK_SMTP_PASSWORD"), host)
+		}
+		notifiers = append(notifiers, n)
+	}
+	if secret := os.Getenv("GOBANK_WEBHOOK_SECRET"); secret != "" {
+		timeout := 5 * time.Second
+		if v := os.Getenv("GOBANK_WEBHOOK_TIMEOUT"); v != "" {
+			var err error
+			if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 {
+				return nil, 0, errors.New("GOBANK_WEBHOOK_TIMEOUT must be a positive duration")
+			}
+		}
+		notifiers = append(notifiers, &WebhookNotifier{Secret: []byte(secret), Client: &http.Client{Timeout: timeout}})
+	}
+	maxAttempts := 5
+	if v := os.Getenv("GOBANK_NOTIFY_MAX_ATTEMPTS"); v != "" {
+		var err error
+		if maxAttempts, err = strconv.Atoi(v); err != nil || maxAttempts <= 0 {
+			return nil, 0, errors.New("GOBANK_NOTIFY_MAX_ATTEMPTS must be a positive integer")
+		}
+	}
+	return notifiers, maxAttempts, nil
+}
+
+func (s *APIServer) notificationRoutes(router *mux.Router) {
+	router.HandleFunc("/account/{id}/notifications", makeHTTPHandleFunc(s.accountOwner(s.requireNotifications(s.handleGetNotifications)))).Methods(http.MethodGet)
+	router.HandleFunc("/account/{id}/notifications", makeHTTPHandleFunc(s.accountOwner(s.requireNotifications(s.handleSetNotifications)))).Methods(http.MethodPut)
+	router.HandleFunc("/account/{id}/notifications", makeHTTPHandleFunc(s.accountOwner(s.requireNotifications(s.handleDeleteNotifications)))).Methods(http.MethodDelete)
+}
+
+func (s *APIServer) requireNotifications(f apiFunc) apiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if s.notifications == nil {
+			return &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: errors.New("notifications are not configured")}
+		}
+		return f(w, r)
+	}
+}
+
+// handleGetNotifications returns the account's preferences; accounts
+// without any get empty ones, which notify nobody.
+func (s *APIServer) handleGetNotifications(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	p, err := s.notifications.NotificationPreferences(id)
+	if errors.Is(err, ErrNotificationsNotFound) {
+		p, err = &NotificationPreferences{AccountID: id, Events: []string{}}, nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, p, nil)
+}
+
+func (s *APIServer) handleSetNotifications(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	req := new(NotificationPreferencesRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	p := &NotificationPreferences{
+		AccountID:  id,
+		Email:      req.Email,
+		WebhookURL: req.WebhookURL,
+		Events:     req.Events,
+		MinAmount:  req.MinAmount,
+	}
+	if p.Events == nil {
+		p.Events = []string{}
+	}
+	if err := s.notifications.SetNotificationPreferences(p); err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, p, nil)
+}
+
+func (s *APIServer) handleDeleteNotifications(w http.ResponseWriter, r *http.Request) error {
+	id, err := getID(r)
+	if err != nil {
+		return err
+	}
+	if err := s.notifications.DeleteNotificationPreferences(id); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *PostgresStore) NotificationPreferences(accountID int) (*NotificationPreferences, error) {
+	p := &NotificationPreferences{AccountID: accountID}
+	var events pq.StringArray
+	err := s.db.QueryRow(`select email, webhook_url, events, min_amount, updated_at
+	from notification_preferences where account_id = $1`, accountID).
+		Scan(&p.Email, &p.WebhookURL, &events, &p.MinAmount, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: account %d", ErrNotificationsNotFound, accountID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Events = []string(events)
+	return p, nil
+}
+
+func (s *PostgresStore) SetNotificationPreferences(p *NotificationPreferences) error {
+	err := s.db.QueryRow(`insert into notification_preferences (account_id, email, webhook_url, events, min_amount)
+	values ($1, $2, $3, $4, $5)
+	on conflict (account_id) do update set email = excluded.email, webhook_url = excluded.webhook_url,
+		events = excluded.events, min_amount = excluded.min_amount, updated_at = now()
+	returning updated_at`, p.AccountID, p.Email, p.WebhookURL, pq.StringArray(p.Events), p.MinAmount).
+		Scan(&p.UpdatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return fmt.Errorf("%w: %d", ErrAccountNotFound, p.AccountID)
+	}
+	return err
+}
+
+func (s *PostgresStore) DeleteNotificationPreferences(accountID int) error {
+	_, err := s.db.Exec("delete from notification_preferences where account_id = $1", accountID)
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newNotifyTestStore returns a store holding two active accounts, the
+// first funded with 1000.
+func newNotifyTestStore(t *testing.T) (*InMemoryStorage, *Account, *Account) {
+	t.Helper()
+	store := NewInMemoryStorage(nil)
+	from := &Account{FirstName: "Ada", LastName: "Lovelace", Balance: 1000, Status: AccountActive}
+	to := &Account{FirstName: "Alan", LastName: "Turing", Status: AccountActive}
+	for _, acc := range []*Account{from, to} {
+		if err := store.CreateAccount(acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store, from, to
+}
+
+// checkTransferNotified checks changes are the two sides of record.
+func checkTransferNotified(t *testing.T, changes []BalanceChange, record *TransferRecord) {
+	t.Helper()
+	if len(changes) != 2 {
+		t.Fatalf("got %d balance changes, want 2: %+v", len(changes), changes)
+	}
+	out, in := changes[0], changes[1]
+	if out.AccountID != record.FromAccount || out.Kind != NotifyTransferOut || out.Counterparty != record.ToAccount {
+		t.Errorf("debit notified as %+v", out)
+	}
+	if in.AccountID != record.ToAccount || in.Kind != NotifyTransferIn || in.Counterparty != record.FromAccount {
+		t.Errorf("credit notified as %+v", in)
+	}
+}
+
+func TestNotifyReleasedHold(t *testing.T) {
+	store, from, to := newNotifyTestStore(t)
+	var changes []BalanceChange
+	holds := &notifyingHoldStore{TransferHoldStore: store, notify: func(c BalanceChange) { changes = append(changes, c) }}
+
+	h := &HeldTransfer{FromAccount: from.ID, ToAccount: to.ID, Amount: 300, Reason: "velocity"}
+	if err := holds.CreateHeldTransfer(h); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("holding a transfer notified %+v", changes)
+	}
+	_, record, err := holds.ReleaseHeldTransfer(h.ID, "checked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransferNotified(t, changes, record)
+
+	// Releasing it again fails and moves nothing.
+	changes = nil
+	if _, _, err := holds.ReleaseHeldTransfer(h.ID, "again"); err == nil {
+		t.Fatal("released a hold twice")
+	}
+	if len(changes) != 0 {
+		t.Errorf("failed release notified %+v", changes)
+	}
+}
+
+func TestNotifyApprovedTransfer(t *testing.T) {
+	store, from, to := newNotifyTestStore(t)
+	var changes []BalanceChange
+	approvals := &notifyingApprovalStore{TransferApprovalStore: store, notify: func(c BalanceChange) { changes = append(changes, c) }}
+
+	p := &PendingTransfer{FromAccount: from.ID, ToAccount: to.ID, Amount: 300, RequiredApprovals: 2,
+		ExpiresAt: time.Now().Add(time.Hour)}
+	if err := approvals.CreatePendingTransfer(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := approvals.ApprovePendingTransfer(p.ID, "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("first of two approvals notified %+v", changes)
+	}
+	_, record, err := approvals.ApprovePendingTransfer(p.ID, "bob", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransferNotified(t, changes, record)
+}
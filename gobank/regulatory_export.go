@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Regulatory export states.
+const (
+	ExportQueued    = "queued"
+	ExportRunning   = "running"
+	ExportSucceeded = "succeeded"
+	ExportFailed    = "failed"
+)
+
+// regulatoryFormat names the layout of the files and manifest, so the
+// regulator's tooling can reject exports it does not understand.
+const regulatoryFormat = "gobank-regulatory/v1"
+
+// maxRegulatoryExportDays bounds the period of one export; reports are
+// filed at most yearly.
+const maxRegulatoryExportDays = 366
+
+var (
+	// ErrExportNotFound is returned for unknown export IDs.
+	ErrExportNotFound = errors.New("export not found")
+	// ErrExportQueueFull is returned when too many exports are waiting.
+	ErrExportQueueFull = errors.New("too many exports queued, retry later")
+)
+
+// RegulatoryAccount is an account as reported to the regulator, with its
+// balance at the end of the reported period.
+type RegulatoryAccount struct {
+	*Account
+	ClosingBalance int64
+}
+
+// RegulatoryTransaction is a deposit, withdrawal, interest credit or
+// transfer. Reference is unique across kinds: "E" and the entry ID for
+// single-account entries, "T" and the transfer ID for transfers. A zero
+// FromAccount or ToAccount is money entering or leaving the bank.
+type RegulatoryTransaction struct {
+	Reference      string
+	Kind           string
+	BookedAt       time.Time
+	FromAccount    int
+	ToAccount      int
+	Amount         int64
+	Currency       Currency
+	CreditAmount   int64
+	CreditCurrency Currency
+}
+
+// RegulatoryWriter receives an export as it is read: every account, by ID,
+// then every transaction, in booking order.
+type RegulatoryWriter interface {
+	Account(acc RegulatoryAccount) error
+	Transaction(tx RegulatoryTransaction) error
+}
+
+// RegulatoryFile is one CSV file of an export. Large exports are split
+// into parts numbered from 1.
+type RegulatoryFile struct {
+	Key    string `json:"key"`
+	Kind   string `json:"kind"`
+	Part   int    `json:"part"`
+	Rows   int    `json:"rows"`
+	Bytes  int    `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// RegulatoryManifest is written last, so an export is complete once its
+// manifest exists.
+type RegulatoryManifest struct {
+	Format       string           `json:"format"`
+	ExportID     string           `json:"exportId"`
+	From         string           `json:"from"`
+	To           string           `json:"to"`
+	GeneratedAt  time.Time        `json:"generatedAt"`
+	Accounts     int              `json:"accounts"`
+	Transactions int              `json:"transactions"`
+	Files        []RegulatoryFile `json:"files"`
+}
+
+// RegulatoryExport is the status of an export job. The counts and files
+// grow while it runs.
+type RegulatoryExport struct {
+	ID           string           `json:"id"`
+	Status       string           `json:"status"`
+	From         string           `json:"from"`
+	To           string           `json:"to"`
+	Accounts     int              `json:"accounts"`
+	Transactions int              `json:"transactions"`
+	Files        []RegulatoryFile `json:"files"`
+	// ManifestKey and ManifestSHA256 are set once the export succeeded.
+	ManifestKey    string     `json:"manifestKey,omitempty"`
+	ManifestSHA256 string     `json:"manifestSha256,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	StartedAt      *time.Time `json:"startedAt,omitempty"`
+	FinishedAt     *time.Time `json:"finishedAt,omitempty"`
+}
+
+// RegulatoryExportRequest selects the UTC days From through To inclusive.
+type RegulatoryExportRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	from, to time.Time
+}
+
+// Validate parses the period, which must have ended by today.
+func (req *RegulatoryExportRequest) Validate() error {
+	var v Validator
+	var fromErr, toErr error
+	req.from, fromErr = time.Parse(time.DateOnly, req.From)
+	v.Check(fromErr == nil, "from", "must be a date like 2006-01-02")
+	req.to, toErr = time.Parse(time.DateOnly, req.To)
+	v.Check(toErr == nil, "to", "must be a date like 2006-01-02")
+	if fromErr == nil && toErr == nil {
+		v.Check(!req.to.Before(req.from), "to", "must not be before from")
+		v.Checkf(req.to.Sub(req.from) < maxRegulatoryExportDays*24*time.Hour, "to", "must be within %d days of from", maxRegulatoryExportDays)
+		v.Check(!req.to.After(time.Now().UTC()), "to", "must not be in the future")
+	}
+	return v.Err()
+}
+
+// RegulatoryExporter runs regulatory exports one at a time in the
+// background and keeps their status in memory. The files outlive it in the
+// sink: after a restart, finished exports are still found by their manifest.
+type RegulatoryExporter struct {
+	store Storage
+	sink  ExportSink
+	// rowsPerFile bounds each CSV file, and so the memory used per export.
+	rowsPerFile int
+	now         func() time.Time
+	queue       chan *RegulatoryExport
+
+	mu   sync.Mutex
+	jobs map[string]*RegulatoryExport
+}
+
+// NewRegulatoryExporter creates an exporter reading from store and writing
+// files of up to 100000 rows to sink. Up to 8 exports may wait for Run.
+func NewRegulatoryExporter(store Storage, sink ExportSink) *RegulatoryExporter {
+	return &RegulatoryExporter{
+		store:       store,
+		sink:        sink,
+		rowsPerFile: 100000,
+		now:         time.Now,
+		queue:       make(chan *RegulatoryExport, 8),
+		jobs:        make(map[string]*RegulatoryExport),
+	}
+}
+
+// Start queues an export of the UTC days from through to.
+func (e *RegulatoryExporter) Start(from, to time.Time) (*RegulatoryExport, error) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	job := &RegulatoryExport{
+		ID:        hex.EncodeToString(b),
+		Status:    ExportQueued,
+		From:      from.Format(time.DateOnly),
+		To:        to.Format(time.DateOnly),
+		Files:     []RegulatoryFile{},
+		CreatedAt: e.now().UTC(),
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	select {
+	case e.queue <- job:
+	default:
+		return nil, ErrExportQueueFull
+	}
+	e.jobs[job.ID] = job
+	return copyExport(job), nil
+}
+
+// Get returns the status of export id, falling back to the manifest in the
+// sink for exports finished before a restart.
+func (e *RegulatoryExporter) Get(ctx context.Context, id string) (*RegulatoryExport, error) {
+	e.mu.Lock()
+	job, ok := e.jobs[id]
+	if ok {
+		job = copyExport(job)
+	}
+	e.mu.Unlock()
+	if ok {
+		return job, nil
+	}
+	// IDs become sink keys, so only ones Start could have made are looked up.
+	if b, err := hex.DecodeString(id); err != nil || len(b) != 8 {
+		return nil, fmt.Errorf("%w: %s", ErrExportNotFound, id)
+	}
+	key := regulatoryKey(id, "manifest.json")
+	data, err := e.sink.Get(ctx, key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrExportNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m RegulatoryManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("read %s: %w", key, err)
+	}
+	sum := sha256.Sum256(data)
+	return &RegulatoryExport{
+		ID:             id,
+		Status:         ExportSucceeded,
+		From:           m.From,
+		To:             m.To,
+		Accounts:       m.Accounts,
+		Transactions:   m.Transactions,
+		Files:          m.Files,
+		ManifestKey:    key,
+		ManifestSHA256: hex.EncodeToString(sum[:]),
+		CreatedAt:      m.GeneratedAt,
+		FinishedAt:     &m.GeneratedAt,
+	}, nil
+}
+
+// Run exports queued jobs until ctx is cancelled. A job interrupted by the
+// cancellation fails; its files stay without a manifest.
+func (e *RegulatoryExporter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-e.queue:
+			e.update(job, func(j *RegulatoryExport) {
+				now := e.now().UTC()
+				j.Status, j.StartedAt = ExportRunning, &now
+			})
+			err := e.export(ctx, job)
+			e.update(job, func(j *RegulatoryExport) {
+				now := e.now().UTC()
+				j.FinishedAt = &now
+				j.Status = ExportSucceeded
+				if err != nil {
+					j.Status, j.Error = ExportFailed, err.Error()
+				}
+			})
+			if err != nil {
+				slog.Error("regulatory export failed", "export_id", job.ID, "error", err)
+			} else {
+				slog.Info("regulatory export finished", "export_id", job.ID, "accounts", job.Accounts, "transactions", job.Transactions)
+			}
+		}
+	}
+}
+
+// update changes job under the lock, since Get copies it concurrently.
+func (e *RegulatoryExporter) update(job *RegulatoryExport, f func(*RegulatoryExport)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f(job)
+}
+
+func (e *RegulatoryExporter) export(ctx context.Context, job *RegulatoryExport) error {
+	from, err := time.Parse(time.DateOnly, job.From)
+	if err != nil {
+		return err
+	}
+	to, err := time.Parse(time.DateOnly, job.To)
+	if err != nil {
+		return err
+	}
+	w := &regulatoryFileWriter{ctx: ctx, exporter: e, job: job}
+	if err := e.store.WriteRegulatoryExport(ctx, from, to, w); err != nil {
+		return err
+	}
+	if err := w.finish(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	manifest := RegulatoryManifest{
+		Format:       regulatoryFormat,
+		ExportID:     job.ID,
+		From:         job.From,
+		To:           job.To,
+		GeneratedAt:  e.now().UTC(),
+		Accounts:     job.Accounts,
+		Transactions: job.Transactions,
+		Files:        append([]RegulatoryFile(nil), job.Files...),
+	}
+	e.mu.Unlock()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	key := regulatoryKey(job.ID, "manifest.json")
+	if err := e.sink.Put(ctx, key, data); err != nil {
+		return fmt.Errorf("write %s: %w", key, err)
+	}
+	sum := sha256.Sum256(data)
+	e.update(job, func(j *RegulatoryExport) {
+		j.ManifestKey, j.ManifestSHA256 = key, hex.EncodeToString(sum[:])
+	})
+	return nil
+}
+
+func regulatoryKey(id, name string) string {
+	return "regulatory/" + id + "/" + name
+}
+
+func copyExport(job *RegulatoryExport) *RegulatoryExport {
+	c := *job
+	c.Files = append([]RegulatoryFile{}, job.Files...)
+	return &c
+}
+
+// Regulatory file kinds and their CSV headers. Amounts are in minor units.
+var regulatoryHeaders = map[string][]string{
+	"accounts": {"account_id", "account_number", "first_name", "last_name", "type", "currency", "status",
+		"opened_at", "closed_at", "closing_balance"},
+	"transactions": {"reference", "kind", "booked_at", "from_account", "to_account", "amount", "currency",
+		"credit_amount", "credit_currency"},
+}
+
+// regulatoryFileWriter encodes the rows streamed by the store as CSV,
+// writing a part to the sink whenever it reaches rowsPerFile rows. Only
+// the current part is held in memory.
+type regulatoryFileWriter struct {
+	ctx      context.Context
+	exporter *RegulatoryExporter
+	job      *RegulatoryExport
+
+	kind  string
+	part  int
+	rows  int
+	buf   bytes.Buffer
+	csv   *csv.Writer
+	parts map[string]int
+}
+
+func (w *regulatoryFileWriter) Account(acc RegulatoryAccount) error {
+	var closedAt string
+	if acc.ClosedAt != nil {
+		closedAt = acc.ClosedAt.UTC().Format(time.RFC3339)
+	}
+	return w.write("accounts", []string{
+		strconv.Itoa(acc.ID),
+		strconv.FormatInt(acc.AccountNo, 10),
+		acc.FirstName,
+		acc.LastName,
+		acc.Type,
+		string(acc.Currency),
+		acc.Status,
+		acc.CreatedAt.UTC().Format(time.RFC3339),
+		closedAt,
+		strconv.FormatInt(acc.ClosingBalance, 10),
+	})
+}
+
+func (w *regulatoryFileWriter) Transaction(tx RegulatoryTransaction) error {
+	account := func(id int) string {
+		if id == 0 {
+			return ""
+		}
+		return strconv.Itoa(id)
+	}
+	return w.write("transactions", []string{
+		tx.Reference,
+		tx.Kind,
+		tx.BookedAt.UTC().Format(time.RFC3339Nano),
+		account(tx.FromAccount),
+		account(tx.ToAccount),
+		strconv.FormatInt(tx.Amount, 10),
+		string(tx.Currency),
+		strconv.FormatInt(tx.CreditAmount, 10),
+		string(tx.CreditCurrency),
+	})
+}
+
+func (w *regulatoryFileWriter) write(kind string, record []string) error {
+	if w.kind != kind || w.rows >= w.exporter.rowsPerFile {
+		if err := w.flush(); err != nil {
+			return err
+		}
+		w.open(kind)
+	}
+	w.csv.Write(record)
+	w.rows++
+	w.exporter.update(w.job, func(j *RegulatoryExport) {
+		if kind == "accounts" {
+			j.Accounts++
+		} else {
+			j.Transactions++
+		}
+	})
+	return nil
+}
+
+func (w *regulatoryFileWriter) open(kind string) {
+	if w.parts == nil {
+		w.parts = make(map[string]int)
+	}
+	w.parts[kind]++
+	w.kind, w.part, w.rows = kind, w.parts[kind], 0
+	w.buf.Reset()
+	w.csv = csv.NewWriter(&w.buf)
+	w.csv.Write(regulatoryHeaders[kind])
+}
+
+// flush writes the current part, if any, to the sink.
+func (w *regulatoryFileWriter) flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	data := w.buf.Bytes()
+	sum := sha256.Sum256(data)
+	file := RegulatoryFile{
+		Key:    regulatoryKey(w.job.ID, fmt.Sprintf("%s-%04d.csv", w.kind, w.part)),
+		Kind:   w.kind,
+		Part:   w.part,
+		Rows:   w.rows,
+		Bytes:  len(data),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+	if err := w.exporter.sink.Put(w.ctx, file.Key, data); err != nil {
+		return fmt.Errorf("write %s: %w", file.Key, err)
+	}
+	w.csv = nil
+	w.exporter.update(w.job, func(j *RegulatoryExport) { j.Files = append(j.Files, file) })
+	return nil
+}
+
+// finish writes the last part. A kind without rows still gets a file with
+// just the header, so every export has the same files.
+func (w *regulatoryFileWriter) finish() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	for _, kind := range []string{"accounts", "transactions"} {
+		if w.parts[kind] == 0 {
+			w.open(kind)
+			if err := w.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handleStartRegulatoryExport queues an export and answers 202 with its
+// status; clients poll the Location until it succeeded or failed.
+func (s *APIServer) handleStartRegulatoryExport(w http.ResponseWriter, r *http.Request) error {
+	if s.regulatory == nil {
+		return &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: errors.New("regulatory exports are not configured")}
+	}
+	req := new(RegulatoryExportRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	job, err := s.regulatory.Start(req.from, req.to)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/admin/exports/regulatory/"+job.ID)
+	return writeData(w, http.StatusAccepted, job, nil)
+}
+
+func (s *APIServer) handleGetRegulatoryExport(w http.ResponseWriter, r *http.Request) error {
+	if s.regulatory == nil {
+		return &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: errors.New("regulatory exports are not configured")}
+	}
+	job, err := s.regulatory.Get(r.Context(), mux.Vars(r)["exportId"])
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, job, nil)
+}
+
+// bookedMovements lists every balance change as (account_id, created_at,
+// signed amount), like statementMovements does for a single account.
+const bookedMovements = `
+	select account_id, created_at, case when kind = 'withdrawal' then -amount else amount end as delta
+	from account_entry
+	union all
+	select from_account, created_at, -amount from transfer
+	union all
+	select to_account, created_at, credit_amount from transfer`
+
+// WriteRegulatoryExport streams every account opened by the end of day to,
+// with its balance then, and every transaction booked from the start of
+// day from to the end of day to. Both are read in one snapshot, so the
+// balances and transactions agree.
+func (s *PostgresStore) WriteRegulatoryExport(ctx context.Context, from, to time.Time, w RegulatoryWriter) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	end := to.AddDate(0, 0, 1)
+	if err := writeRegulatoryAccounts(ctx, tx, end, w); err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, `select 'E' || e.id, e.kind, e.created_at,
+		case when e.kind = 'withdrawal' then e.account_id else 0 end,
+		case when e.kind = 'withdrawal' then 0 else e.account_id end,
+		e.amount, a.currency, e.amount, a.currency
+	from account_entry e join account a on a.id = e.account_id
+	where e.created_at >= $1 and e.created_at < $2
+	union all
+	select 'T' || id, 'transfer', created_at, from_account, to_account, amount, currency, credit_amount, credit_currency
+	from transfer where created_at >= $1 and created_at < $2
+	order by 3, 1`, from, end)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t RegulatoryTransaction
+		if err := rows.Scan(&t.Reference, &t.Kind, &t.BookedAt, &t.FromAccount, &t.ToAccount,
+			&t.Amount, &t.Currency, &t.CreditAmount, &t.CreditCurrency); err != nil {
+			return err
+		}
+		if err := w.Transaction(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func writeRegulatoryAccounts(ctx context.Context, tx *sql.Tx, end time.Time, w RegulatoryWriter) error {
+	rows, err := tx.QueryContext(ctx, `select `+accountColumns+`, balance - coalesce(later.delta, 0)
+	from account left join (
+		select account_id, sum(delta) as delta from (`+bookedMovements+`) m
+		where created_at >= $1 group by account_id
+	) later on later.account_id = account.id
+	where created_at < $1 order by id`, end)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var acc RegulatoryAccount
+		if acc.Account, err = scanIntoAccount(rows, &acc.ClosingBalance); err != nil {
+			return err
+		}
+		if err := w.Account(acc); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// WriteRegulatoryExport collects the export under the lock and writes it
+// after the lock is released, like WriteStatement.
+func (s *InMemoryStorage) WriteRegulatoryExport(ctx context.Context, from, to time.Time, w RegulatoryWriter) error {
+	end := to.AddDate(0, 0, 1)
+	s.mu.Lock()
+	later := make(map[int]int64)
+	var txs []RegulatoryTransaction
+	for _, e := range s.entries {
+		t := RegulatoryTransaction{Reference: fmt.Sprintf("E%d", e.ID), Kind: e.Kind, BookedAt: e.CreatedAt,
+			Amount: e.Amount, CreditAmount: e.Amount}
+		if acc, ok := s.accounts[e.AccountID]; ok {
+			t.Currency, t.CreditCurrency = acc.Currency, acc.Currency
+		}
+		delta := e.Amount
+		if e.Kind == EntryWithdrawal {
+			t.FromAccount, delta = e.AccountID, -delta
+		} else {
+			t.ToAccount = e.AccountID
+		}
+		if !e.CreatedAt.Before(end) {
+			later[e.AccountID] += delta
+		} else if !e.CreatedAt.Before(from) {
+			txs = append(txs, t)
+		}
+	}
+	for _, tr := range s.transfers {
+		if !tr.CreatedAt.Before(end) {
+			later[tr.FromAccount] -= tr.Debit.Amount
+			later[tr.ToAccount] += tr.Credit.Amount
+		} else if !tr.CreatedAt.Before(from) {
+			txs = append(txs, RegulatoryTransaction{Reference: fmt.Sprintf("T%d", tr.ID), Kind: "transfer", BookedAt: tr.CreatedAt,
+				FromAccount: tr.FromAccount, ToAccount: tr.ToAccount, Amount: tr.Debit.Amount, Currency: tr.Debit.Currency,
+				CreditAmount: tr.Credit.Amount, CreditCurrency: tr.Credit.Currency})
+		}
+	}
+	var accounts []RegulatoryAccount
+	for id, acc := range s.accounts {
+		if acc.CreatedAt.Before(end) {
+			accounts = append(accounts, RegulatoryAccount{Account: copyAccount(acc), ClosingBalance: acc.Balance - later[id]})
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	sort.Slice(txs, func(i, j int) bool {
+		if !txs[i].BookedAt.Equal(txs[j].BookedAt) {
+			return txs[i].BookedAt.Before(txs[j].BookedAt)
+		}
+		return txs[i].Reference < txs[j].Reference
+	})
+	for _, acc := range accounts {
+		if err := w.Account(acc); err != nil {
+			return err
+		}
+	}
+	for _, t := range txs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := w.Transaction(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
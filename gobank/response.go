@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Envelope is the body of every JSON response: data on success, error on
+// failure, and optional metadata such as pagination.
+type Envelope struct {
+	Data  any        `json:"data,omitempty"`
+	Error *ErrorBody `json:"error,omitempty"`
+	Meta  Meta       `json:"meta,omitempty"`
+}
+
+// ErrorBody describes a failed request.
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Detail is the English message, with any specifics, when Message
+	// was translated for the Accept-Language of the request.
+	Detail string `json:"detail,omitempty"`
+	// Fields lists the invalid fields of a VALIDATION_FAILED response.
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// Meta carries response metadata.
+type Meta map[string]any
+
+// Error codes returned to clients.
+const (
+	CodeBadRequest           = "BAD_REQUEST"
+	CodeValidation           = "VALIDATION_FAILED"
+	CodeNotFound             = "NOT_FOUND"
+	CodeUnauthorized         = "UNAUTHORIZED"
+	CodeForbidden            = "FORBIDDEN"
+	CodeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	CodeAccountNotFound      = "ACCOUNT_NOT_FOUND"
+	CodeAccountExists        = "ACCOUNT_EXISTS"
+	CodeCustomerNotFound     = "CUSTOMER_NOT_FOUND"
+	CodeCustomerExists       = "CUSTOMER_EXISTS"
+	CodeLastOwner            = "LAST_OWNER"
+	CodeOrderNotFound        = "STANDING_ORDER_NOT_FOUND"
+	CodeInsufficientFunds    = "INSUFFICIENT_FUNDS"
+	CodeInvalidTransfer      = "INVALID_TRANSFER"
+	CodeInvalidAccountNumber = "INVALID_ACCOUNT_NUMBER"
+	CodeIdempotencyMismatch  = "IDEMPOTENCY_MISMATCH"
+	CodeIdempotencyConflict  = "IDEMPOTENCY_IN_PROGRESS"
+	CodeCurrencyMismatch     = "CURRENCY_MISMATCH"
+	CodeAccountFrozen        = "ACCOUNT_FROZEN"
+	CodeAccountPending       = "ACCOUNT_PENDING"
+	CodeAccountClosed        = "ACCOUNT_CLOSED"
+	CodeInvalidTransition    = "INVALID_STATUS_TRANSITION"
+	CodeBalanceNotZero       = "BALANCE_NOT_ZERO"
+	CodeDailyLimitExceeded   = "DAILY_LIMIT_EXCEEDED"
+	CodeWeeklyLimitExceeded  = "WEEKLY_LIMIT_EXCEEDED"
+	CodeHoldNotFound         = "HELD_TRANSFER_NOT_FOUND"
+	CodeHoldResolved         = "HELD_TRANSFER_RESOLVED"
+	CodeFraudSuspected       = "FRAUD_SUSPECTED"
+	CodePendingNotFound      = "PENDING_TRANSFER_NOT_FOUND"
+	CodeApprovalResolved     = "PENDING_TRANSFER_RESOLVED"
+	CodeAlreadyApproved      = "ALREADY_APPROVED"
+	CodeKYCNotFound          = "KYC_NOT_FOUND"
+	CodeInvalidKYCTransition = "INVALID_KYC_TRANSITION"
+	CodeKYCRequired          = "KYC_REQUIRED"
+	CodeAPIKeyNotFound       = "API_KEY_NOT_FOUND"
+	CodeInsufficientScope    = "INSUFFICIENT_SCOPE"
+	CodeExportNotFound       = "EXPORT_NOT_FOUND"
+	CodeUnavailable          = "SERVICE_UNAVAILABLE"
+	CodeVersionConflict      = "VERSION_CONFLICT"
+	CodeInternal             = "INTERNAL_ERROR"
+)
+
+// apiError is returned by handlers to choose the status and code of an error.
+type apiError struct {
+	status int
+	code   string
+	err    error
+}
+
+func (e *apiError) Error() string { return e.err.Error() }
+func (e *apiError) Unwrap() error { return e.err }
+
+func badRequest(err error) error {
+	return &apiError{status: http.StatusBadRequest, code: CodeBadRequest, err: err}
+}
+
+func validationFailed(err error) error {
+	return &apiError{status: http.StatusUnprocessableEntity, code: CodeValidation, err: err}
+}
+
+// errorMappings translates storage errors into statuses and codes.
+var errorMappings = []struct {
+	target error
+	status int
+	code   string
+}{
+	{ErrAccountNotFound, http.StatusNotFound, CodeAccountNotFound},
+	{ErrAccountExists, http.StatusConflict, CodeAccountExists},
+	{ErrVersionConflict, http.StatusConflict, CodeVersionConflict},
+	{ErrCustomerNotFound, http.StatusNotFound, CodeCustomerNotFound},
+	{ErrCustomerExists, http.StatusConflict, CodeCustomerExists},
+	{ErrUnauthenticated, http.StatusUnauthorized, CodeUnauthorized},
+	{ErrForbidden, http.StatusForbidden, CodeForbidden},
+	{ErrLastOwner, http.StatusUnprocessableEntity, CodeLastOwner},
+	{ErrStandingOrderNotFound, http.StatusNotFound, CodeOrderNotFound},
+	{ErrInsufficientFunds, http.StatusUnprocessableEntity, CodeInsufficientFunds},
+	{ErrInvalidTransfer, http.StatusUnprocessableEntity, CodeInvalidTransfer},
+	{ErrInvalidAccountNumber, http.StatusUnprocessableEntity, CodeInvalidAccountNumber},
+	{ErrIdempotencyMismatch, http.StatusUnprocessableEntity, CodeIdempotencyMismatch},
+	{ErrIdempotencyInProgress, http.StatusConflict, CodeIdempotencyConflict},
+	{ErrCurrencyMismatch, http.StatusUnprocessableEntity, CodeCurrencyMismatch},
+	{ErrNoExchangeRate, http.StatusUnprocessableEntity, CodeCurrencyMismatch},
+	{ErrUnsupportedCurrency, http.StatusUnprocessableEntity, CodeValidation},
+	{ErrAmountOverflow, http.StatusUnprocessableEntity, CodeValidation},
+	{ErrAccrualNotDue, http.StatusUnprocessableEntity, CodeValidation},
+	{ErrAccountFrozen, http.StatusForbidden, CodeAccountFrozen},
+	{ErrAccountPending, http.StatusForbidden, CodeAccountPending},
+	{ErrAccountClosed, http.StatusUnprocessableEntity, CodeAccountClosed},
+	{ErrInvalidStatusTransition, http.StatusConflict, CodeInvalidTransition},
+	{ErrBalanceNotZero, http.StatusUnprocessableEntity, CodeBalanceNotZero},
+	{ErrDailyLimitExceeded, http.StatusUnprocessableEntity, CodeDailyLimitExceeded},
+	{ErrWeeklyLimitExceeded, http.StatusUnprocessableEntity, CodeWeeklyLimitExceeded},
+	{ErrHeldTransferNotFound, http.StatusNotFound, CodeHoldNotFound},
+	{ErrHoldResolved, http.StatusConflict, CodeHoldResolved},
+	{ErrFraudSuspected, http.StatusForbidden, CodeFraudSuspected},
+	{ErrPendingTransferNotFound, http.StatusNotFound, CodePendingNotFound},
+	{ErrApprovalResolved, http.StatusConflict, CodeApprovalResolved},
+	{ErrAlreadyApproved, http.StatusConflict, CodeAlreadyApproved},
+	{ErrKYCNotFound, http.StatusNotFound, CodeKYCNotFound},
+	{ErrInvalidKYCTransition, http.StatusConflict, CodeInvalidKYCTransition},
+	{ErrKYCNotApproved, http.StatusForbidden, CodeKYCRequired},
+	{ErrAPIKeyNotFound, http.StatusNotFound, CodeAPIKeyNotFound},
+	{ErrInsufficientScope, http.StatusForbidden, CodeInsufficientScope},
+	{ErrExportNotFound, http.StatusNotFound, CodeExportNotFound},
+	{ErrExportQueueFull, http.StatusServiceUnavailable, CodeUnavailable},
+}
+
+// errorResponse maps err to a status and error body. Unknown errors become
+// a 500 with a generic message so internals are not leaked.
+func errorResponse(err error) (int, *ErrorBody) {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		body := &ErrorBody{Code: ae.code, Message: err.Error()}
+		var fields ValidationErrors
+		if errors.As(err, &fields) {
+			body.Message = "request validation failed"
+			body.Fields = fields
+		}
+		return ae.status, body
+	}
+	for _, m := range errorMappings {
+		if errors.Is(err, m.target) {
+			return m.status, &ErrorBody{Code: m.code, Message: err.Error()}
+		}
+	}
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) && temporary.Temporary() {
+		return http.StatusServiceUnavailable, &ErrorBody{Code: CodeUnavailable, Message: "temporarily unavailable, retry later"}
+	}
+	return http.StatusInternalServerError, &ErrorBody{Code: CodeInternal, Message: "internal server error"}
+}
+
+// WriteJSON writes v as JSON with the given status.
+func WriteJSON(w http.ResponseWriter, status int, v any) error {
+	// Headers must be set before WriteHeader or they are dropped.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+// writeData writes a successful response envelope.
+func writeData(w http.ResponseWriter, status int, data any, meta Meta) error {
+	return WriteJSON(w, status, Envelope{Data: data, Meta: meta})
+}
+
+// writeError writes the error envelope for err. Errors that become a 500
+// are logged with the request ID since the client only sees a generic message.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, body := errorResponse(err)
+	if status == http.StatusInternalServerError {
+		loggerFrom(r.Context()).Error("internal error", "error", err)
+	}
+	writeErrorBody(w, r, status, body)
+}
+
+func writeErrorf(w http.ResponseWriter, r *http.Request, status int, code, format string, args ...any) {
+	writeErrorBody(w, r, status, &ErrorBody{Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// writeErrorBody writes body with its message in the language of r.
+func writeErrorBody(w http.ResponseWriter, r *http.Request, status int, body *ErrorBody) {
+	loc := localeFor(r)
+	loc.localizeError(body)
+	w.Header().Set("Content-Language", loc.Tag)
+	WriteJSON(w, status, Envelope{Error: body})
+}
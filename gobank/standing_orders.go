@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/robfig/cron/v3"
+)
+
+// Standing order statuses.
+const (
+	OrderActive    = "active"
+	OrderCompleted = "completed"
+	OrderCancelled = "cancelled"
+	OrderFailed    = "failed"
+)
+
+// maxOrderFailures is how many consecutive failed runs suspend an order.
+const maxOrderFailures = 3
+
+// ErrStandingOrderNotFound is returned when no standing order has the requested ID.
+var ErrStandingOrderNotFound = errors.New("standing order not found")
+
+// StandingOrder is a recurring transfer. Schedule is a standard 5-field
+// cron expression or a descriptor such as @daily, evaluated in UTC.
+type StandingOrder struct {
+	ID          int64      `json:"id"`
+	FromAccount int        `json:"fromAccount"`
+	ToAccount   int        `json:"toAccount"`
+	Amount      int64      `json:"amount"`
+	Schedule    string     `json:"schedule"`
+	EndDate     *time.Time `json:"endDate,omitempty"`
+	Status      string     `json:"status"`
+	NextRunAt   *time.Time `json:"nextRunAt,omitempty"`
+	LastRunAt   *time.Time `json:"lastRunAt,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	// Failures counts consecutive failed runs; maxOrderFailures suspends the order.
+	Failures  int                 `json:"failures"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Runs      []*StandingOrderRun `json:"runs,omitempty"`
+}
+
+// StandingOrderRun records one execution of a standing order.
+type StandingOrderRun struct {
+	ID           int64     `json:"id"`
+	OrderID      int64     `json:"orderId"`
+	ScheduledFor time.Time `json:"scheduledFor"`
+	TransferID   *int64    `json:"transferId,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// StandingOrderStore persists standing orders and their runs. Transfers
+// themselves go through Storage.Transfer like any other transfer.
+type StandingOrderStore interface {
+	CreateStandingOrder(o *StandingOrder) error
+	StandingOrders(accountID int) ([]*StandingOrder, error)
+	StandingOrder(id int64) (*StandingOrder, error)
+	StandingOrderRuns(orderID int64, limit int) ([]*StandingOrderRun, error)
+	CancelStandingOrder(id int64) (*StandingOrder, error)
+	DueStandingOrders(now time.Time, limit int) ([]*StandingOrder, error)
+	// ClaimStandingOrderRun records that the order is being run for
+	// scheduledFor. It returns false if that run was already claimed, so
+	// an occurrence is executed at most once even with several schedulers.
+	ClaimStandingOrderRun(orderID int64, scheduledFor time.Time) (int64, bool, error)
+	// FinishStandingOrderRun stores the run outcome and the order's next
+	// run time and status.
+	FinishStandingOrderRun(run *StandingOrderRun, next *time.Time, status string) error
+}
+
+var scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// parseSchedule parses a cron expression, rejecting ones that fire more
+// than once a minute.
+func parseSchedule(spec string, now time.Time) (cron.Schedule, error) {
+	schedule, err := scheduleParser.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	first := schedule.Next(now)
+	if first.IsZero() {
+		return nil, errors.New("schedule never fires")
+	}
+	if schedule.Next(first).Sub(first) < time.Minute {
+		return nil, errors.New("schedule must not fire more than once a minute")
+	}
+	return schedule, nil
+}
+
+// nextRun returns the first occurrence after t, or nil when it falls after
+// the order's end date.
+func nextRun(schedule cron.Schedule, t time.Time, endDate *time.Time) *time.Time {
+	next := schedule.Next(t.UTC())
+	if next.IsZero() || (endDate != nil && !next.Before(endDate.AddDate(0, 0, 1))) {
+		return nil
+	}
+	return &next
+}
+
+// StandingOrderRequest creates a standing order from the account in the path.
+type StandingOrderRequest struct {
+	ToAccount int    `json:"toAccount"`
+	Amount    int64  `json:"amount"`
+	Schedule  string `json:"schedule"`
+	// EndDate is the last UTC day the order may run on, as 2006-01-02.
+	EndDate string `json:"endDate"`
+
+	schedule cron.Schedule
+	endDate  *time.Time
+}
+
+func (r *StandingOrderRequest) Validate() error {
+	var v Validator
+	v.Check(r.ToAccount > 0, "toAccount", "is required")
+	checkAmount(&v, r.Amount)
+	now := time.Now().UTC()
+	if r.Schedule == "" {
+		v.Check(false, "schedule", "is required")
+	} else if schedule, err := parseSchedule(r.Schedule, now); err != nil {
+		v.Checkf(false, "schedule", "invalid schedule: %v", err)
+	} else {
+		r.schedule = schedule
+	}
+	if r.EndDate != "" {
+		end, err := time.Parse(time.DateOnly, r.EndDate)
+		v.Check(err == nil, "endDate", "must be a date like 2006-01-02")
+		if err == nil {
+			r.endDate = &end
+			if r.schedule != nil {
+				v.Check(nextRun(r.schedule, now, r.endDate) != nil, "endDate", "the schedule has no run on or before endDate")
+			}
+		}
+	}
+	return v.Err()
+}
+
+// StandingOrderScheduler executes due standing orders.
+type StandingOrderScheduler struct {
+	orders    StandingOrderStore
+	transfers Storage
+	now       func() time.Time
+}
+
+func NewStandingOrderScheduler(orders StandingOrderStore, transfers Storage) *StandingOrderScheduler {
+	return &StandingOrderScheduler{orders: orders, transfers: transfers, now: time.Now}
+}
+
+// Run checks for due orders every interval until ctx is cancelled.
+func (s *StandingOrderScheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := s.RunDue(ctx); err != nil {
+			slog.Error("standing orders failed", "error", err)
+		} else if n > 0 {
+			slog.Info("ran standing orders", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue executes every order whose next run time has passed. Occurrences
+// missed while the scheduler was down are collapsed into a single run.
+func (s *StandingOrderScheduler) RunDue(ctx context.Context) (int, error) {
+	ran := 0
+	for {
+		due, err := s.orders.DueStandingOrders(s.now(), 100)
+		if err != nil {
+			return ran, err
+		}
+		if len(due) == 0 {
+			return ran, nil
+		}
+		for _, order := range due {
+			if err := ctx.Err(); err != nil {
+				return ran, err
+			}
+			if err := s.execute(order); err != nil {
+				return ran, fmt.Errorf("standing order %d: %w", order.ID, err)
+			}
+			ran++
+		}
+	}
+}
+
+func (s *StandingOrderScheduler) execute(order *StandingOrder) error {
+	scheduledFor := *order.NextRunAt
+	runID, claimed, err := s.orders.ClaimStandingOrderRun(order.ID, scheduledFor)
+	if err != nil || !claimed {
+		return err
+	}
+	run := &StandingOrderRun{ID: runID, OrderID: order.ID, ScheduledFor: scheduledFor}
+	record, err := s.transfers.Transfer(order.FromAccount, order.ToAccount, order.Amount)
+	observeTransfer(record, err)
+	status := OrderActive
+	if err != nil {
+		run.Error = err.Error()
+		slog.Warn("standing order run failed", "order_id", order.ID, "error", err)
+		if order.Failures+1 >= maxOrderFailures {
+			status = OrderFailed
+		}
+	} else {
+		run.TransferID = &record.ID
+	}
+
+	var next *time.Time
+	if status == OrderActive {
+		schedule, err := scheduleParser.Parse(order.Schedule)
+		if err != nil {
+			return err
+		}
+		after := s.now().UTC()
+		if scheduledFor.After(after) {
+			after = scheduledFor
+		}
+		if next = nextRun(schedule, after, order.EndDate); next == nil {
+			status = OrderCompleted
+		}
+	}
+	return s.orders.FinishStandingOrderRun(run, next, status)
+}
+
+func (s *APIServer) standingOrderRoutes(router *mux.Router) {
+	router.HandleFunc("/account/{id}/standing-orders", makeHTTPHandleFunc(s.accountOwner(s.handleCreateStandingOrder))).Methods(http.MethodPost)
+	router.HandleFunc("/account/{id}/standing-orders", makeHTTPHandleFunc(s.accountOwner(s.handleListStandingOrders))).Methods(http.MethodGet)
+	router.HandleFunc("/account/{id}/standing-orders/{orderId}", makeHTTPHandleFunc(s.accountOwner(s.handleGetStandingOrder))).Methods(http.MethodGet)
+	router.HandleFunc("/account/{id}/standing-orders/{orderId}", makeHTTPHandleFunc(s.accountOwner(s.handleCancelStandingOrder))).Methods(http.MethodDelete)
+}
+
+func (s *APIServer) requireStandingOrders() error {
+	if s.standingOrders == nil {
+		return &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: errors.New("standing orders are not configured")}
+	}
+	return nil
+}
+
+func (s *APIServer) handleCreateStandingOrder(w http.ResponseWriter, r *http.Request) error {
+	if err := s.requireStandingOrders(); err != nil {
+		return err
+	}
+	id, _ := getID(r)
+	req := new(StandingOrderRequest)
+	if err := decodeRequest(w, r, req); err != nil {
+		return err
+	}
+	if req.ToAccount == id {
+		return validationFailed(ValidationErrors{{Field: "toAccount", Message: "must differ from the source account"}})
+	}
+	order := &StandingOrder{
+		FromAccount: id,
+		ToAccount:   req.ToAccount,
+		Amount:      req.Amount,
+		Schedule:    req.Schedule,
+		EndDate:     req.endDate,
+		Status:      OrderActive,
+		NextRunAt:   nextRun(req.schedule, time.Now(), req.endDate),
+	}
+	if err := s.standingOrders.CreateStandingOrder(order); err != nil {
+		return err
+	}
+	return writeData(w, http.StatusCreated, order, nil)
+}
+
+func (s *APIServer) handleListStandingOrders(w http.ResponseWriter, r *http.Request) error {
+	if err := s.requireStandingOrders(); err != nil {
+		return err
+	}
+	id, _ := getID(r)
+	orders, err := s.standingOrders.StandingOrders(id)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, orders, nil)
+}
+
+// standingOrder loads the {orderId} order, hiding orders of other accounts.
+func (s *APIServer) standingOrder(r *http.Request) (*StandingOrder, error) {
+	if err := s.requireStandingOrders(); err != nil {
+		return nil, err
+	}
+	accountID, _ := getID(r)
+	idStr := mux.Vars(r)["orderId"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, badRequest(fmt.Errorf("invalid standing order id %q", idStr))
+	}
+	order, err := s.standingOrders.StandingOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	if order.FromAccount != accountID {
+		return nil, fmt.Errorf("%w: %d", ErrStandingOrderNotFound, id)
+	}
+	return order, nil
+}
+
+// handleGetStandingOrder returns the order with its 20 most recent runs.
+func (s *APIServer) handleGetStandingOrder(w http.ResponseWriter, r *http.Request) error {
+	order, err := s.standingOrder(r)
+	if err != nil {
+		return err
+	}
+	if order.Runs, err = s.standingOrders.StandingOrderRuns(order.ID, 20); err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, order, nil)
+}
+
+func (s *APIServer) handleCancelStandingOrder(w http.ResponseWriter, r *http.Request) error {
+	order, err := s.standingOrder(r)
+	if err != nil {
+		return err
+	}
+	if order, err = s.standingOrders.CancelStandingOrder(order.ID); err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, order, nil)
+}
+
+const standingOrderColumns = `id, from_account, to_account, amount, schedule, end_date, status,
+	next_run_at, last_run_at, coalesce(last_error, ''), failures, created_at`
+
+func scanIntoStandingOrder(row interface{ Scan(...any) error }) (*StandingOrder, error) {
+	o := new(StandingOrder)
+	var endDate, nextRunAt, lastRunAt sql.NullTime
+	err := row.Scan(&o.ID, &o.FromAccount, &o.ToAccount, &o.Amount, &o.Schedule, &endDate, &o.Status,
+		&nextRunAt, &lastRunAt, &o.LastError, &o.Failures, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if endDate.Valid {
+		o.EndDate = &endDate.Time
+	}
+	if nextRunAt.Valid {
+		o.NextRunAt = &nextRunAt.Time
+	}
+	if lastRunAt.Valid {
+		o.LastRunAt = &lastRunAt.Time
+	}
+	return o, nil
+}
+
+func (s *PostgresStore) queryStandingOrders(query string, args ...any) ([]*StandingOrder, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orders := []*StandingOrder{}
+	for rows.Next() {
+		o, err := scanIntoStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+func (s *PostgresStore) CreateStandingOrder(o *StandingOrder) error {
+	err := s.db.QueryRow(`insert into standing_order (from_account, to_account, amount, schedule, end_date, status, next_run_at)
+	values ($1, $2, $3, $4, $5, $6, $7)
+	returning id, created_at`, o.FromAccount, o.ToAccount, o.Amount, o.Schedule, o.EndDate, o.Status, o.NextRunAt).
+		Scan(&o.ID, &o.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return fmt.Errorf("%w: %d", ErrAccountNotFound, o.ToAccount)
+	}
+	return err
+}
+
+func (s *PostgresStore) StandingOrders(accountID int) ([]*StandingOrder, error) {
+	return s.queryStandingOrders(`select `+standingOrderColumns+` from standing_order
+	where from_account = $1 order by id`, accountID)
+}
+
+func (s *PostgresStore) StandingOrder(id int64) (*StandingOrder, error) {
+	o, err := scanIntoStandingOrder(s.db.QueryRow(`select `+standingOrderColumns+` from standing_order where id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrStandingOrderNotFound, id)
+	}
+	return o, err
+}
+
+func (s *PostgresStore) StandingOrderRuns(orderID int64, limit int) ([]*StandingOrderRun, error) {
+	rows, err := s.db.Query(`select id, order_id, scheduled_for, transfer_id, coalesce(error, ''), created_at
+	from standing_order_run where order_id = $1 order by scheduled_for desc limit $2`, orderID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runs := []*StandingOrderRun{}
+	for rows.Next() {
+		run := new(StandingOrderRun)
+		var transferID sql.NullInt64
+		if err := rows.Scan(&run.ID, &run.OrderID, &run.ScheduledFor, &transferID, &run.Error, &run.CreatedAt); err != nil {
+			return nil, err
+		}
+		if transferID.Valid {
+			run.TransferID = &transferID.Int64
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// CancelStandingOrder stops an active order; finished orders are returned unchanged.
+func (s *PostgresStore) CancelStandingOrder(id int64) (*StandingOrder, error) {
+	if _, err := s.db.Exec(`update standing_order set status = $2, next_run_at = null
+	where id = $1 and status = $3`, id, OrderCancelled, OrderActive); err != nil {
+		return nil, err
+	}
+	return s.StandingOrder(id)
+}
+
+func (s *PostgresStore) DueStandingOrders(now time.Time, limit int) ([]*StandingOrder, error) {
+	return s.queryStandingOrders(`select `+standingOrderColumns+` from standing_order
+	where status = $1 and next_run_at <= $2 order by next_run_at, id limit $3`, OrderActive, now, limit)
+}
+
+func (s *PostgresStore) ClaimStandingOrderRun(orderID int64, scheduledFor time.Time) (int64, bool, error) {
+	var id int64
+	err := s.db.QueryRow(`insert into standing_order_run (order_id, scheduled_for) values ($1, $2)
+	on conflict (order_id, scheduled_for) do nothing returning id`, orderID, scheduledFor).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return id, err == nil, err
+}
+
+func (s *PostgresStore) FinishStandingOrderRun(run *StandingOrderRun, next *time.Time, status string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`update standing_order_run set transfer_id = $2, error = nullif($3, '') where id = $1`,
+		run.ID, run.TransferID, run.Error); err != nil {
+		return err
+	}
+	// A run that failed increments failures; a successful one resets them.
+	// The status only changes if the order was not cancelled meanwhile.
+	if _, err := tx.Exec(`update standing_order set
+		next_run_at = case when status = $5 then $2 end,
+		status = case when status = $5 then $3 else status end,
+		last_run_at = $4,
+		last_error = nullif($6, ''),
+		failures = case when $6 = '' then 0 else failures + 1 end
+	where id = $1`, run.OrderID, next, status, run.ScheduledFor, OrderActive, run.Error); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statement formats.
+const (
+	StatementCSV = "csv"
+	StatementPDF = "pdf"
+)
+
+// maxStatementDays bounds the period a single statement may cover.
+const maxStatementDays = 366
+
+// Statement is the header and totals of an account statement covering the
+// UTC days From through To inclusive.
+type Statement struct {
+	Account *Account
+	From    time.Time
+	To      time.Time
+	Opening int64
+	Closing int64
+}
+
+// StatementLine is one balance movement on a statement. Amount is negative
+// for debits.
+type StatementLine struct {
+	ID          int64
+	Date        time.Time
+	Kind        string
+	Description string
+	// Counterparty is the other account of a transfer line.
+	Counterparty int
+	Amount       int64
+	Balance      int64
+}
+
+// StatementWriter receives a statement as it is read from the ledger, so
+// long statements are streamed rather than held in memory. Closing is only
+// known once every line has been written.
+type StatementWriter interface {
+	Begin(st *Statement) error
+	Line(line StatementLine) error
+	End(st *Statement) error
+}
+
+// ParseStatementPeriod parses the from and to query parameters as dates.
+// An empty to means today and an empty from means 30 days before to.
+func ParseStatementPeriod(from, to string, now time.Time) (time.Time, time.Time, error) {
+	y, m, d := now.UTC().Date()
+	end := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	var err error
+	if to != "" {
+		if end, err = time.Parse(time.DateOnly, to); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be a date like 2006-01-02")
+		}
+	}
+	start := end.AddDate(0, 0, -30)
+	if from != "" {
+		if start, err = time.Parse(time.DateOnly, from); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be a date like 2006-01-02")
+		}
+	}
+	switch {
+	case start.After(end):
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	case end.Sub(start) > maxStatementDays*24*time.Hour:
+		return time.Time{}, time.Time{}, fmt.Errorf("a statement may cover at most %d days", maxStatementDays)
+	}
+	return start, end, nil
+}
+
+// NewStatementWriter returns a writer producing format on w, with line
+// descriptions and amounts in loc. CSV statements keep their English column
+// names and leave amounts ungrouped so they stay machine readable.
+func NewStatementWriter(format string, w io.Writer, loc *Locale) (StatementWriter, error) {
+	switch format {
+	case StatementCSV:
+		return &csvStatement{w: csv.NewWriter(w), loc: loc}, nil
+	case StatementPDF:
+		return &pdfStatement{pdf: newPDFWriter(w), loc: loc}, nil
+	default:
+		return nil, fmt.Errorf("format must be %q or %q", StatementCSV, StatementPDF)
+	}
+}
+
+// StatementContentType returns the MIME type for a statement format.
+func StatementContentType(format string) string {
+	if format == StatementPDF {
+		return "application/pdf"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+func describeLine(kind string, counterparty int) string {
+	switch kind {
+	case EntryDeposit:
+		return "Deposit"
+	case EntryWithdrawal:
+		return "Withdrawal"
+	case EntryInterest:
+		return "Interest"
+	case "transfer_in":
+		return fmt.Sprintf("Transfer from account %d", counterparty)
+	case "transfer_out":
+		return fmt.Sprintf("Transfer to account %d", counterparty)
+	}
+	return kind
+}
+
+type csvStatement struct {
+	w   *csv.Writer
+	loc *Locale
+	cur Currency
+}
+
+func (c *csvStatement) Begin(st *Statement) error {
+	acc := st.Account
+	c.cur = acc.Currency
+	c.w.Write([]string{"account", strconv.FormatInt(acc.AccountNo, 10)})
+	c.w.Write([]string{"name", acc.FirstName + " " + acc.LastName})
+	c.w.Write([]string{"currency", string(acc.Currency)})
+	c.w.Write([]string{"period", st.From.Format(time.DateOnly), st.To.Format(time.DateOnly)})
+	c.w.Write([]string{"opening_balance", c.loc.FormatAmount(st.Opening, acc.Currency, false)})
+	c.w.Write(nil)
+	c.w.Write([]string{"id", "date", "kind", "description", "amount", "balance"})
+	return c.w.Error()
+}
+
+func (c *csvStatement) Line(l StatementLine) error {
+	c.w.Write([]string{
+		strconv.FormatInt(l.ID, 10),
+		l.Date.UTC().Format(time.RFC3339),
+		l.Kind,
+		c.loc.describeLine(l),
+		c.loc.FormatAmount(l.Amount, c.cur, false),
+		c.loc.FormatAmount(l.Balance, c.cur, false),
+	})
+	return c.w.Error()
+}
+
+func (c *csvStatement) End(st *Statement) error {
+	c.w.Write(nil)
+	c.w.Write([]string{"closing_balance", c.loc.FormatAmount(st.Closing, c.cur, false)})
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// pdfStatement lays a statement out as plain text lines on A4 pages.
+type pdfStatement struct {
+	pdf  *pdfWriter
+	loc  *Locale
+	page []string
+	cur  Currency
+}
+
+const pdfLinesPerPage = 60
+
+func (p *pdfStatement) add(line string) error {
+	p.page = append(p.page, line)
+	if len(p.page) == pdfLinesPerPage {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *pdfStatement) flush() error {
+	if len(p.page) == 0 {
+		return nil
+	}
+	err := p.pdf.Page(p.page)
+	p.page = p.page[:0]
+	return err
+}
+
+func (p *pdfStatement) Begin(st *Statement) error {
+	acc := st.Account
+	p.cur = acc.Currency
+	l := p.loc
+	header := []string{
+		l.text("title"),
+		"",
+		fmt.Sprintf("%-10s%d", l.text("account")+":", acc.AccountNo),
+		fmt.Sprintf("%-10s%s %s", l.text("name")+":", acc.FirstName, acc.LastName),
+		fmt.Sprintf("%-10s%s", l.text("period")+":", l.text("period_range", st.From.Format(time.DateOnly), st.To.Format(time.DateOnly))),
+		fmt.Sprintf("%s: %s", l.text("opening_balance"), l.FormatMoney(st.Opening, acc.Currency)),
+		"",
+		fmt.Sprintf("%-20s %-32s %14s %14s", l.text("date"), l.text("description"), l.text("amount"), l.text("balance")),
+	}
+	for _, line := range header {
+		if err := p.add(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pdfStatement) Line(l StatementLine) error {
+	return p.add(fmt.Sprintf("%-20s %-32.32s %14s %14s",
+		l.Date.UTC().Format("2006-01-02 15:04"), p.loc.describeLine(l),
+		p.loc.FormatAmount(l.Amount, p.cur, true), p.loc.FormatAmount(l.Balance, p.cur, true)))
+}
+
+func (p *pdfStatement) End(st *Statement) error {
+	if err := p.add(""); err != nil {
+		return err
+	}
+	if err := p.add(fmt.Sprintf("%s: %s", p.loc.text("closing_balance"), p.loc.FormatMoney(st.Closing, p.cur))); err != nil {
+		return err
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+	return p.pdf.Close()
+}
+
+// pdfWriter streams a minimal PDF of monospaced text pages. Objects 1-3
+// are reserved for the catalog, page tree and font; the page tree is
+// written last, once all pages are known.
+type pdfWriter struct {
+	w       io.Writer
+	n       int64
+	offsets map[int]int64
+	next    int
+	pages   []int
+	err     error
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	return &pdfWriter{w: w, offsets: make(map[int]int64), next: 4}
+}
+
+func (p *pdfWriter) printf(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(p.w, format, args...)
+	p.n += int64(n)
+	p.err = err
+}
+
+func (p *pdfWriter) object(id int, body string) {
+	if p.n == 0 {
+		p.printf("%%PDF-1.4\n")
+	}
+	p.offsets[id] = p.n
+	p.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+// Page writes one page with lines of text from the top.
+func (p *pdfWriter) Page(lines []string) error {
+	var content bytes.Buffer
+	content.WriteString("BT /F1 9 Tf 11 TL 40 800 Td\n")
+	for _, line := range lines {
+		fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+	}
+	content.WriteString("ET")
+
+	contentID, pageID := p.next, p.next+1
+	p.next += 2
+	p.object(contentID, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	p.object(pageID, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", contentID))
+	p.pages = append(p.pages, pageID)
+	return p.err
+}
+
+// Close writes the page tree, catalog and cross-reference table.
+func (p *pdfWriter) Close() error {
+	if len(p.pages) == 0 {
+		p.Page(nil)
+	}
+	kids := make([]string, len(p.pages))
+	for i, id := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	p.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	p.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	p.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	xref := p.n
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", p.next)
+	for id := 1; id < p.next; id++ {
+		p.printf("%010d 00000 n \n", p.offsets[id])
+	}
+	p.printf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", p.next, xref)
+	return p.err
+}
+
+// pdfEscape escapes a string literal in WinAnsiEncoding, writing Latin-1
+// letters and the euro sign as octal escapes and replacing characters the
+// standard fonts cannot show.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case r == '€':
+			b.WriteString("\\200")
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,716 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrAccountNotFound is returned when no account has the requested ID.
+	ErrAccountNotFound = errors.New("account not found")
+	// ErrAccountExists is returned when an account number is already taken.
+	ErrAccountExists = errors.New("account already exists")
+	// ErrInvalidAccountNumber is returned for numbers with wrong check digits.
+	ErrInvalidAccountNumber = errors.New("invalid account number")
+	// ErrInsufficientFunds is returned when a transfer exceeds the balance.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrInvalidTransfer is returned for non-positive amounts or self transfers.
+	ErrInvalidTransfer = errors.New("invalid transfer")
+	// ErrIdempotencyMismatch is returned when an idempotency key is reused
+	// for a different operation.
+	ErrIdempotencyMismatch = errors.New("idempotency key was used for a different request")
+	// ErrAccountFrozen is returned when a frozen account is debited or
+	// takes part in a transfer.
+	ErrAccountFrozen = errors.New("account is frozen")
+	// ErrDailyLimitExceeded is returned when a debit would exceed the
+	// account's daily transfer limit.
+	ErrDailyLimitExceeded = errors.New("daily transfer limit exceeded")
+	// ErrWeeklyLimitExceeded is the weekly counterpart of ErrDailyLimitExceeded.
+	ErrWeeklyLimitExceeded = errors.New("weekly transfer limit exceeded")
+)
+
+// PostgreSQL error codes.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// Storage is the persistence layer used by APIServer.
+type Storage interface {
+	CustomerStore
+	CreateAccount(acc *Account, ownerIDs ...int) error
+	DeleteAccount(int) error
+	// UpdateAccount writes the names, balance, overdraft limit and interest
+	// rate of acc if the account is still at acc.Version, and returns
+	// ErrVersionConflict otherwise.
+	UpdateAccount(*Account) error
+	// ModifyAccount applies apply to the current account and saves the
+	// result, retrying on concurrent changes; see account_update.go.
+	ModifyAccount(id int, apply func(*Account) error) (*Account, error)
+	GetAccountByID(int) (*Account, error)
+	// ListAccounts returns one page of the accounts selected by q.
+	ListAccounts(q *AccountQuery) (*AccountPage, error)
+	// SearchAccounts returns the matches of q, best first, with one more
+	// than q.Limit if there are more.
+	SearchAccounts(q *AccountSearch) ([]*AccountMatch, error)
+	Transfer(fromID, toID int, amount int64) (*TransferRecord, error)
+	Deposit(id int, amount int64, idempotencyKey string) (*AccountEntry, error)
+	Withdraw(id int, amount int64, idempotencyKey string) (*AccountEntry, error)
+	WriteStatement(ctx context.Context, id int, from, to time.Time, w StatementWriter) error
+	// WriteRegulatoryExport streams the accounts and transactions of the
+	// UTC days from through to; see regulatory_export.go.
+	WriteRegulatoryExport(ctx context.Context, from, to time.Time, w RegulatoryWriter) error
+	// SetStatus moves an account through the lifecycle state machine.
+	SetStatus(id int, status string) (*Account, error)
+	// SetTransferLimits sets the daily and weekly debit limits; nil
+	// removes a limit.
+	SetTransferLimits(id int, daily, weekly *int64) (*Account, error)
+	Stats() (*BankStats, error)
+}
+
+// PostgresStore implements Storage on PostgreSQL.
+type PostgresStore struct {
+	db *pgDB
+	// rates converts cross-currency transfers; nil rejects them.
+	rates RateProvider
+}
+
+// NewPostgresStore connects using DATABASE_URL, falling back to the local
+// development database, with the pool, timeouts and retries of cfg.
+func NewPostgresStore(cfg DBConfig) (*PostgresStore, error) {
+	connStr := os.Getenv("DATABASE_URL")
+	if connStr == "" {
+		connStr = "user=postgres dbname=postgres password=gobank sslmode=disable"
+	}
+	db, err := openDB(connStr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+// Init brings the schema up to date.
+func (s *PostgresStore) Init() error {
+	return s.migrate()
+}
+
+// SetRateProvider enables cross-currency transfers using rates.
+func (s *PostgresStore) SetRateProvider(rates RateProvider) {
+	s.rates = rates
+}
+
+// Close closes the database connection pool.
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// CreateAccount stores acc owned by ownerIDs, allocating its account number
+// unless one with valid check digits is already set.
+func (s *PostgresStore) CreateAccount(acc *Account, ownerIDs ...int) error {
+	if acc.AccountNo == 0 {
+		number, err := s.nextAccountNumber()
+		if err != nil {
+			return err
+		}
+		acc.AccountNo = number
+	} else if !ValidAccountNumber(acc.AccountNo) {
+		return fmt.Errorf("%w: invalid account number %d", ErrInvalidAccountNumber, acc.AccountNo)
+	}
+
+	if acc.Currency == "" {
+		acc.Currency = DefaultCurrency
+	}
+	if acc.Type == "" {
+		acc.Type = AccountChecking
+	}
+	if acc.Status == "" {
+		acc.Status = AccountActive
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `insert into account (first_name, last_name, number, balance, overdraft_limit, currency, account_type, interest_rate_bps, status)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	returning id, version, created_at`
+	err = tx.QueryRow(query, acc.FirstName, acc.LastName, acc.AccountNo, acc.Balance, acc.OverdraftLimit,
+		acc.Currency, acc.Type, acc.InterestRateBps, acc.Status).
+		Scan(&acc.ID, &acc.Version, &acc.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: number %d", ErrAccountExists, acc.AccountNo)
+	}
+	if err != nil {
+		return err
+	}
+	for _, customerID := range ownerIDs {
+		_, err := tx.Exec("insert into account_owner (account_id, customer_id) values ($1, $2)", acc.ID, customerID)
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return fmt.Errorf("%w: %d", ErrCustomerNotFound, customerID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DeleteAccount(id int) error {
+	res, err := s.db.Exec("delete from account where id = $1", id)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(res, id)
+}
+
+func (s *PostgresStore) UpdateAccount(acc *Account) error {
+	query := `update account set first_name = $3, last_name = $4, balance = $5, overdraft_limit = $6,
+	interest_rate_bps = $7 where id = $1 and version = $2 returning version`
+	err := s.db.QueryRow(query, acc.ID, acc.Version, acc.FirstName, acc.LastName, acc.Balance, acc.OverdraftLimit,
+		acc.InterestRateBps).Scan(&acc.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.versionConflict(acc.ID)
+	}
+	return err
+}
+
+func (s *PostgresStore) GetAccountByID(id int) (*Account, error) {
+	row := s.db.QueryRow(`select `+accountColumns+` from account where id = $1`, id)
+	acc, err := scanIntoAccount(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+	}
+	return acc, err
+}
+
+// Transfer moves amount, in the source account's currency, between two
+// accounts in a single transaction and records it in the transfer table.
+// Accounts in different currencies need a rate provider; the credited
+// amount is converted at the current rate. Rows are locked in ID order so
+// concurrent opposite transfers cannot deadlock.
+func (s *PostgresStore) Transfer(fromID, toID int, amount int64) (*TransferRecord, error) {
+	if amount <= 0 || fromID == toID {
+		return nil, ErrInvalidTransfer
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	record, err := s.transfer(tx, fromID, toID, amount)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// transfer performs a Transfer within tx, which the caller commits.
+func (s *PostgresStore) transfer(tx *sql.Tx, fromID, toID int, amount int64) (*TransferRecord, error) {
+	type lockedAccount struct {
+		balance        Money
+		overdraftLimit int64
+		status         string
+		limits         debitLimits
+	}
+	accounts := make(map[int]lockedAccount, 2)
+	rows, err := tx.Query(`select id, balance, overdraft_limit, currency, status, daily_transfer_limit, weekly_transfer_limit
+	from account where id in ($1, $2) order by id for update`, fromID, toID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var acc lockedAccount
+		if err := rows.Scan(&id, &acc.balance.Amount, &acc.overdraftLimit, &acc.balance.Currency,
+			&acc.status, &acc.limits.daily, &acc.limits.weekly); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		accounts[id] = acc
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range []int{fromID, toID} {
+		if _, ok := accounts[id]; !ok {
+			return nil, fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+		}
+	}
+
+	from, to := accounts[fromID], accounts[toID]
+	for _, id := range []int{fromID, toID} {
+		if err := checkMovement(id, accounts[id].status, false); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkDebitLimits(tx, fromID, amount, from.limits); err != nil {
+		return nil, err
+	}
+	debit := NewMoney(amount, from.balance.Currency)
+	remaining, err := from.balance.Sub(debit)
+	if err != nil {
+		return nil, err
+	}
+	if remaining.Amount < -from.overdraftLimit {
+		return nil, ErrInsufficientFunds
+	}
+	credit, err := Convert(debit, to.balance.Currency, s.rates)
+	if err != nil {
+		return nil, err
+	}
+	if credit.Amount <= 0 {
+		return nil, fmt.Errorf("%w: amount too small to convert", ErrInvalidTransfer)
+	}
+	if _, err := to.balance.Add(credit); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("update account set balance = balance - $2 where id = $1", fromID, debit.Amount); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("update account set balance = balance + $2 where id = $1", toID, credit.Amount); err != nil {
+		return nil, err
+	}
+	record := &TransferRecord{FromAccount: fromID, ToAccount: toID, Debit: debit, Credit: credit}
+	if err := tx.QueryRow(`insert into transfer (from_account, to_account, amount, currency, credit_amount, credit_currency)
+	values ($1, $2, $3, $4, $5, $6)
+	returning id, created_at`,
+		fromID, toID, debit.Amount, debit.Currency, credit.Amount, credit.Currency).
+		Scan(&record.ID, &record.CreatedAt); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Deposit credits amount to an account. Repeating an idempotency key
+// returns the original entry instead of applying the deposit again.
+func (s *PostgresStore) Deposit(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+	return s.applyEntry(id, EntryDeposit, amount, idempotencyKey)
+}
+
+// Withdraw debits amount from an account, refusing to go below the
+// account's overdraft limit. Idempotency keys work as for Deposit.
+func (s *PostgresStore) Withdraw(id int, amount int64, idempotencyKey string) (*AccountEntry, error) {
+	return s.applyEntry(id, EntryWithdrawal, amount, idempotencyKey)
+}
+
+func (s *PostgresStore) applyEntry(id int, kind string, amount int64, key string) (*AccountEntry, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidTransfer)
+	}
+	if entry, err := s.replayEntry(id, kind, amount, key); entry != nil || err != nil {
+		return entry, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var balance, overdraftLimit int64
+	var status string
+	var limits debitLimits
+	err = tx.QueryRow(`select balance, overdraft_limit, status, daily_transfer_limit, weekly_transfer_limit
+	from account where id = $1 for update`, id).
+		Scan(&balance, &overdraftLimit, &status, &limits.daily, &limits.weekly)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMovement(id, status, kind != EntryWithdrawal); err != nil {
+		return nil, err
+	}
+	delta := amount
+	if kind == EntryWithdrawal {
+		delta = -amount
+		if err := checkDebitLimits(tx, id, amount, limits); err != nil {
+			return nil, err
+		}
+		if balance-amount < -overdraftLimit {
+			return nil, ErrInsufficientFunds
+		}
+	}
+	entry := &AccountEntry{AccountID: id, Kind: kind, Amount: amount, IdempotencyKey: key}
+	if err := tx.QueryRow("update account set balance = balance + $2 where id = $1 returning balance", id, delta).
+		Scan(&entry.BalanceAfter); err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(`insert into account_entry (account_id, kind, amount, balance_after, idempotency_key)
+	values ($1, $2, $3, $4, nullif($5, ''))
+	returning id, created_at`, id, kind, amount, entry.BalanceAfter, key).Scan(&entry.ID, &entry.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		// A concurrent request with the same key won the race.
+		tx.Rollback()
+		return s.replayEntry(id, kind, amount, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// debitLimits are an account's daily and weekly transfer limits.
+type debitLimits struct {
+	daily, weekly sql.NullInt64
+}
+
+// checkDebitLimits fails if debiting amount would take the account's
+// outgoing transfers and withdrawals for the current UTC day or week over
+// its limits. The caller must hold the account row lock so concurrent
+// debits are counted in order.
+func checkDebitLimits(tx *sql.Tx, id int, amount int64, limits debitLimits) error {
+	if !limits.daily.Valid && !limits.weekly.Valid {
+		return nil
+	}
+	var today, week int64
+	err := tx.QueryRow(`select
+		coalesce(sum(amount) filter (where created_at >= date_trunc('day', now() at time zone 'UTC') at time zone 'UTC'), 0),
+		coalesce(sum(amount), 0)
+	from (
+		select amount, created_at from transfer
+		where from_account = $1 and created_at >= date_trunc('week', now() at time zone 'UTC') at time zone 'UTC'
+		union all
+		select amount, created_at from account_entry
+		where account_id = $1 and kind = $2 and created_at >= date_trunc('week', now() at time zone 'UTC') at time zone 'UTC'
+	) debits`, id, EntryWithdrawal).Scan(&today, &week)
+	if err != nil {
+		return err
+	}
+	if limits.daily.Valid && today+amount > limits.daily.Int64 {
+		return fmt.Errorf("%w: %d of %d already used today", ErrDailyLimitExceeded, today, limits.daily.Int64)
+	}
+	if limits.weekly.Valid && week+amount > limits.weekly.Int64 {
+		return fmt.Errorf("%w: %d of %d already used this week", ErrWeeklyLimitExceeded, week, limits.weekly.Int64)
+	}
+	return nil
+}
+
+// replayEntry returns the entry recorded for key, or nil if there is none.
+func (s *PostgresStore) replayEntry(id int, kind string, amount int64, key string) (*AccountEntry, error) {
+	if key == "" {
+		return nil, nil
+	}
+	entry := &AccountEntry{IdempotencyKey: key, Replayed: true}
+	err := s.db.QueryRow(`select id, account_id, kind, amount, balance_after, created_at
+	from account_entry where idempotency_key = $1`, key).
+		Scan(&entry.ID, &entry.AccountID, &entry.Kind, &entry.Amount, &entry.BalanceAfter, &entry.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if entry.AccountID != id || entry.Kind != kind || entry.Amount != amount {
+		return nil, ErrIdempotencyMismatch
+	}
+	return entry, nil
+}
+
+// SetStatus changes the account status if the state machine allows it.
+// Closing an account also cancels the standing orders paying into or out
+// of it.
+func (s *PostgresStore) SetStatus(id int, status string) (*Account, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	var balance int64
+	err = tx.QueryRow(`select status, balance from account where id = $1 for update`, id).Scan(&current, &balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTransition(id, current, status, balance); err != nil {
+		return nil, err
+	}
+	acc, err := scanIntoAccount(tx.QueryRow(`update account set status = $2,
+		closed_at = case when $3 then now() end
+	where id = $1 returning `+accountColumns, id, status, status == AccountClosed))
+	if err != nil {
+		return nil, err
+	}
+	if status == AccountClosed {
+		if _, err := tx.Exec(`update standing_order set status = $2, next_run_at = null
+		where (from_account = $1 or to_account = $1) and status = $3`, id, OrderCancelled, OrderActive); err != nil {
+			return nil, err
+		}
+	}
+	return acc, tx.Commit()
+}
+
+func (s *PostgresStore) SetTransferLimits(id int, daily, weekly *int64) (*Account, error) {
+	return s.ModifyAccount(id, func(acc *Account) error {
+		acc.DailyTransferLimit, acc.WeeklyTransferLimit = daily, weekly
+		return nil
+	})
+}
+
+// Stats aggregates account and ledger totals for the admin API.
+func (s *PostgresStore) Stats() (*BankStats, error) {
+	stats := &BankStats{Balances: make(map[Currency]int64)}
+	rows, err := s.db.Query(`select currency, count(*) filter (where status <> $1), count(*) filter (where status = $2),
+		count(*) filter (where status = $1), coalesce(sum(balance), 0)
+	from account group by currency`, AccountClosed, AccountFrozen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currency Currency
+		var accounts, frozen, closed int
+		var balance int64
+		if err := rows.Scan(&currency, &accounts, &frozen, &closed, &balance); err != nil {
+			return nil, err
+		}
+		stats.Accounts += accounts
+		stats.FrozenAccounts += frozen
+		stats.ClosedAccounts += closed
+		stats.Balances[currency] = balance
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	err = s.db.QueryRow(`select count(*) from transfer
+	where created_at >= date_trunc('day', now() at time zone 'UTC') at time zone 'UTC'`).Scan(&stats.TransfersToday)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// statementMovements lists every balance change on an account as
+// (id, created_at, kind, signed amount, counterparty account).
+const statementMovements = `
+	select id, created_at, kind,
+		case when kind = 'withdrawal' then -amount else amount end as delta, 0 as counterparty
+	from account_entry where account_id = $1
+	union all
+	select id, created_at, 'transfer_out', -amount, to_account from transfer where from_account = $1
+	union all
+	select id, created_at, 'transfer_in', credit_amount, from_account from transfer where to_account = $1`
+
+// WriteStatement streams the movements on an account between the start of
+// day from and the end of day to. The opening balance is derived from the
+// current balance and everything booked since from, inside one snapshot so
+// concurrent activity cannot skew it.
+func (s *PostgresStore) WriteStatement(ctx context.Context, id int, from, to time.Time, w StatementWriter) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	acc, err := scanIntoAccount(tx.QueryRowContext(ctx, `select `+accountColumns+` from account where id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	end := to.AddDate(0, 0, 1)
+	var since int64
+	if err := tx.QueryRowContext(ctx, `select coalesce(sum(delta), 0) from (`+statementMovements+`) m
+	where created_at >= $2`, id, from).Scan(&since); err != nil {
+		return err
+	}
+	st := &Statement{Account: acc, From: from, To: to, Opening: acc.Balance - since}
+	if err := w.Begin(st); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `select id, created_at, kind, delta, counterparty from (`+statementMovements+`) m
+	where created_at >= $2 and created_at < $3 order by created_at, kind, id`, id, from, end)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	balance := st.Opening
+	for rows.Next() {
+		var line StatementLine
+		if err := rows.Scan(&line.ID, &line.Date, &line.Kind, &line.Amount, &line.Counterparty); err != nil {
+			return err
+		}
+		balance += line.Amount
+		line.Balance = balance
+		line.Description = describeLine(line.Kind, line.Counterparty)
+		if err := w.Line(line); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	st.Closing = balance
+	return w.End(st)
+}
+
+// LedgerAfter returns committed transfers with ID greater than afterID.
+func (s *PostgresStore) LedgerAfter(afterID int64, before time.Time, limit int) ([]LedgerEntry, error) {
+	rows, err := s.db.Query(`select id, from_account, to_account, amount, created_at
+	from transfer where id > $1 and created_at < $2 order by id limit $3`, afterID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LedgerEntry
+	for rows.Next() {
+		var entry LedgerEntry
+		if err := rows.Scan(&entry.ID, &entry.FromAccount, &entry.ToAccount, &entry.Amount, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// AccrueInterest credits daily interest to every savings account for each
+// day after its last accrual up to and including through. Each account is
+// accrued in its own transaction and each day with a non-zero credit gets
+// an interest entry keyed by account and date, so reruns never pay twice.
+func (s *PostgresStore) AccrueInterest(ctx context.Context, through time.Time) (*InterestRun, error) {
+	day := through.Format(time.DateOnly)
+	rows, err := s.db.QueryContext(ctx, `select id from account
+	where account_type = $1 and interest_rate_bps > 0 and interest_accrued_through < $2::date
+	and status <> $3
+	order by id`, AccountSavings, day, AccountClosed)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	run := &InterestRun{Through: day}
+	for _, id := range ids {
+		days, entries, err := s.accrueAccount(ctx, id, through)
+		if err != nil {
+			return run, fmt.Errorf("account %d: %w", id, err)
+		}
+		if days > 0 {
+			run.Accounts++
+		}
+		run.Days += days
+		run.Entries += entries
+	}
+	return run, nil
+}
+
+func (s *PostgresStore) accrueAccount(ctx context.Context, id int, through time.Time) (days, entries int, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var balance, remainder int64
+	var rateBps int
+	var accruedThrough time.Time
+	err = tx.QueryRowContext(ctx, `select balance, interest_rate_bps, interest_remainder, interest_accrued_through
+	from account where id = $1 for update`, id).Scan(&balance, &rateBps, &remainder, &accruedThrough)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Deleted since it was listed.
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for day := accruedThrough.AddDate(0, 0, 1); !day.After(through); day = day.AddDate(0, 0, 1) {
+		var amount int64
+		amount, remainder = dailyInterest(balance, rateBps, remainder)
+		days++
+		if amount == 0 {
+			continue
+		}
+		balance += amount
+		key := fmt.Sprintf("interest:%d:%s", id, day.Format(time.DateOnly))
+		if _, err := tx.ExecContext(ctx, `insert into account_entry (account_id, kind, amount, balance_after, idempotency_key)
+		values ($1, $2, $3, $4, $5)`, id, EntryInterest, amount, balance, key); err != nil {
+			return 0, 0, err
+		}
+		entries++
+	}
+	if days == 0 {
+		return 0, 0, nil
+	}
+	if _, err := tx.ExecContext(ctx, `update account set balance = $2, interest_remainder = $3,
+	interest_accrued_through = $4::date where id = $1`, id, balance, remainder, through.Format(time.DateOnly)); err != nil {
+		return 0, 0, err
+	}
+	return days, entries, tx.Commit()
+}
+
+// accountColumns are the columns read by scanIntoAccount, in order.
+const accountColumns = `id, first_name, last_name, number, balance, overdraft_limit, currency,
+	account_type, interest_rate_bps, status, daily_transfer_limit, weekly_transfer_limit, version, created_at, closed_at`
+
+// scanIntoAccount scans accountColumns, followed by any columns selected
+// after them into extra.
+func scanIntoAccount(row interface{ Scan(...any) error }, extra ...any) (*Account, error) {
+	acc := new(Account)
+	var dailyLimit, weeklyLimit sql.NullInt64
+	var closedAt sql.NullTime
+	err := row.Scan(append([]any{&acc.ID, &acc.FirstName, &acc.LastName, &acc.AccountNo, &acc.Balance, &acc.OverdraftLimit, &acc.Currency,
+		&acc.Type, &acc.InterestRateBps, &acc.Status, &dailyLimit, &weeklyLimit, &acc.Version, &acc.CreatedAt, &closedAt}, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	if dailyLimit.Valid {
+		acc.DailyTransferLimit = &dailyLimit.Int64
+	}
+	if weeklyLimit.Valid {
+		acc.WeeklyTransferLimit = &weeklyLimit.Int64
+	}
+	if closedAt.Valid {
+		acc.ClosedAt = &closedAt.Time
+	}
+	return acc, nil
+}
+
+func expectOneRow(res sql.Result, id int) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build tools
+
+package main
+
+// Code generators run by go generate, pinned in go.mod.
+import (
+	_ "github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen"
+)
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Pending transfer statuses.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+var (
+	// ErrPendingTransferNotFound is returned for unknown pending transfer IDs.
+	ErrPendingTransferNotFound = errors.New("pending transfer not found")
+	// ErrApprovalResolved is returned when approving or rejecting a pending
+	// transfer that was already approved, rejected or expired.
+	ErrApprovalResolved = errors.New("pending transfer already resolved")
+	// ErrAlreadyApproved is returned when an approver approves the same
+	// transfer twice.
+	ErrAlreadyApproved = errors.New("approver already approved this transfer")
+)
+
+// ApprovalPolicy sends transfers above Threshold to approval. They execute
+// once Required distinct approvers approved them and expire unless that
+// happens within TTL. The zero policy approves nothing.
+type ApprovalPolicy struct {
+	Threshold int64
+	Required  int
+	TTL       time.Duration
+	// Approvers maps approver tokens to approver names.
+	Approvers map[string]string
+}
+
+func (p ApprovalPolicy) Enabled() bool { return p.Threshold > 0 }
+
+// approvalsFromEnv reads GOBANK_APPROVAL_THRESHOLD, GOBANK_APPROVALS_REQUIRED
+// (default 1), GOBANK_APPROVAL_TTL (default 24h) and GOBANK_APPROVER_TOKENS,
+// a comma-separated list of name:token pairs.
+func approvalsFromEnv() (ApprovalPolicy, error) {
+	policy := ApprovalPolicy{Required: 1, TTL: 24 * time.Hour, Approvers: make(map[string]string)}
+	for _, pair := range strings.Split(os.Getenv("GOBANK_APPROVER_TOKENS"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(pair, ":")
+		if !ok || name == "" || token == "" {
+			return policy, errors.New("GOBANK_APPROVER_TOKENS must be a comma-separated list of name:token pairs")
+		}
+		policy.Approvers[token] = name
+	}
+	v := os.Getenv("GOBANK_APPROVAL_THRESHOLD")
+	if v == "" {
+		return policy, nil
+	}
+	var err error
+	if policy.Threshold, err = strconv.ParseInt(v, 10, 64); err != nil || policy.Threshold <= 0 {
+		return policy, errors.New("GOBANK_APPROVAL_THRESHOLD must be a positive integer")
+	}
+	if v := os.Getenv("GOBANK_APPROVALS_REQUIRED"); v != "" {
+		if policy.Required, err = strconv.Atoi(v); err != nil || policy.Required <= 0 {
+			return policy, errors.New("GOBANK_APPROVALS_REQUIRED must be a positive integer")
+		}
+	}
+	if v := os.Getenv("GOBANK_APPROVAL_TTL"); v != "" {
+		if policy.TTL, err = time.ParseDuration(v); err != nil || policy.TTL <= 0 {
+			return policy, errors.New("GOBANK_APPROVAL_TTL must be a positive duration")
+		}
+	}
+	names := make(map[string]bool)
+	for _, name := range policy.Approvers {
+		names[name] = true
+	}
+	if len(names) < policy.Required {
+		return policy, fmt.Errorf("GOBANK_APPROVER_TOKENS must name at least %d approvers", policy.Required)
+	}
+	return policy, nil
+}
+
+// Approval is one approver's consent to a pending transfer.
+type Approval struct {
+	Approver  string    `json:"approver"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PendingTransfer is a transfer above the approval threshold waiting for
+// approvers. TransferID is set once the last approval executed it.
+type PendingTransfer struct {
+	ID          int64 `json:"id"`
+	FromAccount int   `json:"fromAccount"`
+	ToAccount   int   `json:"toAccount"`
+	Amount      int64 `json:"amount"`
+	// RequestedBy is the customer who asked for the transfer, if any.
+	RequestedBy       *int       `json:"requestedBy,omitempty"`
+	Status            string     `json:"status"`
+	RequiredApprovals int        `json:"requiredApprovals"`
+	Approvals         []Approval `json:"approvals"`
+	TransferID        *int64     `json:"transferId,omitempty"`
+	// RejectedBy and Note record who rejected the transfer and why.
+	RejectedBy string     `json:"rejectedBy,omitempty"`
+	Note       string     `json:"note,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// TransferApprovalStore persists pending transfers. The approval that
+// completes a transfer executes it and marks it approved atomically, so a
+// transfer is never executed twice.
+type TransferApprovalStore interface {
+	CreatePendingTransfer(p *PendingTransfer) error
+	// PendingTransfers lists pending transfers in a status, oldest first.
+	PendingTransfers(status string, limit int) ([]*PendingTransfer, error)
+	// ApprovePendingTransfer records the approval and executes the transfer
+	// once it has enough of them. If executing fails the approval is not
+	// recorded either.
+	ApprovePendingTransfer(id int64, approver, note string) (*PendingTransfer, *TransferRecord, error)
+	RejectPendingTransfer(id int64, approver, note string) (*PendingTransfer, error)
+	// ExpirePendingTransfers marks pending transfers past ExpiresAt expired
+	// and returns how many it marked.
+	ExpirePendingTransfers() (int, error)
+}
+
+// requestApproval records the transfer as pending and returns it if it is
+// above the approval threshold; otherwise it returns nil.
+func (s *APIServer) requestApproval(ctx context.Context, req *TransferRequest) (*PendingTransfer, error) {
+	if s.approvals == nil || !s.approval.Enabled() || req.Amount <= s.approval.Threshold {
+		return nil, nil
+	}
+	pending := &PendingTransfer{
+		FromAccount:       req.FromAccount,
+		ToAccount:         req.ToAccount,
+		Amount:            req.Amount,
+		RequiredApprovals: s.approval.Required,
+		ExpiresAt:         time.Now().Add(s.approval.TTL).UTC(),
+	}
+	if p := principalFrom(ctx); p != nil && p.customer != nil {
+		pending.RequestedBy = &p.customer.ID
+	}
+	if err := s.approvals.CreatePendingTransfer(pending); err != nil {
+		return nil, err
+	}
+	transferApprovals.WithLabelValues("requested").Inc()
+	return pending, nil
+}
+
+// expirePendingTransfers expires unapproved transfers every interval.
+func expirePendingTransfers(ctx context.Context, store TransferApprovalStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := store.ExpirePendingTransfers()
+			if err != nil {
+				slog.Error("expire pending transfers", "error", err)
+			} else if n > 0 {
+				transferApprovals.WithLabelValues(ApprovalExpired).Add(float64(n))
+				slog.Info("expired pending transfers", "count", n)
+			}
+		}
+	}
+}
+
+func (s *APIServer) transferApprovalRoutes(router *mux.Router) {
+	approver := func(f approverFunc) http.HandlerFunc { return makeHTTPHandleFunc(s.requireApprover(f)) }
+	router.HandleFunc("/approvals/transfers", approver(s.handleListPendingTransfers)).Methods(http.MethodGet)
+	router.HandleFunc("/approvals/transfers/{pendingId}/approve", approver(s.handleApprovePendingTransfer)).Methods(http.MethodPost)
+	router.HandleFunc("/approvals/transfers/{pendingId}/reject", approver(s.handleRejectPendingTransfer)).Methods(http.MethodPost)
+}
+
+// approverFunc is an apiFunc that also receives the approver's name.
+type approverFunc func(w http.ResponseWriter, r *http.Request, approver string) error
+
+// requireApprover only lets requests carrying an approver token through.
+// Without configured approvers the approval routes behave as if they did
+// not exist.
+func (s *APIServer) requireApprover(f approverFunc) apiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if s.approvals == nil || len(s.approval.Approvers) == 0 {
+			return &apiError{status: http.StatusNotFound, code: CodeNotFound, err: fmt.Errorf("%s not found", r.URL.Path)}
+		}
+		token, _ := bearerToken(r)
+		for approverToken, name := range s.approval.Approvers {
+			if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(approverToken)) == 1 {
+				return f(w, r, name)
+			}
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		return &apiError{status: http.StatusUnauthorized, code: CodeUnauthorized, err: errors.New("approver token required")}
+	}
+}
+
+// handleListPendingTransfers lists up to 100 pending transfers, by default
+// those still waiting for approval.
+func (s *APIServer) handleListPendingTransfers(w http.ResponseWriter, r *http.Request, _ string) error {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = ApprovalPending
+	}
+	switch status {
+	case ApprovalPending, ApprovalApproved, ApprovalRejected, ApprovalExpired:
+	default:
+		return validationFailed(ValidationErrors{{Field: "status", Message: fmt.Sprintf("must be %s, %s, %s or %s",
+			ApprovalPending, ApprovalApproved, ApprovalRejected, ApprovalExpired)}})
+	}
+	pending, err := s.approvals.PendingTransfers(status, 100)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, pending, nil)
+}
+
+// approvalDecision reads the pending transfer ID and the optional
+// {"note": "..."} body recorded with an approval or rejection.
+func approvalDecision(r *http.Request) (int64, string, error) {
+	idStr := mux.Vars(r)["pendingId"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, "", badRequest(fmt.Errorf("invalid pending transfer id %q", idStr))
+	}
+	note, err := resolutionNote(r)
+	return id, note, err
+}
+
+// handleApprovePendingTransfer approves a pending transfer. The approval
+// that completes it executes the transfer, subject to the usual balance,
+// status and limit checks; if those fail the transfer stays pending.
+func (s *APIServer) handleApprovePendingTransfer(w http.ResponseWriter, r *http.Request, approver string) error {
+	id, note, err := approvalDecision(r)
+	if err != nil {
+		return err
+	}
+	pending, record, err := s.approvals.ApprovePendingTransfer(id, approver, note)
+	if record != nil || err != nil {
+		observeTransfer(record, err)
+	}
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		transferApprovals.WithLabelValues(ApprovalApproved).Inc()
+	}
+	return writeData(w, http.StatusOK, map[string]any{"pendingTransfer": pending, "transfer": record}, nil)
+}
+
+func (s *APIServer) handleRejectPendingTransfer(w http.ResponseWriter, r *http.Request, approver string) error {
+	id, note, err := approvalDecision(r)
+	if err != nil {
+		return err
+	}
+	pending, err := s.approvals.RejectPendingTransfer(id, approver, note)
+	if err != nil {
+		return err
+	}
+	transferApprovals.WithLabelValues(ApprovalRejected).Inc()
+	return writeData(w, http.StatusOK, pending, nil)
+}
+
+const pendingTransferColumns = `id, from_account, to_account, amount, requested_by, status, required_approvals,
+	transfer_id, rejected_by, note, created_at, expires_at, resolved_at`
+
+func scanIntoPendingTransfer(row interface{ Scan(...any) error }) (*PendingTransfer, error) {
+	p := &PendingTransfer{Approvals: []Approval{}}
+	var requestedBy sql.NullInt32
+	var transferID sql.NullInt64
+	var resolvedAt sql.NullTime
+	if err := row.Scan(&p.ID, &p.FromAccount, &p.ToAccount, &p.Amount, &requestedBy, &p.Status, &p.RequiredApprovals,
+		&transferID, &p.RejectedBy, &p.Note, &p.CreatedAt, &p.ExpiresAt, &resolvedAt); err != nil {
+		return nil, err
+	}
+	if requestedBy.Valid {
+		id := int(requestedBy.Int32)
+		p.RequestedBy = &id
+	}
+	if transferID.Valid {
+		p.TransferID = &transferID.Int64
+	}
+	if resolvedAt.Valid {
+		p.ResolvedAt = &resolvedAt.Time
+	}
+	return p, nil
+}
+
+// loadApprovals fills in the approvals of pending transfers.
+func loadApprovals(q interface {
+	Query(string, ...any) (*sql.Rows, error)
+}, pending ...*PendingTransfer) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*PendingTransfer, len(pending))
+	ids := make([]int64, len(pending))
+	for i, p := range pending {
+		byID[p.ID] = p
+		ids[i] = p.ID
+	}
+	rows, err := q.Query(`select pending_transfer_id, approver, note, created_at from transfer_approval
+	where pending_transfer_id = any($1) order by created_at, approver`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var a Approval
+		if err := rows.Scan(&id, &a.Approver, &a.Note, &a.CreatedAt); err != nil {
+			return err
+		}
+		byID[id].Approvals = append(byID[id].Approvals, a)
+	}
+	return rows.Err()
+}
+
+func (s *PostgresStore) CreatePendingTransfer(p *PendingTransfer) error {
+	p.Status = ApprovalPending
+	p.Approvals = []Approval{}
+	return s.db.QueryRow(`insert into pending_transfer (from_account, to_account, amount, requested_by,
+	required_approvals, expires_at) values ($1, $2, $3, $4, $5, $6) returning id, created_at`,
+		p.FromAccount, p.ToAccount, p.Amount, p.RequestedBy, p.RequiredApprovals, p.ExpiresAt).
+		Scan(&p.ID, &p.CreatedAt)
+}
+
+func (s *PostgresStore) PendingTransfers(status string, limit int) ([]*PendingTransfer, error) {
+	rows, err := s.db.Query(`select `+pendingTransferColumns+` from pending_transfer
+	where status = $1 order by created_at, id limit $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pending := []*PendingTransfer{}
+	for rows.Next() {
+		p, err := scanIntoPendingTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return pending, loadApprovals(s.db, pending...)
+}
+
+// lockPendingTransfer locks a pending transfer that is still waiting for
+// approval. One found expired is marked so and committed before the error
+// is returned.
+func lockPendingTransfer(tx *sql.Tx, id int64) (*PendingTransfer, error) {
+	p, err := scanIntoPendingTransfer(tx.QueryRow(`select `+pendingTransferColumns+` from pending_transfer
+	where id = $1 for update`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrPendingTransferNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.Status == ApprovalPending && !time.Now().Before(p.ExpiresAt) {
+		if _, err := tx.Exec(`update pending_transfer set status = $2, resolved_at = now() where id = $1`,
+			id, ApprovalExpired); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		transferApprovals.WithLabelValues(ApprovalExpired).Inc()
+		p.Status = ApprovalExpired
+	}
+	if p.Status != ApprovalPending {
+		return nil, fmt.Errorf("%w: %d is %s", ErrApprovalResolved, id, p.Status)
+	}
+	return p, loadApprovals(tx, p)
+}
+
+func (s *PostgresStore) ApprovePendingTransfer(id int64, approver, note string) (*PendingTransfer, *TransferRecord, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	p, err := lockPendingTransfer(tx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := tx.Exec(`insert into transfer_approval (pending_transfer_id, approver, note) values ($1, $2, $3)
+	on conflict do nothing`, id, approver, note)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, nil, err
+	} else if n == 0 {
+		return nil, nil, fmt.Errorf("%w: %s on %d", ErrAlreadyApproved, approver, id)
+	}
+
+	var record *TransferRecord
+	if len(p.Approvals)+1 >= p.RequiredApprovals {
+		if record, err = s.transfer(tx, p.FromAccount, p.ToAccount, p.Amount); err != nil {
+			return nil, nil, err
+		}
+		if _, err := tx.Exec(`update pending_transfer set status = $2, transfer_id = $3, resolved_at = now()
+		where id = $1`, id, ApprovalApproved, record.ID); err != nil {
+			return nil, nil, err
+		}
+	}
+	p, err = scanIntoPendingTransfer(tx.QueryRow(`select `+pendingTransferColumns+` from pending_transfer
+	where id = $1`, id))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := loadApprovals(tx, p); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return p, record, nil
+}
+
+func (s *PostgresStore) RejectPendingTransfer(id int64, approver, note string) (*PendingTransfer, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := lockPendingTransfer(tx, id); err != nil {
+		return nil, err
+	}
+	p, err := scanIntoPendingTransfer(tx.QueryRow(`update pending_transfer set status = $2, rejected_by = $3,
+	note = $4, resolved_at = now() where id = $1 returning `+pendingTransferColumns, id, ApprovalRejected, approver, note))
+	if err != nil {
+		return nil, err
+	}
+	if err := loadApprovals(tx, p); err != nil {
+		return nil, err
+	}
+	return p, tx.Commit()
+}
+
+func (s *PostgresStore) ExpirePendingTransfers() (int, error) {
+	res, err := s.db.Exec(`update pending_transfer set status = $1, resolved_at = now()
+	where status = $2 and expires_at <= now()`, ApprovalExpired, ApprovalPending)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Held transfer statuses.
+const (
+	HoldPending  = "held"
+	HoldReleased = "released"
+	HoldRejected = "rejected"
+)
+
+var (
+	// ErrHeldTransferNotFound is returned for unknown held transfer IDs.
+	ErrHeldTransferNotFound = errors.New("held transfer not found")
+	// ErrHoldResolved is returned when releasing or rejecting a held
+	// transfer that was already released or rejected.
+	ErrHoldResolved = errors.New("held transfer already resolved")
+)
+
+// VelocityRule holds transfers from an account that already made
+// MaxTransfers transfers within Window, so bursts that look like account
+// takeover wait for an operator. The zero rule holds nothing.
+type VelocityRule struct {
+	MaxTransfers int
+	Window       time.Duration
+}
+
+func (r VelocityRule) Enabled() bool { return r.MaxTransfers > 0 && r.Window > 0 }
+
+// velocityFromEnv reads GOBANK_VELOCITY_MAX_TRANSFERS and
+// GOBANK_VELOCITY_WINDOW, e.g. 5 and 10m; both must be set together.
+func velocityFromEnv() (VelocityRule, error) {
+	var rule VelocityRule
+	maxTransfers, window := os.Getenv("GOBANK_VELOCITY_MAX_TRANSFERS"), os.Getenv("GOBANK_VELOCITY_WINDOW")
+	if maxTransfers == "" && window == "" {
+		return rule, nil
+	}
+	var err error
+	if rule.MaxTransfers, err = strconv.Atoi(maxTransfers); err != nil || rule.MaxTransfers <= 0 {
+		return rule, errors.New("GOBANK_VELOCITY_MAX_TRANSFERS must be a positive integer")
+	}
+	if rule.Window, err = time.ParseDuration(window); err != nil || rule.Window <= 0 {
+		return rule, errors.New("GOBANK_VELOCITY_WINDOW must be a positive duration")
+	}
+	return rule, nil
+}
+
+// HeldTransfer is a transfer request waiting for an operator to release
+// or reject it. TransferID is set once a release has executed it.
+type HeldTransfer struct {
+	ID          int64      `json:"id"`
+	FromAccount int        `json:"fromAccount"`
+	ToAccount   int        `json:"toAccount"`
+	Amount      int64      `json:"amount"`
+	Reason      string     `json:"reason"`
+	Status      string     `json:"status"`
+	TransferID  *int64     `json:"transferId,omitempty"`
+	Note        string     `json:"note,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ResolvedAt  *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// TransferHoldStore persists held transfers. Releasing executes the
+// transfer and marks it released atomically, so a transfer is never
+// executed twice.
+type TransferHoldStore interface {
+	// CountTransfersSince counts transfers from an account at or after since.
+	CountTransfersSince(accountID int, since time.Time) (int, error)
+	CreateHeldTransfer(h *HeldTransfer) error
+	// HeldTransfers lists held transfers in a status, oldest first.
+	HeldTransfers(status string, limit int) ([]*HeldTransfer, error)
+	ReleaseHeldTransfer(id int64, note string) (*HeldTransfer, *TransferRecord, error)
+	RejectHeldTransfer(id int64, note string) (*HeldTransfer, error)
+}
+
+// holdIfTooFast holds the transfer and returns the hold if its source
+// account is over the velocity rule; otherwise it returns nil.
+func (s *APIServer) holdIfTooFast(req *TransferRequest) (*HeldTransfer, error) {
+	if s.holds == nil || !s.velocity.Enabled() {
+		return nil, nil
+	}
+	recent, err := s.holds.CountTransfersSince(req.FromAccount, time.Now().Add(-s.velocity.Window))
+	if err != nil || recent < s.velocity.MaxTransfers {
+		return nil, err
+	}
+	return s.holdTransfer(req, fmt.Sprintf("%d transfers in the last %s", recent, s.velocity.Window))
+}
+
+// holdTransfer records the transfer as held for reason.
+func (s *APIServer) holdTransfer(req *TransferRequest, reason string) (*HeldTransfer, error) {
+	held := &HeldTransfer{
+		FromAccount: req.FromAccount,
+		ToAccount:   req.ToAccount,
+		Amount:      req.Amount,
+		Reason:      reason,
+	}
+	if err := s.holds.CreateHeldTransfer(held); err != nil {
+		return nil, err
+	}
+	transfersHeld.Inc()
+	return held, nil
+}
+
+func (s *APIServer) transferHoldRoutes(router *mux.Router) {
+	admin := func(f apiFunc) http.HandlerFunc { return makeHTTPHandleFunc(s.requireAdmin(f)) }
+	router.HandleFunc("/admin/transfers/held", admin(s.handleListHeldTransfers)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/transfers/held/{holdId}/release", admin(s.handleReleaseHeldTransfer)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/transfers/held/{holdId}/reject", admin(s.handleRejectHeldTransfer)).Methods(http.MethodPost)
+}
+
+func (s *APIServer) requireHolds() error {
+	if s.holds == nil {
+		return &apiError{status: http.StatusServiceUnavailable, code: CodeUnavailable, err: errors.New("transfer holds are not configured")}
+	}
+	return nil
+}
+
+// handleListHeldTransfers lists up to 100 held transfers, by default those
+// still waiting for review.
+func (s *APIServer) handleListHeldTransfers(w http.ResponseWriter, r *http.Request) error {
+	if err := s.requireHolds(); err != nil {
+		return err
+	}
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = HoldPending
+	}
+	if status != HoldPending && status != HoldReleased && status != HoldRejected {
+		return validationFailed(ValidationErrors{{Field: "status", Message: fmt.Sprintf("must be %s, %s or %s", HoldPending, HoldReleased, HoldRejected)}})
+	}
+	held, err := s.holds.HeldTransfers(status, 100)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, held, nil)
+}
+
+// holdResolution reads the hold ID and the optional {"note": "..."} body
+// recorded with a release or rejection.
+func holdResolution(r *http.Request) (int64, string, error) {
+	idStr := mux.Vars(r)["holdId"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, "", badRequest(fmt.Errorf("invalid held transfer id %q", idStr))
+	}
+	note, err := resolutionNote(r)
+	return id, note, err
+}
+
+// resolutionNote reads the optional {"note": "..."} request body.
+func resolutionNote(r *http.Request) (string, error) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return "", badRequest(fmt.Errorf("invalid request body: %w", err))
+		}
+	}
+	if len(req.Note) > 500 {
+		return "", validationFailed(ValidationErrors{{Field: "note", Message: "must be at most 500 characters"}})
+	}
+	return req.Note, nil
+}
+
+// handleReleaseHeldTransfer executes a held transfer. It is subject to the
+// usual balance, status and limit checks; if those fail the transfer stays
+// held so it can be retried or rejected.
+func (s *APIServer) handleReleaseHeldTransfer(w http.ResponseWriter, r *http.Request) error {
+	if err := s.requireHolds(); err != nil {
+		return err
+	}
+	id, note, err := holdResolution(r)
+	if err != nil {
+		return err
+	}
+	held, record, err := s.holds.ReleaseHeldTransfer(id, note)
+	observeTransfer(record, err)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, map[string]any{"hold": held, "transfer": record}, nil)
+}
+
+func (s *APIServer) handleRejectHeldTransfer(w http.ResponseWriter, r *http.Request) error {
+	if err := s.requireHolds(); err != nil {
+		return err
+	}
+	id, note, err := holdResolution(r)
+	if err != nil {
+		return err
+	}
+	held, err := s.holds.RejectHeldTransfer(id, note)
+	if err != nil {
+		return err
+	}
+	return writeData(w, http.StatusOK, held, nil)
+}
+
+const heldTransferColumns = `id, from_account, to_account, amount, reason, status, transfer_id, note, created_at, resolved_at`
+
+func scanIntoHeldTransfer(row interface{ Scan(...any) error }) (*HeldTransfer, error) {
+	h := new(HeldTransfer)
+	var transferID sql.NullInt64
+	var resolvedAt sql.NullTime
+	if err := row.Scan(&h.ID, &h.FromAccount, &h.ToAccount, &h.Amount, &h.Reason, &h.Status,
+		&transferID, &h.Note, &h.CreatedAt, &resolvedAt); err != nil {
+		return nil, err
+	}
+	if transferID.Valid {
+		h.TransferID = &transferID.Int64
+	}
+	if resolvedAt.Valid {
+		h.ResolvedAt = &resolvedAt.Time
+	}
+	return h, nil
+}
+
+func (s *PostgresStore) CountTransfersSince(accountID int, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(`select count(*) from transfer where from_account = $1 and created_at >= $2`,
+		accountID, since).Scan(&n)
+	return n, err
+}
+
+func (s *PostgresStore) CreateHeldTransfer(h *HeldTransfer) error {
+	h.Status = HoldPending
+	return s.db.QueryRow(`insert into held_transfer (from_account, to_account, amount, reason)
+	values ($1, $2, $3, $4) returning id, created_at`, h.FromAccount, h.ToAccount, h.Amount, h.Reason).
+		Scan(&h.ID, &h.CreatedAt)
+}
+
+func (s *PostgresStore) HeldTransfers(status string, limit int) ([]*HeldTransfer, error) {
+	rows, err := s.db.Query(`select `+heldTransferColumns+` from held_transfer
+	where status = $1 order by created_at, id limit $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	held := []*HeldTransfer{}
+	for rows.Next() {
+		h, err := scanIntoHeldTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		held = append(held, h)
+	}
+	return held, rows.Err()
+}
+
+// lockHeldTransfer locks a held transfer that is still waiting for review.
+func lockHeldTransfer(tx *sql.Tx, id int64) (*HeldTransfer, error) {
+	h, err := scanIntoHeldTransfer(tx.QueryRow(`select `+heldTransferColumns+` from held_transfer
+	where id = $1 for update`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrHeldTransferNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if h.Status != HoldPending {
+		return nil, fmt.Errorf("%w: %d is %s", ErrHoldResolved, id, h.Status)
+	}
+	return h, nil
+}
+
+func (s *PostgresStore) ReleaseHeldTransfer(id int64, note string) (*HeldTransfer, *TransferRecord, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	h, err := lockHeldTransfer(tx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	record, err := s.transfer(tx, h.FromAccount, h.ToAccount, h.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	h, err = scanIntoHeldTransfer(tx.QueryRow(`update held_transfer set status = $2, transfer_id = $3, note = $4,
+	resolved_at = now() where id = $1 returning `+heldTransferColumns, id, HoldReleased, record.ID, note))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return h, record, nil
+}
+
+func (s *PostgresStore) RejectHeldTransfer(id int64, note string) (*HeldTransfer, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := lockHeldTransfer(tx, id); err != nil {
+		return nil, err
+	}
+	h, err := scanIntoHeldTransfer(tx.QueryRow(`update held_transfer set status = $2, note = $3, resolved_at = now()
+	where id = $1 returning `+heldTransferColumns, id, HoldRejected, note))
+	if err != nil {
+		return nil, err
+	}
+	return h, tx.Commit()
+}
@@ -1,6 +1,83 @@
 package main
 
-import "math/rand"
+import (
+	"strings"
+	"time"
+)
+
+type CreateAccountRequest struct {
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	// Currency is an ISO 4217 code; empty means DefaultCurrency.
+	Currency string `json:"currency"`
+	// Type is AccountChecking (the default) or AccountSavings.
+	Type string `json:"type"`
+}
+
+// Validate trims the names and checks every field, reporting all invalid
+// fields together.
+func (r *CreateAccountRequest) Validate() error {
+	var v Validator
+	r.FirstName = strings.TrimSpace(r.FirstName)
+	r.LastName = strings.TrimSpace(r.LastName)
+	v.Check(r.FirstName != "", "firstname", "is required")
+	v.Check(len(r.FirstName) <= 100, "firstname", "must be at most 100 characters")
+	v.Check(r.LastName != "", "lastname", "is required")
+	v.Check(len(r.LastName) <= 100, "lastname", "must be at most 100 characters")
+
+	if r.Currency == "" {
+		r.Currency = string(DefaultCurrency)
+	}
+	currency, err := ParseCurrency(r.Currency)
+	v.Checkf(err == nil, "currency", "unsupported currency %q", r.Currency)
+	if err == nil {
+		r.Currency = string(currency)
+	}
+
+	if r.Type == "" {
+		r.Type = AccountChecking
+	}
+	v.Checkf(r.Type == AccountChecking || r.Type == AccountSavings,
+		"type", "must be %q or %q", AccountChecking, AccountSavings)
+	return v.Err()
+}
+
+// maxOperationAmount caps a single deposit, withdrawal or transfer.
+const maxOperationAmount = 1_000_000_000
+
+func checkAmount(v *Validator, amount int64) {
+	v.Check(amount > 0, "amount", "must be greater than 0")
+	v.Check(amount <= maxOperationAmount, "amount", "exceeds the per-operation limit")
+}
+
+type AmountRequest struct {
+	Amount int64 `json:"amount"`
+}
+
+// Validate checks the amount is positive and below the per-operation cap.
+func (r *AmountRequest) Validate() error {
+	var v Validator
+	checkAmount(&v, r.Amount)
+	return v.Err()
+}
+
+// TransferRequest moves Amount, in the source account's currency, between
+// two accounts identified by ID.
+type TransferRequest struct {
+	FromAccount int   `json:"fromAccount"`
+	ToAccount   int   `json:"toAccount"`
+	Amount      int64 `json:"amount"`
+}
+
+// Validate checks both accounts are set and distinct and the amount is in range.
+func (r *TransferRequest) Validate() error {
+	var v Validator
+	v.Check(r.FromAccount > 0, "fromAccount", "is required")
+	v.Check(r.ToAccount > 0, "toAccount", "is required")
+	v.Check(r.FromAccount != r.ToAccount, "toAccount", "must differ from fromAccount")
+	checkAmount(&v, r.Amount)
+	return v.Err()
+}
 
 type Account struct {
 	ID        int    `json:"id"`
@@ -8,13 +85,104 @@ type Account struct {
 	LastName  string `json:"lastname"`
 	AccountNo int64  `json:"accountnumber"`
 	Balance   int64  `json:"balance"`
+	// OverdraftLimit is how far below zero withdrawals and transfers may take the balance.
+	OverdraftLimit int64    `json:"overdraftLimit"`
+	Currency       Currency `json:"currency"`
+	Type           string   `json:"type"`
+	// InterestRateBps is the annual interest rate in basis points; only
+	// savings accounts accrue interest.
+	InterestRateBps int `json:"interestRateBps"`
+	// Status is AccountPending, AccountActive, AccountFrozen or
+	// AccountClosed; see checkMovement for what each allows.
+	Status string `json:"status"`
+	// DailyTransferLimit caps outgoing transfers plus withdrawals per UTC
+	// day; nil means unlimited.
+	DailyTransferLimit *int64 `json:"dailyTransferLimit"`
+	// WeeklyTransferLimit is the same cap per UTC week starting Monday.
+	WeeklyTransferLimit *int64 `json:"weeklyTransferLimit"`
+	// Version increases with every change to the account; see
+	// account_update.go.
+	Version   int64      `json:"version"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ClosedAt  *time.Time `json:"closedAt,omitempty"`
+}
+
+// Account types.
+const (
+	AccountChecking = "checking"
+	AccountSavings  = "savings"
+)
+
+// BalanceMoney returns the balance together with its currency.
+func (a *Account) BalanceMoney() Money {
+	return NewMoney(a.Balance, a.Currency)
+}
+
+// Account entry kinds.
+const (
+	EntryDeposit    = "deposit"
+	EntryWithdrawal = "withdrawal"
+	EntryInterest   = "interest"
+)
+
+// AccountEntry records a deposit, withdrawal or interest credit on a
+// single account.
+type AccountEntry struct {
+	ID             int64     `json:"id"`
+	AccountID      int       `json:"accountId"`
+	Kind           string    `json:"kind"`
+	Amount         int64     `json:"amount"`
+	BalanceAfter   int64     `json:"balanceAfter"`
+	IdempotencyKey string    `json:"idempotencyKey,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	// Replayed is set when the entry was returned for a repeated idempotency key.
+	Replayed bool `json:"replayed"`
 }
 
+// NewAccount creates an unsaved account. The storage layer assigns its ID
+// and account number.
 func NewAccount(fn, ln string) *Account {
 	return &Account{
-		ID:        rand.Intn(10000),
 		FirstName: fn,
 		LastName:  ln,
-		AccountNo: int64(rand.Intn(1000000)),
+		Status:    AccountActive,
+		CreatedAt: time.Now().UTC(),
 	}
 }
+
+// TransferRecord is a committed transfer. Credit differs from Debit when
+// the accounts use different currencies.
+type TransferRecord struct {
+	ID          int64     `json:"id"`
+	FromAccount int       `json:"fromAccount"`
+	ToAccount   int       `json:"toAccount"`
+	Debit       Money     `json:"debit"`
+	Credit      Money     `json:"credit"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// LimitsRequest sets an account's daily and weekly transfer limits. A
+// null limit removes it.
+type LimitsRequest struct {
+	DailyTransferLimit  *int64 `json:"dailyTransferLimit"`
+	WeeklyTransferLimit *int64 `json:"weeklyTransferLimit"`
+}
+
+func (r *LimitsRequest) Validate() error {
+	var v Validator
+	v.Check(r.DailyTransferLimit == nil || *r.DailyTransferLimit >= 0, "dailyTransferLimit", "must not be negative")
+	v.Check(r.WeeklyTransferLimit == nil || *r.WeeklyTransferLimit >= 0, "weeklyTransferLimit", "must not be negative")
+	if r.DailyTransferLimit != nil && r.WeeklyTransferLimit != nil {
+		v.Check(*r.WeeklyTransferLimit >= *r.DailyTransferLimit, "weeklyTransferLimit", "must not be less than dailyTransferLimit")
+	}
+	return v.Err()
+}
+
+// BankStats are aggregate figures for the admin API.
+type BankStats struct {
+	Accounts       int                `json:"accounts"`
+	FrozenAccounts int                `json:"frozenAccounts"`
+	ClosedAccounts int                `json:"closedAccounts"`
+	Balances       map[Currency]int64 `json:"balances"`
+	TransfersToday int                `json:"transfersToday"`
+}
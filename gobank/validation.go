@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// FieldError describes why one request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects every invalid field of a request so clients
+// can fix them all at once. It renders as a 422 with the fields listed.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, fe := range v {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validator accumulates field errors:
+//
+//	var v Validator
+//	v.Check(req.Amount > 0, "amount", "must be greater than 0")
+//	return v.Err()
+type Validator struct {
+	errs ValidationErrors
+}
+
+// Check records message for field unless ok. Only the first failure per
+// field is kept.
+func (v *Validator) Check(ok bool, field, message string) {
+	if ok || v.Has(field) {
+		return
+	}
+	v.errs = append(v.errs, FieldError{Field: field, Message: message})
+}
+
+// Checkf is Check with a formatted message.
+func (v *Validator) Checkf(ok bool, field, format string, args ...any) {
+	if !ok {
+		v.Check(false, field, fmt.Sprintf(format, args...))
+	}
+}
+
+// Has reports whether field already failed.
+func (v *Validator) Has(field string) bool {
+	for _, fe := range v.errs {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the collected errors, or nil if every check passed.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Validatable is implemented by request DTOs. Validate normalizes the
+// request in place and returns ValidationErrors for invalid fields.
+type Validatable interface {
+	Validate() error
+}
+
+// maxRequestBody caps JSON request bodies.
+const maxRequestBody = 1 << 20
+
+// decodeRequest decodes a JSON body into dst, rejecting unknown fields and
+// trailing data, then validates it. Decoding problems are 400s and
+// validation problems 422s with field errors.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst Validatable) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return badRequest(fmt.Errorf("invalid request body: %w", err))
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return badRequest(fmt.Errorf("invalid request body: unexpected data after JSON object"))
+	}
+	if err := dst.Validate(); err != nil {
+		return validationFailed(err)
+	}
+	return nil
+}
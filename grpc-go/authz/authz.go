@@ -0,0 +1,294 @@
+// Package authz decides which authenticated callers may call which RPCs.
+// A YAML policy file maps full method names to the roles and scopes the
+// caller's token must carry; the Authorizer rereads the file when it
+// changes, so new RPCs can be locked down without a release.
+//
+//	# Methods not listed are allowed unless default is deny.
+//	default: allow
+//	methods:
+//	  /Greeter/BatchSayHello:
+//	    roles: [batch, admin]
+//	  /greeter.v2.Greeter/*:
+//	    scopes: [greeter.v2]
+//
+// A rule is met by a caller holding any one of its roles and all of its
+// scopes. "/<service>/*" applies to every method of a service that has no
+// rule of its own.
+package authz
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// Claims are what a token grants its bearer.
+type Claims struct {
+	Roles  []string
+	Scopes []string
+}
+
+// Rule lists what a caller needs to call a method.
+type Rule struct {
+	// Roles are alternatives: one of them suffices. Empty means any role.
+	Roles []string `yaml:"roles"`
+	// Scopes are all required.
+	Scopes []string `yaml:"scopes"`
+}
+
+// allows reports whether c meets the rule.
+func (r Rule) allows(c Claims) bool {
+	if len(r.Roles) > 0 && !slices.ContainsFunc(r.Roles, func(role string) bool { return slices.Contains(c.Roles, role) }) {
+		return false
+	}
+	for _, s := range r.Scopes {
+		if !slices.Contains(c.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// String describes the rule for PermissionDenied messages.
+func (r Rule) String() string {
+	var parts []string
+	if len(r.Roles) > 0 {
+		parts = append(parts, "one of roles "+strings.Join(r.Roles, ", "))
+	}
+	if len(r.Scopes) > 0 {
+		parts = append(parts, "scopes "+strings.Join(r.Scopes, ", "))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// Default decisions for methods without a rule.
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// Policy is the parsed policy file.
+type Policy struct {
+	// Default is Allow (or empty) or Deny.
+	Default string `yaml:"default"`
+	// Methods maps full method names, e.g. "/Greeter/SayHello", or
+	// "/<service>/*" to their rules.
+	Methods map[string]Rule `yaml:"methods"`
+}
+
+// ParsePolicy parses and checks a policy file. Unknown keys are errors,
+// like in the server config, so typos cannot silently open a method.
+func ParsePolicy(b []byte) (*Policy, error) {
+	var p Policy
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	var errs []error
+	if p.Default != "" && p.Default != Allow && p.Default != Deny {
+		errs = append(errs, fmt.Errorf("default %q is not %s or %s", p.Default, Allow, Deny))
+	}
+	for m, r := range p.Methods {
+		service, method, ok := strings.Cut(strings.TrimPrefix(m, "/"), "/")
+		if !strings.HasPrefix(m, "/") || !ok || service == "" || method == "" || strings.Contains(method, "/") {
+			errs = append(errs, fmt.Errorf("method %q is not /<service>/<method> or /<service>/*", m))
+		}
+		if len(r.Roles) == 0 && len(r.Scopes) == 0 {
+			errs = append(errs, fmt.Errorf("method %q: rule needs roles or scopes", m))
+		}
+	}
+	return &p, errors.Join(errs...)
+}
+
+// rule returns the rule for a full method name and whether there is one.
+func (p *Policy) rule(method string) (Rule, bool) {
+	if r, ok := p.Methods[method]; ok {
+		return r, true
+	}
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		if r, ok := p.Methods[method[:i]+"/*"]; ok {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Config locates the policy file and the claims of tokens.
+type Config struct {
+	// PolicyFile is the YAML policy; empty disables authorization.
+	PolicyFile string
+	// ReloadInterval is how often Watch checks the file for changes.
+	ReloadInterval time.Duration
+	// Claims returns the claims of tokens it knows. Other tokens, such as
+	// static GRPC_AUTH_TOKENS, have none and pass only methods without a rule.
+	Claims func(token string) (Claims, bool)
+	// Exempt holds full method names, e.g. "/grpc.health.v1.Health/Check".
+	Exempt []string
+}
+
+// ConfigFromEnv reads GRPC_AUTHZ_POLICY, the policy file, and
+// GRPC_AUTHZ_RELOAD_INTERVAL, a duration like "5s".
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{PolicyFile: os.Getenv("GRPC_AUTHZ_POLICY"), ReloadInterval: 5 * time.Second}
+	if s := os.Getenv("GRPC_AUTHZ_RELOAD_INTERVAL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("GRPC_AUTHZ_RELOAD_INTERVAL: %q is not a positive duration", s)
+		}
+		cfg.ReloadInterval = d
+	}
+	return cfg, nil
+}
+
+// fileStamp identifies a version of the policy file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Authorizer checks calls against the current policy.
+type Authorizer struct {
+	cfg    Config
+	policy atomic.Pointer[Policy]
+	// mu serializes reloads; stamp is the file version policy was read from.
+	mu    sync.Mutex
+	stamp fileStamp
+}
+
+// New loads cfg.PolicyFile. A missing or invalid file is an error, so the
+// server does not start with a policy other than the one intended.
+func New(cfg Config) (*Authorizer, error) {
+	a := &Authorizer{cfg: cfg}
+	if !a.Enabled() {
+		return a, nil
+	}
+	if _, err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Enabled reports whether a policy file is configured; without one the
+// interceptors let every call through.
+func (a *Authorizer) Enabled() bool { return a.cfg.PolicyFile != "" }
+
+// Reload rereads the policy file if it changed since it was last read and
+// reports whether it did. An invalid file leaves the current policy in
+// place and is reported once, not again until it changes.
+func (a *Authorizer) Reload() (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fi, err := os.Stat(a.cfg.PolicyFile)
+	if err != nil {
+		return false, fmt.Errorf("authz policy: %w", err)
+	}
+	stamp := fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+	if a.policy.Load() != nil && stamp == a.stamp {
+		return false, nil
+	}
+	b, err := os.ReadFile(a.cfg.PolicyFile)
+	if err != nil {
+		return false, fmt.Errorf("authz policy: %w", err)
+	}
+	p, err := ParsePolicy(b)
+	a.stamp = stamp
+	if err != nil {
+		return false, fmt.Errorf("authz policy %s: %w", a.cfg.PolicyFile, err)
+	}
+	a.policy.Store(p)
+	return true, nil
+}
+
+// Watch reloads the policy every cfg.ReloadInterval until ctx is done,
+// logging changes and errors.
+func (a *Authorizer) Watch(ctx context.Context) {
+	if !a.Enabled() {
+		return
+	}
+	ticker := time.NewTicker(a.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := a.Reload()
+		if err != nil {
+			log.Printf("%v; keeping the previous policy", err)
+		} else if changed {
+			log.Printf("authz policy %s reloaded", a.cfg.PolicyFile)
+		}
+	}
+}
+
+// UnaryServerInterceptor rejects calls whose token lacks the roles or
+// scopes the policy requires with codes.PermissionDenied. It belongs after
+// authentication, which rejects missing and invalid tokens.
+func (a *Authorizer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := a.authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming RPCs; the
+// policy is checked once, when the stream opens.
+func (a *Authorizer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := a.authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (a *Authorizer) authorize(ctx context.Context, method string) error {
+	p := a.policy.Load()
+	if p == nil || slices.Contains(a.cfg.Exempt, method) {
+		return nil
+	}
+	rule, ok := p.rule(method)
+	if !ok {
+		if p.Default == Deny {
+			return status.Errorf(codes.PermissionDenied, "%s is not allowed by the authorization policy", method)
+		}
+		return nil
+	}
+	var claims Claims
+	if token, ok := bearerToken(ctx); ok && a.cfg.Claims != nil {
+		claims, _ = a.cfg.Claims(token)
+	}
+	if !rule.allows(claims) {
+		return status.Errorf(codes.PermissionDenied, "%s requires %s", method, rule)
+	}
+	return nil
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", false
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	return token, ok && token != ""
+}
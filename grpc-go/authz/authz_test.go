@@ -0,0 +1,151 @@
+package authz
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy([]byte(`
+default: deny
+methods:
+  /Greeter/SayHello:
+    roles: [admin, greeter]
+  /greeter.v2.Greeter/*:
+    scopes: [greeter.v2]
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	for _, tt := range []struct {
+		method string
+		want   bool
+	}{
+		{"/Greeter/SayHello", true},
+		{"/Greeter/Chat", false},
+		{"/greeter.v2.Greeter/SayHello", true},
+	} {
+		if _, ok := p.rule(tt.method); ok != tt.want {
+			t.Errorf("rule(%q) found = %t, want %t", tt.method, ok, tt.want)
+		}
+	}
+
+	for name, doc := range map[string]string{
+		"unknown key":    "methods:\n  /Greeter/SayHello:\n    role: [admin]\n",
+		"bad default":    "default: maybe\n",
+		"bad method":     "methods:\n  Greeter.SayHello:\n    roles: [admin]\n",
+		"empty rule":     "methods:\n  /Greeter/SayHello: {}\n",
+		"nested service": "methods:\n  /a/b/c:\n    roles: [admin]\n",
+	} {
+		if _, err := ParsePolicy([]byte(doc)); err == nil {
+			t.Errorf("%s: ParsePolicy succeeded", name)
+		}
+	}
+}
+
+func TestRuleAllows(t *testing.T) {
+	rule := Rule{Roles: []string{"admin", "greeter"}, Scopes: []string{"read", "write"}}
+	for _, tt := range []struct {
+		name   string
+		claims Claims
+		want   bool
+	}{
+		{"one role and all scopes", Claims{Roles: []string{"greeter"}, Scopes: []string{"write", "read"}}, true},
+		{"missing scope", Claims{Roles: []string{"admin"}, Scopes: []string{"read"}}, false},
+		{"no matching role", Claims{Roles: []string{"viewer"}, Scopes: []string{"read", "write"}}, false},
+		{"no claims", Claims{}, false},
+	} {
+		if got := rule.allows(tt.claims); got != tt.want {
+			t.Errorf("%s: allows = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func writePolicy(t *testing.T, path, doc string, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Set the time explicitly; rewrites within the filesystem's timestamp
+	// resolution would otherwise look unchanged.
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	mtime := time.Now().Add(-time.Hour)
+	writePolicy(t, path, "methods:\n  /Greeter/SayHello:\n    roles: [admin]\n", mtime)
+	a, err := New(Config{
+		PolicyFile: path,
+		Claims: func(token string) (Claims, bool) {
+			if token == "admin" {
+				return Claims{Roles: []string{"admin"}}, true
+			}
+			return Claims{}, false
+		},
+		Exempt: []string{"/grpc.health.v1.Health/Check"},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	call := func(token, method string) codes.Code {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+		return status.Code(a.authorize(ctx, method))
+	}
+	if got := call("admin", "/Greeter/SayHello"); got != codes.OK {
+		t.Errorf("admin: %v, want OK", got)
+	}
+	if got := call("other", "/Greeter/SayHello"); got != codes.PermissionDenied {
+		t.Errorf("other: %v, want PermissionDenied", got)
+	}
+	if got := call("other", "/Greeter/Chat"); got != codes.OK {
+		t.Errorf("unlisted method: %v, want OK", got)
+	}
+
+	// Lock everything down; unchanged files are not reread.
+	if changed, err := a.Reload(); changed || err != nil {
+		t.Errorf("Reload of unchanged file = %t, %v", changed, err)
+	}
+	writePolicy(t, path, "default: deny\n", mtime.Add(time.Minute))
+	if changed, err := a.Reload(); !changed || err != nil {
+		t.Fatalf("Reload = %t, %v", changed, err)
+	}
+	if got := call("admin", "/Greeter/Chat"); got != codes.PermissionDenied {
+		t.Errorf("after reload: %v, want PermissionDenied", got)
+	}
+	if got := call("", "/grpc.health.v1.Health/Check"); got != codes.OK {
+		t.Errorf("exempt method: %v, want OK", got)
+	}
+
+	// A broken edit keeps the last good policy.
+	writePolicy(t, path, "default: [\n", mtime.Add(2*time.Minute))
+	if _, err := a.Reload(); err == nil {
+		t.Error("Reload of invalid policy succeeded")
+	}
+	if got := call("admin", "/Greeter/Chat"); got != codes.PermissionDenied {
+		t.Errorf("after invalid reload: %v, want PermissionDenied", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	a, err := New(Config{})
+	if err != nil || a.Enabled() {
+		t.Fatalf("New without a policy = %t, %v; want disabled", a.Enabled(), err)
+	}
+	if err := a.authorize(context.Background(), "/Greeter/SayHello"); err != nil {
+		t.Errorf("disabled authorizer rejected a call: %v", err)
+	}
+	if _, err := New(Config{PolicyFile: filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("New with a missing policy file succeeded")
+	}
+}
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -7,12 +9,20 @@ import (
 	"time"
 
 	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"github.com/gnsalok/go-project-root/grpc-go/statuserr"
+	"github.com/gnsalok/go-project-root/grpc-go/tlsconfig"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
+	// TLS settings come from GRPC_TLS_* env vars; GRPC_INSECURE=true for plaintext
+	creds, err := tlsconfig.ClientConfigFromEnv().Credentials()
+	if err != nil {
+		log.Fatalf("failed to load credentials: %v", err)
+	}
 	// Set up a connection to the server
-	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure(), grpc.WithBlock())
+	conn, err := grpc.Dial("localhost:50051", grpc.WithTransportCredentials(creds), grpc.WithBlock())
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -20,14 +30,33 @@ func main() {
 	c := pb.NewGreeterClient(conn)
 
 	// Contact the server and print out its response
-	name := "World"
+	name, language := "World", ""
 	if len(os.Args) > 1 {
 		name = os.Args[1]
 	}
+	if len(os.Args) > 2 {
+		language = os.Args[2]
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	r, err := c.SayHello(ctx, &pb.HelloRequest{Name: name})
+	token := os.Getenv("GRPC_AUTH_TOKEN")
+	// With GRPC_AUTH_USER set, log in for a short-lived token instead.
+	if user := os.Getenv("GRPC_AUTH_USER"); user != "" {
+		t, err := pb.NewAuthClient(conn).Login(ctx, &pb.LoginRequest{Username: user, Password: os.Getenv("GRPC_AUTH_PASSWORD")})
+		if err != nil {
+			log.Fatalf("could not log in: %v", err)
+		}
+		log.Printf("Logged in as %s until %s", user, t.GetExpiresAt().AsTime().Local().Format(time.Kitchen))
+		token = t.GetAccessToken()
+	}
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	r, err := c.SayHello(ctx, &pb.HelloRequest{Name: name, Language: language})
 	if err != nil {
+		for _, v := range statuserr.BadRequest(err) {
+			log.Printf("invalid %s: %s", v.GetField(), v.GetDescription())
+		}
 		log.Fatalf("could not greet: %v", err)
 	}
 	log.Printf("Greeting: %s", r.GetMessage())
@@ -0,0 +1,106 @@
+// Command cluster runs several Greeter servers on consecutive ports for
+// trying out client-side load balancing locally:
+//
+//	go run ./cmd/cluster -n 3 -- -insecure
+//
+// Arguments after -- are passed to every server. Each server's output is
+// prefixed with its port, and the address list to give loadgen's -addrs
+// flag is printed once they are started. Interrupting the command stops
+// all of them.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+func main() {
+	n := flag.Int("n", 3, "number of servers")
+	port := flag.Int("port", 50051, "port of the first server; the others use the ports after it")
+	metricsPort := flag.Int("metrics-port", 0, "port of the first server's /metrics, likewise; 0 disables metrics")
+	bin := flag.String("bin", "", "server binary (default: build the one in the current directory)")
+	flag.Parse()
+	if *n < 1 || *port < 1 || *port+*n-1 > 65535 || *metricsPort < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	path := *bin
+	if path == "" {
+		dir, err := os.MkdirTemp("", "greeter-cluster")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path = filepath.Join(dir, "greeter")
+		build := exec.Command("go", "build", "-o", path, ".")
+		build.Stdout, build.Stderr = os.Stdout, os.Stderr
+		if err := build.Run(); err != nil {
+			log.Fatalf("failed to build server: %v", err)
+		}
+	}
+
+	var (
+		wg    sync.WaitGroup
+		addrs []string
+	)
+	for i := 0; i < *n; i++ {
+		p := *port + i
+		metricsAddr := ""
+		if *metricsPort > 0 {
+			metricsAddr = ":" + strconv.Itoa(*metricsPort+i)
+		}
+		args := append([]string{"-port", strconv.Itoa(p), "-metrics-addr=" + metricsAddr}, flag.Args()...)
+		cmd := exec.Command(path, args...)
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			log.Fatal(err)
+		}
+		cmd.Stderr = cmd.Stdout
+		if err := cmd.Start(); err != nil {
+			log.Fatalf("failed to start server on port %d: %v", p, err)
+		}
+		addrs = append(addrs, "localhost:"+strconv.Itoa(p))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prefix(os.Stdout, out, fmt.Sprintf("[%d] ", p))
+			if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+				log.Printf("server on port %d exited: %v", p, err)
+			}
+		}()
+
+		// Stop the server when the cluster is interrupted.
+		go func() {
+			<-ctx.Done()
+			cmd.Process.Signal(os.Interrupt)
+		}()
+	}
+
+	log.Printf("started %d servers; try:\n\n\tgo run ./cmd/loadgen -addrs %s\n", *n, strings.Join(addrs, ","))
+	wg.Wait()
+}
+
+// prefix copies r to w line by line, starting each line with p.
+func prefix(w io.Writer, r io.Reader, p string) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fmt.Fprintln(w, p+sc.Text())
+	}
+}
@@ -0,0 +1,215 @@
+// Command loadgen sends SayHello requests to a Greeter server at a fixed
+// rate and concurrency, then reports latency percentiles and errors by
+// status code:
+//
+//	go run ./cmd/loadgen -addr localhost:50051 -qps 200 -c 20 -duration 30s
+//
+// With -addrs it balances requests over several servers, such as those
+// started by cmd/cluster, and also counts the requests each one served:
+//
+//	go run ./cmd/loadgen -addrs localhost:50051,localhost:50052,localhost:50053 -lb round_robin
+//
+// TLS and auth settings come from the same GRPC_TLS_*, GRPC_INSECURE and
+// GRPC_AUTH_TOKEN env vars as the sample clients.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"github.com/gnsalok/go-project-root/grpc-go/pbclient"
+	"github.com/gnsalok/go-project-root/grpc-go/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type options struct {
+	addr        string
+	addrs       string
+	lb          string
+	qps         int
+	concurrency int
+	duration    time.Duration
+	timeout     time.Duration
+	payload     int
+	language    string
+	conns       int
+	retries     int
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.addr, "addr", "localhost:50051", "server address, or a gRPC name such as dns:///greeter:50051")
+	flag.StringVar(&o.addrs, "addrs", "", "comma-separated server addresses to balance over, instead of -addr")
+	flag.StringVar(&o.lb, "lb", "", "load balancing policy: pick_first or round_robin (default round_robin with -addrs, else pick_first)")
+	flag.IntVar(&o.qps, "qps", 50, "requests per second across all workers; 0 sends as fast as possible")
+	flag.IntVar(&o.concurrency, "c", 10, "concurrent workers")
+	flag.DurationVar(&o.duration, "duration", 10*time.Second, "how long to send requests")
+	flag.DurationVar(&o.timeout, "timeout", time.Second, "per-request deadline")
+	flag.IntVar(&o.payload, "payload", 5, "name length in bytes (the server rejects more than 100 characters)")
+	flag.StringVar(&o.language, "language", "", "greeting language")
+	flag.IntVar(&o.conns, "conns", 1, "connections to spread requests over")
+	flag.IntVar(&o.retries, "retries", 0, "client-side retries of UNAVAILABLE errors")
+	flag.Parse()
+	if o.concurrency < 1 || o.conns < 1 || o.qps < 0 || o.duration <= 0 || o.payload < 0 || o.retries < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	creds, err := tlsconfig.ClientConfigFromEnv().Credentials()
+	if err != nil {
+		log.Fatalf("failed to load credentials: %v", err)
+	}
+	cfg := pbclient.Config{
+		Target:        o.addr,
+		Credentials:   creds,
+		Timeout:       o.timeout,
+		MaxAttempts:   o.retries + 1,
+		PoolSize:      o.conns,
+		LoadBalancing: o.lb,
+	}
+	if o.addrs != "" {
+		cfg.Target, cfg.Addresses = "", strings.Split(o.addrs, ",")
+		o.addr = o.addrs
+	}
+	client, err := pbclient.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	if token := os.Getenv("GRPC_AUTH_TOKEN"); token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	log.Printf("sending to %s for %s: qps=%d concurrency=%d payload=%dB", o.addr, o.duration, o.qps, o.concurrency, o.payload)
+	r := run(ctx, client, o)
+	r.print(os.Stdout)
+}
+
+// result holds every latency, the count of each status code and the count
+// of requests each server address answered.
+type result struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	codes     map[codes.Code]int
+	servers   map[string]int
+	elapsed   time.Duration
+}
+
+func (r *result) record(d time.Duration, err error, server string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies = append(r.latencies, d)
+	r.codes[status.Code(err)]++
+	if server != "" {
+		r.servers[server]++
+	}
+}
+
+// run sends requests until o.duration has passed. With a qps limit a
+// ticker hands out one token per request; workers that find none wait.
+func run(ctx context.Context, client *pbclient.Client, o options) *result {
+	ctx, cancel := context.WithTimeout(ctx, o.duration)
+	defer cancel()
+
+	var tokens <-chan time.Time
+	if o.qps > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(o.qps))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+	req := &pb.HelloRequest{Name: strings.Repeat("x", o.payload), Language: o.language}
+	r := &result{codes: make(map[codes.Code]int), servers: make(map[string]int)}
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < o.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if tokens != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tokens:
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+				// The request gets its own deadline, not the run's, so
+				// requests in flight at the end are not counted as failed.
+				reqCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.timeout)
+				var p peer.Peer
+				t := time.Now()
+				_, err := client.Greeter().SayHello(reqCtx, req, grpc.Peer(&p))
+				var server string
+				if p.Addr != nil {
+					server = p.Addr.String()
+				}
+				r.record(time.Since(t), err, server)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	return r
+}
+
+func (r *result) print(w io.Writer) {
+	total := len(r.latencies)
+	if total == 0 {
+		fmt.Fprintln(w, "no requests sent")
+		return
+	}
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	failed := total - r.codes[codes.OK]
+
+	fmt.Fprintf(w, "requests:   %d in %s (%.1f/s)\n", total, r.elapsed.Round(time.Millisecond), float64(total)/r.elapsed.Seconds())
+	fmt.Fprintf(w, "errors:     %d (%.2f%%)\n", failed, 100*float64(failed)/float64(total))
+	fmt.Fprintf(w, "latency:    p50=%s p90=%s p99=%s max=%s\n",
+		percentile(r.latencies, 50), percentile(r.latencies, 90), percentile(r.latencies, 99), r.latencies[total-1])
+	fmt.Fprintln(w, "status codes:")
+	found := make([]codes.Code, 0, len(r.codes))
+	for code := range r.codes {
+		found = append(found, code)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+	for _, code := range found {
+		fmt.Fprintf(w, "  %-20s %d\n", code, r.codes[code])
+	}
+	if len(r.servers) > 1 {
+		fmt.Fprintln(w, "servers:")
+		addrs := make([]string, 0, len(r.servers))
+		for addr := range r.servers {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		for _, addr := range addrs {
+			fmt.Fprintf(w, "  %-20s %d (%.1f%%)\n", addr, r.servers[addr], 100*float64(r.servers[addr])/float64(total))
+		}
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	if i < 1 {
+		i = 1
+	}
+	return sorted[i-1]
+}
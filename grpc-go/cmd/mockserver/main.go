@@ -0,0 +1,141 @@
+// Command mockserver serves scripted responses for the RPCs described by
+// the protos in pb, so client teams can test timeouts, retries and error
+// handling without the real backend:
+//
+//	go run ./cmd/mockserver -config cmd/mockserver/example.yaml
+//
+// The YAML script lists, per method, the responses of successive calls,
+// each with a latency, a body or stream messages, and a status code; see
+// example.yaml. Methods without a script fail with UNIMPLEMENTED. The
+// server is plaintext, like the real one run with -insecure.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	// Registers the protos of every service that can be mocked.
+	_ "github.com/gnsalok/go-project-root/grpc-go/pb"
+	_ "github.com/gnsalok/go-project-root/grpc-go/pb/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func main() {
+	path := flag.String("config", "", "YAML script of responses (required)")
+	port := flag.Int("port", 50051, "listen port")
+	flag.Parse()
+	if *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	s, err := loadScript(*path)
+	if err != nil {
+		log.Fatalf("invalid script: %v", err)
+	}
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	log.Printf("mock server listening at %v with %d scripted methods", lis.Addr(), len(s))
+	if err := newServer(s).Serve(lis); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// newServer answers every call from s, whatever its service.
+func newServer(s script) *grpc.Server {
+	return grpc.NewServer(grpc.UnknownServiceHandler(s.handle))
+}
+
+// handle replies to one call with the method's next response. Requests
+// are read and dropped; client streams are read to the end first. A
+// bidirectional stream takes a response for every request, and ends with
+// the first one carrying an error.
+func (s script) handle(_ any, stream grpc.ServerStream) error {
+	name, _ := grpc.MethodFromServerStream(stream)
+	m, ok := s[name]
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "mockserver: no script for %s", name)
+	}
+	ctx := stream.Context()
+	recv := func() error { return stream.RecvMsg(dynamicpb.NewMessage(m.desc.Input())) }
+
+	if m.desc.IsStreamingClient() && m.desc.IsStreamingServer() {
+		for {
+			if err := recv(); errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := m.reply(ctx, name, stream); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		err := recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !m.desc.IsStreamingClient() {
+			break
+		}
+	}
+	return m.reply(ctx, name, stream)
+}
+
+// reply sends the next response and returns its status.
+func (m *method) reply(ctx context.Context, name string, stream grpc.ServerStream) error {
+	i, r := m.next()
+	log.Printf("%s: response %d (%s)", name, i+1, r.code)
+	if err := sleep(ctx, r.latency); err != nil {
+		return err
+	}
+	msgs := r.stream
+	if r.body != nil {
+		msgs = []proto.Message{r.body}
+	}
+	for j, msg := range msgs {
+		if j > 0 {
+			if err := sleep(ctx, r.interval); err != nil {
+				return err
+			}
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+	if r.code != codes.OK {
+		return status.Error(r.code, r.message)
+	}
+	return nil
+}
+
+// sleep waits for d unless the call ends first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startMock serves the script at path over an in-memory listener.
+func startMock(t *testing.T, path string) *grpc.ClientConn {
+	t.Helper()
+	s, err := loadScript(path)
+	if err != nil {
+		t.Fatalf("loadScript: %v", err)
+	}
+	srv := newServer(s)
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestExampleScript(t *testing.T) {
+	c := pb.NewGreeterClient(startMock(t, "example.yaml"))
+	ctx := context.Background()
+
+	// SayHello loops through two greetings and an error.
+	for i, want := range []struct {
+		code codes.Code
+		msg  string
+	}{
+		{codes.OK, "Hello from the mock"},
+		{codes.OK, "Hello again"},
+		{codes.Unavailable, ""},
+		{codes.OK, "Hello from the mock"},
+	} {
+		resp, err := c.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+		if status.Code(err) != want.code || resp.GetMessage() != want.msg {
+			t.Errorf("call %d = %q, %v; want %q, %v", i+1, resp.GetMessage(), err, want.msg, want.code)
+		}
+	}
+
+	// BatchSayHello repeats its slow last response, which misses deadlines.
+	resp, err := c.BatchSayHello(ctx, &pb.BatchHelloRequest{Names: []string{"Ann"}})
+	if err != nil || resp.GetNextPageToken() != "2" || len(resp.GetMessages()) != 2 {
+		t.Errorf("first BatchSayHello = %v, %v", resp, err)
+	}
+	short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.BatchSayHello(short, &pb.BatchHelloRequest{Names: []string{"Cy"}}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("slow BatchSayHello: got %v, want DEADLINE_EXCEEDED", err)
+	}
+
+	// SayHelloStream sends two messages before failing.
+	stream, err := c.SayHelloStream(ctx, &pb.HelloStreamRequest{Name: "World", Count: 5})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	var got []string
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			if status.Code(err) != codes.Internal {
+				t.Errorf("stream ended with %v, want INTERNAL", err)
+			}
+			break
+		}
+		got = append(got, msg.GetMessage())
+	}
+	if len(got) != 2 {
+		t.Errorf("stream messages = %q, want two", got)
+	}
+
+	// Chat answers every message.
+	chat, err := c.Chat(ctx)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := chat.Send(&pb.ChatMessage{Name: "me", Text: "hi"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if msg, err := chat.Recv(); err != nil || msg.GetName() != "server" {
+			t.Errorf("Recv = %v, %v", msg, err)
+		}
+	}
+	chat.CloseSend()
+	if _, err := chat.Recv(); err != io.EOF {
+		t.Errorf("Recv after CloseSend: %v, want EOF", err)
+	}
+
+	// Methods without a script are unimplemented.
+	stream2, err := c.SayHelloToAll(ctx)
+	if err == nil {
+		_, err = stream2.CloseAndRecv()
+	}
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("SayHelloToAll: got %v, want UNIMPLEMENTED", err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  methodConfig
+		key  string
+	}{
+		{"unknown service", methodConfig{Responses: []responseConfig{{}}}, "Nope/SayHello"},
+		{"unknown method", methodConfig{Responses: []responseConfig{{}}}, "Greeter/Nope"},
+		{"no responses", methodConfig{}, "Greeter/SayHello"},
+		{"unknown field", methodConfig{Responses: []responseConfig{{Body: map[string]any{"nope": 1}}}}, "Greeter/SayHello"},
+		{"unknown code", methodConfig{Responses: []responseConfig{{Code: "BROKEN"}}}, "Greeter/SayHello"},
+		{"stream on unary", methodConfig{Responses: []responseConfig{{Stream: []any{map[string]any{}}}}}, "Greeter/SayHello"},
+		{"body on stream", methodConfig{Responses: []responseConfig{{Body: map[string]any{}}}}, "Greeter/SayHelloStream"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := fileConfig{Methods: map[string]methodConfig{tt.key: tt.cfg}}
+			if _, err := cfg.compile(); err == nil {
+				t.Error("compile succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the YAML script, keyed by method, e.g. "Greeter/SayHello"
+// or "/greeter.v2.Greeter/SayHello".
+type fileConfig struct {
+	Methods map[string]methodConfig `yaml:"methods"`
+}
+
+type methodConfig struct {
+	// Loop starts over after the last response; otherwise it repeats.
+	Loop      bool             `yaml:"loop"`
+	Responses []responseConfig `yaml:"responses"`
+}
+
+// responseConfig is one scripted reply. Body and the Stream messages are
+// written like protojson, in YAML or JSON syntax.
+type responseConfig struct {
+	// Latency is waited before replying, Interval between stream messages.
+	Latency  time.Duration `yaml:"latency"`
+	Interval time.Duration `yaml:"interval"`
+	Body     any           `yaml:"body"`
+	Stream   []any         `yaml:"stream"`
+	// Code ends the call, after any stream messages; OK by default.
+	Code    string `yaml:"code"`
+	Message string `yaml:"message"`
+}
+
+// response is a responseConfig checked against the method's types.
+type response struct {
+	latency  time.Duration
+	interval time.Duration
+	body     proto.Message
+	stream   []proto.Message
+	code     codes.Code
+	message  string
+}
+
+// method holds the responses of one RPC and where its sequence is.
+type method struct {
+	desc      protoreflect.MethodDescriptor
+	loop      bool
+	responses []response
+	mu        sync.Mutex
+	calls     int
+}
+
+// next returns the response for the next call, and its index.
+func (m *method) next() (int, response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.calls
+	m.calls++
+	if m.loop {
+		i %= len(m.responses)
+	} else {
+		i = min(i, len(m.responses)-1)
+	}
+	return i, m.responses[i]
+}
+
+// script maps full method names, "/Greeter/SayHello", to their responses.
+type script map[string]*method
+
+func loadScript(path string) (script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg fileConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s, err := cfg.compile()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// compile resolves the methods among the protos linked into the binary
+// and parses the responses into their output types.
+func (cfg fileConfig) compile() (script, error) {
+	if len(cfg.Methods) == 0 {
+		return nil, fmt.Errorf("no methods")
+	}
+	s := make(script)
+	for name, mc := range cfg.Methods {
+		desc, err := findMethod(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(mc.Responses) == 0 {
+			return nil, fmt.Errorf("%s: no responses", name)
+		}
+		m := &method{desc: desc, loop: mc.Loop}
+		for i, rc := range mc.Responses {
+			r, err := rc.compile(desc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: response %d: %w", name, i+1, err)
+			}
+			m.responses = append(m.responses, r)
+		}
+		s[fullMethodName(desc)] = m
+	}
+	return s, nil
+}
+
+func (rc responseConfig) compile(desc protoreflect.MethodDescriptor) (response, error) {
+	r := response{latency: rc.Latency, interval: rc.Interval, message: rc.Message}
+	if rc.Code != "" {
+		if err := r.code.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(rc.Code)))); err != nil {
+			return r, err
+		}
+	}
+	if rc.Latency < 0 || rc.Interval < 0 {
+		return r, fmt.Errorf("latency and interval must not be negative")
+	}
+	if desc.IsStreamingServer() {
+		if rc.Body != nil {
+			return r, fmt.Errorf("%s streams its responses; use stream instead of body", desc.Name())
+		}
+		for i, v := range rc.Stream {
+			msg, err := outputMessage(desc, v)
+			if err != nil {
+				return r, fmt.Errorf("stream message %d: %w", i+1, err)
+			}
+			r.stream = append(r.stream, msg)
+		}
+		return r, nil
+	}
+	if rc.Stream != nil {
+		return r, fmt.Errorf("%s returns one response; use body instead of stream", desc.Name())
+	}
+	if r.code == codes.OK {
+		// An OK reply without a body is the empty message.
+		msg, err := outputMessage(desc, rc.Body)
+		if err != nil {
+			return r, fmt.Errorf("body: %w", err)
+		}
+		r.body = msg
+	}
+	return r, nil
+}
+
+// outputMessage parses v, decoded from YAML, as desc's output message.
+func outputMessage(desc protoreflect.MethodDescriptor, v any) (proto.Message, error) {
+	msg := dynamicpb.NewMessage(desc.Output())
+	if v == nil {
+		return msg, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// findMethod looks up name, "Service/Method" with or without the leading
+// slash, in the protos registered by the linked pb packages.
+func findMethod(name string) (protoreflect.MethodDescriptor, error) {
+	service, methodName, ok := strings.Cut(strings.TrimPrefix(name, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("%s: method must be Service/Method", name)
+	}
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unknown service %s", name, service)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is not a service", name, service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(methodName))
+	if md == nil {
+		return nil, fmt.Errorf("%s: %s has no method %s", name, service, methodName)
+	}
+	return md, nil
+}
+
+func fullMethodName(md protoreflect.MethodDescriptor) string {
+	return "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+}
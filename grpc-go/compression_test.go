@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gnsalok/go-project-root/grpc-go/config"
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// wireBytes counts the bytes of messages a client sent and received as
+// they went over the wire, that is after compression.
+type wireBytes struct {
+	sent, received atomic.Int64
+}
+
+func (w *wireBytes) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (w *wireBytes) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+func (w *wireBytes) HandleConn(context.Context, stats.ConnStats)                       {}
+func (w *wireBytes) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch s := s.(type) {
+	case *stats.OutPayload:
+		w.sent.Add(int64(s.WireLength))
+	case *stats.InPayload:
+		w.received.Add(int64(s.WireLength))
+	}
+}
+
+// sayHelloToAll greets names in one SayHelloToAll call.
+func sayHelloToAll(ctx context.Context, c pb.GreeterClient, names []string, opts ...grpc.CallOption) (string, error) {
+	stream, err := c.SayHelloToAll(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range names {
+		if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
+			return "", err
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+	return resp.Message, nil
+}
+
+func TestGzipCompression(t *testing.T) {
+	c := pb.NewGreeterClient(startServer(t, nil))
+
+	resp, err := c.SayHello(authed(testToken), &pb.HelloRequest{Name: "World"}, grpc.UseCompressor(gzip.Name))
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if resp.Message != "Hello World" {
+		t.Errorf("SayHello = %q, want %q", resp.Message, "Hello World")
+	}
+}
+
+func TestMessageSizeLimits(t *testing.T) {
+	c := pb.NewGreeterClient(startServer(t, func(cfg *serverConfig) {
+		cfg.messages = config.Messages{MaxRecvSize: 64, MaxSendSize: 1 << 10}
+	}))
+	long := strings.Repeat("x", maxNameLength)
+
+	for _, tt := range []struct {
+		name string
+		call func() error
+	}{
+		{"request over MaxRecvSize", func() error {
+			_, err := c.SayHello(authed(testToken), &pb.HelloRequest{Name: long})
+			return err
+		}},
+		// The limit applies to the decompressed size, so compression
+		// does not get around it.
+		{"compressed request over MaxRecvSize", func() error {
+			_, err := c.SayHello(authed(testToken), &pb.HelloRequest{Name: long}, grpc.UseCompressor(gzip.Name))
+			return err
+		}},
+		{"response over MaxSendSize", func() error {
+			_, err := sayHelloToAll(authed(testToken), c, strings.Fields(strings.Repeat("World ", 500)))
+			return err
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); status.Code(err) != codes.ResourceExhausted {
+				t.Errorf("got %v, want RESOURCE_EXHAUSTED", err)
+			}
+		})
+	}
+
+	if _, err := c.SayHello(authed(testToken), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("SayHello under the limits: %v", err)
+	}
+}
+
+// BenchmarkSayHelloToAll compares greeting large batches of names with and
+// without gzip. Besides time it reports the bytes each call put on the
+// wire in each direction:
+//
+//	go test -run '^$' -bench SayHelloToAll
+func BenchmarkSayHelloToAll(b *testing.B) {
+	for _, batch := range []int{100, 1000, 10000} {
+		names := make([]string, batch)
+		for i := range names {
+			names[i] = fmt.Sprintf("Customer %05d", i)
+		}
+		for _, compress := range []bool{false, true} {
+			name := fmt.Sprintf("batch=%d/uncompressed", batch)
+			var opts []grpc.CallOption
+			if compress {
+				name = fmt.Sprintf("batch=%d/gzip", batch)
+				opts = append(opts, grpc.UseCompressor(gzip.Name))
+			}
+			b.Run(name, func(b *testing.B) {
+				wire := new(wireBytes)
+				c := pb.NewGreeterClient(startServer(b, func(cfg *serverConfig) {
+					// Measure the transport, not the interceptors.
+					cfg.interceptors = config.Interceptors{}
+				}, grpc.WithStatsHandler(wire)))
+				ctx := authed(testToken)
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := sayHelloToAll(ctx, c, names, opts...); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(wire.sent.Load())/float64(b.N), "sent-B/op")
+				b.ReportMetric(float64(wire.received.Load())/float64(b.N), "recv-B/op")
+			})
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Package config loads the Greeter server's settings. Each setting has a
+// default, which an optional YAML file, then GRPC_* env vars, then
+// command-line flags override in turn.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the server settings. The YAML file uses the field tags;
+// see Load for the env vars and flags.
+type Config struct {
+	Port int `yaml:"port"`
+	// MetricsAddr serves Prometheus /metrics; empty disables it.
+	MetricsAddr string `yaml:"metricsAddr"`
+	// LogLevel is the lowest level of request log lines written: debug,
+	// info, warn or error. Successful calls log at info, failures at warn.
+	LogLevel     string       `yaml:"logLevel"`
+	TLS          TLS          `yaml:"tls"`
+	Keepalive    Keepalive    `yaml:"keepalive"`
+	Messages     Messages     `yaml:"messages"`
+	Interceptors Interceptors `yaml:"interceptors"`
+}
+
+// TLS locates the server's key pair and, for mutual TLS, the CA client
+// certificates must chain to.
+type TLS struct {
+	CertFile     string `yaml:"certFile"`
+	KeyFile      string `yaml:"keyFile"`
+	ClientCAFile string `yaml:"clientCAFile"`
+	// Insecure serves plaintext; meant for local development only.
+	Insecure bool `yaml:"insecure"`
+}
+
+// Keepalive configures server pings and how often clients may ping. Zero
+// MaxConnectionIdle and MaxConnectionAge mean unlimited.
+type Keepalive struct {
+	// Time is how long a connection may be quiet before the server pings it,
+	// and Timeout how long it then waits for the ack.
+	Time              time.Duration `yaml:"time"`
+	Timeout           time.Duration `yaml:"timeout"`
+	MaxConnectionIdle time.Duration `yaml:"maxConnectionIdle"`
+	// MaxConnectionAge closes connections after this long so clients
+	// rebalance across replicas, and MaxConnectionAgeGrace is how long their
+	// calls may then take to finish; zero means unlimited.
+	MaxConnectionAge      time.Duration `yaml:"maxConnectionAge"`
+	MaxConnectionAgeGrace time.Duration `yaml:"maxConnectionAgeGrace"`
+	// MinTime is the shortest interval between client pings the server
+	// tolerates, and PermitWithoutStream whether clients may ping without
+	// active calls. Clients breaking this enforcement policy are
+	// disconnected with a too_many_pings GOAWAY, which the server logs.
+	MinTime             time.Duration `yaml:"minTime"`
+	PermitWithoutStream bool          `yaml:"permitWithoutStream"`
+}
+
+// Messages caps the size in bytes of a single message the server
+// receives or sends. Larger messages fail with RESOURCE_EXHAUSTED; the
+// limits apply after decompression.
+type Messages struct {
+	MaxRecvSize int `yaml:"maxRecvSize"`
+	MaxSendSize int `yaml:"maxSendSize"`
+}
+
+// Interceptors switches the optional parts of the interceptor chain.
+// Auth, authz, quotas and auditing are also inactive while unconfigured.
+type Interceptors struct {
+	RequestLog bool `yaml:"requestLog"`
+	Metrics    bool `yaml:"metrics"`
+	Recovery   bool `yaml:"recovery"`
+	Auth       bool `yaml:"auth"`
+	Authz      bool `yaml:"authz"`
+	Quota      bool `yaml:"quota"`
+	PayloadLog bool `yaml:"payloadLog"`
+	Audit      bool `yaml:"audit"`
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() Config {
+	return Config{
+		Port:        50051,
+		MetricsAddr: ":9464",
+		LogLevel:    "info",
+		Keepalive: Keepalive{
+			Time:    2 * time.Hour,
+			Timeout: 20 * time.Second,
+			MinTime: 5 * time.Minute,
+		},
+		// gRPC's own receive limit; clients use it too, so sending more
+		// than that would only fail on their side.
+		Messages: Messages{
+			MaxRecvSize: 4 << 20,
+			MaxSendSize: 4 << 20,
+		},
+		Interceptors: Interceptors{
+			RequestLog: true,
+			Metrics:    true,
+			Recovery:   true,
+			Auth:       true,
+			Authz:      true,
+			Quota:      true,
+			PayloadLog: true,
+			Audit:      true,
+		},
+	}
+}
+
+// Load builds the configuration from args, normally os.Args[1:]. The YAML
+// file is named by -config or GRPC_CONFIG. Env vars override the file:
+//
+//	GRPC_PORT, GRPC_METRICS_ADDR, GRPC_LOG_LEVEL
+//	GRPC_TLS_CERT, GRPC_TLS_KEY, GRPC_TLS_CLIENT_CA, GRPC_INSECURE
+//	GRPC_KEEPALIVE_TIME, GRPC_KEEPALIVE_TIMEOUT, GRPC_KEEPALIVE_MAX_IDLE,
+//	GRPC_KEEPALIVE_MAX_AGE, GRPC_KEEPALIVE_MAX_AGE_GRACE, GRPC_KEEPALIVE_MIN_TIME,
+//	GRPC_KEEPALIVE_PERMIT_WITHOUT_STREAM
+//	GRPC_MAX_RECV_MSG_SIZE, GRPC_MAX_SEND_MSG_SIZE
+//	GRPC_INTERCEPTOR_REQUEST_LOG, _METRICS, _RECOVERY, _AUTH, _AUTHZ, _QUOTA,
+//	_PAYLOAD_LOG, _AUDIT
+//
+// and flags override both; only flags given on the command line count.
+func Load(args []string) (Config, error) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("GRPC_CONFIG"), "YAML config file")
+	var f Config
+	fs.IntVar(&f.Port, "port", 0, "listen port (default 50051)")
+	fs.StringVar(&f.MetricsAddr, "metrics-addr", "", "address serving Prometheus /metrics; empty disables it (default :9464)")
+	fs.StringVar(&f.LogLevel, "log-level", "", "debug, info, warn or error (default info)")
+	fs.StringVar(&f.TLS.CertFile, "tls-cert", "", "server certificate (PEM)")
+	fs.StringVar(&f.TLS.KeyFile, "tls-key", "", "server private key (PEM)")
+	fs.StringVar(&f.TLS.ClientCAFile, "client-ca", "", "CA for client certificates; enables mutual TLS")
+	fs.BoolVar(&f.TLS.Insecure, "insecure", false, "serve plaintext (local development only)")
+	fs.DurationVar(&f.Keepalive.MinTime, "keepalive-min-time", 0, "shortest interval between client pings tolerated (default 5m)")
+	fs.BoolVar(&f.Keepalive.PermitWithoutStream, "keepalive-permit-without-stream", false, "let clients ping without active calls")
+	fs.IntVar(&f.Messages.MaxRecvSize, "max-recv-msg-size", 0, "largest message received, in bytes (default 4MiB)")
+	fs.IntVar(&f.Messages.MaxSendSize, "max-send-msg-size", 0, "largest message sent, in bytes (default 4MiB)")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return Config{}, err
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "port":
+			cfg.Port = f.Port
+		case "metrics-addr":
+			cfg.MetricsAddr = f.MetricsAddr
+		case "log-level":
+			cfg.LogLevel = f.LogLevel
+		case "tls-cert":
+			cfg.TLS.CertFile = f.TLS.CertFile
+		case "tls-key":
+			cfg.TLS.KeyFile = f.TLS.KeyFile
+		case "client-ca":
+			cfg.TLS.ClientCAFile = f.TLS.ClientCAFile
+		case "insecure":
+			cfg.TLS.Insecure = f.TLS.Insecure
+		case "keepalive-min-time":
+			cfg.Keepalive.MinTime = f.Keepalive.MinTime
+		case "keepalive-permit-without-stream":
+			cfg.Keepalive.PermitWithoutStream = f.Keepalive.PermitWithoutStream
+		case "max-recv-msg-size":
+			cfg.Messages.MaxRecvSize = f.Messages.MaxRecvSize
+		case "max-send-msg-size":
+			cfg.Messages.MaxSendSize = f.Messages.MaxSendSize
+		}
+	})
+	return cfg, cfg.Validate()
+}
+
+// loadFile overrides the settings present in the YAML file at path.
+// Unknown keys are errors, so typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	parse := func(name string, parse func(string) error) {
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			if err := parse(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is invalid", name, v))
+			}
+		}
+	}
+	integer := func(name string, dst *int) {
+		parse(name, func(v string) (err error) { *dst, err = strconv.Atoi(v); return err })
+	}
+	boolean := func(name string, dst *bool) {
+		parse(name, func(v string) (err error) { *dst, err = strconv.ParseBool(v); return err })
+	}
+	duration := func(name string, dst *time.Duration) {
+		parse(name, func(v string) (err error) { *dst, err = time.ParseDuration(v); return err })
+	}
+
+	integer("GRPC_PORT", &c.Port)
+	str("GRPC_METRICS_ADDR", &c.MetricsAddr)
+	str("GRPC_LOG_LEVEL", &c.LogLevel)
+	str("GRPC_TLS_CERT", &c.TLS.CertFile)
+	str("GRPC_TLS_KEY", &c.TLS.KeyFile)
+	str("GRPC_TLS_CLIENT_CA", &c.TLS.ClientCAFile)
+	boolean("GRPC_INSECURE", &c.TLS.Insecure)
+	duration("GRPC_KEEPALIVE_TIME", &c.Keepalive.Time)
+	duration("GRPC_KEEPALIVE_TIMEOUT", &c.Keepalive.Timeout)
+	duration("GRPC_KEEPALIVE_MAX_IDLE", &c.Keepalive.MaxConnectionIdle)
+	duration("GRPC_KEEPALIVE_MAX_AGE", &c.Keepalive.MaxConnectionAge)
+	duration("GRPC_KEEPALIVE_MAX_AGE_GRACE", &c.Keepalive.MaxConnectionAgeGrace)
+	duration("GRPC_KEEPALIVE_MIN_TIME", &c.Keepalive.MinTime)
+	boolean("GRPC_KEEPALIVE_PERMIT_WITHOUT_STREAM", &c.Keepalive.PermitWithoutStream)
+	integer("GRPC_MAX_RECV_MSG_SIZE", &c.Messages.MaxRecvSize)
+	integer("GRPC_MAX_SEND_MSG_SIZE", &c.Messages.MaxSendSize)
+	boolean("GRPC_INTERCEPTOR_REQUEST_LOG", &c.Interceptors.RequestLog)
+	boolean("GRPC_INTERCEPTOR_METRICS", &c.Interceptors.Metrics)
+	boolean("GRPC_INTERCEPTOR_RECOVERY", &c.Interceptors.Recovery)
+	boolean("GRPC_INTERCEPTOR_AUTH", &c.Interceptors.Auth)
+	boolean("GRPC_INTERCEPTOR_AUTHZ", &c.Interceptors.Authz)
+	boolean("GRPC_INTERCEPTOR_QUOTA", &c.Interceptors.Quota)
+	boolean("GRPC_INTERCEPTOR_PAYLOAD_LOG", &c.Interceptors.PayloadLog)
+	boolean("GRPC_INTERCEPTOR_AUDIT", &c.Interceptors.Audit)
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting together.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is not between 1 and 65535", c.Port))
+	}
+	if _, err := c.SlogLevel(); err != nil {
+		errs = append(errs, err)
+	}
+	k := c.Keepalive
+	if k.Time < 0 || k.Timeout < 0 || k.MaxConnectionIdle < 0 || k.MaxConnectionAge < 0 || k.MaxConnectionAgeGrace < 0 || k.MinTime < 0 {
+		errs = append(errs, errors.New("keepalive durations must not be negative"))
+	}
+	if c.Messages.MaxRecvSize <= 0 || c.Messages.MaxSendSize <= 0 {
+		errs = append(errs, errors.New("max message sizes must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// ListenAddr is the address the server listens on, on all interfaces.
+func (c Config) ListenAddr() string { return ":" + strconv.Itoa(c.Port) }
+
+// SlogLevel parses LogLevel.
+func (c Config) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(c.LogLevel))); err != nil {
+		return 0, fmt.Errorf("log level %q is not debug, info, warn or error", c.LogLevel)
+	}
+	return level, nil
+}
+
+// ServerTLS returns the TLS settings for tlsconfig.
+func (c Config) ServerTLS() tlsconfig.ServerConfig {
+	return tlsconfig.ServerConfig{
+		CertFile:     c.TLS.CertFile,
+		KeyFile:      c.TLS.KeyFile,
+		ClientCAFile: c.TLS.ClientCAFile,
+		Insecure:     c.TLS.Insecure,
+	}
+}
+
+// KeepaliveOptions returns the server options applying Keepalive.
+func (c Config) KeepaliveOptions() []grpc.ServerOption {
+	k := c.Keepalive
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     k.MaxConnectionIdle,
+			MaxConnectionAge:      k.MaxConnectionAge,
+			MaxConnectionAgeGrace: k.MaxConnectionAgeGrace,
+			Time:                  k.Time,
+			Timeout:               k.Timeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             k.MinTime,
+			PermitWithoutStream: k.PermitWithoutStream,
+		}),
+	}
+}
+
+// ServerOptions returns the server options applying the size limits.
+func (m Messages) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(m.MaxRecvSize),
+		grpc.MaxSendMsgSize(m.MaxSendSize),
+	}
+}
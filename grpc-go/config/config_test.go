@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+port: 6000
+logLevel: debug
+tls:
+  insecure: true
+keepalive:
+  maxConnectionAge: 30m
+messages:
+  maxRecvSize: 1048576
+  maxSendSize: 1048576
+interceptors:
+  payloadLog: false
+`)
+	t.Setenv("GRPC_PORT", "7000")
+	t.Setenv("GRPC_KEEPALIVE_TIME", "1m")
+	t.Setenv("GRPC_KEEPALIVE_MAX_AGE_GRACE", "10s")
+	t.Setenv("GRPC_KEEPALIVE_MIN_TIME", "1m")
+	t.Setenv("GRPC_MAX_RECV_MSG_SIZE", "2097152")
+
+	cfg, err := Load([]string{"-config", path, "-port", "8000", "-max-send-msg-size", "8388608", "-keepalive-min-time", "30s"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := Default()
+	want.Port = 8000                                        // flag over env over file
+	want.LogLevel = "debug"                                 // file over default
+	want.TLS.Insecure = true                                // file
+	want.Keepalive.MaxConnectionAge = 30 * time.Minute      // file
+	want.Keepalive.Time = time.Minute                       // env
+	want.Keepalive.MaxConnectionAgeGrace = 10 * time.Second // env
+	want.Keepalive.MinTime = 30 * time.Second               // flag over env
+	want.Messages.MaxRecvSize = 2 << 20                     // env over file
+	want.Messages.MaxSendSize = 8 << 20                     // flag over file
+	want.Interceptors.PayloadLog = false                    // file
+	if cfg != want {
+		t.Errorf("Load = %+v\nwant %+v", cfg, want)
+	}
+	if got := cfg.ListenAddr(); got != ":8000" {
+		t.Errorf("ListenAddr = %q, want :8000", got)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("GRPC_CONFIG", "")
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg != Default() {
+		t.Errorf("Load = %+v, want defaults", cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{name: "unknown key", file: "prot: 1\n", want: []string{"field prot not found"}},
+		{name: "bad env", env: map[string]string{"GRPC_INTERCEPTOR_AUTH": "maybe", "GRPC_KEEPALIVE_TIME": "soon"},
+			want: []string{"GRPC_INTERCEPTOR_AUTH", "GRPC_KEEPALIVE_TIME"}},
+		{name: "invalid values", args: []string{"-port", "70000", "-log-level", "loud"}, want: []string{"port 70000", `log level "loud"`}},
+		{name: "zero message size", args: []string{"-max-recv-msg-size", "0"}, want: []string{"max message sizes"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GRPC_CONFIG", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeFile(t, tt.file))
+			}
+			_, err := Load(args)
+			if err == nil {
+				t.Fatal("Load succeeded, want an error")
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not mention %q", err, w)
+				}
+			}
+		})
+	}
+}
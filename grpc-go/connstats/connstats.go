@@ -0,0 +1,288 @@
+// Package connstats tracks the server's connections per peer. Handler is a
+// gRPC stats handler exporting active connections, active streams and
+// message bytes per peer as Prometheus metrics, and, through Credentials,
+// logs and counts connections the server closes for violating its policy,
+// such as clients pinging more often than the keepalive enforcement
+// policy allows.
+package connstats
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/stats"
+)
+
+// peerStats counts one peer. Peers are identified by IP address, without
+// the port, so that a client's connections add up.
+type peerStats struct {
+	conns, streams int
+	recvBytes      uint64
+	sentBytes      uint64
+}
+
+// PeerStats is a copy of the counts of one peer.
+type PeerStats struct {
+	Connections int
+	Streams     int
+	RecvBytes   uint64
+	SentBytes   uint64
+}
+
+// Handler counts connections, streams and bytes per peer. Register it with
+// grpc.StatsHandler and in a Prometheus registry. Peers are forgotten once
+// their last connection closes, so the metrics only hold connected peers.
+type Handler struct {
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	peers map[string]*peerStats
+
+	closed      *prometheus.CounterVec
+	connsDesc   *prometheus.Desc
+	streamsDesc *prometheus.Desc
+	recvDesc    *prometheus.Desc
+	sentDesc    *prometheus.Desc
+}
+
+// New returns a Handler logging policy violations to logger.
+func New(logger *slog.Logger) *Handler {
+	return &Handler{
+		logger: logger,
+		peers:  make(map[string]*peerStats),
+		closed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_connections_closed_total",
+			Help: "Connections closed by the server for violating its policy, by reason, e.g. too_many_pings.",
+		}, []string{"reason"}),
+		connsDesc: prometheus.NewDesc("grpc_server_peer_connections",
+			"Open connections per peer.", []string{"peer"}, nil),
+		streamsDesc: prometheus.NewDesc("grpc_server_peer_streams",
+			"Active streams per peer.", []string{"peer"}, nil),
+		recvDesc: prometheus.NewDesc("grpc_server_peer_received_bytes_total",
+			"Message bytes received from each connected peer, as sent on the wire.", []string{"peer"}, nil),
+		sentDesc: prometheus.NewDesc("grpc_server_peer_sent_bytes_total",
+			"Message bytes sent to each connected peer, as sent on the wire.", []string{"peer"}, nil),
+	}
+}
+
+type peerKey struct{}
+
+// peerOf returns the peer key of addr.
+func peerOf(addr net.Addr) string {
+	if addr == nil {
+		return "unknown"
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// update applies f to the counts of peer, forgetting the peer once it has
+// neither connections nor streams left.
+func (h *Handler) update(peer string, f func(*peerStats)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := h.peers[peer]
+	if p == nil {
+		p = new(peerStats)
+		h.peers[peer] = p
+	}
+	f(p)
+	if p.conns <= 0 && p.streams <= 0 {
+		delete(h.peers, peer)
+	}
+}
+
+// TagConn implements stats.Handler.
+func (h *Handler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, peerKey{}, peerOf(info.RemoteAddr))
+}
+
+// HandleConn implements stats.Handler.
+func (h *Handler) HandleConn(ctx context.Context, s stats.ConnStats) {
+	peer, _ := ctx.Value(peerKey{}).(string)
+	switch s.(type) {
+	case *stats.ConnBegin:
+		h.update(peer, func(p *peerStats) { p.conns++ })
+	case *stats.ConnEnd:
+		h.update(peer, func(p *peerStats) { p.conns-- })
+	}
+}
+
+// TagRPC implements stats.Handler. RPC contexts derive from their
+// connection's, so they already carry the peer.
+func (h *Handler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC implements stats.Handler.
+func (h *Handler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	peer, ok := ctx.Value(peerKey{}).(string)
+	if !ok {
+		return
+	}
+	switch s := s.(type) {
+	case *stats.Begin:
+		h.update(peer, func(p *peerStats) { p.streams++ })
+	case *stats.End:
+		h.update(peer, func(p *peerStats) { p.streams-- })
+	case *stats.InPayload:
+		h.update(peer, func(p *peerStats) { p.recvBytes += uint64(s.WireLength) })
+	case *stats.OutPayload:
+		h.update(peer, func(p *peerStats) { p.sentBytes += uint64(s.WireLength) })
+	}
+}
+
+// Peers returns the counts of every connected peer.
+func (h *Handler) Peers() map[string]PeerStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[string]PeerStats, len(h.peers))
+	for peer, p := range h.peers {
+		out[peer] = PeerStats{Connections: p.conns, Streams: p.streams, RecvBytes: p.recvBytes, SentBytes: p.sentBytes}
+	}
+	return out
+}
+
+// Describe implements prometheus.Collector.
+func (h *Handler) Describe(ch chan<- *prometheus.Desc) {
+	h.closed.Describe(ch)
+	ch <- h.connsDesc
+	ch <- h.streamsDesc
+	ch <- h.recvDesc
+	ch <- h.sentDesc
+}
+
+// Collect implements prometheus.Collector.
+func (h *Handler) Collect(ch chan<- prometheus.Metric) {
+	h.closed.Collect(ch)
+	for peer, p := range h.Peers() {
+		ch <- prometheus.MustNewConstMetric(h.connsDesc, prometheus.GaugeValue, float64(p.Connections), peer)
+		ch <- prometheus.MustNewConstMetric(h.streamsDesc, prometheus.GaugeValue, float64(p.Streams), peer)
+		ch <- prometheus.MustNewConstMetric(h.recvDesc, prometheus.CounterValue, float64(p.RecvBytes), peer)
+		ch <- prometheus.MustNewConstMetric(h.sentDesc, prometheus.CounterValue, float64(p.SentBytes), peer)
+	}
+}
+
+// HTTP/2 framing; see RFC 9113, sections 4.1, 6.8 and 7.
+const (
+	codeNoError          = 0x0
+	codeEnhanceYourCalm  = 0xb
+	frameTypeGoAway      = 0x7
+	frameHeaderLen       = 9
+	maxGoAwayPayloadRead = 8 + 128
+)
+
+// goAway records a GOAWAY the server sent to remote. Graceful ones, sent
+// when connections reach their maximum age or idle time or the server
+// stops, are not violations and are ignored.
+func (h *Handler) goAway(remote net.Addr, code uint32, debug string) {
+	if code == codeNoError {
+		return
+	}
+	reason := debug
+	if reason == "" {
+		reason = fmt.Sprintf("http2_error_%#x", code)
+	}
+	h.closed.WithLabelValues(reason).Inc()
+	msg := "connection closed for protocol violation"
+	if code == codeEnhanceYourCalm {
+		msg = "connection closed for keepalive policy violation"
+	}
+	h.logger.Warn(msg, "peer", remote.String(), "reason", reason, "http2_code", code)
+}
+
+// Credentials wraps creds so that h sees the GOAWAY frames the server sends
+// on each connection: gRPC only tells clients why it closed a connection.
+func (h *Handler) Credentials(creds credentials.TransportCredentials) credentials.TransportCredentials {
+	return &watchedCredentials{TransportCredentials: creds, h: h}
+}
+
+type watchedCredentials struct {
+	credentials.TransportCredentials
+	h *Handler
+}
+
+func (c *watchedCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.TransportCredentials.ServerHandshake(rawConn)
+	if err != nil {
+		return conn, info, err
+	}
+	remote := conn.RemoteAddr()
+	return &goAwayConn{Conn: conn, onGoAway: func(code uint32, debug string) {
+		c.h.goAway(remote, code, debug)
+	}}, info, nil
+}
+
+func (c *watchedCredentials) Clone() credentials.TransportCredentials {
+	return &watchedCredentials{TransportCredentials: c.TransportCredentials.Clone(), h: c.h}
+}
+
+// goAwayConn scans the HTTP/2 frames written to a connection, after any
+// TLS, for GOAWAY frames. It only keeps frame headers and the start of
+// GOAWAY payloads, so the scan costs little.
+type goAwayConn struct {
+	net.Conn
+	onGoAway func(code uint32, debug string)
+
+	mu        sync.Mutex
+	header    [frameHeaderLen]byte
+	headerN   int
+	remaining int
+	goAway    bool
+	payload   []byte
+}
+
+func (c *goAwayConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.mu.Lock()
+	c.scan(p[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *goAwayConn) scan(p []byte) {
+	for len(p) > 0 {
+		if c.headerN < frameHeaderLen {
+			k := copy(c.header[c.headerN:], p)
+			c.headerN += k
+			p = p[k:]
+			if c.headerN < frameHeaderLen {
+				return
+			}
+			c.remaining = int(c.header[0])<<16 | int(c.header[1])<<8 | int(c.header[2])
+			c.goAway = c.header[3] == frameTypeGoAway
+			c.payload = c.payload[:0]
+			if c.remaining == 0 {
+				c.endFrame()
+			}
+			continue
+		}
+		k := min(len(p), c.remaining)
+		if c.goAway && len(c.payload) < maxGoAwayPayloadRead {
+			c.payload = append(c.payload, p[:min(k, maxGoAwayPayloadRead-len(c.payload))]...)
+		}
+		c.remaining -= k
+		p = p[k:]
+		if c.remaining == 0 {
+			c.endFrame()
+		}
+	}
+}
+
+func (c *goAwayConn) endFrame() {
+	// The payload starts with the last stream ID and the error code.
+	if c.goAway && len(c.payload) >= 8 {
+		c.onGoAway(binary.BigEndian.Uint32(c.payload[4:8]), string(c.payload[8:]))
+	}
+	c.headerN = 0
+	c.goAway = false
+}
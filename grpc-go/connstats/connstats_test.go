@@ -0,0 +1,164 @@
+package connstats
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// syncBuffer is a bytes.Buffer safe for the server's goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// startServer serves health checks through h over an in-memory listener,
+// only tolerating client pings an hour apart.
+func startServer(t *testing.T, h *Handler) *bufconn.Listener {
+	t.Helper()
+	s := grpc.NewServer(
+		grpc.Creds(h.Credentials(insecure.NewCredentials())),
+		grpc.StatsHandler(h),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: time.Hour}),
+	)
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPeerStats(t *testing.T) {
+	h := New(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	lis := startServer(t, h)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	// bufconn addresses have no port, so the peer is the whole address.
+	var got PeerStats
+	waitFor(t, "the call to end", func() bool {
+		got = h.Peers()["bufconn"]
+		return got.Streams == 0
+	})
+	if got.Connections != 1 || got.RecvBytes == 0 || got.SentBytes == 0 {
+		t.Errorf("peer stats = %+v, want 1 connection and bytes both ways", got)
+	}
+	ch := make(chan prometheus.Metric, 16)
+	h.Collect(ch)
+	close(ch)
+	// One series of each per-peer metric; no connection was closed for a
+	// violation.
+	if n := len(ch); n != 4 {
+		t.Errorf("collected %d series, want 4", n)
+	}
+
+	conn.Close()
+	waitFor(t, "the peer to be forgotten", func() bool { return len(h.Peers()) == 0 })
+}
+
+// http2Frame encodes a frame with an empty stream ID.
+func http2Frame(typ byte, payload []byte) []byte {
+	n := len(payload)
+	return append([]byte{byte(n >> 16), byte(n >> 8), byte(n), typ, 0, 0, 0, 0, 0}, payload...)
+}
+
+func TestTooManyPings(t *testing.T) {
+	var logs syncBuffer
+	h := New(slog.New(slog.NewTextHandler(&logs, nil)))
+	lis := startServer(t, h)
+
+	// grpc-go clients never ping this often, so speak HTTP/2 directly.
+	conn, err := lis.Dial()
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	out := []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+	out = append(out, http2Frame(0x4, nil)...) // SETTINGS
+	for i := 0; i < 5; i++ {
+		out = append(out, http2Frame(0x6, make([]byte, 8))...) // PING
+	}
+	if _, err := conn.Write(out); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	// The server closes the connection after its GOAWAY.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(io.Discard, conn); err != nil {
+		t.Fatalf("reading until the server closes: %v", err)
+	}
+
+	var m dto.Metric
+	if err := h.closed.WithLabelValues("too_many_pings").Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("too_many_pings closes = %v, want 1", got)
+	}
+	if !strings.Contains(logs.String(), "keepalive policy violation") {
+		t.Errorf("logs = %q, want the violation logged", logs.String())
+	}
+}
+
+func TestScanSplitWrites(t *testing.T) {
+	var codes []uint32
+	var debugs []string
+	c := &goAwayConn{onGoAway: func(code uint32, debug string) {
+		codes = append(codes, code)
+		debugs = append(debugs, debug)
+	}}
+	stream := append(http2Frame(0x4, nil), http2Frame(0x0, []byte("data"))...)
+	stream = append(stream, http2Frame(frameTypeGoAway, append([]byte{0, 0, 0, 1, 0, 0, 0, codeEnhanceYourCalm}, "too_many_pings"...))...)
+	// Feed the frames a byte at a time, splitting every header and payload.
+	for i := range stream {
+		c.scan(stream[i : i+1])
+	}
+	if len(codes) != 1 || codes[0] != codeEnhanceYourCalm || debugs[0] != "too_many_pings" {
+		t.Errorf("GOAWAYs = %v %q, want one ENHANCE_YOUR_CALM too_many_pings", codes, debugs)
+	}
+}
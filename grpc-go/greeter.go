@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// hello is a greeting request in the form shared by every Greeter
+// version. The v1 and v2 services only translate their messages to and
+// from it, so validation and greeting logic exist once.
+type hello struct {
+	name     string
+	locale   string
+	metadata map[string]string
+	// localeField names the locale in error details: "language" in v1,
+	// "locale" in v2.
+	localeField string
+}
+
+// greet returns the greeting for in.
+func (s *server) greet(ctx context.Context, in hello) (string, error) {
+	if err := validateHello(in); err != nil {
+		return "", err
+	}
+	word, err := s.greeting(ctx, in)
+	if err != nil {
+		return "", err
+	}
+	return word + " " + in.name, nil
+}
+
+// greetStream sends count greetings for in, pausing streamInterval
+// between them.
+func (s *server) greetStream(ctx context.Context, in hello, count int32, send func(msg string) error) error {
+	if err := validateHelloStream(in, count); err != nil {
+		return err
+	}
+	word, err := s.greeting(ctx, in)
+	if err != nil {
+		return err
+	}
+	for i := int32(1); i <= count; i++ {
+		if err := send(fmt.Sprintf("%s %s (%d/%d)", word, in.name, i, count)); err != nil {
+			return err
+		}
+		if i == count {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-time.After(s.streamInterval):
+		}
+	}
+	return nil
+}
+
+// greetAll reads requests with recv until io.EOF and greets all of them in
+// one message, in the locale of the first request, which it also returns.
+func (s *server) greetAll(ctx context.Context, recv func() (hello, error)) (string, hello, error) {
+	var first hello
+	var names []string
+	for {
+		in, err := recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", first, err
+		}
+		if err := validateHello(in); err != nil {
+			return "", first, err
+		}
+		if len(names) == 0 {
+			first = in
+		}
+		names = append(names, in.name)
+	}
+	if len(names) == 0 {
+		return "", first, status.Error(codes.InvalidArgument, "no names received")
+	}
+	word, err := s.greeting(ctx, first)
+	if err != nil {
+		return "", first, err
+	}
+	return word + " " + strings.Join(names, ", "), first, nil
+}
+
+// batchDeadlineMargin is the time greetBatch keeps in hand before the
+// deadline to send its partial response back.
+const batchDeadlineMargin = 20 * time.Millisecond
+
+// batchPage is one response of a batch greeting.
+type batchPage struct {
+	messages  []string
+	nextToken string
+	remaining int
+}
+
+// greetBatch greets names from where pageToken left off, taking
+// batchInterval per name. It stops early when another name would not be
+// done by the deadline of ctx, less batchDeadlineMargin, and returns a
+// token for the rest.
+func (s *server) greetBatch(ctx context.Context, in hello, names []string, pageToken string) (batchPage, error) {
+	digest := batchDigest(in, names)
+	offset, err := validateBatch(in, names, pageToken, digest)
+	if err != nil {
+		return batchPage{}, err
+	}
+	word, err := s.greeting(ctx, in)
+	if err != nil {
+		return batchPage{}, err
+	}
+
+	var page batchPage
+	deadline, hasDeadline := ctx.Deadline()
+	for _, name := range names[offset:] {
+		if hasDeadline && time.Until(deadline) < s.batchInterval+batchDeadlineMargin {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return batchPage{}, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(s.batchInterval):
+		}
+		page.messages = append(page.messages, word+" "+name)
+	}
+	done := offset + len(page.messages)
+	page.remaining = len(names) - done
+	if page.remaining == 0 {
+		return page, nil
+	}
+	if len(page.messages) == 0 {
+		return batchPage{}, status.Error(codes.DeadlineExceeded, "deadline leaves no time to greet a name")
+	}
+	page.nextToken = encodePageToken(done, digest)
+	return page, nil
+}
+
+// batchDigest identifies a batch request, so a page token is only
+// accepted for the request that produced it.
+func batchDigest(in hello, names []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n", in.locale)
+	keys := make([]string, 0, len(in.metadata))
+	for k := range in.metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%q=%q\n", k, in.metadata[k])
+	}
+	for _, name := range names {
+		fmt.Fprintf(h, "%q\n", name)
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:12])
+}
+
+// encodePageToken returns an opaque token resuming the batch with digest
+// at offset. Tokens carry their state, so any server can resume a batch.
+func encodePageToken(offset int, digest string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset) + "." + digest))
+}
+
+// decodePageToken returns the offset in token, which must belong to the
+// batch with digest.
+func decodePageToken(token, digest string) (int, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, false
+	}
+	offset, d, ok := strings.Cut(string(raw), ".")
+	if !ok || d != digest {
+		return 0, false
+	}
+	n, err := strconv.Atoi(offset)
+	return n, err == nil
+}
+
+// chatReply is the server's answer to a chat message.
+func chatReply(name, text string) string {
+	return fmt.Sprintf("Hello %s, you said %q", name, text)
+}
@@ -0,0 +1,69 @@
+// Package greeting supplies the localized greeting words used by the
+// Greeter server. The server depends only on Provider, so where greetings
+// come from is chosen at startup.
+package greeting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultLanguage is used when a request does not name a language.
+const DefaultLanguage = "en"
+
+// ErrUnsupportedLanguage is returned for languages a provider has no
+// greeting for.
+var ErrUnsupportedLanguage = errors.New("unsupported language")
+
+// Provider returns the greeting word for a language, such as "Hola" for
+// "es". Languages are BCP 47 tags; see Lookup for how they are matched.
+type Provider interface {
+	Greeting(ctx context.Context, language string) (string, error)
+}
+
+// Lookup asks p for language, falling back from a regional tag such as
+// "pt-BR" to its base language "pt". An empty language means
+// DefaultLanguage.
+func Lookup(ctx context.Context, p Provider, language string) (string, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" {
+		language = DefaultLanguage
+	}
+	word, err := p.Greeting(ctx, language)
+	if base, _, regional := strings.Cut(language, "-"); regional && errors.Is(err, ErrUnsupportedLanguage) {
+		return p.Greeting(ctx, base)
+	}
+	return word, err
+}
+
+// Config selects and configures a provider.
+type Config struct {
+	// Kind is "static" (the default), "file" or "http".
+	Kind string
+	// Source is the JSON file for "file" and the base URL for "http".
+	Source string
+	// Timeout bounds each request of the "http" provider. Default 2s.
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads GREETING_PROVIDER and GREETING_SOURCE.
+func ConfigFromEnv() Config {
+	return Config{Kind: os.Getenv("GREETING_PROVIDER"), Source: os.Getenv("GREETING_SOURCE")}
+}
+
+// New builds the provider described by cfg.
+func New(cfg Config) (Provider, error) {
+	switch cfg.Kind {
+	case "", "static":
+		return Static(DefaultGreetings), nil
+	case "file":
+		return NewFileProvider(cfg.Source)
+	case "http":
+		return NewHTTPProvider(cfg.Source, cfg.Timeout)
+	}
+	return nil, fmt.Errorf("unknown greeting provider %q; want static, file or http", cfg.Kind)
+}
@@ -0,0 +1,55 @@
+package greeting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPProvider fetches greetings from a remote service with
+// GET {BaseURL}/greetings/{language}, which answers
+// {"greeting": "Hola"} or 404 for unknown languages.
+type HTTPProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewHTTPProvider returns a provider for baseURL whose requests time out
+// after timeout, or 2s if timeout is zero.
+func NewHTTPProvider(baseURL string, timeout time.Duration) (*HTTPProvider, error) {
+	if _, err := url.ParseRequestURI(baseURL); err != nil {
+		return nil, fmt.Errorf("http greeting provider needs a base URL: %w", err)
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &HTTPProvider{BaseURL: baseURL, Client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (p *HTTPProvider) Greeting(ctx context.Context, language string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.BaseURL+"/greetings/"+url.PathEscape(language), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedLanguage, language)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("greeting service returned %s", resp.Status)
+	}
+	var body struct {
+		Greeting string `json:"greeting"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode greeting: %w", err)
+	}
+	return body.Greeting, nil
+}
@@ -0,0 +1,52 @@
+package greeting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultGreetings are the greetings built into the server.
+var DefaultGreetings = map[string]string{
+	"de": "Hallo",
+	"en": "Hello",
+	"es": "Hola",
+	"fr": "Bonjour",
+	"hi": "Namaste",
+	"it": "Ciao",
+	"ja": "こんにちは",
+	"pt": "Olá",
+}
+
+// Static serves greetings from a map keyed by lower-case language tag.
+type Static map[string]string
+
+func (s Static) Greeting(_ context.Context, language string) (string, error) {
+	if word, ok := s[language]; ok {
+		return word, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedLanguage, language)
+}
+
+// NewFileProvider loads greetings once from a JSON object mapping language
+// tags to greetings, e.g. {"en": "Hello", "nl": "Hallo"}.
+func NewFileProvider(path string) (Static, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file greeting provider needs a path")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	greetings := make(Static, len(raw))
+	for lang, word := range raw {
+		greetings[strings.ToLower(lang)] = word
+	}
+	return greetings, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// unauthenticatedMethods stay reachable without a token so Kubernetes
+// probes and grpcurl work against a server with auth enabled.
+var unauthenticatedMethods = []string{
+	healthpb.Health_Check_FullMethodName,
+	healthpb.Health_Watch_FullMethodName,
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// dependency is something a service needs to answer requests.
+type dependency struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// dependenciesFromEnv reads GRPC_DEPENDENCIES, a comma-separated list of
+// name=host:port entries that are checked by opening a TCP connection.
+func dependenciesFromEnv() ([]dependency, error) {
+	var deps []dependency
+	for _, entry := range strings.Split(os.Getenv("GRPC_DEPENDENCIES"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, addr, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || addr == "" {
+			return nil, fmt.Errorf("GRPC_DEPENDENCIES: %q is not name=host:port", entry)
+		}
+		deps = append(deps, dependency{name: name, check: dialCheck(addr)})
+	}
+	return deps, nil
+}
+
+func dialCheck(addr string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// watchHealth checks deps every interval and marks services, and the
+// server as a whole (""), NOT_SERVING while any dependency fails. It only
+// logs status changes.
+func watchHealth(ctx context.Context, hs *health.Server, services []string, deps []dependency, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last healthpb.HealthCheckResponse_ServingStatus
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		for _, dep := range deps {
+			checkCtx, cancel := context.WithTimeout(ctx, interval/2)
+			err := dep.check(checkCtx)
+			cancel()
+			if err != nil {
+				status = healthpb.HealthCheckResponse_NOT_SERVING
+				if last != status {
+					log.Printf("dependency %s is unhealthy: %v", dep.name, err)
+				}
+			}
+		}
+		if status != last {
+			log.Printf("health status %s", status)
+			for _, service := range append([]string{""}, services...) {
+				hs.SetServingStatus(service, status)
+			}
+			last = status
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AuditRecord describes one RPC in the audit trail. Payloads are
+// rendered like payload logs: JSON, redacted and truncated.
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	Kind     string    `json:"kind"`
+	Peer     string    `json:"peer,omitempty"`
+	Duration float64   `json:"duration_ms"`
+	Code     string    `json:"code"`
+	Error    string    `json:"error,omitempty"`
+	// Request is the unary request, or the first message a client sent
+	// on a stream.
+	Request string `json:"request,omitempty"`
+	// Response is the unary response; streams leave it out.
+	Response string `json:"response,omitempty"`
+}
+
+// AuditSink stores audit records. Write is called concurrently.
+type AuditSink interface {
+	Write(AuditRecord) error
+	Close() error
+}
+
+// JSONAuditSink writes each record as one line of JSON.
+type JSONAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+// NewJSONAuditSink writes records to w, e.g. os.Stdout. Closing the sink
+// leaves w open.
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	return &JSONAuditSink{w: w}
+}
+
+// NewFileAuditSink appends records to the file at path, creating it if
+// needed. Closing the sink closes the file.
+func NewFileAuditSink(path string) (*JSONAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("audit file: %w", err)
+	}
+	return &JSONAuditSink{w: f, c: f}, nil
+}
+
+func (s *JSONAuditSink) Write(r AuditRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+func (s *JSONAuditSink) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
+
+// AuditConfig controls which RPCs are written to Sink.
+type AuditConfig struct {
+	// Sink receives the records; nil disables auditing.
+	Sink AuditSink
+	// SampleRate is the fraction of successful RPCs (0..1) recorded.
+	// Failed RPCs are always recorded.
+	SampleRate float64
+	// MaxBytes truncates each payload; 0 means no limit.
+	MaxBytes int
+	// RedactFields lists proto field names whose values are masked.
+	RedactFields []string
+	// Logger reports records the sink failed to write; it defaults to the
+	// standard logger.
+	Logger *log.Logger
+}
+
+// AuditConfigFromEnv reads GRPC_AUDIT_SINK ("stdout", or "file" to append
+// to GRPC_AUDIT_FILE; unset disables auditing), GRPC_AUDIT_SAMPLE_RATE
+// (default 1) and GRPC_AUDIT_MAX_BYTES (default 1024). Fields named in
+// GRPC_LOG_REDACT are masked here too. The caller closes the sink.
+func AuditConfigFromEnv() (AuditConfig, error) {
+	cfg := AuditConfig{SampleRate: 1, MaxBytes: 1024, RedactFields: LoggingConfigFromEnv().RedactFields}
+	if v := os.Getenv("GRPC_AUDIT_SAMPLE_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return AuditConfig{}, fmt.Errorf("GRPC_AUDIT_SAMPLE_RATE: %q is not between 0 and 1", v)
+		}
+		cfg.SampleRate = rate
+	}
+	if v := os.Getenv("GRPC_AUDIT_MAX_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return AuditConfig{}, fmt.Errorf("GRPC_AUDIT_MAX_BYTES: %q is invalid", v)
+		}
+		cfg.MaxBytes = n
+	}
+	switch sink := os.Getenv("GRPC_AUDIT_SINK"); sink {
+	case "":
+	case "stdout":
+		cfg.Sink = NewJSONAuditSink(os.Stdout)
+	case "file":
+		path := os.Getenv("GRPC_AUDIT_FILE")
+		if path == "" {
+			return AuditConfig{}, fmt.Errorf("GRPC_AUDIT_FILE is required with GRPC_AUDIT_SINK=file")
+		}
+		s, err := NewFileAuditSink(path)
+		if err != nil {
+			return AuditConfig{}, err
+		}
+		cfg.Sink = s
+	default:
+		return AuditConfig{}, fmt.Errorf("GRPC_AUDIT_SINK: %q is not stdout or file", sink)
+	}
+	return cfg, nil
+}
+
+// Enabled reports whether a sink is configured; without one the audit
+// interceptors let every call through unrecorded.
+func (c AuditConfig) Enabled() bool { return c.Sink != nil }
+
+type auditor struct {
+	cfg AuditConfig
+	payloadFormatter
+	*sampler
+}
+
+func newAuditor(cfg AuditConfig) *auditor {
+	if cfg.Logger == nil {
+		cfg.Logger = log.Default()
+	}
+	return &auditor{
+		cfg:              cfg,
+		payloadFormatter: newPayloadFormatter(cfg.MaxBytes, cfg.RedactFields),
+		sampler:          newSampler(cfg.SampleRate),
+	}
+}
+
+// UnaryServerAudit returns an interceptor that writes a record of a
+// sample of unary RPCs, and of every failed one, to cfg.Sink.
+func UnaryServerAudit(cfg AuditConfig) grpc.UnaryServerInterceptor {
+	a := newAuditor(cfg)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !a.cfg.Enabled() {
+			return handler(ctx, req)
+		}
+		sampled := a.sample()
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		if sampled || err != nil {
+			a.record(ctx, info.FullMethod, "unary", start, err, req, resp)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerAudit is UnaryServerAudit for streaming RPCs; the record is
+// written when the stream ends.
+func StreamServerAudit(cfg AuditConfig) grpc.StreamServerInterceptor {
+	a := newAuditor(cfg)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !a.cfg.Enabled() {
+			return handler(srv, ss)
+		}
+		sampled := a.sample()
+		start := time.Now()
+		rs := &recordingStream{ServerStream: ss}
+		err := handler(srv, rs)
+		if sampled || err != nil {
+			a.record(ss.Context(), info.FullMethod, "stream", start, err, rs.first, nil)
+		}
+		return err
+	}
+}
+
+func (a *auditor) record(ctx context.Context, method, kind string, start time.Time, err error, req, resp any) {
+	r := AuditRecord{
+		Time:     start.UTC(),
+		Method:   method,
+		Kind:     kind,
+		Duration: float64(time.Since(start)) / float64(time.Millisecond),
+		Code:     status.Code(err).String(),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.Peer = p.Addr.String()
+	}
+	if err != nil {
+		r.Error = status.Convert(err).Message()
+	}
+	if req != nil {
+		r.Request = a.format(req)
+	}
+	if resp != nil {
+		r.Response = a.format(resp)
+	}
+	if err := a.cfg.Sink.Write(r); err != nil {
+		a.cfg.Logger.Printf("audit: dropped record of %s: %v", method, err)
+	}
+}
+
+// recordingStream keeps the first message the client sends.
+type recordingStream struct {
+	grpc.ServerStream
+	first any
+}
+
+func (s *recordingStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && s.first == nil {
+		s.first = m
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package interceptors
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const redacted = "[REDACTED]"
+
+// LoggingConfig controls which RPCs get their payloads logged.
+type LoggingConfig struct {
+	// SampleRate is the fraction of RPCs (0..1) whose payloads are logged.
+	SampleRate float64
+	// AlwaysLogErrors logs failed RPCs regardless of sampling.
+	AlwaysLogErrors bool
+	// MaxBytes truncates each logged payload; 0 means no limit.
+	MaxBytes int
+	// RedactFields lists proto field names whose values are masked,
+	// at any nesting depth.
+	RedactFields []string
+	// Logger defaults to the standard logger.
+	Logger *log.Logger
+}
+
+// LoggingConfigFromEnv reads GRPC_LOG_SAMPLE_RATE, GRPC_LOG_MAX_BYTES,
+// GRPC_LOG_REDACT (comma-separated field names) and GRPC_LOG_ERRORS.
+func LoggingConfigFromEnv() LoggingConfig {
+	cfg := LoggingConfig{SampleRate: 0, AlwaysLogErrors: true, MaxBytes: 1024}
+	if v, err := strconv.ParseFloat(os.Getenv("GRPC_LOG_SAMPLE_RATE"), 64); err == nil && v >= 0 && v <= 1 {
+		cfg.SampleRate = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("GRPC_LOG_MAX_BYTES")); err == nil && v >= 0 {
+		cfg.MaxBytes = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("GRPC_LOG_ERRORS")); err == nil {
+		cfg.AlwaysLogErrors = v
+	}
+	for _, f := range strings.Split(os.Getenv("GRPC_LOG_REDACT"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			cfg.RedactFields = append(cfg.RedactFields, f)
+		}
+	}
+	return cfg
+}
+
+type payloadLogger struct {
+	cfg LoggingConfig
+	payloadFormatter
+	*sampler
+}
+
+// UnaryServerLogging returns an interceptor that logs request and response
+// payloads for a sample of unary RPCs.
+func UnaryServerLogging(cfg LoggingConfig) grpc.UnaryServerInterceptor {
+	l := &payloadLogger{
+		cfg:              cfg,
+		payloadFormatter: newPayloadFormatter(cfg.MaxBytes, cfg.RedactFields),
+		sampler:          newSampler(cfg.SampleRate),
+	}
+	if l.cfg.Logger == nil {
+		l.cfg.Logger = log.Default()
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		sampled := l.sample()
+		if !sampled && !cfg.AlwaysLogErrors {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		if !sampled && err == nil {
+			return resp, err
+		}
+
+		l.cfg.Logger.Printf("grpc %s code=%s duration=%s request=%s response=%s",
+			info.FullMethod, status.Code(err), time.Since(start), l.format(req), l.format(resp))
+		return resp, err
+	}
+}
+
+// sampler picks a random fraction of calls.
+type sampler struct {
+	rate float64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newSampler(rate float64) *sampler {
+	return &sampler{rate: rate, rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (s *sampler) sample() bool {
+	switch {
+	case s.rate <= 0:
+		return false
+	case s.rate >= 1:
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rnd.Float64() < s.rate
+}
+
+// payloadFormatter renders payloads for logs, masking the fields in redact
+// and truncating them to maxBytes unless it is 0.
+type payloadFormatter struct {
+	maxBytes int
+	redact   map[protoreflect.Name]bool
+}
+
+func newPayloadFormatter(maxBytes int, redactFields []string) payloadFormatter {
+	f := payloadFormatter{maxBytes: maxBytes, redact: make(map[protoreflect.Name]bool)}
+	for _, name := range redactFields {
+		f.redact[protoreflect.Name(name)] = true
+	}
+	return f
+}
+
+// format renders a payload as redacted, truncated JSON.
+func (l payloadFormatter) format(v any) string {
+	msg, ok := v.(proto.Message)
+	if !ok || msg == nil {
+		return "null"
+	}
+	if len(l.redact) > 0 {
+		msg = proto.Clone(msg)
+		l.redactMessage(msg.ProtoReflect())
+	}
+	data, err := protojson.MarshalOptions{}.Marshal(msg)
+	if err != nil {
+		return "<unmarshalable: " + err.Error() + ">"
+	}
+	if l.maxBytes > 0 && len(data) > l.maxBytes {
+		return string(data[:l.maxBytes]) + "...(truncated " + strconv.Itoa(len(data)-l.maxBytes) + " bytes)"
+	}
+	return string(data)
+}
+
+func (l payloadFormatter) redactMessage(m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if l.redact[fd.Name()] {
+			if fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap() {
+				m.Set(fd, protoreflect.ValueOfString(redacted))
+			} else {
+				m.Clear(fd)
+			}
+			return true
+		}
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				l.redactMessage(list.Get(i).Message())
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				l.redactMessage(mv.Message())
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			l.redactMessage(v.Message())
+		}
+		return true
+	})
+}
@@ -0,0 +1,56 @@
+package interceptors
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerRequestLog logs one structured line per unary RPC with its
+// method, status code, duration and peer address. A nil logger uses
+// slog.Default().
+func UnaryServerRequestLog(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logRequest(ctx, logger, info.FullMethod, "unary", start, err)
+		return resp, err
+	}
+}
+
+// StreamServerRequestLog is UnaryServerRequestLog for streaming RPCs; the
+// line is written when the stream ends.
+func StreamServerRequestLog(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logRequest(ss.Context(), logger, info.FullMethod, "stream", start, err)
+		return err
+	}
+}
+
+func logRequest(ctx context.Context, logger *slog.Logger, method, kind string, start time.Time, err error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	code := status.Code(err)
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("kind", kind),
+		slog.String("code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("peer", p.Addr.String()))
+	}
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+	logger.LogAttrs(ctx, level, "grpc request", attrs...)
+}
@@ -0,0 +1,207 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: quota.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	QuotaAdmin_GetQuota_FullMethodName   = "/QuotaAdmin/GetQuota"
+	QuotaAdmin_SetQuota_FullMethodName   = "/QuotaAdmin/SetQuota"
+	QuotaAdmin_ListQuotas_FullMethodName = "/QuotaAdmin/ListQuotas"
+)
+
+// QuotaAdminClient is the client API for QuotaAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// QuotaAdmin inspects and adjusts the daily request quotas of clients at
+// runtime. Callers need one of the GRPC_QUOTA_ADMIN_TOKENS.
+type QuotaAdminClient interface {
+	GetQuota(ctx context.Context, in *GetQuotaRequest, opts ...grpc.CallOption) (*Quota, error)
+	// SetQuota overrides a client's daily limit, or restores the default.
+	SetQuota(ctx context.Context, in *SetQuotaRequest, opts ...grpc.CallOption) (*Quota, error)
+	// ListQuotas returns every client with an override or usage today.
+	ListQuotas(ctx context.Context, in *ListQuotasRequest, opts ...grpc.CallOption) (*ListQuotasResponse, error)
+}
+
+type quotaAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewQuotaAdminClient(cc grpc.ClientConnInterface) QuotaAdminClient {
+	return &quotaAdminClient{cc}
+}
+
+func (c *quotaAdminClient) GetQuota(ctx context.Context, in *GetQuotaRequest, opts ...grpc.CallOption) (*Quota, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Quota)
+	err := c.cc.Invoke(ctx, QuotaAdmin_GetQuota_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quotaAdminClient) SetQuota(ctx context.Context, in *SetQuotaRequest, opts ...grpc.CallOption) (*Quota, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Quota)
+	err := c.cc.Invoke(ctx, QuotaAdmin_SetQuota_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quotaAdminClient) ListQuotas(ctx context.Context, in *ListQuotasRequest, opts ...grpc.CallOption) (*ListQuotasResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListQuotasResponse)
+	err := c.cc.Invoke(ctx, QuotaAdmin_ListQuotas_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// QuotaAdminServer is the server API for QuotaAdmin service.
+// All implementations must embed UnimplementedQuotaAdminServer
+// for forward compatibility.
+//
+// QuotaAdmin inspects and adjusts the daily request quotas of clients at
+// runtime. Callers need one of the GRPC_QUOTA_ADMIN_TOKENS.
+type QuotaAdminServer interface {
+	GetQuota(context.Context, *GetQuotaRequest) (*Quota, error)
+	// SetQuota overrides a client's daily limit, or restores the default.
+	SetQuota(context.Context, *SetQuotaRequest) (*Quota, error)
+	// ListQuotas returns every client with an override or usage today.
+	ListQuotas(context.Context, *ListQuotasRequest) (*ListQuotasResponse, error)
+	mustEmbedUnimplementedQuotaAdminServer()
+}
+
+// UnimplementedQuotaAdminServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedQuotaAdminServer struct{}
+
+func (UnimplementedQuotaAdminServer) GetQuota(context.Context, *GetQuotaRequest) (*Quota, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQuota not implemented")
+}
+func (UnimplementedQuotaAdminServer) SetQuota(context.Context, *SetQuotaRequest) (*Quota, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetQuota not implemented")
+}
+func (UnimplementedQuotaAdminServer) ListQuotas(context.Context, *ListQuotasRequest) (*ListQuotasResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListQuotas not implemented")
+}
+func (UnimplementedQuotaAdminServer) mustEmbedUnimplementedQuotaAdminServer() {}
+func (UnimplementedQuotaAdminServer) testEmbeddedByValue()                    {}
+
+// UnsafeQuotaAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to QuotaAdminServer will
+// result in compilation errors.
+type UnsafeQuotaAdminServer interface {
+	mustEmbedUnimplementedQuotaAdminServer()
+}
+
+func RegisterQuotaAdminServer(s grpc.ServiceRegistrar, srv QuotaAdminServer) {
+	// If the following call pancis, it indicates UnimplementedQuotaAdminServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&QuotaAdmin_ServiceDesc, srv)
+}
+
+func _QuotaAdmin_GetQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetQuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuotaAdminServer).GetQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: QuotaAdmin_GetQuota_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuotaAdminServer).GetQuota(ctx, req.(*GetQuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _QuotaAdmin_SetQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetQuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuotaAdminServer).SetQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: QuotaAdmin_SetQuota_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuotaAdminServer).SetQuota(ctx, req.(*SetQuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _QuotaAdmin_ListQuotas_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQuotasRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuotaAdminServer).ListQuotas(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: QuotaAdmin_ListQuotas_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuotaAdminServer).ListQuotas(ctx, req.(*ListQuotasRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// QuotaAdmin_ServiceDesc is the grpc.ServiceDesc for QuotaAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var QuotaAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "QuotaAdmin",
+	HandlerType: (*QuotaAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetQuota",
+			Handler:    _QuotaAdmin_GetQuota_Handler,
+		},
+		{
+			MethodName: "SetQuota",
+			Handler:    _QuotaAdmin_SetQuota_Handler,
+		},
+		{
+			MethodName: "ListQuotas",
+			Handler:    _QuotaAdmin_ListQuotas_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "quota.proto",
+}
@@ -0,0 +1,245 @@
+// Package pbclient is a reusable client for the Greeter service. It owns a
+// small pool of connections, applies a default deadline to every unary
+// call, retries UNAVAILABLE errors through the gRPC service config and can
+// balance calls across several server instances.
+package pbclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// Config configures a Client. Zero values take the defaults noted on each
+// field.
+type Config struct {
+	// Target is the server address, e.g. "localhost:50051", or any gRPC
+	// name such as "dns:///greeter.internal:50051", whose resolver may
+	// return several addresses to balance across.
+	Target string
+	// Addresses is a static list of server addresses to balance across,
+	// used instead of Target.
+	Addresses []string
+	// LoadBalancing names the gRPC load balancing policy, "pick_first" or
+	// "round_robin". Default round_robin with Addresses, otherwise
+	// pick_first, which sends every call on a connection to one address.
+	LoadBalancing string
+	// Credentials secures the connection; nil means plaintext.
+	Credentials credentials.TransportCredentials
+	// Timeout is the deadline given to unary calls whose context has
+	// none. Default 5s.
+	Timeout time.Duration
+	// MaxAttempts is the total number of tries for a call failing with
+	// UNAVAILABLE, including the first; 1 disables retries. Default 3.
+	MaxAttempts int
+	// InitialBackoff is the base retry delay; gRPC adds jitter and
+	// doubles it per attempt. Default 100ms.
+	InitialBackoff time.Duration
+	// PoolSize is the number of connections calls are spread across.
+	// Default 1.
+	PoolSize int
+	// Compress sends requests gzip-compressed and asks the server to
+	// compress its responses. It pays off for large messages such as long
+	// SayHelloToAll batches; small greetings only get slower.
+	Compress bool
+	// DialOptions are appended to the options built from the fields above.
+	DialOptions []grpc.DialOption
+}
+
+func (c *Config) setDefaults() {
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 100 * time.Millisecond
+	}
+	if c.PoolSize <= 0 {
+		c.PoolSize = 1
+	}
+	if c.Credentials == nil {
+		c.Credentials = insecure.NewCredentials()
+	}
+	if c.LoadBalancing == "" && len(c.Addresses) > 0 {
+		c.LoadBalancing = "round_robin"
+	}
+}
+
+// serviceConfig returns the JSON service config with the load balancing
+// policy and the retry policy for every Greeter method.
+func (c *Config) serviceConfig() (string, error) {
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type name struct {
+		Service string `json:"service"`
+	}
+	type methodConfig struct {
+		Name        []name       `json:"name"`
+		RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+	}
+	mc := methodConfig{Name: []name{{Service: pb.Greeter_ServiceDesc.ServiceName}}}
+	// gRPC rejects retry policies with fewer than two attempts.
+	if c.MaxAttempts > 1 {
+		mc.RetryPolicy = &retryPolicy{
+			MaxAttempts:          c.MaxAttempts,
+			InitialBackoff:       durationString(c.InitialBackoff),
+			MaxBackoff:           durationString(c.InitialBackoff * 10),
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: []string{"UNAVAILABLE"},
+		}
+	}
+	sc := map[string]any{"methodConfig": []methodConfig{mc}}
+	if c.LoadBalancing != "" {
+		sc["loadBalancingConfig"] = []map[string]any{{c.LoadBalancing: struct{}{}}}
+	}
+	data, err := json.Marshal(sc)
+	return string(data), err
+}
+
+// durationString formats d the way service configs expect, e.g. "0.1s".
+func durationString(d time.Duration) string {
+	return fmt.Sprintf("%gs", d.Seconds())
+}
+
+// Client is a Greeter client backed by a pool of connections. It is safe
+// for concurrent use.
+type Client struct {
+	conns   []*grpc.ClientConn
+	clients []pb.GreeterClient
+	next    atomic.Uint32
+}
+
+// New creates the connection pool. Connections are established lazily, so
+// New does not fail when the server is down. With a balancing policy
+// other than pick_first, every pooled connection spreads its calls over
+// all the addresses.
+func New(cfg Config) (*Client, error) {
+	switch {
+	case cfg.Target == "" && len(cfg.Addresses) == 0:
+		return nil, errors.New("pbclient: target or addresses are required")
+	case cfg.Target != "" && len(cfg.Addresses) > 0:
+		return nil, errors.New("pbclient: set either target or addresses, not both")
+	}
+	cfg.setDefaults()
+	if cfg.LoadBalancing != "" && balancer.Get(cfg.LoadBalancing) == nil {
+		return nil, fmt.Errorf("pbclient: unknown load balancing policy %q", cfg.LoadBalancing)
+	}
+	sc, err := cfg.serviceConfig()
+	if err != nil {
+		return nil, err
+	}
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(cfg.Credentials),
+		grpc.WithDefaultServiceConfig(sc),
+		grpc.WithChainUnaryInterceptor(defaultTimeout(cfg.Timeout)),
+	}, cfg.DialOptions...)
+	if cfg.Compress {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	}
+
+	c := &Client{}
+	for i := 0; i < cfg.PoolSize; i++ {
+		target, connOpts := cfg.Target, opts
+		if len(cfg.Addresses) > 0 {
+			target, connOpts = staticResolver(cfg.Addresses, opts)
+		}
+		conn, err := grpc.NewClient(target, connOpts...)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.conns = append(c.conns, conn)
+		c.clients = append(c.clients, pb.NewGreeterClient(conn))
+	}
+	return c, nil
+}
+
+// staticResolver returns a target and dial options resolving to addrs. Each
+// connection gets its own resolver, which only serves the connection that
+// built it.
+func staticResolver(addrs []string, opts []grpc.DialOption) (string, []grpc.DialOption) {
+	r := manual.NewBuilderWithScheme("pbclient")
+	state := resolver.State{}
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	r.InitialState(state)
+	return r.Scheme() + ":///greeter", append(opts[:len(opts):len(opts)], grpc.WithResolvers(r))
+}
+
+// defaultTimeout bounds unary calls whose context has no deadline. The
+// deadline covers all retry attempts.
+func defaultTimeout(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// Greeter returns the generated client on the next pooled connection, for
+// the streaming RPCs and per-call options the helpers below do not cover.
+func (c *Client) Greeter() pb.GreeterClient {
+	i := c.next.Add(1) - 1
+	return c.clients[int(i)%len(c.clients)]
+}
+
+// SayHello returns the server's greeting for name.
+func (c *Client) SayHello(ctx context.Context, name string, opts ...grpc.CallOption) (string, error) {
+	r, err := c.Greeter().SayHello(ctx, &pb.HelloRequest{Name: name}, opts...)
+	if err != nil {
+		return "", err
+	}
+	return r.GetMessage(), nil
+}
+
+// SayHelloBatch greets every name with BatchSayHello, following page
+// tokens until the batch is done. Each page is a separate call, so without
+// a deadline on ctx each gets its own Timeout; with one, the batch fails
+// once it passes.
+func (c *Client) SayHelloBatch(ctx context.Context, names []string, opts ...grpc.CallOption) ([]string, error) {
+	req := &pb.BatchHelloRequest{Names: names}
+	messages := make([]string, 0, len(names))
+	for {
+		r, err := c.Greeter().BatchSayHello(ctx, req, opts...)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, r.GetMessages()...)
+		if r.GetNextPageToken() == "" {
+			return messages, nil
+		}
+		req.PageToken = r.GetNextPageToken()
+	}
+}
+
+// Close closes every pooled connection.
+func (c *Client) Close() error {
+	var errs []error
+	for _, conn := range c.conns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,290 @@
+package pbclient
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeGreeter fails the first failures calls with UNAVAILABLE and sleeps
+// for delay before answering.
+type fakeGreeter struct {
+	pb.UnimplementedGreeterServer
+	failures int32
+	delay    time.Duration
+	calls    atomic.Int32
+}
+
+func (g *fakeGreeter) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloResponse, error) {
+	if g.calls.Add(1) <= g.failures {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	select {
+	case <-time.After(g.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &pb.HelloResponse{Message: "Hello " + in.Name}, nil
+}
+
+// BatchSayHello greets two names per page, with the offset as page token.
+func (g *fakeGreeter) BatchSayHello(ctx context.Context, in *pb.BatchHelloRequest) (*pb.BatchHelloResponse, error) {
+	offset, _ := strconv.Atoi(in.PageToken)
+	end := min(offset+2, len(in.Names))
+	resp := &pb.BatchHelloResponse{Remaining: int32(len(in.Names) - end)}
+	for _, name := range in.Names[offset:end] {
+		resp.Messages = append(resp.Messages, "Hello "+name)
+	}
+	if end < len(in.Names) {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+	return resp, nil
+}
+
+// startServer serves g over an in-memory listener with opts and returns a
+// Config dialing it. connections counts the connections the server accepted.
+func startServer(t *testing.T, g pb.GreeterServer, opts ...grpc.ServerOption) (cfg Config, connections *atomic.Int32) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(opts...)
+	pb.RegisterGreeterServer(s, g)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	connections = new(atomic.Int32)
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		connections.Add(1)
+		return lis.DialContext(ctx)
+	}
+	return Config{
+		Target:         "passthrough:///bufnet",
+		InitialBackoff: time.Millisecond,
+		DialOptions:    []grpc.DialOption{grpc.WithContextDialer(dialer)},
+	}, connections
+}
+
+func newClient(t *testing.T, cfg Config) *Client {
+	t.Helper()
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestSayHello(t *testing.T) {
+	cfg, _ := startServer(t, &fakeGreeter{})
+	c := newClient(t, cfg)
+
+	got, err := c.SayHello(context.Background(), "World")
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if got != "Hello World" {
+		t.Errorf("SayHello = %q, want %q", got, "Hello World")
+	}
+}
+
+func TestSayHelloBatchFollowsPages(t *testing.T) {
+	cfg, _ := startServer(t, &fakeGreeter{})
+	c := newClient(t, cfg)
+
+	got, err := c.SayHelloBatch(context.Background(), []string{"a", "b", "c", "d", "e"})
+	if err != nil {
+		t.Fatalf("SayHelloBatch: %v", err)
+	}
+	if want := []string{"Hello a", "Hello b", "Hello c", "Hello d", "Hello e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SayHelloBatch = %q, want %q", got, want)
+	}
+}
+
+func TestRetriesUnavailable(t *testing.T) {
+	g := &fakeGreeter{failures: 2}
+	cfg, _ := startServer(t, g)
+	c := newClient(t, cfg)
+
+	if _, err := c.SayHello(context.Background(), "World"); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if n := g.calls.Load(); n != 3 {
+		t.Errorf("server saw %d calls, want 3", n)
+	}
+}
+
+func TestRetriesGiveUpAfterMaxAttempts(t *testing.T) {
+	g := &fakeGreeter{failures: 10}
+	cfg, _ := startServer(t, g)
+	cfg.MaxAttempts = 2
+	c := newClient(t, cfg)
+
+	_, err := c.SayHello(context.Background(), "World")
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("SayHello error = %v, want UNAVAILABLE", err)
+	}
+	if n := g.calls.Load(); n != 2 {
+		t.Errorf("server saw %d calls, want 2", n)
+	}
+}
+
+func TestNoRetriesWhenDisabled(t *testing.T) {
+	g := &fakeGreeter{failures: 1}
+	cfg, _ := startServer(t, g)
+	cfg.MaxAttempts = 1
+	c := newClient(t, cfg)
+
+	if _, err := c.SayHello(context.Background(), "World"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("SayHello error = %v, want UNAVAILABLE", err)
+	}
+	if n := g.calls.Load(); n != 1 {
+		t.Errorf("server saw %d calls, want 1", n)
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	cfg, _ := startServer(t, &fakeGreeter{delay: time.Second})
+	cfg.Timeout = 50 * time.Millisecond
+	c := newClient(t, cfg)
+
+	start := time.Now()
+	_, err := c.SayHello(context.Background(), "World")
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("SayHello error = %v, want DEADLINE_EXCEEDED", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("SayHello took %s, want about 50ms", elapsed)
+	}
+}
+
+func TestCallerDeadlineWins(t *testing.T) {
+	cfg, _ := startServer(t, &fakeGreeter{delay: 100 * time.Millisecond})
+	cfg.Timeout = 10 * time.Millisecond
+	c := newClient(t, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := c.SayHello(ctx, "World"); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+}
+
+func TestPoolSpreadsCalls(t *testing.T) {
+	cfg, connections := startServer(t, &fakeGreeter{})
+	cfg.PoolSize = 3
+	c := newClient(t, cfg)
+
+	for i := 0; i < 6; i++ {
+		if _, err := c.SayHello(context.Background(), "World"); err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+	}
+	if n := connections.Load(); n != 3 {
+		t.Errorf("server accepted %d connections, want 3", n)
+	}
+}
+
+func TestRoundRobinOverAddresses(t *testing.T) {
+	// Two servers, told apart by the address the resolver hands the dialer.
+	greeters := map[string]*fakeGreeter{"a:50051": {}, "b:50051": {}}
+	listeners := make(map[string]*bufconn.Listener)
+	for addr, g := range greeters {
+		lis := bufconn.Listen(1 << 20)
+		s := grpc.NewServer()
+		pb.RegisterGreeterServer(s, g)
+		go s.Serve(lis)
+		t.Cleanup(s.Stop)
+		listeners[addr] = lis
+	}
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		return listeners[addr].DialContext(ctx)
+	}
+	c := newClient(t, Config{
+		Addresses:   []string{"a:50051", "b:50051"},
+		DialOptions: []grpc.DialOption{grpc.WithContextDialer(dialer)},
+	})
+
+	// round_robin only picks connected addresses, so the first calls may
+	// all land on whichever connected first.
+	deadline := time.Now().Add(5 * time.Second)
+	for greeters["a:50051"].calls.Load() == 0 || greeters["b:50051"].calls.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("calls per server: a=%d b=%d, want both above 0",
+				greeters["a:50051"].calls.Load(), greeters["b:50051"].calls.Load())
+		}
+		if _, err := c.SayHello(context.Background(), "World"); err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+	}
+}
+
+func TestNewRejectsBadBalancing(t *testing.T) {
+	for _, cfg := range []Config{
+		{Target: "localhost:50051", Addresses: []string{"localhost:50052"}},
+		{Target: "localhost:50051", LoadBalancing: "least_busy"},
+	} {
+		if c, err := New(cfg); err == nil {
+			c.Close()
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
+
+// encodings records the grpc-encoding of every request the server reads.
+type encodings struct {
+	mu  sync.Mutex
+	got []string
+}
+
+func (e *encodings) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (e *encodings) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+func (e *encodings) HandleConn(context.Context, stats.ConnStats)                       {}
+func (e *encodings) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.InHeader); ok {
+		e.mu.Lock()
+		e.got = append(e.got, h.Compression)
+		e.mu.Unlock()
+	}
+}
+
+func TestCompress(t *testing.T) {
+	for _, tt := range []struct {
+		compress bool
+		want     string
+	}{
+		{false, ""},
+		{true, "gzip"},
+	} {
+		enc := new(encodings)
+		cfg, _ := startServer(t, &fakeGreeter{}, grpc.StatsHandler(enc))
+		cfg.Compress = tt.compress
+		c := newClient(t, cfg)
+
+		msg, err := c.SayHello(context.Background(), "World")
+		if err != nil || msg != "Hello World" {
+			t.Fatalf("Compress=%t: SayHello = %q, %v", tt.compress, msg, err)
+		}
+		enc.mu.Lock()
+		if len(enc.got) != 1 || enc.got[0] != tt.want {
+			t.Errorf("Compress=%t: request encodings %q, want %q", tt.compress, enc.got, tt.want)
+		}
+		enc.mu.Unlock()
+	}
+}
+
+func TestNewRequiresTarget(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Fatal("New without target succeeded")
+	}
+}
@@ -0,0 +1,30 @@
+package pbclient_test
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/pbclient"
+	"google.golang.org/grpc/metadata"
+)
+
+func Example() {
+	c, err := pbclient.New(pbclient.Config{
+		Target:      "localhost:50051",
+		Timeout:     2 * time.Second,
+		MaxAttempts: 4,
+		PoolSize:    2,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer s3cret")
+	msg, err := c.SayHello(ctx, "World")
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println(msg)
+}
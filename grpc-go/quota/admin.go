@@ -0,0 +1,147 @@
+package quota
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"github.com/gnsalok/go-project-root/grpc-go/statuserr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AdminMethods are the QuotaAdmin RPCs. AdminServer checks its own tokens,
+// so they can be exempted from service auth, and they are exempt from
+// quotas so operators cannot lock themselves out.
+var AdminMethods = []string{
+	pb.QuotaAdmin_GetQuota_FullMethodName,
+	pb.QuotaAdmin_SetQuota_FullMethodName,
+	pb.QuotaAdmin_ListQuotas_FullMethodName,
+}
+
+// AdminServer implements the QuotaAdmin service on top of a Limiter's
+// store. Every call needs one of the limiter's Config.AdminTokens; without
+// any, the service refuses all calls.
+type AdminServer struct {
+	pb.UnimplementedQuotaAdminServer
+	limiter *Limiter
+}
+
+func NewAdminServer(l *Limiter) *AdminServer {
+	return &AdminServer{limiter: l}
+}
+
+func (a *AdminServer) GetQuota(ctx context.Context, in *pb.GetQuotaRequest) (*pb.Quota, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if err := validateClientID(in.GetClientId()); err != nil {
+		return nil, err
+	}
+	return a.quota(ctx, in.GetClientId())
+}
+
+func (a *AdminServer) SetQuota(ctx context.Context, in *pb.SetQuotaRequest) (*pb.Quota, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	var v statuserr.FieldViolations
+	v.Check(in.GetClientId() != "", "client_id", "must not be empty")
+	v.Check(in.GetDailyLimit() >= 0, "daily_limit", "must not be negative")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	store := a.limiter.store
+	var err error
+	if in.GetUseDefault() {
+		err = store.DeleteLimit(ctx, in.GetClientId())
+	} else {
+		err = store.SetLimit(ctx, in.GetClientId(), in.GetDailyLimit())
+	}
+	if err == nil && in.GetResetUsage() {
+		today, _ := day(a.limiter.now())
+		err = store.ResetUsage(ctx, in.GetClientId(), today)
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	log.Printf("quota: client %s set to %d/day (default=%t, reset=%t)",
+		in.GetClientId(), in.GetDailyLimit(), in.GetUseDefault(), in.GetResetUsage())
+	return a.quota(ctx, in.GetClientId())
+}
+
+func (a *AdminServer) ListQuotas(ctx context.Context, _ *pb.ListQuotasRequest) (*pb.ListQuotasResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	today, _ := day(a.limiter.now())
+	clients, err := a.limiter.store.Clients(ctx, today)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	resp := &pb.ListQuotasResponse{}
+	for _, c := range clients {
+		q, err := a.quota(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		resp.Quotas = append(resp.Quotas, q)
+	}
+	return resp, nil
+}
+
+// quota reports client's limit and today's usage.
+func (a *AdminServer) quota(ctx context.Context, client string) (*pb.Quota, error) {
+	limit, overridden, err := a.limiter.limit(ctx, client)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	today, resetsAt := day(a.limiter.now())
+	used, err := a.limiter.store.Usage(ctx, client, today)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	q := &pb.Quota{
+		ClientId:   client,
+		DailyLimit: limit,
+		Overridden: overridden,
+		Used:       used,
+		ResetsAt:   timestamppb.New(resetsAt),
+	}
+	if limit > 0 {
+		remaining := max(limit-used, 0)
+		q.Remaining = &remaining
+	}
+	return q, nil
+}
+
+func (a *AdminServer) authorize(ctx context.Context) error {
+	tokens := a.limiter.cfg.AdminTokens
+	if len(tokens) == 0 {
+		return status.Error(codes.PermissionDenied, "quota admin is disabled; set GRPC_QUOTA_ADMIN_TOKENS")
+	}
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.PermissionDenied, "not a quota admin token")
+}
+
+func validateClientID(id string) error {
+	var v statuserr.FieldViolations
+	v.Check(id != "", "client_id", "must not be empty")
+	return v.Err()
+}
+
+func storeError(err error) error {
+	log.Printf("quota store: %v", err)
+	return statuserr.Unavailable("quota store unavailable", time.Second)
+}
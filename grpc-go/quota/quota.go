@@ -0,0 +1,170 @@
+// Package quota enforces daily per-client request quotas. Clients are
+// identified by their bearer token; the Limiter's interceptors count each
+// call against the client's limit in a Store and reject calls over it with
+// RESOURCE_EXHAUSTED. AdminServer adjusts limits at runtime.
+package quota
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/statuserr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Anonymous is the client ID of calls without a bearer token.
+const Anonymous = "anonymous"
+
+// Config sets the default quota and the methods it does not apply to.
+type Config struct {
+	// DailyLimit is the number of calls each client may make per UTC day
+	// unless it has an override; 0 means unlimited.
+	DailyLimit int64
+	// Exempt holds full method names, e.g. "/grpc.health.v1.Health/Check".
+	Exempt []string
+	// AdminTokens are the bearer tokens accepted by AdminServer.
+	AdminTokens []string
+	// Identify, if set, returns the client ID of tokens it knows, so that
+	// clients keep their quota when their short-lived tokens change; other
+	// tokens are identified by ClientID.
+	Identify func(token string) (client string, ok bool)
+}
+
+// ConfigFromEnv reads GRPC_QUOTA_DAILY and GRPC_QUOTA_ADMIN_TOKENS, a
+// comma-separated token list.
+func ConfigFromEnv() (Config, error) {
+	var cfg Config
+	if s := os.Getenv("GRPC_QUOTA_DAILY"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("GRPC_QUOTA_DAILY: %q is not a non-negative integer", s)
+		}
+		cfg.DailyLimit = n
+	}
+	for _, t := range strings.Split(os.Getenv("GRPC_QUOTA_ADMIN_TOKENS"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			cfg.AdminTokens = append(cfg.AdminTokens, t)
+		}
+	}
+	return cfg, nil
+}
+
+// ClientID returns the ID of the client whose bearer token is token: the
+// first 12 hex digits of its SHA-256, so IDs can be logged and shared with
+// operators without revealing the token.
+func ClientID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:6])
+}
+
+// clientFromContext returns the ID of the caller's bearer token, or
+// Anonymous.
+func (l *Limiter) clientFromContext(ctx context.Context) string {
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return Anonymous
+	}
+	if l.cfg.Identify != nil {
+		if client, ok := l.cfg.Identify(token); ok {
+			return client
+		}
+	}
+	return ClientID(token)
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", false
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	return token, ok && token != ""
+}
+
+// day names the UTC day of t and returns when it ends.
+func day(t time.Time) (string, time.Time) {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return start.Format(time.DateOnly), start.AddDate(0, 0, 1)
+}
+
+// Limiter counts calls against the clients' daily quotas.
+type Limiter struct {
+	store Store
+	cfg   Config
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+func NewLimiter(store Store, cfg Config) *Limiter {
+	return &Limiter{store: store, cfg: cfg, now: time.Now}
+}
+
+// UnaryServerInterceptor rejects calls from clients that used up today's
+// quota with codes.ResourceExhausted. It belongs after authentication, so
+// rejected tokens do not use quota.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := l.consume(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming RPCs; a
+// stream counts as one call, when it opens.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.consume(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// consume counts the call against the caller's quota. Store failures are
+// logged and let the call through, so a store outage does not take the
+// service down with it.
+func (l *Limiter) consume(ctx context.Context, method string) error {
+	if slices.Contains(l.cfg.Exempt, method) {
+		return nil
+	}
+	client := l.clientFromContext(ctx)
+	limit, _, err := l.limit(ctx, client)
+	if err != nil {
+		log.Printf("quota store: %v", err)
+		return nil
+	}
+	now := l.now()
+	today, resetsAt := day(now)
+	_, ok, err := l.store.Consume(ctx, client, today, limit)
+	if err != nil {
+		log.Printf("quota store: %v", err)
+		return nil
+	}
+	if !ok {
+		return statuserr.QuotaExhausted("client:"+client,
+			fmt.Sprintf("daily quota of %d requests exhausted", limit), resetsAt.Sub(now))
+	}
+	return nil
+}
+
+// limit returns client's daily limit and whether it is an override.
+func (l *Limiter) limit(ctx context.Context, client string) (int64, bool, error) {
+	limit, ok, err := l.store.Limit(ctx, client)
+	if err != nil || !ok {
+		return l.cfg.DailyLimit, false, err
+	}
+	return limit, true, nil
+}
@@ -0,0 +1,133 @@
+package quota
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"github.com/gnsalok/go-project-root/grpc-go/statuserr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type echoGreeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (echoGreeter) SayHello(_ context.Context, in *pb.HelloRequest) (*pb.HelloResponse, error) {
+	return &pb.HelloResponse{Message: "Hello " + in.Name}, nil
+}
+
+// startServer serves a greeter and QuotaAdmin behind l's interceptor over
+// an in-memory listener.
+func startServer(t *testing.T, l *Limiter) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.UnaryInterceptor(l.UnaryServerInterceptor()))
+	pb.RegisterGreeterServer(s, echoGreeter{})
+	pb.RegisterQuotaAdminServer(s, NewAdminServer(l))
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestQuota(t *testing.T) {
+	now := time.Date(2024, 5, 31, 23, 0, 0, 0, time.UTC)
+	l := NewLimiter(NewMemoryStore(), Config{DailyLimit: 2, Exempt: AdminMethods, AdminTokens: []string{"admin"}})
+	l.now = func() time.Time { return now }
+	conn := startServer(t, l)
+	greeter, admin := pb.NewGreeterClient(conn), pb.NewQuotaAdminClient(conn)
+	alice := withToken("alice")
+
+	for i := 0; i < 2; i++ {
+		if _, err := greeter.SayHello(alice, &pb.HelloRequest{Name: "Alice"}); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	_, err := greeter.SayHello(alice, &pb.HelloRequest{Name: "Alice"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("third call: got %v, want RESOURCE_EXHAUSTED", err)
+	}
+	if delay, ok := statuserr.RetryDelay(err); !ok || delay != time.Hour {
+		t.Errorf("RetryDelay = %v, %t; want 1h until midnight UTC", delay, ok)
+	}
+	// Other clients have their own quota.
+	if _, err := greeter.SayHello(withToken("bob"), &pb.HelloRequest{Name: "Bob"}); err != nil {
+		t.Errorf("bob: %v", err)
+	}
+
+	// Admin calls are exempt from quotas but need an admin token.
+	_, err = admin.SetQuota(alice, &pb.SetQuotaRequest{ClientId: ClientID("alice"), DailyLimit: 3})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("SetQuota with client token: got %v, want PERMISSION_DENIED", err)
+	}
+	q, err := admin.SetQuota(withToken("admin"), &pb.SetQuotaRequest{ClientId: ClientID("alice"), DailyLimit: 3})
+	if err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+	if !q.Overridden || q.Used != 2 || q.GetRemaining() != 1 {
+		t.Errorf("SetQuota = %v, want overridden with 2 used and 1 remaining", q)
+	}
+	if _, err := greeter.SayHello(alice, &pb.HelloRequest{Name: "Alice"}); err != nil {
+		t.Errorf("call after raising the limit: %v", err)
+	}
+
+	list, err := admin.ListQuotas(withToken("admin"), &pb.ListQuotasRequest{})
+	if err != nil {
+		t.Fatalf("ListQuotas: %v", err)
+	}
+	if len(list.Quotas) != 2 {
+		t.Errorf("ListQuotas returned %d quotas, want alice and bob", len(list.Quotas))
+	}
+
+	// Usage starts over the next UTC day.
+	now = now.Add(time.Hour)
+	q, err = admin.GetQuota(withToken("admin"), &pb.GetQuotaRequest{ClientId: ClientID("alice")})
+	if err != nil {
+		t.Fatalf("GetQuota: %v", err)
+	}
+	if q.Used != 0 || q.GetRemaining() != 3 {
+		t.Errorf("GetQuota next day = %v, want 0 used and 3 remaining", q)
+	}
+}
+
+func TestQuotaIdentify(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), Config{DailyLimit: 2, Identify: func(token string) (string, bool) {
+		return "user:alice", strings.HasPrefix(token, "alice-")
+	}})
+	greeter := pb.NewGreeterClient(startServer(t, l))
+
+	// Each token of the same user counts against one quota.
+	for _, token := range []string{"alice-1", "alice-2"} {
+		if _, err := greeter.SayHello(withToken(token), &pb.HelloRequest{Name: "Alice"}); err != nil {
+			t.Fatalf("%s: %v", token, err)
+		}
+	}
+	_, err := greeter.SayHello(withToken("alice-3"), &pb.HelloRequest{Name: "Alice"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("third token: got %v, want RESOURCE_EXHAUSTED", err)
+	}
+	// Tokens Identify does not know are fingerprinted as usual.
+	if _, err := greeter.SayHello(withToken("bob"), &pb.HelloRequest{Name: "Bob"}); err != nil {
+		t.Errorf("bob: %v", err)
+	}
+}
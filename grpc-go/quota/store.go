@@ -0,0 +1,114 @@
+package quota
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Store keeps per-client usage for each UTC day, named like "2024-05-31",
+// and per-client overrides of the default daily limit. Implementations
+// must be safe for concurrent use; a shared store such as Redis lets
+// several replicas enforce one quota.
+type Store interface {
+	// Consume counts one request for client on day unless that would take
+	// its usage past limit, and returns the usage after the call. A limit
+	// of 0 means unlimited.
+	Consume(ctx context.Context, client, day string, limit int64) (used int64, ok bool, err error)
+	Usage(ctx context.Context, client, day string) (int64, error)
+	ResetUsage(ctx context.Context, client, day string) error
+
+	// Limit returns client's override of the default limit, if any.
+	Limit(ctx context.Context, client string) (limit int64, ok bool, err error)
+	SetLimit(ctx context.Context, client string, limit int64) error
+	DeleteLimit(ctx context.Context, client string) error
+
+	// Clients lists, sorted, the clients with an override or usage on day.
+	Clients(ctx context.Context, day string) ([]string, error)
+}
+
+// MemoryStore is a Store for a single server process. It only keeps usage
+// for the most recent day it has seen.
+type MemoryStore struct {
+	mu     sync.Mutex
+	day    string
+	usage  map[string]int64
+	limits map[string]int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{usage: map[string]int64{}, limits: map[string]int64{}}
+}
+
+// today returns the usage map for day, dropping older days. Usage for a
+// day before the current one reads as empty. mu must be held.
+func (m *MemoryStore) today(day string) map[string]int64 {
+	if day > m.day {
+		m.day, m.usage = day, map[string]int64{}
+	}
+	if day != m.day {
+		return map[string]int64{}
+	}
+	return m.usage
+}
+
+func (m *MemoryStore) Consume(_ context.Context, client, day string, limit int64) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := m.today(day)
+	if limit > 0 && usage[client] >= limit {
+		return usage[client], false, nil
+	}
+	usage[client]++
+	return usage[client], true, nil
+}
+
+func (m *MemoryStore) Usage(_ context.Context, client, day string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.today(day)[client], nil
+}
+
+func (m *MemoryStore) ResetUsage(_ context.Context, client, day string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.today(day), client)
+	return nil
+}
+
+func (m *MemoryStore) Limit(_ context.Context, client string) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	limit, ok := m.limits[client]
+	return limit, ok, nil
+}
+
+func (m *MemoryStore) SetLimit(_ context.Context, client string, limit int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limits[client] = limit
+	return nil
+}
+
+func (m *MemoryStore) DeleteLimit(_ context.Context, client string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.limits, client)
+	return nil
+}
+
+func (m *MemoryStore) Clients(_ context.Context, day string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var clients []string
+	for c := range m.limits {
+		clients = append(clients, c)
+	}
+	for c := range m.today(day) {
+		if _, ok := m.limits[c]; !ok {
+			clients = append(clients, c)
+		}
+	}
+	sort.Strings(clients)
+	return clients, nil
+}
@@ -2,30 +2,321 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"io"
 	"log"
+	"log/slog"
 	"net"
+	"os"
+	"time"
 
+	"github.com/gnsalok/go-project-root/grpc-go/authz"
+	"github.com/gnsalok/go-project-root/grpc-go/config"
+	"github.com/gnsalok/go-project-root/grpc-go/connstats"
+	"github.com/gnsalok/go-project-root/grpc-go/greeting"
+	"github.com/gnsalok/go-project-root/grpc-go/interceptors"
 	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	pbv2 "github.com/gnsalok/go-project-root/grpc-go/pb/v2"
+	"github.com/gnsalok/go-project-root/grpc-go/quota"
+	"github.com/gnsalok/go-project-root/grpc-go/session"
+	"github.com/gnsalok/go-project-root/grpc-go/statuserr"
+	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	// Registers the gzip compressor, so the server accepts gzip-compressed
+	// requests and compresses its responses to those clients.
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
+// maxStreamGreetings caps the count accepted by SayHelloStream.
+const maxStreamGreetings = 100
+
+// server implements Greeter v1, and the greeting logic shared with v2 in
+// greeter.go.
 type server struct {
 	pb.UnimplementedGreeterServer
+	greetings greeting.Provider
+	// streamInterval is the pause between SayHelloStream messages.
+	streamInterval time.Duration
+	// batchInterval is the time BatchSayHello spends on each name.
+	batchInterval time.Duration
+}
+
+// greeting returns the greeting word for in.locale as a gRPC error-ready
+// result: unknown locales are invalid arguments, provider failures are
+// retryable.
+func (s *server) greeting(ctx context.Context, in hello) (string, error) {
+	word, err := greeting.Lookup(ctx, s.greetings, in.locale)
+	if errors.Is(err, greeting.ErrUnsupportedLanguage) {
+		var v statuserr.FieldViolations
+		v.Add(in.localeField, err.Error())
+		return "", v.Err()
+	}
+	if err != nil {
+		log.Printf("greeting provider: %v", err)
+		return "", statuserr.Unavailable("greeting provider unavailable", time.Second)
+	}
+	return word, nil
+}
+
+// helloV1 translates a v1 request, whose locale is called language.
+func helloV1(in *pb.HelloRequest) hello {
+	return hello{name: in.GetName(), locale: in.GetLanguage(), localeField: "language"}
 }
 
 // Implement the SayHello method
 func (s *server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloResponse, error) {
-	return &pb.HelloResponse{Message: "Hello " + in.Name}, nil
+	msg, err := s.greet(ctx, helloV1(in))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.HelloResponse{Message: msg}, nil
+}
+
+// SayHelloStream sends in.Count greetings, pausing streamInterval between them.
+func (s *server) SayHelloStream(in *pb.HelloStreamRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	req := hello{name: in.GetName(), locale: in.GetLanguage(), localeField: "language"}
+	return s.greetStream(stream.Context(), req, in.GetCount(), func(msg string) error {
+		return stream.Send(&pb.HelloResponse{Message: msg})
+	})
+}
+
+// SayHelloToAll reads names until the client closes its side, then greets
+// all of them in one response, in the language of the first request.
+func (s *server) SayHelloToAll(stream pb.Greeter_SayHelloToAllServer) error {
+	msg, _, err := s.greetAll(stream.Context(), func() (hello, error) {
+		in, err := stream.Recv()
+		return helloV1(in), err
+	})
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(&pb.HelloResponse{Message: msg})
+}
+
+// BatchSayHello greets as many of in.Names as fit before the deadline and
+// returns a page token for the rest.
+func (s *server) BatchSayHello(ctx context.Context, in *pb.BatchHelloRequest) (*pb.BatchHelloResponse, error) {
+	req := hello{locale: in.GetLanguage(), localeField: "language"}
+	page, err := s.greetBatch(ctx, req, in.GetNames(), in.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.BatchHelloResponse{Messages: page.messages, NextPageToken: page.nextToken, Remaining: int32(page.remaining)}, nil
+}
+
+// Chat replies to every message as soon as it arrives, until the client
+// closes its side.
+func (s *server) Chat(stream pb.Greeter_ChatServer) error {
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.ChatMessage{Name: "server", Text: chatReply(in.Name, in.Text)}); err != nil {
+			return err
+		}
+	}
+}
+
+// serverConfig holds what newGRPCServer wires together.
+type serverConfig struct {
+	greetings      greeting.Provider
+	streamInterval time.Duration
+	batchInterval  time.Duration
+	interceptors   config.Interceptors
+	messages       config.Messages
+	// logger writes the request log.
+	logger  *slog.Logger
+	auth    interceptors.AuthConfig
+	audit   interceptors.AuditConfig
+	authz   *authz.Authorizer
+	limiter *quota.Limiter
+	// sessions issues the tokens of the Auth service; auth should accept
+	// them.
+	sessions *session.Issuer
+	metrics  *grpcprom.ServerMetrics
+}
+
+// newGRPCServer builds the server with the interceptors enabled in cfg and
+// registers both Greeter versions and the Auth, QuotaAdmin, health and
+// reflection services. Callers pass credentials, keepalive and tracing in
+// opts.
+func newGRPCServer(cfg serverConfig, opts ...grpc.ServerOption) (*grpc.Server, *health.Server) {
+	// Request logging and auditing sit outermost so they record the code
+	// returned by recovery and auth.
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	on := cfg.interceptors
+	if on.RequestLog {
+		unary = append(unary, interceptors.UnaryServerRequestLog(cfg.logger))
+		stream = append(stream, interceptors.StreamServerRequestLog(cfg.logger))
+	}
+	if on.Audit {
+		unary = append(unary, interceptors.UnaryServerAudit(cfg.audit))
+		stream = append(stream, interceptors.StreamServerAudit(cfg.audit))
+	}
+	if on.Metrics {
+		unary = append(unary, cfg.metrics.UnaryServerInterceptor())
+		stream = append(stream, cfg.metrics.StreamServerInterceptor())
+	}
+	if on.Recovery {
+		unary = append(unary, interceptors.UnaryServerRecovery(nil))
+		stream = append(stream, interceptors.StreamServerRecovery(nil))
+	}
+	if on.Auth {
+		unary = append(unary, interceptors.UnaryServerAuth(cfg.auth))
+		stream = append(stream, interceptors.StreamServerAuth(cfg.auth))
+	}
+	if on.Authz && cfg.authz != nil {
+		unary = append(unary, cfg.authz.UnaryServerInterceptor())
+		stream = append(stream, cfg.authz.StreamServerInterceptor())
+	}
+	if on.Quota {
+		unary = append(unary, cfg.limiter.UnaryServerInterceptor())
+		stream = append(stream, cfg.limiter.StreamServerInterceptor())
+	}
+	if on.PayloadLog {
+		unary = append(unary, interceptors.UnaryServerLogging(interceptors.LoggingConfigFromEnv()))
+	}
+	opts = append(opts, cfg.messages.ServerOptions()...)
+	opts = append(opts, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+	s := grpc.NewServer(opts...)
+	greeter := &server{greetings: cfg.greetings, streamInterval: cfg.streamInterval, batchInterval: cfg.batchInterval}
+	pb.RegisterGreeterServer(s, greeter)
+	pbv2.RegisterGreeterServer(s, &serverV2{core: greeter})
+	pb.RegisterQuotaAdminServer(s, quota.NewAdminServer(cfg.limiter))
+	pb.RegisterAuthServer(s, session.NewServer(cfg.sessions))
+
+	// Health checking for Kubernetes gRPC probes, reflection for grpcurl.
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+	reflection.Register(s)
+	cfg.metrics.InitializeMetrics(s)
+	return s, hs
 }
 
 func main() {
-	lis, err := net.Listen("tcp", ":50051")
+	// Flags override GRPC_* env vars, which override the -config file.
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	level, _ := cfg.SlogLevel()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	tlsCfg := cfg.ServerTLS()
+	creds, err := tlsCfg.Credentials()
+	if err != nil {
+		log.Fatalf("failed to load credentials: %v", err)
+	}
+	greetings, err := greeting.New(greeting.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("invalid greeting provider: %v", err)
+	}
+	deps, err := dependenciesFromEnv()
+	if err != nil {
+		log.Fatalf("invalid dependencies: %v", err)
+	}
+	lis, err := net.Listen("tcp", cfg.ListenAddr())
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
-	pb.RegisterGreeterServer(s, &server{})
-	log.Printf("server listening at %v", lis.Addr())
+	// Payload logging is configured via GRPC_LOG_* env vars and tokens via
+	// GRPC_AUTH_TOKENS.
+	auth := interceptors.AuthConfigFromEnv()
+	auth.Exempt = append(auth.Exempt, unauthenticatedMethods...)
+	auth.Exempt = append(auth.Exempt, quota.AdminMethods...)
+	auth.Exempt = append(auth.Exempt, session.Methods...)
+	// Users in GRPC_AUTH_USERS log in through the Auth service for
+	// short-lived tokens, accepted alongside GRPC_AUTH_TOKENS.
+	sessionCfg, err := session.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid auth config: %v", err)
+	}
+	sessions := session.NewIssuer(sessionCfg)
+	if sessionCfg.Enabled() {
+		auth.Verifier = sessions
+	}
+	if !auth.Enabled() {
+		log.Printf("GRPC_AUTH_TOKENS and GRPC_AUTH_USERS are empty; authentication disabled")
+	}
+	// The GRPC_AUTHZ_POLICY file lists the roles and scopes methods require;
+	// users get theirs from GRPC_AUTH_ROLES and GRPC_AUTH_SCOPES. Edits to
+	// the file apply without a restart.
+	authzCfg, err := authz.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid authz config: %v", err)
+	}
+	authzCfg.Claims = sessions.Claims
+	authzCfg.Exempt = auth.Exempt
+	authorizer, err := authz.New(authzCfg)
+	if err != nil {
+		log.Fatalf("invalid authz policy: %v", err)
+	}
+	go authorizer.Watch(context.Background())
+	// Daily quotas per token come from GRPC_QUOTA_DAILY and are adjusted at
+	// runtime through QuotaAdmin with one of GRPC_QUOTA_ADMIN_TOKENS. Users
+	// keep theirs across token refreshes.
+	quotaCfg, err := quota.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid quota config: %v", err)
+	}
+	quotaCfg.Identify = sessions.QuotaClient
+	quotaCfg.Exempt = append(append(quotaCfg.Exempt, unauthenticatedMethods...), quota.AdminMethods...)
+	limiter := quota.NewLimiter(quota.NewMemoryStore(), quotaCfg)
+	// Audit records go to the sink named by GRPC_AUDIT_SINK.
+	audit, err := interceptors.AuditConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid audit config: %v", err)
+	}
+	if audit.Enabled() {
+		defer audit.Sink.Close()
+	}
+	metrics, reg := newServerMetrics()
+	// Connections, streams and bytes per peer, and connections closed for
+	// breaking the keepalive enforcement policy.
+	conns := connstats.New(logger)
+	reg.MustRegister(conns)
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	s, hs := newGRPCServer(serverConfig{
+		greetings:      greetings,
+		streamInterval: 500 * time.Millisecond,
+		batchInterval:  20 * time.Millisecond,
+		interceptors:   cfg.Interceptors,
+		messages:       cfg.Messages,
+		logger:         logger,
+		auth:           auth,
+		audit:          audit,
+		authz:          authorizer,
+		limiter:        limiter,
+		sessions:       sessions,
+		metrics:        metrics,
+	}, append(cfg.KeepaliveOptions(),
+		grpc.Creds(conns.Credentials(creds)),
+		grpc.StatsHandler(conns),
+		// Extracts incoming trace context and records a span per RPC.
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+	)...)
+	if cfg.MetricsAddr != "" {
+		go serveMetrics(cfg.MetricsAddr, reg)
+	}
+	go watchHealth(context.Background(), hs, []string{pb.Greeter_ServiceDesc.ServiceName, pbv2.Greeter_ServiceDesc.ServiceName}, deps, 10*time.Second)
+	log.Printf("server listening at %v (tls=%t, mtls=%t)", lis.Addr(), !tlsCfg.Insecure, tlsCfg.ClientCAFile != "")
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
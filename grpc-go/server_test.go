@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/authz"
+	"github.com/gnsalok/go-project-root/grpc-go/config"
+	"github.com/gnsalok/go-project-root/grpc-go/greeting"
+	"github.com/gnsalok/go-project-root/grpc-go/interceptors"
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"github.com/gnsalok/go-project-root/grpc-go/quota"
+	"github.com/gnsalok/go-project-root/grpc-go/session"
+	"github.com/gnsalok/go-project-root/grpc-go/statuserr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testToken is the only static token accepted by servers started with
+// startServer; testUser may log in with testPassword for session tokens.
+const (
+	testToken    = "s3cret"
+	testUser     = "alice"
+	testPassword = "wonderland"
+)
+
+// startServer serves the full interceptor chain and services over an
+// in-memory listener, with token and session auth and no quota, and returns a client
+// connection to it, dialed with opts. Tests of new RPCs call it and then
+// create their service's client on the connection; change cfg to swap
+// dependencies.
+func startServer(t testing.TB, configure func(*serverConfig), opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	metrics, _ := newServerMetrics()
+	sessions := session.NewIssuer(session.Config{
+		Users:      map[string]string{testUser: testPassword},
+		AccessTTL:  time.Minute,
+		RefreshTTL: time.Hour,
+	})
+	cfg := serverConfig{
+		greetings:      greeting.Static(greeting.DefaultGreetings),
+		streamInterval: time.Millisecond,
+		interceptors:   config.Default().Interceptors,
+		messages:       config.Default().Messages,
+		auth: interceptors.AuthConfig{
+			Tokens:   []string{testToken},
+			Verifier: sessions,
+			Exempt:   append(slices.Clone(unauthenticatedMethods), session.Methods...),
+		},
+		limiter:  quota.NewLimiter(quota.NewMemoryStore(), quota.Config{}),
+		sessions: sessions,
+		metrics:  metrics,
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+	s, _ := newGRPCServer(cfg)
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// authed returns a context carrying token as a bearer token.
+func authed(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestSayHello(t *testing.T) {
+	c := pb.NewGreeterClient(startServer(t, nil))
+
+	for _, tt := range []struct {
+		language, want string
+	}{
+		{"", "Hello World"},
+		{"es", "Hola World"},
+		{"pt-BR", "Olá World"},
+	} {
+		resp, err := c.SayHello(authed(testToken), &pb.HelloRequest{Name: "World", Language: tt.language})
+		if err != nil {
+			t.Fatalf("SayHello(%q): %v", tt.language, err)
+		}
+		if resp.Message != tt.want {
+			t.Errorf("SayHello(%q) = %q, want %q", tt.language, resp.Message, tt.want)
+		}
+	}
+}
+
+func TestSayHelloStream(t *testing.T) {
+	c := pb.NewGreeterClient(startServer(t, nil))
+
+	stream, err := c.SayHelloStream(authed(testToken), &pb.HelloStreamRequest{Name: "World", Count: 3})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	var got []string
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		got = append(got, resp.Message)
+	}
+	if len(got) != 3 || got[2] != "Hello World (3/3)" {
+		t.Errorf("SayHelloStream = %q, want 3 greetings ending in %q", got, "Hello World (3/3)")
+	}
+}
+
+func TestSayHelloValidation(t *testing.T) {
+	c := pb.NewGreeterClient(startServer(t, nil))
+
+	for _, tt := range []struct {
+		name   string
+		req    *pb.HelloRequest
+		fields []string
+	}{
+		{"empty name", &pb.HelloRequest{Name: " "}, []string{"name"}},
+		{"long name", &pb.HelloRequest{Name: strings.Repeat("x", maxNameLength+1)}, []string{"name"}},
+		{"unknown language", &pb.HelloRequest{Name: "World", Language: "xx"}, []string{"language"}},
+		{"every field", &pb.HelloRequest{Language: strings.Repeat("x", maxLanguageLength+1)}, []string{"name", "language"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.SayHello(authed(testToken), tt.req)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("SayHello: got %v, want INVALID_ARGUMENT", err)
+			}
+			var fields []string
+			for _, v := range statuserr.BadRequest(err) {
+				fields = append(fields, v.GetField())
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("field violations = %q, want %q", fields, tt.fields)
+			}
+		})
+	}
+}
+
+// A batch too slow for one deadline comes back in pages that together
+// greet every name, in order.
+func TestBatchSayHello(t *testing.T) {
+	c := pb.NewGreeterClient(startServer(t, func(cfg *serverConfig) { cfg.batchInterval = 10 * time.Millisecond }))
+
+	names := make([]string, 20)
+	for i := range names {
+		names[i] = fmt.Sprintf("n%02d", i)
+	}
+	req := &pb.BatchHelloRequest{Names: names, Language: "es"}
+	var got []string
+	for pages := 1; ; pages++ {
+		ctx, cancel := context.WithTimeout(authed(testToken), 100*time.Millisecond)
+		resp, err := c.BatchSayHello(ctx, req)
+		cancel()
+		if err != nil {
+			t.Fatalf("BatchSayHello page %d: %v", pages, err)
+		}
+		got = append(got, resp.Messages...)
+		if int(resp.Remaining) != len(names)-len(got) {
+			t.Errorf("page %d: remaining = %d, want %d", pages, resp.Remaining, len(names)-len(got))
+		}
+		if resp.NextPageToken == "" {
+			if pages == 1 {
+				t.Error("the whole batch fit in one deadline; want partial pages")
+			}
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	if len(got) != len(names) || got[0] != "Hola n00" || got[19] != "Hola n19" {
+		t.Errorf("greetings = %q, want one per name in order", got)
+	}
+
+	// Without a deadline the batch is done in one call.
+	resp, err := c.BatchSayHello(authed(testToken), &pb.BatchHelloRequest{Names: names[:3]})
+	if err != nil {
+		t.Fatalf("BatchSayHello: %v", err)
+	}
+	if len(resp.Messages) != 3 || resp.NextPageToken != "" || resp.Remaining != 0 {
+		t.Errorf("BatchSayHello = %v, want all 3 greetings and no token", resp)
+	}
+}
+
+func TestBatchSayHelloValidation(t *testing.T) {
+	c := pb.NewGreeterClient(startServer(t, func(cfg *serverConfig) { cfg.batchInterval = 10 * time.Millisecond }))
+
+	ctx, cancel := context.WithTimeout(authed(testToken), 50*time.Millisecond)
+	defer cancel()
+	first, err := c.BatchSayHello(ctx, &pb.BatchHelloRequest{Names: []string{"a", "b", "c", "d", "e", "f", "g"}})
+	if err != nil || first.NextPageToken == "" {
+		t.Fatalf("BatchSayHello = %v, %v; want a partial page", first, err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		req    *pb.BatchHelloRequest
+		fields []string
+	}{
+		{"no names", &pb.BatchHelloRequest{}, []string{"names"}},
+		{"empty name", &pb.BatchHelloRequest{Names: []string{"a", " "}}, []string{"names[1]"}},
+		{"token of another request", &pb.BatchHelloRequest{Names: []string{"a", "b", "c", "d", "e", "f", "x"}, PageToken: first.NextPageToken}, []string{"page_token"}},
+		{"garbage token", &pb.BatchHelloRequest{Names: []string{"a"}, PageToken: "!"}, []string{"page_token"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.BatchSayHello(authed(testToken), tt.req)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("BatchSayHello: got %v, want INVALID_ARGUMENT", err)
+			}
+			var fields []string
+			for _, v := range statuserr.BadRequest(err) {
+				fields = append(fields, v.GetField())
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("field violations = %q, want %q", fields, tt.fields)
+			}
+		})
+	}
+}
+
+// A deadline too short for even one name fails instead of returning an
+// empty page the client would retry forever.
+func TestBatchSayHelloDeadlineTooShort(t *testing.T) {
+	c := pb.NewGreeterClient(startServer(t, func(cfg *serverConfig) { cfg.batchInterval = time.Second }))
+
+	ctx, cancel := context.WithTimeout(authed(testToken), 200*time.Millisecond)
+	defer cancel()
+	_, err := c.BatchSayHello(ctx, &pb.BatchHelloRequest{Names: []string{"a"}})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("BatchSayHello: got %v, want DEADLINE_EXCEEDED", err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	conn := startServer(t, nil)
+	c := pb.NewGreeterClient(conn)
+
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"missing token", context.Background()},
+		{"wrong token", authed("wrong")},
+		{"not a bearer token", metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+testToken)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.SayHello(tt.ctx, &pb.HelloRequest{Name: "World"})
+			if status.Code(err) != codes.Unauthenticated {
+				t.Errorf("SayHello: got %v, want UNAUTHENTICATED", err)
+			}
+			stream, err := c.SayHelloStream(tt.ctx, &pb.HelloStreamRequest{Name: "World", Count: 1})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if status.Code(err) != codes.Unauthenticated {
+				t.Errorf("SayHelloStream: got %v, want UNAUTHENTICATED", err)
+			}
+		})
+	}
+
+	// Health checks stay reachable without a token.
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Health/Check without token: %v", err)
+	}
+}
+
+// TestSessionAuth logs in, calls the Greeter with the access token and
+// refreshes it, as a client of the Auth service would.
+func TestSessionAuth(t *testing.T) {
+	conn := startServer(t, nil)
+	authc, greeter := pb.NewAuthClient(conn), pb.NewGreeterClient(conn)
+	ctx := context.Background()
+
+	_, err := authc.Login(ctx, &pb.LoginRequest{Username: testUser, Password: "wrong"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Login with wrong password: got %v, want UNAUTHENTICATED", err)
+	}
+	_, err = authc.Login(ctx, &pb.LoginRequest{Username: testUser})
+	if v := statuserr.BadRequest(err); len(v) != 1 || v[0].GetField() != "password" {
+		t.Errorf("Login without password: got %v, want a violation of password", err)
+	}
+
+	tok, err := authc.Login(ctx, &pb.LoginRequest{Username: testUser, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := greeter.SayHello(authed(tok.AccessToken), &pb.HelloRequest{Name: "Alice"}); err != nil {
+		t.Errorf("SayHello with access token: %v", err)
+	}
+	stream, err := greeter.SayHelloStream(authed(tok.AccessToken), &pb.HelloStreamRequest{Name: "Alice", Count: 1})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if err != nil {
+		t.Errorf("SayHelloStream with access token: %v", err)
+	}
+	_, err = greeter.SayHello(authed(tok.RefreshToken), &pb.HelloRequest{Name: "Alice"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("SayHello with refresh token: got %v, want UNAUTHENTICATED", err)
+	}
+
+	refreshed, err := authc.Refresh(ctx, &pb.RefreshRequest{RefreshToken: tok.RefreshToken})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, err := greeter.SayHello(authed(refreshed.AccessToken), &pb.HelloRequest{Name: "Alice"}); err != nil {
+		t.Errorf("SayHello with refreshed token: %v", err)
+	}
+	_, err = greeter.SayHello(authed(tok.AccessToken), &pb.HelloRequest{Name: "Alice"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("SayHello with replaced token: got %v, want UNAUTHENTICATED", err)
+	}
+	_, err = authc.Refresh(ctx, &pb.RefreshRequest{RefreshToken: tok.RefreshToken})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("second Refresh with one token: got %v, want UNAUTHENTICATED", err)
+	}
+}
+
+// TestAuthz locks SayHelloStream down to the admin role through a policy
+// file and checks that only a user with that role may call it.
+func TestAuthz(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("methods:\n  /Greeter/SayHelloStream:\n    roles: [admin]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var sessions *session.Issuer
+	conn := startServer(t, func(cfg *serverConfig) {
+		sessions = session.NewIssuer(session.Config{
+			Users:      map[string]string{testUser: testPassword, "bob": "builder"},
+			Roles:      map[string][]string{testUser: {"admin"}},
+			AccessTTL:  time.Minute,
+			RefreshTTL: time.Hour,
+		})
+		cfg.sessions = sessions
+		cfg.auth.Verifier = sessions
+		authorizer, err := authz.New(authz.Config{PolicyFile: path, Claims: sessions.Claims, Exempt: cfg.auth.Exempt})
+		if err != nil {
+			t.Fatalf("authz.New: %v", err)
+		}
+		cfg.authz = authorizer
+	})
+	authc, greeter := pb.NewAuthClient(conn), pb.NewGreeterClient(conn)
+	streamCode := func(token string) codes.Code {
+		stream, err := greeter.SayHelloStream(authed(token), &pb.HelloStreamRequest{Name: "World", Count: 1})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		return status.Code(err)
+	}
+
+	alice, err := authc.Login(context.Background(), &pb.LoginRequest{Username: testUser, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Login alice: %v", err)
+	}
+	bob, err := authc.Login(context.Background(), &pb.LoginRequest{Username: "bob", Password: "builder"})
+	if err != nil {
+		t.Fatalf("Login bob: %v", err)
+	}
+	if got := streamCode(alice.AccessToken); got != codes.OK {
+		t.Errorf("SayHelloStream as admin: %v, want OK", got)
+	}
+	for name, token := range map[string]string{"user without role": bob.AccessToken, "static token": testToken} {
+		if got := streamCode(token); got != codes.PermissionDenied {
+			t.Errorf("SayHelloStream as %s: %v, want PERMISSION_DENIED", name, got)
+		}
+	}
+	// Methods without a rule stay open to every authenticated caller.
+	if _, err := greeter.SayHello(authed(bob.AccessToken), &pb.HelloRequest{Name: "Bob"}); err != nil {
+		t.Errorf("SayHello as user without role: %v", err)
+	}
+}
+
+// blockingProvider records the deadline of the first lookup and blocks
+// until its context is done.
+type blockingProvider struct {
+	deadline chan time.Time
+}
+
+func (p *blockingProvider) Greeting(ctx context.Context, _ string) (string, error) {
+	d, _ := ctx.Deadline()
+	p.deadline <- d
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+// TestAudit checks sampled and failed RPCs are recorded with redacted
+// payloads, and that unsampled successful ones are not.
+func TestAudit(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		sampleRate float64
+		wantCodes  []string
+	}{
+		{"All", 1, []string{"OK", "OK", "Unauthenticated"}},
+		{"FailuresOnly", 0, []string{"Unauthenticated"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := pb.NewGreeterClient(startServer(t, func(cfg *serverConfig) {
+				cfg.audit = interceptors.AuditConfig{
+					Sink:         interceptors.NewJSONAuditSink(&buf),
+					SampleRate:   tt.sampleRate,
+					RedactFields: []string{"name"},
+				}
+			}))
+
+			if _, err := c.SayHello(authed(testToken), &pb.HelloRequest{Name: "World", Language: "es"}); err != nil {
+				t.Fatalf("SayHello: %v", err)
+			}
+			stream, err := c.SayHelloStream(authed(testToken), &pb.HelloStreamRequest{Name: "World", Count: 1})
+			if err != nil {
+				t.Fatalf("SayHelloStream: %v", err)
+			}
+			for err == nil {
+				_, err = stream.Recv()
+			}
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("Recv: %v", err)
+			}
+			if _, err := c.SayHello(authed("wrong"), &pb.HelloRequest{Name: "World"}); status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("SayHello with a wrong token: %v", err)
+			}
+
+			var got []string
+			dec := json.NewDecoder(&buf)
+			for {
+				var r interceptors.AuditRecord
+				if err := dec.Decode(&r); errors.Is(err, io.EOF) {
+					break
+				} else if err != nil {
+					t.Fatalf("decode record: %v", err)
+				}
+				got = append(got, r.Code)
+				if strings.Contains(r.Request, "World") {
+					t.Errorf("%s record leaks a redacted field: %s", r.Method, r.Request)
+				}
+				if r.Method == "/Greeter/SayHello" && r.Code == "OK" && !strings.Contains(r.Response, "Hola") {
+					t.Errorf("SayHello record response = %q", r.Response)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantCodes) {
+				t.Errorf("recorded codes %v, want %v", got, tt.wantCodes)
+			}
+		})
+	}
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	provider := &blockingProvider{deadline: make(chan time.Time, 1)}
+	c := pb.NewGreeterClient(startServer(t, func(cfg *serverConfig) { cfg.greetings = provider }))
+
+	ctx, cancel := context.WithTimeout(authed(testToken), 100*time.Millisecond)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("SayHello: got %v, want DEADLINE_EXCEEDED", err)
+	}
+	select {
+	case got := <-provider.deadline:
+		// The deadline travels as a timeout, so it shifts by the time the
+		// request spent in flight.
+		if got.IsZero() || got.After(want.Add(50*time.Millisecond)) || got.Before(want.Add(-50*time.Millisecond)) {
+			t.Errorf("provider deadline = %v, want about %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("provider was not called")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	pbv2 "github.com/gnsalok/go-project-root/grpc-go/pb/v2"
+)
+
+// serverV2 implements Greeter v2 by translating its messages for the v1
+// server's shared greeting logic.
+type serverV2 struct {
+	pbv2.UnimplementedGreeterServer
+	core *server
+}
+
+func helloV2(in *pbv2.HelloRequest) hello {
+	return hello{name: in.GetName(), locale: in.GetLocale(), metadata: in.GetMetadata(), localeField: "locale"}
+}
+
+func (s *serverV2) SayHello(ctx context.Context, in *pbv2.HelloRequest) (*pbv2.HelloResponse, error) {
+	msg, err := s.core.greet(ctx, helloV2(in))
+	if err != nil {
+		return nil, err
+	}
+	return &pbv2.HelloResponse{Message: msg, Metadata: in.GetMetadata()}, nil
+}
+
+func (s *serverV2) SayHelloStream(in *pbv2.HelloStreamRequest, stream pbv2.Greeter_SayHelloStreamServer) error {
+	req := hello{name: in.GetName(), locale: in.GetLocale(), metadata: in.GetMetadata(), localeField: "locale"}
+	return s.core.greetStream(stream.Context(), req, in.GetCount(), func(msg string) error {
+		return stream.Send(&pbv2.HelloResponse{Message: msg, Metadata: in.GetMetadata()})
+	})
+}
+
+func (s *serverV2) SayHelloToAll(stream pbv2.Greeter_SayHelloToAllServer) error {
+	msg, first, err := s.core.greetAll(stream.Context(), func() (hello, error) {
+		in, err := stream.Recv()
+		return helloV2(in), err
+	})
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(&pbv2.HelloResponse{Message: msg, Metadata: first.metadata})
+}
+
+func (s *serverV2) BatchSayHello(ctx context.Context, in *pbv2.BatchHelloRequest) (*pbv2.BatchHelloResponse, error) {
+	req := hello{locale: in.GetLocale(), metadata: in.GetMetadata(), localeField: "locale"}
+	page, err := s.core.greetBatch(ctx, req, in.GetNames(), in.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	return &pbv2.BatchHelloResponse{Messages: page.messages, NextPageToken: page.nextToken,
+		Remaining: int32(page.remaining), Metadata: in.GetMetadata()}, nil
+}
+
+func (s *serverV2) Chat(stream pbv2.Greeter_ChatServer) error {
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pbv2.ChatMessage{Name: "server", Text: chatReply(in.Name, in.Text)}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	pbv2 "github.com/gnsalok/go-project-root/grpc-go/pb/v2"
+	"github.com/gnsalok/go-project-root/grpc-go/statuserr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestV2SayHello(t *testing.T) {
+	c := pbv2.NewGreeterClient(startServer(t, nil))
+
+	md := map[string]string{"request-id": "abc123"}
+	resp, err := c.SayHello(authed(testToken), &pbv2.HelloRequest{Name: "World", Locale: "pt-BR", Metadata: md})
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if resp.Message != "Olá World" {
+		t.Errorf("SayHello = %q, want %q", resp.Message, "Olá World")
+	}
+	if !reflect.DeepEqual(resp.Metadata, md) {
+		t.Errorf("metadata = %v, want %v", resp.Metadata, md)
+	}
+}
+
+func TestV2BatchSayHello(t *testing.T) {
+	c := pbv2.NewGreeterClient(startServer(t, nil))
+
+	md := map[string]string{"request-id": "abc123"}
+	resp, err := c.BatchSayHello(authed(testToken), &pbv2.BatchHelloRequest{Names: []string{"Ana", "Rui"}, Locale: "pt-BR", Metadata: md})
+	if err != nil {
+		t.Fatalf("BatchSayHello: %v", err)
+	}
+	if want := []string{"Olá Ana", "Olá Rui"}; !reflect.DeepEqual(resp.Messages, want) {
+		t.Errorf("BatchSayHello = %q, want %q", resp.Messages, want)
+	}
+	if !reflect.DeepEqual(resp.Metadata, md) {
+		t.Errorf("metadata = %v, want %v", resp.Metadata, md)
+	}
+}
+
+func TestV2SayHelloStream(t *testing.T) {
+	c := pbv2.NewGreeterClient(startServer(t, nil))
+
+	md := map[string]string{"k": "v"}
+	stream, err := c.SayHelloStream(authed(testToken), &pbv2.HelloStreamRequest{Name: "World", Count: 2, Locale: "es", Metadata: md})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	var got []string
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		if !reflect.DeepEqual(resp.Metadata, md) {
+			t.Errorf("metadata = %v, want %v", resp.Metadata, md)
+		}
+		got = append(got, resp.Message)
+	}
+	if want := []string{"Hola World (1/2)", "Hola World (2/2)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SayHelloStream = %q, want %q", got, want)
+	}
+}
+
+func TestV2SayHelloToAll(t *testing.T) {
+	c := pbv2.NewGreeterClient(startServer(t, nil))
+
+	stream, err := c.SayHelloToAll(authed(testToken))
+	if err != nil {
+		t.Fatalf("SayHelloToAll: %v", err)
+	}
+	for i, name := range []string{"Ana", "Bo"} {
+		md := map[string]string{"n": fmt.Sprint(i)}
+		if err := stream.Send(&pbv2.HelloRequest{Name: name, Locale: "es", Metadata: md}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv: %v", err)
+	}
+	if resp.Message != "Hola Ana, Bo" || resp.Metadata["n"] != "0" {
+		t.Errorf("SayHelloToAll = %q %v, want %q with the first request's metadata", resp.Message, resp.Metadata, "Hola Ana, Bo")
+	}
+}
+
+func TestV2Validation(t *testing.T) {
+	c := pbv2.NewGreeterClient(startServer(t, nil))
+
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxMetadataEntries; i++ {
+		tooMany[fmt.Sprintf("k%02d", i)] = "v"
+	}
+	for _, tt := range []struct {
+		name   string
+		req    *pbv2.HelloRequest
+		fields []string
+	}{
+		{"unknown locale", &pbv2.HelloRequest{Name: "World", Locale: "xx"}, []string{"locale"}},
+		{"long locale", &pbv2.HelloRequest{Name: "World", Locale: strings.Repeat("x", maxLanguageLength+1)}, []string{"locale"}},
+		{"too much metadata", &pbv2.HelloRequest{Name: "World", Metadata: tooMany}, []string{"metadata"}},
+		{"bad metadata entries", &pbv2.HelloRequest{Name: "World", Metadata: map[string]string{
+			"": "v",
+			strings.Repeat("k", maxMetadataKeyLength+1): "v",
+			"ok":   "v",
+			"long": strings.Repeat("v", maxMetadataValueLength+1),
+		}}, []string{`metadata[""]`, `metadata["` + strings.Repeat("k", maxMetadataKeyLength+1) + `"]`, `metadata["long"]`}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.SayHello(authed(testToken), tt.req)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("SayHello: got %v, want INVALID_ARGUMENT", err)
+			}
+			var fields []string
+			for _, v := range statuserr.BadRequest(err) {
+				fields = append(fields, v.GetField())
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("field violations = %q, want %q", fields, tt.fields)
+			}
+		})
+	}
+}
+
+// Both versions are served side by side and greet alike, since they
+// share one implementation.
+func TestV1AndV2Agree(t *testing.T) {
+	conn := startServer(t, nil)
+	v1, v2 := pb.NewGreeterClient(conn), pbv2.NewGreeterClient(conn)
+
+	for _, tt := range []struct{ name, locale string }{
+		{"World", ""},
+		{"World", "pt-BR"},
+		{"World", "xx"},
+		{" ", "es"},
+	} {
+		r1, err1 := v1.SayHello(authed(testToken), &pb.HelloRequest{Name: tt.name, Language: tt.locale})
+		r2, err2 := v2.SayHello(authed(testToken), &pbv2.HelloRequest{Name: tt.name, Locale: tt.locale})
+		if status.Code(err1) != status.Code(err2) || r1.GetMessage() != r2.GetMessage() {
+			t.Errorf("(%q, %q): v1 = %q, %v; v2 = %q, %v", tt.name, tt.locale, r1.GetMessage(), err1, r2.GetMessage(), err2)
+		}
+	}
+}
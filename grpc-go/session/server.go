@@ -0,0 +1,81 @@
+package session
+
+import (
+	"context"
+	"log"
+
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"github.com/gnsalok/go-project-root/grpc-go/statuserr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Methods are the Auth RPCs. Callers have no token yet, so they must be
+// exempted from service auth.
+var Methods = []string{
+	pb.Auth_Login_FullMethodName,
+	pb.Auth_Refresh_FullMethodName,
+}
+
+// Server implements the Auth service on top of an Issuer. Without any
+// users configured, Login refuses every call.
+type Server struct {
+	pb.UnimplementedAuthServer
+	issuer *Issuer
+}
+
+func NewServer(i *Issuer) *Server {
+	return &Server{issuer: i}
+}
+
+func (s *Server) Login(_ context.Context, in *pb.LoginRequest) (*pb.Token, error) {
+	if !s.issuer.cfg.Enabled() {
+		return nil, status.Error(codes.FailedPrecondition, "login is disabled; set GRPC_AUTH_USERS")
+	}
+	var v statuserr.FieldViolations
+	v.Check(in.GetUsername() != "", "username", "must not be empty")
+	v.Check(in.GetPassword() != "", "password", "must not be empty")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	t, ok, err := s.issuer.Login(in.GetUsername(), in.GetPassword())
+	if err != nil {
+		return nil, issueError(err)
+	}
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid username or password")
+	}
+	log.Printf("auth: %s logged in", in.GetUsername())
+	return tokenProto(t), nil
+}
+
+func (s *Server) Refresh(_ context.Context, in *pb.RefreshRequest) (*pb.Token, error) {
+	var v statuserr.FieldViolations
+	v.Check(in.GetRefreshToken() != "", "refresh_token", "must not be empty")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	t, ok, err := s.issuer.Refresh(in.GetRefreshToken())
+	if err != nil {
+		return nil, issueError(err)
+	}
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired refresh token")
+	}
+	return tokenProto(t), nil
+}
+
+func tokenProto(t Token) *pb.Token {
+	return &pb.Token{
+		AccessToken:      t.Access,
+		ExpiresAt:        timestamppb.New(t.ExpiresAt),
+		RefreshToken:     t.Refresh,
+		RefreshExpiresAt: timestamppb.New(t.RefreshExpiresAt),
+	}
+}
+
+func issueError(err error) error {
+	log.Printf("auth: issuing token: %v", err)
+	return status.Error(codes.Internal, "could not issue token")
+}
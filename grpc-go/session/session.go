@@ -0,0 +1,259 @@
+// Package session issues short-lived bearer tokens to users who log in
+// with a password. Server implements the Auth service; the Issuer it
+// wraps verifies the access tokens for the auth interceptors, tells quotas
+// which user a token belongs to, so refreshing does not reset them, and
+// gives the authz policy the roles and scopes the token was issued with.
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/authz"
+)
+
+// Config lists the users who may log in and how long their tokens last.
+type Config struct {
+	// Users maps usernames to passwords.
+	Users map[string]string
+	// Roles and Scopes map usernames to the claims of the tokens they are
+	// issued; see authz.
+	Roles  map[string][]string
+	Scopes map[string][]string
+	// AccessTTL is how long an access token authenticates calls, and
+	// RefreshTTL how long its refresh token can get a new pair.
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// DefaultConfig returns the token lifetimes used unless overridden, and no
+// users.
+func DefaultConfig() Config {
+	return Config{AccessTTL: 15 * time.Minute, RefreshTTL: 24 * time.Hour}
+}
+
+// ConfigFromEnv reads GRPC_AUTH_USERS, a comma-separated list of
+// username:password pairs, GRPC_AUTH_ROLES and GRPC_AUTH_SCOPES, lists of
+// username:role and username:scope pairs naming a user once per claim, and
+// GRPC_AUTH_ACCESS_TTL and GRPC_AUTH_REFRESH_TTL, durations like "15m".
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	for n, u := range strings.Split(os.Getenv("GRPC_AUTH_USERS"), ",") {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		name, password, ok := strings.Cut(u, ":")
+		if !ok || name == "" || password == "" {
+			// Not quoting the entry, which may hold a password.
+			return cfg, fmt.Errorf("GRPC_AUTH_USERS: entry %d is not username:password", n+1)
+		}
+		if cfg.Users == nil {
+			cfg.Users = make(map[string]string)
+		}
+		cfg.Users[name] = password
+	}
+	for _, c := range []struct {
+		env    string
+		claims *map[string][]string
+	}{
+		{"GRPC_AUTH_ROLES", &cfg.Roles},
+		{"GRPC_AUTH_SCOPES", &cfg.Scopes},
+	} {
+		for _, p := range strings.Split(os.Getenv(c.env), ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			name, claim, ok := strings.Cut(p, ":")
+			if !ok || name == "" || claim == "" {
+				return cfg, fmt.Errorf("%s: %q is not username:claim", c.env, p)
+			}
+			if *c.claims == nil {
+				*c.claims = make(map[string][]string)
+			}
+			(*c.claims)[name] = append((*c.claims)[name], claim)
+		}
+	}
+	for _, d := range []struct {
+		env string
+		ttl *time.Duration
+	}{
+		{"GRPC_AUTH_ACCESS_TTL", &cfg.AccessTTL},
+		{"GRPC_AUTH_REFRESH_TTL", &cfg.RefreshTTL},
+	} {
+		s := os.Getenv(d.env)
+		if s == "" {
+			continue
+		}
+		ttl, err := time.ParseDuration(s)
+		if err != nil || ttl <= 0 {
+			return cfg, fmt.Errorf("%s: %q is not a positive duration", d.env, s)
+		}
+		*d.ttl = ttl
+	}
+	return cfg, nil
+}
+
+// Enabled reports whether any user may log in.
+func (c Config) Enabled() bool { return len(c.Users) > 0 }
+
+// Token is a pair of access and refresh tokens issued to a user.
+type Token struct {
+	Access           string
+	ExpiresAt        time.Time
+	Refresh          string
+	RefreshExpiresAt time.Time
+}
+
+// grant is an issued token. pair is the key of the other token of its pair.
+// Claims are fixed when the token is issued.
+type grant struct {
+	user      string
+	claims    authz.Claims
+	refresh   bool
+	pair      string
+	expiresAt time.Time
+}
+
+// Issuer creates and checks the tokens of logged in users. Tokens are kept
+// in memory, so they are per replica and end with the process.
+type Issuer struct {
+	cfg Config
+	// now is replaced in tests.
+	now func() time.Time
+	mu  sync.Mutex
+	// grants is keyed by the SHA-256 of the token, so lookups do not leak
+	// tokens through timing.
+	grants map[string]grant
+}
+
+func NewIssuer(cfg Config) *Issuer {
+	return &Issuer{cfg: cfg, now: time.Now, grants: make(map[string]grant)}
+}
+
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Login issues a token pair to user if password is theirs. It reports
+// false for unknown users and wrong passwords alike.
+func (i *Issuer) Login(user, password string) (Token, bool, error) {
+	want, known := i.cfg.Users[user]
+	// Compare against something even for unknown users, so timing does not
+	// tell which users exist.
+	if !known {
+		want = "\x00"
+	}
+	if subtle.ConstantTimeCompare([]byte(password), []byte(want)) != 1 || !known {
+		return Token{}, false, nil
+	}
+	t, err := i.issue(user)
+	return t, err == nil, err
+}
+
+// Refresh revokes the refresh token and the access token issued with it,
+// and issues the same user a new pair. It reports false for unknown,
+// expired and already used refresh tokens.
+func (i *Issuer) Refresh(refreshToken string) (Token, bool, error) {
+	key := tokenKey(refreshToken)
+	i.mu.Lock()
+	g, ok := i.grants[key]
+	ok = ok && g.refresh && i.now().Before(g.expiresAt)
+	if ok {
+		delete(i.grants, key)
+		delete(i.grants, g.pair)
+	}
+	i.mu.Unlock()
+	if !ok {
+		return Token{}, false, nil
+	}
+	t, err := i.issue(g.user)
+	return t, err == nil, err
+}
+
+func (i *Issuer) issue(user string) (Token, error) {
+	access, err := newToken()
+	if err != nil {
+		return Token{}, err
+	}
+	refresh, err := newToken()
+	if err != nil {
+		return Token{}, err
+	}
+	now := i.now()
+	t := Token{
+		Access:           access,
+		ExpiresAt:        now.Add(i.cfg.AccessTTL).UTC(),
+		Refresh:          refresh,
+		RefreshExpiresAt: now.Add(i.cfg.RefreshTTL).UTC(),
+	}
+	accessKey, refreshKey := tokenKey(access), tokenKey(refresh)
+	claims := authz.Claims{Roles: i.cfg.Roles[user], Scopes: i.cfg.Scopes[user]}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	// Drop expired grants as new ones come in, so they do not pile up.
+	for key, g := range i.grants {
+		if !now.Before(g.expiresAt) {
+			delete(i.grants, key)
+		}
+	}
+	i.grants[accessKey] = grant{user: user, claims: claims, pair: refreshKey, expiresAt: t.ExpiresAt}
+	i.grants[refreshKey] = grant{user: user, refresh: true, pair: accessKey, expiresAt: t.RefreshExpiresAt}
+	return t, nil
+}
+
+// User returns the user an unexpired access token was issued to.
+func (i *Issuer) User(accessToken string) (string, bool) {
+	g, ok := i.access(accessToken)
+	return g.user, ok
+}
+
+// Claims returns the roles and scopes of an unexpired access token. It
+// fits authz.Config.Claims.
+func (i *Issuer) Claims(accessToken string) (authz.Claims, bool) {
+	g, ok := i.access(accessToken)
+	return g.claims, ok
+}
+
+func (i *Issuer) access(accessToken string) (grant, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	g, ok := i.grants[tokenKey(accessToken)]
+	if !ok || g.refresh || !i.now().Before(g.expiresAt) {
+		return grant{}, false
+	}
+	return g, true
+}
+
+// VerifyToken reports whether token is an unexpired access token, making
+// the Issuer an interceptors.TokenVerifier.
+func (i *Issuer) VerifyToken(token string) bool {
+	_, ok := i.User(token)
+	return ok
+}
+
+// QuotaClient returns the quota client ID of an access token: "user:"
+// followed by its user, so that a user keeps their quota across refreshes.
+// It fits quota.Config.Identify.
+func (i *Issuer) QuotaClient(accessToken string) (string, bool) {
+	user, ok := i.User(accessToken)
+	if !ok {
+		return "", false
+	}
+	return "user:" + user, true
+}
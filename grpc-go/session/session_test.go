@@ -0,0 +1,123 @@
+package session
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestIssuer(now *time.Time) *Issuer {
+	i := NewIssuer(Config{
+		Users:      map[string]string{"alice": "wonderland"},
+		Roles:      map[string][]string{"alice": {"admin"}},
+		Scopes:     map[string][]string{"alice": {"greeter.v2"}},
+		AccessTTL:  time.Minute,
+		RefreshTTL: time.Hour,
+	})
+	i.now = func() time.Time { return *now }
+	return i
+}
+
+func TestLogin(t *testing.T) {
+	now := time.Now()
+	i := newTestIssuer(&now)
+
+	for _, tt := range []struct{ user, password string }{
+		{"alice", "wrong"},
+		{"bob", "wonderland"},
+		{"alice", ""},
+	} {
+		if _, ok, err := i.Login(tt.user, tt.password); ok || err != nil {
+			t.Errorf("Login(%q, %q) = %t, %v; want false", tt.user, tt.password, ok, err)
+		}
+	}
+
+	tok, ok, err := i.Login("alice", "wonderland")
+	if !ok || err != nil {
+		t.Fatalf("Login = %t, %v", ok, err)
+	}
+	if user, ok := i.User(tok.Access); !ok || user != "alice" {
+		t.Errorf("User(access) = %q, %t; want alice", user, ok)
+	}
+	if i.VerifyToken(tok.Refresh) {
+		t.Error("refresh token accepted as access token")
+	}
+	if client, _ := i.QuotaClient(tok.Access); client != "user:alice" {
+		t.Errorf("QuotaClient = %q, want user:alice", client)
+	}
+	if claims, ok := i.Claims(tok.Access); !ok || !slices.Equal(claims.Roles, []string{"admin"}) || !slices.Equal(claims.Scopes, []string{"greeter.v2"}) {
+		t.Errorf("Claims(access) = %+v, %t; want role admin and scope greeter.v2", claims, ok)
+	}
+	if _, ok := i.Claims(tok.Refresh); ok {
+		t.Error("refresh token has claims")
+	}
+
+	now = now.Add(time.Minute)
+	if i.VerifyToken(tok.Access) {
+		t.Error("access token accepted after AccessTTL")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	now := time.Now()
+	i := newTestIssuer(&now)
+	first, _, _ := i.Login("alice", "wonderland")
+
+	second, ok, err := i.Refresh(first.Refresh)
+	if !ok || err != nil {
+		t.Fatalf("Refresh = %t, %v", ok, err)
+	}
+	if !i.VerifyToken(second.Access) {
+		t.Error("refreshed access token rejected")
+	}
+	// The old pair is revoked, so a stolen refresh token works only once.
+	if i.VerifyToken(first.Access) {
+		t.Error("old access token accepted after refresh")
+	}
+	if _, ok, _ := i.Refresh(first.Refresh); ok {
+		t.Error("refresh token accepted twice")
+	}
+	if _, ok, _ := i.Refresh(second.Access); ok {
+		t.Error("access token accepted as refresh token")
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok, _ := i.Refresh(second.Refresh); ok {
+		t.Error("refresh token accepted after RefreshTTL")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("GRPC_AUTH_USERS", "alice:wonderland, bob:pa:ss")
+	t.Setenv("GRPC_AUTH_ACCESS_TTL", "5m")
+	t.Setenv("GRPC_AUTH_ROLES", "alice:admin, alice:batch")
+	t.Setenv("GRPC_AUTH_SCOPES", "bob:greeter.v2")
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %v", err)
+	}
+	if cfg.Users["alice"] != "wonderland" || cfg.Users["bob"] != "pa:ss" {
+		t.Errorf("Users = %v", cfg.Users)
+	}
+	if cfg.AccessTTL != 5*time.Minute || cfg.RefreshTTL != DefaultConfig().RefreshTTL {
+		t.Errorf("TTLs = %v, %v; want 5m and the default", cfg.AccessTTL, cfg.RefreshTTL)
+	}
+	if !slices.Equal(cfg.Roles["alice"], []string{"admin", "batch"}) || !slices.Equal(cfg.Scopes["bob"], []string{"greeter.v2"}) {
+		t.Errorf("Roles = %v, Scopes = %v", cfg.Roles, cfg.Scopes)
+	}
+
+	for _, env := range [][2]string{
+		{"GRPC_AUTH_USERS", "alice"},
+		{"GRPC_AUTH_USERS", ":secret"},
+		{"GRPC_AUTH_REFRESH_TTL", "0s"},
+		{"GRPC_AUTH_ROLES", "admin"},
+	} {
+		t.Run(env[0]+"="+env[1], func(t *testing.T) {
+			t.Setenv("GRPC_AUTH_USERS", "")
+			t.Setenv(env[0], env[1])
+			if _, err := ConfigFromEnv(); err == nil {
+				t.Error("ConfigFromEnv succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// Package statuserr builds gRPC status errors carrying google.rpc error
+// details, and reads them back on the client side.
+package statuserr
+
+import (
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// FieldViolations collects invalid request fields. The zero value is ready
+// to use.
+type FieldViolations struct {
+	violations []*errdetails.BadRequest_FieldViolation
+}
+
+// Add records that field is invalid. Nested fields use dot paths, e.g.
+// "address.city".
+func (f *FieldViolations) Add(field, description string) {
+	f.violations = append(f.violations, &errdetails.BadRequest_FieldViolation{Field: field, Description: description})
+}
+
+// Check adds the violation unless ok.
+func (f *FieldViolations) Check(ok bool, field, description string) {
+	if !ok {
+		f.Add(field, description)
+	}
+}
+
+// Err returns an INVALID_ARGUMENT error with a google.rpc.BadRequest
+// detail listing every violation, or nil if there are none.
+func (f *FieldViolations) Err() error {
+	if len(f.violations) == 0 {
+		return nil
+	}
+	return withDetails(codes.InvalidArgument, "invalid request", &errdetails.BadRequest{FieldViolations: f.violations})
+}
+
+// NotFound returns a NOT_FOUND error with a google.rpc.ResourceInfo detail.
+func NotFound(resourceType, name string) error {
+	return withDetails(codes.NotFound, resourceType+" "+name+" not found",
+		&errdetails.ResourceInfo{ResourceType: resourceType, ResourceName: name})
+}
+
+// Unavailable returns an UNAVAILABLE error with a google.rpc.RetryInfo
+// detail telling clients how long to wait before retrying.
+func Unavailable(msg string, retryDelay time.Duration) error {
+	return withDetails(codes.Unavailable, msg, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)})
+}
+
+// QuotaExhausted returns a RESOURCE_EXHAUSTED error with a
+// google.rpc.QuotaFailure detail naming the exhausted quota and a
+// google.rpc.RetryInfo detail saying when it resets.
+func QuotaExhausted(subject, description string, retryDelay time.Duration) error {
+	return withDetails(codes.ResourceExhausted, description,
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{Subject: subject, Description: description}}},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)})
+}
+
+// withDetails attaches details to a new status. Attaching only fails for
+// an OK code, which callers never pass.
+func withDetails(code codes.Code, msg string, details ...protoadapt.MessageV1) error {
+	st, err := status.New(code, msg).WithDetails(details...)
+	if err != nil {
+		return status.Error(code, msg)
+	}
+	return st.Err()
+}
+
+// BadRequest returns the field violations attached to err, or nil.
+func BadRequest(err error) []*errdetails.BadRequest_FieldViolation {
+	for _, d := range status.Convert(err).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			return br.GetFieldViolations()
+		}
+	}
+	return nil
+}
+
+// RetryDelay returns the delay from a google.rpc.RetryInfo detail on err.
+func RetryDelay(err error) (time.Duration, bool) {
+	for _, d := range status.Convert(err).Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			return ri.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,120 @@
+//go:build ignore
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gnsalok/go-project-root/grpc-go/pb"
+	"github.com/gnsalok/go-project-root/grpc-go/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Exercises the three streaming RPCs of the Greeter service:
+//
+//	go run streaming_client.go
+func main() {
+	creds, err := tlsconfig.ClientConfigFromEnv().Credentials()
+	if err != nil {
+		log.Fatalf("failed to load credentials: %v", err)
+	}
+	conn, err := grpc.NewClient("localhost:50051", grpc.WithTransportCredentials(creds))
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	c := pb.NewGreeterClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if token := os.Getenv("GRPC_AUTH_TOKEN"); token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+
+	if err := serverStreaming(ctx, c); err != nil {
+		log.Fatalf("SayHelloStream: %v", err)
+	}
+	if err := clientStreaming(ctx, c); err != nil {
+		log.Fatalf("SayHelloToAll: %v", err)
+	}
+	if err := bidiStreaming(ctx, c); err != nil {
+		log.Fatalf("Chat: %v", err)
+	}
+}
+
+// serverStreaming receives until the server ends the stream with io.EOF.
+func serverStreaming(ctx context.Context, c pb.GreeterClient) error {
+	stream, err := c.SayHelloStream(ctx, &pb.HelloStreamRequest{Name: "World", Count: 3})
+	if err != nil {
+		return err
+	}
+	for {
+		r, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("SayHelloStream: %s", r.GetMessage())
+	}
+}
+
+// clientStreaming sends several names, then closes its side to get the
+// single response.
+func clientStreaming(ctx context.Context, c pb.GreeterClient) error {
+	stream, err := c.SayHelloToAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
+			return err
+		}
+	}
+	r, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	log.Printf("SayHelloToAll: %s", r.GetMessage())
+	return nil
+}
+
+// bidiStreaming sends and receives concurrently: replies are read in a
+// goroutine while messages are still being sent.
+func bidiStreaming(ctx context.Context, c pb.GreeterClient) error {
+	stream, err := c.Chat(ctx)
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		for {
+			r, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				done <- nil
+				return
+			}
+			if err != nil {
+				done <- err
+				return
+			}
+			log.Printf("Chat: %s: %s", r.GetName(), r.GetText())
+		}
+	}()
+	for _, text := range []string{"hi", "how are you?", "bye"} {
+		if err := stream.Send(&pb.ChatMessage{Name: "World", Text: text}); err != nil {
+			return err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	return <-done
+}
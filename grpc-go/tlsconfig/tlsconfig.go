@@ -0,0 +1,130 @@
+// Package tlsconfig builds gRPC transport credentials for the Greeter
+// server and clients. TLS is the default; plaintext must be requested
+// explicitly with Insecure.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ServerConfig locates the server's key pair and, for mutual TLS, the CA
+// that client certificates must chain to.
+type ServerConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mutual TLS: clients must present a certificate
+	// signed by this CA.
+	ClientCAFile string
+	// Insecure serves plaintext; meant for local development only.
+	Insecure bool
+}
+
+// ServerConfigFromEnv reads GRPC_TLS_CERT, GRPC_TLS_KEY, GRPC_TLS_CLIENT_CA
+// and GRPC_INSECURE.
+func ServerConfigFromEnv() ServerConfig {
+	insecure, _ := strconv.ParseBool(os.Getenv("GRPC_INSECURE"))
+	return ServerConfig{
+		CertFile:     os.Getenv("GRPC_TLS_CERT"),
+		KeyFile:      os.Getenv("GRPC_TLS_KEY"),
+		ClientCAFile: os.Getenv("GRPC_TLS_CLIENT_CA"),
+		Insecure:     insecure,
+	}
+}
+
+// Credentials returns the transport credentials for grpc.Creds.
+func (c ServerConfig) Credentials() (credentials.TransportCredentials, error) {
+	if c.Insecure {
+		if c.CertFile != "" || c.ClientCAFile != "" {
+			return nil, errors.New("insecure mode cannot be combined with TLS files")
+		}
+		return insecure.NewCredentials(), nil
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("a TLS certificate and key are required; enable insecure mode for plaintext")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server key pair: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.ClientCAFile != "" {
+		if cfg.ClientCAs, err = loadPool(c.ClientCAFile); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// ClientConfig configures how a client verifies the server and, for
+// mutual TLS, which certificate it presents.
+type ClientConfig struct {
+	// CAFile verifies the server; empty uses the system roots.
+	CAFile string
+	// CertFile and KeyFile are the client certificate for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name checked against the server certificate.
+	ServerName string
+	// Insecure connects over plaintext.
+	Insecure bool
+}
+
+// ClientConfigFromEnv reads GRPC_TLS_CA, GRPC_TLS_CERT, GRPC_TLS_KEY,
+// GRPC_TLS_SERVER_NAME and GRPC_INSECURE.
+func ClientConfigFromEnv() ClientConfig {
+	insecure, _ := strconv.ParseBool(os.Getenv("GRPC_INSECURE"))
+	return ClientConfig{
+		CAFile:     os.Getenv("GRPC_TLS_CA"),
+		CertFile:   os.Getenv("GRPC_TLS_CERT"),
+		KeyFile:    os.Getenv("GRPC_TLS_KEY"),
+		ServerName: os.Getenv("GRPC_TLS_SERVER_NAME"),
+		Insecure:   insecure,
+	}
+}
+
+// Credentials returns the transport credentials for
+// grpc.WithTransportCredentials.
+func (c ClientConfig) Credentials() (credentials.TransportCredentials, error) {
+	if c.Insecure {
+		return insecure.NewCredentials(), nil
+	}
+	cfg := &tls.Config{ServerName: c.ServerName, MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		var err error
+		if cfg.RootCAs, err = loadPool(c.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+func loadPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", file)
+	}
+	return pool, nil
+}
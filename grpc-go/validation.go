@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gnsalok/go-project-root/grpc-go/statuserr"
+)
+
+// maxNameLength caps names in characters, not bytes.
+const maxNameLength = 100
+
+// maxLanguageLength is the longest BCP 47 tag worth looking up.
+const maxLanguageLength = 35
+
+func checkName(v *statuserr.FieldViolations, field, name string) {
+	v.Check(strings.TrimSpace(name) != "", field, "must not be empty")
+	v.Check(utf8.RuneCountInString(name) <= maxNameLength, field, fmt.Sprintf("must be at most %d characters", maxNameLength))
+}
+
+// maxMetadataEntries, maxMetadataKeyLength and maxMetadataValueLength cap
+// v2 request metadata; keys and values are counted in characters.
+const (
+	maxMetadataEntries     = 16
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 256
+)
+
+func checkLocale(v *statuserr.FieldViolations, field, locale string) {
+	v.Check(len(locale) <= maxLanguageLength, field, fmt.Sprintf("must be at most %d characters", maxLanguageLength))
+}
+
+// checkMetadata reports at most one violation per key, in key order.
+func checkMetadata(v *statuserr.FieldViolations, metadata map[string]string) {
+	v.Check(len(metadata) <= maxMetadataEntries, "metadata", fmt.Sprintf("must have at most %d entries", maxMetadataEntries))
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		field := fmt.Sprintf("metadata[%q]", k)
+		switch {
+		case strings.TrimSpace(k) == "":
+			v.Add(field, "key must not be empty")
+		case utf8.RuneCountInString(k) > maxMetadataKeyLength:
+			v.Add(field, fmt.Sprintf("key must be at most %d characters", maxMetadataKeyLength))
+		case utf8.RuneCountInString(metadata[k]) > maxMetadataValueLength:
+			v.Add(field, fmt.Sprintf("value must be at most %d characters", maxMetadataValueLength))
+		}
+	}
+}
+
+func validateHello(in hello) error {
+	var v statuserr.FieldViolations
+	checkName(&v, "name", in.name)
+	checkLocale(&v, in.localeField, in.locale)
+	checkMetadata(&v, in.metadata)
+	return v.Err()
+}
+
+func validateHelloStream(in hello, count int32) error {
+	var v statuserr.FieldViolations
+	checkName(&v, "name", in.name)
+	checkLocale(&v, in.localeField, in.locale)
+	checkMetadata(&v, in.metadata)
+	v.Check(count >= 1 && count <= maxStreamGreetings, "count",
+		fmt.Sprintf("must be between 1 and %d", maxStreamGreetings))
+	return v.Err()
+}
+
+// maxBatchNames caps the names accepted by BatchSayHello.
+const maxBatchNames = 1000
+
+// validateBatch also checks pageToken against the batch with digest and
+// returns the offset it resumes at.
+func validateBatch(in hello, names []string, pageToken, digest string) (int, error) {
+	var v statuserr.FieldViolations
+	v.Check(len(names) >= 1 && len(names) <= maxBatchNames, "names",
+		fmt.Sprintf("must have between 1 and %d names", maxBatchNames))
+	for i, name := range names {
+		checkName(&v, fmt.Sprintf("names[%d]", i), name)
+	}
+	checkLocale(&v, in.localeField, in.locale)
+	checkMetadata(&v, in.metadata)
+	var offset int
+	if pageToken != "" {
+		var ok bool
+		offset, ok = decodePageToken(pageToken, digest)
+		v.Check(ok && offset > 0 && offset < len(names), "page_token", "must be the next_page_token of this request")
+	}
+	return offset, v.Err()
+}
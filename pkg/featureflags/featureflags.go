@@ -0,0 +1,272 @@
+// Package featureflags provides runtime-toggleable feature flags shared by the
+// projects in this repository. Flags are registered with a default value and
+// can be overridden from environment variables, a JSON file, or an HTTP admin
+// endpoint while the process is running.
+package featureflags
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownFlag is returned when a flag name has not been registered.
+	ErrUnknownFlag = errors.New("unknown feature flag")
+)
+
+// Kind describes the type of value held by a flag.
+type Kind string
+
+const (
+	KindBool     Kind = "bool"
+	KindString   Kind = "string"
+	KindInt      Kind = "int"
+	KindDuration Kind = "duration"
+)
+
+// Change describes an update to a flag's value.
+type Change struct {
+	Name     string `json:"name"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+	Source   string `json:"source"`
+}
+
+// Info is a snapshot of a registered flag.
+type Info struct {
+	Name        string `json:"name"`
+	Kind        Kind   `json:"kind"`
+	Value       string `json:"value"`
+	Default     string `json:"default"`
+	Description string `json:"description"`
+	Source      string `json:"source"`
+}
+
+type flag struct {
+	info     Info
+	validate func(string) error
+}
+
+// Registry holds a set of flags and their current values.
+type Registry struct {
+	mu        sync.RWMutex
+	flags     map[string]*flag
+	listeners map[string][]func(Change)
+	global    []func(Change)
+}
+
+// Default is the process-wide registry used by the package-level helpers.
+var Default = New()
+
+// New creates an empty Registry.
+func New() *Registry {
+	return &Registry{
+		flags:     make(map[string]*flag),
+		listeners: make(map[string][]func(Change)),
+	}
+}
+
+func (r *Registry) register(name string, kind Kind, def, description string, validate func(string) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.flags[name]; exists {
+		panic(fmt.Sprintf("featureflags: flag %q registered twice", name))
+	}
+	r.flags[name] = &flag{
+		info: Info{
+			Name:        name,
+			Kind:        kind,
+			Value:       def,
+			Default:     def,
+			Description: description,
+			Source:      "default",
+		},
+		validate: validate,
+	}
+}
+
+func (r *Registry) value(name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.flags[name].info.Value
+}
+
+// Set updates the value of a registered flag. The value is validated against
+// the flag's kind and listeners are notified if it changed.
+func (r *Registry) Set(name, value, source string) error {
+	r.mu.Lock()
+	f, exists := r.flags[name]
+	if !exists {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+	if err := f.validate(value); err != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("invalid value for %s: %w", name, err)
+	}
+	old := f.info.Value
+	f.info.Value = value
+	f.info.Source = source
+	listeners := append(append([]func(Change){}, r.global...), r.listeners[name]...)
+	r.mu.Unlock()
+
+	if old == value {
+		return nil
+	}
+	change := Change{Name: name, OldValue: old, NewValue: value, Source: source}
+	for _, fn := range listeners {
+		fn(change)
+	}
+	return nil
+}
+
+// Reset restores a flag to its default value.
+func (r *Registry) Reset(name string) error {
+	r.mu.RLock()
+	f, exists := r.flags[name]
+	r.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+	return r.Set(name, f.info.Default, "default")
+}
+
+// Get returns a snapshot of a single flag.
+func (r *Registry) Get(name string) (Info, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, exists := r.flags[name]
+	if !exists {
+		return Info{}, fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+	return f.info, nil
+}
+
+// List returns a snapshot of every registered flag sorted by name.
+func (r *Registry) List() []Info {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	infos := make([]Info, 0, len(r.flags))
+	for _, f := range r.flags {
+		infos = append(infos, f.info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// OnChange registers fn to be called whenever the named flag changes value.
+// An empty name subscribes to changes of every flag.
+func (r *Registry) OnChange(name string, fn func(Change)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == "" {
+		r.global = append(r.global, fn)
+		return
+	}
+	r.listeners[name] = append(r.listeners[name], fn)
+}
+
+// BoolFlag is a typed accessor for a boolean flag.
+type BoolFlag struct {
+	r    *Registry
+	name string
+}
+
+// Bool registers a boolean flag.
+func (r *Registry) Bool(name string, def bool, description string) *BoolFlag {
+	r.register(name, KindBool, strconv.FormatBool(def), description, func(v string) error {
+		_, err := strconv.ParseBool(v)
+		return err
+	})
+	return &BoolFlag{r: r, name: name}
+}
+
+// Enabled reports the current value of the flag.
+func (f *BoolFlag) Enabled() bool {
+	v, _ := strconv.ParseBool(f.r.value(f.name))
+	return v
+}
+
+// Name returns the registered flag name.
+func (f *BoolFlag) Name() string { return f.name }
+
+// StringFlag is a typed accessor for a string flag.
+type StringFlag struct {
+	r    *Registry
+	name string
+}
+
+// String registers a string flag. If allowed is non-empty the flag only
+// accepts one of the listed values.
+func (r *Registry) String(name, def, description string, allowed ...string) *StringFlag {
+	r.register(name, KindString, def, description, func(v string) error {
+		if len(allowed) == 0 {
+			return nil
+		}
+		for _, a := range allowed {
+			if v == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %v", allowed)
+	})
+	return &StringFlag{r: r, name: name}
+}
+
+// Value reports the current value of the flag.
+func (f *StringFlag) Value() string { return f.r.value(f.name) }
+
+// Name returns the registered flag name.
+func (f *StringFlag) Name() string { return f.name }
+
+// IntFlag is a typed accessor for an integer flag.
+type IntFlag struct {
+	r    *Registry
+	name string
+}
+
+// Int registers an integer flag.
+func (r *Registry) Int(name string, def int, description string) *IntFlag {
+	r.register(name, KindInt, strconv.Itoa(def), description, func(v string) error {
+		_, err := strconv.Atoi(v)
+		return err
+	})
+	return &IntFlag{r: r, name: name}
+}
+
+// Value reports the current value of the flag.
+func (f *IntFlag) Value() int {
+	v, _ := strconv.Atoi(f.r.value(f.name))
+	return v
+}
+
+// Name returns the registered flag name.
+func (f *IntFlag) Name() string { return f.name }
+
+// DurationFlag is a typed accessor for a time.Duration flag.
+type DurationFlag struct {
+	r    *Registry
+	name string
+}
+
+// Duration registers a duration flag.
+func (r *Registry) Duration(name string, def time.Duration, description string) *DurationFlag {
+	r.register(name, KindDuration, def.String(), description, func(v string) error {
+		_, err := time.ParseDuration(v)
+		return err
+	})
+	return &DurationFlag{r: r, name: name}
+}
+
+// Value reports the current value of the flag.
+func (f *DurationFlag) Value() time.Duration {
+	v, _ := time.ParseDuration(f.r.value(f.name))
+	return v
+}
+
+// Name returns the registered flag name.
+func (f *DurationFlag) Name() string { return f.name }
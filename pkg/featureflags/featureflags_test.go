@@ -0,0 +1,93 @@
+package featureflags_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gnsalok/go-projects-root/pkg/featureflags"
+)
+
+// newRegistry returns a registry with one flag of every kind.
+func newRegistry() *featureflags.Registry {
+	r := featureflags.New()
+	r.Bool("log.bodies", false, "")
+	r.String("propagation.mode", "all", "", "all", "mapped")
+	r.Int("batch.size", 100, "")
+	r.Duration("sync.interval", time.Minute, "")
+	return r
+}
+
+// TestSet checks values are validated against the flag's kind.
+func TestSet(t *testing.T) {
+	testCases := []struct {
+		name, flag, value string
+		wantErr           bool
+		unknown           bool
+	}{
+		{name: "bool", flag: "log.bodies", value: "true"},
+		{name: "invalid bool", flag: "log.bodies", value: "yes please", wantErr: true},
+		{name: "allowed string", flag: "propagation.mode", value: "mapped"},
+		{name: "disallowed string", flag: "propagation.mode", value: "none", wantErr: true},
+		{name: "int", flag: "batch.size", value: "1000000"},
+		{name: "float as int", flag: "batch.size", value: "1e+06", wantErr: true},
+		{name: "duration", flag: "sync.interval", value: "90s"},
+		{name: "invalid duration", flag: "sync.interval", value: "90", wantErr: true},
+		{name: "unknown flag", flag: "no.such.flag", value: "1", wantErr: true, unknown: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newRegistry()
+			err := r.Set(tc.flag, tc.value, "test")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Set(%q, %q) error = %v, want error %v", tc.flag, tc.value, err, tc.wantErr)
+			}
+			if errors.Is(err, featureflags.ErrUnknownFlag) != tc.unknown {
+				t.Fatalf("Set(%q) error = %v, want ErrUnknownFlag %v", tc.flag, err, tc.unknown)
+			}
+			if err != nil {
+				return
+			}
+			info, err := r.Get(tc.flag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Value != tc.value || info.Source != "test" {
+				t.Errorf("Get(%q) = %q from %q, want %q from test", tc.flag, info.Value, info.Source, tc.value)
+			}
+		})
+	}
+}
+
+// TestOnChange checks listeners only hear about changed values, and Reset
+// restores the default.
+func TestOnChange(t *testing.T) {
+	r := featureflags.New()
+	size := r.Int("batch.size", 100, "")
+	var changes []featureflags.Change
+	r.OnChange("batch.size", func(c featureflags.Change) { changes = append(changes, c) })
+
+	for _, v := range []string{"200", "200"} {
+		if err := r.Set("batch.size", v, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Reset("batch.size"); err != nil {
+		t.Fatal(err)
+	}
+	want := []featureflags.Change{
+		{Name: "batch.size", OldValue: "100", NewValue: "200", Source: "test"},
+		{Name: "batch.size", OldValue: "200", NewValue: "100", Source: "default"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes %v, want %v", len(changes), changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+	if size.Value() != 100 {
+		t.Errorf("Value() = %d after Reset, want 100", size.Value())
+	}
+}
@@ -0,0 +1,71 @@
+package featureflags
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type setRequest struct {
+	Value *string `json:"value"`
+}
+
+// Handler returns an admin http.Handler for inspecting and toggling flags.
+// It is meant to be mounted under a prefix with http.StripPrefix:
+//
+//	GET    /        list all flags
+//	GET    /{name}  show a single flag
+//	PUT    /{name}  set a flag, body {"value": "..."}
+//	DELETE /{name}  reset a flag to its default
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.Trim(req.URL.Path, "/")
+		if name == "" {
+			if req.Method != http.MethodGet {
+				writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+				return
+			}
+			writeJSON(w, http.StatusOK, r.List())
+			return
+		}
+
+		var err error
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var body setRequest
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Value == nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": `body must be {"value": "..."}`})
+				return
+			}
+			err = r.Set(name, *body.Value, "admin")
+		case http.MethodDelete:
+			err = r.Reset(name)
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrUnknownFlag) {
+				status = http.StatusNotFound
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+
+		info, err := r.Get(name)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,74 @@
+package featureflags_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gnsalok/go-projects-root/pkg/featureflags"
+)
+
+// TestHandler checks flags can be listed, read, set and reset over HTTP.
+func TestHandler(t *testing.T) {
+	testCases := []struct {
+		name, method, path, body string
+		// set is the batch.size value before the request, if not the default.
+		set        string
+		wantStatus int
+		wantValue  string
+	}{
+		{name: "get", method: http.MethodGet, path: "/batch.size", wantStatus: http.StatusOK, wantValue: "100"},
+		{name: "set", method: http.MethodPut, path: "/batch.size", body: `{"value": "250"}`, wantStatus: http.StatusOK, wantValue: "250"},
+		{name: "set invalid", method: http.MethodPut, path: "/batch.size", body: `{"value": "many"}`, wantStatus: http.StatusBadRequest},
+		{name: "set without value", method: http.MethodPut, path: "/batch.size", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "reset", method: http.MethodDelete, path: "/batch.size", set: "300", wantStatus: http.StatusOK, wantValue: "100"},
+		{name: "unknown", method: http.MethodGet, path: "/no.such.flag", wantStatus: http.StatusNotFound},
+		{name: "set unknown", method: http.MethodPut, path: "/no.such.flag", body: `{"value": "1"}`, wantStatus: http.StatusNotFound},
+		{name: "patch", method: http.MethodPatch, path: "/batch.size", wantStatus: http.StatusMethodNotAllowed},
+		{name: "post to list", method: http.MethodPost, path: "/", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newRegistry()
+			if tc.set != "" {
+				if err := r.Set("batch.size", tc.set, "test"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			rr := httptest.NewRecorder()
+			r.Handler().ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tc.wantStatus, rr.Body)
+			}
+			if tc.wantValue == "" {
+				return
+			}
+			var info featureflags.Info
+			if err := json.NewDecoder(rr.Body).Decode(&info); err != nil {
+				t.Fatal(err)
+			}
+			if info.Value != tc.wantValue {
+				t.Errorf("value = %q, want %q", info.Value, tc.wantValue)
+			}
+		})
+	}
+}
+
+// TestHandlerList checks the root lists every flag, sorted by name.
+func TestHandlerList(t *testing.T) {
+	rr := httptest.NewRecorder()
+	newRegistry().Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	var infos []featureflags.Info
+	if err := json.NewDecoder(rr.Body).Decode(&infos); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	if got, want := strings.Join(names, ","), "batch.size,log.bodies,propagation.mode,sync.interval"; got != want {
+		t.Errorf("names = %s, want %s", got, want)
+	}
+}
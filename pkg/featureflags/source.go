@@ -0,0 +1,88 @@
+package featureflags
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// EnvName returns the environment variable consulted for a flag, e.g. the
+// flag "dcreds.propagation.mode" with prefix "FF" maps to
+// FF_DCREDS_PROPAGATION_MODE.
+func EnvName(prefix, name string) string {
+	key := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+	if prefix == "" {
+		return key
+	}
+	return strings.ToUpper(prefix) + "_" + key
+}
+
+// LoadEnv overrides registered flags from environment variables.
+func (r *Registry) LoadEnv(prefix string) error {
+	var errs []error
+	for _, info := range r.List() {
+		value, ok := os.LookupEnv(EnvName(prefix, info.Name))
+		if !ok {
+			continue
+		}
+		if err := r.Set(info.Name, value, "env"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LoadFile overrides registered flags from a JSON object mapping flag names
+// to values. Values may be JSON strings, numbers, or booleans.
+func (r *Registry) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Numbers are kept as written; decoded as float64 they would print
+	// as e.g. 1e+06, which integer flags reject.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if dec.More() {
+		return fmt.Errorf("parse %s: unexpected data after the JSON object", path)
+	}
+	var errs []error
+	for name, v := range raw {
+		value := fmt.Sprint(v)
+		if err := r.Set(name, value, "file"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WatchFile reloads path every interval while its modification time changes,
+// until ctx is cancelled. Load errors are logged and the previous values kept.
+func (r *Registry) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	var lastMod time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if st, err := os.Stat(path); err == nil && st.ModTime() != lastMod {
+			lastMod = st.ModTime()
+			if err := r.LoadFile(path); err != nil {
+				log.Printf("featureflags: reload %s: %v", path, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
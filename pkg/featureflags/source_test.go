@@ -0,0 +1,94 @@
+package featureflags_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gnsalok/go-projects-root/pkg/featureflags"
+)
+
+// TestLoadFile checks values of every JSON type are applied as written,
+// and invalid files or values are reported.
+func TestLoadFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		file    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "all kinds",
+			file: `{"log.bodies": true, "propagation.mode": "mapped", "batch.size": 250, "sync.interval": "90s"}`,
+			want: map[string]string{"log.bodies": "true", "propagation.mode": "mapped", "batch.size": "250", "sync.interval": "90s"},
+		},
+		{
+			name: "large number",
+			file: `{"batch.size": 1000000}`,
+			want: map[string]string{"batch.size": "1000000"},
+		},
+		{
+			name:    "fractional number",
+			file:    `{"batch.size": 1.5}`,
+			want:    map[string]string{"batch.size": "100"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown flag keeps the rest",
+			file:    `{"no.such.flag": 1, "batch.size": 7}`,
+			want:    map[string]string{"batch.size": "7"},
+			wantErr: true,
+		},
+		{name: "not an object", file: `[1, 2]`, wantErr: true},
+		{name: "trailing data", file: `{"batch.size": 7} {}`, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "flags.json")
+			if err := os.WriteFile(path, []byte(tc.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			r := newRegistry()
+			err := r.LoadFile(path)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("LoadFile() error = %v, want error %v", err, tc.wantErr)
+			}
+			for name, want := range tc.want {
+				info, err := r.Get(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Value != want {
+					t.Errorf("%s = %q, want %q", name, info.Value, want)
+				}
+			}
+		})
+	}
+}
+
+// TestLoadFileMissing checks a missing file is reported as such.
+func TestLoadFileMissing(t *testing.T) {
+	err := newRegistry().LoadFile(filepath.Join(t.TempDir(), "missing.json"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LoadFile() error = %v, want os.ErrNotExist", err)
+	}
+}
+
+// TestLoadEnv checks flags are read from their prefixed variables.
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("FF_BATCH_SIZE", "42")
+	t.Setenv("FF_PROPAGATION_MODE", "mapped")
+	r := newRegistry()
+	if err := r.LoadEnv("FF"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"batch.size": "42", "propagation.mode": "mapped", "log.bodies": "false"} {
+		if info, _ := r.Get(name); info.Value != want {
+			t.Errorf("%s = %q, want %q", name, info.Value, want)
+		}
+	}
+	if got := featureflags.EnvName("FF", "dcreds.propagation-mode"); got != "FF_DCREDS_PROPAGATION_MODE" {
+		t.Errorf("EnvName() = %q", got)
+	}
+}